@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"log/slog"
+
+	"github.com/hytromo/mimosa/internal/configuration"
+	"github.com/hytromo/mimosa/internal/hasher"
+	"github.com/hytromo/mimosa/internal/logger"
+	"github.com/hytromo/mimosa/internal/orchestration/actions"
+	"github.com/hytromo/mimosa/internal/orchestration/orchestrator"
+	"github.com/hytromo/mimosa/internal/utils/tempdir"
+	"github.com/spf13/cobra"
+)
+
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Inspect mimosa's cache",
+}
+
+var cacheDiffCmd = &cobra.Command{
+	Use:   "diff [flags] -- <command A> -- <command B> | <hash A|tag A> <hash B|tag B>",
+	Short: "Show why two commands or two cache entries get a different hash",
+	Long: `The diff subcommand hashes two docker buildx build/bake commands, without running them, and shows which of their inputs differ: the normalized command arguments, the registries, the targets and tags, and the build context files.
+
+Run diff from the same checkout (or checkouts) the pipelines run from. Builds that ran with remember --analyze-rebuilds also record their inputs in the registry, so two of their cache entries can be compared instead of the commands: pass a hash (looked up in the repository of --image) or the tag of an image that such a build pushed, for each of them.
+
+  Example:
+    mimosa cache diff -- docker buildx build --push -t org/image:v1 . -- docker buildx build --push -t org/image:v1 --build-arg VERSION=2 .
+
+    # or as two quoted command lines
+    mimosa cache diff "docker buildx bake -f a.hcl" "docker buildx bake -f b.hcl"
+
+    # or two cache entries, recorded with remember --analyze-rebuilds
+    mimosa cache diff --image org/image 40e764c8623a830fe8cc77c52b4902c7 org/image:v1`,
+	Run: func(cmd *cobra.Command, positionalArgs []string) {
+		hashAlgorithm, _ := cmd.Flags().GetString("hash-algo")
+		aggressiveNormalize, _ := cmd.Flags().GetBool("aggressive-normalize")
+		ignoreInfraFlags, _ := cmd.Flags().GetBool("ignore-infra-flags")
+		infraFlags, _ := cmd.Flags().GetStringArray("infra-flag")
+		hashBuilder, _ := cmd.Flags().GetBool("hash-builder")
+		hashBaseImages, _ := cmd.Flags().GetBool("hash-base-images")
+		pullPolicy, _ := cmd.Flags().GetString("pull-policy")
+		bakePlan, _ := cmd.Flags().GetString("bake-plan")
+		cacheScope, _ := cmd.Flags().GetString("cache-scope")
+		cacheDefaultBranch, _ := cmd.Flags().GetString("cache-default-branch")
+		debugNormalize, _ := cmd.Flags().GetBool("debug-normalize")
+		cacheTagPrefix, _ := cmd.Flags().GetString("cache-tag-prefix")
+		cacheRepository, _ := cmd.Flags().GetString("cache-repository")
+		datedCacheTags, _ := cmd.Flags().GetBool("dated-cache-tags")
+		image, _ := cmd.Flags().GetString("image")
+
+		hasher.SetNormalizationTracing(debugNormalize)
+
+		// the commands are hashed with the same options as remember
+		rememberOptions := configuration.RememberSubcommandOptions{
+			HashAlgorithm:       hashAlgorithm,
+			AggressiveNormalize: aggressiveNormalize,
+			IgnoreInfraFlags:    ignoreInfraFlags,
+			InfraFlags:          infraFlags,
+			HashBuilder:         hashBuilder,
+			HashBaseImages:      hashBaseImages,
+			PullPolicy:          pullPolicy,
+			BakePlan:            bakePlan,
+			CacheScope:          cacheScope,
+			CacheDefaultBranch:  cacheDefaultBranch,
+			CacheTagPrefix:      cacheTagPrefix,
+			CacheRepository:     cacheRepository,
+			DatedCacheTags:      datedCacheTags,
+		}
+
+		var err error
+		if entryA, entryB, ok := configuration.SplitDiffCacheEntries(positionalArgs); ok {
+			err = orchestrator.HandleDiffCacheEntriesSubcommand(rememberOptions, image, entryA, entryB, actions.New())
+		} else {
+			var commandA, commandB []string
+			commandA, commandB, err = configuration.SplitDiffCommands(positionalArgs)
+			if err == nil {
+				err = orchestrator.HandleDiffSubcommand(rememberOptions, commandA, commandB, actions.New())
+			}
+		}
+
+		if err != nil {
+			slog.Error(err.Error())
+		}
+	},
+}
+
+var cacheCleanTempCmd = &cobra.Command{
+	Use:   "clean-temp",
+	Short: "Remove the temp files left behind by runs that were killed",
+	Long:  `Every run keeps its temp files (e.g. the build context read from stdin, the checkouts of remote bake definitions) in its own dir under the mimosa temp dir, and removes it when it exits. The dirs of runs that were killed or crashed are removed by the next run anyway - clean-temp removes them right away, keeping those of the runs that are still running.`,
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, positionalArgs []string) {
+		removed, err := tempdir.CleanOrphans()
+		for _, dir := range removed {
+			logger.CleanLog.Info("removed " + dir)
+		}
+		if err != nil {
+			slog.Error("Failed to remove the temp files of earlier runs", "error", err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(cacheCmd)
+	cacheCmd.AddCommand(cacheDiffCmd)
+	cacheCmd.AddCommand(cacheCleanTempCmd)
+
+	cacheDiffCmd.Flags().String("hash-algo", string(hasher.FileHashAlgorithmImo), "Algorithm used to hash the build context files (must match the one used by remember)")
+	cacheDiffCmd.Flags().Bool("aggressive-normalize", false, "Normalize the commands like remember --aggressive-normalize does")
+	cacheDiffCmd.Flags().Bool("ignore-infra-flags", false, "Normalize the commands like remember --ignore-infra-flags does")
+	cacheDiffCmd.Flags().StringArray("infra-flag", nil, "Normalize the commands like remember --infra-flag does (repeatable)")
+	cacheDiffCmd.Flags().Bool("hash-builder", false, "Include the buildx builder in the hashes like remember --hash-builder does (runs 'docker buildx inspect')")
+	cacheDiffCmd.Flags().Bool("hash-base-images", false, "Include the digests of the base images in the hashes like remember --hash-base-images does")
+	cacheDiffCmd.Flags().String("pull-policy", "", "Hash the commands that pull like remember --pull-policy does")
+	cacheDiffCmd.Flags().String("bake-plan", "", "Hash bake commands from this pre-resolved bake definition like remember --bake-plan does")
+	cacheDiffCmd.Flags().String("cache-scope", "", "Use the cache scope of remember --cache-scope")
+	cacheDiffCmd.Flags().String("cache-default-branch", "", "Use the default branch of remember --cache-default-branch")
+	cacheDiffCmd.Flags().Bool("debug-normalize", false, "Log the normalization rule that matched every argument of the commands, like remember --debug-normalize does")
+	cacheDiffCmd.Flags().String("image", "", "The image whose repository the cache entries given as hashes are looked up in")
+	cacheDiffCmd.Flags().String("cache-tag-prefix", "", "Look up the cache entries with the cache tag prefix of remember --cache-tag-prefix")
+	cacheDiffCmd.Flags().String("cache-repository", "", "Look up the cache entries in the cache repository of remember --cache-repository")
+	cacheDiffCmd.Flags().Bool("dated-cache-tags", false, "Look up the cache entries among the dated cache tags of remember --dated-cache-tags")
+}
@@ -4,4 +4,8 @@ var (
 	dryRunFlag  = "dry-run"
 	versionFlag = "version"
 	debugFlag   = "debug"
+	quietFlag   = "quiet"
+
+	logLevelFlag  = "log-level"
+	logFormatFlag = "log-format"
 )
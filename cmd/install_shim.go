@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"errors"
+	"log/slog"
+	"os"
+
+	"github.com/hytromo/mimosa/internal/configuration"
+	"github.com/hytromo/mimosa/internal/orchestration/orchestrator"
+	"github.com/spf13/cobra"
+)
+
+var installShimCmd = &cobra.Command{
+	Use:   "install-shim docker --dir <directory> [-- <remember flags>]",
+	Short: "Install a docker wrapper that runs the builds through mimosa",
+	Long: `The install-shim subcommand writes a "docker" script into a directory that comes before the real docker in PATH, so that pipelines use mimosa without being edited: "docker build", "docker buildx build" and "docker buildx bake" run as "mimosa remember -- docker ...", and every other docker command runs the real docker as is.
+
+Set MIMOSA_SHIM_DISABLE (or MIMOSA_DISABLE) to make the shim run the real docker for everything, and MIMOSA_SHIM_DOCKER to point it to another docker. Remove the script to uninstall the shim.
+
+  Example:
+    mimosa install-shim docker --dir /usr/local/mimosa/bin
+    export PATH="/usr/local/mimosa/bin:$PATH"
+
+    # flags after -- are passed to every remember
+    mimosa install-shim docker --dir /usr/local/mimosa/bin -- --hash-base-images`,
+	Run: func(cmd *cobra.Command, positionalArgs []string) {
+		dir, _ := cmd.Flags().GetString("dir")
+		dockerPath, _ := cmd.Flags().GetString("docker")
+		force, _ := cmd.Flags().GetBool("force")
+
+		err := installShim(positionalArgs, dir, dockerPath, force)
+		if err != nil {
+			slog.Error(err.Error())
+		}
+	},
+}
+
+func installShim(positionalArgs []string, dir string, dockerPath string, force bool) error {
+	if len(positionalArgs) == 0 || positionalArgs[0] != "docker" {
+		return errors.New("only a docker shim can be installed: mimosa install-shim docker --dir <directory>")
+	}
+	if dir == "" {
+		return errors.New("--dir is required")
+	}
+
+	var err error
+	if dockerPath == "" {
+		if dockerPath, err = orchestrator.FindRealDocker(dir); err != nil {
+			return err
+		}
+	}
+
+	mimosaPath, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	return orchestrator.HandleInstallShim(configuration.InstallShimOptions{
+		Dir:          dir,
+		Force:        force,
+		MimosaPath:   mimosaPath,
+		DockerPath:   dockerPath,
+		RememberArgs: positionalArgs[1:],
+	})
+}
+
+func init() {
+	rootCmd.AddCommand(installShimCmd)
+
+	installShimCmd.Flags().String("dir", "", "Directory to write the docker shim into - it has to come before the real docker in PATH")
+	installShimCmd.Flags().String("docker", "", "Path of the real docker (default: the first docker in PATH outside of --dir)")
+	installShimCmd.Flags().Bool("force", false, "Replace an existing docker in --dir that is not a mimosa shim")
+}
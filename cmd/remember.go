@@ -1,11 +1,18 @@
 package cmd
 
 import (
+	"errors"
+	"fmt"
+	"io"
 	"log/slog"
+	"os"
 
 	"github.com/hytromo/mimosa/internal/configuration"
+	"github.com/hytromo/mimosa/internal/docker"
+	"github.com/hytromo/mimosa/internal/hasher"
 	"github.com/hytromo/mimosa/internal/orchestration/actions"
 	"github.com/hytromo/mimosa/internal/orchestration/orchestrator"
+	"github.com/hytromo/mimosa/internal/reporting"
 	"github.com/spf13/cobra"
 )
 
@@ -41,15 +48,133 @@ var rememberCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, positionalArgs []string) {
 		dryRun, _ := cmd.Flags().GetBool(dryRunFlag)
 		retagOnly, _ := cmd.Flags().GetBool("retag-only")
+		hashBuilder, _ := cmd.Flags().GetBool("hash-builder")
+		hashBaseImages, _ := cmd.Flags().GetBool("hash-base-images")
+		bakePlan, _ := cmd.Flags().GetString("bake-plan")
+		cacheScope, _ := cmd.Flags().GetString("cache-scope")
+		cacheDefaultBranch, _ := cmd.Flags().GetString("cache-default-branch")
+		cacheTagPrefix, _ := cmd.Flags().GetString("cache-tag-prefix")
+		cacheRepository, _ := cmd.Flags().GetString("cache-repository")
+		datedCacheTags, _ := cmd.Flags().GetBool("dated-cache-tags")
+		requireSignedCache, _ := cmd.Flags().GetBool("require-signed-cache")
+		noWrite, _ := cmd.Flags().GetBool("no-write")
+		pullPolicy, _ := cmd.Flags().GetString("pull-policy")
+		hashAlgorithm, _ := cmd.Flags().GetString("hash-algo")
+		aggressiveNormalize, _ := cmd.Flags().GetBool("aggressive-normalize")
+		ignoreInfraFlags, _ := cmd.Flags().GetBool("ignore-infra-flags")
+		infraFlags, _ := cmd.Flags().GetStringArray("infra-flag")
+		debugNormalize, _ := cmd.Flags().GetBool("debug-normalize")
+		batchFile, _ := cmd.Flags().GetString("batch")
+		batchConcurrency, _ := cmd.Flags().GetInt("batch-concurrency")
+		annotate, _ := cmd.Flags().GetBool("annotate")
+		rollbackFailedRetag, _ := cmd.Flags().GetBool("rollback-failed-retag")
+		verifyPush, _ := cmd.Flags().GetString("verify-push")
+		pushPatterns, _ := cmd.Flags().GetStringArray("push-pattern")
+		requirePush, _ := cmd.Flags().GetBool("require-push")
+		contextSizeWarning, _ := cmd.Flags().GetString("context-size-warning")
+		shellScript, _ := cmd.Flags().GetString("shell")
+		hashTimeout, _ := cmd.Flags().GetDuration("hash-timeout")
+		waitForCache, _ := cmd.Flags().GetDuration("wait-for-cache")
+		analyzeRebuilds, _ := cmd.Flags().GetBool("analyze-rebuilds")
+		gitlab, _ := cmd.Flags().GetBool("gitlab")
+		githubOutput, _ := cmd.Flags().GetBool("github-output")
+		githubAction, _ := cmd.Flags().GetBool("github-action")
+		reportURL, _ := cmd.Flags().GetString("report-url")
+		savingsFile, _ := cmd.Flags().GetString("savings-file")
+		auditLog, _ := cmd.Flags().GetString("audit-log")
+		digestMapFile, _ := cmd.Flags().GetString("print-digest-map")
+		hitMarker, _ := cmd.Flags().GetString("hit-marker")
+		outputTags, _ := cmd.Flags().GetStringArray("output-tag")
+		hitTagTemplate, _ := cmd.Flags().GetString("hit-tag-template")
+		quietWrapped, _ := cmd.Flags().GetBool("quiet-wrapped")
+		wrappedOutputPrefix, _ := cmd.Flags().GetString("wrapped-output-prefix")
+		wrappedOutputFile, _ := cmd.Flags().GetString("wrapped-output-file")
 
-		err := orchestrator.HandleRememberSubcommand(
-			configuration.RememberSubcommandOptions{
-				Enabled:      true,
-				DryRun:       dryRun,
-				RetagOnly:    retagOnly,
-				CommandToRun: positionalArgs,
-			},
-			actions.New())
+		docker.SetRetagAnnotations(annotate)
+		docker.SetRetagRollback(rollbackFailedRetag)
+		hasher.SetNormalizationTracing(debugNormalize)
+		reporting.Configure(reportURL, Version)
+		reporting.ConfigureSavingsFile(savingsFile)
+		reporting.ConfigureAuditLog(auditLog)
+		actions.SetCommandOutput(actions.CommandOutput{Quiet: quietWrapped, Prefix: wrappedOutputPrefix, File: wrappedOutputFile})
+
+		rememberOptions := configuration.RememberSubcommandOptions{
+			Enabled:             true,
+			DryRun:              dryRun,
+			RetagOnly:           retagOnly,
+			HashBuilder:         hashBuilder,
+			HashBaseImages:      hashBaseImages,
+			BakePlan:            bakePlan,
+			CacheScope:          cacheScope,
+			CacheDefaultBranch:  cacheDefaultBranch,
+			CacheTagPrefix:      cacheTagPrefix,
+			CacheRepository:     cacheRepository,
+			DatedCacheTags:      datedCacheTags,
+			RequireSignedCache:  requireSignedCache,
+			NoWrite:             noWrite,
+			PullPolicy:          pullPolicy,
+			HashAlgorithm:       hashAlgorithm,
+			CommandToRun:        positionalArgs,
+			AggressiveNormalize: aggressiveNormalize,
+			IgnoreInfraFlags:    ignoreInfraFlags,
+			InfraFlags:          infraFlags,
+			BatchConcurrency:    batchConcurrency,
+			VerifyPush:          verifyPush,
+			PushPatterns:        pushPatterns,
+			RequirePush:         requirePush,
+			ContextSizeWarning:  contextSizeWarning,
+			Shell:               shellScript != "",
+			HashTimeout:         hashTimeout,
+			WaitForCache:        waitForCache,
+			AnalyzeRebuilds:     analyzeRebuilds,
+			DigestMapFile:       digestMapFile,
+			HitMarker:           hitMarker,
+			OutputTags:          outputTags,
+			HitTagTemplate:      hitTagTemplate,
+		}
+		if gitlab {
+			rememberOptions.DotenvFile = orchestrator.GitLabDotenvPath()
+		}
+		if githubAction {
+			if !orchestrator.InGitHubActions() {
+				slog.Warn("--github-action is set but mimosa is not running in GitHub Actions (GITHUB_ACTIONS is not true)")
+			}
+			githubOutput = true
+			rememberOptions.GitHubStepSummaryFile = orchestrator.GitHubStepSummaryPath()
+		}
+		if githubOutput {
+			rememberOptions.GitHubOutputFile = orchestrator.GitHubOutputPath()
+			if rememberOptions.GitHubOutputFile == "" {
+				slog.Warn("--github-output is set but GITHUB_OUTPUT is not, the outputs will not be written")
+			}
+		}
+
+		var err error
+		switch {
+		case rememberOptions.Shell && (len(positionalArgs) > 0 || batchFile != ""):
+			err = errors.New("--shell cannot be combined with a command or --batch")
+		case rememberOptions.BakePlan != "" && batchFile != "":
+			err = errors.New("--bake-plan cannot be combined with --batch")
+		case len(rememberOptions.OutputTags) > 0 && batchFile != "":
+			err = errors.New("--output-tag cannot be combined with --batch")
+		case rememberOptions.AnalyzeRebuilds && batchFile != "":
+			err = errors.New("--analyze-rebuilds cannot be combined with --batch")
+		case rememberOptions.WaitForCache > 0 && batchFile != "":
+			err = errors.New("--wait-for-cache cannot be combined with --batch")
+		case gitlab && batchFile != "":
+			err = errors.New("--gitlab cannot be combined with --batch")
+		case githubAction && batchFile != "":
+			err = errors.New("--github-action cannot be combined with --batch")
+		case githubOutput && batchFile != "":
+			err = errors.New("--github-output cannot be combined with --batch")
+		case batchFile != "":
+			err = rememberBatch(rememberOptions, batchFile)
+		default:
+			if rememberOptions.Shell {
+				rememberOptions.CommandToRun = orchestrator.ShellCommand(shellScript)
+			}
+			err = orchestrator.HandleRememberSubcommand(rememberOptions, actions.New())
+		}
 
 		if err != nil {
 			slog.Error(err.Error())
@@ -57,9 +182,74 @@ var rememberCmd = &cobra.Command{
 	},
 }
 
+func rememberBatch(rememberOptions configuration.RememberSubcommandOptions, batchFile string) error {
+	if len(rememberOptions.CommandToRun) > 0 {
+		return errors.New("--batch cannot be combined with a command")
+	}
+
+	var content []byte
+	var err error
+	if batchFile == "-" {
+		content, err = io.ReadAll(os.Stdin)
+	} else {
+		content, err = os.ReadFile(batchFile)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read batch file: %w", err)
+	}
+
+	commands, err := configuration.ParseBatchCommands(content)
+	if err != nil {
+		return err
+	}
+
+	return orchestrator.HandleRememberBatch(rememberOptions, commands, actions.New())
+}
+
 func init() {
 	rootCmd.AddCommand(rememberCmd)
 
 	rememberCmd.Flags().BoolP(dryRunFlag, "", false, "Dry run - do not really build or push anything - just show if it would be a cache hit or not")
 	rememberCmd.Flags().Bool("retag-only", false, "On cache miss do not run the real build; on cache hit, retag")
+	rememberCmd.Flags().String("hash-algo", string(hasher.FileHashAlgorithmImo), "Algorithm used to hash the build context files: imo (fast, samples large files), sha256 (full content, correctness first) or xxh3 (full content, fast)")
+	rememberCmd.Flags().Bool("aggressive-normalize", false, "Ignore values that look run-specific (temp dirs, CI run URLs, UUIDs) in any flag when hashing the command")
+	rememberCmd.Flags().Bool("ignore-infra-flags", false, "Ignore the values that depend on the runner in the default infrastructure flags (the IPs of --add-host, --cgroup-parent) when hashing the command")
+	rememberCmd.Flags().StringArray("infra-flag", nil, "Ignore the values of this build flag too when hashing the command, e.g. --infra-flag=--dns (repeatable)")
+	rememberCmd.Flags().Bool("debug-normalize", false, "Log, for every argument of the command, the normalization rule that matched it (discarded, templated, kept, sorted position) and what it was hashed as")
+	rememberCmd.Flags().String("batch", "", "Run many builds from a file (or - for stdin): one command per line, or a JSON array of commands - all the builds are hashed and checked against the cache first, then only the misses are run")
+	rememberCmd.Flags().String("shell", "", "Run a shell script instead of a command, e.g. 'docker build -t org/app:v1 . && docker push org/app:v1': its first docker build command is hashed, and the whole script runs with sh -c on cache miss")
+	rememberCmd.Flags().Int("batch-concurrency", 1, "How many builds of a batch can run at the same time")
+	rememberCmd.Flags().Bool("annotate", false, "On cache hit, add the "+docker.CacheHashAnnotation+" and "+docker.OriginalTagAnnotation+" annotations to the retagged index/image (changes its digest, layers stay the same)")
+	rememberCmd.Flags().Bool("rollback-failed-retag", false, "When retagging from the cache fails for some of the tags, point the tags already retagged back to their previous image (or delete them if they are new) before running the command")
+	rememberCmd.Flags().Bool("require-push", false, "Fail without running the command if it does not push to a registry (--push or --output type=registry), instead of running it without caching")
+	rememberCmd.Flags().String("verify-push", "", "On cache miss, check that the command output shows all the tags as pushed before saving the cache tags: warn or fail (the command output is then no longer written straight to the terminal)")
+	rememberCmd.Flags().StringArray("push-pattern", []string{}, "Extra regex matching a pushed image reference in the command output, captured by its first group (buildx's \"pushing manifest for\" lines are built in)")
+	rememberCmd.Flags().StringArray("output-tag", []string{}, "Create this tag ([target=]tag, in the registry of a tag of the target) instead of the tags of the command, which are then only where the cache is looked up and saved - e.g. build with a temporary tag and publish the release tag")
+	rememberCmd.Flags().String("hit-tag-template", "", "On cache hit, create the tags named by this Go template instead of the tags of the command, e.g. '{{.Original}}-cached' ({{.Original}}, {{.Repository}}, {{.Tag}}, {{.Hash}}, {{.Target}}), to tell retagged images apart from built ones")
+	rememberCmd.Flags().String("hit-marker", "", "On cache hit, print this line to stdout, once per tag if it contains {tag}, e.g. 'CACHED {tag}'")
+	rememberCmd.Flags().Bool("quiet-wrapped", false, "Do not show the output of the command in the terminal - it is still written to --wrapped-output-file")
+	rememberCmd.Flags().String("wrapped-output-prefix", "", "Prefix every line of the command output with this, e.g. '[api] '")
+	rememberCmd.Flags().String("wrapped-output-file", "", "Also append the command output to this file, e.g. to keep it as a CI artifact")
+	rememberCmd.Flags().String("context-size-warning", "500MB", "Warn when the files of the build contexts that are not ignored are larger than this - 0 disables the warning")
+	rememberCmd.Flags().Duration("hash-timeout", 0, "Give up hashing after this long (e.g. 30s) and run the command without caching - 0 never gives up")
+	rememberCmd.Flags().Duration("wait-for-cache", 0, "On a cache miss, wait up to this long (e.g. 5m) for another job building the same hash (e.g. of a CI matrix) to save the cache, instead of building too - 0 never waits")
+	rememberCmd.Flags().Bool("analyze-rebuilds", false, "After a cache miss is pushed, report whether an earlier build of a different hash pushed the very same image (a rebuild that the hash made necessary) and which flags and files made the hashes differ - the inputs of every build are recorded next to its cache tags")
+	rememberCmd.Flags().Bool("github-output", false, "Append cache-hit, hash and tags to GITHUB_OUTPUT, to be used as the outputs of the GitHub Actions step")
+	rememberCmd.Flags().Bool("github-action", false, "Run as a GitHub Actions step: --github-output, plus the cache decision, the hash and the tags in the job summary (GITHUB_STEP_SUMMARY)")
+	rememberCmd.Flags().Bool("gitlab", false, "Write MIMOSA_CACHE_HIT and MIMOSA_HASH to mimosa.env in CI_PROJECT_DIR, to be used as the artifacts:reports:dotenv of the GitLab CI job")
+	rememberCmd.Flags().String("report-url", "", "POST an anonymized JSON record of every build (hashed repository, cache hit, build seconds, mimosa version) to this URL after the run")
+	rememberCmd.Flags().String("print-digest-map", "", "Write a JSON map of every tag of the build to the digest it points to, after a cache hit or a pushed build, to pin deployments by digest")
+	rememberCmd.Flags().String("savings-file", "", "Append a JSON line for every build (repositories, hash, cache hit, build seconds) to this file, for the savings subcommand")
+	rememberCmd.Flags().String("audit-log", "", "Append a JSON line for every significant action (hash computed, cache lookup, cache saved, every tag written to or deleted from a registry) to this file")
+	rememberCmd.Flags().Bool("hash-builder", false, "Include the buildx builder's driver, buildkit version and platforms in the hash (runs 'docker buildx inspect')")
+	rememberCmd.Flags().Bool("hash-base-images", false, "Resolve the FROM images of the Dockerfiles to their digests and include them in the hash, so that a moved base tag (e.g. alpine:latest) is a cache miss (one registry call per base image)")
+	rememberCmd.Flags().String("bake-plan", "", "Hash bake commands from this pre-resolved bake definition (the JSON of docker buildx bake --print) instead of resolving the bake files and --set overrides of the command")
+	rememberCmd.Flags().String("cache-scope", "", "Scope of the cache tags: \"branch\" saves them per git branch (except on the default branch) and falls back to the default branch's cache tags on lookups")
+	rememberCmd.Flags().String("cache-default-branch", "", "The branch whose cache tags are shared by all branches with --cache-scope branch (default: CI_DEFAULT_BRANCH or main)")
+	rememberCmd.Flags().String("cache-tag-prefix", "", "Prefix of the cache tags, which the hash follows (default: mimosa-content-hash-)")
+	rememberCmd.Flags().String("cache-repository", "", "Save all the cache tags in this repository (e.g. org/mimosa-cache, in the registry of each image) instead of next to the images")
+	rememberCmd.Flags().Bool("dated-cache-tags", false, "End new cache tags with their creation date (-yyyymmdd) so that registry lifecycle rules can expire them, and find the newest cache tag of any date on lookups")
+	rememberCmd.Flags().Bool("require-signed-cache", false, "Treat the cache tags that are not signed with the key in MIMOSA_CACHE_SIGNING_KEY as cache misses (with the key set, cache tags are always signed, and the ones with an invalid signature are never used)")
+	rememberCmd.Flags().Bool("no-write", false, "Never write to the cache, e.g. in untrusted pull request builds: cache hits are retagged to the tags of the command, cache misses are built without saving cache tags (nor signatures, --wait-for-cache announcements or --analyze-rebuilds inputs)")
+	rememberCmd.Flags().String("pull-policy", "", "What --pull means for the cache: \"miss\" always rebuilds commands that pull, \"resolve\" includes the digests of their base images in the hash (default: --pull does not affect the cache)")
 }
@@ -1,9 +1,11 @@
 package cmd
 
 import (
+	"log/slog"
 	"os"
 
 	"github.com/hytromo/mimosa/internal/logger"
+	"github.com/hytromo/mimosa/internal/utils/tempdir"
 	"github.com/spf13/cobra"
 )
 
@@ -11,14 +13,27 @@ var rootCmd = &cobra.Command{
 	Use:   "mimosa",
 	Short: "Zero-config Docker image promotion",
 	Long:  `Mimosa saves a unique hash for each docker build - if it bumps into the same exact build, it will simply retag your image instead of rebuilding it.`,
-	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
 		forceDebug, _ := cmd.Flags().GetBool(debugFlag)
-		logger.InitLogging(forceDebug)
+		quiet, _ := cmd.Flags().GetBool(quietFlag)
+		logLevel, _ := cmd.Flags().GetString(logLevelFlag)
+		logFormat, _ := cmd.Flags().GetString(logFormatFlag)
+		if err := logger.InitLogging(forceDebug, logLevel, logFormat); err != nil {
+			return err
+		}
+		logger.InitProgress(quiet)
+		if removed, err := tempdir.CleanOrphans(); err != nil {
+			slog.Debug("Failed to remove the temp files of earlier runs", "error", err)
+		} else if len(removed) > 0 {
+			slog.Debug("Removed the temp files of earlier runs that did not exit cleanly", "dirs", removed)
+		}
+		return nil
 	},
 }
 
 func Execute() {
 	err := rootCmd.Execute()
+	tempdir.Cleanup()
 	if err != nil {
 		os.Exit(1)
 	}
@@ -26,4 +41,7 @@ func Execute() {
 
 func init() {
 	rootCmd.PersistentFlags().Bool(debugFlag, false, "Show debug logs")
+	rootCmd.PersistentFlags().String(logLevelFlag, "", "Log level: debug, info, warn or error (defaults to LOG_LEVEL, or info)")
+	rootCmd.PersistentFlags().String(logFormatFlag, "", "Log format: text or json (defaults to LOG_FORMAT, or text) - logs always go to stderr")
+	rootCmd.PersistentFlags().Bool(quietFlag, false, "Do not show progress (it is never shown when stderr is not a terminal)")
 }
@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"errors"
+	"log/slog"
+
+	"github.com/hytromo/mimosa/internal/orchestration/orchestrator"
+	"github.com/spf13/cobra"
+)
+
+var savingsCmd = &cobra.Command{
+	Use:   "savings --file <savings file>",
+	Short: "Report the build time saved by the cache",
+	Long: `The savings subcommand sums up the builds that remember --savings-file recorded, per repository: how many hit and missed the cache, how long the misses ran, and how long the hits would have run - the duration of the miss that built the same hash, or the average duration of the misses of the repository.
+
+  Example:
+    mimosa remember --savings-file ~/.mimosa-savings.jsonl -- docker buildx build --push -t org/image:v1 .
+
+    # the savings of the last 30 days
+    mimosa savings --file ~/.mimosa-savings.jsonl --since 720h`,
+	Run: func(cmd *cobra.Command, positionalArgs []string) {
+		file, _ := cmd.Flags().GetString("file")
+		since, _ := cmd.Flags().GetDuration("since")
+
+		var err error
+		if file == "" {
+			err = errors.New("--file is required")
+		} else {
+			err = orchestrator.HandleSavingsSubcommand(file, since)
+		}
+
+		if err != nil {
+			slog.Error(err.Error())
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(savingsCmd)
+
+	savingsCmd.Flags().String("file", "", "The savings file that remember --savings-file writes")
+	savingsCmd.Flags().Duration("since", 0, "Only report the builds of this last period, e.g. 168h (default: all the builds of the file)")
+}
@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/hytromo/mimosa/internal/configuration"
+	"github.com/hytromo/mimosa/internal/docker"
+	"github.com/hytromo/mimosa/internal/hasher"
+	"github.com/hytromo/mimosa/internal/orchestration/actions"
+	"github.com/hytromo/mimosa/internal/orchestration/orchestrator"
+	"github.com/spf13/cobra"
+)
+
+const defaultSyncInterval = 30 * time.Second
+
+var syncCmd = &cobra.Command{
+	Use:   "sync --dir <build specs directory>",
+	Short: "Continuously reconcile a directory of build specs",
+	Long: `The sync subcommand watches a directory of declarative build specs (*.yaml/*.yml files) and reconciles them continuously, like remember --batch with all of them: every spec is hashed, retagged on cache hit and built on cache miss. Specs whose hash has not changed since the last pass are left alone.
+
+A build spec holds the command to run and, optionally, tags and a context that are appended to it:
+
+    command: docker buildx build --push --platform linux/amd64,linux/arm64
+    tags:
+      - myregistry/app:v1
+    context: ./app
+
+  Example:
+    # reconcile every 30 seconds
+    mimosa sync --dir builds/
+
+    # reconcile once and exit, e.g. in CI
+    mimosa sync --dir builds/ --once`,
+	Run: func(cmd *cobra.Command, positionalArgs []string) {
+		dir, _ := cmd.Flags().GetString("dir")
+		interval, _ := cmd.Flags().GetDuration("interval")
+		once, _ := cmd.Flags().GetBool("once")
+		dryRun, _ := cmd.Flags().GetBool(dryRunFlag)
+		hashAlgorithm, _ := cmd.Flags().GetString("hash-algo")
+		aggressiveNormalize, _ := cmd.Flags().GetBool("aggressive-normalize")
+		ignoreInfraFlags, _ := cmd.Flags().GetBool("ignore-infra-flags")
+		infraFlags, _ := cmd.Flags().GetStringArray("infra-flag")
+		batchConcurrency, _ := cmd.Flags().GetInt("batch-concurrency")
+		annotate, _ := cmd.Flags().GetBool("annotate")
+		contextSizeWarning, _ := cmd.Flags().GetString("context-size-warning")
+
+		var err error
+		if dir == "" {
+			err = errors.New("--dir is required")
+		} else {
+			docker.SetRetagAnnotations(annotate)
+			err = orchestrator.HandleSyncSubcommand(configuration.SyncSubcommandOptions{
+				Dir:      dir,
+				Interval: interval,
+				Once:     once,
+				Remember: configuration.RememberSubcommandOptions{
+					Enabled:             true,
+					DryRun:              dryRun,
+					HashAlgorithm:       hashAlgorithm,
+					AggressiveNormalize: aggressiveNormalize,
+					IgnoreInfraFlags:    ignoreInfraFlags,
+					InfraFlags:          infraFlags,
+					BatchConcurrency:    batchConcurrency,
+					ContextSizeWarning:  contextSizeWarning,
+				},
+			}, actions.New())
+		}
+
+		if err != nil {
+			slog.Error(err.Error())
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(syncCmd)
+
+	syncCmd.Flags().String("dir", "", "Directory of the build specs (*.yaml/*.yml)")
+	syncCmd.Flags().Duration("interval", defaultSyncInterval, "How often the build specs are reconciled")
+	syncCmd.Flags().Bool("once", false, "Reconcile once and exit with the exit code of the first failed build")
+	syncCmd.Flags().BoolP(dryRunFlag, "", false, "Dry run - do not really build or push anything - just show if it would be a cache hit or not")
+	syncCmd.Flags().String("hash-algo", string(hasher.FileHashAlgorithmImo), "Algorithm used to hash the build context files: imo (fast, samples large files), sha256 (full content, correctness first) or xxh3 (full content, fast)")
+	syncCmd.Flags().Bool("aggressive-normalize", false, "Ignore values that look run-specific (temp dirs, CI run URLs, UUIDs) in any flag when hashing the command")
+	syncCmd.Flags().Bool("ignore-infra-flags", false, "Ignore the values that depend on the runner in the default infrastructure flags (the IPs of --add-host, --cgroup-parent) when hashing the command")
+	syncCmd.Flags().StringArray("infra-flag", nil, "Ignore the values of this build flag too when hashing the command, e.g. --infra-flag=--dns (repeatable)")
+	syncCmd.Flags().Int("batch-concurrency", 1, "How many builds can run at the same time")
+	syncCmd.Flags().Bool("annotate", false, "On cache hit, add the "+docker.CacheHashAnnotation+" and "+docker.OriginalTagAnnotation+" annotations to the retagged index/image (changes its digest, layers stay the same)")
+	syncCmd.Flags().String("context-size-warning", "500MB", "Warn when the files of the build contexts that are not ignored are larger than this - 0 disables the warning")
+}
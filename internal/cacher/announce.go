@@ -0,0 +1,160 @@
+package cacher
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/hytromo/mimosa/internal/docker"
+)
+
+const (
+	// the announcement of a build is pushed next to the cache tag of its first tag, as an empty image with the
+	// announcement annotations
+	announcementTagSuffix    = ".lock"
+	AnnouncedUntilAnnotation = "io.mimosa/build-announced-until"
+	AnnouncerAnnotation      = "io.mimosa/build-announcer"
+)
+
+// the id that the announcements of this run are signed with, to tell them apart from the ones of the other builds
+var announcerID = newAnnouncerID()
+
+func newAnnouncerID() string {
+	id := make([]byte, 8)
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// announcement is a build announced with its announcement tag
+type announcement struct {
+	until     time.Time
+	announcer string
+}
+
+// active reports whether the announced build is still running
+func (a announcement) active() bool {
+	return now().Before(a.until)
+}
+
+// ours reports whether the announcement is the one of this run
+func (a announcement) ours() bool {
+	return a.announcer == announcerID
+}
+
+// announcementTag returns the tag that announces the build of the hash
+func (rc *RegistryCache) announcementTag() (string, error) {
+	for _, targetName := range slices.Sorted(maps.Keys(rc.TagsByTarget)) {
+		if tags := rc.TagsByTarget[targetName]; len(tags) > 0 {
+			cacheTag, err := rc.GetCacheTagForRegistry(tags[0])
+			if err != nil {
+				return "", err
+			}
+			return cacheTag + announcementTagSuffix, nil
+		}
+	}
+	return "", errors.New("no tags to announce the build with")
+}
+
+// readAnnouncement returns the announcement of the announcement tag - an invalid announcement or none at all is an
+// announcement that is no longer active
+func (rc *RegistryCache) readAnnouncement(announcementTag string) (announcement, error) {
+	annotations, found, err := docker.ArtifactAnnotations(rc.DockerConfigDir, announcementTag)
+	if err != nil || !found {
+		return announcement{}, err
+	}
+	until, err := time.Parse(time.RFC3339, annotations[AnnouncedUntilAnnotation])
+	if err != nil {
+		return announcement{}, nil
+	}
+	return announcement{until: until, announcer: annotations[AnnouncerAnnotation]}, nil
+}
+
+func (rc *RegistryCache) writeAnnouncement(announcementTag string, until time.Time) error {
+	return docker.WriteAnnotationArtifact(rc.DockerConfigDir, announcementTag, map[string]string{
+		AnnouncedUntilAnnotation: until.UTC().Format(time.RFC3339),
+		AnnouncerAnnotation:      announcerID,
+	})
+}
+
+// Announce announces that the hash is being built, for the next ttl - unless another build has already announced it
+// and its announcement is still active, in which case nothing is announced and the time the other build announced
+// itself until is returned. The zero time is returned when this build announced itself, or announces nothing as a
+// read-only cache does. The announcement is read back once written, so that of two builds announcing themselves at
+// the same time, the one whose announcement was overwritten waits for the other
+func (rc *RegistryCache) Announce(ttl time.Duration, dryRun bool) (time.Time, error) {
+	announcementTag, err := rc.announcementTag()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	current, err := rc.readAnnouncement(announcementTag)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if current.active() && !current.ours() {
+		slog.Info("Another build of the same hash is running", "announcement", announcementTag, "until", current.until)
+		return current.until, nil
+	}
+
+	if readOnly {
+		// the build still waits for the builds that announced themselves, but never announces itself
+		slog.Debug("Not announcing the build, the cache is read-only", "announcement", announcementTag)
+		return time.Time{}, nil
+	}
+	if dryRun {
+		slog.Info("> DRY RUN: would announce the build", "announcement", announcementTag, "ttl", ttl)
+		return time.Time{}, nil
+	}
+	slog.Debug("Announcing the build", "announcement", announcementTag, "ttl", ttl)
+	if err := rc.writeAnnouncement(announcementTag, now().Add(ttl)); err != nil {
+		return time.Time{}, err
+	}
+
+	written, err := rc.readAnnouncement(announcementTag)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if written.active() && !written.ours() {
+		slog.Info("Another build of the same hash announced itself at the same time", "announcement", announcementTag, "until", written.until)
+		return written.until, nil
+	}
+	return time.Time{}, nil
+}
+
+// AnnouncedUntil returns the time that the build of the hash is announced until, or the zero time when no build is
+// announced anymore: it saved the cache, gave up on it (see Withdraw) or its announcement expired
+func (rc *RegistryCache) AnnouncedUntil() (time.Time, error) {
+	announcementTag, err := rc.announcementTag()
+	if err != nil {
+		return time.Time{}, err
+	}
+	current, err := rc.readAnnouncement(announcementTag)
+	if err != nil || !current.active() {
+		return time.Time{}, err
+	}
+	return current.until, nil
+}
+
+// Withdraw expires the announcement of this run when its build will not save the cache (e.g. the build failed), so
+// that the builds waiting for it stop waiting right away instead of until the announcement expires
+func (rc *RegistryCache) Withdraw() error {
+	announcementTag, err := rc.announcementTag()
+	if err != nil {
+		return err
+	}
+	current, err := rc.readAnnouncement(announcementTag)
+	if err != nil {
+		return err
+	}
+	// read-only caches and dry runs never announce the build, there is nothing to withdraw for them
+	if !current.active() || !current.ours() {
+		return nil
+	}
+
+	slog.Debug("Withdrawing the announcement of the build", "announcement", announcementTag)
+	return rc.writeAnnouncement(announcementTag, now())
+}
@@ -0,0 +1,85 @@
+package cacher
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hytromo/mimosa/internal/docker"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// asAnotherBuild makes the announcements be made by another build until the test ends
+func asAnotherBuild(t *testing.T) {
+	t.Helper()
+	ours := announcerID
+	announcerID = newAnnouncerID()
+	t.Cleanup(func() {
+		announcerID = ours
+	})
+}
+
+func TestRegistryCache_Announce(t *testing.T) {
+	registryHost := startInMemoryRegistry(t)
+	t.Cleanup(func() {
+		now = time.Now
+		docker.ForgetRegistryState()
+	})
+	registryCache := &RegistryCache{Hash: testHexHashRegistry, TagsByTarget: map[string][]string{"default": {registryHost + "/app:v1"}}}
+
+	// a dry run announces nothing
+	until, err := registryCache.Announce(time.Minute, true)
+	require.NoError(t, err)
+	assert.True(t, until.IsZero())
+	_, found, err := docker.ArtifactAnnotations("", registryHost+"/app:"+CacheTagPrefix+testHexHashRegistry+announcementTagSuffix)
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	until, err = registryCache.Announce(time.Minute, false)
+	require.NoError(t, err)
+	assert.True(t, until.IsZero(), "the first build announces itself")
+
+	docker.ForgetRegistryState()
+	until, err = registryCache.Announce(time.Minute, false)
+	require.NoError(t, err)
+	assert.True(t, until.IsZero(), "the build that announced itself does not wait for itself")
+
+	asAnotherBuild(t)
+	docker.ForgetRegistryState()
+	until, err = registryCache.Announce(time.Minute, false)
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), until, 2*time.Second, "the other builds find the announcement")
+
+	// an expired announcement is replaced
+	now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	docker.ForgetRegistryState()
+	until, err = registryCache.Announce(time.Minute, false)
+	require.NoError(t, err)
+	assert.True(t, until.IsZero())
+}
+
+func TestRegistryCache_WithdrawStopsTheWaiting(t *testing.T) {
+	registryHost := startInMemoryRegistry(t)
+	t.Cleanup(docker.ForgetRegistryState)
+	registryCache := &RegistryCache{Hash: testHexHashRegistry, TagsByTarget: map[string][]string{"default": {registryHost + "/app:v1"}}}
+
+	until, err := registryCache.Announce(time.Minute, false)
+	require.NoError(t, err)
+	require.True(t, until.IsZero())
+
+	// another build can not withdraw the announcement
+	ours := announcerID
+	announcerID = newAnnouncerID()
+	require.NoError(t, registryCache.Withdraw())
+	announcerID = ours
+	docker.ForgetRegistryState()
+	until, err = registryCache.AnnouncedUntil()
+	require.NoError(t, err)
+	assert.False(t, until.IsZero())
+
+	require.NoError(t, registryCache.Withdraw())
+	docker.ForgetRegistryState()
+	until, err = registryCache.AnnouncedUntil()
+	require.NoError(t, err)
+	assert.True(t, until.IsZero(), "the waiting builds find no announced build anymore")
+}
@@ -0,0 +1,75 @@
+package cacher
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hytromo/mimosa/internal/docker"
+	"github.com/hytromo/mimosa/internal/hasher"
+	"github.com/hytromo/mimosa/internal/utils/dockerutil"
+)
+
+const (
+	// the inputs of a build are pushed next to its cache tags, under a tag named after the digest of the image it
+	// pushed, as an empty image with the inputs annotation
+	buildInputsTagInfix   = "inputs-"
+	BuildInputsAnnotation = "io.mimosa/build-inputs"
+)
+
+// BuildInputs are the hash of a build and what it was calculated from
+type BuildInputs struct {
+	Hash       string                 `json:"hash"`
+	Breakdowns []hasher.HashBreakdown `json:"breakdowns"`
+}
+
+// buildInputsTag returns the tag that keeps the inputs of the build that pushed the digest to the tag
+func buildInputsTag(tag string, digest string) (string, error) {
+	parsed, err := dockerutil.ParseTag(tag)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse tag %s: %w", tag, err)
+	}
+	_, digestHex, found := strings.Cut(digest, ":")
+	if !found || digestHex == "" {
+		return "", fmt.Errorf("invalid digest %q", digest)
+	}
+
+	registry, imageName, _ := docker.CacheRepositoryFor(parsed.Registry, parsed.ImageName)
+	return fmt.Sprintf("%s/%s:%s%s%s", registry, imageName, docker.CurrentCacheTagPrefix(), buildInputsTagInfix, digestHex), nil
+}
+
+// RecordedBuildInputs returns the inputs recorded by the last build that pushed the digest to the repository of the tag
+func RecordedBuildInputs(dockerConfigDir string, tag string, digest string) (BuildInputs, bool, error) {
+	inputsTag, err := buildInputsTag(tag, digest)
+	if err != nil {
+		return BuildInputs{}, false, err
+	}
+
+	annotations, found, err := docker.ArtifactAnnotations(dockerConfigDir, inputsTag)
+	if err != nil || !found {
+		return BuildInputs{}, false, err
+	}
+
+	var inputs BuildInputs
+	if err := json.Unmarshal([]byte(annotations[BuildInputsAnnotation]), &inputs); err != nil {
+		return BuildInputs{}, false, fmt.Errorf("invalid build inputs in %s: %w", inputsTag, err)
+	}
+	return inputs, true, nil
+}
+
+// RecordBuildInputs records the inputs of the build that pushed the digest to the repository of the tag
+func RecordBuildInputs(dockerConfigDir string, tag string, digest string, inputs BuildInputs) error {
+	if readOnly {
+		return ErrReadOnlyCache
+	}
+	inputsTag, err := buildInputsTag(tag, digest)
+	if err != nil {
+		return err
+	}
+
+	content, err := json.Marshal(inputs)
+	if err != nil {
+		return err
+	}
+	return docker.WriteAnnotationArtifact(dockerConfigDir, inputsTag, map[string]string{BuildInputsAnnotation: string(content)})
+}
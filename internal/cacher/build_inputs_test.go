@@ -0,0 +1,46 @@
+package cacher
+
+import (
+	"testing"
+
+	"github.com/hytromo/mimosa/internal/docker"
+	"github.com/hytromo/mimosa/internal/hasher"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildInputs_RecordAndRead(t *testing.T) {
+	registryHost := startInMemoryRegistry(t)
+	t.Cleanup(docker.ForgetRegistryState)
+	tag := registryHost + "/app:v1"
+	digest := "sha256:" + testHexHashRegistry
+
+	_, found, err := RecordedBuildInputs("", tag, digest)
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	inputs := BuildInputs{
+		Hash: "abc",
+		Breakdowns: []hasher.HashBreakdown{{
+			Name:    "default",
+			Command: []string{"docker", "build", "--build-arg", "VERSION=1", "."},
+			Files:   map[string]string{"Dockerfile": "1234"},
+			Hash:    "abc",
+		}},
+	}
+	require.NoError(t, RecordBuildInputs("", tag, digest, inputs))
+
+	recorded, found, err := RecordedBuildInputs("", registryHost+"/app:v2", digest)
+	require.NoError(t, err)
+	assert.True(t, found, "the inputs are kept per repository, whatever the tag")
+	assert.Equal(t, inputs, recorded)
+
+	_, found, err = docker.ArtifactAnnotations("", registryHost+"/app:"+CacheTagPrefix+buildInputsTagInfix+testHexHashRegistry)
+	require.NoError(t, err)
+	assert.True(t, found)
+}
+
+func TestBuildInputsTag_InvalidDigest(t *testing.T) {
+	_, err := buildInputsTag("myreg1/app:v1", "not-a-digest")
+	assert.ErrorContains(t, err, "invalid digest")
+}
@@ -0,0 +1,75 @@
+package cacher
+
+import (
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/hytromo/mimosa/internal/docker"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func useCacheRepository(t *testing.T, prefix string, repository string) {
+	t.Helper()
+	require.NoError(t, docker.SetCacheTagPrefix(prefix))
+	require.NoError(t, docker.SetCacheRepository(repository))
+	t.Cleanup(func() {
+		_ = docker.SetCacheTagPrefix("")
+		_ = docker.SetCacheRepository("")
+	})
+}
+
+func digestOf(t *testing.T, tag string) string {
+	t.Helper()
+	ref, err := name.ParseReference(tag)
+	require.NoError(t, err)
+	desc, err := remote.Get(ref)
+	require.NoError(t, err)
+	return desc.Digest.String()
+}
+
+func TestRegistryCache_GetCacheTagForRegistry_WithPrefix(t *testing.T) {
+	useCacheRepository(t, "cache-", "")
+	registryCache := &RegistryCache{Hash: testHexHashRegistry}
+
+	cacheTag, err := registryCache.GetCacheTagForRegistry("myregistry.com/app:v1")
+	require.NoError(t, err)
+	assert.Equal(t, "myregistry.com/app:cache-"+testHexHashRegistry, cacheTag)
+}
+
+func TestRegistryCache_GetCacheTagForRegistry_WithCacheRepository(t *testing.T) {
+	useCacheRepository(t, "", "org/mimosa-cache")
+	registryCache := &RegistryCache{Hash: testHexHashRegistry}
+
+	apiCacheTag, err := registryCache.GetCacheTagForRegistry("myregistry.com/org/api:v1")
+	require.NoError(t, err)
+	webCacheTag, err := registryCache.GetCacheTagForRegistry("myregistry.com/org/web:v1")
+	require.NoError(t, err)
+
+	assert.Contains(t, apiCacheTag, "myregistry.com/org/mimosa-cache:"+CacheTagPrefix+testHexHashRegistry+"-")
+	assert.Contains(t, webCacheTag, "myregistry.com/org/mimosa-cache:"+CacheTagPrefix+testHexHashRegistry+"-")
+	assert.NotEqual(t, apiCacheTag, webCacheTag, "the targets of a bake command must not share a cache tag")
+}
+
+func TestRegistryCache_CacheRepositoryRoundTrip(t *testing.T) {
+	registryHost := startInMemoryRegistry(t)
+	useCacheRepository(t, "", "org/mimosa-cache")
+	newTag := registryHost + "/org/api:v1"
+	registryCache := &RegistryCache{Hash: testHexHashRegistry, TagsByTarget: map[string][]string{"default": {newTag}}}
+
+	pushRandomImage(t, newTag)
+	require.NoError(t, registryCache.SaveCacheTags(false))
+
+	exists, pairs, err := registryCache.Exists()
+	require.NoError(t, err)
+	require.True(t, exists)
+	cacheTag := pairs["default"][0].CacheTag
+	assert.Contains(t, cacheTag, registryHost+"/org/mimosa-cache:")
+	assert.Equal(t, digestOf(t, newTag), digestOf(t, cacheTag), "the image is copied to the cache repository as is")
+
+	// a later run retags from the cache repository back to the image repository
+	retaggedTag := registryHost + "/org/api:v2"
+	require.NoError(t, docker.RetagSingleTag("", cacheTag, retaggedTag, false))
+	assert.Equal(t, digestOf(t, newTag), digestOf(t, retaggedTag))
+}
@@ -0,0 +1,64 @@
+package cacher
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/hytromo/mimosa/internal/docker"
+	"github.com/hytromo/mimosa/internal/utils/dockerutil"
+)
+
+// the layout of the creation date that dated cache tags end with
+const cacheTagDateLayout = "20060102"
+
+var (
+	datedCacheTags = false
+	// the date that new dated cache tags get
+	now = time.Now
+	// the date suffix of a dated cache tag
+	cacheTagDateSuffix = regexp.MustCompile(`^-[0-9]{8}$`)
+)
+
+// SetDatedCacheTags makes new cache tags end with their creation date (mimosa-content-hash-<hash>-<yyyymmdd>), so that
+// registry lifecycle rules can expire them by age, while lookups match the cache tags of any date by prefix
+func SetDatedCacheTags(enabled bool) {
+	datedCacheTags = enabled
+}
+
+// datedCacheTag returns the cache tag to save: the cache tag itself, or the cache tag dated today
+func datedCacheTag(cacheTag string) string {
+	if !datedCacheTags {
+		return cacheTag
+	}
+	return cacheTag + "-" + now().UTC().Format(cacheTagDateLayout)
+}
+
+// findDatedCacheTag returns the newest cache tag of the repository that is the cache tag itself or the cache tag with a
+// date, so that lookups keep finding undated cache tags saved before dated cache tags were turned on
+func findDatedCacheTag(dockerConfigDir string, cacheTag string) (string, bool, error) {
+	parsed, err := dockerutil.ParseTag(cacheTag)
+	if err != nil {
+		return "", false, err
+	}
+
+	tags, err := docker.ListTags(dockerConfigDir, parsed.Registry+"/"+parsed.ImageName)
+	if err != nil {
+		return "", false, err
+	}
+
+	matching := []string{}
+	for _, tag := range tags {
+		suffix, found := strings.CutPrefix(tag, parsed.Tag)
+		if found && (suffix == "" || cacheTagDateSuffix.MatchString(suffix)) {
+			matching = append(matching, tag)
+		}
+	}
+	if len(matching) == 0 {
+		return cacheTag, false, nil
+	}
+
+	// the dates sort like the tags do, and undated cache tags are the oldest
+	return parsed.Registry + "/" + parsed.ImageName + ":" + slices.Max(matching), true, nil
+}
@@ -0,0 +1,75 @@
+package cacher
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hytromo/mimosa/internal/docker"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func useDatedCacheTags(t *testing.T, date time.Time) {
+	t.Helper()
+	SetDatedCacheTags(true)
+	now = func() time.Time { return date }
+	t.Cleanup(func() {
+		SetDatedCacheTags(false)
+		now = time.Now
+		docker.ForgetRegistryState()
+	})
+}
+
+func TestRegistryCache_DatedCacheTagsRoundTrip(t *testing.T) {
+	registryHost := startInMemoryRegistry(t)
+	useDatedCacheTags(t, time.Date(2026, 3, 9, 23, 0, 0, 0, time.UTC))
+	newTag := registryHost + "/app:v1"
+	cacheTag := registryHost + "/app:" + CacheTagPrefix + testHexHashRegistry
+	registryCache := &RegistryCache{Hash: testHexHashRegistry, TagsByTarget: map[string][]string{"default": {newTag}}}
+
+	exists, _, err := registryCache.Exists()
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	pushRandomImage(t, newTag)
+	require.NoError(t, registryCache.SaveCacheTags(false))
+	docker.ForgetRegistryState()
+
+	exists, pairs, err := registryCache.Exists()
+	require.NoError(t, err)
+	assert.True(t, exists)
+	assert.Equal(t, map[string][]CacheTagPair{"default": {{CacheTag: cacheTag + "-20260309", NewTag: newTag}}}, pairs)
+}
+
+func TestFindDatedCacheTag(t *testing.T) {
+	registryHost := startInMemoryRegistry(t)
+	useDatedCacheTags(t, time.Now())
+	cacheTag := registryHost + "/app:" + CacheTagPrefix + testHexHashRegistry
+
+	// undated cache tags, saved before dated cache tags were turned on, are found
+	pushRandomImage(t, cacheTag)
+	// the cache tags of other scopes are not
+	pushRandomImage(t, cacheTag+"-feature-20270101")
+	found, exists, err := findDatedCacheTag("", cacheTag)
+	require.NoError(t, err)
+	assert.True(t, exists)
+	assert.Equal(t, cacheTag, found)
+
+	// the newest dated cache tag wins
+	pushRandomImage(t, cacheTag+"-20260101")
+	pushRandomImage(t, cacheTag+"-20260215")
+	docker.ForgetRegistryState()
+	found, exists, err = findDatedCacheTag("", cacheTag)
+	require.NoError(t, err)
+	assert.True(t, exists)
+	assert.Equal(t, cacheTag+"-20260215", found)
+}
+
+func TestFindDatedCacheTag_MissingRepository(t *testing.T) {
+	registryHost := startInMemoryRegistry(t)
+	useDatedCacheTags(t, time.Now())
+
+	_, exists, err := findDatedCacheTag("", registryHost+"/missing:"+CacheTagPrefix+testHexHashRegistry)
+	require.NoError(t, err)
+	assert.False(t, exists)
+}
@@ -0,0 +1,71 @@
+package cacher
+
+import (
+	"io"
+	"log"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startInMemoryRegistry starts a throwaway registry and returns its host:port
+func startInMemoryRegistry(t *testing.T) string {
+	t.Helper()
+	server := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	t.Cleanup(server.Close)
+	return strings.TrimPrefix(server.URL, "http://")
+}
+
+func pushRandomImage(t *testing.T, tag string) {
+	t.Helper()
+	image, err := random.Image(64, 1)
+	require.NoError(t, err)
+	ref, err := name.ParseReference(tag)
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(ref, image))
+}
+
+// a single command can push the same image to many registries (e.g. ECR and GAR) - each tag is matched with the cache
+// tag of its own registry and repository
+func TestRegistryCache_MultipleRegistries(t *testing.T) {
+	registryA := startInMemoryRegistry(t)
+	registryB := startInMemoryRegistry(t)
+
+	builtTags := []string{registryA + "/team/app:v1", registryB + "/mirror/app:v1"}
+	for _, tag := range builtTags {
+		pushRandomImage(t, tag)
+	}
+	require.NoError(t, (&RegistryCache{Hash: testHexHashRegistry, TagsByTarget: map[string][]string{"default": builtTags}}).SaveCacheTags(false))
+
+	newTags := []string{registryA + "/team/app:v2", registryB + "/mirror/app:v2", registryB + "/mirror/app:latest"}
+	exists, cacheTagPairs, err := (&RegistryCache{Hash: testHexHashRegistry, TagsByTarget: map[string][]string{"default": newTags}}).Exists()
+
+	require.NoError(t, err)
+	assert.True(t, exists)
+	assert.ElementsMatch(t, []CacheTagPair{
+		{CacheTag: registryA + "/team/app:" + CacheTagPrefix + testHexHashRegistry, NewTag: registryA + "/team/app:v2"},
+		{CacheTag: registryB + "/mirror/app:" + CacheTagPrefix + testHexHashRegistry, NewTag: registryB + "/mirror/app:v2"},
+		{CacheTag: registryB + "/mirror/app:" + CacheTagPrefix + testHexHashRegistry, NewTag: registryB + "/mirror/app:latest"},
+	}, cacheTagPairs["default"])
+}
+
+// the cache is only hit when every registry has it - otherwise the command runs and pushes to all of them again
+func TestRegistryCache_MultipleRegistries_MissingInOne(t *testing.T) {
+	registryA := startInMemoryRegistry(t)
+	registryB := startInMemoryRegistry(t)
+
+	pushRandomImage(t, registryA+"/app:v1")
+	require.NoError(t, (&RegistryCache{Hash: testHexHashRegistry, TagsByTarget: map[string][]string{"default": {registryA + "/app:v1"}}}).SaveCacheTags(false))
+
+	exists, _, err := (&RegistryCache{Hash: testHexHashRegistry, TagsByTarget: map[string][]string{"default": {registryA + "/app:v2", registryB + "/app:v2"}}}).Exists()
+
+	require.NoError(t, err)
+	assert.False(t, exists)
+}
@@ -0,0 +1,101 @@
+package cacher
+
+import (
+	"fmt"
+	"strings"
+
+	"log/slog"
+
+	"github.com/hytromo/mimosa/internal/docker"
+	"github.com/hytromo/mimosa/internal/utils/dockerutil"
+)
+
+// LocalCache handles cache operations for builds that only load their image to the local docker daemon: the cache
+// tags are local images (<image>:mimosa-content-hash-<hash>) instead of registry tags
+type LocalCache struct {
+	// the docker global flags of the command, which pick the daemon
+	GlobalFlags  []string
+	Hash         string
+	TagsByTarget map[string][]string // from parsed command
+}
+
+// cacheTag returns the local cache tag of the tag, in the image repository as the command names it
+func (lc *LocalCache) cacheTag(tag string) (string, error) {
+	parsed, err := dockerutil.ParseTag(tag)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse tag %s: %w", tag, err)
+	}
+	return strings.TrimSuffix(tag, ":"+parsed.Tag) + ":" + docker.CurrentCacheTagPrefix() + lc.Hash, nil
+}
+
+// Exists checks if the local docker daemon has the cache tags of ALL tags in TagsByTarget
+func (lc *LocalCache) Exists() (bool, map[string][]CacheTagPair, error) {
+	if len(lc.TagsByTarget) == 0 {
+		return false, nil, fmt.Errorf("no tags to check")
+	}
+
+	cacheTagPairs := make(map[string][]CacheTagPair)
+	checked := map[string]bool{}
+	for targetName, tagsForTarget := range lc.TagsByTarget {
+		if len(tagsForTarget) == 0 {
+			return false, nil, nil
+		}
+
+		for _, tag := range tagsForTarget {
+			cacheTag, err := lc.cacheTag(tag)
+			if err != nil {
+				slog.Debug("Failed to construct local cache tag", "tag", tag, "error", err)
+				return false, nil, nil
+			}
+			exists, ok := checked[cacheTag]
+			if !ok {
+				if exists, err = docker.LocalImageExists(lc.GlobalFlags, cacheTag); err != nil {
+					return false, nil, err
+				}
+				checked[cacheTag] = exists
+			}
+			if !exists {
+				slog.Debug("Local cache tag not found", "cacheTag", cacheTag)
+				return false, nil, nil
+			}
+			cacheTagPairs[targetName] = append(cacheTagPairs[targetName], CacheTagPair{CacheTag: cacheTag, NewTag: tag})
+		}
+	}
+
+	return true, cacheTagPairs, nil
+}
+
+// SaveCacheTags tags the local images of all the tags in TagsByTarget with their cache tags
+func (lc *LocalCache) SaveCacheTags(dryRun bool) error {
+	if len(lc.TagsByTarget) == 0 {
+		return fmt.Errorf("no tags to save")
+	}
+	if readOnly {
+		return ErrReadOnlyCache
+	}
+
+	saved := map[string]bool{}
+	for _, tags := range lc.TagsByTarget {
+		for _, tag := range tags {
+			cacheTag, err := lc.cacheTag(tag)
+			if err != nil {
+				slog.Debug("Failed to construct local cache tag", "tag", tag, "error", err)
+				continue
+			}
+			if saved[cacheTag] {
+				continue
+			}
+			saved[cacheTag] = true
+
+			if dryRun {
+				slog.Info("> DRY RUN: would tag local image", "from", tag, "to", cacheTag)
+				continue
+			}
+			if err := docker.TagLocalImage(lc.GlobalFlags, tag, cacheTag); err != nil {
+				return fmt.Errorf("failed to create local cache tag %s from %s: %w", cacheTag, tag, err)
+			}
+			slog.Debug("Created local cache tag", "from", tag, "to", cacheTag)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+package cacher
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalCache_CacheTag(t *testing.T) {
+	localCache := &LocalCache{Hash: testHexHashRegistry}
+
+	for tag, expected := range map[string]string{
+		"app:dev":                    "app:" + CacheTagPrefix + testHexHashRegistry,
+		"app":                        "app:" + CacheTagPrefix + testHexHashRegistry,
+		"localhost:5000/org/app:dev": "localhost:5000/org/app:" + CacheTagPrefix + testHexHashRegistry,
+	} {
+		cacheTag, err := localCache.cacheTag(tag)
+		require.NoError(t, err)
+		assert.Equal(t, expected, cacheTag, tag)
+	}
+
+	_, err := localCache.cacheTag("Invalid Tag")
+	assert.Error(t, err)
+}
@@ -0,0 +1,14 @@
+package cacher
+
+import "errors"
+
+// ErrReadOnlyCache is returned by everything that writes to the cache while it is read-only
+var ErrReadOnlyCache = errors.New("the cache is read-only (--no-write)")
+
+var readOnly = false
+
+// SetReadOnly makes the cache read-only, e.g. for untrusted pull request builds: cache hits are still retagged to the
+// tags of the build, but no cache tag (nor signature, announcement or build inputs) is ever written
+func SetReadOnly(enabled bool) {
+	readOnly = enabled
+}
@@ -0,0 +1,41 @@
+package cacher
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hytromo/mimosa/internal/docker"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func useReadOnlyCache(t *testing.T) {
+	t.Helper()
+	SetReadOnly(true)
+	t.Cleanup(func() {
+		SetReadOnly(false)
+	})
+}
+
+func TestReadOnlyCache_NothingIsWritten(t *testing.T) {
+	registryHost := startInMemoryRegistry(t)
+	t.Cleanup(docker.ForgetRegistryState)
+	useReadOnlyCache(t)
+	tagsByTarget := map[string][]string{"default": {registryHost + "/app:v1"}}
+
+	registryCache := &RegistryCache{Hash: testHexHashRegistry, TagsByTarget: tagsByTarget}
+	assert.ErrorIs(t, registryCache.SaveCacheTags(false), ErrReadOnlyCache)
+	assert.ErrorIs(t, registryCache.SaveCacheTags(true), ErrReadOnlyCache)
+
+	localCache := &LocalCache{Hash: testHexHashRegistry, TagsByTarget: tagsByTarget}
+	assert.ErrorIs(t, localCache.SaveCacheTags(false), ErrReadOnlyCache)
+
+	assert.ErrorIs(t, RecordBuildInputs("", registryHost+"/app:v1", "sha256:"+testHexHashRegistry, BuildInputs{}), ErrReadOnlyCache)
+
+	until, err := registryCache.Announce(time.Minute, false)
+	require.NoError(t, err)
+	assert.True(t, until.IsZero())
+	_, found, err := docker.ArtifactAnnotations("", registryHost+"/app:"+CacheTagPrefix+testHexHashRegistry+announcementTagSuffix)
+	require.NoError(t, err)
+	assert.False(t, found, "a read-only cache announces nothing")
+}
@@ -10,31 +10,87 @@ import (
 	"github.com/hytromo/mimosa/internal/utils/dockerutil"
 )
 
-const CacheTagPrefix = "mimosa-content-hash-"
+const CacheTagPrefix = docker.CacheTagPrefix
 
 // RegistryCache handles cache operations using Docker registry tags
 type RegistryCache struct {
 	Hash         string
 	TagsByTarget map[string][]string // from parsed command
+	// the docker config dir of the command, whose credentials the registry calls use ("" for the default one)
+	DockerConfigDir string
 }
 
-// GetCacheTagForRegistry constructs the cache tag for a given full tag (registry/image:tag)
-// Returns: registry/image:mimosa-content-hash-<hash>
+// GetCacheTagForRegistry constructs the cache tag for a given full tag (registry/image:tag) in the cache scope
+// Returns: registry/image:mimosa-content-hash-<hash> (or registry/image:mimosa-content-hash-<hash>-<scope>), or
+// registry/cache-repository:mimosa-content-hash-<hash>-<repository key> when all the cache tags go in a cache repository
 func (rc *RegistryCache) GetCacheTagForRegistry(fullTag string) (string, error) {
+	return rc.cacheTagForScope(fullTag, cacheScope)
+}
+
+func (rc *RegistryCache) cacheTagForScope(fullTag string, scope string) (string, error) {
 	parsed, err := dockerutil.ParseTag(fullTag)
 	if err != nil {
 		return "", fmt.Errorf("failed to parse tag %s: %w", fullTag, err)
 	}
 
 	// Construct cache tag: registry/image:mimosa-content-hash-<hash>
-	cacheTag := fmt.Sprintf("%s/%s:%s%s", parsed.Registry, parsed.ImageName, CacheTagPrefix, rc.Hash)
+	registry, imageName, dedicated := docker.CacheRepositoryFor(parsed.Registry, parsed.ImageName)
+	cacheTag := fmt.Sprintf("%s/%s:%s%s", registry, imageName, docker.CurrentCacheTagPrefix(), rc.Hash)
+	if dedicated {
+		cacheTag += "-" + docker.CacheRepositoryKey(parsed.Registry, parsed.ImageName)
+	}
+	if scope != "" {
+		cacheTag += "-" + fitCacheScope(scope, scopeBudget(cacheTag))
+	}
 	return cacheTag, nil
 }
 
+// findCacheTag returns the cache tag that exists for the cache tag: itself or, with dated cache tags, its newest dated one
+func findCacheTag(dockerConfigDir string, cacheTag string) (string, bool, error) {
+	if datedCacheTags {
+		return findDatedCacheTag(dockerConfigDir, cacheTag)
+	}
+	exists, err := docker.TagExists(dockerConfigDir, cacheTag)
+	return cacheTag, exists, err
+}
+
+// lookupCacheTag returns the cache tag of the full tag that exists: the one of the cache scope or, failing that, the
+// one of the default scope. If neither exists, the cache tag of the cache scope is returned.
+func (rc *RegistryCache) lookupCacheTag(fullTag string) (string, bool, error) {
+	scopedCacheTag, err := rc.GetCacheTagForRegistry(fullTag)
+	if err != nil {
+		return "", false, err
+	}
+
+	scopes := []string{cacheScope}
+	if cacheScope != "" {
+		scopes = append(scopes, "")
+	}
+	for _, scope := range scopes {
+		cacheTag, err := rc.cacheTagForScope(fullTag, scope)
+		if err != nil {
+			return "", false, err
+		}
+		foundCacheTag, exists, err := findCacheTag(rc.DockerConfigDir, cacheTag)
+		if err != nil {
+			return cacheTag, false, err
+		}
+		if exists {
+			return foundCacheTag, true, nil
+		}
+		slog.Debug("Cache tag not found in scope", "cacheTag", cacheTag, "scope", scope)
+	}
+
+	return scopedCacheTag, false, nil
+}
+
 type existsResult struct {
+	// the cache tag of the scope, which the original tags are grouped by
 	cacheTag string
-	exists   bool
-	err      error
+	// the cache tag that was found, which can be the one of the default scope
+	foundCacheTag string
+	exists        bool
+	err           error
 }
 
 // Exists checks if cache tags exist for ALL tags in TagsByTarget
@@ -67,11 +123,14 @@ func (registryCache *RegistryCache) Exists() (bool, map[string][]CacheTagPair, e
 
 		// Only check unique cache tags (buffered channel ensures goroutines won't block on early return)
 		existsResultChan := make(chan existsResult, len(cacheTagToOrigTags))
-		for uniqueCacheTag := range cacheTagToOrigTags {
+		for uniqueCacheTag, originalTags := range cacheTagToOrigTags {
 			go func() {
 				slog.Debug("Checking existence of", "cacheTag", uniqueCacheTag)
-				exists, err := docker.TagExists(uniqueCacheTag)
-				existsResultChan <- existsResult{cacheTag: uniqueCacheTag, exists: exists, err: err}
+				foundCacheTag, exists, err := registryCache.lookupCacheTag(originalTags[0])
+				if err == nil && exists {
+					exists, err = verifyCacheTag(registryCache.DockerConfigDir, foundCacheTag)
+				}
+				existsResultChan <- existsResult{cacheTag: uniqueCacheTag, foundCacheTag: foundCacheTag, exists: exists, err: err}
 			}()
 		}
 
@@ -79,7 +138,7 @@ func (registryCache *RegistryCache) Exists() (bool, map[string][]CacheTagPair, e
 		for range cacheTagToOrigTags {
 			checkResult := <-existsResultChan
 			if checkResult.err != nil {
-				return false, nil, fmt.Errorf("failed to check cache tag %s: %w", checkResult.cacheTag, checkResult.err)
+				return false, nil, fmt.Errorf("failed to check cache tag %s: %w", checkResult.foundCacheTag, checkResult.err)
 			}
 			if !checkResult.exists {
 				slog.Debug("Cache tag not found", "cacheTag", checkResult.cacheTag)
@@ -87,7 +146,7 @@ func (registryCache *RegistryCache) Exists() (bool, map[string][]CacheTagPair, e
 			}
 			// Add pairs for all original tags that share this cache tag
 			for _, originalTag := range cacheTagToOrigTags[checkResult.cacheTag] {
-				targetPairs = append(targetPairs, CacheTagPair{CacheTag: checkResult.cacheTag, NewTag: originalTag})
+				targetPairs = append(targetPairs, CacheTagPair{CacheTag: checkResult.foundCacheTag, NewTag: originalTag})
 			}
 		}
 
@@ -109,6 +168,9 @@ func (rc *RegistryCache) SaveCacheTags(dryRun bool) error {
 	if len(rc.TagsByTarget) == 0 {
 		return fmt.Errorf("no tags to save")
 	}
+	if readOnly {
+		return ErrReadOnlyCache
+	}
 
 	if dryRun {
 		slog.Info("> DRY RUN: would create cache tags")
@@ -122,7 +184,7 @@ func (rc *RegistryCache) SaveCacheTags(dryRun bool) error {
 				}
 				if !seenCacheTags[cacheTag] {
 					seenCacheTags[cacheTag] = true
-					slog.Info("> DRY RUN: would tag", "from", tag, "to", cacheTag)
+					slog.Info("> DRY RUN: would tag", "from", tag, "to", datedCacheTag(cacheTag))
 				}
 			}
 		}
@@ -148,7 +210,7 @@ func (rc *RegistryCache) SaveCacheTags(dryRun bool) error {
 			// Only add if we haven't seen this cache tag yet
 			if !seenCacheTags[cacheTag] {
 				seenCacheTags[cacheTag] = true
-				retagOps = append(retagOps, retagOp{sourceTag: tag, cacheTag: cacheTag, target: target})
+				retagOps = append(retagOps, retagOp{sourceTag: tag, cacheTag: datedCacheTag(cacheTag), target: target})
 			}
 		}
 	}
@@ -161,11 +223,15 @@ func (rc *RegistryCache) SaveCacheTags(dryRun bool) error {
 		go func(op retagOp) {
 			defer wg.Done()
 			// Use RetagSingleTag to properly handle manifest lists (multi-platform images)
-			err := docker.RetagSingleTag(op.sourceTag, op.cacheTag, false)
+			err := docker.RetagSingleTag(rc.DockerConfigDir, op.sourceTag, op.cacheTag, false)
 			if err != nil {
 				errChan <- fmt.Errorf("failed to create cache tag %s from %s: %w", op.cacheTag, op.sourceTag, err)
 				return
 			}
+			if err := signCacheTag(rc.DockerConfigDir, op.cacheTag); err != nil {
+				errChan <- fmt.Errorf("failed to sign cache tag %s: %w", op.cacheTag, err)
+				return
+			}
 			slog.Debug("Created cache tag", "from", op.sourceTag, "to", op.cacheTag, "target", op.target)
 		}(op)
 	}
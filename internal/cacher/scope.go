@@ -0,0 +1,60 @@
+package cacher
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"strings"
+)
+
+const (
+	// the longest tag that registries accept
+	maxTagLength = 128
+	// the length of the short hash that replaces the tail of a scope that does not fit in the cache tag
+	scopeHashLength = 8
+)
+
+var (
+	cacheScope = ""
+	// the characters that are not allowed in a tag
+	invalidTagCharacters = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+	// the longest suffix that a cache tag is saved with: the announcement of its build or its signature
+	longestCacheTagSuffix = max(len(announcementTagSuffix), len(signatureTagSuffix))
+)
+
+// SetCacheScope makes the cache tags be saved under the given scope (e.g. a git branch) instead of the default one:
+// lookups check the scope first and fall back to the default scope, saves only write to the scope. "" is the default scope.
+func SetCacheScope(scope string) {
+	cacheScope = sanitizeCacheScope(scope)
+}
+
+// sanitizeCacheScope turns the scope into something that can be part of a tag, e.g. "feature/login" -> "feature-login"
+func sanitizeCacheScope(scope string) string {
+	return strings.Trim(invalidTagCharacters.ReplaceAllString(scope, "-"), "-.")
+}
+
+// scopeBudget returns how long the scope of the cache tag can be, so that the cache tag stays a valid tag once the
+// scope, the date of dated cache tags and the longest suffix are added to it
+func scopeBudget(cacheTag string) int {
+	budget := maxTagLength - len(cacheTag[strings.LastIndex(cacheTag, ":")+1:]) - len("-") - longestCacheTagSuffix
+	if datedCacheTags {
+		budget -= len("-") + len(cacheTagDateLayout)
+	}
+	return budget
+}
+
+// fitCacheScope returns the scope if it is within the budget, or the scope with its tail replaced by a short hash of the
+// whole scope otherwise - long scopes that only differ after the budget still get different cache tags
+func fitCacheScope(scope string, budget int) string {
+	if len(scope) <= budget {
+		return scope
+	}
+
+	sum := sha256.Sum256([]byte(scope))
+	shortHash := hex.EncodeToString(sum[:])[:scopeHashLength]
+	kept := strings.TrimRight(scope[:max(budget-len("-")-scopeHashLength, 0)], "-.")
+	if kept == "" {
+		return shortHash[:min(scopeHashLength, max(budget, 0))]
+	}
+	return kept + "-" + shortHash
+}
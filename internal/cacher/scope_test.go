@@ -0,0 +1,108 @@
+package cacher
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func useCacheScope(t *testing.T, scope string) {
+	t.Helper()
+	SetCacheScope(scope)
+	t.Cleanup(func() {
+		SetCacheScope("")
+	})
+}
+
+func TestSanitizeCacheScope(t *testing.T) {
+	assert.Equal(t, "feature-login", sanitizeCacheScope("feature/login"))
+	assert.Equal(t, "fix-JIRA-1_v2.1", sanitizeCacheScope("fix/JIRA 1_v2.1"))
+	assert.Equal(t, "dependabot-go-golang.org-x-net", sanitizeCacheScope("-dependabot/go/golang.org/x/net."))
+	assert.Equal(t, "", sanitizeCacheScope(""))
+	assert.Len(t, sanitizeCacheScope(strings.Repeat("a", 200)), 200)
+}
+
+func TestFitCacheScope(t *testing.T) {
+	assert.Equal(t, "feature-login", fitCacheScope("feature-login", 13))
+
+	long := strings.Repeat("a", 60)
+	fitted := fitCacheScope(long, 40)
+	assert.Len(t, fitted, 40)
+	assert.True(t, strings.HasPrefix(fitted, strings.Repeat("a", 31)+"-"))
+	// scopes that only differ after the budget get different short hashes
+	assert.NotEqual(t, fitted, fitCacheScope(long+"b", 40))
+
+	// the kept part of the scope does not end with a separator, which the short hash follows
+	fitted = fitCacheScope(strings.Repeat("a", 30)+"-"+strings.Repeat("b", 30), 40)
+	assert.True(t, strings.HasPrefix(fitted, strings.Repeat("a", 30)+"-"))
+	assert.NotContains(t, fitted, "--")
+
+	assert.Len(t, fitCacheScope(long, 5), 5)
+}
+
+func TestRegistryCache_LongScopesFitInTheLongestCacheTags(t *testing.T) {
+	useCacheRepository(t, strings.Repeat("p", 32), "org/mimosa-cache")
+	useDatedCacheTags(t, time.Date(2026, 10, 14, 0, 0, 0, 0, time.UTC))
+	registryCache := &RegistryCache{Hash: testHexHashRegistry}
+
+	branch := "feature/" + strings.Repeat("very-long-branch-name-", 10)
+	useCacheScope(t, branch+"one")
+	cacheTag, err := registryCache.GetCacheTagForRegistry("myregistry.com/app:v1")
+	require.NoError(t, err)
+	// the longest tag that is saved for the cache tag: its dated announcement
+	tag := datedCacheTag(cacheTag) + announcementTagSuffix
+	assert.Len(t, tag[strings.LastIndex(tag, ":")+1:], maxTagLength)
+
+	useCacheScope(t, branch+"two")
+	otherCacheTag, err := registryCache.GetCacheTagForRegistry("myregistry.com/app:v1")
+	require.NoError(t, err)
+	assert.NotEqual(t, cacheTag, otherCacheTag)
+	assert.Len(t, otherCacheTag, len(cacheTag))
+}
+
+func TestRegistryCache_GetCacheTagForRegistry_WithScope(t *testing.T) {
+	useCacheScope(t, "feature/login")
+	registryCache := &RegistryCache{Hash: testHexHashRegistry}
+
+	cacheTag, err := registryCache.GetCacheTagForRegistry("myregistry.com/app:v1")
+	require.NoError(t, err)
+	assert.Equal(t, "myregistry.com/app:"+CacheTagPrefix+testHexHashRegistry+"-feature-login", cacheTag)
+}
+
+func TestRegistryCache_ScopeFallsBackToTheDefaultScope(t *testing.T) {
+	registryHost := startInMemoryRegistry(t)
+	newTag := registryHost + "/app:v2"
+	defaultCacheTag := registryHost + "/app:" + CacheTagPrefix + testHexHashRegistry
+	scopedCacheTag := defaultCacheTag + "-feature-login"
+	registryCache := &RegistryCache{Hash: testHexHashRegistry, TagsByTarget: map[string][]string{"default": {newTag}}}
+
+	// the default branch saved the cache tag
+	pushRandomImage(t, defaultCacheTag)
+
+	useCacheScope(t, "feature/login")
+	exists, pairs, err := registryCache.Exists()
+	require.NoError(t, err)
+	assert.True(t, exists)
+	assert.Equal(t, map[string][]CacheTagPair{"default": {{CacheTag: defaultCacheTag, NewTag: newTag}}}, pairs)
+
+	// the branch saves its own cache tag, which is then preferred
+	pushRandomImage(t, newTag)
+	require.NoError(t, registryCache.SaveCacheTags(false))
+	exists, pairs, err = registryCache.Exists()
+	require.NoError(t, err)
+	assert.True(t, exists)
+	assert.Equal(t, map[string][]CacheTagPair{"default": {{CacheTag: scopedCacheTag, NewTag: newTag}}}, pairs)
+}
+
+func TestRegistryCache_ScopeMissesWhenNeitherScopeExists(t *testing.T) {
+	registryHost := startInMemoryRegistry(t)
+	useCacheScope(t, "feature")
+	registryCache := &RegistryCache{Hash: testHexHashRegistry, TagsByTarget: map[string][]string{"default": {registryHost + "/app:v2"}}}
+
+	exists, _, err := registryCache.Exists()
+	require.NoError(t, err)
+	assert.False(t, exists)
+}
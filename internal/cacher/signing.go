@@ -0,0 +1,107 @@
+package cacher
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"os"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/hytromo/mimosa/internal/docker"
+)
+
+const (
+	// the HMAC key that cache tags are signed and verified with, e.g. filled in from a KMS secret by the CI
+	CacheSigningKeyEnv = "MIMOSA_CACHE_SIGNING_KEY"
+	// the signature of a cache tag is pushed next to it, as an empty image with the signature annotation
+	signatureTagSuffix       = ".sig"
+	CacheSignatureAnnotation = "io.mimosa/cache-signature"
+)
+
+var requireSignedCache = false
+
+// SetRequireSignedCache makes cache tags without a valid signature cache misses, instead of only the ones whose
+// signature is invalid
+func SetRequireSignedCache(required bool) error {
+	if required && cacheSigningKey() == nil {
+		return errors.New("--require-signed-cache needs the signing key in " + CacheSigningKeyEnv)
+	}
+	requireSignedCache = required
+	return nil
+}
+
+func cacheSigningKey() []byte {
+	if key := os.Getenv(CacheSigningKeyEnv); key != "" {
+		return []byte(key)
+	}
+	return nil
+}
+
+// cacheTagSignature is the HMAC of the cache tag and the digest it points to: a signature is only valid for the image
+// it was made for, under the cache tag (and thus the hash) it was made for
+func cacheTagSignature(key []byte, cacheTag string, digest string) string {
+	if ref, err := name.NewTag(cacheTag); err == nil {
+		cacheTag = ref.Name()
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(cacheTag + "\x00" + digest))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// cacheTagDigest returns the digest that the cache tag points to
+func cacheTagDigest(dockerConfigDir string, cacheTag string) (string, error) {
+	digests, err := docker.TagDigests(dockerConfigDir, []string{cacheTag})
+	if err != nil {
+		return "", err
+	}
+	return digests[cacheTag], nil
+}
+
+// signCacheTag pushes the signature of the cache tag next to it, if there is a signing key
+func signCacheTag(dockerConfigDir string, cacheTag string) error {
+	key := cacheSigningKey()
+	if key == nil {
+		return nil
+	}
+	digest, err := cacheTagDigest(dockerConfigDir, cacheTag)
+	if err != nil {
+		return err
+	}
+	return docker.WriteAnnotationArtifact(dockerConfigDir, cacheTag+signatureTagSuffix, map[string]string{
+		CacheSignatureAnnotation: cacheTagSignature(key, cacheTag, digest),
+	})
+}
+
+// verifyCacheTag reports whether the cache tag can be used: always without a signing key, otherwise only if its
+// signature matches what it points to - or if it is not signed at all, unless signed cache tags are required
+func verifyCacheTag(dockerConfigDir string, cacheTag string) (bool, error) {
+	key := cacheSigningKey()
+	if key == nil {
+		return true, nil
+	}
+
+	annotations, found, err := docker.ArtifactAnnotations(dockerConfigDir, cacheTag+signatureTagSuffix)
+	if err != nil {
+		return false, err
+	}
+	if !found {
+		if requireSignedCache {
+			slog.Warn("The cache tag is not signed, treating it as a cache miss", "cacheTag", cacheTag)
+			return false, nil
+		}
+		slog.Debug("Using unsigned cache tag", "cacheTag", cacheTag)
+		return true, nil
+	}
+
+	digest, err := cacheTagDigest(dockerConfigDir, cacheTag)
+	if err != nil {
+		return false, err
+	}
+	if !hmac.Equal([]byte(annotations[CacheSignatureAnnotation]), []byte(cacheTagSignature(key, cacheTag, digest))) {
+		slog.Warn("The signature of the cache tag does not match the image it points to, treating it as a cache miss", "cacheTag", cacheTag, "digest", digest)
+		return false, nil
+	}
+	return true, nil
+}
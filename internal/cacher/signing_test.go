@@ -0,0 +1,89 @@
+package cacher
+
+import (
+	"testing"
+
+	"github.com/hytromo/mimosa/internal/docker"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func useCacheSigningKey(t *testing.T, key string, required bool) {
+	t.Helper()
+	t.Setenv(CacheSigningKeyEnv, key)
+	require.NoError(t, SetRequireSignedCache(required))
+	t.Cleanup(func() {
+		requireSignedCache = false
+		docker.ForgetRegistryState()
+	})
+}
+
+func TestSetRequireSignedCache_NeedsKey(t *testing.T) {
+	t.Setenv(CacheSigningKeyEnv, "")
+	assert.ErrorContains(t, SetRequireSignedCache(true), CacheSigningKeyEnv)
+	assert.NoError(t, SetRequireSignedCache(false))
+}
+
+func TestRegistryCache_SignedCacheTagsRoundTrip(t *testing.T) {
+	registryHost := startInMemoryRegistry(t)
+	useCacheSigningKey(t, "secret", true)
+	newTag := registryHost + "/app:v1"
+	cacheTag := registryHost + "/app:" + CacheTagPrefix + testHexHashRegistry
+	registryCache := &RegistryCache{Hash: testHexHashRegistry, TagsByTarget: map[string][]string{"default": {newTag}}}
+
+	pushRandomImage(t, newTag)
+	require.NoError(t, registryCache.SaveCacheTags(false))
+	docker.ForgetRegistryState()
+
+	annotations, found, err := docker.ArtifactAnnotations("", cacheTag+signatureTagSuffix)
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.Len(t, annotations[CacheSignatureAnnotation], 64)
+
+	exists, _, err := registryCache.Exists()
+	require.NoError(t, err)
+	assert.True(t, exists)
+}
+
+func TestVerifyCacheTag(t *testing.T) {
+	registryHost := startInMemoryRegistry(t)
+	useCacheSigningKey(t, "secret", false)
+	cacheTag := registryHost + "/app:" + CacheTagPrefix + testHexHashRegistry
+
+	// unsigned cache tags are used, unless signed cache tags are required
+	pushRandomImage(t, cacheTag)
+	verified, err := verifyCacheTag("", cacheTag)
+	require.NoError(t, err)
+	assert.True(t, verified)
+
+	requireSignedCache = true
+	verified, err = verifyCacheTag("", cacheTag)
+	require.NoError(t, err)
+	assert.False(t, verified)
+
+	require.NoError(t, signCacheTag("", cacheTag))
+	verified, err = verifyCacheTag("", cacheTag)
+	require.NoError(t, err)
+	assert.True(t, verified)
+
+	// the signature no longer matches once the cache tag is pointed to another image
+	pushRandomImage(t, cacheTag)
+	docker.ForgetRegistryState()
+	verified, err = verifyCacheTag("", cacheTag)
+	require.NoError(t, err)
+	assert.False(t, verified)
+
+	// nor when signed with another key
+	require.NoError(t, signCacheTag("", cacheTag))
+	t.Setenv(CacheSigningKeyEnv, "another secret")
+	verified, err = verifyCacheTag("", cacheTag)
+	require.NoError(t, err)
+	assert.False(t, verified)
+}
+
+func TestVerifyCacheTag_NoKey(t *testing.T) {
+	t.Setenv(CacheSigningKeyEnv, "")
+	verified, err := verifyCacheTag("", "localhost:1/app:unreachable")
+	require.NoError(t, err)
+	assert.True(t, verified, "cache tags are not verified without a signing key")
+}
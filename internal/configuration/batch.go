@@ -0,0 +1,73 @@
+package configuration
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/google/shlex"
+)
+
+// ParseBatchCommands parses the contents of a batch file, which is either:
+// - a JSON array of commands, each one an array of arguments or a single string to be split like a shell would
+// - one command per line, split like a shell would; empty lines and lines starting with # are ignored
+func ParseBatchCommands(content []byte) ([][]string, error) {
+	trimmed := bytes.TrimSpace(content)
+
+	if bytes.HasPrefix(trimmed, []byte("[")) {
+		return parseJSONBatchCommands(trimmed)
+	}
+
+	commands := [][]string{}
+	for lineNumber, line := range strings.Split(string(trimmed), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		command, err := shlex.Split(line)
+		if err != nil {
+			return nil, fmt.Errorf("invalid command on line %d: %w", lineNumber+1, err)
+		}
+		commands = append(commands, command)
+	}
+
+	if len(commands) == 0 {
+		return nil, fmt.Errorf("no commands found in batch file")
+	}
+
+	return commands, nil
+}
+
+func parseJSONBatchCommands(content []byte) ([][]string, error) {
+	var rawCommands []json.RawMessage
+	if err := json.Unmarshal(content, &rawCommands); err != nil {
+		return nil, fmt.Errorf("invalid JSON batch file: %w", err)
+	}
+
+	commands := make([][]string, 0, len(rawCommands))
+	for i, rawCommand := range rawCommands {
+		var command []string
+		if err := json.Unmarshal(rawCommand, &command); err != nil {
+			var commandLine string
+			if err := json.Unmarshal(rawCommand, &commandLine); err != nil {
+				return nil, fmt.Errorf("command %d must be an array of strings or a string", i)
+			}
+			if command, err = shlex.Split(commandLine); err != nil {
+				return nil, fmt.Errorf("invalid command %d: %w", i, err)
+			}
+		}
+
+		if len(command) == 0 {
+			return nil, fmt.Errorf("command %d is empty", i)
+		}
+		commands = append(commands, command)
+	}
+
+	if len(commands) == 0 {
+		return nil, fmt.Errorf("no commands found in batch file")
+	}
+
+	return commands, nil
+}
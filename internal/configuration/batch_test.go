@@ -0,0 +1,61 @@
+package configuration
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseBatchCommands_Lines(t *testing.T) {
+	content := `
+# the api image
+docker buildx build --push -t org/api:v1 ./api
+
+docker buildx build --push --build-arg "GREETING=hello world" -t org/web:v1 ./web
+`
+
+	commands, err := ParseBatchCommands([]byte(content))
+	require.NoError(t, err)
+
+	assert.Equal(t, [][]string{
+		{"docker", "buildx", "build", "--push", "-t", "org/api:v1", "./api"},
+		{"docker", "buildx", "build", "--push", "--build-arg", "GREETING=hello world", "-t", "org/web:v1", "./web"},
+	}, commands)
+}
+
+func TestParseBatchCommands_JSON(t *testing.T) {
+	content := `[
+		["docker", "buildx", "build", "--push", "-t", "org/api:v1", "./api"],
+		"docker buildx bake --push 'my target'"
+	]`
+
+	commands, err := ParseBatchCommands([]byte(content))
+	require.NoError(t, err)
+
+	assert.Equal(t, [][]string{
+		{"docker", "buildx", "build", "--push", "-t", "org/api:v1", "./api"},
+		{"docker", "buildx", "bake", "--push", "my target"},
+	}, commands)
+}
+
+func TestParseBatchCommands_Errors(t *testing.T) {
+	testCases := []struct {
+		name          string
+		content       string
+		expectedError string
+	}{
+		{name: "empty", content: "\n# only a comment\n", expectedError: "no commands found"},
+		{name: "empty JSON array", content: "[]", expectedError: "no commands found"},
+		{name: "invalid JSON", content: "[\"docker\"", expectedError: "invalid JSON batch file"},
+		{name: "invalid JSON command", content: "[1]", expectedError: "must be an array of strings or a string"},
+		{name: "empty JSON command", content: "[[]]", expectedError: "command 0 is empty"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ParseBatchCommands([]byte(tc.content))
+			assert.ErrorContains(t, err, tc.expectedError)
+		})
+	}
+}
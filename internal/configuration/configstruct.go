@@ -1,14 +1,90 @@
 package configuration
 
+import "time"
+
 type CommandContainer interface {
 	GetCommandToRun() []string
 }
 
+const (
+	PullPolicyMiss    = "miss"    // builds with --pull are always cache misses
+	PullPolicyResolve = "resolve" // builds with --pull include the digests of their base images in the hash
+)
+
+const (
+	VerifyPushWarn = "warn" // warn about tags missing from the command output, but save the cache tags anyway
+	VerifyPushFail = "fail" // do not save the cache tags and fail when tags are missing from the command output
+)
+
 type RememberSubcommandOptions struct {
-	Enabled      bool
-	CommandToRun []string
-	DryRun       bool
-	RetagOnly    bool
+	Enabled       bool
+	CommandToRun  []string
+	DryRun        bool
+	RetagOnly     bool
+	HashBuilder   bool   // include the buildx builder's driver, buildkit version and platforms in the hash
+	HashAlgorithm string // the algorithm used to hash the files of the build contexts (imo, sha256, xxh3)
+	// resolve the FROM images of the Dockerfiles and include their digests in the hash
+	HashBaseImages bool
+	// hash bake commands from this pre-resolved bake definition (docker buildx bake --print), "" resolves the command
+	BakePlan string
+	// save the cache tags under a scope ("branch": the git branch, unless it is the default branch) and fall back to
+	// the default scope on lookups, "" always uses the default scope
+	CacheScope string
+	// the branch whose cache tags are saved in the default scope, "" is CI_DEFAULT_BRANCH or main
+	CacheDefaultBranch string
+	// the prefix of the cache tags, "" is mimosa-content-hash-
+	CacheTagPrefix string
+	// the repository to save all the cache tags in (e.g. org/mimosa-cache), "" saves them next to the images
+	CacheRepository string
+	// end new cache tags with their creation date, for registry lifecycle rules, and match them by prefix on lookups
+	DatedCacheTags bool
+	// never write to the cache (cache tags, signatures, announcements, build inputs), only retag cache hits
+	NoWrite bool
+	// treat the cache tags that are not signed with MIMOSA_CACHE_SIGNING_KEY as cache misses
+	RequireSignedCache bool
+	// template values that look run-specific (temp dirs, CI run URLs, UUIDs) in any flag
+	AggressiveNormalize bool
+	// template the values of the default infrastructure flags (--add-host IPs, --cgroup-parent)
+	IgnoreInfraFlags bool
+	// more flags whose values are templated as infrastructure flags, e.g. "--dns"
+	InfraFlags []string
+	// how many commands of a batch can run at the same time
+	BatchConcurrency int
+	// check the command output for the pushed tags before saving the cache tags: "" (off), "warn" or "fail"
+	VerifyPush string
+	// extra regexes matching pushed image references in the command output (first capture group)
+	PushPatterns []string
+	// what --pull means for the cache: "" (nothing), "miss" or "resolve"
+	PullPolicy string
+	// fail, without running it, when a docker command does not push to a registry (instead of running it without caching)
+	RequirePush bool
+	// warn when the build contexts are larger than this size (e.g. "500MB"), "0" disables the warning
+	ContextSizeWarning string
+	// give up hashing after this long and run the command without caching, 0 never gives up
+	HashTimeout time.Duration
+	// on a cache miss, wait up to this long for another build of the same hash that announced itself to save the cache,
+	// announcing this build otherwise - 0 never waits
+	WaitForCache time.Duration
+	// after a cache miss is pushed, report whether an earlier build of a different hash pushed the same image, and
+	// which inputs made the hashes differ
+	AnalyzeRebuilds bool
+	// write the cache decision and the hash to this dotenv file (e.g. a GitLab CI dotenv report), "" does not write it
+	DotenvFile string
+	// append the cache decision, the hash and the tags to this GitHub Actions outputs file, "" does not write it
+	GitHubOutputFile string
+	// append the cache decision, the hash and the tags to this GitHub Actions job summary file, "" does not write it
+	GitHubStepSummaryFile string
+	// write a JSON map of every tag of the build to the digest it points to after a hit or a pushed build, "" does not write it
+	DigestMapFile string
+	// the tags to create instead of the tags of the command, each [target=]tag: the tags of the command are only
+	// where the cache is looked up and saved
+	OutputTags []string
+	// the Go template that names the tags that a cache hit creates (e.g. "{{.Original}}-cached"), "" creates the tags themselves
+	HitTagTemplate string
+	// print this line on cache hit, once per retagged tag if it contains {tag}, "" prints nothing
+	HitMarker string
+	// CommandToRun is "sh -c <script>", whose first docker build command is the one that is hashed
+	Shell bool
 }
 
 func (r RememberSubcommandOptions) GetCommandToRun() []string {
@@ -24,4 +100,33 @@ type ParsedCommand struct {
 	Hash string
 	// the raw command - we will fallback to actually running this if there is an error during remember mode
 	Command []string
+	// map of target to the platforms it is built for, targets without platforms are built for the builder's default
+	PlatformsByTarget map[string][]string
+	// map of target to the attestations (provenance, sbom) it asks for, that the cached image must hold
+	AttestationsByTarget map[string][]string
+	// the command does not push but loads its image to the local docker daemon, whose images are its cache tags
+	Local bool
+	// the command always pulls its base images (--pull, or pull = true for a bake target)
+	Pulls bool
+	// map of target to the tags to create for it instead of its tags in TagsByTarget (--output-tag): TagsByTarget then
+	// only says where the cache tags are looked up and saved - targets without output tags create their own tags
+	OutputTagsByTarget map[string][]string
+	// the docker config dir that the command picks with "docker --config <dir>" - mimosa's registry calls for the
+	// command use its credentials, "" for the default docker config
+	DockerConfigDir string
+}
+
+// PublishedTagsByTarget returns the tags that the command creates for each target: its output tags, if any
+func (p ParsedCommand) PublishedTagsByTarget() map[string][]string {
+	if len(p.OutputTagsByTarget) == 0 {
+		return p.TagsByTarget
+	}
+	published := map[string][]string{}
+	for target, tags := range p.TagsByTarget {
+		published[target] = tags
+		if outputTags, ok := p.OutputTagsByTarget[target]; ok {
+			published[target] = outputTags
+		}
+	}
+	return published
 }
@@ -22,3 +22,11 @@ func TestCommandContainer_Interface(t *testing.T) {
 	result := container.GetCommandToRun()
 	assert.Equal(t, []string{"docker", "build"}, result)
 }
+
+func TestParsedCommand_PublishedTagsByTarget(t *testing.T) {
+	parsedCommand := ParsedCommand{TagsByTarget: map[string][]string{"api": {"myreg1/api:tmp"}, "web": {"myreg1/web:tmp"}}}
+	assert.Equal(t, parsedCommand.TagsByTarget, parsedCommand.PublishedTagsByTarget())
+
+	parsedCommand.OutputTagsByTarget = map[string][]string{"web": {"myreg1/web:1.2.0"}}
+	assert.Equal(t, map[string][]string{"api": {"myreg1/api:tmp"}, "web": {"myreg1/web:1.2.0"}}, parsedCommand.PublishedTagsByTarget())
+}
@@ -0,0 +1,53 @@
+package configuration
+
+import (
+	"errors"
+	"slices"
+	"strings"
+
+	"github.com/google/shlex"
+)
+
+// SplitDiffCommands splits the arguments of "mimosa cache diff" into the two commands to compare, given either as
+// "<command A> -- <command B>" or as two quoted command lines
+func SplitDiffCommands(args []string) ([]string, []string, error) {
+	if separator := slices.Index(args, "--"); separator != -1 {
+		commandA, commandB := args[:separator], args[separator+1:]
+		if len(commandA) == 0 || len(commandB) == 0 {
+			return nil, nil, errors.New("both commands must be non-empty")
+		}
+		return commandA, commandB, nil
+	}
+
+	if len(args) != 2 {
+		return nil, nil, errors.New("expected two commands separated by -- or two quoted commands")
+	}
+
+	commandA, err := shlex.Split(args[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	commandB, err := shlex.Split(args[1])
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(commandA) == 0 || len(commandB) == 0 {
+		return nil, nil, errors.New("both commands must be non-empty")
+	}
+
+	return commandA, commandB, nil
+}
+
+// SplitDiffCacheEntries returns the two cache entries to compare when the arguments of "mimosa cache diff" are a hash or
+// an image tag each, instead of two commands - a command always has more than one word
+func SplitDiffCacheEntries(args []string) (string, string, bool) {
+	if len(args) != 2 {
+		return "", "", false
+	}
+	for _, arg := range args {
+		if arg == "" || arg == "--" || strings.ContainsAny(arg, " \t\n") {
+			return "", "", false
+		}
+	}
+	return args[0], args[1], true
+}
@@ -0,0 +1,53 @@
+package configuration
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitDiffCommands_Separator(t *testing.T) {
+	commandA, commandB, err := SplitDiffCommands([]string{"docker", "buildx", "build", ".", "--", "docker", "buildx", "bake"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"docker", "buildx", "build", "."}, commandA)
+	assert.Equal(t, []string{"docker", "buildx", "bake"}, commandB)
+}
+
+func TestSplitDiffCommands_QuotedCommands(t *testing.T) {
+	commandA, commandB, err := SplitDiffCommands([]string{"docker buildx build --build-arg 'A=1 2' .", "docker buildx bake"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"docker", "buildx", "build", "--build-arg", "A=1 2", "."}, commandA)
+	assert.Equal(t, []string{"docker", "buildx", "bake"}, commandB)
+}
+
+func TestSplitDiffCommands_Invalid(t *testing.T) {
+	for _, args := range [][]string{
+		{},
+		{"docker buildx build ."},
+		{"docker", "buildx", "build", "--"},
+		{"--", "docker", "buildx", "build"},
+		{"docker buildx build .", ""},
+	} {
+		_, _, err := SplitDiffCommands(args)
+		assert.Error(t, err, "args: %v", args)
+	}
+}
+
+func TestSplitDiffCacheEntries(t *testing.T) {
+	entryA, entryB, ok := SplitDiffCacheEntries([]string{"406b7725b0e93838b460e38d30903899", "r.io/app:v1"})
+	require.True(t, ok)
+	assert.Equal(t, "406b7725b0e93838b460e38d30903899", entryA)
+	assert.Equal(t, "r.io/app:v1", entryB)
+
+	for _, args := range [][]string{
+		{},
+		{"r.io/app:v1"},
+		{"docker buildx build .", "docker buildx bake"},
+		{"docker", "--", "bake"},
+		{"r.io/app:v1", ""},
+	} {
+		_, _, ok := SplitDiffCacheEntries(args)
+		assert.False(t, ok, "args: %v", args)
+	}
+}
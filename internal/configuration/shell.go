@@ -0,0 +1,167 @@
+package configuration
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SplitShellScript splits a simple shell script into its commands, e.g. "docker build -t app . && docker push app"
+// into ["docker", "build", "-t", "app", "."] and ["docker", "push", "app"]. Commands are separated by newlines, ;, &, &&, |
+// and ||, words are split like a shell would and $VAR/${VAR} are expanded with lookupEnv (outside single quotes).
+// Constructs whose result cannot be known without running the script (command substitution, subshells, redirections,
+// unset variables) are rejected.
+func SplitShellScript(script string, lookupEnv func(string) (string, bool)) ([][]string, error) {
+	commands := [][]string{}
+	command := []string{}
+	var word strings.Builder
+	inWord := false
+
+	endWord := func() {
+		if inWord {
+			command = append(command, word.String())
+			word.Reset()
+			inWord = false
+		}
+	}
+	endCommand := func() {
+		endWord()
+		if len(command) > 0 {
+			commands = append(commands, command)
+			command = []string{}
+		}
+	}
+
+	runes := []rune(script)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == '\\':
+			if i+1 < len(runes) {
+				i++
+				// a backslash-newline continues the line
+				if runes[i] != '\n' {
+					word.WriteRune(runes[i])
+					inWord = true
+				}
+			}
+		case r == '\'':
+			end := indexRune(runes, '\'', i+1)
+			if end == -1 {
+				return nil, fmt.Errorf("unterminated single quote")
+			}
+			word.WriteString(string(runes[i+1 : end]))
+			inWord = true
+			i = end
+		case r == '"':
+			end, err := expandDoubleQuoted(runes, i+1, &word, lookupEnv)
+			if err != nil {
+				return nil, err
+			}
+			inWord = true
+			i = end
+		case r == '$':
+			end, err := expandVariable(runes, i, &word, lookupEnv)
+			if err != nil {
+				return nil, err
+			}
+			inWord = true
+			i = end
+		case r == '#' && !inWord:
+			// a comment lasts until the end of the line
+			for i+1 < len(runes) && runes[i+1] != '\n' {
+				i++
+			}
+		case r == '\n' || r == ';' || r == '&' || r == '|':
+			endCommand()
+		case r == ' ' || r == '\t' || r == '\r':
+			endWord()
+		case strings.ContainsRune("`()<>", r):
+			return nil, fmt.Errorf("unsupported shell syntax %q", r)
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	endCommand()
+
+	return commands, nil
+}
+
+func indexRune(runes []rune, r rune, from int) int {
+	for i := from; i < len(runes); i++ {
+		if runes[i] == r {
+			return i
+		}
+	}
+	return -1
+}
+
+// expandDoubleQuoted writes the contents of a double-quoted string starting at from into word, and returns the index
+// of its closing quote
+func expandDoubleQuoted(runes []rune, from int, word *strings.Builder, lookupEnv func(string) (string, bool)) (int, error) {
+	for i := from; i < len(runes); i++ {
+		switch runes[i] {
+		case '"':
+			return i, nil
+		case '\\':
+			if i+1 < len(runes) && strings.ContainsRune("$`\"\\\n", runes[i+1]) {
+				i++
+				if runes[i] != '\n' {
+					word.WriteRune(runes[i])
+				}
+			} else {
+				word.WriteRune('\\')
+			}
+		case '`':
+			return 0, fmt.Errorf("unsupported shell syntax %q", '`')
+		case '$':
+			end, err := expandVariable(runes, i, word, lookupEnv)
+			if err != nil {
+				return 0, err
+			}
+			i = end
+		default:
+			word.WriteRune(runes[i])
+		}
+	}
+	return 0, fmt.Errorf("unterminated double quote")
+}
+
+// expandVariable writes the value of the $VAR or ${VAR} starting at from into word, and returns the index of its last rune
+func expandVariable(runes []rune, from int, word *strings.Builder, lookupEnv func(string) (string, bool)) (int, error) {
+	i := from + 1
+	braced := i < len(runes) && runes[i] == '{'
+	if braced {
+		i++
+	}
+
+	start := i
+	for i < len(runes) && (runes[i] == '_' || (runes[i] >= 'a' && runes[i] <= 'z') || (runes[i] >= 'A' && runes[i] <= 'Z') || (i > start && runes[i] >= '0' && runes[i] <= '9')) {
+		i++
+	}
+	name := string(runes[start:i])
+
+	if braced {
+		if i >= len(runes) || runes[i] != '}' || name == "" {
+			return 0, fmt.Errorf("unsupported variable expansion at %q", string(runes[from:min(i+1, len(runes))]))
+		}
+		i++
+	}
+
+	if name == "" {
+		if i < len(runes) && strings.ContainsRune("(?!#@*$-0123456789", runes[i]) {
+			return 0, fmt.Errorf("unsupported shell syntax %q", "$"+string(runes[i]))
+		}
+		// a lone $ is kept as is
+		word.WriteRune('$')
+		return from, nil
+	}
+
+	value, ok := lookupEnv(name)
+	if !ok {
+		return 0, fmt.Errorf("variable %s is not set", name)
+	}
+	word.WriteString(value)
+
+	return i - 1, nil
+}
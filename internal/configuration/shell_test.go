@@ -0,0 +1,57 @@
+package configuration
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testLookupEnv(name string) (string, bool) {
+	values := map[string]string{"IMAGE": "org/app", "VERSION": "v1", "EMPTY": ""}
+	value, ok := values[name]
+	return value, ok
+}
+
+func TestSplitShellScript(t *testing.T) {
+	script := `# build and push
+docker build -t "$IMAGE:${VERSION}" --build-arg 'NOTE=$not expanded' . && docker push $IMAGE:$VERSION
+echo done; echo "a \"quoted\" word" | cat \
+  -n || true &`
+
+	commands, err := SplitShellScript(script, testLookupEnv)
+	require.NoError(t, err)
+
+	assert.Equal(t, [][]string{
+		{"docker", "build", "-t", "org/app:v1", "--build-arg", "NOTE=$not expanded", "."},
+		{"docker", "push", "org/app:v1"},
+		{"echo", "done"},
+		{"echo", `a "quoted" word`},
+		{"cat", "-n"},
+		{"true"},
+	}, commands)
+}
+
+func TestSplitShellScript_EmptyValuesAndDollars(t *testing.T) {
+	commands, err := SplitShellScript(`echo "$EMPTY" price$ a#b`, testLookupEnv)
+	require.NoError(t, err)
+
+	assert.Equal(t, [][]string{{"echo", "", "price$", "a#b"}}, commands)
+}
+
+func TestSplitShellScript_Unsupported(t *testing.T) {
+	for script, expectedError := range map[string]string{
+		`docker build -t $(cat tag) .`:    "unsupported shell syntax",
+		"docker build -t `cat tag` .":     "unsupported shell syntax",
+		`docker build . > build.log`:      "unsupported shell syntax",
+		`(cd app && docker build .)`:      "unsupported shell syntax",
+		`docker build -t $UNSET .`:        "variable UNSET is not set",
+		`docker build -t ${IMAGE:-x} .`:   "unsupported variable expansion",
+		`docker build -t "$1" .`:          "unsupported shell syntax",
+		`docker build -t 'unterminated .`: "unterminated single quote",
+		`docker build -t "unterminated .`: "unterminated double quote",
+	} {
+		_, err := SplitShellScript(script, testLookupEnv)
+		assert.ErrorContains(t, err, expectedError, script)
+	}
+}
@@ -0,0 +1,15 @@
+package configuration
+
+// InstallShimOptions are the options of the install-shim subcommand, which installs a docker wrapper that runs the
+// build commands through mimosa remember
+type InstallShimOptions struct {
+	// the directory the shim is written to - it has to come before the real docker in PATH
+	Dir string
+	// replace an existing file that is not a mimosa shim
+	Force bool
+	// the absolute paths the shim calls
+	MimosaPath string
+	DockerPath string
+	// extra flags of remember, e.g. --hash-base-images
+	RememberArgs []string
+}
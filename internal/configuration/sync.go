@@ -0,0 +1,114 @@
+package configuration
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/shlex"
+	"gopkg.in/yaml.v3"
+)
+
+// SyncSubcommandOptions are the options of the sync subcommand, which reconciles a directory of build specs
+type SyncSubcommandOptions struct {
+	Dir string
+	// how often the specs are reconciled again
+	Interval time.Duration
+	// reconcile once and exit (with the exit code of the first failed build), instead of watching the directory
+	Once bool
+	// the options used for every build, like in remember --batch
+	Remember RememberSubcommandOptions
+}
+
+// SyncSpec is a declarative build spec of the sync subcommand, e.g.
+//
+//	command: docker buildx build --push
+//	tags: [myregistry/app:v1]
+//	context: ./app
+type SyncSpec struct {
+	// the file name of the spec, without the extension
+	Name    string
+	Command syncSpecCommand `yaml:"command"`
+	// appended to the command as --tag flags
+	Tags []string `yaml:"tags"`
+	// appended to the command as its last argument
+	Context string `yaml:"context"`
+}
+
+// syncSpecCommand is either an array of arguments or a single string to be split like a shell would
+type syncSpecCommand []string
+
+func (c *syncSpecCommand) UnmarshalYAML(value *yaml.Node) error {
+	var command []string
+	if err := value.Decode(&command); err == nil {
+		*c = command
+		return nil
+	}
+
+	var commandLine string
+	if err := value.Decode(&commandLine); err != nil {
+		return errors.New("command must be an array of strings or a string")
+	}
+	command, err := shlex.Split(commandLine)
+	if err != nil {
+		return fmt.Errorf("invalid command: %w", err)
+	}
+	*c = command
+	return nil
+}
+
+// FullCommand returns the command of the spec with its tags and context appended
+func (s SyncSpec) FullCommand() []string {
+	command := slices.Clone([]string(s.Command))
+	for _, tag := range s.Tags {
+		command = append(command, "--tag", tag)
+	}
+	if s.Context != "" {
+		command = append(command, s.Context)
+	}
+	return command
+}
+
+// ParseSyncSpec parses the YAML contents of a build spec
+func ParseSyncSpec(name string, content []byte) (SyncSpec, error) {
+	spec := SyncSpec{Name: name}
+	if err := yaml.Unmarshal(content, &spec); err != nil {
+		return SyncSpec{}, fmt.Errorf("invalid build spec %s: %w", name, err)
+	}
+	if len(spec.Command) == 0 {
+		return SyncSpec{}, fmt.Errorf("build spec %s has no command", name)
+	}
+	return spec, nil
+}
+
+// LoadSyncSpecs loads the build specs (*.yaml and *.yml files) of the directory, sorted by name
+func LoadSyncSpecs(dir string) ([]SyncSpec, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read build specs directory: %w", err)
+	}
+
+	specs := []SyncSpec{}
+	for _, entry := range entries {
+		extension := filepath.Ext(entry.Name())
+		if entry.IsDir() || (extension != ".yaml" && extension != ".yml") {
+			continue
+		}
+
+		content, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read build spec: %w", err)
+		}
+		spec, err := ParseSyncSpec(strings.TrimSuffix(entry.Name(), extension), content)
+		if err != nil {
+			return nil, err
+		}
+		specs = append(specs, spec)
+	}
+
+	return specs, nil
+}
@@ -0,0 +1,69 @@
+package configuration
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSyncSpec_CommandLine(t *testing.T) {
+	content := `
+command: docker buildx build --push --build-arg "GREETING=hello world"
+tags:
+  - org/api:v1
+  - org/api:latest
+context: ./api
+`
+
+	spec, err := ParseSyncSpec("api", []byte(content))
+	require.NoError(t, err)
+
+	assert.Equal(t, "api", spec.Name)
+	assert.Equal(t, []string{
+		"docker", "buildx", "build", "--push", "--build-arg", "GREETING=hello world",
+		"--tag", "org/api:v1", "--tag", "org/api:latest", "./api",
+	}, spec.FullCommand())
+}
+
+func TestParseSyncSpec_CommandArray(t *testing.T) {
+	content := `command: ["docker", "buildx", "bake", "--push", "my target"]`
+
+	spec, err := ParseSyncSpec("bake", []byte(content))
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"docker", "buildx", "bake", "--push", "my target"}, spec.FullCommand())
+}
+
+func TestParseSyncSpec_Errors(t *testing.T) {
+	_, err := ParseSyncSpec("empty", []byte("tags: [org/api:v1]"))
+	assert.ErrorContains(t, err, "has no command")
+
+	_, err = ParseSyncSpec("invalid", []byte("command: {a: b}"))
+	assert.ErrorContains(t, err, "must be an array of strings or a string")
+
+	_, err = ParseSyncSpec("unterminated", []byte(`command: docker buildx build "unterminated`))
+	assert.ErrorContains(t, err, "invalid command")
+}
+
+func TestLoadSyncSpecs(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "web.yml"), []byte("command: docker buildx build --push -t org/web:v1 ./web"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "api.yaml"), []byte("command: docker buildx build --push -t org/api:v1 ./api"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "README.md"), []byte("not a spec"), 0644))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "nested.yaml"), 0755))
+
+	specs, err := LoadSyncSpecs(dir)
+	require.NoError(t, err)
+
+	require.Len(t, specs, 2)
+	assert.Equal(t, "api", specs[0].Name)
+	assert.Equal(t, "web", specs[1].Name)
+}
+
+func TestLoadSyncSpecs_MissingDir(t *testing.T) {
+	_, err := LoadSyncSpecs(filepath.Join(t.TempDir(), "missing"))
+	assert.Error(t, err)
+}
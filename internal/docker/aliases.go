@@ -0,0 +1,45 @@
+package docker
+
+import (
+	"maps"
+	"slices"
+	"strings"
+)
+
+// buildCommandAliases are the docker subcommands that run one of the build commands that mimosa parses ("docker
+// build", "docker buildx build" and "docker buildx bake") under another name - an alias that docker adds only needs
+// to be added here
+var buildCommandAliases = map[string][]string{
+	"builder build": {"build"},
+	"image build":   {"build"},
+	"buildx b":      {"buildx", "build"},
+	"buildx f":      {"buildx", "bake"},
+}
+
+func buildCommandAlias(command []string) ([]string, bool) {
+	if len(command) < 3 || command[0] != "docker" {
+		return nil, false
+	}
+	canonical, ok := buildCommandAliases[command[1]+" "+command[2]]
+	return canonical, ok
+}
+
+// CanonicalBuildCommand returns the docker command with the alias of its subcommand replaced by the build command it
+// stands for, e.g. "docker builder build ." becomes "docker build ." - docker's global flags must be split off first
+func CanonicalBuildCommand(command []string) []string {
+	canonical, ok := buildCommandAlias(command)
+	if !ok {
+		return command
+	}
+	return slices.Concat([]string{"docker"}, canonical, command[3:])
+}
+
+// CacheableSubcommands returns the docker subcommands that mimosa parses, aliases included, e.g. ["build"],
+// ["buildx", "bake"] and ["builder", "build"]
+func CacheableSubcommands() [][]string {
+	subcommands := [][]string{{"build"}, {"buildx", "build"}, {"buildx", "bake"}}
+	for _, alias := range slices.Sorted(maps.Keys(buildCommandAliases)) {
+		subcommands = append(subcommands, strings.Fields(alias))
+	}
+	return subcommands
+}
@@ -0,0 +1,29 @@
+package docker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCanonicalBuildCommand(t *testing.T) {
+	assert.Equal(t, []string{"docker", "build", "-t", "app:v1", "."}, CanonicalBuildCommand([]string{"docker", "builder", "build", "-t", "app:v1", "."}))
+	assert.Equal(t, []string{"docker", "buildx", "bake", "api"}, CanonicalBuildCommand([]string{"docker", "buildx", "f", "api"}))
+
+	// anything else is kept as is
+	for _, command := range [][]string{
+		{"docker", "buildx", "build", "."},
+		{"docker", "builder", "prune"},
+		{"podman", "image", "build", "."},
+		{"docker", "build"},
+	} {
+		assert.Equal(t, command, CanonicalBuildCommand(command))
+	}
+}
+
+func TestBuildCommandPrefixLen_Aliases(t *testing.T) {
+	assert.Equal(t, 2, buildCommandPrefixLen([]string{"docker", "build", "."}))
+	assert.Equal(t, 3, buildCommandPrefixLen([]string{"docker", "buildx", "build", "."}))
+	assert.Equal(t, 3, buildCommandPrefixLen([]string{"docker", "image", "build", "."}))
+	assert.True(t, isBakeCommand([]string{"docker", "buildx", "f"}))
+}
@@ -0,0 +1,56 @@
+package docker
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/hytromo/mimosa/internal/reporting"
+)
+
+// WriteAnnotationArtifact pushes an empty image that only carries the annotations under the tag, e.g. the signature
+// of a cache tag next to it
+func WriteAnnotationArtifact(dockerConfigDir string, tag string, annotations map[string]string) error {
+	ref, err := name.NewTag(tag)
+	if err != nil {
+		return err
+	}
+	artifact, ok := mutate.Annotations(empty.Image, annotations).(v1.Image)
+	if !ok {
+		return fmt.Errorf("failed to annotate the artifact %s", tag)
+	}
+	taggedRef, registryOptions, err := withRegistryOptions(dockerConfigDir, ref)
+	if err != nil {
+		return err
+	}
+	if err := remote.Write(taggedRef, artifact, registryOptions...); err != nil {
+		return err
+	}
+	rememberTagExists(taggedRef, true)
+	reporting.Audit(reporting.AuditArtifactPushed, "tag", tag, "annotations", annotations)
+	return nil
+}
+
+// ArtifactAnnotations returns the annotations of the manifest of the tag - found is false if the tag does not exist
+func ArtifactAnnotations(dockerConfigDir string, tag string) (annotations map[string]string, found bool, err error) {
+	ref, err := name.NewTag(tag)
+	if err != nil {
+		return nil, false, err
+	}
+	desc, err := Get(dockerConfigDir, ref)
+	if err != nil {
+		if isNotFoundError(err) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	manifest, err := v1.ParseManifest(bytes.NewReader(desc.Manifest))
+	if err != nil {
+		return nil, false, err
+	}
+	return manifest.Annotations, true, nil
+}
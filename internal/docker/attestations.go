@@ -0,0 +1,149 @@
+package docker
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/docker/buildx/util/buildflags"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/samber/lo"
+)
+
+// the attestation types that mimosa checks the cached images for - other types are not checked
+const (
+	attestationProvenance = "provenance"
+	attestationSBOM       = "sbom"
+)
+
+// buildkit marks the attestation manifests of an index with this annotation, and the predicate of their layers with
+// the in-toto one
+const (
+	referenceTypeAnnotation   = "vnd.docker.reference.type"
+	attestationManifestType   = "attestation-manifest"
+	predicateTypeAnnotation   = "in-toto.io/predicate-type"
+	provenancePredicatePrefix = "https://slsa.dev/provenance/"
+)
+
+// requestedAttestations returns the attestation types (provenance, sbom) that a docker build command asks for with
+// --attest, --provenance and --sbom, sorted - like buildx, the last one of each type wins, so that e.g.
+// "--provenance=false" disables an earlier "--attest type=provenance"
+func requestedAttestations(dockerBuildCmd []string) []string {
+	flags, _ := splitBuildArgs(dockerBuildCmd[min(buildCommandPrefixLen(dockerBuildCmd), len(dockerBuildCmd)):])
+	attests, shorthands := []string{}, []string{}
+	for _, flag := range flags {
+		if !flag.hasValue {
+			continue
+		}
+		switch flag.name {
+		case "--attest":
+			attests = append(attests, flag.value)
+		case "--provenance":
+			shorthands = append(shorthands, buildflags.CanonicalizeAttest(attestationProvenance, flag.value))
+		case "--sbom":
+			shorthands = append(shorthands, buildflags.CanonicalizeAttest(attestationSBOM, flag.value))
+		}
+	}
+
+	parsed, err := buildflags.ParseAttests(append(attests, shorthands...))
+	if err != nil {
+		// buildx fails the build too - nothing to check
+		return nil
+	}
+	return enabledAttestations(parsed.Normalize())
+}
+
+// enabledAttestations returns the checked attestation types that are not disabled, sorted
+func enabledAttestations(attests buildflags.Attests) []string {
+	types := []string{}
+	for _, attest := range attests {
+		if attest != nil && !attest.Disabled && (attest.Type == attestationProvenance || attest.Type == attestationSBOM) {
+			types = append(types, attest.Type)
+		}
+	}
+	types = lo.Uniq(types)
+	slices.Sort(types)
+	return types
+}
+
+// predicateAttestation returns the attestation type of an in-toto predicate type, "" for the unchecked ones
+func predicateAttestation(predicateType string) string {
+	switch {
+	case strings.HasPrefix(predicateType, provenancePredicatePrefix):
+		return attestationProvenance
+	case strings.HasPrefix(predicateType, "https://spdx.dev/"), strings.HasPrefix(predicateType, "https://cyclonedx.org/"):
+		return attestationSBOM
+	}
+	return ""
+}
+
+// imageAttestations returns the attestation types that the attestation manifests of the index of the tag hold - a
+// single image has none
+func imageAttestations(dockerConfigDir string, tag string) ([]string, error) {
+	ref, err := name.ParseReference(tag)
+	if err != nil {
+		return nil, err
+	}
+	desc, err := Get(dockerConfigDir, ref)
+	if err != nil {
+		return nil, err
+	}
+	if !desc.MediaType.IsIndex() {
+		return nil, nil
+	}
+
+	index, err := desc.ImageIndex()
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := index.IndexManifest()
+	if err != nil {
+		return nil, err
+	}
+
+	types := []string{}
+	for _, descriptor := range manifest.Manifests {
+		if descriptor.Annotations[referenceTypeAnnotation] != attestationManifestType {
+			continue
+		}
+		attestationDesc, err := Get(dockerConfigDir, ref.Context().Digest(descriptor.Digest.String()))
+		if err != nil {
+			return nil, err
+		}
+		image, err := attestationDesc.Image()
+		if err != nil {
+			return nil, err
+		}
+		attestationManifest, err := image.Manifest()
+		if err != nil {
+			return nil, err
+		}
+		for _, layer := range attestationManifest.Layers {
+			if attestation := predicateAttestation(layer.Annotations[predicateTypeAnnotation]); attestation != "" {
+				types = append(types, attestation)
+			}
+		}
+	}
+	return lo.Uniq(types), nil
+}
+
+// VerifyCachedAttestations checks that the images of the cache tags hold all the attestations requested for their
+// targets, so that e.g. an image that was built without provenance (a builder that does not support attestations
+// drops them) is not served to a build that asks for it
+func VerifyCachedAttestations(dockerConfigDir string, cacheTagPairsByTarget map[string][]CacheTagPair, attestationsByTarget map[string][]string) error {
+	for target, attestations := range attestationsByTarget {
+		pairs := cacheTagPairsByTarget[target]
+		if len(attestations) == 0 || len(pairs) == 0 {
+			continue
+		}
+		// all the cache tags of a target point to the same image
+		cached, err := imageAttestations(dockerConfigDir, pairs[0].CacheTag)
+		if err != nil {
+			return fmt.Errorf("failed to get the attestations of %s: %w", pairs[0].CacheTag, err)
+		}
+		if missing, _ := lo.Difference(attestations, cached); len(missing) > 0 {
+			return fmt.Errorf("%s has no %s attestation", pairs[0].CacheTag, strings.Join(missing, ", "))
+		}
+	}
+	return nil
+}
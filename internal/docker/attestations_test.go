@@ -0,0 +1,88 @@
+package docker
+
+import (
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestedAttestations(t *testing.T) {
+	for _, tc := range []struct {
+		args     []string
+		expected []string
+	}{
+		{[]string{"--push", "-t", "app:v1", "."}, []string{}},
+		{[]string{"--provenance=mode=max", "."}, []string{"provenance"}},
+		{[]string{"--provenance", "true", "--sbom=true", "."}, []string{"provenance", "sbom"}},
+		{[]string{"--attest", "type=sbom", "--attest", "type=provenance,mode=min,builder-id=https://ci/run/1", "."}, []string{"provenance", "sbom"}},
+		// like buildx, the shorthands come after --attest, and the last one of a type wins
+		{[]string{"--provenance=false", "--attest", "type=provenance,mode=max", "."}, []string{}},
+		{[]string{"--attest", "type=sbom,disabled=true", "."}, []string{}},
+		{[]string{"--attest", "type=custom", "."}, []string{}},
+	} {
+		assert.Equal(t, tc.expected, requestedAttestations(append([]string{"docker", "buildx", "build"}, tc.args...)), tc.args)
+	}
+}
+
+// writeTestIndexWithAttestations writes an index with a linux/amd64 image and an attestation manifest holding the
+// statements of the predicate types
+func writeTestIndexWithAttestations(t *testing.T, tag string, predicateTypes ...string) {
+	t.Helper()
+	image, err := random.Image(64, 1)
+	require.NoError(t, err)
+	index := mutate.AppendManifests(empty.Index, mutate.IndexAddendum{
+		Add:        image,
+		Descriptor: v1.Descriptor{Platform: &v1.Platform{OS: "linux", Architecture: "amd64"}},
+	})
+
+	var attestationManifest v1.Image = empty.Image
+	for _, predicateType := range predicateTypes {
+		attestationManifest, err = mutate.Append(attestationManifest, mutate.Addendum{
+			Layer:       static.NewLayer([]byte(`{"predicateType":"`+predicateType+`"}`), types.MediaType("application/vnd.in-toto+json")),
+			Annotations: map[string]string{predicateTypeAnnotation: predicateType},
+		})
+		require.NoError(t, err)
+	}
+	index = mutate.AppendManifests(index, mutate.IndexAddendum{
+		Add: attestationManifest,
+		Descriptor: v1.Descriptor{
+			Platform:    &v1.Platform{OS: "unknown", Architecture: "unknown"},
+			Annotations: map[string]string{referenceTypeAnnotation: attestationManifestType},
+		},
+	})
+	require.NoError(t, remote.WriteIndex(parseTestReference(t, tag), index))
+}
+
+func TestVerifyCachedAttestations(t *testing.T) {
+	registryHost := startInMemoryRegistry(t)
+	apiTag := registryHost + "/api:" + CacheTagPrefix + "abc"
+	webTag := registryHost + "/web:" + CacheTagPrefix + "abc"
+	singleTag := registryHost + "/single:" + CacheTagPrefix + "abc"
+	writeTestIndexWithAttestations(t, apiTag, "https://slsa.dev/provenance/v1", "https://spdx.dev/Document")
+	writeTestIndexWithAttestations(t, webTag, "https://slsa.dev/provenance/v0.2")
+	image, err := random.Image(64, 1)
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(parseTestReference(t, singleTag), image))
+
+	pairs := map[string][]CacheTagPair{
+		"api":    {{CacheTag: apiTag, NewTag: registryHost + "/api:v1"}},
+		"web":    {{CacheTag: webTag, NewTag: registryHost + "/web:v1"}},
+		"single": {{CacheTag: singleTag, NewTag: registryHost + "/single:v1"}},
+	}
+
+	assert.NoError(t, VerifyCachedAttestations("", pairs, map[string][]string{"api": {"provenance", "sbom"}, "web": {"provenance"}}))
+	assert.NoError(t, VerifyCachedAttestations("", pairs, map[string][]string{"single": {}}))
+	assert.ErrorContains(t, VerifyCachedAttestations("", pairs, map[string][]string{"web": {"provenance", "sbom"}}), "has no sbom attestation")
+	assert.ErrorContains(t, VerifyCachedAttestations("", pairs, map[string][]string{"single": {"provenance"}}), "has no provenance attestation")
+	assert.Error(t, VerifyCachedAttestations("", map[string][]CacheTagPair{
+		"default": {{CacheTag: registryHost + "/missing:" + CacheTagPrefix + "abc", NewTag: registryHost + "/missing:v1"}},
+	}, map[string][]string{"default": {"provenance"}}))
+}
@@ -6,16 +6,69 @@ import (
 	ecr "github.com/awslabs/amazon-ecr-credential-helper/ecr-login"
 	ecrapi "github.com/awslabs/amazon-ecr-credential-helper/ecr-login/api"
 	acr "github.com/chrismellard/docker-credential-acr-env/pkg/credhelper"
+	"github.com/docker/cli/cli/config"
+	"github.com/docker/cli/cli/config/types"
 	cntauthn "github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
 	"github.com/google/go-containerregistry/pkg/v1/google"
 )
 
-var Keychain = cntauthn.NewMultiKeychain(
-	cntauthn.DefaultKeychain,
+var cloudKeychains = []cntauthn.Keychain{
 	google.Keychain,
 	cntauthn.NewKeychainFromHelper(ecr.NewECRHelper(
 		ecr.WithClientFactory(ecrapi.DefaultClientFactory{}),
 		ecr.WithLogger(io.Discard), // ECR keychain is too noisy when the target is a non-ecr registry
 	)),
 	cntauthn.NewKeychainFromHelper(acr.ACRCredHelper{}),
-)
+}
+
+var Keychain = cntauthn.NewMultiKeychain(append([]cntauthn.Keychain{cntauthn.DefaultKeychain}, cloudKeychains...)...)
+
+// configDirKeychain reads the credentials of a docker config dir, like the default keychain does for DOCKER_CONFIG
+type configDirKeychain struct {
+	dir string
+}
+
+func (k configDirKeychain) Resolve(target cntauthn.Resource) (cntauthn.Authenticator, error) {
+	configFile, err := config.Load(k.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var authConfig, empty types.AuthConfig
+	for _, key := range []string{target.String(), target.RegistryStr()} {
+		if key == name.DefaultRegistry {
+			key = cntauthn.DefaultAuthKey
+		}
+
+		authConfig, err = configFile.GetAuthConfig(key)
+		if err != nil {
+			return nil, err
+		}
+		// only the credentials tell whether the config has any for the target
+		authConfig.ServerAddress = ""
+		if authConfig != empty {
+			break
+		}
+	}
+	if authConfig == empty {
+		return cntauthn.Anonymous, nil
+	}
+
+	return cntauthn.FromConfig(cntauthn.AuthConfig{
+		Username:      authConfig.Username,
+		Password:      authConfig.Password,
+		Auth:          authConfig.Auth,
+		IdentityToken: authConfig.IdentityToken,
+		RegistryToken: authConfig.RegistryToken,
+	}), nil
+}
+
+// keychainForConfigDir returns the keychain of a command that picks its docker config dir with "docker --config <dir>",
+// the default Keychain (DOCKER_CONFIG or ~/.docker) otherwise
+func keychainForConfigDir(dockerConfigDir string) cntauthn.Keychain {
+	if dockerConfigDir == "" {
+		return Keychain
+	}
+	return cntauthn.NewMultiKeychain(append([]cntauthn.Keychain{configDirKeychain{dir: dockerConfigDir}}, cloudKeychains...)...)
+}
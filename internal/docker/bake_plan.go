@@ -0,0 +1,26 @@
+package docker
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// validateBakePlan makes sure the bake plan is a JSON bake definition, i.e. it was produced with --print
+func validateBakePlan(path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read bake plan: %w", err)
+	}
+
+	var plan struct {
+		Target map[string]json.RawMessage `json:"target"`
+	}
+	if err := json.Unmarshal(content, &plan); err != nil {
+		return fmt.Errorf("bake plan %s is not the JSON output of docker buildx bake --print: %w", path, err)
+	}
+	if len(plan.Target) == 0 {
+		return fmt.Errorf("bake plan %s has no targets", path)
+	}
+	return nil
+}
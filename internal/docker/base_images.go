@@ -0,0 +1,138 @@
+package docker
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/hytromo/mimosa/internal/hasher"
+	"github.com/moby/buildkit/frontend/dockerfile/instructions"
+	"github.com/moby/buildkit/frontend/dockerfile/parser"
+	"github.com/moby/buildkit/frontend/dockerfile/shell"
+	"github.com/samber/lo"
+)
+
+// hashesBaseImages reports whether the digests of the base images of a build are included in its hash: with
+// --hash-base-images, or with --pull-policy resolve for the builds that always pull them (--pull), whose intent is to
+// build on the current base images
+func hashesBaseImages(hashingOptions hasher.Options, pulls bool) bool {
+	return hashingOptions.HashBaseImages || (hashingOptions.HashBaseImagesOnPull && pulls)
+}
+
+// baseImages returns the images that the stages of the Dockerfile are built FROM, and the images that they
+// COPY --from or RUN --mount from, with the ARGs declared before the first FROM substituted (by their build args, or
+// their defaults). Stages, scratch and the named build contexts are not images of a registry
+func baseImages(dockerfile []byte, buildArgs map[string]string, buildContextNames []string) ([]string, error) {
+	result, err := parser.Parse(bytes.NewReader(dockerfile))
+	if err != nil {
+		return nil, err
+	}
+	stages, metaArgs, err := instructions.Parse(result.AST, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	env := []string{}
+	for _, metaArg := range metaArgs {
+		for _, arg := range metaArg.Args {
+			if value, ok := buildArgs[arg.Key]; ok {
+				env = append(env, arg.Key+"="+value)
+			} else if arg.Value != nil {
+				env = append(env, arg.Key+"="+*arg.Value)
+			}
+		}
+	}
+
+	lex := shell.NewLex(result.EscapeToken)
+	isImage := func(image string, stageNames []string) bool {
+		isStage := slices.ContainsFunc(stageNames, func(name string) bool { return strings.EqualFold(name, image) })
+		return !isStage && image != "scratch" && !slices.Contains(buildContextNames, image)
+	}
+
+	allStageNames := lo.FilterMap(stages, func(stage instructions.Stage, _ int) (string, bool) {
+		return stage.Name, stage.Name != ""
+	})
+	stageNames := []string{}
+	images := []string{}
+	for _, stage := range stages {
+		image, _, err := lex.ProcessWord(stage.BaseName, shell.EnvsFromSlice(env))
+		if err != nil {
+			return nil, err
+		}
+		if image == "" {
+			return nil, fmt.Errorf("the base image %q is empty after substituting the ARGs", stage.BaseName)
+		}
+
+		// FROM can only refer to the stages before it
+		if isImage(image, stageNames) {
+			images = append(images, image)
+		}
+		if stage.Name != "" {
+			stageNames = append(stageNames, stage.Name)
+		}
+
+		for _, from := range commandSources(stage.Commands) {
+			image, _, err := lex.ProcessWord(from, shell.EnvsFromSlice(env))
+			if err != nil {
+				return nil, err
+			}
+			if image == "" {
+				return nil, fmt.Errorf("the --from image %q is empty after substituting the ARGs", from)
+			}
+			// --from can also refer to a stage by its index
+			if _, err := strconv.Atoi(image); err == nil || !isImage(image, allStageNames) {
+				continue
+			}
+			images = append(images, image)
+		}
+	}
+	return lo.Uniq(images), nil
+}
+
+// commandSources returns the --from of the COPY commands and of the RUN --mount's
+func commandSources(commands []instructions.Command) []string {
+	sources := []string{}
+	for _, command := range commands {
+		switch command := command.(type) {
+		case *instructions.CopyCommand:
+			if command.From != "" {
+				sources = append(sources, command.From)
+			}
+		case *instructions.RunCommand:
+			for _, mount := range instructions.GetMounts(command) {
+				if mount.From != "" {
+					sources = append(sources, mount.From)
+				}
+			}
+		}
+	}
+	return sources
+}
+
+// baseImageDigests returns the digests of the base images of the Dockerfile when --hash-base-images is set (or the build
+// pulls with --pull-policy resolve): a floating base (e.g. alpine:latest) then causes a cache miss as soon as it moves.
+// Failing to resolve them fails the hashing, so that a base that may have moved is never a cache hit
+func baseImageDigests(dockerConfigDir string, dockerfile []byte, buildArgs map[string]string, buildContextNames []string, hashingOptions hasher.Options, pulls bool) ([]string, error) {
+	if !hashesBaseImages(hashingOptions, pulls) {
+		return nil, nil
+	}
+
+	images, err := baseImages(dockerfile, buildArgs, buildContextNames)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find the base images of the Dockerfile: %w", err)
+	}
+
+	digests := make([]string, 0, len(images))
+	for _, image := range images {
+		digest, err := resolveDigest(dockerConfigDir, image)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve the base image %s: %w", image, err)
+		}
+		slog.Debug("Including the base image in the hash", "image", image, "digest", digest)
+		digests = append(digests, digest)
+	}
+	return digests, nil
+}
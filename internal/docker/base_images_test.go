@@ -0,0 +1,89 @@
+package docker
+
+import (
+	"os"
+	"testing"
+
+	"github.com/hytromo/mimosa/internal/hasher"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBaseImages(t *testing.T) {
+	dockerfile := []byte(`ARG BASE=alpine:3.20
+ARG GO_VERSION
+FROM --platform=$BUILDPLATFORM golang:${GO_VERSION:-1.24} AS build
+FROM build AS test
+FROM scratch AS empty
+FROM shared
+FROM ${BASE}
+FROM alpine:3.20
+`)
+
+	images, err := baseImages(dockerfile, map[string]string{}, []string{"shared"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"golang:1.24", "alpine:3.20"}, images, "stages, scratch and build contexts are not images, duplicates are resolved once")
+
+	images, err = baseImages(dockerfile, map[string]string{"BASE": "debian:12", "GO_VERSION": "1.25"}, []string{"shared"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"golang:1.25", "debian:12", "alpine:3.20"}, images, "build args override the ARG defaults")
+
+	_, err = baseImages([]byte("FROM $UNDECLARED\n"), map[string]string{"UNDECLARED": "alpine"}, nil)
+	assert.ErrorContains(t, err, "empty after substituting", "only the ARGs declared before the first FROM are substituted")
+}
+
+func TestBaseImages_FromImages(t *testing.T) {
+	dockerfile := []byte(`ARG NGINX=nginx:1.27
+FROM alpine:3.20 AS build
+COPY --from=${NGINX} /etc/nginx/nginx.conf /etc/nginx/
+COPY --from=0 /etc/os-release /tmp/
+COPY --from=final /app /app
+COPY --from=shared /config /config
+RUN --mount=type=bind,from=busybox:1.36,source=/bin,target=/tools ls /tools
+RUN --mount=type=cache,target=/root/.cache --mount=type=bind,from=build,target=/src ls /src
+FROM scratch AS final
+COPY --from=golang:1.24 /usr/local/go/bin/go /go
+`)
+
+	images, err := baseImages(dockerfile, map[string]string{}, []string{"shared"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"alpine:3.20", "nginx:1.27", "busybox:1.36", "golang:1.24"}, images, "stages (by name or index) and build contexts are not images")
+}
+
+func TestBaseImageDigests(t *testing.T) {
+	forgetResolvedDigests(t)
+	registryHost := startInMemoryRegistry(t)
+	digest := pushFrontend(t, registryHost+"/base:latest")
+	dockerfile := []byte("FROM " + registryHost + "/base:latest\n")
+
+	digests, err := baseImageDigests("", dockerfile, nil, nil, hasher.Options{}, false)
+	require.NoError(t, err)
+	assert.Empty(t, digests, "base images are only resolved with --hash-base-images")
+
+	hashBaseImages := hasher.Options{HashBaseImages: true}
+	digests, err = baseImageDigests("", dockerfile, nil, nil, hashBaseImages, false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{digest}, digests)
+
+	_, err = baseImageDigests("", []byte("FROM "+registryHost+"/base:missing\n"), nil, nil, hashBaseImages, false)
+	assert.ErrorContains(t, err, "failed to resolve the base image")
+}
+
+func TestParseBuildCommand_MovedBaseImageChangesTheHash(t *testing.T) {
+	forgetResolvedDigests(t)
+	registryHost := startInMemoryRegistry(t)
+	pushFrontend(t, registryHost+"/base:latest")
+
+	t.Chdir(t.TempDir())
+	require.NoError(t, os.WriteFile("Dockerfile", []byte("FROM "+registryHost+"/base:latest\nRUN echo hi\n"), 0o644))
+	command := []string{"docker", "build", "--push", "-t", "myreg/app:v1", "."}
+
+	before, err := ParseBuildCommand(command, hasher.Options{HashBaseImages: true}, "")
+	require.NoError(t, err)
+
+	pushFrontend(t, registryHost+"/base:latest")
+	forgetResolvedDigests(t)
+	after, err := ParseBuildCommand(command, hasher.Options{HashBaseImages: true}, "")
+	require.NoError(t, err)
+	assert.NotEqual(t, before.Hash, after.Hash)
+}
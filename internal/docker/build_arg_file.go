@@ -0,0 +1,76 @@
+package docker
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+const buildArgFileFlag = "--build-arg-file"
+
+// expandBuildArgFiles replaces every --build-arg-file of a docker build command with the build args read from the
+// file, as "--build-arg KEY=VALUE" in the order of the file, so that the hash depends on the values of the build args
+// and not on where the file is. The file has one KEY=VALUE per line; empty lines and lines starting with # are
+// ignored, and a KEY without a value is kept as is: like with --build-arg KEY, docker takes its value from the
+// environment, which is not hashed
+func expandBuildArgFiles(dockerBuildCmd []string) ([]string, error) {
+	prefixLen := min(buildCommandPrefixLen(dockerBuildCmd), len(dockerBuildCmd))
+	expanded := append([]string{}, dockerBuildCmd[:prefixLen]...)
+
+	for i := prefixLen; i < len(dockerBuildCmd); i++ {
+		arg := dockerBuildCmd[i]
+		if arg == "--" {
+			expanded = append(expanded, dockerBuildCmd[i:]...)
+			break
+		}
+
+		path, hasValue := strings.CutPrefix(arg, buildArgFileFlag+"=")
+		if arg == buildArgFileFlag && i+1 < len(dockerBuildCmd) {
+			i++
+			path, hasValue = dockerBuildCmd[i], true
+		}
+		if !hasValue {
+			expanded = append(expanded, arg)
+			continue
+		}
+
+		fileArgs, err := readBuildArgFile(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, buildArg := range fileArgs {
+			expanded = append(expanded, "--build-arg", buildArg)
+		}
+	}
+
+	return expanded, nil
+}
+
+// readBuildArgFile returns the build args of the file
+func readBuildArgFile(path string) ([]string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the build arg file: %w", err)
+	}
+
+	buildArgs := []string{}
+	for lineNumber, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, value, hasValue := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if key == "" || strings.ContainsAny(key, " \t") {
+			return nil, fmt.Errorf("invalid build arg on line %d of %s", lineNumber+1, path)
+		}
+		if !hasValue {
+			buildArgs = append(buildArgs, key)
+			continue
+		}
+		buildArgs = append(buildArgs, key+"="+value)
+	}
+
+	return buildArgs, nil
+}
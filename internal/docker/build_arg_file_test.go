@@ -0,0 +1,55 @@
+package docker
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hytromo/mimosa/internal/hasher"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpandBuildArgFiles(t *testing.T) {
+	argsFile := filepath.Join(t.TempDir(), "build.args")
+	require.NoError(t, os.WriteFile(argsFile, []byte("# versions\nVERSION=1.2.3\n\nGREETING = hello world\nWITHOUT_VALUE\nOTHER_WITHOUT_VALUE\n"), 0644))
+
+	expanded, err := expandBuildArgFiles([]string{"docker", "buildx", "build", "--build-arg", "A=1", "--build-arg-file", argsFile, "--build-arg-file=" + argsFile, "."})
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"docker", "buildx", "build", "--build-arg", "A=1",
+		"--build-arg", "VERSION=1.2.3", "--build-arg", "GREETING= hello world", "--build-arg", "WITHOUT_VALUE", "--build-arg", "OTHER_WITHOUT_VALUE",
+		"--build-arg", "VERSION=1.2.3", "--build-arg", "GREETING= hello world", "--build-arg", "WITHOUT_VALUE", "--build-arg", "OTHER_WITHOUT_VALUE",
+		".",
+	}, expanded)
+
+	_, err = expandBuildArgFiles([]string{"docker", "build", "--build-arg-file", filepath.Join(t.TempDir(), "missing"), "."})
+	assert.ErrorContains(t, err, "failed to read the build arg file")
+
+	invalidFile := filepath.Join(t.TempDir(), "invalid.args")
+	require.NoError(t, os.WriteFile(invalidFile, []byte("VERSION=1\nNOT A KEY=2\n"), 0644))
+	_, err = expandBuildArgFiles([]string{"docker", "build", "--build-arg-file", invalidFile, "."})
+	assert.ErrorContains(t, err, "invalid build arg on line 2")
+}
+
+func TestParseBuildCommand_BuildArgFileHashedByValues(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Chdir(tempDir)
+	require.NoError(t, os.WriteFile("Dockerfile", []byte("FROM scratch\nARG VERSION"), 0644))
+
+	hashWithArgsFile := func(path string, content string) string {
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+		parsed, err := ParseBuildCommand([]string{"docker", "buildx", "build", "--push", "--build-arg-file", path, "-t", "myapp:latest", "."}, hasher.Options{}, "")
+		require.NoError(t, err)
+		return parsed.Hash
+	}
+
+	// the path of the file does not matter, its build args do
+	first := hashWithArgsFile(filepath.Join(t.TempDir(), "build.args"), "VERSION=1")
+	assert.Equal(t, first, hashWithArgsFile(filepath.Join(t.TempDir(), "other.args"), "VERSION=1"))
+	assert.NotEqual(t, first, hashWithArgsFile(filepath.Join(t.TempDir(), "build.args"), "VERSION=2"))
+
+	parsed, err := ParseBuildCommand([]string{"docker", "buildx", "build", "--push", "--build-arg", "VERSION=1", "-t", "myapp:latest", "."}, hasher.Options{}, "")
+	require.NoError(t, err)
+	assert.Equal(t, first, parsed.Hash, "the same as giving the build args with --build-arg")
+}
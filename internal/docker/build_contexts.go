@@ -0,0 +1,39 @@
+package docker
+
+import (
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/hytromo/mimosa/internal/hasher"
+)
+
+// the scheme of the named build contexts that are images of a registry, e.g. --build-context alpine=docker-image://alpine:3.20
+const dockerImageContextScheme = "docker-image://"
+
+// buildContextImageDigests returns the digests of the images that the named build contexts point to, under the same
+// conditions as baseImageDigests: a context that replaces a FROM image (or that is copied from) is a base image too,
+// and its tag can move just the same. Contexts of other schemes are hashed by the hasher (local directories and OCI
+// layouts) or by the reference itself (git URLs and bake targets, whose own inputs bake hashes)
+func buildContextImageDigests(dockerConfigDir string, buildContexts map[string]string, hashingOptions hasher.Options, pulls bool) ([]string, error) {
+	if !hashesBaseImages(hashingOptions, pulls) {
+		return nil, nil
+	}
+
+	digests := []string{}
+	for _, contextName := range slices.Sorted(maps.Keys(buildContexts)) {
+		image, ok := strings.CutPrefix(buildContexts[contextName], dockerImageContextScheme)
+		if !ok {
+			continue
+		}
+		digest, err := resolveDigest(dockerConfigDir, image)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve the image %s of the build context %s: %w", image, contextName, err)
+		}
+		slog.Debug("Including the image of the build context in the hash", "context", contextName, "image", image, "digest", digest)
+		digests = append(digests, contextName+"="+digest)
+	}
+	return digests, nil
+}
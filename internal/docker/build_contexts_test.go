@@ -0,0 +1,52 @@
+package docker
+
+import (
+	"os"
+	"testing"
+
+	"github.com/hytromo/mimosa/internal/hasher"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildContextImageDigests(t *testing.T) {
+	forgetResolvedDigests(t)
+	registryHost := startInMemoryRegistry(t)
+	digest := pushFrontend(t, registryHost+"/base:latest")
+	buildContexts := map[string]string{
+		"base":  "docker-image://" + registryHost + "/base:latest",
+		"repo":  "https://github.com/user/repo.git",
+		"local": "./shared",
+	}
+
+	digests, err := buildContextImageDigests("", buildContexts, hasher.Options{}, false)
+	require.NoError(t, err)
+	assert.Empty(t, digests, "the images of the build contexts are only resolved with --hash-base-images")
+
+	hashBaseImages := hasher.Options{HashBaseImages: true}
+	digests, err = buildContextImageDigests("", buildContexts, hashBaseImages, false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"base=" + digest}, digests)
+
+	_, err = buildContextImageDigests("", map[string]string{"base": "docker-image://" + registryHost + "/base:missing"}, hashBaseImages, false)
+	assert.ErrorContains(t, err, "failed to resolve the image "+registryHost+"/base:missing of the build context base")
+}
+
+func TestParseBuildCommand_MovedBuildContextImageChangesTheHash(t *testing.T) {
+	forgetResolvedDigests(t)
+	registryHost := startInMemoryRegistry(t)
+	pushFrontend(t, registryHost+"/base:latest")
+
+	t.Chdir(t.TempDir())
+	require.NoError(t, os.WriteFile("Dockerfile", []byte("FROM base\nRUN echo hi\n"), 0o644))
+	command := []string{"docker", "buildx", "build", "--push", "--build-context", "base=docker-image://" + registryHost + "/base:latest", "-t", "myreg/app:v1", "."}
+
+	before, err := ParseBuildCommand(command, hasher.Options{HashBaseImages: true}, "")
+	require.NoError(t, err)
+
+	forgetResolvedDigests(t)
+	pushFrontend(t, registryHost+"/base:latest")
+	after, err := ParseBuildCommand(command, hasher.Options{HashBaseImages: true}, "")
+	require.NoError(t, err)
+	assert.NotEqual(t, before.Hash, after.Hash, "the image of the build context moved")
+}
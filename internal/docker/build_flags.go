@@ -0,0 +1,82 @@
+package docker
+
+import (
+	"slices"
+	"strings"
+)
+
+// buildBooleanFlags are the flags of docker build/docker buildx build that do not take a value - every other flag
+// takes one, even if it starts with a dash, e.g. --label "-weird"
+var buildBooleanFlags = []string{
+	"--check", "-D", "--debug", "--load", "--no-cache", "--pull", "--push", "-q", "--quiet",
+	// legacy docker build flags that buildx accepts and ignores
+	"--compress", "--disable-content-trust", "--force-rm", "--rm", "--squash",
+}
+
+// buildFlag is a flag of a docker build command, e.g. "-t" with the value "myapp:latest"
+type buildFlag struct {
+	name     string
+	value    string
+	hasValue bool
+	// the arguments the flag was given as, e.g. ["-t", "myapp:latest"] or ["--tag=myapp:latest"]
+	args []string
+}
+
+// buildCommandPrefixLen returns how many arguments "docker build" or "docker buildx build" (or their aliases) are
+func buildCommandPrefixLen(dockerBuildCmd []string) int {
+	if _, ok := buildCommandAlias(dockerBuildCmd); ok {
+		return 3
+	}
+	if len(dockerBuildCmd) > 1 && dockerBuildCmd[1] == "buildx" {
+		return 3
+	}
+	return 2
+}
+
+// splitBuildArgs splits the arguments that follow "docker build"/"docker buildx build" into flags and positional arguments
+// (the context), the way the docker cli does: any flag not in buildBooleanFlags takes the next argument as its value,
+// unless the value is given as --flag=value (or -fvalue/-f=value for shorthands)
+func splitBuildArgs(args []string) (flags []buildFlag, positional []string) {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+
+		if arg == "--" {
+			positional = append(positional, args[i+1:]...)
+			break
+		}
+
+		// "-" on its own is the context read from stdin
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			positional = append(positional, arg)
+			continue
+		}
+
+		start := i
+		name, value, hasValue := strings.Cut(arg, "=")
+		if !hasValue && !strings.HasPrefix(arg, "--") && len(arg) > 2 && !slices.Contains(buildBooleanFlags, arg[:2]) {
+			// shorthand with its value attached, e.g. -tmyapp:latest
+			name, value, hasValue = arg[:2], arg[2:], true
+		}
+
+		if !hasValue && !slices.Contains(buildBooleanFlags, name) && i+1 < len(args) {
+			i++
+			value, hasValue = args[i], true
+		}
+
+		flags = append(flags, buildFlag{name: name, value: value, hasValue: hasValue, args: args[start : i+1]})
+	}
+
+	return flags, positional
+}
+
+// targetStage returns the stage that a docker build command builds with --target (the last one given), if any
+func targetStage(dockerBuildCmd []string) string {
+	flags, _ := splitBuildArgs(dockerBuildCmd[min(buildCommandPrefixLen(dockerBuildCmd), len(dockerBuildCmd)):])
+	stage := ""
+	for _, flag := range flags {
+		if flag.name == "--target" && flag.hasValue {
+			stage = flag.value
+		}
+	}
+	return stage
+}
@@ -0,0 +1,121 @@
+package docker
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitBuildArgs(t *testing.T) {
+	testCases := []struct {
+		name               string
+		args               []string
+		expectedFlags      []buildFlag
+		expectedPositional []string
+	}{
+		{
+			name: "Values that look like flags",
+			args: []string{"--label", "-weird", "--build-arg", "FLAGS=--foo", "--push", "."},
+			expectedFlags: []buildFlag{
+				{name: "--label", value: "-weird", hasValue: true, args: []string{"--label", "-weird"}},
+				{name: "--build-arg", value: "FLAGS=--foo", hasValue: true, args: []string{"--build-arg", "FLAGS=--foo"}},
+				{name: "--push", args: []string{"--push"}},
+			},
+			expectedPositional: []string{"."},
+		},
+		{
+			name: "Equals and attached shorthand values",
+			args: []string{"--tag=myapp:v1", "-f=Dockerfile", "-tmyapp:v2", "-q", "./app"},
+			expectedFlags: []buildFlag{
+				{name: "--tag", value: "myapp:v1", hasValue: true, args: []string{"--tag=myapp:v1"}},
+				{name: "-f", value: "Dockerfile", hasValue: true, args: []string{"-f=Dockerfile"}},
+				{name: "-t", value: "myapp:v2", hasValue: true, args: []string{"-tmyapp:v2"}},
+				{name: "-q", args: []string{"-q"}},
+			},
+			expectedPositional: []string{"./app"},
+		},
+		{
+			name: "Unknown flags take a value",
+			args: []string{"--some-new-flag", "-x", "."},
+			expectedFlags: []buildFlag{
+				{name: "--some-new-flag", value: "-x", hasValue: true, args: []string{"--some-new-flag", "-x"}},
+			},
+			expectedPositional: []string{"."},
+		},
+		{
+			name:               "Everything after -- is positional",
+			args:               []string{"--push", "--", "--weird-context"},
+			expectedFlags:      []buildFlag{{name: "--push", args: []string{"--push"}}},
+			expectedPositional: []string{"--weird-context"},
+		},
+		{
+			name:               "Stdin context",
+			args:               []string{"-t", "myapp:v1", "-"},
+			expectedFlags:      []buildFlag{{name: "-t", value: "myapp:v1", hasValue: true, args: []string{"-t", "myapp:v1"}}},
+			expectedPositional: []string{"-"},
+		},
+		{
+			name:          "Missing value",
+			args:          []string{"--push", "-t"},
+			expectedFlags: []buildFlag{{name: "--push", args: []string{"--push"}}, {name: "-t", args: []string{"-t"}}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			flags, positional := splitBuildArgs(tc.args)
+			assert.Equal(t, tc.expectedFlags, flags)
+			assert.Equal(t, tc.expectedPositional, positional)
+		})
+	}
+}
+
+func TestBuildCommandPrefixLen(t *testing.T) {
+	assert.Equal(t, 3, buildCommandPrefixLen([]string{"docker", "buildx", "build", "."}))
+	assert.Equal(t, 2, buildCommandPrefixLen([]string{"docker", "build", "-t", "buildx", "."}))
+}
+
+// FuzzFindContextPath generates docker buildx build command lines with arbitrary flag values - dashes included - in
+// arbitrary order, and checks that the context and the tag are always found
+func FuzzFindContextPath(f *testing.F) {
+	f.Add("-weird", "FLAGS=--foo", "./app", uint8(0))
+	f.Add("--push", "-t", ".", uint8(3))
+	f.Add("a=b", "", "/tmp/context", uint8(7))
+
+	f.Fuzz(func(t *testing.T, labelValue string, buildArgValue string, context string, order uint8) {
+		if context == "" || strings.HasPrefix(context, "-") {
+			t.Skip("contexts that start with a dash must follow --")
+		}
+
+		flagGroups := [][]string{
+			{"--label", labelValue},
+			{"--build-arg=" + buildArgValue},
+			{"-t", "myregistry/app:v1"},
+			{"--push"},
+		}
+		// rotate the flags, and put the context before or after them
+		rotation := int(order) % len(flagGroups)
+		flagGroups = append(flagGroups[rotation:], flagGroups[:rotation]...)
+
+		command := []string{"docker", "buildx", "build"}
+		if order%2 == 0 {
+			command = append(command, context)
+		}
+		for _, group := range flagGroups {
+			command = append(command, group...)
+		}
+		if order%2 == 1 {
+			command = append(command, context)
+		}
+
+		contextPath, err := findContextPath(command)
+		require.NoError(t, err, "command: %q", command)
+		assert.Equal(t, context, contextPath, "command: %q", command)
+
+		tags, _, _, err := extractBuildFlags(command[1:])
+		require.NoError(t, err, "command: %q", command)
+		assert.Equal(t, []string{"myregistry/app:v1"}, tags, "command: %q", command)
+	})
+}
@@ -0,0 +1,122 @@
+package docker
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"log/slog"
+
+	"github.com/samber/lo"
+)
+
+// metadata keys that docker buildx writes to the --metadata-file
+const (
+	metadataDigestKey    = "containerimage.digest"
+	metadataImageNameKey = "image.name"
+)
+
+// BuildOutputFiles are the files that a build writes next to the image, which later steps of a pipeline may read
+type BuildOutputFiles struct {
+	IIDFile      string // --iidfile (docker build/docker buildx build only)
+	MetadataFile string // --metadata-file
+}
+
+// Empty reports whether the command asks for no output files
+func (files BuildOutputFiles) Empty() bool {
+	return files.IIDFile == "" && files.MetadataFile == ""
+}
+
+// OutputFilesFromCommand returns the --iidfile and --metadata-file paths of a docker build or bake command
+func OutputFilesFromCommand(command []string) BuildOutputFiles {
+	_, command = SplitGlobalFlags(command)
+	files := BuildOutputFiles{MetadataFile: lastFlagValue(command, "--metadata-file")}
+	if !isBakeCommand(command) {
+		files.IIDFile = lastFlagValue(command, "--iidfile")
+	}
+	return files
+}
+
+func isBakeCommand(command []string) bool {
+	command = CanonicalBuildCommand(command)
+	return len(command) > 2 && command[1] == "buildx" && command[2] == "bake"
+}
+
+// lastFlagValue returns the value of the last occurrence of the flag, given either as "--flag value" or "--flag=value"
+func lastFlagValue(command []string, flagName string) string {
+	value := ""
+	for i := 0; i < len(command); i++ {
+		if command[i] == "--" {
+			break
+		}
+		if command[i] == flagName && i+1 < len(command) {
+			i++
+			value = command[i]
+		} else if flagValue, found := strings.CutPrefix(command[i], flagName+"="); found {
+			value = flagValue
+		}
+	}
+	return value
+}
+
+// WriteCacheHitOutputs writes the --iidfile and --metadata-file of the command for a build that was served from the
+// cache, so that they exist just like after a real build: the iidfile holds the digest of the retagged image and the
+// metadata file the digest and the names of the image (per target for bake, like buildx does)
+func WriteCacheHitOutputs(command []string, cacheTagPairsByTarget map[string][]CacheTagPair) error {
+	files := OutputFilesFromCommand(command)
+	if files.Empty() {
+		return nil
+	}
+	globalFlags, command := SplitGlobalFlags(command)
+	dockerConfigDir := ConfigDirFromGlobalFlags(globalFlags)
+
+	metadataByTarget := map[string]map[string]string{}
+	for target, pairs := range cacheTagPairsByTarget {
+		if len(pairs) == 0 {
+			continue
+		}
+		// all the new tags of a target point to the same image
+		digest, err := resolveDigest(dockerConfigDir, pairs[0].NewTag)
+		if err != nil {
+			return fmt.Errorf("failed to resolve the digest of %s: %w", pairs[0].NewTag, err)
+		}
+		names := lo.Uniq(lo.Map(pairs, func(pair CacheTagPair, _ int) string { return pair.NewTag }))
+		slices.Sort(names)
+		metadataByTarget[target] = map[string]string{
+			metadataDigestKey:    digest,
+			metadataImageNameKey: strings.Join(names, ","),
+		}
+	}
+	if len(metadataByTarget) == 0 {
+		return fmt.Errorf("no retagged images to write the build outputs for")
+	}
+
+	// docker build has a single target
+	buildMetadata := lo.Values(metadataByTarget)[0]
+
+	if files.IIDFile != "" {
+		if err := os.WriteFile(files.IIDFile, []byte(buildMetadata[metadataDigestKey]), 0o644); err != nil {
+			return fmt.Errorf("failed to write the iidfile: %w", err)
+		}
+		slog.Debug("Wrote the iidfile of the cached image", "path", files.IIDFile)
+	}
+
+	if files.MetadataFile != "" {
+		var metadata any = buildMetadata
+		if isBakeCommand(command) {
+			metadata = metadataByTarget
+		}
+		content, err := json.MarshalIndent(metadata, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(files.MetadataFile, content, 0o644); err != nil {
+			return fmt.Errorf("failed to write the metadata file: %w", err)
+		}
+		slog.Debug("Wrote the metadata file of the cached image", "path", files.MetadataFile)
+	}
+
+	return nil
+}
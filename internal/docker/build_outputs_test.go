@@ -0,0 +1,106 @@
+package docker
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutputFilesFromCommand(t *testing.T) {
+	assert.Equal(t, BuildOutputFiles{IIDFile: "iid.txt", MetadataFile: "meta.json"},
+		OutputFilesFromCommand([]string{"docker", "buildx", "build", "--iidfile", "iid.txt", "--metadata-file=meta.json", "--push", "."}))
+	assert.Equal(t, BuildOutputFiles{IIDFile: "iid.txt"},
+		OutputFilesFromCommand([]string{"docker", "--context", "remote", "build", "--iidfile=iid.txt", "."}))
+	// bake has no --iidfile
+	assert.Equal(t, BuildOutputFiles{MetadataFile: "meta.json"},
+		OutputFilesFromCommand([]string{"docker", "buildx", "bake", "--metadata-file", "meta.json", "--push"}))
+	assert.True(t, OutputFilesFromCommand([]string{"docker", "buildx", "build", "--push", "."}).Empty())
+}
+
+func TestWriteCacheHitOutputs_Build(t *testing.T) {
+	registryHost := startInMemoryRegistry(t)
+	ForgetRegistryState()
+	t.Cleanup(ForgetRegistryState)
+
+	image, err := random.Image(64, 1)
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(parseTestReference(t, registryHost+"/app:v1"), image))
+	digest, err := image.Digest()
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	iidFile := filepath.Join(dir, "iid.txt")
+	metadataFile := filepath.Join(dir, "meta.json")
+	command := []string{"docker", "buildx", "build", "--push", "--iidfile", iidFile, "--metadata-file", metadataFile, "."}
+	pairs := map[string][]CacheTagPair{"default": {
+		{CacheTag: registryHost + "/app:" + CacheTagPrefix + "abc", NewTag: registryHost + "/app:v1"},
+		{CacheTag: registryHost + "/app:" + CacheTagPrefix + "abc", NewTag: registryHost + "/app:latest"},
+	}}
+
+	require.NoError(t, WriteCacheHitOutputs(command, pairs))
+
+	iid, err := os.ReadFile(iidFile)
+	require.NoError(t, err)
+	assert.Equal(t, digest.String(), string(iid))
+
+	var metadata map[string]string
+	content, err := os.ReadFile(metadataFile)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(content, &metadata))
+	assert.Equal(t, map[string]string{
+		metadataDigestKey:    digest.String(),
+		metadataImageNameKey: registryHost + "/app:latest," + registryHost + "/app:v1",
+	}, metadata)
+}
+
+func TestWriteCacheHitOutputs_BakeMetadataPerTarget(t *testing.T) {
+	registryHost := startInMemoryRegistry(t)
+	ForgetRegistryState()
+	t.Cleanup(ForgetRegistryState)
+
+	digests := map[string]string{}
+	for _, repository := range []string{"api", "web"} {
+		image, err := random.Image(64, 1)
+		require.NoError(t, err)
+		require.NoError(t, remote.Write(parseTestReference(t, registryHost+"/"+repository+":v1"), image))
+		digest, err := image.Digest()
+		require.NoError(t, err)
+		digests[repository] = digest.String()
+	}
+
+	metadataFile := filepath.Join(t.TempDir(), "meta.json")
+	command := []string{"docker", "buildx", "bake", "--push", "--metadata-file=" + metadataFile}
+	pairs := map[string][]CacheTagPair{
+		"api": {{CacheTag: registryHost + "/api:" + CacheTagPrefix + "abc", NewTag: registryHost + "/api:v1"}},
+		"web": {{CacheTag: registryHost + "/web:" + CacheTagPrefix + "abc", NewTag: registryHost + "/web:v1"}},
+	}
+
+	require.NoError(t, WriteCacheHitOutputs(command, pairs))
+
+	var metadata map[string]map[string]string
+	content, err := os.ReadFile(metadataFile)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(content, &metadata))
+	assert.Equal(t, digests["api"], metadata["api"][metadataDigestKey])
+	assert.Equal(t, registryHost+"/web:v1", metadata["web"][metadataImageNameKey])
+	assert.Equal(t, digests["web"], metadata["web"][metadataDigestKey])
+}
+
+func TestWriteCacheHitOutputs_MissingImage(t *testing.T) {
+	registryHost := startInMemoryRegistry(t)
+	ForgetRegistryState()
+	t.Cleanup(ForgetRegistryState)
+
+	iidFile := filepath.Join(t.TempDir(), "iid.txt")
+	command := []string{"docker", "build", "--push", "--iidfile", iidFile, "."}
+	pairs := map[string][]CacheTagPair{"default": {{CacheTag: registryHost + "/app:" + CacheTagPrefix + "abc", NewTag: registryHost + "/app:v1"}}}
+
+	assert.Error(t, WriteCacheHitOutputs(command, pairs))
+	assert.NoFileExists(t, iidFile)
+}
@@ -0,0 +1,107 @@
+package docker
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+
+	"log/slog"
+
+	"github.com/samber/lo"
+)
+
+// BuilderInfo holds the parts of a buildx builder that can influence the produced artifacts
+type BuilderInfo struct {
+	Driver           string
+	BuildkitVersions []string
+	Platforms        []string
+}
+
+// Summary returns a normalized, order-independent representation of the builder, suitable for hashing
+func (b BuilderInfo) Summary() string {
+	return fmt.Sprintf("driver=%s;buildkit=%s;platforms=%s",
+		b.Driver,
+		strings.Join(b.BuildkitVersions, ","),
+		strings.Join(b.Platforms, ","),
+	)
+}
+
+// BuilderNameFromCommand returns the builder that the docker command is going to use.
+// An empty string means the currently selected builder.
+func BuilderNameFromCommand(command []string) string {
+	for i := 0; i < len(command); i++ {
+		if command[i] == "--builder" && i+1 < len(command) {
+			return command[i+1]
+		}
+		if strings.HasPrefix(command[i], "--builder=") {
+			return strings.TrimPrefix(command[i], "--builder=")
+		}
+	}
+
+	return os.Getenv("BUILDX_BUILDER")
+}
+
+// parseBuilderInspectOutput parses the output of "docker buildx inspect"
+func parseBuilderInspectOutput(output string) BuilderInfo {
+	info := BuilderInfo{}
+
+	for _, line := range strings.Split(output, "\n") {
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "Driver":
+			info.Driver = strings.ToLower(value)
+		case "BuildKit version", "Buildkit", "BuildKit":
+			if value != "" {
+				info.BuildkitVersions = append(info.BuildkitVersions, value)
+			}
+		case "Platforms":
+			for _, platform := range strings.Split(value, ",") {
+				// buildx marks the platforms that were explicitly configured with a trailing "*"
+				platform = strings.TrimSuffix(strings.TrimSpace(platform), "*")
+				if platform != "" {
+					info.Platforms = append(info.Platforms, platform)
+				}
+			}
+		}
+	}
+
+	// a builder can have multiple nodes - we only care about the set of versions and platforms
+	info.BuildkitVersions = lo.Uniq(info.BuildkitVersions)
+	slices.Sort(info.BuildkitVersions)
+	info.Platforms = lo.Uniq(info.Platforms)
+	slices.Sort(info.Platforms)
+
+	return info
+}
+
+// InspectBuilder queries "docker buildx inspect" for the given builder (empty for the current one), using the
+// same docker global flags (e.g. --context) as the wrapped command
+func InspectBuilder(globalFlags []string, builderName string) (BuilderInfo, error) {
+	args := append(slices.Clone(globalFlags), "buildx", "inspect")
+	if builderName != "" {
+		args = append(args, builderName)
+	}
+
+	slog.Debug("Inspecting buildx builder", "builder", builderName)
+	output, err := exec.Command("docker", args...).Output()
+	if err != nil {
+		return BuilderInfo{}, fmt.Errorf("failed to inspect buildx builder %q: %w", builderName, err)
+	}
+
+	info := parseBuilderInspectOutput(string(output))
+	if info.Driver == "" {
+		return BuilderInfo{}, fmt.Errorf("could not determine the driver of buildx builder %q", builderName)
+	}
+
+	slog.Debug("Inspected buildx builder", "builder", builderName, "summary", info.Summary())
+
+	return info, nil
+}
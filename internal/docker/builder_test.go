@@ -0,0 +1,106 @@
+package docker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseBuilderInspectOutput(t *testing.T) {
+	testCases := []struct {
+		name     string
+		output   string
+		expected BuilderInfo
+	}{
+		{
+			name: "default docker driver",
+			output: `Name:          default
+Driver:        docker
+Last Activity: 2025-01-01 10:00:00 +0000 UTC
+
+Nodes:
+Name:             default
+Endpoint:         default
+Status:           running
+BuildKit version: v0.12.5
+Platforms:        linux/amd64, linux/amd64/v2, linux/386
+`,
+			expected: BuilderInfo{
+				Driver:           "docker",
+				BuildkitVersions: []string{"v0.12.5"},
+				Platforms:        []string{"linux/386", "linux/amd64", "linux/amd64/v2"},
+			},
+		},
+		{
+			name: "docker-container driver with multiple nodes",
+			output: `Name:          multi
+Driver:        docker-container
+
+Nodes:
+Name:                  multi0
+Endpoint:              unix:///var/run/docker.sock
+Status:                running
+BuildKit daemon flags: --allow-insecure-entitlement=network.host
+BuildKit version:      v0.13.0
+Platforms:             linux/arm64*, linux/amd64
+
+Name:                  multi1
+Endpoint:              ssh://remote
+Status:                running
+BuildKit version:      v0.12.5
+Platforms:             linux/amd64
+`,
+			expected: BuilderInfo{
+				Driver:           "docker-container",
+				BuildkitVersions: []string{"v0.12.5", "v0.13.0"},
+				Platforms:        []string{"linux/amd64", "linux/arm64"},
+			},
+		},
+		{
+			name: "older buildx output",
+			output: `Name:   old
+Driver: docker-container
+Nodes:
+Name:      old0
+Buildkit:  v0.11.6
+Platforms: linux/amd64
+`,
+			expected: BuilderInfo{
+				Driver:           "docker-container",
+				BuildkitVersions: []string{"v0.11.6"},
+				Platforms:        []string{"linux/amd64"},
+			},
+		},
+		{
+			name:     "empty output",
+			output:   "",
+			expected: BuilderInfo{BuildkitVersions: []string{}, Platforms: []string{}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, parseBuilderInspectOutput(tc.output))
+		})
+	}
+}
+
+func TestBuilderInfoSummary_OrderIndependent(t *testing.T) {
+	first := parseBuilderInspectOutput("Driver: docker-container\nBuildKit version: v0.13.0\nPlatforms: linux/arm64, linux/amd64\n")
+	second := parseBuilderInspectOutput("Driver: Docker-Container\nBuildKit version: v0.13.0\nPlatforms: linux/amd64, linux/arm64\n")
+
+	assert.Equal(t, first.Summary(), second.Summary())
+	assert.Equal(t, "driver=docker-container;buildkit=v0.13.0;platforms=linux/amd64,linux/arm64", first.Summary())
+}
+
+func TestBuilderNameFromCommand(t *testing.T) {
+	t.Setenv("BUILDX_BUILDER", "")
+
+	assert.Equal(t, "mybuilder", BuilderNameFromCommand([]string{"docker", "buildx", "build", "--builder", "mybuilder", "."}))
+	assert.Equal(t, "mybuilder", BuilderNameFromCommand([]string{"docker", "buildx", "build", "--builder=mybuilder", "."}))
+	assert.Equal(t, "", BuilderNameFromCommand([]string{"docker", "buildx", "build", "."}))
+
+	t.Setenv("BUILDX_BUILDER", "from-env")
+	assert.Equal(t, "from-env", BuilderNameFromCommand([]string{"docker", "buildx", "build", "."}))
+	assert.Equal(t, "mybuilder", BuilderNameFromCommand([]string{"docker", "buildx", "build", "--builder", "mybuilder", "."}))
+}
@@ -0,0 +1,60 @@
+package docker
+
+import (
+	"log/slog"
+
+	"github.com/docker/buildx/util/buildflags"
+	"github.com/samber/lo"
+)
+
+// buildkitCacheFlags returns the values of the --cache-from and --cache-to flags of a build command, and whether caching
+// is turned off with --no-cache
+func buildkitCacheFlags(dockerBuildCmd []string) (cacheFrom []string, cacheTo []string, noCache bool) {
+	flags, _ := splitBuildArgs(dockerBuildCmd[min(buildCommandPrefixLen(dockerBuildCmd), len(dockerBuildCmd)):])
+	for _, flag := range flags {
+		switch flag.name {
+		case "--cache-from":
+			cacheFrom = append(cacheFrom, flag.value)
+		case "--cache-to":
+			cacheTo = append(cacheTo, flag.value)
+		case "--no-cache":
+			noCache = true
+		}
+	}
+	return cacheFrom, cacheTo, noCache
+}
+
+// cacheEntryNames parses cache flag values into their short form, e.g. "registry:myreg/app:cache" or "gha"
+func cacheEntryNames(values []string) []string {
+	entries, err := buildflags.ParseCacheEntry(values)
+	if err != nil {
+		// buildx will report the invalid cache entry itself
+		slog.Debug("Failed to parse cache entries", "error", err)
+		return values
+	}
+	return lo.Map(entries, func(entry *buildflags.CacheOptionsEntry, _ int) string {
+		if ref, ok := entry.Attrs["ref"]; ok {
+			return entry.Type + ":" + ref
+		}
+		return entry.Type
+	})
+}
+
+// reportBuildkitCaches explains how BuildKit's own layer cache (--cache-from/--cache-to) relates to mimosa's cache:
+// a mimosa hit retags without running the build at all, so the layer cache only ever speeds up mimosa's misses
+func reportBuildkitCaches(dockerBuildCmd []string) {
+	cacheFrom, cacheTo, noCache := buildkitCacheFlags(dockerBuildCmd)
+	if len(cacheFrom) == 0 && len(cacheTo) == 0 {
+		return
+	}
+
+	slog.Info("BuildKit layer caching is active: it is only used on mimosa cache misses, hits retag without building",
+		"cache-from", cacheEntryNames(cacheFrom), "cache-to", cacheEntryNames(cacheTo))
+
+	if len(cacheFrom) > 0 {
+		slog.Debug("--cache-from values are part of the hash - a cache ref that changes between runs (e.g. per branch) causes mimosa cache misses")
+	}
+	if noCache && len(cacheFrom) > 0 {
+		slog.Warn("--no-cache makes BuildKit ignore --cache-from, cache misses are built from scratch")
+	}
+}
@@ -0,0 +1,37 @@
+package docker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildkitCacheFlags(t *testing.T) {
+	cacheFrom, cacheTo, noCache := buildkitCacheFlags([]string{"docker", "buildx", "build", "--cache-from", "type=registry,ref=myreg/app:cache",
+		"--cache-from=myreg/app:main", "--cache-to", "type=gha,mode=max", "--no-cache", "-t", "myreg/app:v1", "."})
+
+	assert.Equal(t, []string{"type=registry,ref=myreg/app:cache", "myreg/app:main"}, cacheFrom)
+	assert.Equal(t, []string{"type=gha,mode=max"}, cacheTo)
+	assert.True(t, noCache)
+
+	cacheFrom, cacheTo, noCache = buildkitCacheFlags([]string{"docker", "build", "--label", "--cache-from", "."})
+	assert.Empty(t, cacheFrom, "flag values are not flags")
+	assert.Empty(t, cacheTo)
+	assert.False(t, noCache)
+}
+
+func TestCacheEntryNames(t *testing.T) {
+	assert.Equal(t, []string{"registry:myreg/app:cache", "registry:myreg/app:main", "gha"},
+		cacheEntryNames([]string{"type=registry,ref=myreg/app:cache", "myreg/app:main", "type=gha,mode=max"}))
+	assert.Equal(t, []string{"type=\"broken"}, cacheEntryNames([]string{"type=\"broken"}), "invalid entries are kept as is")
+}
+
+func TestReportBuildkitCaches(t *testing.T) {
+	logs := captureWarnings(t)
+	reportBuildkitCaches([]string{"docker", "buildx", "build", "--cache-from", "myreg/app:cache", "--no-cache", "."})
+	assert.Contains(t, logs.String(), "--no-cache makes BuildKit ignore --cache-from")
+
+	logs.Reset()
+	reportBuildkitCaches([]string{"docker", "buildx", "build", "--cache-from", "myreg/app:cache", "."})
+	assert.Empty(t, logs.String())
+}
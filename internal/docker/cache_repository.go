@@ -0,0 +1,92 @@
+package docker
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+// the longest cache tag prefix - tags are limited to 128 characters, which the prefix shares with the hash and the scope
+const maxCacheTagPrefixLength = 32
+
+var (
+	cacheTagPrefix = CacheTagPrefix
+	// the repository that all the cache tags are saved in, "" saves them next to the images
+	cacheRepository = ""
+	// a tag prefix: starts like a tag does and only has the characters of a tag
+	validCacheTagPrefix = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]*$`)
+)
+
+// SetCacheTagPrefix sets the prefix of the cache tags, which the hash follows - "" restores the default prefix
+func SetCacheTagPrefix(prefix string) error {
+	if prefix == "" {
+		cacheTagPrefix = CacheTagPrefix
+		return nil
+	}
+	if len(prefix) > maxCacheTagPrefixLength || !validCacheTagPrefix.MatchString(prefix) {
+		return fmt.Errorf("invalid cache tag prefix %q: up to %d letters, digits, '_', '.' and '-', not starting with '.' or '-'", prefix, maxCacheTagPrefixLength)
+	}
+	cacheTagPrefix = prefix
+	return nil
+}
+
+// CurrentCacheTagPrefix returns the prefix of the cache tags
+func CurrentCacheTagPrefix() string {
+	return cacheTagPrefix
+}
+
+// SetCacheRepository makes the cache tags of all the images be saved in a dedicated repository (e.g. org/mimosa-cache,
+// in the registry of each image, or ghcr.io/org/mimosa-cache) instead of next to the images - "" saves them next to
+// the images
+func SetCacheRepository(repository string) error {
+	if repository == "" {
+		cacheRepository = ""
+		return nil
+	}
+	if _, err := name.NewRepository(repository); err != nil {
+		return fmt.Errorf("invalid cache repository %q: %w", repository, err)
+	}
+	cacheRepository = repository
+	return nil
+}
+
+// hasRegistry reports whether the first component of the repository is a registry host, like docker decides it
+func hasRegistry(repository string) bool {
+	first, _, found := strings.Cut(repository, "/")
+	return found && (strings.ContainsAny(first, ".:") || first == "localhost")
+}
+
+// CacheRepositoryFor returns the registry and the repository that the cache tags of an image are saved in, and whether
+// that is the dedicated cache repository
+func CacheRepositoryFor(registry string, imageName string) (string, string, bool) {
+	if cacheRepository == "" {
+		return registry, imageName, false
+	}
+
+	repository := cacheRepository
+	if !hasRegistry(repository) {
+		repository = registry + "/" + repository
+	}
+	parsed, err := name.NewRepository(repository)
+	if err != nil {
+		return registry, imageName, false
+	}
+	return parsed.Registry.Name(), parsed.RepositoryStr(), true
+}
+
+// CacheRepositoryKey returns the part of a cache tag in the dedicated cache repository that tells apart the images that
+// share it: the same hash of a bake command is saved once per target repository
+func CacheRepositoryKey(registry string, imageName string) string {
+	sum := sha256.Sum256([]byte(registry + "/" + imageName))
+	return hex.EncodeToString(sum[:])[:8]
+}
+
+// isCacheRepository reports whether the repository is the dedicated cache repository, from any image's point of view
+func isCacheRepository(registry string, imageName string) bool {
+	cacheRegistry, cacheImageName, dedicated := CacheRepositoryFor(registry, imageName)
+	return dedicated && cacheRegistry == registry && cacheImageName == imageName
+}
@@ -0,0 +1,36 @@
+package docker
+
+import (
+	"context"
+	"log/slog"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+)
+
+// daemonProbeTimeout bounds the probe of the daemon, so that an unreachable DOCKER_HOST does not hang the build
+const daemonProbeTimeout = 10 * time.Second
+
+// DaemonAvailable reports whether the docker CLI is installed and the daemon of the global flags answers. mimosa itself
+// only talks to the registries, the daemon is needed only for the images of local-only builds - without it (e.g. in a
+// distroless image, or a CI step with a remote buildx builder and no dind) mimosa runs registry-only
+func DaemonAvailable(globalFlags []string) bool {
+	if _, err := exec.LookPath("docker"); err != nil {
+		slog.Debug("No docker CLI found, running registry-only", "error", err)
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), daemonProbeTimeout)
+	defer cancel()
+
+	args := append(slices.Clone(globalFlags), "version", "--format", "{{.Server.Version}}")
+	output, err := exec.CommandContext(ctx, "docker", args...).Output()
+	if err != nil || strings.TrimSpace(string(output)) == "" {
+		slog.Debug("No docker daemon answers, running registry-only", "error", err)
+		return false
+	}
+
+	slog.Debug("Found docker daemon", "version", strings.TrimSpace(string(output)))
+	return true
+}
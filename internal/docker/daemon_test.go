@@ -0,0 +1,33 @@
+package docker
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDaemonAvailable_NoDockerCLI(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+
+	assert.False(t, DaemonAvailable(nil))
+}
+
+func TestDaemonAvailable_DaemonDoesNotAnswer(t *testing.T) {
+	binDir := t.TempDir()
+	// a docker CLI whose daemon is gone prints the client version only and fails
+	require.NoError(t, os.WriteFile(filepath.Join(binDir, "docker"), []byte("#!/bin/sh\nexit 1\n"), 0o755))
+	t.Setenv("PATH", binDir)
+
+	assert.False(t, DaemonAvailable(nil))
+}
+
+func TestDaemonAvailable_DaemonAnswers(t *testing.T) {
+	binDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(binDir, "docker"), []byte("#!/bin/sh\necho 27.3.1\n"), 0o755))
+	t.Setenv("PATH", binDir)
+
+	assert.True(t, DaemonAvailable([]string{"--context", "colima"}))
+}
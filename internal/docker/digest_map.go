@@ -0,0 +1,32 @@
+package docker
+
+import (
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// TagDigests resolves each tag to the digest it points to right now in its registry, e.g. after it was pushed or
+// retagged - unlike the digests of the images a build depends on, these are never taken from what was resolved earlier
+// in the run
+func TagDigests(dockerConfigDir string, tags []string) (map[string]string, error) {
+	digests := map[string]string{}
+	for _, tag := range tags {
+		if _, ok := digests[tag]; ok {
+			continue
+		}
+		ref, err := name.ParseReference(tag)
+		if err != nil {
+			return nil, err
+		}
+		ref, registryOptions, err := withRegistryOptions(dockerConfigDir, ref)
+		if err != nil {
+			return nil, err
+		}
+		descriptor, err := remote.Head(ref, registryOptions...)
+		if err != nil {
+			return nil, err
+		}
+		digests[tag] = descriptor.Digest.String()
+	}
+	return digests, nil
+}
@@ -0,0 +1,27 @@
+package docker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTagDigests(t *testing.T) {
+	registryHost := startInMemoryRegistry(t)
+	first := pushFrontend(t, registryHost+"/app:v1")
+	second := pushFrontend(t, registryHost+"/app:v2")
+
+	digests, err := TagDigests("", []string{registryHost + "/app:v1", registryHost + "/app:v2", registryHost + "/app:v1"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{registryHost + "/app:v1": first, registryHost + "/app:v2": second}, digests)
+
+	// tags that moved are resolved again
+	moved := pushFrontend(t, registryHost+"/app:v1")
+	digests, err = TagDigests("", []string{registryHost + "/app:v1"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{registryHost + "/app:v1": moved}, digests)
+
+	_, err = TagDigests("", []string{registryHost + "/app:missing"})
+	assert.Error(t, err)
+}
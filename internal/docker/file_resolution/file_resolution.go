@@ -3,6 +3,7 @@ package fileresolution
 import (
 	"os"
 	"path/filepath"
+	"strings"
 
 	"log/slog"
 )
@@ -25,6 +26,38 @@ func ResolveAbsoluteDockerfilePath(cwd, absOrRelativeDockerfilePath string) stri
 	return filepath.Join(cwd, "Dockerfile")
 }
 
+const bakeCwdPrefix = "cwd://"
+
+// ResolveBakeContextPath resolves the context of a bake target the same way buildx does:
+// relative contexts are relative to the current working directory, with an optional "cwd://" prefix
+func ResolveBakeContextPath(cwd, contextPath string) string {
+	contextPath = strings.TrimPrefix(contextPath, bakeCwdPrefix)
+	if contextPath == "" {
+		contextPath = "."
+	}
+
+	if filepath.IsAbs(contextPath) {
+		return filepath.Clean(contextPath)
+	}
+
+	return filepath.Join(cwd, contextPath)
+}
+
+// ResolveAbsoluteBakeDockerfilePath resolves the dockerfile of a bake target the same way buildx does:
+// relative dockerfiles are relative to the (already resolved) target context, unless they are prefixed with "cwd://",
+// in which case they are relative to the current working directory
+func ResolveAbsoluteBakeDockerfilePath(cwd, absoluteContextPath, dockerfilePath string) string {
+	if dockerfilePath == "" {
+		dockerfilePath = "Dockerfile"
+	}
+
+	if cwdRelativePath, ok := strings.CutPrefix(dockerfilePath, bakeCwdPrefix); ok {
+		return ResolveAbsoluteDockerfilePath(cwd, cwdRelativePath)
+	}
+
+	return ResolveAbsoluteDockerfilePath(absoluteContextPath, dockerfilePath)
+}
+
 func ResolveAbsoluteDockerIgnorePath(contextPathAbs, dockerfilePathAbs string) string {
 	dockerfileDir := filepath.Dir(dockerfilePathAbs)
 	dockerfileBase := filepath.Base(dockerfilePathAbs)
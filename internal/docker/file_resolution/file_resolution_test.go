@@ -155,3 +155,56 @@ func TestResolveDockerignorePath(t *testing.T) {
 		})
 	}
 }
+
+func TestResolveBakeContextPath(t *testing.T) {
+	cwd := t.TempDir()
+
+	assert.Equal(t, cwd, ResolveBakeContextPath(cwd, "."))
+	assert.Equal(t, cwd, ResolveBakeContextPath(cwd, ""))
+	assert.Equal(t, filepath.Join(cwd, "app"), ResolveBakeContextPath(cwd, "./app"))
+	assert.Equal(t, filepath.Join(cwd, "app"), ResolveBakeContextPath(cwd, "cwd://app"))
+	assert.Equal(t, "/absolute/context", ResolveBakeContextPath(cwd, "/absolute/context/"))
+}
+
+func TestResolveAbsoluteBakeDockerfilePath(t *testing.T) {
+	cwd := t.TempDir()
+	contextDir := filepath.Join(cwd, "services", "api")
+
+	testCases := []struct {
+		name           string
+		dockerfilePath string
+		expected       string
+	}{
+		{
+			name:           "Default dockerfile is relative to the context",
+			dockerfilePath: "",
+			expected:       filepath.Join(contextDir, "Dockerfile"),
+		},
+		{
+			name:           "Relative dockerfile is relative to the context",
+			dockerfilePath: "docker/Dockerfile.prod",
+			expected:       filepath.Join(contextDir, "docker", "Dockerfile.prod"),
+		},
+		{
+			name:           "Dockerfile outside of the context",
+			dockerfilePath: "../shared/Dockerfile",
+			expected:       filepath.Join(cwd, "services", "shared", "Dockerfile"),
+		},
+		{
+			name:           "Dockerfile relative to the working directory",
+			dockerfilePath: "cwd://shared/Dockerfile",
+			expected:       filepath.Join(cwd, "shared", "Dockerfile"),
+		},
+		{
+			name:           "Absolute dockerfile",
+			dockerfilePath: "/absolute/path/Dockerfile",
+			expected:       "/absolute/path/Dockerfile",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, ResolveAbsoluteBakeDockerfilePath(cwd, contextDir, tc.dockerfilePath))
+		})
+	}
+}
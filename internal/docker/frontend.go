@@ -0,0 +1,72 @@
+package docker
+
+import (
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/moby/buildkit/frontend/dockerfile/parser"
+)
+
+// buildkitSyntaxArg is the build arg that overrides the "# syntax=" directive of the Dockerfile
+const buildkitSyntaxArg = "BUILDKIT_SYNTAX"
+
+// dockerfileFrontend returns the frontend image that builds the Dockerfile: BUILDKIT_SYNTAX if set, otherwise the
+// "# syntax=" directive - "" when the builder's built-in frontend is used
+func dockerfileFrontend(dockerfile []byte, buildArgs map[string]string) string {
+	if frontend := buildArgs[buildkitSyntaxArg]; frontend != "" {
+		return frontend
+	}
+	frontend, _, _, _ := parser.DetectSyntax(dockerfile)
+	return frontend
+}
+
+// frontendDigests returns the digest of the frontend of the Dockerfile, if it uses one: the Dockerfile only pins the
+// frontend's tag (e.g. docker/dockerfile:1 or :labs), and a new frontend version can build the same Dockerfile
+// differently. When the frontend cannot be resolved only its name, already part of the Dockerfile, is hashed
+func frontendDigests(dockerConfigDir string, dockerfile []byte, buildArgs map[string]string) []string {
+	frontend := dockerfileFrontend(dockerfile, buildArgs)
+	if frontend == "" {
+		return nil
+	}
+
+	digest, err := resolveDigest(dockerConfigDir, frontend)
+	if err != nil {
+		slog.Warn("Failed to resolve the Dockerfile frontend, its digest is not part of the hash", "frontend", frontend, "error", err)
+		return nil
+	}
+	slog.Debug("Including the Dockerfile frontend in the hash", "frontend", frontend, "digest", digest)
+	return []string{digest}
+}
+
+// readDockerfile returns the contents of the Dockerfile of a build, or nil if it cannot be read (e.g. it is missing -
+// the build will report it)
+func readDockerfile(path string) []byte {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		slog.Debug("Failed to read the Dockerfile", "path", path, "error", err)
+		return nil
+	}
+	return content
+}
+
+// buildArgs returns the --build-arg values of a build command - args without a value take it from the environment,
+// like the docker cli does
+func buildArgs(dockerBuildCmd []string) map[string]string {
+	args := map[string]string{}
+	flags, _ := splitBuildArgs(dockerBuildCmd[min(buildCommandPrefixLen(dockerBuildCmd), len(dockerBuildCmd)):])
+	for _, flag := range flags {
+		if flag.name != "--build-arg" {
+			continue
+		}
+		key, value, hasValue := strings.Cut(flag.value, "=")
+		if !hasValue {
+			var ok bool
+			if value, ok = os.LookupEnv(key); !ok {
+				continue
+			}
+		}
+		args[key] = value
+	}
+	return args
+}
@@ -0,0 +1,141 @@
+package docker
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker/buildx/bake"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/hytromo/mimosa/internal/hasher"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pushFrontend pushes a new random image under the reference and returns its digest
+func pushFrontend(t *testing.T, reference string) string {
+	t.Helper()
+	image, err := random.Image(64, 1)
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(parseTestReference(t, reference), image))
+	digest, err := image.Digest()
+	require.NoError(t, err)
+	return digest.String()
+}
+
+// forgetResolvedDigests makes the digests be resolved again, as in a new run
+func forgetResolvedDigests(t *testing.T) {
+	t.Helper()
+	resolvedDigests.mu.Lock()
+	resolvedDigests.digests = map[string]string{}
+	resolvedDigests.mu.Unlock()
+}
+
+func TestDockerfileFrontend(t *testing.T) {
+	dockerfile := []byte("# syntax=docker/dockerfile:1.7\nFROM alpine\n")
+
+	assert.Equal(t, "docker/dockerfile:1.7", dockerfileFrontend(dockerfile, nil))
+	assert.Equal(t, "docker/dockerfile:labs", dockerfileFrontend(dockerfile, map[string]string{buildkitSyntaxArg: "docker/dockerfile:labs"}))
+	assert.Empty(t, dockerfileFrontend([]byte("FROM alpine\n# syntax=docker/dockerfile:1.7\n"), nil), "directives come first")
+	assert.Empty(t, dockerfileFrontend(nil, nil))
+}
+
+func TestBuildArgs(t *testing.T) {
+	t.Setenv("FROM_ENV", "env-value")
+	command := []string{"docker", "buildx", "build", "--build-arg", "A=1", "--build-arg=B=x=y", "--build-arg", "FROM_ENV", "--build-arg", "UNSET_ARG_FOR_TEST", "."}
+
+	assert.Equal(t, map[string]string{"A": "1", "B": "x=y", "FROM_ENV": "env-value"}, buildArgs(command))
+}
+
+func TestResolveDigest(t *testing.T) {
+	forgetResolvedDigests(t)
+	registryHost := startInMemoryRegistry(t)
+	digest := pushFrontend(t, registryHost+"/dockerfile:1")
+
+	resolved, err := resolveDigest("", registryHost+"/dockerfile:1")
+	require.NoError(t, err)
+	assert.Equal(t, digest, resolved)
+
+	pinned := "docker/dockerfile@sha256:" + "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	resolved, err = resolveDigest("", pinned)
+	require.NoError(t, err, "pinned references are not resolved through the registry")
+	assert.Equal(t, "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef", resolved)
+
+	_, err = resolveDigest("", registryHost+"/dockerfile:missing")
+	assert.Error(t, err)
+}
+
+func TestWithImageDigests(t *testing.T) {
+	assert.Equal(t, "hash", withImageDigests("hash", nil))
+	assert.NotEqual(t, "hash", withImageDigests("hash", []string{"sha256:a"}))
+	assert.Equal(t, withImageDigests("hash", []string{"sha256:a", "sha256:b"}), withImageDigests("hash", []string{"sha256:b", "sha256:a"}))
+}
+
+func TestParseBuildCommand_FrontendUpgradeChangesTheHash(t *testing.T) {
+	forgetResolvedDigests(t)
+	registryHost := startInMemoryRegistry(t)
+	pushFrontend(t, registryHost+"/dockerfile:1")
+
+	t.Chdir(t.TempDir())
+	require.NoError(t, os.WriteFile("Dockerfile", []byte("# syntax="+registryHost+"/dockerfile:1\nFROM alpine\n"), 0o644))
+	command := []string{"docker", "build", "--push", "-t", "myreg/app:v1", "."}
+
+	before, err := ParseBuildCommand(command, hasher.Options{}, "")
+	require.NoError(t, err)
+
+	forgetResolvedDigests(t)
+	again, err := ParseBuildCommand(command, hasher.Options{}, "")
+	require.NoError(t, err)
+	assert.Equal(t, before.Hash, again.Hash)
+
+	// a new release of the frontend under the same tag
+	pushFrontend(t, registryHost+"/dockerfile:1")
+	forgetResolvedDigests(t)
+	after, err := ParseBuildCommand(command, hasher.Options{}, "")
+	require.NoError(t, err)
+	assert.NotEqual(t, before.Hash, after.Hash)
+}
+
+func TestBakeImageDigests(t *testing.T) {
+	forgetResolvedDigests(t)
+	registryHost := startInMemoryRegistry(t)
+	digest := pushFrontend(t, registryHost+"/dockerfile:1")
+
+	t.Chdir(t.TempDir())
+	require.NoError(t, os.WriteFile("Dockerfile", []byte("FROM alpine\n"), 0o644))
+	inline := "# syntax=" + registryHost + "/dockerfile:1\nFROM alpine\n"
+	context, dockerfile := ".", "Dockerfile"
+	syntax := registryHost + "/dockerfile:1"
+
+	targets := map[string]*bake.Target{
+		"inline":    {DockerfileInline: &inline},
+		"file":      {Context: &context, Dockerfile: &dockerfile},
+		"build-arg": {Context: &context, Dockerfile: &dockerfile, Args: map[string]*string{buildkitSyntaxArg: &syntax}},
+	}
+
+	digests, err := bakeImageDigests("", targets, hasher.Options{}, false, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{digest, digest}, digests)
+}
+
+func TestBakeImageDigests_RemoteDefinition(t *testing.T) {
+	forgetResolvedDigests(t)
+	registryHost := startInMemoryRegistry(t)
+	digest := pushFrontend(t, registryHost+"/dockerfile:1")
+
+	definitionDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(definitionDir, "Dockerfile"), []byte("# syntax="+registryHost+"/dockerfile:1\nFROM alpine\n"), 0o644))
+	t.Chdir(t.TempDir())
+	require.NoError(t, os.WriteFile("Dockerfile", []byte("FROM alpine\n"), 0o644))
+	context, localContext, dockerfile := ".", "cwd://.", "Dockerfile"
+
+	targets := map[string]*bake.Target{
+		"remote": {Context: &context, Dockerfile: &dockerfile},
+		"local":  {Context: &localContext, Dockerfile: &dockerfile},
+	}
+
+	digests, err := bakeImageDigests("", targets, hasher.Options{}, false, definitionDir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{digest}, digests, "only the Dockerfile of the checkout has a frontend")
+}
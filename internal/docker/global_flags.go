@@ -0,0 +1,85 @@
+package docker
+
+import (
+	"slices"
+	"strings"
+)
+
+// docker's global flags that take a value, e.g. "docker --context colima buildx build ..."
+var globalFlagsWithValue = []string{
+	"--config", "-c", "--context", "-H", "--host", "-l", "--log-level", "--tlscacert", "--tlscert", "--tlskey",
+}
+
+// docker's global boolean flags
+var globalBooleanFlags = []string{
+	"-D", "--debug", "--tls", "--tlsverify",
+}
+
+// GlobalFlagsWithValue returns docker's global flags that take a value
+func GlobalFlagsWithValue() []string {
+	return slices.Clone(globalFlagsWithValue)
+}
+
+// SplitGlobalFlags separates docker's global flags (which pick the config dir, the context/daemon etc) from the rest
+// of a docker command: "docker --context colima buildx build ." returns ["--context", "colima"] and ["docker", "buildx", "build", "."]
+func SplitGlobalFlags(command []string) (globalFlags []string, commandWithoutGlobalFlags []string) {
+	if len(command) == 0 || command[0] != "docker" {
+		return nil, command
+	}
+
+	globalFlags = []string{}
+	i := 1
+	for ; i < len(command); i++ {
+		arg := command[i]
+
+		if slices.Contains(globalBooleanFlags, arg) {
+			globalFlags = append(globalFlags, arg)
+			continue
+		}
+
+		if slices.Contains(globalFlagsWithValue, arg) {
+			globalFlags = append(globalFlags, arg)
+			if i+1 < len(command) {
+				i++
+				globalFlags = append(globalFlags, command[i])
+			}
+			continue
+		}
+
+		flagName, _, hasValue := strings.Cut(arg, "=")
+		if hasValue && slices.Contains(globalFlagsWithValue, flagName) {
+			globalFlags = append(globalFlags, arg)
+			continue
+		}
+
+		// the first non-global flag argument is the docker subcommand
+		break
+	}
+
+	return globalFlags, append([]string{command[0]}, command[i:]...)
+}
+
+// globalFlagValue returns the value of the given global flag (any of its names), if set
+func globalFlagValue(globalFlags []string, names ...string) string {
+	value := ""
+	for i := 0; i < len(globalFlags); i++ {
+		flagName, flagValue, hasValue := strings.Cut(globalFlags[i], "=")
+		if !slices.Contains(names, flagName) {
+			continue
+		}
+		if hasValue {
+			value = flagValue
+		} else if i+1 < len(globalFlags) {
+			i++
+			value = globalFlags[i]
+		}
+	}
+	return value
+}
+
+// ConfigDirFromGlobalFlags returns the docker config dir that the command picks with "docker --config <dir> ...", so
+// that mimosa's own registry calls use the same credentials - empty when it does not pick one, so DOCKER_CONFIG (or
+// ~/.docker) is used, just like docker does
+func ConfigDirFromGlobalFlags(globalFlags []string) string {
+	return globalFlagValue(globalFlags, "--config")
+}
@@ -0,0 +1,93 @@
+package docker
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitGlobalFlags(t *testing.T) {
+	testCases := []struct {
+		name                string
+		command             []string
+		expectedGlobalFlags []string
+		expectedCommand     []string
+	}{
+		{
+			name:                "no global flags",
+			command:             []string{"docker", "buildx", "build", "--push", "."},
+			expectedGlobalFlags: []string{},
+			expectedCommand:     []string{"docker", "buildx", "build", "--push", "."},
+		},
+		{
+			name:                "context and config",
+			command:             []string{"docker", "--context", "colima", "--config", "/tmp/docker", "buildx", "build", "."},
+			expectedGlobalFlags: []string{"--context", "colima", "--config", "/tmp/docker"},
+			expectedCommand:     []string{"docker", "buildx", "build", "."},
+		},
+		{
+			name:                "equals syntax, short and boolean flags",
+			command:             []string{"docker", "-c", "remote", "--config=/cfg", "-D", "--tlsverify", "-H=tcp://host:2376", "build", "-D", "."},
+			expectedGlobalFlags: []string{"-c", "remote", "--config=/cfg", "-D", "--tlsverify", "-H=tcp://host:2376"},
+			expectedCommand:     []string{"docker", "build", "-D", "."},
+		},
+		{
+			name:                "not a docker command",
+			command:             []string{"podman", "--config", "/x", "build", "."},
+			expectedGlobalFlags: nil,
+			expectedCommand:     []string{"podman", "--config", "/x", "build", "."},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			globalFlags, command := SplitGlobalFlags(tc.command)
+			assert.Equal(t, tc.expectedGlobalFlags, globalFlags)
+			assert.Equal(t, tc.expectedCommand, command)
+		})
+	}
+}
+
+func TestGlobalFlagValue(t *testing.T) {
+	assert.Equal(t, "/cfg", globalFlagValue([]string{"--context", "colima", "--config", "/cfg"}, "--config"))
+	assert.Equal(t, "/cfg", globalFlagValue([]string{"--config=/cfg"}, "--config"))
+	assert.Equal(t, "colima", globalFlagValue([]string{"-c", "colima"}, "-c", "--context"))
+	assert.Equal(t, "", globalFlagValue([]string{"--context", "colima"}, "--config"))
+}
+
+func TestConfigDirFromGlobalFlags(t *testing.T) {
+	assert.Equal(t, "", ConfigDirFromGlobalFlags([]string{"--context", "colima"}))
+	assert.Equal(t, "/from-the-command", ConfigDirFromGlobalFlags([]string{"--config", "/from-the-command"}))
+	assert.Equal(t, "/from-the-command", ConfigDirFromGlobalFlags([]string{"--config=/from-the-command"}))
+}
+
+func TestKeychainForConfigDir(t *testing.T) {
+	configDir := t.TempDir()
+	auth := base64.StdEncoding.EncodeToString([]byte("mimosa:secret"))
+	require.NoError(t, os.WriteFile(filepath.Join(configDir, "config.json"), []byte(`{"auths": {"registry.internal:5000": {"auth": "`+auth+`"}}}`), 0600))
+
+	// the config dir of the command is used without touching DOCKER_CONFIG, which other commands may rely on
+	t.Setenv("DOCKER_CONFIG", t.TempDir())
+	registry, err := name.NewRegistry("registry.internal:5000")
+	require.NoError(t, err)
+	authenticator, err := keychainForConfigDir(configDir).Resolve(registry)
+	require.NoError(t, err)
+	authConfig, err := authenticator.Authorization()
+	require.NoError(t, err)
+
+	assert.Equal(t, "mimosa", authConfig.Username)
+	assert.Equal(t, "secret", authConfig.Password)
+
+	// other registries have no credentials in the config dir
+	otherRegistry, err := name.NewRegistry("other.internal:5000")
+	require.NoError(t, err)
+	authenticator, err = keychainForConfigDir(configDir).Resolve(otherRegistry)
+	require.NoError(t, err)
+	assert.Equal(t, authn.Anonymous, authenticator)
+}
@@ -0,0 +1,126 @@
+package docker
+
+import (
+	"context"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/buildx/bake"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	fileresolution "github.com/hytromo/mimosa/internal/docker/file_resolution"
+	"github.com/hytromo/mimosa/internal/hasher"
+	"github.com/samber/lo"
+)
+
+const resolveDigestTimeout = 10 * time.Second
+
+// resolvedDigests keeps the digests resolved during a run, e.g. a frontend shared by many bake targets
+var resolvedDigests = struct {
+	mu      sync.Mutex
+	digests map[string]string
+}{digests: map[string]string{}}
+
+// resolveDigest returns the digest that an image reference points to right now - references pinned to a digest are
+// returned without asking the registry
+func resolveDigest(dockerConfigDir string, image string) (string, error) {
+	ref, err := name.ParseReference(image)
+	if err != nil {
+		return "", err
+	}
+	if digest, ok := ref.(name.Digest); ok {
+		return digest.DigestStr(), nil
+	}
+
+	resolvedDigests.mu.Lock()
+	digest, ok := resolvedDigests.digests[ref.Name()]
+	resolvedDigests.mu.Unlock()
+	if ok {
+		return digest, nil
+	}
+
+	ref, registryOptions, err := withRegistryOptions(dockerConfigDir, ref)
+	if err != nil {
+		return "", err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), resolveDigestTimeout)
+	defer cancel()
+	descriptor, err := remote.Head(ref, append(registryOptions, remote.WithContext(ctx))...)
+	if err != nil {
+		return "", err
+	}
+
+	digest = descriptor.Digest.String()
+	resolvedDigests.mu.Lock()
+	resolvedDigests.digests[ref.Name()] = digest
+	resolvedDigests.mu.Unlock()
+	return digest, nil
+}
+
+// withImageDigests folds the digests of the images a build depends on into its hash - builds that depend on no
+// resolved image keep their hash as is
+func withImageDigests(hash string, digests []string) string {
+	if len(digests) == 0 {
+		return hash
+	}
+	sorted := slices.Clone(digests)
+	slices.Sort(sorted)
+	return hasher.HashStrings(append([]string{hash}, sorted...))
+}
+
+// buildImageDigests returns the digests of the images a build of the Dockerfile depends on: its frontend, and its base
+// images and docker-image:// build contexts with --hash-base-images (or when the build pulls them, with --pull-policy resolve)
+func buildImageDigests(dockerConfigDir string, dockerfile []byte, buildArgs map[string]string, buildContexts map[string]string, hashingOptions hasher.Options, pulls bool) ([]string, error) {
+	baseDigests, err := baseImageDigests(dockerConfigDir, dockerfile, buildArgs, lo.Keys(buildContexts), hashingOptions, pulls)
+	if err != nil {
+		return nil, err
+	}
+	contextDigests, err := buildContextImageDigests(dockerConfigDir, buildContexts, hashingOptions, pulls)
+	if err != nil {
+		return nil, err
+	}
+	return slices.Concat(frontendDigests(dockerConfigDir, dockerfile, buildArgs), baseDigests, contextDigests), nil
+}
+
+// bakeImageDigests returns the buildImageDigests of all the bake targets - pulls is whether the bake command itself
+// pulls for all of them (--pull), and definitionDir the checkout of a remote bake definition ("" for local ones)
+func bakeImageDigests(dockerConfigDir string, targets map[string]*bake.Target, hashingOptions hasher.Options, pulls bool, definitionDir string) ([]string, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+
+	digests := []string{}
+	for _, target := range targets {
+		var dockerfile []byte
+		switch {
+		case target.DockerfileInline != nil:
+			dockerfile = []byte(*target.DockerfileInline)
+		case target.Context != nil && target.Dockerfile != nil:
+			contextDir := cwd
+			if definitionDir != "" && !strings.HasPrefix(*target.Context, bakeCwdPrefix) {
+				contextDir = definitionDir
+			}
+			contextPath := fileresolution.ResolveBakeContextPath(contextDir, *target.Context)
+			dockerfile = readDockerfile(fileresolution.ResolveAbsoluteBakeDockerfilePath(cwd, contextPath, *target.Dockerfile))
+		default:
+			continue
+		}
+
+		args := map[string]string{}
+		for key, value := range target.Args {
+			if value != nil {
+				args[key] = *value
+			}
+		}
+		targetDigests, err := buildImageDigests(dockerConfigDir, dockerfile, args, target.Contexts, hashingOptions, pulls || targetPulls(target))
+		if err != nil {
+			return nil, err
+		}
+		digests = append(digests, targetDigests...)
+	}
+	return digests, nil
+}
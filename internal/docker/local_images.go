@@ -0,0 +1,82 @@
+package docker
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"slices"
+	"strings"
+
+	"log/slog"
+)
+
+// LoadsLocally reports whether the build command only loads its image to the local docker daemon (--load or
+// --output type=docker) - the command itself must not push
+func LoadsLocally(command []string) bool {
+	for i, arg := range command {
+		if arg == "--load" {
+			return true
+		}
+		if (arg == "--output" || arg == "-o") && i+1 < len(command) && outputLoads(command[i+1]) {
+			return true
+		}
+		for _, prefix := range []string{"--output=", "-o="} {
+			if value, ok := strings.CutPrefix(arg, prefix); ok && outputLoads(value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// outputLoads reports whether the --output value loads the image to the local docker daemon
+func outputLoads(outputValue string) bool {
+	for _, field := range strings.Split(outputValue, ",") {
+		if field == "type=docker" {
+			return true
+		}
+	}
+	return false
+}
+
+// LocalImageExists reports whether the local docker daemon (the one of the global flags) has an image with the tag
+func LocalImageExists(globalFlags []string, tag string) (bool, error) {
+	args := append(slices.Clone(globalFlags), "image", "inspect", "--format", "{{.Id}}", tag)
+	var stderr bytes.Buffer
+	inspect := exec.Command("docker", args...)
+	inspect.Stderr = &stderr
+
+	if err := inspect.Run(); err != nil {
+		if strings.Contains(strings.ToLower(stderr.String()), "no such image") {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to inspect local image %s: %w: %s", tag, err, strings.TrimSpace(stderr.String()))
+	}
+	return true, nil
+}
+
+// TagLocalImage points the new tag of the local docker daemon to the image of the existing tag
+func TagLocalImage(globalFlags []string, fromTag string, toTag string) error {
+	args := append(slices.Clone(globalFlags), "tag", fromTag, toTag)
+	if output, err := exec.Command("docker", args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to tag local image %s -> %s: %w: %s", fromTag, toTag, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// RetagLocally points the new tags of the local docker daemon to the images of their cache tags
+func RetagLocally(globalFlags []string, cacheTagPairsByTarget map[string][]CacheTagPair, dryRun bool) error {
+	for target, pairs := range cacheTagPairsByTarget {
+		for _, pair := range pairs {
+			if dryRun {
+				slog.Info("> DRY RUN: would tag local image", "from", pair.CacheTag, "to", pair.NewTag, "target", target)
+				continue
+			}
+			if err := TagLocalImage(globalFlags, pair.CacheTag, pair.NewTag); err != nil {
+				return err
+			}
+			slog.Debug("Tagged local image", "from", pair.CacheTag, "to", pair.NewTag, "target", target)
+		}
+	}
+	return nil
+}
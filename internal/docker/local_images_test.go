@@ -0,0 +1,16 @@
+package docker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadsLocally(t *testing.T) {
+	assert.True(t, LoadsLocally([]string{"docker", "buildx", "build", "--load", "-t", "app", "."}))
+	assert.True(t, LoadsLocally([]string{"docker", "buildx", "bake", "--load"}))
+	assert.True(t, LoadsLocally([]string{"docker", "buildx", "build", "--output", "type=docker,name=app", "."}))
+	assert.True(t, LoadsLocally([]string{"docker", "buildx", "build", "-o=type=docker", "."}))
+	assert.False(t, LoadsLocally([]string{"docker", "buildx", "build", "-t", "app", "."}))
+	assert.False(t, LoadsLocally([]string{"docker", "buildx", "build", "--output", "type=local,dest=out", "."}))
+}
@@ -0,0 +1,117 @@
+package docker
+
+import (
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fuzzBuildCommand generates a valid docker buildx build command from the fuzz inputs, as flag groups (a flag and its
+// value, if any) that can be passed in any order, plus the context
+func fuzzBuildCommand(tag string, label string, buildArg string, target string, secretSource string) [][]string {
+	// commas separate the fields of a secret: a valid source has none
+	secretSource = strings.ReplaceAll(secretSource, ",", "")
+
+	groups := [][]string{
+		{"-t", tag},
+		{"--tag=" + tag + "-latest"},
+		{"--label", "org.opencontainers.image.version=" + label},
+		{"--build-arg", "VERSION=" + buildArg},
+		{"--network", "host"},
+		{"--secret", "id=token,src=" + secretSource},
+		{"--attest", "type=provenance,builder-id=" + label},
+		{"--iidfile", secretSource},
+		{"--platform", "linux/amd64,linux/arm64"},
+		{"--push"},
+		{"--quiet"},
+	}
+
+	// targets are names: keep them valid
+	target = strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '_' {
+			return r
+		}
+		return -1
+	}, target)
+	if target != "" {
+		groups = append(groups, []string{"--target", target})
+	}
+
+	return append(groups, []string{"."})
+}
+
+func flattenFlagGroups(groups [][]string) []string {
+	command := []string{"docker", "buildx", "build"}
+	for _, group := range groups {
+		command = append(command, group...)
+	}
+	return command
+}
+
+// FuzzNormalizeCommandForHashing checks the invariants of the hash normalization over generated command permutations:
+// the flag order does not matter, normalizing twice changes nothing and the values that are not templated are kept,
+// each one right after its flag
+func FuzzNormalizeCommandForHashing(f *testing.F) {
+	f.Add("myregistry/app:v1", "1.2.3", "2", "gpu", "/tmp/secret", uint64(0))
+	f.Add("localhost:5000/app:sha-abc", "", "--foo", "", "-", uint64(42))
+	f.Add("<VALUE>", "a=b,c=d", "x y", "BUILD_stage", "/home/runner/work/_temp/secret", uint64(7))
+
+	f.Fuzz(func(t *testing.T, tag string, label string, buildArg string, target string, secretSource string, seed uint64) {
+		groups := fuzzBuildCommand(tag, label, buildArg, target, secretSource)
+		command := flattenFlagGroups(groups)
+
+		shuffled := slices.Clone(groups)
+		rand.New(rand.NewPCG(seed, seed)).Shuffle(len(shuffled), func(i, j int) {
+			shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+		})
+		shuffledCommand := flattenFlagGroups(shuffled)
+
+		normalized := normalizeCommandForHashing(command, nil)
+
+		// order independence
+		assert.Equal(t, normalized, normalizeCommandForHashing(shuffledCommand, nil), "commands: %q %q", command, shuffledCommand)
+
+		// idempotence
+		assert.Equal(t, normalized, normalizeCommandForHashing(normalized, nil), "command: %q", command)
+
+		// the values that affect the build are kept, the run-specific ones are not
+		require.NotContains(t, normalized, "--quiet")
+		assert.Contains(t, normalized, "VERSION="+buildArg)
+		assert.Contains(t, normalized, "--platform=linux/amd64,linux/arm64")
+		assert.Contains(t, normalized, "org.opencontainers.image.version=<VALUE>")
+		assert.Contains(t, normalized, "id=token,src=<VALUE>")
+		assert.Equal(t, lo.Count(command, "--label"), lo.Count(normalized, "--label"))
+		assert.Equal(t, lo.Count(command, "--build-arg"), lo.Count(normalized, "--build-arg"))
+
+		// the values follow their flags, so swapping the values of two flags is a different build
+		for flag, value := range map[string]string{"--build-arg": "VERSION=" + buildArg, "--network": "host"} {
+			index := slices.Index(normalized, flag)
+			require.NotEqual(t, -1, index, "flag %s of %q", flag, command)
+			require.Less(t, index+1, len(normalized))
+			assert.Equal(t, value, normalized[index+1], "value of %s in %q", flag, normalized)
+		}
+		swapped := slices.Clone(groups)
+		for i, group := range swapped {
+			switch group[0] {
+			case "--build-arg":
+				swapped[i] = []string{"--build-arg", "host"}
+			case "--network":
+				swapped[i] = []string{"--network", "VERSION=" + buildArg}
+			}
+		}
+		assert.NotEqual(t, normalized, normalizeCommandForHashing(flattenFlagGroups(swapped), nil), "command: %q", command)
+		// flags are never dropped, apart from the discarded booleans - the set-like --platform and --target become a
+		// single argument
+		if len(groups) > 12 {
+			assert.Contains(t, normalized, "--target="+groups[11][1], "the target is kept")
+			assert.Len(t, normalized, len(command)-3)
+		} else {
+			assert.Len(t, normalized, len(command)-2)
+		}
+	})
+}
@@ -4,12 +4,15 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"log/slog"
 
 	composecli "github.com/compose-spec/compose-go/v2/cli"
 	"github.com/docker/buildx/bake"
+	"github.com/docker/buildx/build"
+	"github.com/docker/buildx/util/buildflags"
 	"github.com/hytromo/mimosa/internal/configuration"
 	"github.com/hytromo/mimosa/internal/hasher"
 	"github.com/hytromo/mimosa/internal/logger"
@@ -26,8 +29,9 @@ var (
 	}...)
 )
 
-// extractBakeFlags extracts flags from a docker bake command
-func extractBakeFlags(args []string) (bakeFiles, targetNames, overrides []string, err error) {
+// extractBakeFlags extracts flags from a docker bake command - definitionURL is the remote bake definition that the
+// command reads its targets from, if any (e.g. "docker buildx bake https://github.com/org/repo.git#main app")
+func extractBakeFlags(args []string) (bakeFiles, targetNames, overrides []string, definitionURL string, err error) {
 	bakeFiles = []string{}
 	targetNames = []string{}
 	overrides = []string{}
@@ -43,9 +47,9 @@ func extractBakeFlags(args []string) (bakeFiles, targetNames, overrides []string
 		"--list":          true,
 		"--metadata-file": true,
 		"--progress":      true,
-		"--provenance":    true,
-		"--sbom":          true,
 	}
+	// the attestation shorthands change the targets, like buildx they become "*.attest" overrides
+	attestShorthands := map[string]string{"--provenance": "provenance", "--sbom": "sbom"}
 
 	for i := 1; i < len(args); i++ {
 		arg := args[i]
@@ -67,6 +71,14 @@ func extractBakeFlags(args []string) (bakeFiles, targetNames, overrides []string
 			}
 		case strings.HasPrefix(arg, "--set="):
 			overrides = append(overrides, strings.TrimPrefix(arg, "--set="))
+		case attestShorthands[arg] != "":
+			if i+1 < len(args) {
+				overrides = append(overrides, "*.attest="+buildflags.CanonicalizeAttest(attestShorthands[arg], args[i+1]))
+				i++ // skip next
+			}
+		case strings.HasPrefix(arg, "--provenance=") || strings.HasPrefix(arg, "--sbom="):
+			flagName, value, _ := strings.Cut(arg, "=")
+			overrides = append(overrides, "*.attest="+buildflags.CanonicalizeAttest(attestShorthands[flagName], value))
 		case strings.HasPrefix(arg, "-"):
 			// Handle unknown flags
 			if !strings.Contains(arg, "=") {
@@ -80,18 +92,19 @@ func extractBakeFlags(args []string) (bakeFiles, targetNames, overrides []string
 				continue
 			}
 		case !strings.HasPrefix(arg, "-"):
+			// like buildx, the first argument is the remote bake definition if it is a URL
+			if len(targetNames) == 0 && definitionURL == "" && build.IsRemoteURL(arg) {
+				definitionURL = arg
+				continue
+			}
 			// If it doesn't start with -, it's a target name
 			targetNames = append(targetNames, arg)
 		}
 	}
 
-	// If no bake files specified, look for default ones
-	if len(bakeFiles) == 0 {
-		for _, file := range defaultBakeLookupOrder {
-			if _, err := os.Stat(file); err == nil {
-				bakeFiles = append(bakeFiles, file)
-			}
-		}
+	// If no bake files specified, look for default ones - remote definitions are looked up in their repository instead
+	if len(bakeFiles) == 0 && definitionURL == "" {
+		bakeFiles = defaultBakeFiles("")
 	}
 
 	// If no target names specified, use "default"
@@ -99,11 +112,42 @@ func extractBakeFlags(args []string) (bakeFiles, targetNames, overrides []string
 		targetNames = []string{"default"}
 	}
 
-	return bakeFiles, targetNames, overrides, nil
+	return bakeFiles, targetNames, overrides, definitionURL, nil
+}
+
+// defaultBakeFiles returns the default bake files that exist in the dir ("" for the current working directory)
+func defaultBakeFiles(dir string) []string {
+	bakeFiles := []string{}
+	for _, file := range defaultBakeLookupOrder {
+		if _, err := os.Stat(filepath.Join(dir, file)); err == nil {
+			bakeFiles = append(bakeFiles, filepath.Join(dir, file))
+		}
+	}
+	return bakeFiles
+}
+
+// linkedTargets returns the targets that bake only builds because other targets use them as build contexts
+// (contexts = { base = "target:base" }): bake builds them to its cache only, so nothing is pushed for them
+func linkedTargets(targets map[string]*bake.Target) map[string]bool {
+	linked := map[string]bool{}
+	for _, target := range targets {
+		for _, dependency := range hasher.TargetDependencies(target) {
+			if dependencyTarget, ok := targets[dependency]; ok && onlyBuildsToCache(dependencyTarget) {
+				linked[dependency] = true
+			}
+		}
+	}
+	return linked
 }
 
-// ParseBakeCommand parses a docker bake command
-func ParseBakeCommand(dockerBakeCmd []string) (parsedCommand configuration.ParsedCommand, err error) {
+// onlyBuildsToCache reports whether the only output of the target is the build cache
+func onlyBuildsToCache(target *bake.Target) bool {
+	return len(target.Outputs) == 1 && target.Outputs[0] != nil && target.Outputs[0].Type == "cacheonly"
+}
+
+// ParseBakeCommand parses a docker bake command and hashes it with the given hashing options - the images it depends on are
+// resolved with the credentials of dockerConfigDir ("" for the default docker config)
+func ParseBakeCommand(dockerBakeCmd []string, hashingOptions hasher.Options, dockerConfigDir string) (parsedCommand configuration.ParsedCommand, err error) {
 	slog.Debug("Parsing bake command", "command", dockerBakeCmd)
 	parsedCommand.Command = dockerBakeCmd
 
@@ -113,11 +157,36 @@ func ParseBakeCommand(dockerBakeCmd []string) (parsedCommand configuration.Parse
 	}
 
 	// Extract flags
-	bakeFiles, targetNames, overrides, err := extractBakeFlags(dockerBakeCmd[1:])
+	bakeFiles, targetNames, overrides, definitionURL, err := extractBakeFlags(dockerBakeCmd[1:])
 	if err != nil {
 		return parsedCommand, fmt.Errorf("failed to extract bake flags: %w", err)
 	}
 
+	definitionDir := ""
+	if definitionURL != "" {
+		if hashingOptions.BakePlan != "" {
+			return parsedCommand, fmt.Errorf("--bake-plan cannot be used with the remote bake definition %s", definitionURL)
+		}
+		var cleanup func()
+		definitionDir, cleanup, err = checkoutRemoteBakeDefinition(definitionURL)
+		if err != nil {
+			return parsedCommand, err
+		}
+		defer cleanup()
+		bakeFiles = remoteBakeFiles(definitionDir, bakeFiles)
+	}
+
+	if bakePlan := hashingOptions.BakePlan; bakePlan != "" {
+		// the plan is already resolved: its targets are hashed exactly as they will be built, without the bake
+		// files and the overrides of the command
+		if err := validateBakePlan(bakePlan); err != nil {
+			return parsedCommand, err
+		}
+		slog.Debug("Hashing the bake plan instead of the bake files of the command", "plan", bakePlan, "bakeFiles", bakeFiles, "overrides", overrides)
+		bakeFiles = []string{bakePlan}
+		overrides = nil
+	}
+
 	if len(bakeFiles) == 0 {
 		return parsedCommand, fmt.Errorf("no bake files found")
 	}
@@ -135,9 +204,31 @@ func ParseBakeCommand(dockerBakeCmd []string) (parsedCommand configuration.Parse
 		return parsedCommand, fmt.Errorf("failed to parse bake targets: %w", err)
 	}
 
+	commandPulls := bakePulls(dockerBakeCmd)
+	parsedCommand.Pulls = commandPulls
+	linked := linkedTargets(targets)
 	tagsByTarget := make(map[string][]string)
 	for name, target := range targets {
+		warnAboutSecretsFromEnv(target.Secrets)
+		parsedCommand.Pulls = parsedCommand.Pulls || targetPulls(target)
+		if linked[name] {
+			// only built as the build context of other targets - its inputs are part of their hashes instead
+			slog.Debug("Target is only a build context of other targets, not caching its tags", "target", name, "tags", target.Tags)
+			continue
+		}
 		tagsByTarget[name] = target.Tags
+		if len(target.Platforms) > 0 {
+			if parsedCommand.PlatformsByTarget == nil {
+				parsedCommand.PlatformsByTarget = map[string][]string{}
+			}
+			parsedCommand.PlatformsByTarget[name] = sortedPlatforms(target.Platforms)
+		}
+		if attestations := enabledAttestations(target.Attest); len(attestations) > 0 {
+			if parsedCommand.AttestationsByTarget == nil {
+				parsedCommand.AttestationsByTarget = map[string][]string{}
+			}
+			parsedCommand.AttestationsByTarget[name] = attestations
+		}
 	}
 
 	if logger.IsDebugEnabled() {
@@ -148,7 +239,17 @@ func ParseBakeCommand(dockerBakeCmd []string) (parsedCommand configuration.Parse
 	}
 
 	parsedCommand.TagsByTarget = tagsByTarget
-	parsedCommand.Hash = hasher.HashBakeTargets(targets, bakeFiles)
+	imageDigests, err := bakeImageDigests(dockerConfigDir, targets, hashingOptions, commandPulls, definitionDir)
+	if err != nil {
+		return parsedCommand, err
+	}
+	var hash string
+	if definitionDir != "" {
+		hash = hasher.HashRemoteBakeTargets(targets, bakeFiles, definitionDir, hashingOptions)
+	} else {
+		hash = hasher.HashBakeTargets(targets, bakeFiles, hashingOptions)
+	}
+	parsedCommand.Hash = withImageDigests(hash, imageDigests)
 
 	return parsedCommand, nil
 }
@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/hytromo/mimosa/internal/configuration"
+	"github.com/hytromo/mimosa/internal/hasher"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -146,7 +147,7 @@ func TestParseBakeCommand_ValidCommand(t *testing.T) {
 			require.NoError(t, err)
 
 			// Parse the command
-			result, err := ParseBakeCommand(tc.command)
+			result, err := ParseBakeCommand(tc.command, hasher.Options{}, "")
 			require.NoError(t, err)
 
 			// Verify basic fields
@@ -177,7 +178,7 @@ func TestParseBakeCommand_InvalidCommands(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			_, err := ParseBakeCommand(tc.command)
+			_, err := ParseBakeCommand(tc.command, hasher.Options{}, "")
 			assert.Error(t, err)
 			assert.Contains(t, err.Error(), tc.expectedErr)
 		})
@@ -311,6 +312,13 @@ func TestExtractBakeFlags(t *testing.T) {
 			expectedTargets:   []string{"app", "db"},
 			expectedOverrides: []string{},
 		},
+		{
+			name:              "Bake with attestation shorthands",
+			args:              []string{"bake", "--provenance", "mode=max", "--sbom=false", "app"},
+			expectedFiles:     []string{},
+			expectedTargets:   []string{"app"},
+			expectedOverrides: []string{"*.attest=type=provenance,mode=max", "*.attest=type=sbom,disabled=true"},
+		},
 		{
 			name:              "Bake with shorthand flags that should be ignored",
 			args:              []string{"bake", "-D", "--load", "app", "-f", "docker-bake.json"},
@@ -322,7 +330,7 @@ func TestExtractBakeFlags(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			files, targets, overrides, err := extractBakeFlags(tc.args)
+			files, targets, overrides, _, err := extractBakeFlags(tc.args)
 			require.NoError(t, err)
 
 			assert.Equal(t, tc.expectedFiles, files)
@@ -363,7 +371,7 @@ func TestParseBakeCommand_WithRealBakeFile(t *testing.T) {
 	command := []string{"docker", "bake", "app", "db"}
 
 	// Parse the command
-	result, err := ParseBakeCommand(command)
+	result, err := ParseBakeCommand(command, hasher.Options{}, "")
 	require.NoError(t, err)
 
 	// Verify the command was parsed successfully
@@ -375,6 +383,31 @@ func TestParseBakeCommand_WithRealBakeFile(t *testing.T) {
 	}, result.TagsByTarget)
 }
 
+func TestParseBakeCommand_AttestationShorthandsChangeTheHash(t *testing.T) {
+	tempDir := t.TempDir()
+	originalWd, err := os.Getwd()
+	require.NoError(t, err)
+	defer func() { _ = os.Chdir(originalWd) }()
+	require.NoError(t, os.Chdir(tempDir))
+
+	bakeFile := `{"target": {"app": {"context": ".", "dockerfile": "Dockerfile", "tags": ["myapp:latest"]}}}`
+	require.NoError(t, os.WriteFile("docker-bake.json", []byte(bakeFile), 0644))
+	require.NoError(t, os.WriteFile("Dockerfile", []byte("FROM scratch\n"), 0644))
+
+	plain, err := ParseBakeCommand([]string{"docker", "buildx", "bake", "app"}, hasher.Options{}, "")
+	require.NoError(t, err)
+	withProvenance, err := ParseBakeCommand([]string{"docker", "buildx", "bake", "--provenance=mode=max", "app"}, hasher.Options{}, "")
+	require.NoError(t, err)
+	withoutProvenance, err := ParseBakeCommand([]string{"docker", "buildx", "bake", "--provenance", "false", "app"}, hasher.Options{}, "")
+	require.NoError(t, err)
+
+	assert.NotEqual(t, plain.Hash, withProvenance.Hash)
+	assert.NotEqual(t, withProvenance.Hash, withoutProvenance.Hash)
+	assert.Nil(t, plain.AttestationsByTarget)
+	assert.Equal(t, map[string][]string{"app": {"provenance"}}, withProvenance.AttestationsByTarget)
+	assert.Nil(t, withoutProvenance.AttestationsByTarget)
+}
+
 func TestParseBakeCommand_DefaultFileLookup(t *testing.T) {
 	testCases := []struct {
 		name     string
@@ -434,7 +467,7 @@ services:
 			command := []string{"docker", "bake"}
 
 			// Parse the command
-			result, err := ParseBakeCommand(command)
+			result, err := ParseBakeCommand(command, hasher.Options{}, "")
 			require.NoError(t, err)
 
 			// Verify the command was parsed successfully
@@ -470,7 +503,7 @@ func TestParseBakeCommand_WithOverrides(t *testing.T) {
 	command := []string{"docker", "bake", "--set", "*.tags=myapp:override", "app"}
 
 	// Parse the command
-	result, err := ParseBakeCommand(command)
+	result, err := ParseBakeCommand(command, hasher.Options{}, "")
 	require.NoError(t, err)
 
 	// Verify the command was parsed successfully
@@ -527,9 +560,97 @@ func TestParseBakeCommand_ErrorHandling(t *testing.T) {
 			require.NoError(t, err)
 
 			// Parse the command
-			_, err = ParseBakeCommand(tc.command)
+			_, err = ParseBakeCommand(tc.command, hasher.Options{}, "")
 			assert.Error(t, err)
 			assert.Contains(t, err.Error(), tc.expectedErr)
 		})
 	}
 }
+
+func TestParseBakeCommand_WithBakePlan(t *testing.T) {
+	tempDir := t.TempDir()
+
+	originalWd, err := os.Getwd()
+	require.NoError(t, err)
+	defer func() { _ = os.Chdir(originalWd) }()
+	require.NoError(t, os.Chdir(tempDir))
+
+	require.NoError(t, os.WriteFile("docker-bake.hcl", []byte(`target "app" {
+		context = "."
+		tags = ["myapp:from-bake-file"]
+	}`), 0644))
+	// what "docker buildx bake --print app" prints
+	plan := `{
+		"group": {"default": {"targets": ["app"]}},
+		"target": {
+			"app": {
+				"context": ".",
+				"dockerfile": "Dockerfile",
+				"tags": ["myapp:planned"]
+			}
+		}
+	}`
+	require.NoError(t, os.WriteFile("plan.json", []byte(plan), 0644))
+
+	planResult, err := ParseBakeCommand([]string{"docker", "buildx", "bake", "-f", "plan.json", "app"}, hasher.Options{}, "")
+	require.NoError(t, err)
+
+	command := []string{"docker", "buildx", "bake", "--set", "*.tags=myapp:override", "app"}
+	result, err := ParseBakeCommand(command, hasher.Options{BakePlan: "plan.json"}, "")
+	require.NoError(t, err)
+
+	// the plan is hashed exactly as if it was the bake file of the command, ignoring the bake files and overrides
+	assert.Equal(t, command, result.Command)
+	assert.Equal(t, map[string][]string{"app": {"myapp:planned"}}, result.TagsByTarget)
+	assert.Equal(t, planResult.Hash, result.Hash)
+
+	_, err = ParseBakeCommand(command, hasher.Options{BakePlan: "docker-bake.hcl"}, "")
+	assert.ErrorContains(t, err, "not the JSON output of docker buildx bake --print")
+
+	_, err = ParseBakeCommand(command, hasher.Options{BakePlan: "missing.json"}, "")
+	assert.ErrorContains(t, err, "failed to read bake plan")
+}
+
+func TestParseBakeCommand_TargetDependencies(t *testing.T) {
+	tempDir := t.TempDir()
+	originalWd, err := os.Getwd()
+	require.NoError(t, err)
+	defer func() { _ = os.Chdir(originalWd) }()
+	require.NoError(t, os.Chdir(tempDir))
+
+	require.NoError(t, os.MkdirAll("base", 0755))
+	require.NoError(t, os.WriteFile("base/Dockerfile", []byte("FROM alpine\n"), 0644))
+	require.NoError(t, os.WriteFile("Dockerfile", []byte("FROM base\n"), 0644))
+	bakeFile := `{
+		"target": {
+			"base": {
+				"context": "base",
+				"dockerfile": "Dockerfile",
+				"tags": ["myreg/base:latest"]
+			},
+			"app": {
+				"context": ".",
+				"dockerfile": "Dockerfile",
+				"contexts": {"base": "target:base"},
+				"tags": ["myreg/app:latest"]
+			}
+		}
+	}`
+	require.NoError(t, os.WriteFile("docker-bake.json", []byte(bakeFile), 0644))
+
+	result, err := ParseBakeCommand([]string{"docker", "bake", "app"}, hasher.Options{}, "")
+	require.NoError(t, err)
+	// base is only built to the build cache, for app - its tags are not pushed
+	assert.Equal(t, map[string][]string{"app": {"myreg/app:latest"}}, result.TagsByTarget)
+
+	// a change in the inputs of base changes the hash of app
+	require.NoError(t, os.WriteFile("base/Dockerfile", []byte("FROM alpine\nRUN true\n"), 0644))
+	changed, err := ParseBakeCommand([]string{"docker", "bake", "app"}, hasher.Options{}, "")
+	require.NoError(t, err)
+	assert.NotEqual(t, result.Hash, changed.Hash)
+
+	// asked for explicitly, base is pushed like any other target
+	both, err := ParseBakeCommand([]string{"docker", "bake", "app", "base"}, hasher.Options{}, "")
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]string{"app": {"myreg/app:latest"}, "base": {"myreg/base:latest"}}, both.TagsByTarget)
+}
@@ -1,10 +1,13 @@
 package docker
 
 import (
+	"encoding/csv"
 	"fmt"
+	"maps"
 	"os"
 	"path/filepath"
 	"slices"
+	"strconv"
 	"strings"
 
 	"log/slog"
@@ -27,43 +30,46 @@ type ParsedBuildCommand struct {
 	RegistryDomain         string   // the full domain name of the registry, e.g. docker.io - extracted from the tag
 }
 
-const (
-	tagFlagEq         = "--tag="
-	tagShortFlagEq    = "-t="
-	fileFlagEq        = "--file="
-	fileShortFlagEq   = "-f="
-	outputFlagEq      = "--output="
-	outputShortFlagEq = "-o="
-)
-
-// extractRegistryNameFromOutput extracts the image name from an --output flag value
-// when the output type is "registry". For example, for "type=registry,name=localhost:6000/image:tag",
-// it returns "localhost:6000/image:tag" and true. If the type is not "registry" or there's no name,
-// it returns empty string and false.
-func extractRegistryNameFromOutput(outputValue string) (string, bool) {
-	// Parse key=value pairs separated by commas
-	pairs := strings.Split(outputValue, ",")
-
-	var isRegistry bool
-	var name string
+// outputAttributes parses the key=value attributes of an --output flag value, which is CSV: a value with commas is
+// quoted, e.g. type=image,"name=registry/app:v1,registry/app:latest",push=true
+func outputAttributes(outputValue string) map[string]string {
+	attributes := map[string]string{}
+	fields, err := csv.NewReader(strings.NewReader(outputValue)).Read()
+	if err != nil {
+		// not valid CSV, fall back to a plain split
+		fields = strings.Split(outputValue, ",")
+	}
 
-	for _, pair := range pairs {
+	for _, field := range fields {
 		// Split on first '=' only to handle values with '=' in them
-		idx := strings.Index(pair, "=")
-		if idx == -1 {
-			continue
+		if key, value, ok := strings.Cut(field, "="); ok {
+			attributes[strings.ToLower(strings.TrimSpace(key))] = value
 		}
-		key := pair[:idx]
-		value := pair[idx+1:]
+	}
+	return attributes
+}
 
-		if key == "type" && value == "registry" {
-			isRegistry = true
-		} else if key == "name" && value != "" {
-			name = value
-		}
+// OutputPushes returns whether an --output flag value pushes the image to a registry: type=registry, or
+// type=image with push=true
+func OutputPushes(outputValue string) bool {
+	attributes := outputAttributes(outputValue)
+	switch attributes["type"] {
+	case "registry":
+		return true
+	case "image":
+		push, err := strconv.ParseBool(attributes["push"])
+		return err == nil && push
 	}
+	return false
+}
 
-	if isRegistry && name != "" {
+// extractRegistryNameFromOutput extracts the image name from an --output flag value when the output pushes to a
+// registry. For example, for "type=registry,name=localhost:6000/image:tag", it returns "localhost:6000/image:tag"
+// and true. Multiple names are returned comma-separated, as given. If the output does not push or there's no name,
+// it returns empty string and false.
+func extractRegistryNameFromOutput(outputValue string) (string, bool) {
+	name := outputAttributes(outputValue)["name"]
+	if OutputPushes(outputValue) && name != "" {
 		return name, true
 	}
 	return "", false
@@ -76,6 +82,7 @@ type flagTemplate struct {
 	longFlag  string   // e.g., "--tag"
 	shortFlag string   // e.g., "-t" (optional, empty if no short form)
 	subKeys   []string // e.g., ["builder-id"] for partial templating within the value (optional)
+	keepKey   bool     // keep the key of a key=value value and template the rest, e.g. "--label key=<VALUE>" (optional)
 }
 
 // flagsToTemplate defines which flags should have their values replaced with <VALUE>
@@ -99,9 +106,11 @@ var flagsToTemplate = []flagTemplate{
 	// Display format - purely cosmetic
 	{longFlag: "--progress"},
 	// labels
-	{longFlag: "--label"},
-	// secrets
-	{longFlag: "--secret", subKeys: []string{"src", "env"}},
+	{longFlag: "--label", keepKey: true},
+	// secrets and ssh agents are identified by their id - where they come from (paths, env variables) changes between
+	// machines, and their values are never part of the build cache anyway
+	{longFlag: "--secret", subKeys: []string{"src", "source", "env"}},
+	{longFlag: "--ssh", keepKey: true},
 }
 
 // flagsToDiscard defines boolean flags that should be completely removed before
@@ -112,70 +121,127 @@ var flagsToDiscard = []flagTemplate{
 	{longFlag: "--debug", shortFlag: "-D"},
 }
 
+// setLikeFlags are the repeatable flags whose values are a set: neither their order, nor repeating a value, nor how
+// they are spelled ("--flag value", "--flag=value") changes the build. The flags mapped to true also take
+// comma-separated values, e.g. "--platform linux/amd64,linux/arm64".
+var setLikeFlags = map[string]bool{
+	"--allow":           false,
+	"--no-cache-filter": false,
+	"--platform":        true,
+	"--ulimit":          false,
+}
+
+// canonicalizeSetLikeFlags replaces all the occurrences of the set-like flags with their sorted, unique values, as
+// "--platform=linux/amd64,linux/arm64" (comma-separated flags) or one "--allow=<value>" per value (the rest)
+func canonicalizeSetLikeFlags(dockerBuildCmd []string) []string {
+	canonical := []string{}
+	values := map[string][]string{}
+	occurrences := map[string][]string{} // flag name -> the arguments it was given as, for tracing
+
+	for i := 0; i < len(dockerBuildCmd); i++ {
+		arg := dockerBuildCmd[i]
+		start := i
+		flagName, value, hasValue := strings.Cut(arg, "=")
+		commaSeparated, isSetLike := setLikeFlags[flagName]
+		if !isSetLike || (!hasValue && i+1 >= len(dockerBuildCmd)) {
+			canonical = append(canonical, arg)
+			continue
+		}
+		if !hasValue {
+			i++
+			value = dockerBuildCmd[i]
+		}
+		occurrences[flagName] = append(occurrences[flagName], strings.Join(dockerBuildCmd[start:i+1], " "))
+		if commaSeparated {
+			values[flagName] = append(values[flagName], strings.Split(value, ",")...)
+		} else {
+			values[flagName] = append(values[flagName], value)
+		}
+	}
+
+	for _, flagName := range slices.Sorted(maps.Keys(values)) {
+		flagValues := lo.Uniq(values[flagName])
+		slices.Sort(flagValues)
+		canonicalStart := len(canonical)
+		if setLikeFlags[flagName] {
+			canonical = append(canonical, flagName+"="+strings.Join(flagValues, ","))
+		} else {
+			for _, value := range flagValues {
+				canonical = append(canonical, flagName+"="+value)
+			}
+		}
+		hasher.TraceNormalization(strings.Join(occurrences[flagName], " "), "set-like flag canonicalized", strings.Join(canonical[canonicalStart:], " "))
+	}
+
+	return canonical
+}
+
+// canonicalizeTargetFlag replaces the --target flags with a single "--target=<stage>" of the stage that is built (the
+// last one given, like docker does), so that the stage is not parted from its flag when the arguments are sorted:
+// otherwise "--target builder --network host" and "--target host --network builder" are hashed the same
+func canonicalizeTargetFlag(dockerBuildCmd []string) []string {
+	canonical := []string{}
+	occurrences := []string{}
+	stage := ""
+
+	for i := 0; i < len(dockerBuildCmd); i++ {
+		arg := dockerBuildCmd[i]
+		start := i
+		flagName, value, hasValue := strings.Cut(arg, "=")
+		if flagName != "--target" || (!hasValue && i+1 >= len(dockerBuildCmd)) {
+			canonical = append(canonical, arg)
+			continue
+		}
+		if !hasValue {
+			i++
+			value = dockerBuildCmd[i]
+		}
+		occurrences = append(occurrences, strings.Join(dockerBuildCmd[start:i+1], " "))
+		stage = value
+	}
+
+	if len(occurrences) > 0 {
+		canonical = append(canonical, "--target="+stage)
+		hasher.TraceNormalization(strings.Join(occurrences, " "), "target stage canonicalized", "--target="+stage)
+	}
+	return canonical
+}
+
 func extractBuildFlags(args []string) (allTags []string, additionalBuildContexts map[string]string, dockerfilePath string, err error) {
 	allTags = []string{}
 	dockerfilePath = ""
 	additionalBuildContexts = make(map[string]string) // context name -> context path/value
-	for i := 1; i < len(args); i++ {
-		if args[i] == "--tag" || args[i] == "-t" {
-			if i+1 < len(args) {
-				allTags = append(allTags, args[i+1])
-				i++ // skip next
-			}
-		} else if len(args[i]) > len(tagFlagEq)-1 && args[i][:len(tagFlagEq)] == tagFlagEq {
-			allTags = append(allTags, args[i][len(tagFlagEq):])
-		} else if len(args[i]) > len(tagShortFlagEq)-1 && args[i][:len(tagShortFlagEq)] == tagShortFlagEq {
-			allTags = append(allTags, args[i][len(tagShortFlagEq):])
-		} else if args[i] == "--output" || args[i] == "-o" {
-			// Handle: --output type=registry,name=VALUE or -o type=registry,name=VALUE
-			if i+1 < len(args) {
-				outputValue := args[i+1]
-				if name, ok := extractRegistryNameFromOutput(outputValue); ok {
-					allTags = append(allTags, name)
-				}
-				i++ // skip next
-			}
-		} else if strings.HasPrefix(args[i], outputFlagEq) {
-			// Handle: --output=type=registry,name=VALUE
-			outputValue := args[i][len(outputFlagEq):]
-			if name, ok := extractRegistryNameFromOutput(outputValue); ok {
-				allTags = append(allTags, name)
-			}
-		} else if strings.HasPrefix(args[i], outputShortFlagEq) {
-			// Handle: -o=type=registry,name=VALUE
-			outputValue := args[i][len(outputShortFlagEq):]
-			if name, ok := extractRegistryNameFromOutput(outputValue); ok {
-				allTags = append(allTags, name)
-			}
-		} else if args[i] == "--file" || args[i] == "-f" {
-			if i+1 < len(args) {
-				dockerfilePath = args[i+1]
-				i++ // skip next
-			}
-		} else if len(args[i]) > len(fileFlagEq)-1 && args[i][:len(fileFlagEq)] == fileFlagEq {
-			dockerfilePath = args[i][len(fileFlagEq):]
-		} else if len(args[i]) > len(fileShortFlagEq)-1 && args[i][:len(fileShortFlagEq)] == fileShortFlagEq {
-			dockerfilePath = args[i][len(fileShortFlagEq):]
-		} else if args[i] == "--build-context" {
-			if i+1 < len(args) {
-				// Handle: --build-context name=VALUE
-				contextArg := args[i+1]
-				if strings.Contains(contextArg, "=") {
-					parts := strings.SplitN(contextArg, "=", 2)
-					if len(parts) == 2 {
-						additionalBuildContexts[parts[0]] = parts[1]
+
+	// args start after "docker": skip "build" or "buildx build"
+	prefixLen := 1
+	if len(args) > 0 && args[0] == "buildx" {
+		prefixLen = 2
+	}
+	flags, _ := splitBuildArgs(args[min(prefixLen, len(args)):])
+
+	for _, flag := range flags {
+		if !flag.hasValue {
+			continue
+		}
+
+		switch flag.name {
+		case "--tag", "-t":
+			allTags = append(allTags, flag.value)
+		case "--output", "-o":
+			// Handle: --output type=registry,name=VALUE (or type=image,name=VALUE,push=true), VALUE can hold many names
+			if names, ok := extractRegistryNameFromOutput(flag.value); ok {
+				for _, name := range strings.Split(names, ",") {
+					if name = strings.TrimSpace(name); name != "" {
+						allTags = append(allTags, name)
 					}
 				}
-				i++ // skip the context argument
 			}
-		} else if strings.HasPrefix(args[i], "--build-context=") {
-			// Handle: --build-context=name=VALUE
-			contextArg := args[i][len("--build-context="):]
-			if strings.Contains(contextArg, "=") {
-				parts := strings.SplitN(contextArg, "=", 2)
-				if len(parts) == 2 {
-					additionalBuildContexts[parts[0]] = parts[1]
-				}
+		case "--file", "-f":
+			dockerfilePath = flag.value
+		case "--build-context":
+			// Handle: --build-context name=VALUE
+			if contextName, contextValue, ok := strings.Cut(flag.value, "="); ok {
+				additionalBuildContexts[contextName] = contextValue
 			}
 		}
 	}
@@ -187,51 +253,15 @@ func extractBuildFlags(args []string) (allTags []string, additionalBuildContexts
 	return
 }
 
-// assumes the context path does not start with "-"
+// findContextPath returns the positional argument of the docker build command, which is its build context
 func findContextPath(dockerBuildArgs []string) (string, error) {
-	booleanFlags := []string{
-		"--check", "-D", "--debug", "--load", "--no-cache", "--pull", "--push", "-q", "--quiet",
-	}
-
-	var previousArgument string
+	_, positional := splitBuildArgs(dockerBuildArgs[min(buildCommandPrefixLen(dockerBuildArgs), len(dockerBuildArgs)):])
 
-	// skip docker build/docker buildx build args
-	hasBuildx := slices.Contains(dockerBuildArgs, "buildx")
-	firstIndex := 2
-	if hasBuildx {
-		firstIndex = 3
+	if len(positional) == 0 {
+		return "", fmt.Errorf("context path not found")
 	}
 
-	for i := firstIndex; i < len(dockerBuildArgs); i++ {
-		arg := dockerBuildArgs[i]
-
-		// if the argument is a boolean flag, skip it
-		if slices.Contains(booleanFlags, arg) {
-			continue
-		}
-
-		// If the current argument starts with '-', it's a flag / normal argument (could be --file, -t, --no-cache, etc.)
-		if strings.HasPrefix(arg, "-") {
-			previousArgument = arg // save this so as to see if the next arg is its value
-			continue
-		}
-
-		// If the previous argument was a flag (and didn't include '='), assume this is its value
-		if strings.HasPrefix(previousArgument, "-") && !strings.Contains(previousArgument, "=") {
-			// This argument is being used as the value of the previous flag, so skip it
-			previousArgument = arg
-			continue
-		}
-
-		// If we reach here, the argument:
-		// - doesn't start with '-'
-		// - isn't the value of a previous flag
-		// So we assume it's the build context (e.g. ".", "./dir", etc.)
-		return arg, nil
-	}
-
-	// If no suitable argument was found, return an error
-	return "", fmt.Errorf("context path not found")
+	return positional[0], nil
 }
 
 // templateSubKeys replaces specific sub-key values within a flag value.
@@ -249,11 +279,16 @@ func templateSubKeys(value string, subKeys []string) string {
 				break
 			}
 			idx += searchStart // adjust for the offset
-			// Find the end of this sub-key's value (next comma or end of string)
+			// Find the end of this sub-key's value (next comma or end of string - or the closing quote of a
+			// quoted CSV field like "name=a,b", whose value holds commas)
 			startOfValue := idx + len(prefix)
 			endOfValue := len(result)
+			separator := byte(',')
+			if idx > 0 && result[idx-1] == '"' {
+				separator = '"'
+			}
 			for j := startOfValue; j < len(result); j++ {
-				if result[j] == ',' {
+				if result[j] == separator {
 					endOfValue = j
 					break
 				}
@@ -286,12 +321,16 @@ func templateLabelValue(value string) string {
 // 1. Discards boolean flags defined in flagsToDiscard (they don't affect image content)
 // 2. Templates flag values defined in flagsToTemplate (replacing with <VALUE>)
 // 3. Sorts the resulting arguments to ensure order independence
-func normalizeCommandForHashing(dockerBuildCmd []string) []string {
+// Set-like flags (e.g. --platform, --allow) and --target are canonicalized first, see canonicalizeSetLikeFlags and
+// canonicalizeTargetFlag, after the values of the given infrastructure flags are templated, see hasher.TemplateInfrastructureFlags.
+func normalizeCommandForHashing(dockerBuildCmd []string, infrastructureFlags []hasher.InfrastructureFlag) []string {
 	var normalized []string
+	dockerBuildCmd = canonicalizeTargetFlag(canonicalizeSetLikeFlags(hasher.TemplateInfrastructureFlags(dockerBuildCmd, infrastructureFlags)))
 
 	for i := 0; i < len(dockerBuildCmd); i++ {
 		arg := dockerBuildCmd[i]
 		handled := false
+		start, normalizedStart, rule := i, len(normalized), "kept"
 
 		// Check if this is a boolean flag to discard entirely
 		for _, ft := range flagsToDiscard {
@@ -301,40 +340,28 @@ func normalizeCommandForHashing(dockerBuildCmd []string) []string {
 			}
 		}
 		if handled {
+			hasher.TraceNormalization(arg, "discarded", "")
 			continue
 		}
 
 		for _, ft := range flagsToTemplate {
-			// Special handling for --label: keep key, template value
-			if ft.longFlag == "--label" {
-				// Check for space-separated format: --label key=value
-				if arg == "--label" {
-					normalized = append(normalized, arg)
-					if i+1 < len(dockerBuildCmd) {
-						i++
-						normalized = append(normalized, templateLabelValue(dockerBuildCmd[i]))
-					}
-					handled = true
-					break
-				}
-				// Check for equals format: --label=key=value
-				if strings.HasPrefix(arg, "--label=") {
-					value := arg[len("--label="):]
-					normalized = append(normalized, "--label="+templateLabelValue(value))
-					handled = true
-					break
-				}
-			}
-
 			// Check for space-separated format: --flag value or -f value
 			if arg == ft.longFlag || (ft.shortFlag != "" && arg == ft.shortFlag) {
-				if len(ft.subKeys) > 0 && i+1 < len(dockerBuildCmd) {
+				if ft.keepKey && i+1 < len(dockerBuildCmd) {
+					// keep flag and key, template the value
+					rule = "value templated, key kept"
+					normalized = append(normalized, arg)
+					i++
+					normalized = append(normalized, templateLabelValue(dockerBuildCmd[i]))
+				} else if len(ft.subKeys) > 0 && i+1 < len(dockerBuildCmd) {
 					// Partial templating: keep flag, template only sub-keys in value
+					rule = "sub-keys templated"
 					normalized = append(normalized, arg)
 					i++
 					normalized = append(normalized, templateSubKeys(dockerBuildCmd[i], ft.subKeys))
 				} else {
 					// Full templating: replace entire value with <VALUE>
+					rule = "templated"
 					normalized = append(normalized, arg)
 					if i+1 < len(dockerBuildCmd) {
 						i++
@@ -353,12 +380,17 @@ func normalizeCommandForHashing(dockerBuildCmd []string) []string {
 			}
 
 			if strings.HasPrefix(arg, longPrefix) {
-				if len(ft.subKeys) > 0 {
+				if ft.keepKey {
+					rule = "value templated, key kept"
+					normalized = append(normalized, longPrefix+templateLabelValue(arg[len(longPrefix):]))
+				} else if len(ft.subKeys) > 0 {
 					// Partial templating: template only sub-keys
+					rule = "sub-keys templated"
 					value := arg[len(longPrefix):]
 					normalized = append(normalized, longPrefix+templateSubKeys(value, ft.subKeys))
 				} else {
 					// Full templating
+					rule = "templated"
 					normalized = append(normalized, longPrefix+"<VALUE>")
 				}
 				handled = true
@@ -368,10 +400,12 @@ func normalizeCommandForHashing(dockerBuildCmd []string) []string {
 			if shortPrefix != "" && strings.HasPrefix(arg, shortPrefix) {
 				if len(ft.subKeys) > 0 {
 					// Partial templating: template only sub-keys
+					rule = "sub-keys templated"
 					value := arg[len(shortPrefix):]
 					normalized = append(normalized, shortPrefix+templateSubKeys(value, ft.subKeys))
 				} else {
 					// Full templating
+					rule = "templated"
 					normalized = append(normalized, shortPrefix+"<VALUE>")
 				}
 				handled = true
@@ -382,6 +416,7 @@ func normalizeCommandForHashing(dockerBuildCmd []string) []string {
 		if !handled {
 			normalized = append(normalized, arg)
 		}
+		hasher.TraceNormalization(strings.Join(dockerBuildCmd[start:i+1], " "), rule, strings.Join(normalized[normalizedStart:], " "))
 	}
 
 	// Sort arguments (excluding the command prefix like "docker build" or "docker buildx build")
@@ -426,7 +461,8 @@ func normalizeCommandForHashing(dockerBuildCmd []string) []string {
 		})
 		// Flatten groups back into a single slice
 		argsToSort = []string{}
-		for _, group := range groups {
+		for position, group := range groups {
+			hasher.TraceNormalization(strings.Join(group, " "), "sorted", fmt.Sprintf("position %d", prefixLen+position))
 			argsToSort = append(argsToSort, group...)
 		}
 		normalized = append(normalized[:prefixLen], argsToSort...)
@@ -435,33 +471,24 @@ func normalizeCommandForHashing(dockerBuildCmd []string) []string {
 	return normalized
 }
 
-// groupFlagValuePairs groups flags with their values together.
-// Flags that take values (from flagsToTemplate) are grouped with their following value.
+// groupFlagValuePairs groups flags with their values together, the way splitBuildArgs reads them: every flag that takes
+// a value is grouped with it, so that sorting never moves a value to another flag
 func groupFlagValuePairs(args []string) [][]string {
-	var groups [][]string
-	flagsWithValues := make(map[string]bool)
-
-	// Build a set of flags that take values
-	for _, ft := range flagsToTemplate {
-		flagsWithValues[ft.longFlag] = true
-		if ft.shortFlag != "" {
-			flagsWithValues[ft.shortFlag] = true
-		}
-	}
+	flags, positional := splitBuildArgs(args)
 
-	i := 0
-	for i < len(args) {
-		arg := args[i]
-		// Check if this is a flag that takes a value
-		if flagsWithValues[arg] && i+1 < len(args) {
-			// Group flag with its value
-			groups = append(groups, []string{arg, args[i+1]})
-			i += 2
-		} else {
-			// Standalone argument
-			groups = append(groups, []string{arg})
-			i++
-		}
+	groups := make([][]string, 0, len(flags)+len(positional)+1)
+	grouped := 0
+	for _, flag := range flags {
+		groups = append(groups, flag.args)
+		grouped += len(flag.args)
+	}
+	for _, arg := range positional {
+		groups = append(groups, []string{arg})
+		grouped++
+	}
+	if grouped < len(args) {
+		// the "--" that ends the flags
+		groups = append(groups, []string{"--"})
 	}
 
 	return groups
@@ -469,11 +496,13 @@ func groupFlagValuePairs(args []string) [][]string {
 
 // buildCommandWithoutTagArguments is kept for backward compatibility but now calls
 // the more general normalizeCommandForHashing function.
-func buildCommandWithoutTagArguments(dockerBuildCmd []string) []string {
-	return normalizeCommandForHashing(dockerBuildCmd)
+func buildCommandWithoutTagArguments(dockerBuildCmd []string, infrastructureFlags []hasher.InfrastructureFlag) []string {
+	return normalizeCommandForHashing(dockerBuildCmd, infrastructureFlags)
 }
 
-func ParseBuildCommand(dockerBuildCmd []string) (parsedCommand configuration.ParsedCommand, err error) {
+// ParseBuildCommand parses a docker build command and hashes it with the given hashing options - the images it depends on are
+// resolved with the credentials of dockerConfigDir ("" for the default docker config)
+func ParseBuildCommand(dockerBuildCmd []string, hashingOptions hasher.Options, dockerConfigDir string) (parsedCommand configuration.ParsedCommand, err error) {
 	slog.Debug("Parsing command", "command", dockerBuildCmd)
 	parsedCommand.Command = dockerBuildCmd
 
@@ -525,19 +554,61 @@ func ParseBuildCommand(dockerBuildCmd []string) (parsedCommand configuration.Par
 	absoluteDockerfilePath := fileresolution.ResolveAbsoluteDockerfilePath(cwd, relativeDockerfilePath)
 	dockerignorePath := fileresolution.ResolveAbsoluteDockerIgnorePath(absoluteContextPath, relativeDockerfilePath)
 
+	if relativeContextPath == stdinContextArg {
+		// the context read from stdin is hashed as a whole: the Dockerfile is in it, and nothing of it is ignored
+		absoluteContextPath, err = stdinContextDir()
+		if err != nil {
+			return parsedCommand, err
+		}
+		defer func() {
+			_ = os.RemoveAll(absoluteContextPath)
+		}()
+		absoluteDockerfilePath = fileresolution.ResolveAbsoluteDockerfilePath(absoluteContextPath, relativeDockerfilePath)
+		dockerignorePath = ""
+	}
+
+	warnAboutBuildSecretsFromEnv(dockerBuildCmd)
+	reportBuildkitCaches(dockerBuildCmd)
+
+	// the build args of --build-arg-file are hashed by their values
+	hashedBuildCmd, err := expandBuildArgFiles(dockerBuildCmd)
+	if err != nil {
+		return parsedCommand, err
+	}
+
 	// add the context in all the build contexts:
 	allBuildContexts[configuration.MainBuildContextName] = absoluteContextPath
 
+	// a build of a --target stage is named after it, so that its cache tags are never mistaken for another stage's
+	targetName := "default"
+	if stage := targetStage(dockerBuildCmd); stage != "" {
+		targetName = stage
+	}
+
 	parsedCommand.Hash = hasher.HashBuildCommand(hasher.DockerBuildCommand{
+		Name:                   targetName,
 		DockerfilePath:         absoluteDockerfilePath,
 		DockerignorePath:       dockerignorePath,
 		BuildContexts:          allBuildContexts,
 		AllRegistryDomains:     lo.Uniq(allRegistryDomains),
-		CmdWithoutTagArguments: buildCommandWithoutTagArguments(dockerBuildCmd),
-	})
+		CmdWithoutTagArguments: buildCommandWithoutTagArguments(hashedBuildCmd, hashingOptions.InfrastructureFlags),
+	}, hashingOptions)
+	pulls := buildPulls(dockerBuildCmd)
+	imageDigests, err := buildImageDigests(dockerConfigDir, readDockerfile(absoluteDockerfilePath), buildArgs(hashedBuildCmd), allBuildContexts, hashingOptions, pulls)
+	if err != nil {
+		return parsedCommand, err
+	}
+	parsedCommand.Hash = withImageDigests(parsedCommand.Hash, imageDigests)
 	parsedCommand.TagsByTarget = map[string][]string{
-		"default": allTags,
+		targetName: allTags,
+	}
+	if platforms := requestedPlatforms(dockerBuildCmd); len(platforms) > 0 {
+		parsedCommand.PlatformsByTarget = map[string][]string{targetName: platforms}
+	}
+	if attestations := requestedAttestations(dockerBuildCmd); len(attestations) > 0 {
+		parsedCommand.AttestationsByTarget = map[string][]string{targetName: attestations}
 	}
+	parsedCommand.Pulls = pulls
 
 	return parsedCommand, nil
 }
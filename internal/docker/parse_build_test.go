@@ -1,11 +1,14 @@
 package docker
 
 import (
+	"bytes"
+	"log/slog"
 	"os"
 	"strings"
 	"testing"
 
 	"github.com/hytromo/mimosa/internal/configuration"
+	"github.com/hytromo/mimosa/internal/hasher"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -147,6 +150,16 @@ func TestParseBuildCommand_ValidCommand(t *testing.T) {
 				},
 			},
 		},
+		{
+			name:    "Build command with target stage",
+			command: []string{"docker", "build", "--target", "builder", "-t", "myapp:builder", "."},
+			expected: configuration.ParsedCommand{
+				Command: []string{"docker", "build", "--target", "builder", "-t", "myapp:builder", "."},
+				TagsByTarget: map[string][]string{
+					"builder": {"myapp:builder"},
+				},
+			},
+		},
 		{
 			name:    "Build command with output name before type",
 			command: []string{"docker", "buildx", "build", "--push", "--output", "name=localhost:6000/image:tag,type=registry", "."},
@@ -176,7 +189,7 @@ func TestParseBuildCommand_ValidCommand(t *testing.T) {
 			err = os.WriteFile(dockerfilePath, []byte("FROM alpine:latest"), 0644)
 			require.NoError(t, err)
 
-			result, err := ParseBuildCommand(tc.command)
+			result, err := ParseBuildCommand(tc.command, hasher.Options{}, "")
 			require.NoError(t, err)
 
 			assert.Equal(t, tc.expected.Command, result.Command)
@@ -231,7 +244,7 @@ func TestParseBuildCommand_InvalidCommands(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			_, err := ParseBuildCommand(tc.command)
+			_, err := ParseBuildCommand(tc.command, hasher.Options{}, "")
 			require.Error(t, err)
 			require.Contains(t, err.Error(), tc.expectedErr)
 		})
@@ -255,6 +268,13 @@ func TestExtractBuildFlags(t *testing.T) {
 			expectedBuildContexts:  map[string]string{},
 			expectedDockerfilePath: "",
 		},
+		{
+			name:                   "Tags in a pushed image output",
+			args:                   []string{"buildx", "build", "--output", `type=image,"name=myreg/app:v1,myreg/app:latest",push=true`, "."},
+			expectedTags:           []string{"myreg/app:v1", "myreg/app:latest"},
+			expectedBuildContexts:  map[string]string{},
+			expectedDockerfilePath: "",
+		},
 		{
 			name:                   "Multiple tags",
 			args:                   []string{"build", "-t", "myapp:latest", "-t", "myapp:v1.0.0", "."},
@@ -384,6 +404,13 @@ func TestExtractBuildFlags(t *testing.T) {
 			expectError:            true,
 			expectedErrorContains:  "cannot find image tag",
 		},
+		{
+			name:                   "Flag values that look like tag flags",
+			args:                   []string{"buildx", "build", "--label", "-t", "--build-arg", "--file=ignored", "-tmyapp:latest", "."},
+			expectedTags:           []string{"myapp:latest"},
+			expectedBuildContexts:  map[string]string{},
+			expectedDockerfilePath: "",
+		},
 	}
 
 	for _, tc := range testCases {
@@ -446,6 +473,21 @@ func TestFindContextPath(t *testing.T) {
 			args:         []string{"docker", "build", "--build-context", "backend=./backend", "-t", "myapp:latest", "--push", "./docs"},
 			expectedPath: "./docs",
 		},
+		{
+			name:         "Flag values that start with dashes",
+			args:         []string{"docker", "buildx", "build", "--build-arg", "FLAGS=--foo", "--label", "-weird", "-t", "myapp:latest", "./app"},
+			expectedPath: "./app",
+		},
+		{
+			name:         "Legacy boolean flags",
+			args:         []string{"docker", "build", "--rm", "--force-rm", "-t", "myapp:latest", "./app"},
+			expectedPath: "./app",
+		},
+		{
+			name:         "Context from stdin",
+			args:         []string{"docker", "build", "-t", "myapp:latest", "-"},
+			expectedPath: "-",
+		},
 		{
 			name:          "No context path",
 			args:          []string{"docker", "build", "-t", "myapp:latest"},
@@ -480,26 +522,23 @@ func TestNormalizeCommandForHashing(t *testing.T) {
 	githubActionsExpected := []string{
 		"docker", "buildx", "build",
 		"--attest", "type=provenance,mode=min,inline-only=true,builder-id=<VALUE>",
-		"--file",
+		"--file", "Dockerfile.gpu",
 		"--iidfile", "<VALUE>",
 		"--metadata-file", "<VALUE>",
-		"--platform",
+		"--platform=linux/amd64",
 		"--push",
 		"--secret", "id=ARTIFACTORY_PASSWORD,src=<VALUE>",
 		"--secret", "id=ARTIFACTORY_USER,src=<VALUE>",
 		"--tag", "<VALUE>",
-		"--target",
+		"--target=application",
 		".",
-		"Dockerfile.gpu",
-		"application",
-		"linux/amd64",
 	}
 
 	// Shared expected output for GitHub Actions commands with labels - label values are templated
 	githubActionsWithLabelsExpected := []string{
 		"docker", "buildx", "build",
 		"--attest", "type=provenance,mode=min,inline-only=true,builder-id=<VALUE>",
-		"--file",
+		"--file", "Dockerfile.gpu",
 		"--iidfile", "<VALUE>",
 		"--label", "org.opencontainers.image.created=<VALUE>",
 		"--label", "org.opencontainers.image.description=<VALUE>",
@@ -510,16 +549,13 @@ func TestNormalizeCommandForHashing(t *testing.T) {
 		"--label", "org.opencontainers.image.url=<VALUE>",
 		"--label", "org.opencontainers.image.version=<VALUE>",
 		"--metadata-file", "<VALUE>",
-		"--platform",
+		"--platform=linux/amd64",
 		"--push",
 		"--secret", "id=ARTIFACTORY_PASSWORD,src=<VALUE>",
 		"--secret", "id=ARTIFACTORY_USER,src=<VALUE>",
 		"--tag", "<VALUE>",
-		"--target",
+		"--target=application",
 		".",
-		"Dockerfile.gpu",
-		"application",
-		"linux/amd64",
 	}
 
 	testCases := []struct {
@@ -711,6 +747,27 @@ func TestNormalizeCommandForHashing(t *testing.T) {
 			input:    []string{"docker", "build", "--secret", "id=mysecret,src=/path,env=VAR", "-t", "myapp:latest", "."},
 			expected: []string{"docker", "build", "--secret", "id=mysecret,src=<VALUE>,env=<VALUE>", "-t", "<VALUE>", "."},
 		},
+		{
+			name:     "secret with source key",
+			input:    []string{"docker", "build", "--secret", "id=mysecret,source=/path/to/file", "-t", "myapp:latest", "."},
+			expected: []string{"docker", "build", "--secret", "id=mysecret,source=<VALUE>", "-t", "<VALUE>", "."},
+		},
+		// SSH tests
+		{
+			name:     "ssh default agent",
+			input:    []string{"docker", "build", "--ssh", "default", "-t", "myapp:latest", "."},
+			expected: []string{"docker", "build", "--ssh", "default", "-t", "<VALUE>", "."},
+		},
+		{
+			name:     "ssh with socket path",
+			input:    []string{"docker", "build", "--ssh", "default=/tmp/ssh-XXXX/agent.123", "-t", "myapp:latest", "."},
+			expected: []string{"docker", "build", "--ssh", "default=<VALUE>", "-t", "<VALUE>", "."},
+		},
+		{
+			name:     "ssh with key paths in equals format",
+			input:    []string{"docker", "build", "--ssh=github=/home/me/.ssh/id_rsa,/home/me/.ssh/id_ed25519", "-t", "myapp:latest", "."},
+			expected: []string{"docker", "build", "--ssh=github=<VALUE>", "-t", "<VALUE>", "."},
+		},
 		// Real-world GitHub Actions example - two different runs should normalize to the same output
 		{
 			name: "GitHub Actions buildx command with different temp paths and tags",
@@ -801,7 +858,7 @@ func TestNormalizeCommandForHashing(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			result := normalizeCommandForHashing(tc.input)
+			result := normalizeCommandForHashing(tc.input, nil)
 			assert.Equal(t, tc.expected, result)
 		})
 	}
@@ -829,6 +886,21 @@ func TestNormalizeCommandForHashing_OrderIndependence(t *testing.T) {
 			input1: []string{"docker", "buildx", "build", "--metadata-file", "/path/1.json", "--platform", "linux/amd64,linux/arm64", "-t", "img:v1", "."},
 			input2: []string{"docker", "buildx", "build", "-t", "img:v2", "--platform", "linux/amd64,linux/arm64", "--metadata-file", "/path/2.json", "."},
 		},
+		{
+			name:   "Platforms in a different order, repeated and in separate flags",
+			input1: []string{"docker", "buildx", "build", "--platform", "linux/arm64,linux/amd64", "-t", "img:v1", "."},
+			input2: []string{"docker", "buildx", "build", "--platform=linux/amd64", "-t", "img:v1", "--platform", "linux/arm64,linux/amd64", "."},
+		},
+		{
+			name:   "Entitlements in equals and separate format, in a different order",
+			input1: []string{"docker", "buildx", "build", "--allow", "network.host", "--allow=security.insecure", "-t", "img:v1", "."},
+			input2: []string{"docker", "buildx", "build", "--allow", "security.insecure", "-t", "img:v1", "--allow=network.host", "--allow", "network.host", "."},
+		},
+		{
+			name:   "No-cache filters and ulimits in a different order",
+			input1: []string{"docker", "buildx", "build", "--no-cache-filter", "build", "--no-cache-filter=test", "--ulimit", "nofile=1024:1024", "--ulimit", "nproc=512", "."},
+			input2: []string{"docker", "buildx", "build", "--ulimit=nproc=512", "--no-cache-filter", "test", "--ulimit", "nofile=1024:1024", "--no-cache-filter", "build", "."},
+		},
 		{
 			name:   "With and without quiet flag",
 			input1: []string{"docker", "build", "--quiet", "-t", "myapp:latest", "--platform", "linux/amd64", "."},
@@ -853,13 +925,29 @@ func TestNormalizeCommandForHashing_OrderIndependence(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			result1 := normalizeCommandForHashing(tc.input1)
-			result2 := normalizeCommandForHashing(tc.input2)
+			result1 := normalizeCommandForHashing(tc.input1, nil)
+			result2 := normalizeCommandForHashing(tc.input2, nil)
 			assert.Equal(t, result1, result2, "Commands with same flags in different order should normalize to the same result")
 		})
 	}
 }
 
+func TestNormalizeCommandForHashing_ValuesStayWithTheirFlags(t *testing.T) {
+	// swapping the values of two flags is a different build, even though the words are the same
+	hostNetwork := normalizeCommandForHashing([]string{"docker", "build", "--network", "host", "--build-arg", "A=B", "."}, nil)
+	swapped := normalizeCommandForHashing([]string{"docker", "build", "--network", "A=B", "--build-arg", "host", "."}, nil)
+
+	assert.Equal(t, []string{"docker", "build", "--build-arg", "A=B", "--network", "host", "."}, hostNetwork)
+	assert.Equal(t, []string{"docker", "build", "--build-arg", "host", "--network", "A=B", "."}, swapped)
+	assert.NotEqual(t, hostNetwork, swapped)
+
+	// values that are given in the same way are sorted along with their flags
+	assert.Equal(t,
+		normalizeCommandForHashing([]string{"docker", "build", "--shm-size", "1g", "--cpu-shares", "512", "-f", "Dockerfile.gpu", "."}, nil),
+		normalizeCommandForHashing([]string{"docker", "build", "-f", "Dockerfile.gpu", "--cpu-shares", "512", "--shm-size", "1g", "."}, nil),
+	)
+}
+
 func TestNormalizeCommandForHashing_GitHubActionsExample(t *testing.T) {
 	// These are the actual commands from the GitHub Actions issue
 	// They should produce identical normalized output
@@ -885,8 +973,8 @@ func TestNormalizeCommandForHashing_GitHubActionsExample(t *testing.T) {
 		"docs/gh-actions/actions-example",
 	}
 
-	result1 := normalizeCommandForHashing(cmd1)
-	result2 := normalizeCommandForHashing(cmd2)
+	result1 := normalizeCommandForHashing(cmd1, nil)
+	result2 := normalizeCommandForHashing(cmd2, nil)
 
 	assert.Equal(t, result1, result2, "GitHub Actions example commands should normalize to the same result")
 
@@ -923,6 +1011,12 @@ func TestTemplateSubKeys(t *testing.T) {
 			subKeys:  []string{"builder-id"},
 			expected: "builder-id=<VALUE>,type=provenance",
 		},
+		{
+			name:     "Template a quoted value holding commas",
+			value:    `type=image,"name=myreg/app:v1,myreg/app:latest",push=true`,
+			subKeys:  []string{"name"},
+			expected: `type=image,"name=<VALUE>",push=true`,
+		},
 		{
 			name:     "No matching subkey",
 			value:    "type=provenance,mode=max",
@@ -961,8 +1055,8 @@ func TestTemplateSubKeys(t *testing.T) {
 func TestBuildCmdWithoutTagArguments(t *testing.T) {
 	// This function should delegate to normalizeCommandForHashing
 	input := []string{"docker", "build", "-t", "myapp:latest", "."}
-	result := buildCommandWithoutTagArguments(input)
-	expected := normalizeCommandForHashing(input)
+	result := buildCommandWithoutTagArguments(input, nil)
+	expected := normalizeCommandForHashing(input, nil)
 	assert.Equal(t, expected, result)
 }
 
@@ -981,7 +1075,7 @@ func TestNormalizeCommandForHashing_ShortFlagEqualsWithSubKeys(t *testing.T) {
 	})
 
 	input := []string{"docker", "build", "-a=type=provenance,builder-id=https://example.com", "-t", "myapp:latest", "."}
-	result := normalizeCommandForHashing(input)
+	result := normalizeCommandForHashing(input, nil)
 
 	// The short flag with equals should have its subKey templated
 	assert.Contains(t, result, "-a=type=provenance,builder-id=<VALUE>")
@@ -1004,7 +1098,7 @@ func TestParseBuildCommand_DockerignoreHandling(t *testing.T) {
 
 	command := []string{"docker", "build", "-t", "myapp:latest", "."}
 
-	result, err := ParseBuildCommand(command)
+	result, err := ParseBuildCommand(command, hasher.Options{}, "")
 	require.NoError(t, err)
 
 	assert.Equal(t, command, result.Command)
@@ -1030,7 +1124,7 @@ func TestParseBuildCommand_CustomDockerignoreHandling(t *testing.T) {
 
 	command := []string{"docker", "build", "-f", "Dockerfile.prod", "-t", "myapp:latest", "."}
 
-	result, err := ParseBuildCommand(command)
+	result, err := ParseBuildCommand(command, hasher.Options{}, "")
 	require.NoError(t, err)
 
 	assert.Equal(t, command, result.Command)
@@ -1084,8 +1178,8 @@ func TestNormalizeCommandForHashing_LabelBehavior(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			result1 := normalizeCommandForHashing(tc.input1)
-			result2 := normalizeCommandForHashing(tc.input2)
+			result1 := normalizeCommandForHashing(tc.input1, nil)
+			result2 := normalizeCommandForHashing(tc.input2, nil)
 			if tc.expected {
 				assert.Equal(t, result1, result2, "Commands should normalize to the same result")
 			} else {
@@ -1148,8 +1242,8 @@ func TestNormalizeCommandForHashing_SecretBehavior(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			result1 := normalizeCommandForHashing(tc.input1)
-			result2 := normalizeCommandForHashing(tc.input2)
+			result1 := normalizeCommandForHashing(tc.input1, nil)
+			result2 := normalizeCommandForHashing(tc.input2, nil)
 			if tc.expected {
 				assert.Equal(t, result1, result2, "Commands should normalize to the same result")
 			} else {
@@ -1273,6 +1367,30 @@ func TestExtractRegistryNameFromOutput(t *testing.T) {
 			expectedName: "",
 			expectedOk:   false,
 		},
+		{
+			name:         "type=image pushed",
+			input:        "type=image,name=localhost:6000/image:tag,push=true",
+			expectedName: "localhost:6000/image:tag",
+			expectedOk:   true,
+		},
+		{
+			name:         "type=image not pushed",
+			input:        "type=image,name=localhost:6000/image:tag",
+			expectedName: "",
+			expectedOk:   false,
+		},
+		{
+			name:         "type=image with push=false",
+			input:        "type=image,name=localhost:6000/image:tag,push=false",
+			expectedName: "",
+			expectedOk:   false,
+		},
+		{
+			name:         "quoted multiple names",
+			input:        `type=registry,"name=localhost:6000/image:v1,localhost:6000/image:latest"`,
+			expectedName: "localhost:6000/image:v1,localhost:6000/image:latest",
+			expectedOk:   true,
+		},
 	}
 
 	for _, tc := range testCases {
@@ -1325,8 +1443,8 @@ func TestNormalizeCommandForHashing_OutputBehavior(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			result1 := normalizeCommandForHashing(tc.input1)
-			result2 := normalizeCommandForHashing(tc.input2)
+			result1 := normalizeCommandForHashing(tc.input1, nil)
+			result2 := normalizeCommandForHashing(tc.input2, nil)
 			if tc.expected {
 				assert.Equal(t, result1, result2, "Commands should normalize to the same result")
 			} else {
@@ -1335,3 +1453,95 @@ func TestNormalizeCommandForHashing_OutputBehavior(t *testing.T) {
 		})
 	}
 }
+
+func TestCanonicalizeSetLikeFlags(t *testing.T) {
+	assert.Equal(t,
+		[]string{"docker", "buildx", "build", "-t", "img:v1", ".", "--allow=network.host", "--allow=security.insecure", "--platform=linux/amd64,linux/arm64"},
+		canonicalizeSetLikeFlags([]string{"docker", "buildx", "build", "--platform", "linux/arm64", "--allow", "security.insecure", "-t", "img:v1", "--platform=linux/amd64,linux/arm64", "--allow=network.host", "."}),
+	)
+
+	// a set-like flag without its value is kept as is
+	assert.Equal(t, []string{"docker", "build", ".", "--platform"}, canonicalizeSetLikeFlags([]string{"docker", "build", ".", "--platform"}))
+}
+
+func TestCanonicalizeTargetFlag(t *testing.T) {
+	// the last --target is the stage that is built
+	assert.Equal(t,
+		[]string{"docker", "build", "-t", "img:v1", ".", "--target=runtime"},
+		canonicalizeTargetFlag([]string{"docker", "build", "--target", "builder", "-t", "img:v1", "--target=runtime", "."}),
+	)
+
+	// a --target without its value is kept as is
+	assert.Equal(t, []string{"docker", "build", ".", "--target"}, canonicalizeTargetFlag([]string{"docker", "build", ".", "--target"}))
+
+	// the stage stays with its flag when the arguments are sorted
+	assert.NotEqual(t,
+		normalizeCommandForHashing([]string{"docker", "build", "--target", "builder", "--network", "host", "."}, nil),
+		normalizeCommandForHashing([]string{"docker", "build", "--target", "host", "--network", "builder", "."}, nil),
+	)
+}
+
+func TestParseBuildCommand_TargetStagesHashDifferently(t *testing.T) {
+	t.Chdir(t.TempDir())
+	require.NoError(t, os.WriteFile("Dockerfile", []byte("FROM alpine AS builder\nFROM alpine AS runtime\n"), 0644))
+
+	builder, err := ParseBuildCommand([]string{"docker", "build", "--target", "builder", "-t", "myapp:v1", "."}, hasher.Options{}, "")
+	require.NoError(t, err)
+	runtime, err := ParseBuildCommand([]string{"docker", "build", "--target=runtime", "-t", "myapp:v1", "."}, hasher.Options{}, "")
+	require.NoError(t, err)
+	plain, err := ParseBuildCommand([]string{"docker", "build", "-t", "myapp:v1", "."}, hasher.Options{}, "")
+	require.NoError(t, err)
+
+	assert.NotEqual(t, builder.Hash, runtime.Hash)
+	assert.NotEqual(t, builder.Hash, plain.Hash)
+	assert.Equal(t, map[string][]string{"runtime": {"myapp:v1"}}, runtime.TagsByTarget)
+	assert.Equal(t, map[string][]string{"default": {"myapp:v1"}}, plain.TagsByTarget)
+}
+
+func TestOutputPushes(t *testing.T) {
+	assert.True(t, OutputPushes("type=registry"))
+	assert.True(t, OutputPushes("type=image,push=true,name=myreg/app:v1"))
+	assert.True(t, OutputPushes("push=1,type=image"))
+	assert.False(t, OutputPushes("type=image,name=myreg/app:v1"))
+	assert.False(t, OutputPushes("type=docker,name=myreg/app:v1"))
+	assert.False(t, OutputPushes("type=local,dest=/tmp/out"))
+	assert.False(t, OutputPushes(""))
+}
+
+func TestNormalizeCommandForHashing_Tracing(t *testing.T) {
+	var logs bytes.Buffer
+	defaultLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+	hasher.SetNormalizationTracing(true)
+	t.Cleanup(func() {
+		slog.SetDefault(defaultLogger)
+		hasher.SetNormalizationTracing(false)
+	})
+
+	normalizeCommandForHashing([]string{
+		"docker", "buildx", "build", "-q", "-t", "myreg/app:v1", "--attest=type=provenance,builder-id=https://ci/runs/1",
+		"--label", "version=1.2.3", "--platform", "linux/arm64,linux/amd64", ".",
+	}, nil)
+
+	for _, line := range []string{
+		`argument=-q rule=discarded result=""`,
+		`argument="-t myreg/app:v1" rule=templated result="-t <VALUE>"`,
+		`argument="--attest=type=provenance,builder-id=https://ci/runs/1" rule="sub-keys templated" result="--attest=type=provenance,builder-id=<VALUE>"`,
+		`argument="--label version=1.2.3" rule="value templated, key kept" result="--label version=<VALUE>"`,
+		`argument="--platform linux/arm64,linux/amd64" rule="set-like flag canonicalized" result="--platform=linux/amd64,linux/arm64"`,
+		`argument=. rule=kept result=.`,
+		`argument=. rule=sorted result="position 7"`,
+	} {
+		assert.Contains(t, logs.String(), line)
+	}
+}
+
+func TestNormalizeCommandForHashing_InfrastructureFlags(t *testing.T) {
+	first := []string{"docker", "buildx", "build", "--add-host", "ci-proxy:10.0.0.5", "--cgroup-parent=/runner-1", "-t", "myapp:latest", "."}
+	second := []string{"docker", "buildx", "build", "--cgroup-parent=/runner-2", "--add-host", "ci-proxy:10.0.0.9", "-t", "myapp:latest", "."}
+	assert.NotEqual(t, normalizeCommandForHashing(first, nil), normalizeCommandForHashing(second, nil))
+
+	flags, err := hasher.ParseInfrastructureFlags(true, nil)
+	require.NoError(t, err)
+	assert.Equal(t, normalizeCommandForHashing(first, flags), normalizeCommandForHashing(second, flags))
+}
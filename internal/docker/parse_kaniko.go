@@ -0,0 +1,172 @@
+package docker
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"log/slog"
+
+	"github.com/hytromo/mimosa/internal/configuration"
+	argparse "github.com/hytromo/mimosa/internal/docker/arg_parse"
+	"github.com/hytromo/mimosa/internal/hasher"
+	"github.com/samber/lo"
+)
+
+// the short flags of the kaniko executor that take a value
+var kanikoShortFlags = map[string]string{
+	"-c": "context",
+	"-f": "dockerfile",
+	"-d": "destination",
+	"-v": "verbosity",
+}
+
+// kanikoFlagsToIgnore do not affect the image contents - where it is pushed, how it is cached, logging etc
+var kanikoFlagsToIgnore = []string{
+	"destination", "context", "context-sub-path", "no-push", "tar-path",
+	"digest-file", "image-name-with-digest-file", "image-name-tag-with-digest-file", "oci-layout-path",
+	"cache", "cache-repo", "cache-dir", "cache-ttl", "cache-copy-layers", "cache-run-layers", "compressed-caching",
+	"cleanup", "verbosity", "log-format", "log-timestamp", "push-retry", "image-fs-extract-retry",
+	"insecure", "insecure-pull", "insecure-registry", "skip-tls-verify", "skip-tls-verify-pull",
+	"skip-tls-verify-registry", "registry-certificate", "registry-client-cert", "registry-mirror",
+	"skip-default-registry-fallback", "ignore-var-run", "ignore-path", "kaniko-dir", "force",
+}
+
+type kanikoFlag struct {
+	name  string
+	value string
+}
+
+// IsKanikoCommand reports whether the command runs the kaniko executor (e.g. "/kaniko/executor --context ...")
+func IsKanikoCommand(command []string) bool {
+	return len(command) > 0 && filepath.Base(command[0]) == "executor"
+}
+
+// parseKanikoFlags parses the flags of the kaniko executor, which takes no positional arguments: a flag is
+// followed by its value, unless the next argument is another flag (boolean flag)
+func parseKanikoFlags(args []string) ([]kanikoFlag, error) {
+	flags := []kanikoFlag{}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "-") {
+			return nil, fmt.Errorf("unexpected argument %q", arg)
+		}
+
+		name, value, hasValue := strings.Cut(arg, "=")
+		if longName, ok := kanikoShortFlags[name]; ok {
+			name = longName
+		} else {
+			name = strings.TrimLeft(name, "-")
+		}
+
+		if !hasValue && i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
+			i++
+			value = args[i]
+		}
+		flags = append(flags, kanikoFlag{name: name, value: value})
+	}
+	return flags, nil
+}
+
+func kanikoFlagValue(flags []kanikoFlag, name string, defaultValue string) string {
+	value := defaultValue
+	for _, flag := range flags {
+		if flag.name == name {
+			value = flag.value
+		}
+	}
+	return value
+}
+
+// resolveKanikoDockerfilePath resolves the dockerfile like kaniko does: as given if it exists, otherwise inside the context
+func resolveKanikoDockerfilePath(absoluteContextPath string, dockerfilePath string) (string, error) {
+	if _, err := os.Stat(dockerfilePath); err == nil {
+		return filepath.Abs(dockerfilePath)
+	}
+	return filepath.Join(absoluteContextPath, dockerfilePath), nil
+}
+
+// normalizeKanikoFlagsForHashing keeps only the flags that affect the image contents, order independent
+func normalizeKanikoFlagsForHashing(flags []kanikoFlag) []string {
+	normalized := []string{}
+	for _, flag := range flags {
+		if slices.Contains(kanikoFlagsToIgnore, flag.name) {
+			hasher.TraceNormalization("--"+flag.name+"="+flag.value, "discarded", "")
+			continue
+		}
+		value, rule := flag.value, "kept"
+		if flag.name == "label" {
+			// like docker build: label keys affect the hash, label values do not
+			value, rule = templateLabelValue(value), "value templated, key kept"
+		}
+		hasher.TraceNormalization("--"+flag.name+"="+flag.value, rule, "--"+flag.name+"="+value)
+		normalized = append(normalized, "--"+flag.name+"="+value)
+	}
+	slices.Sort(normalized)
+	return append([]string{"kaniko"}, normalized...)
+}
+
+// ParseKanikoCommand parses a kaniko executor command, e.g. "/kaniko/executor --context . --destination org/app:v1", and
+// hashes it with the given hashing options
+func ParseKanikoCommand(command []string, hashingOptions hasher.Options) (parsedCommand configuration.ParsedCommand, err error) {
+	slog.Debug("Parsing kaniko command", "command", command)
+	parsedCommand.Command = command
+
+	flags, err := parseKanikoFlags(command[1:])
+	if err != nil {
+		return parsedCommand, err
+	}
+
+	if lo.ContainsBy(flags, func(flag kanikoFlag) bool { return flag.name == "no-push" && flag.value != "false" }) {
+		return parsedCommand, errors.New("--no-push found, skipping caching behavior and running command directly")
+	}
+
+	destinations := lo.FilterMap(flags, func(flag kanikoFlag, _ int) (string, bool) {
+		return flag.value, flag.name == "destination" && flag.value != ""
+	})
+	if len(destinations) == 0 {
+		return parsedCommand, errors.New("no --destination found, skipping caching behavior and running command directly")
+	}
+
+	contextPath := strings.TrimPrefix(kanikoFlagValue(flags, "context", "/workspace/"), "dir://")
+	if strings.Contains(contextPath, "://") || strings.HasSuffix(contextPath, ".tar.gz") {
+		return parsedCommand, fmt.Errorf("only local kaniko contexts are supported, got: %s", contextPath)
+	}
+	contextPath = filepath.Join(contextPath, kanikoFlagValue(flags, "context-sub-path", ""))
+	absoluteContextPath, err := filepath.Abs(contextPath)
+	if err != nil {
+		return parsedCommand, err
+	}
+
+	absoluteDockerfilePath, err := resolveKanikoDockerfilePath(absoluteContextPath, kanikoFlagValue(flags, "dockerfile", "Dockerfile"))
+	if err != nil {
+		return parsedCommand, err
+	}
+
+	// kaniko only reads the .dockerignore of the context root
+	dockerignorePath := filepath.Join(absoluteContextPath, ".dockerignore")
+	if _, err := os.Stat(dockerignorePath); err != nil {
+		dockerignorePath = ""
+	}
+
+	registryDomains := lo.Map(destinations, func(destination string, _ int) string {
+		return argparse.ExtractRegistryDomain(destination)
+	})
+
+	parsedCommand.Hash = hasher.HashBuildCommand(hasher.DockerBuildCommand{
+		Name:                   "default",
+		DockerfilePath:         absoluteDockerfilePath,
+		DockerignorePath:       dockerignorePath,
+		BuildContexts:          map[string]string{configuration.MainBuildContextName: absoluteContextPath},
+		AllRegistryDomains:     lo.Uniq(registryDomains),
+		CmdWithoutTagArguments: normalizeKanikoFlagsForHashing(flags),
+	}, hashingOptions)
+	parsedCommand.TagsByTarget = map[string][]string{
+		"default": destinations,
+	}
+
+	return parsedCommand, nil
+}
@@ -0,0 +1,103 @@
+package docker
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hytromo/mimosa/internal/hasher"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func kanikoContext(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "Dockerfile"), []byte("FROM alpine\nCOPY . .\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "app.txt"), []byte("app"), 0644))
+	return dir
+}
+
+func TestIsKanikoCommand(t *testing.T) {
+	assert.True(t, IsKanikoCommand([]string{"/kaniko/executor", "--context", "."}))
+	assert.True(t, IsKanikoCommand([]string{"executor"}))
+	assert.False(t, IsKanikoCommand([]string{"docker", "buildx", "build"}))
+	assert.False(t, IsKanikoCommand([]string{}))
+}
+
+func TestParseKanikoFlags(t *testing.T) {
+	flags, err := parseKanikoFlags([]string{"-c", "dir:///ws", "--dockerfile=Dockerfile.prod", "--cache", "-d", "org/app:v1", "--build-arg", "A=1"})
+	require.NoError(t, err)
+	assert.Equal(t, []kanikoFlag{
+		{name: "context", value: "dir:///ws"},
+		{name: "dockerfile", value: "Dockerfile.prod"},
+		{name: "cache"},
+		{name: "destination", value: "org/app:v1"},
+		{name: "build-arg", value: "A=1"},
+	}, flags)
+
+	_, err = parseKanikoFlags([]string{"--context", ".", "positional", "extra"})
+	assert.Error(t, err)
+}
+
+func TestParseKanikoCommand(t *testing.T) {
+	contextDir := kanikoContext(t)
+	command := []string{"/kaniko/executor", "--context", "dir://" + contextDir, "--destination", "registry.io/org/app:v1", "-d", "registry.io/org/app:latest", "--build-arg", "A=1"}
+
+	parsedCommand, err := ParseKanikoCommand(command, hasher.Options{})
+
+	require.NoError(t, err)
+	assert.Equal(t, command, parsedCommand.Command)
+	assert.Equal(t, map[string][]string{"default": {"registry.io/org/app:v1", "registry.io/org/app:latest"}}, parsedCommand.TagsByTarget)
+	assert.NotEmpty(t, parsedCommand.Hash)
+
+	// destinations, caching and logging flags, and the flag order do not affect the hash
+	sameBuild, err := ParseKanikoCommand([]string{"/kaniko/executor", "--build-arg=A=1", "--cache=true", "--cache-repo", "registry.io/org/cache", "--verbosity", "debug", "-c", contextDir, "-d", "registry.io/org/app:v2"}, hasher.Options{})
+	require.NoError(t, err)
+	assert.Equal(t, parsedCommand.Hash, sameBuild.Hash)
+
+	otherBuild, err := ParseKanikoCommand([]string{"/kaniko/executor", "--context", contextDir, "--destination", "registry.io/org/app:v1", "--build-arg", "A=2"}, hasher.Options{})
+	require.NoError(t, err)
+	assert.NotEqual(t, parsedCommand.Hash, otherBuild.Hash)
+
+	require.NoError(t, os.WriteFile(filepath.Join(contextDir, "app.txt"), []byte("changed"), 0644))
+	changedContext, err := ParseKanikoCommand(command, hasher.Options{})
+	require.NoError(t, err)
+	assert.NotEqual(t, parsedCommand.Hash, changedContext.Hash)
+}
+
+func TestParseKanikoCommand_DockerfileAndDockerignore(t *testing.T) {
+	contextDir := kanikoContext(t)
+	require.NoError(t, os.MkdirAll(filepath.Join(contextDir, "sub"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(contextDir, "sub", "Dockerfile.sub"), []byte("FROM alpine\n"), 0644))
+
+	command := []string{"/kaniko/executor", "--context", contextDir, "--dockerfile", "sub/Dockerfile.sub", "--destination", "registry.io/org/app:v1"}
+	parsedCommand, err := ParseKanikoCommand(command, hasher.Options{})
+	require.NoError(t, err)
+
+	// ignored files do not affect the hash
+	require.NoError(t, os.WriteFile(filepath.Join(contextDir, ".dockerignore"), []byte("ignored.txt\n"), 0644))
+	withDockerignore, err := ParseKanikoCommand(command, hasher.Options{})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(contextDir, "ignored.txt"), []byte("ignored"), 0644))
+	withIgnoredFile, err := ParseKanikoCommand(command, hasher.Options{})
+	require.NoError(t, err)
+
+	assert.NotEqual(t, parsedCommand.Hash, withDockerignore.Hash)
+	assert.Equal(t, withDockerignore.Hash, withIgnoredFile.Hash)
+}
+
+func TestParseKanikoCommand_NotCacheable(t *testing.T) {
+	contextDir := kanikoContext(t)
+
+	for name, command := range map[string][]string{
+		"no push":        {"/kaniko/executor", "--context", contextDir, "--destination", "org/app:v1", "--no-push"},
+		"no destination": {"/kaniko/executor", "--context", contextDir, "--tar-path", "image.tar"},
+		"remote context": {"/kaniko/executor", "--context", "s3://bucket/context.tar.gz", "--destination", "org/app:v1"},
+		"git context":    {"/kaniko/executor", "--context", "git://github.com/org/repo.git", "--destination", "org/app:v1"},
+	} {
+		parsedCommand, err := ParseKanikoCommand(command, hasher.Options{})
+		assert.Error(t, err, name)
+		assert.Equal(t, command, parsedCommand.Command, name)
+	}
+}
@@ -0,0 +1,124 @@
+package docker
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/samber/lo"
+)
+
+// requestedPlatforms returns the platforms given with --platform to a docker build command, sorted - none means the
+// default platform of the builder
+func requestedPlatforms(dockerBuildCmd []string) []string {
+	flags, _ := splitBuildArgs(dockerBuildCmd[buildCommandPrefixLen(dockerBuildCmd):])
+	values := []string{}
+	for _, flag := range flags {
+		if flag.name == "--platform" && flag.hasValue {
+			values = append(values, flag.value)
+		}
+	}
+	return sortedPlatforms(values)
+}
+
+// sortedPlatforms returns the unique platforms of the values, sorted - each value can be a comma-separated list
+func sortedPlatforms(values []string) []string {
+	platforms := []string{}
+	for _, value := range values {
+		for _, platform := range strings.Split(value, ",") {
+			if platform = strings.TrimSpace(platform); platform != "" {
+				platforms = append(platforms, platform)
+			}
+		}
+	}
+	platforms = lo.Uniq(platforms)
+	slices.Sort(platforms)
+	return platforms
+}
+
+// imagePlatforms returns the platforms of the image or index that the tag points to; the attestation manifests of an
+// index (platform unknown/unknown) are not platforms
+func imagePlatforms(dockerConfigDir string, tag string) ([]v1.Platform, error) {
+	ref, err := name.ParseReference(tag)
+	if err != nil {
+		return nil, err
+	}
+	desc, err := Get(dockerConfigDir, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	if desc.MediaType.IsIndex() {
+		index, err := desc.ImageIndex()
+		if err != nil {
+			return nil, err
+		}
+		manifest, err := index.IndexManifest()
+		if err != nil {
+			return nil, err
+		}
+		platforms := []v1.Platform{}
+		for _, descriptor := range manifest.Manifests {
+			if descriptor.Platform != nil && descriptor.Platform.OS != "unknown" {
+				platforms = append(platforms, *descriptor.Platform)
+			}
+		}
+		return platforms, nil
+	}
+
+	image, err := desc.Image()
+	if err != nil {
+		return nil, err
+	}
+	config, err := image.ConfigFile()
+	if err != nil {
+		return nil, err
+	}
+	return []v1.Platform{{OS: config.OS, Architecture: config.Architecture, Variant: config.Variant}}, nil
+}
+
+// MissingPlatforms returns the requested platforms (e.g. "linux/arm64") that the image of the tag is not built for -
+// a requested platform without a variant matches any variant
+func MissingPlatforms(dockerConfigDir string, tag string, requested []string) ([]string, error) {
+	if len(requested) == 0 {
+		return nil, nil
+	}
+
+	platforms, err := imagePlatforms(dockerConfigDir, tag)
+	if err != nil {
+		return nil, err
+	}
+
+	return lo.Filter(requested, func(platform string, _ int) bool {
+		spec, err := v1.ParsePlatform(platform)
+		if err != nil || !strings.Contains(platform, "/") {
+			// e.g. "local", which buildx resolves itself - nothing to compare with
+			return false
+		}
+		return !lo.ContainsBy(platforms, func(imagePlatform v1.Platform) bool {
+			return imagePlatform.Satisfies(*spec)
+		})
+	}), nil
+}
+
+// VerifyCachedPlatforms checks that the images of the cache tags are built for all the platforms requested for their
+// targets, so that e.g. an amd64-only image is not served to a build that asks for amd64 and arm64
+func VerifyCachedPlatforms(dockerConfigDir string, cacheTagPairsByTarget map[string][]CacheTagPair, platformsByTarget map[string][]string) error {
+	for target, platforms := range platformsByTarget {
+		pairs := cacheTagPairsByTarget[target]
+		if len(platforms) == 0 || len(pairs) == 0 {
+			continue
+		}
+		// all the cache tags of a target point to the same image
+		missing, err := MissingPlatforms(dockerConfigDir, pairs[0].CacheTag, platforms)
+		if err != nil {
+			return fmt.Errorf("failed to get the platforms of %s: %w", pairs[0].CacheTag, err)
+		}
+		if len(missing) > 0 {
+			return fmt.Errorf("%s is not built for %s", pairs[0].CacheTag, strings.Join(missing, ", "))
+		}
+	}
+	return nil
+}
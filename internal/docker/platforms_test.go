@@ -0,0 +1,88 @@
+package docker
+
+import (
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestedPlatforms(t *testing.T) {
+	assert.Equal(t, []string{"linux/amd64", "linux/arm64"},
+		requestedPlatforms([]string{"docker", "buildx", "build", "--platform", "linux/arm64, linux/amd64", "--platform=linux/arm64", "."}))
+	assert.Equal(t, []string{}, requestedPlatforms([]string{"docker", "build", "--push", "-t", "app:v1", "."}))
+}
+
+// writeTestIndex writes an index with one image per platform, plus an attestation manifest, to the tag
+func writeTestIndex(t *testing.T, tag string, platforms ...v1.Platform) {
+	t.Helper()
+	var index v1.ImageIndex = empty.Index
+	for _, platform := range append(platforms, v1.Platform{OS: "unknown", Architecture: "unknown"}) {
+		image, err := random.Image(64, 1)
+		require.NoError(t, err)
+		index = mutate.AppendManifests(index, mutate.IndexAddendum{
+			Add:        image,
+			Descriptor: v1.Descriptor{Platform: &platform},
+		})
+	}
+	require.NoError(t, remote.WriteIndex(parseTestReference(t, tag), index))
+}
+
+func TestMissingPlatforms_Index(t *testing.T) {
+	registryHost := startInMemoryRegistry(t)
+	tag := registryHost + "/app:" + CacheTagPrefix + "abc"
+	writeTestIndex(t, tag, v1.Platform{OS: "linux", Architecture: "amd64"}, v1.Platform{OS: "linux", Architecture: "arm64", Variant: "v8"})
+
+	missing, err := MissingPlatforms("", tag, []string{"linux/amd64", "linux/arm64"})
+	require.NoError(t, err)
+	assert.Empty(t, missing, "a platform without a variant matches any variant")
+
+	missing, err = MissingPlatforms("", tag, []string{"linux/amd64", "linux/arm/v7", "local"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"linux/arm/v7"}, missing)
+
+	missing, err = MissingPlatforms("", tag, []string{"unknown/unknown"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"unknown/unknown"}, missing, "attestation manifests are not platforms")
+}
+
+func TestMissingPlatforms_Image(t *testing.T) {
+	registryHost := startInMemoryRegistry(t)
+	tag := registryHost + "/app:" + CacheTagPrefix + "abc"
+
+	image, err := random.Image(64, 1)
+	require.NoError(t, err)
+	image, err = mutate.ConfigFile(image, &v1.ConfigFile{OS: "linux", Architecture: "amd64"})
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(parseTestReference(t, tag), image))
+
+	missing, err := MissingPlatforms("", tag, []string{"linux/amd64", "linux/arm64"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"linux/arm64"}, missing)
+}
+
+func TestVerifyCachedPlatforms(t *testing.T) {
+	registryHost := startInMemoryRegistry(t)
+	apiTag := registryHost + "/api:" + CacheTagPrefix + "abc"
+	webTag := registryHost + "/web:" + CacheTagPrefix + "abc"
+	writeTestIndex(t, apiTag, v1.Platform{OS: "linux", Architecture: "amd64"}, v1.Platform{OS: "linux", Architecture: "arm64"})
+	writeTestIndex(t, webTag, v1.Platform{OS: "linux", Architecture: "amd64"})
+
+	pairs := map[string][]CacheTagPair{
+		"api": {{CacheTag: apiTag, NewTag: registryHost + "/api:v1"}},
+		"web": {{CacheTag: webTag, NewTag: registryHost + "/web:v1"}},
+	}
+
+	assert.NoError(t, VerifyCachedPlatforms("", pairs, map[string][]string{"api": {"linux/amd64", "linux/arm64"}, "web": {"linux/amd64"}}))
+	// targets without platforms use the default platform of the builder, which is not checked
+	assert.NoError(t, VerifyCachedPlatforms("", pairs, map[string][]string{"api": {"linux/arm64"}}))
+	assert.ErrorContains(t, VerifyCachedPlatforms("", pairs, map[string][]string{"web": {"linux/amd64", "linux/arm64"}}), "is not built for linux/arm64")
+	assert.Error(t, VerifyCachedPlatforms("", map[string][]CacheTagPair{
+		"default": {{CacheTag: registryHost + "/missing:" + CacheTagPrefix + "abc", NewTag: registryHost + "/missing:v1"}},
+	}, map[string][]string{"default": {"linux/amd64"}}))
+}
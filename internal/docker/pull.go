@@ -0,0 +1,36 @@
+package docker
+
+import (
+	"slices"
+	"strconv"
+
+	"github.com/docker/buildx/bake"
+)
+
+// buildPulls reports whether the build command always pulls its base images (--pull or --pull=true)
+func buildPulls(dockerBuildCmd []string) bool {
+	flags, _ := splitBuildArgs(dockerBuildCmd[min(buildCommandPrefixLen(dockerBuildCmd), len(dockerBuildCmd)):])
+	pulls := false
+	for _, flag := range flags {
+		if flag.name != "--pull" {
+			continue
+		}
+		if !flag.hasValue {
+			pulls = true
+			continue
+		}
+		// an invalid value is reported by docker itself
+		pulls, _ = strconv.ParseBool(flag.value)
+	}
+	return pulls
+}
+
+// targetPulls reports whether the bake target always pulls its base images (pull = true or --pull)
+func targetPulls(target *bake.Target) bool {
+	return target.Pull != nil && *target.Pull
+}
+
+// bakePulls reports whether the bake command always pulls the base images of all its targets (--pull)
+func bakePulls(dockerBakeCmd []string) bool {
+	return slices.Contains(dockerBakeCmd, "--pull")
+}
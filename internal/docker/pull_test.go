@@ -0,0 +1,41 @@
+package docker
+
+import (
+	"testing"
+
+	"github.com/docker/buildx/bake"
+	"github.com/hytromo/mimosa/internal/hasher"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildPulls(t *testing.T) {
+	assert.True(t, buildPulls([]string{"docker", "buildx", "build", "--pull", "-t", "app", "."}))
+	assert.True(t, buildPulls([]string{"docker", "build", "--pull=true", "."}))
+	assert.False(t, buildPulls([]string{"docker", "buildx", "build", "--pull=false", "."}))
+	assert.False(t, buildPulls([]string{"docker", "buildx", "build", "--label", "--pull", "."}), "a flag value is not the flag")
+	assert.False(t, buildPulls([]string{"docker", "buildx", "build", "."}))
+}
+
+func TestTargetPulls(t *testing.T) {
+	pull := true
+	assert.True(t, targetPulls(&bake.Target{Pull: &pull}))
+	assert.False(t, targetPulls(&bake.Target{}))
+	assert.True(t, bakePulls([]string{"docker", "buildx", "bake", "--pull", "app"}))
+}
+
+func TestBaseImageDigests_OnPull(t *testing.T) {
+	forgetResolvedDigests(t)
+	registryHost := startInMemoryRegistry(t)
+	digest := pushFrontend(t, registryHost+"/base:latest")
+	dockerfile := []byte("FROM " + registryHost + "/base:latest\n")
+	hashBaseImagesOnPull := hasher.Options{HashBaseImagesOnPull: true}
+
+	digests, err := baseImageDigests("", dockerfile, nil, nil, hashBaseImagesOnPull, false)
+	require.NoError(t, err)
+	assert.Empty(t, digests, "builds that do not pull keep their base images out of the hash")
+
+	digests, err = baseImageDigests("", dockerfile, nil, nil, hashBaseImagesOnPull, true)
+	require.NoError(t, err)
+	assert.Equal(t, []string{digest}, digests)
+}
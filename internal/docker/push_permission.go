@@ -0,0 +1,47 @@
+package docker
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// CheckPushPermission checks that mimosa can push to the repositories of the new tags, once per repository, so that a
+// cache hit fails fast with an auth error instead of late, halfway through the retags
+func CheckPushPermission(dockerConfigDir string, cacheTagPairsByTarget map[string][]CacheTagPair) error {
+	repositories := []string{}
+	refs := map[string]name.Reference{}
+	for _, pairs := range cacheTagPairsByTarget {
+		for _, pair := range pairs {
+			ref, err := name.ParseReference(pair.NewTag)
+			if err != nil {
+				return fmt.Errorf("invalid tag %s: %w", pair.NewTag, err)
+			}
+			repository := ref.Context().Name()
+			if _, ok := refs[repository]; !ok {
+				repositories = append(repositories, repository)
+				refs[repository] = ref
+			}
+		}
+	}
+	slices.Sort(repositories)
+
+	for _, repository := range repositories {
+		ref, _, err := withRegistryOptions(dockerConfigDir, refs[repository])
+		if err != nil {
+			return err
+		}
+		transport, err := registryTransport(ref.Context().RegistryStr())
+		if err != nil {
+			return err
+		}
+		slog.Debug("Checking push permission", "repository", repository)
+		if err := remote.CheckPushPermission(ref, keychainForConfigDir(dockerConfigDir), transport); err != nil {
+			return fmt.Errorf("no push permission to %s: %w", repository, err)
+		}
+	}
+	return nil
+}
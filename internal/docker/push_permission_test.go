@@ -0,0 +1,43 @@
+package docker
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckPushPermission(t *testing.T) {
+	registryHost := startInMemoryRegistry(t)
+
+	assert.NoError(t, CheckPushPermission("", map[string][]CacheTagPair{
+		"api": {{CacheTag: registryHost + "/org/api:mimosa-content-hash-abc", NewTag: registryHost + "/org/api:v1"}},
+		"web": {{CacheTag: registryHost + "/org/web:mimosa-content-hash-abc", NewTag: registryHost + "/org/web:v1"}},
+	}))
+}
+
+func TestCheckPushPermission_Denied(t *testing.T) {
+	registryHandler := registry.New(registry.Logger(log.New(io.Discard, "", 0)))
+	// a registry that only lets org/api be pushed to
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost && !strings.HasPrefix(r.URL.Path, "/v2/org/api/") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		registryHandler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	registryHost := strings.TrimPrefix(server.URL, "http://")
+
+	err := CheckPushPermission("", map[string][]CacheTagPair{
+		"api": {{CacheTag: registryHost + "/org/api:mimosa-content-hash-abc", NewTag: registryHost + "/org/api:v1"}},
+		"web": {{CacheTag: registryHost + "/org/web:mimosa-content-hash-abc", NewTag: registryHost + "/org/web:v1"}},
+	})
+
+	assert.ErrorContains(t, err, "no push permission to "+registryHost+"/org/web")
+}
@@ -0,0 +1,26 @@
+package docker
+
+import (
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/samber/lo"
+)
+
+// normalizedReference returns the fully qualified form of the reference (e.g. "app" -> "index.docker.io/library/app:latest"),
+// or the reference as is if it cannot be parsed
+func normalizedReference(reference string) string {
+	parsed, err := name.ParseReference(reference)
+	if err != nil {
+		return reference
+	}
+	return parsed.Name()
+}
+
+// MissingReferences returns the expected image references that are not among the found ones, comparing them in their
+// fully qualified form ("org/app:v1" matches "docker.io/org/app:v1")
+func MissingReferences(expected []string, found []string) []string {
+	foundNormalized := lo.Map(found, func(reference string, _ int) string { return normalizedReference(reference) })
+
+	return lo.Filter(lo.Uniq(expected), func(reference string, _ int) bool {
+		return !lo.Contains(foundNormalized, normalizedReference(reference))
+	})
+}
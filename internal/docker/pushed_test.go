@@ -0,0 +1,16 @@
+package docker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMissingReferences(t *testing.T) {
+	expected := []string{"org/app:v1", "app", "ghcr.io/org/app:v1", "localhost:5000/app:v2", "org/app:v1"}
+	found := []string{"docker.io/org/app:v1", "index.docker.io/library/app:latest", "localhost:5000/app:v2"}
+
+	assert.Equal(t, []string{"ghcr.io/org/app:v1"}, MissingReferences(expected, found))
+	assert.Empty(t, MissingReferences(nil, found))
+	assert.Equal(t, []string{"org/app:v1"}, MissingReferences([]string{"org/app:v1"}, nil))
+}
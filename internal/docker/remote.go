@@ -2,6 +2,7 @@ package docker
 
 import (
 	"strings"
+	"sync"
 
 	"log/slog"
 
@@ -9,29 +10,70 @@ import (
 	"github.com/google/go-containerregistry/pkg/v1/remote"
 )
 
-func Get(ref name.Reference, options ...remote.Option) (*remote.Descriptor, error) {
-	return remote.Get(ref, remote.WithAuthFromKeychain(Keychain))
+func Get(dockerConfigDir string, ref name.Reference, options ...remote.Option) (*remote.Descriptor, error) {
+	ref, registryOptions, err := withRegistryOptions(dockerConfigDir, ref)
+	if err != nil {
+		return nil, err
+	}
+	return remote.Get(ref, append(registryOptions, options...)...)
+}
+
+// knownTags keeps whether the tags checked during a run exist, keyed by their full reference, so that the targets of
+// a bake build (or the builds of a batch) that share a cache tag ask the registry only once. The tags that mimosa
+// itself writes or deletes during the run are kept up to date.
+var knownTags = struct {
+	mu     sync.Mutex
+	exists map[string]bool
+}{exists: map[string]bool{}}
+
+// ForgetRegistryState forgets what was learnt from the registries so far (which tags exist, what the images resolve to),
+// so that a new run - e.g. a new sync pass - asks the registries again
+func ForgetRegistryState() {
+	knownTags.mu.Lock()
+	knownTags.exists = map[string]bool{}
+	knownTags.mu.Unlock()
+
+	resolvedDigests.mu.Lock()
+	resolvedDigests.digests = map[string]string{}
+	resolvedDigests.mu.Unlock()
+
+	knownRepositoryTags.mu.Lock()
+	knownRepositoryTags.tags = map[string][]string{}
+	knownRepositoryTags.mu.Unlock()
+}
+
+func rememberTagExists(ref name.Reference, exists bool) {
+	knownTags.mu.Lock()
+	defer knownTags.mu.Unlock()
+	knownTags.exists[ref.Name()] = exists
 }
 
 // TagExists checks if a tag exists in the remote registry
-func TagExists(fullTag string) (bool, error) {
+func TagExists(dockerConfigDir string, fullTag string) (bool, error) {
 	ref, err := name.ParseReference(fullTag)
 	if err != nil {
 		slog.Debug("Failed to parse tag reference", "tag", fullTag, "error", err)
 		return false, err
 	}
 
+	knownTags.mu.Lock()
+	exists, ok := knownTags.exists[ref.Name()]
+	knownTags.mu.Unlock()
+	if ok {
+		slog.Debug("Tag existence already known", "tag", fullTag, "exists", exists)
+		return exists, nil
+	}
+
+	ref, registryOptions, err := withRegistryOptions(dockerConfigDir, ref)
+	if err != nil {
+		return false, err
+	}
+
 	// Use Head instead of Get for a lighter-weight existence check
-	_, err = remote.Head(ref, remote.WithAuthFromKeychain(Keychain))
+	_, err = remote.Head(ref, registryOptions...)
 	if err != nil {
-		// Check if it's a "not found" error by examining the error message
-		// go-containerregistry doesn't expose a specific ErrNotFound type,
-		// but not found errors typically contain "MANIFEST_UNKNOWN" or "not found"
-		errStr := err.Error()
-		if strings.Contains(errStr, "MANIFEST_UNKNOWN") ||
-			strings.Contains(errStr, "not found") ||
-			strings.Contains(errStr, "404") ||
-			strings.Contains(errStr, "NAME_UNKNOWN") {
+		if isNotFoundError(err) {
+			rememberTagExists(ref, false)
 			return false, nil
 		}
 		// Other errors (auth, network, etc.) should be returned
@@ -39,5 +81,58 @@ func TagExists(fullTag string) (bool, error) {
 		return false, err
 	}
 
+	rememberTagExists(ref, true)
 	return true, nil
 }
+
+// isNotFoundError checks if the registry error means that the tag/manifest does not exist
+func isNotFoundError(err error) bool {
+	// go-containerregistry doesn't expose a specific ErrNotFound type,
+	// but not found errors typically contain "MANIFEST_UNKNOWN" or "not found"
+	errStr := err.Error()
+	return strings.Contains(errStr, "MANIFEST_UNKNOWN") ||
+		strings.Contains(errStr, "not found") ||
+		strings.Contains(errStr, "404") ||
+		strings.Contains(errStr, "NAME_UNKNOWN")
+}
+
+// knownRepositoryTags keeps the tags of the repositories listed during a run, keyed by the repository
+var knownRepositoryTags = struct {
+	mu   sync.Mutex
+	tags map[string][]string
+}{tags: map[string][]string{}}
+
+// ListTags returns the tags of the repository (registry/image), listing them only the first time it is asked for during
+// a run - a repository that does not exist yet has no tags
+func ListTags(dockerConfigDir string, repository string) ([]string, error) {
+	repo, err := name.NewRepository(repository)
+	if err != nil {
+		return nil, err
+	}
+
+	knownRepositoryTags.mu.Lock()
+	tags, ok := knownRepositoryTags.tags[repo.Name()]
+	knownRepositoryTags.mu.Unlock()
+	if ok {
+		return tags, nil
+	}
+
+	// the options of the registry (insecure registries, transport) are picked by reference
+	ref, registryOptions, err := withRegistryOptions(dockerConfigDir, repo.Tag("latest"))
+	if err != nil {
+		return nil, err
+	}
+	tags, err = remote.List(ref.Context(), registryOptions...)
+	if err != nil {
+		if !isNotFoundError(err) {
+			slog.Debug("Error listing tags", "repository", repository, "error", err)
+			return nil, err
+		}
+		tags = []string{}
+	}
+
+	knownRepositoryTags.mu.Lock()
+	knownRepositoryTags.tags[repo.Name()] = tags
+	knownRepositoryTags.mu.Unlock()
+	return tags, nil
+}
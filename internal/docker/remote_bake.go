@@ -0,0 +1,87 @@
+package docker
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/hytromo/mimosa/internal/utils/tempdir"
+	"github.com/moby/buildkit/util/gitutil"
+)
+
+const bakeCwdPrefix = "cwd://"
+
+// checkoutRemoteBakeDefinition checks out the git repository of a remote bake definition, e.g.
+// "https://github.com/org/repo.git#main:subdir", to a temp dir, so that its bake files and the contexts of its
+// targets are hashed like local ones - it returns the dir of the definition (the subdir of the checkout) and a
+// function that removes the checkout
+func checkoutRemoteBakeDefinition(definitionURL string) (dir string, cleanup func(), err error) {
+	gitRef, err := gitutil.ParseGitRef(definitionURL)
+	if err != nil {
+		return "", nil, fmt.Errorf("only git repositories are supported as remote bake definitions, got: %s", definitionURL)
+	}
+	remote := gitRef.Remote
+	if gitRef.IndistinguishableFromLocal {
+		remote = "https://" + remote
+	}
+	ref := gitRef.Commit
+	if ref == "" {
+		ref = "HEAD"
+	}
+
+	checkoutDir, err := tempdir.MkdirTemp("bake-*")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup = func() {
+		if err := os.RemoveAll(checkoutDir); err != nil {
+			slog.Debug("Failed to remove the checkout of the remote bake definition", "dir", checkoutDir, "error", err)
+		}
+	}
+
+	// fetching the ref works for branches, tags and commits alike, unlike clone --branch
+	for _, gitArgs := range [][]string{
+		{"init", "--quiet"},
+		{"fetch", "--quiet", "--depth", "1", remote, ref},
+		{"checkout", "--quiet", "FETCH_HEAD"},
+	} {
+		output, err := exec.Command("git", append([]string{"-C", checkoutDir}, gitArgs...)...).CombinedOutput()
+		if err != nil {
+			cleanup()
+			return "", nil, fmt.Errorf("failed to check out the remote bake definition %s (git %s): %w: %s", definitionURL, gitArgs[0], err, strings.TrimSpace(string(output)))
+		}
+	}
+
+	if commit, err := exec.Command("git", "-C", checkoutDir, "rev-parse", "HEAD").Output(); err == nil {
+		slog.Debug("Checked out the remote bake definition", "url", definitionURL, "commit", strings.TrimSpace(string(commit)))
+	}
+	// buildkit does not keep the .git dir of git contexts - and its files change with every checkout
+	if err := os.RemoveAll(filepath.Join(checkoutDir, ".git")); err != nil {
+		cleanup()
+		return "", nil, err
+	}
+
+	return filepath.Join(checkoutDir, gitRef.SubDir), cleanup, nil
+}
+
+// remoteBakeFiles resolves the bake files of a remote definition like buildx does: the files of the command are read
+// from the repository, unless they are prefixed with "cwd://" - and when only local files are given, the default bake
+// files of the repository are read before them
+func remoteBakeFiles(definitionDir string, bakeFiles []string) []string {
+	remoteFiles, localFiles := []string{}, []string{}
+	for _, file := range bakeFiles {
+		if localFile, ok := strings.CutPrefix(file, bakeCwdPrefix); ok {
+			localFiles = append(localFiles, localFile)
+		} else {
+			remoteFiles = append(remoteFiles, filepath.Join(definitionDir, file))
+		}
+	}
+
+	if len(remoteFiles) == 0 {
+		remoteFiles = defaultBakeFiles(definitionDir)
+	}
+	return append(remoteFiles, localFiles...)
+}
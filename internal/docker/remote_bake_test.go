@@ -0,0 +1,117 @@
+package docker
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hytromo/mimosa/internal/hasher"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const remoteBakeRepository = "https://git.example.com/org/app.git"
+
+// useRemoteBakeRepository creates a git repository with a bake definition, and makes git fetch remoteBakeRepository from it
+func useRemoteBakeRepository(t *testing.T) (repository string, git func(args ...string) string) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	repository = t.TempDir()
+	git = func(args ...string) string {
+		t.Helper()
+		output, err := exec.Command("git", append([]string{"-C", repository, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...).CombinedOutput()
+		require.NoError(t, err, string(output))
+		return strings.TrimSpace(string(output))
+	}
+
+	git("init", "-q", "-b", "main")
+	files := map[string]string{
+		"docker-bake.hcl": `target "app" {
+  context = "services/app"
+  tags = ["myreg/app:v1"]
+}`,
+		".dockerignore":           ".git",
+		"services/app/Dockerfile": "FROM alpine\nCOPY . .",
+		"services/app/main.go":    "package main",
+	}
+	for path, content := range files {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(repository, path)), 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(repository, path), []byte(content), 0o644))
+	}
+	git("add", ".")
+	git("commit", "-q", "-m", "app")
+
+	t.Setenv("GIT_CONFIG_COUNT", "1")
+	t.Setenv("GIT_CONFIG_KEY_0", "url.file://"+repository+".insteadOf")
+	t.Setenv("GIT_CONFIG_VALUE_0", remoteBakeRepository)
+	return repository, git
+}
+
+func TestParseBakeCommand_RemoteDefinition(t *testing.T) {
+	repository, git := useRemoteBakeRepository(t)
+	firstCommit := git("rev-parse", "HEAD")
+	t.Chdir(t.TempDir())
+
+	remote, err := ParseBakeCommand([]string{"docker", "buildx", "bake", "--push", remoteBakeRepository + "#main", "app"}, hasher.Options{}, "")
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]string{"app": {"myreg/app:v1"}}, remote.TagsByTarget)
+
+	t.Chdir(repository)
+	local, err := ParseBakeCommand([]string{"docker", "buildx", "bake", "--push", "app"}, hasher.Options{}, "")
+	require.NoError(t, err)
+	assert.Equal(t, local.Hash, remote.Hash, "the remote definition hashes like the same local checkout")
+
+	require.NoError(t, os.WriteFile(filepath.Join(repository, "services/app/main.go"), []byte("package main // changed"), 0o644))
+	git("commit", "-q", "-am", "change")
+	t.Chdir(t.TempDir())
+
+	changed, err := ParseBakeCommand([]string{"docker", "buildx", "bake", "--push", remoteBakeRepository + "#main", "app"}, hasher.Options{}, "")
+	require.NoError(t, err)
+	assert.NotEqual(t, remote.Hash, changed.Hash, "the files of the context at the ref are hashed")
+
+	pinned, err := ParseBakeCommand([]string{"docker", "buildx", "bake", "--push", remoteBakeRepository + "#" + firstCommit, "app"}, hasher.Options{}, "")
+	require.NoError(t, err)
+	assert.Equal(t, remote.Hash, pinned.Hash)
+}
+
+func TestParseBakeCommand_RemoteDefinitionErrors(t *testing.T) {
+	useRemoteBakeRepository(t)
+	t.Chdir(t.TempDir())
+
+	_, err := ParseBakeCommand([]string{"docker", "buildx", "bake", remoteBakeRepository + "#no-such-branch", "app"}, hasher.Options{}, "")
+	assert.ErrorContains(t, err, "failed to check out the remote bake definition")
+
+	_, err = ParseBakeCommand([]string{"docker", "buildx", "bake", "https://example.com/bake.tar.gz", "app"}, hasher.Options{}, "")
+	assert.ErrorContains(t, err, "only git repositories are supported")
+
+	_, err = ParseBakeCommand([]string{"docker", "buildx", "bake", remoteBakeRepository, "app"}, hasher.Options{BakePlan: "plan.json"}, "")
+	assert.ErrorContains(t, err, "--bake-plan cannot be used")
+}
+
+func TestExtractBakeFlags_RemoteDefinition(t *testing.T) {
+	files, targets, _, definitionURL, err := extractBakeFlags([]string{"bake", "-f", "cwd://local.hcl", remoteBakeRepository + "#main", "app"})
+	require.NoError(t, err)
+	assert.Equal(t, remoteBakeRepository+"#main", definitionURL)
+	assert.Equal(t, []string{"cwd://local.hcl"}, files)
+	assert.Equal(t, []string{"app"}, targets)
+
+	_, targets, _, definitionURL, err = extractBakeFlags([]string{"bake", remoteBakeRepository})
+	require.NoError(t, err)
+	assert.Equal(t, remoteBakeRepository, definitionURL)
+	assert.Equal(t, []string{"default"}, targets)
+}
+
+func TestRemoteBakeFiles(t *testing.T) {
+	definitionDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(definitionDir, "docker-bake.hcl"), []byte(""), 0o644))
+
+	assert.Equal(t, []string{filepath.Join(definitionDir, "ci.hcl"), "local.hcl"}, remoteBakeFiles(definitionDir, []string{"ci.hcl", "cwd://local.hcl"}))
+	assert.Equal(t, []string{filepath.Join(definitionDir, "docker-bake.hcl"), "local.hcl"}, remoteBakeFiles(definitionDir, []string{"cwd://local.hcl"}),
+		"the default files of the repository are read when only local files are given")
+	assert.Equal(t, []string{filepath.Join(definitionDir, "docker-bake.hcl")}, remoteBakeFiles(definitionDir, nil))
+}
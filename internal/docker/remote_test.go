@@ -3,8 +3,11 @@ package docker
 import (
 	"fmt"
 	"math/rand/v2"
+	"net/http"
 	"testing"
 
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
 	"github.com/hytromo/mimosa/internal/testutils"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -14,7 +17,7 @@ func TestTagExists_ExistingTag(t *testing.T) {
 	testID := rand.IntN(10000000000)
 	imageTag := testutils.CreateTestImage(t, fmt.Sprintf("testapp-%d", testID), "v1.0.0")
 
-	exists, err := TagExists(imageTag)
+	exists, err := TagExists("", imageTag)
 	require.NoError(t, err)
 	assert.True(t, exists, "Tag should exist: %s", imageTag)
 }
@@ -23,7 +26,7 @@ func TestTagExists_NonExistentTag(t *testing.T) {
 	testID := rand.IntN(10000000000)
 	nonExistentTag := fmt.Sprintf("localhost:5000/nonexistent-image-%d:tag", testID)
 
-	exists, err := TagExists(nonExistentTag)
+	exists, err := TagExists("", nonExistentTag)
 	require.NoError(t, err)
 	assert.False(t, exists, "Tag should not exist: %s", nonExistentTag)
 }
@@ -38,7 +41,7 @@ func TestTagExists_NonExistentTagInExistingRepo(t *testing.T) {
 	// Check for a tag that doesn't exist in the same repo
 	nonExistentTag := fmt.Sprintf("localhost:5000/%s:nonexistent-%d", imageName, testID)
 
-	exists, err := TagExists(nonExistentTag)
+	exists, err := TagExists("", nonExistentTag)
 	require.NoError(t, err)
 	assert.False(t, exists, "Tag should not exist: %s", nonExistentTag)
 }
@@ -47,14 +50,14 @@ func TestTagExists_InvalidTagFormat_TooManyColons(t *testing.T) {
 	// This is genuinely invalid - go-containerregistry will fail to parse it
 	invalidTag := "invalid:tag:format:too:many:colons"
 
-	exists, err := TagExists(invalidTag)
+	exists, err := TagExists("", invalidTag)
 	assert.Error(t, err)
 	assert.False(t, exists)
 }
 
 func TestTagExists_InvalidTagFormat_EmptyString(t *testing.T) {
 	// Empty string is invalid
-	exists, err := TagExists("")
+	exists, err := TagExists("", "")
 	assert.Error(t, err)
 	assert.False(t, exists)
 }
@@ -67,7 +70,43 @@ func TestTagExists_AfterImageDeletion(t *testing.T) {
 	imageTag := testutils.CreateTestImage(t, imageName, "v1.0.0")
 
 	// Verify it exists
-	exists, err := TagExists(imageTag)
+	exists, err := TagExists("", imageTag)
 	require.NoError(t, err)
 	assert.True(t, exists, "Tag should exist after creation: %s", imageTag)
 }
+
+func TestTagExists_RemembersTheResultDuringTheRun(t *testing.T) {
+	t.Cleanup(ForgetRegistryState)
+	registryHost, requests := startCountingRegistry(t)
+
+	cacheTag := registryHost + "/app:" + CacheTagPrefix + "abc123"
+	newTag := registryHost + "/app:v1"
+	image, err := random.Image(64, 1)
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(parseTestReference(t, cacheTag), image))
+	requests.reset()
+
+	for range 3 {
+		exists, err := TagExists("", cacheTag)
+		require.NoError(t, err)
+		assert.True(t, exists)
+		exists, err = TagExists("", newTag)
+		require.NoError(t, err)
+		assert.False(t, exists)
+	}
+	assert.Equal(t, 2, requests.count(http.MethodHead))
+
+	// the tags written by mimosa are known to exist without asking again
+	require.NoError(t, RetagSingleTag("", cacheTag, newTag, false))
+	exists, err := TagExists("", newTag)
+	require.NoError(t, err)
+	assert.True(t, exists)
+	assert.Equal(t, 2, requests.count(http.MethodHead))
+
+	// a new run asks the registry again
+	ForgetRegistryState()
+	exists, err = TagExists("", cacheTag)
+	require.NoError(t, err)
+	assert.True(t, exists)
+	assert.Equal(t, 3, requests.count(http.MethodHead))
+}
@@ -3,70 +3,208 @@ package docker
 import (
 	"errors"
 	"fmt"
+	"strings"
 	"sync"
 
 	"log/slog"
 
 	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/hytromo/mimosa/internal/logger"
+	"github.com/hytromo/mimosa/internal/reporting"
 	"github.com/hytromo/mimosa/internal/utils/dockerutil"
 )
 
-func RetagSingleTag(fromTag string, toTag string, dryRun bool) error {
-	fromRef, err := dockerutil.ParseTag(fromTag)
+// CacheTagPrefix is the prefix of the tags that mimosa saves in the registry - the hash follows it
+const CacheTagPrefix = "mimosa-content-hash-"
+
+const (
+	// the annotations added to the retagged indexes/images when retag annotations are enabled
+	CacheHashAnnotation   = "io.mimosa/cache-hash"
+	OriginalTagAnnotation = "io.mimosa/original-tag"
+)
+
+var retagAnnotations = false
+
+// SetRetagAnnotations enables annotating the indexes/images retagged from the cache with their cache lineage
+func SetRetagAnnotations(enabled bool) {
+	retagAnnotations = enabled
+}
+
+// cacheLineageAnnotations returns the annotations that document which cache tag the new tag was retagged from
+func cacheLineageAnnotations(cacheTag string) map[string]string {
+	annotations := map[string]string{OriginalTagAnnotation: cacheTag}
+	if parsed, err := dockerutil.ParseTag(cacheTag); err == nil && strings.HasPrefix(parsed.Tag, cacheTagPrefix) {
+		// the repository key and the cache scope, if any, follow the hash: mimosa-content-hash-<hash>-<scope>
+		hash, _, _ := strings.Cut(strings.TrimPrefix(parsed.Tag, cacheTagPrefix), "-")
+		annotations[CacheHashAnnotation] = hash
+	}
+	return annotations
+}
+
+// writeAnnotated republishes the index/image of the descriptor under the destination tag with the given annotations.
+// Only the top-level manifest changes (and thus its digest) - the platform manifests and the layers are reused as is,
+// and mounted from the source repository when the destination is another repository of the same registry. Without
+// annotations the index/image is copied as is, keeping its digest.
+func writeAnnotated(dstTag name.Tag, desc *remote.Descriptor, annotations map[string]string, options []remote.Option) error {
+	if desc.MediaType.IsIndex() {
+		index, err := desc.ImageIndex()
+		if err != nil {
+			return err
+		}
+		if len(annotations) == 0 {
+			return remote.WriteIndex(dstTag, index, options...)
+		}
+		annotatedIndex, ok := mutate.Annotations(index, annotations).(v1.ImageIndex)
+		if !ok {
+			return fmt.Errorf("failed to annotate index %s", desc.Digest)
+		}
+		return remote.WriteIndex(dstTag, annotatedIndex, options...)
+	}
+
+	image, err := desc.Image()
 	if err != nil {
 		return err
 	}
+	if len(annotations) == 0 {
+		return remote.Write(dstTag, image, options...)
+	}
+	annotatedImage, ok := mutate.Annotations(image, annotations).(v1.Image)
+	if !ok {
+		return fmt.Errorf("failed to annotate image %s", desc.Digest)
+	}
+	return remote.Write(dstTag, annotatedImage, options...)
+}
+
+func RetagSingleTag(dockerConfigDir string, fromTag string, toTag string, dryRun bool) error {
+	return retagSingleTag(dockerConfigDir, fromTag, toTag, dryRun, nil)
+}
+
+// retagOperation is a retag from a cache tag to a new tag, whose source descriptor has already been fetched
+type retagOperation struct {
+	fromTag  string
+	toTag    string
+	fromDesc *remote.Descriptor
+	dstTag   name.Tag
+	session  *retagSession
+	// the new tag is in another repository, which does not have the manifests and the blobs of the source yet
+	crossRepository bool
+	// what the new tag pointed to before the retag (nil if it did not exist) - only fetched when rollback is enabled
+	previousDesc *remote.Descriptor
+}
+
+// prepareRetag validates the retag and fetches the descriptor of the source tag (once per session), without writing anything
+func prepareRetag(session *retagSession, fromTag string, toTag string) (retagOperation, error) {
+	fromRef, err := dockerutil.ParseTag(fromTag)
+	if err != nil {
+		return retagOperation{}, err
+	}
 	toRef, err := dockerutil.ParseTag(toTag)
 	if err != nil {
-		return err
+		return retagOperation{}, err
 	}
 
-	// Retagging MUST be within the same repository
-	if fromRef.Registry != toRef.Registry || fromRef.ImageName != toRef.ImageName {
-		return fmt.Errorf("retagging across repositories is not supported: %s -> %s", fromTag, toTag)
+	// Retagging MUST be within the same repository - unless it is to or from the dedicated cache repository
+	crossRepository := fromRef.Registry != toRef.Registry || fromRef.ImageName != toRef.ImageName
+	if crossRepository && !isCacheRepository(fromRef.Registry, fromRef.ImageName) && !isCacheRepository(toRef.Registry, toRef.ImageName) {
+		return retagOperation{}, fmt.Errorf("retagging across repositories is not supported: %s -> %s", fromTag, toTag)
 	}
 
 	// Fetch the descriptor from the remote registry
-	fromDesc, err := Get(fromRef.Ref)
+	fromDesc, err := session.descriptor(fromTag, fromRef.Ref)
 	if err != nil {
 		slog.Debug("Failed to get descriptor", "fromTag", fromTag, "error", err)
-		return fmt.Errorf("failed to get descriptor: %w", err)
+		return retagOperation{}, fmt.Errorf("failed to get descriptor: %w", err)
 	}
 
-	// If dry run, just return success without doing anything
-	if dryRun {
-		slog.Debug("DRY RUN: Would retag", "fromTag", fromTag, "toTag", toTag)
-		return nil
+	dstTag, err := name.NewTag(toTag)
+	if err != nil {
+		slog.Debug("Failed to parse destination as tag", "toTag", toTag, "error", err)
+		return retagOperation{}, fmt.Errorf("failed to parse destination tag: %w", err)
+	}
+
+	op := retagOperation{fromTag: fromTag, toTag: toTag, fromDesc: fromDesc, dstTag: dstTag, session: session, crossRepository: crossRepository}
+	if retagRollback {
+		if op.previousDesc, err = previousDescriptor(session.dockerConfigDir, dstTag); err != nil {
+			return retagOperation{}, err
+		}
 	}
 
+	return op, nil
+}
+
+// write points the new tag to the source descriptor
+func (op retagOperation) write(annotations map[string]string) error {
 	// Use descriptor-based tagging: since source and destination are in the same
 	// repository, the registry already has all blobs/manifests. We just point
 	// the new tag at the existing descriptor (works for both images and indexes).
-	dstTag, err := name.NewTag(toTag)
+	dstRef, registryOptions, err := withRegistryOptions(op.session.dockerConfigDir, op.dstTag)
 	if err != nil {
-		slog.Debug("Failed to parse destination as tag", "toTag", toTag, "error", err)
-		return fmt.Errorf("failed to parse destination tag: %w", err)
+		return err
+	}
+	if registryOptions, err = op.session.writeOptions(dstRef, registryOptions); err != nil {
+		return err
 	}
 
-	if err := remote.Tag(dstTag, fromDesc, remote.WithAuthFromKeychain(Keychain)); err != nil {
-		slog.Debug("Failed to tag descriptor", "fromTag", fromTag, "toTag", toTag, "error", err)
-		return fmt.Errorf("failed to tag %s -> %s: %w", fromTag, toTag, err)
+	if len(annotations) > 0 || op.crossRepository {
+		if err := writeAnnotated(dstRef.(name.Tag), op.fromDesc, annotations, registryOptions); err != nil {
+			slog.Debug("Failed to write descriptor", "fromTag", op.fromTag, "toTag", op.toTag, "error", err)
+			if len(annotations) == 0 {
+				return fmt.Errorf("failed to copy %s -> %s: %w", op.fromTag, op.toTag, err)
+			}
+			return fmt.Errorf("failed to tag %s -> %s with annotations: %w", op.fromTag, op.toTag, err)
+		}
+		rememberTagExists(dstRef, true)
+		op.audit(annotations)
+		return nil
+	}
+
+	if err := remote.Tag(dstRef.(name.Tag), op.fromDesc, registryOptions...); err != nil {
+		slog.Debug("Failed to tag descriptor", "fromTag", op.fromTag, "toTag", op.toTag, "error", err)
+		return fmt.Errorf("failed to tag %s -> %s: %w", op.fromTag, op.toTag, err)
 	}
 
+	rememberTagExists(dstRef, true)
+	op.audit(annotations)
 	return nil
 }
 
-// CacheTagPair represents a pair of cache tag and new tag (always in the same repository)
+// audit records the written new tag in the audit log
+func (op retagOperation) audit(annotations map[string]string) {
+	reporting.Audit(reporting.AuditRetag, "from", op.fromTag, "to", op.toTag, "digest", op.fromDesc.Digest.String(), "crossRepository", op.crossRepository, "annotations", annotations)
+}
+
+// retagSingleTag points toTag to the same index/image as fromTag - if annotations are given, the index/image
+// is republished with them instead
+func retagSingleTag(dockerConfigDir string, fromTag string, toTag string, dryRun bool, annotations map[string]string) error {
+	op, err := prepareRetag(newRetagSession(dockerConfigDir), fromTag, toTag)
+	if err != nil {
+		return err
+	}
+
+	// If dry run, just return success without doing anything
+	if dryRun {
+		slog.Debug("DRY RUN: Would retag", "fromTag", fromTag, "toTag", toTag)
+		return nil
+	}
+
+	return op.write(annotations)
+}
+
+// CacheTagPair represents a pair of cache tag and new tag (in the same repository, unless the cache tag is in the
+// dedicated --cache-repository)
 type CacheTagPair struct {
 	CacheTag string
 	NewTag   string
 }
 
 // Retag creates new tags from cache tags.
-// Each CacheTagPair contains a cache tag and its corresponding new tag - both MUST be in the same repository.
+// Each CacheTagPair contains a cache tag and its corresponding new tag - both MUST be in the same repository, unless
+// one of them is in the dedicated --cache-repository.
 // cacheTagPairsByTarget maps target name -> list of (cacheTag, newTag) pairs
-func Retag(cacheTagPairsByTarget map[string][]CacheTagPair, dryRun bool) error {
+func Retag(dockerConfigDir string, cacheTagPairsByTarget map[string][]CacheTagPair, dryRun bool) error {
 	if len(cacheTagPairsByTarget) == 0 {
 		return fmt.Errorf("no cache tag pairs provided")
 	}
@@ -84,48 +222,81 @@ func Retag(cacheTagPairsByTarget map[string][]CacheTagPair, dryRun bool) error {
 
 	slog.Info("Retagging from cache", "targets", len(cacheTagPairsByTarget), "totalOperations", nWorkers)
 
-	var wg sync.WaitGroup
-	wg.Add(nWorkers)
-
-	// Create error channel to collect errors from workers
+	// 1. fetch all the cache tags first: if any of them is gone, the retag fails before any new tag is written,
+	// so that a multi-target build is never left half-retagged
+	session := newRetagSession(dockerConfigDir)
+	operations := make(chan retagOperation, nWorkers)
 	errChan := make(chan error, nWorkers)
-
-	// Worker function - retag within the same repository
-	worker := func(fromTag string, toTag string) {
-		defer wg.Done()
-		if fromTag == toTag {
-			slog.Info("Skipping retagging to itself", "tag", fromTag)
-			return
-		}
-		slog.Info("Retagging", "from", fromTag, "to", toTag)
-		if err := RetagSingleTag(fromTag, toTag, dryRun); err != nil {
-			errChan <- fmt.Errorf("failed to retag %s -> %s: %w", fromTag, toTag, err)
-		}
-	}
-
-	// Launch workers - each pair is cache tag -> new tag in the SAME repository
+	var wg sync.WaitGroup
 	for target, pairs := range cacheTagPairsByTarget {
 		for _, pair := range pairs {
-			slog.Debug("Starting retag worker", "target", target, "from", pair.CacheTag, "to", pair.NewTag)
-			go worker(pair.CacheTag, pair.NewTag)
+			if pair.CacheTag == pair.NewTag {
+				slog.Info("Skipping retagging to itself", "tag", pair.CacheTag)
+				continue
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				slog.Debug("Checking cache tag before retagging", "target", target, "from", pair.CacheTag, "to", pair.NewTag)
+				op, err := prepareRetag(session, pair.CacheTag, pair.NewTag)
+				if err != nil {
+					errChan <- fmt.Errorf("failed to retag %s -> %s: %w", pair.CacheTag, pair.NewTag, err)
+					return
+				}
+				operations <- op
+			}()
 		}
 	}
+	wg.Wait()
+	close(operations)
+	close(errChan)
 
-	// Wait for all workers to complete
+	if allErrs := collectErrors(errChan); len(allErrs) > 0 {
+		return errors.Join(allErrs...)
+	}
+
+	// 2. write the new tags - each one is cache tag -> new tag in the SAME repository
+	errChan = make(chan error, nWorkers)
+	var writtenMu sync.Mutex
+	var written []retagOperation
+	for op := range operations {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			slog.Info("Retagging", "from", op.fromTag, "to", op.toTag)
+			logger.Progress.Phase("retagging %s", op.toTag)
+			var annotations map[string]string
+			if retagAnnotations {
+				annotations = cacheLineageAnnotations(op.fromTag)
+			}
+			if err := op.write(annotations); err != nil {
+				errChan <- err
+				return
+			}
+			writtenMu.Lock()
+			written = append(written, op)
+			writtenMu.Unlock()
+		}()
+	}
 	wg.Wait()
 	close(errChan)
 
-	// Check for any errors
+	if allErrs := collectErrors(errChan); len(allErrs) > 0 {
+		if len(written) > 0 {
+			allErrs = append(allErrs, handlePartialRetag(written))
+		}
+		return errors.Join(allErrs...)
+	}
+
+	return nil
+}
+
+func collectErrors(errChan <-chan error) []error {
 	var allErrs []error
 	for err := range errChan {
 		if err != nil {
 			allErrs = append(allErrs, err)
 		}
 	}
-
-	if len(allErrs) > 0 {
-		return errors.Join(allErrs...)
-	}
-
-	return nil
+	return allErrs
 }
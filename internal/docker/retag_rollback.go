@@ -0,0 +1,81 @@
+package docker
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/hytromo/mimosa/internal/reporting"
+	"github.com/samber/lo"
+)
+
+var retagRollback = false
+
+// SetRetagRollback enables restoring the tags written by a retag that failed for some of its tags, so that
+// a multi-target build does not end up with only some of its tags pointing to the new image
+func SetRetagRollback(enabled bool) {
+	retagRollback = enabled
+}
+
+// previousDescriptor returns what the tag currently points to, or nil if it does not exist
+func previousDescriptor(dockerConfigDir string, tag name.Tag) (*remote.Descriptor, error) {
+	desc, err := Get(dockerConfigDir, tag)
+	if err != nil {
+		if isNotFoundError(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get the current %s to be able to roll back: %w", tag, err)
+	}
+	return desc, nil
+}
+
+// handlePartialRetag reports the tags that were written by a retag that failed for other tags and,
+// when rollback is enabled, points them back to what they were before (or deletes them if they are new)
+func handlePartialRetag(written []retagOperation) error {
+	writtenTags := lo.Map(written, func(op retagOperation, _ int) string { return op.toTag })
+
+	if !retagRollback {
+		return fmt.Errorf("retag partially failed, these tags were written: %s", strings.Join(writtenTags, ", "))
+	}
+
+	slog.Warn("Retag partially failed, rolling back the written tags", "tags", writtenTags)
+	var rollbackErrs []error
+	for _, op := range written {
+		if err := op.rollback(); err != nil {
+			slog.Debug("Failed to roll back tag", "tag", op.toTag, "error", err)
+			rollbackErrs = append(rollbackErrs, fmt.Errorf("failed to roll back %s: %w", op.toTag, err))
+		}
+	}
+
+	if len(rollbackErrs) > 0 {
+		return errors.Join(append([]error{errors.New("retag partially failed and could not be fully rolled back")}, rollbackErrs...)...)
+	}
+
+	return fmt.Errorf("retag partially failed, these tags were rolled back: %s", strings.Join(writtenTags, ", "))
+}
+
+// rollback points the new tag back to its previous descriptor, or deletes it if it did not exist before the retag
+func (op retagOperation) rollback() error {
+	dstRef, registryOptions, err := withRegistryOptions(op.session.dockerConfigDir, op.dstTag)
+	if err != nil {
+		return err
+	}
+
+	if op.previousDesc == nil {
+		if err := remote.Delete(dstRef, registryOptions...); err != nil {
+			return err
+		}
+		rememberTagExists(dstRef, false)
+		reporting.Audit(reporting.AuditTagDeleted, "tag", op.toTag, "reason", "rollback")
+		return nil
+	}
+
+	if err := remote.Tag(dstRef.(name.Tag), op.previousDesc, registryOptions...); err != nil {
+		return err
+	}
+	reporting.Audit(reporting.AuditTagRestored, "tag", op.toTag, "digest", op.previousDesc.Digest.String(), "reason", "rollback")
+	return nil
+}
@@ -0,0 +1,117 @@
+package docker
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startRegistryRejectingTag starts a throwaway registry that refuses to write manifests under the given tag
+func startRegistryRejectingTag(t *testing.T, tag string) string {
+	t.Helper()
+	registryHandler := registry.New(registry.Logger(log.New(io.Discard, "", 0)))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut && strings.HasSuffix(r.URL.Path, "/manifests/"+tag) {
+			http.Error(w, "denied", http.StatusForbidden)
+			return
+		}
+		registryHandler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return strings.TrimPrefix(server.URL, "http://")
+}
+
+func useRetagRollback(t *testing.T) {
+	t.Helper()
+	SetRetagRollback(true)
+	t.Cleanup(func() {
+		SetRetagRollback(false)
+	})
+}
+
+// partialRetagFixture pushes a cache tag and an older image under app:v1, and returns the retag pairs,
+// of which the worker one fails to be written
+func partialRetagFixture(t *testing.T, registryHost string) (map[string][]CacheTagPair, v1.Hash) {
+	t.Helper()
+	cacheTag := registryHost + "/app:" + CacheTagPrefix + "abc123"
+	workerCacheTag := registryHost + "/worker:" + CacheTagPrefix + "abc123"
+
+	for _, tag := range []string{cacheTag, workerCacheTag} {
+		image, err := random.Image(64, 1)
+		require.NoError(t, err)
+		require.NoError(t, remote.Write(parseTestReference(t, tag), image))
+	}
+
+	oldImage, err := random.Image(64, 1)
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(parseTestReference(t, registryHost+"/app:v1"), oldImage))
+	oldDigest, err := oldImage.Digest()
+	require.NoError(t, err)
+
+	return map[string][]CacheTagPair{
+		"app": {
+			{CacheTag: cacheTag, NewTag: registryHost + "/app:v1"},
+			{CacheTag: cacheTag, NewTag: registryHost + "/app:v3"},
+		},
+		"worker": {{CacheTag: workerCacheTag, NewTag: registryHost + "/worker:blocked"}},
+	}, oldDigest
+}
+
+func TestRetag_PartialFailureReportsWrittenTags(t *testing.T) {
+	registryHost := startRegistryRejectingTag(t, "blocked")
+	cacheTagPairs, oldDigest := partialRetagFixture(t, registryHost)
+
+	err := Retag("", cacheTagPairs, false)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "these tags were written")
+	assert.Contains(t, err.Error(), registryHost+"/app:v1")
+	assert.Contains(t, err.Error(), registryHost+"/app:v3")
+
+	// without rollback the written tags are left as is
+	desc, err := remote.Get(parseTestReference(t, registryHost+"/app:v1"))
+	require.NoError(t, err)
+	assert.NotEqual(t, oldDigest, desc.Digest)
+}
+
+func TestRetag_PartialFailureRollsBack(t *testing.T) {
+	useRetagRollback(t)
+	registryHost := startRegistryRejectingTag(t, "blocked")
+	cacheTagPairs, oldDigest := partialRetagFixture(t, registryHost)
+
+	err := Retag("", cacheTagPairs, false)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "these tags were rolled back")
+
+	// the existing tag points to its previous image again
+	desc, err := remote.Get(parseTestReference(t, registryHost+"/app:v1"))
+	require.NoError(t, err)
+	assert.Equal(t, oldDigest, desc.Digest)
+
+	// the new tag is deleted
+	exists, err := TagExists("", registryHost+"/app:v3")
+	require.NoError(t, err)
+	assert.False(t, exists)
+}
+
+func TestRetag_RollbackEnabledSucceeds(t *testing.T) {
+	useRetagRollback(t)
+	registryHost := startInMemoryRegistry(t)
+	cacheTagPairs, oldDigest := partialRetagFixture(t, registryHost)
+	delete(cacheTagPairs, "worker")
+
+	require.NoError(t, Retag("", cacheTagPairs, false))
+
+	desc, err := remote.Get(parseTestReference(t, registryHost+"/app:v1"))
+	require.NoError(t, err)
+	assert.NotEqual(t, oldDigest, desc.Digest)
+}
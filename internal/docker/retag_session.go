@@ -0,0 +1,68 @@
+package docker
+
+import (
+	"sync"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// retagSession is shared by all the retags of a single Retag call, so that retagging to many new tags stays cheap:
+// the descriptor of each cache tag is fetched once no matter how many new tags point to it, and all the manifest PUTs
+// to a registry go through the same pusher, reusing its token and connections instead of authenticating per tag
+type retagSession struct {
+	// the docker config dir of the command, whose credentials the retags use
+	dockerConfigDir string
+	mu              sync.Mutex
+	descriptors     map[string]*descriptorFetch
+	pushers         map[string]*remote.Pusher
+}
+
+// descriptorFetch is the (single) fetch of the descriptor of a cache tag
+type descriptorFetch struct {
+	once sync.Once
+	desc *remote.Descriptor
+	err  error
+}
+
+func newRetagSession(dockerConfigDir string) *retagSession {
+	return &retagSession{
+		dockerConfigDir: dockerConfigDir,
+		descriptors:     map[string]*descriptorFetch{},
+		pushers:         map[string]*remote.Pusher{},
+	}
+}
+
+// descriptor returns the descriptor of the cache tag, fetching it only the first time it is asked for
+func (s *retagSession) descriptor(fromTag string, ref name.Reference) (*remote.Descriptor, error) {
+	s.mu.Lock()
+	fetch, ok := s.descriptors[fromTag]
+	if !ok {
+		fetch = &descriptorFetch{}
+		s.descriptors[fromTag] = fetch
+	}
+	s.mu.Unlock()
+
+	fetch.once.Do(func() {
+		fetch.desc, fetch.err = Get(s.dockerConfigDir, ref)
+	})
+	return fetch.desc, fetch.err
+}
+
+// writeOptions returns the remote options to write to the registry of the reference, reusing the pusher of the registry
+func (s *retagSession) writeOptions(ref name.Reference, registryOptions []remote.Option) ([]remote.Option, error) {
+	registry := ref.Context().RegistryStr()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pusher, ok := s.pushers[registry]
+	if !ok {
+		var err error
+		if pusher, err = remote.NewPusher(registryOptions...); err != nil {
+			return nil, err
+		}
+		s.pushers[registry] = pusher
+	}
+	return append(registryOptions, remote.Reuse(pusher)), nil
+}
@@ -1,13 +1,25 @@
 package docker
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
+	"log"
 	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/hytromo/mimosa/internal/reporting"
 	"github.com/hytromo/mimosa/internal/testutils"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -19,7 +31,7 @@ func TestRetagSingle_SinglePlatform(t *testing.T) {
 	newTag := fmt.Sprintf("%s/testapp-%d:v1.1.0", "localhost:5000", testID)
 
 	// Test dry run
-	err := RetagSingleTag(originalImage, newTag, true)
+	err := RetagSingleTag("", originalImage, newTag, true)
 	assert.NoError(t, err)
 
 	// Verify the new tag doesn't exist (because it was dry run)
@@ -27,7 +39,7 @@ func TestRetagSingle_SinglePlatform(t *testing.T) {
 	assert.Error(t, err, "Image should not exist in dry run mode: %s", newTag)
 
 	// Test actual retag
-	err = RetagSingleTag(originalImage, newTag, false)
+	err = RetagSingleTag("", originalImage, newTag, false)
 	assert.NoError(t, err)
 
 	// Verify the new tag exists
@@ -42,7 +54,7 @@ func TestRetagSingle_MultiPlatform(t *testing.T) {
 	newTag := fmt.Sprintf("%s/multiplatform-app-%d:v1.1.0", "localhost:5000", testID)
 
 	// Test actual retag
-	err := RetagSingleTag(originalImage, newTag, false)
+	err := RetagSingleTag("", originalImage, newTag, false)
 	assert.NoError(t, err)
 
 	// Verify the new tag exists
@@ -58,7 +70,7 @@ func TestRetagSingle_InvalidFromTagFormat(t *testing.T) {
 	newTag := fmt.Sprintf("%s/testapp-%d:v1.0.0", "localhost:5000", testID)
 
 	// Test with invalid from tag format (ParseTag fails)
-	err := RetagSingleTag("invalid:reference:format", newTag, false)
+	err := RetagSingleTag("", "invalid:reference:format", newTag, false)
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "invalid image reference")
 }
@@ -68,7 +80,7 @@ func TestRetagSingle_InvalidToTagFormat(t *testing.T) {
 	originalImage := testutils.CreateTestImage(t, fmt.Sprintf("testapp-%d", testID), "v1.0.0")
 
 	// Test with invalid to tag format (ParseTag fails)
-	err := RetagSingleTag(originalImage, "invalid:reference:format", false)
+	err := RetagSingleTag("", originalImage, "invalid:reference:format", false)
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "invalid image reference")
 }
@@ -80,7 +92,7 @@ func TestRetagSingle_InvalidSourceTag(t *testing.T) {
 
 	// Test with non-existent source tag (valid format, same repo, but doesn't exist)
 	nonExistentSource := fmt.Sprintf("%s:nonexistent-tag-%d", imageName, testID)
-	err := RetagSingleTag(nonExistentSource, newTag, false)
+	err := RetagSingleTag("", nonExistentSource, newTag, false)
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "failed to get descriptor")
 }
@@ -90,7 +102,7 @@ func TestRetagSingle_InvalidTargetTag(t *testing.T) {
 	originalImage := testutils.CreateTestImage(t, fmt.Sprintf("testapp-%d", testID), "v1.0.0")
 
 	// Test with invalid target tag
-	err := RetagSingleTag(originalImage, "invalid-target:tag", false)
+	err := RetagSingleTag("", originalImage, "invalid-target:tag", false)
 	assert.Error(t, err)
 }
 
@@ -139,11 +151,11 @@ func TestRetag_SingleTarget(t *testing.T) {
 			}
 
 			// Test dry run
-			err := Retag(cacheTagPairsByTarget, true)
+			err := Retag("", cacheTagPairsByTarget, true)
 			assert.NoError(t, err)
 
 			// Test actual retag
-			err = Retag(cacheTagPairsByTarget, false)
+			err = Retag("", cacheTagPairsByTarget, false)
 			assert.NoError(t, err)
 
 			// Verify the new tags exist
@@ -206,7 +218,7 @@ func TestRetag_MultipleTargets(t *testing.T) {
 			}
 
 			// Test actual retag
-			err := Retag(cacheTagPairsByTarget, false)
+			err := Retag("", cacheTagPairsByTarget, false)
 			assert.NoError(t, err)
 
 			// Verify all new tags exist
@@ -236,7 +248,7 @@ func TestRetag_MultipleTargets(t *testing.T) {
 func TestRetag_EmptyCacheTagPairs(t *testing.T) {
 	// Test should fail because no cache tag pairs provided
 	emptyCacheTagPairs := map[string][]CacheTagPair{}
-	err := Retag(emptyCacheTagPairs, false)
+	err := Retag("", emptyCacheTagPairs, false)
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "no cache tag pairs provided")
 }
@@ -254,7 +266,7 @@ func TestRetag_CrossRepositoryRetag(t *testing.T) {
 	}
 
 	// Test should fail because retagging across repositories is not supported
-	err := Retag(cacheTagPairsByTarget, false)
+	err := Retag("", cacheTagPairsByTarget, false)
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "retagging across repositories is not supported")
 }
@@ -272,7 +284,7 @@ func TestRetag_SkipRetaggingToItself(t *testing.T) {
 		},
 	}
 
-	err := Retag(cacheTagPairsByTarget, false)
+	err := Retag("", cacheTagPairsByTarget, false)
 	assert.NoError(t, err)
 
 	// Verify the new tag exists (actual retag succeeded)
@@ -295,7 +307,7 @@ func TestRetag_WorkerErrorPropagation(t *testing.T) {
 		},
 	}
 
-	err := Retag(cacheTagPairsByTarget, false)
+	err := Retag("", cacheTagPairsByTarget, false)
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "failed to retag")
 	assert.Contains(t, err.Error(), "failed to get descriptor")
@@ -341,7 +353,7 @@ func TestRetag_DryRun(t *testing.T) {
 			}
 
 			// Test dry run - should not actually retag
-			err := Retag(cacheTagPairsByTarget, true)
+			err := Retag("", cacheTagPairsByTarget, true)
 			assert.NoError(t, err)
 
 			// Verify the new tag doesn't exist (because it was dry run)
@@ -439,3 +451,286 @@ func checkMultiPlatformManifest(t *testing.T, imageTag string, originalImageTag
 
 	t.Logf("Multi-platform image %s contains all original digests with preserved platform info: %v", *ref, originalDigests)
 }
+
+// parseTestReference parses a reference that the test itself built
+func parseTestReference(t *testing.T, reference string) name.Reference {
+	t.Helper()
+	ref, err := name.ParseReference(reference)
+	require.NoError(t, err)
+	return ref
+}
+
+// startInMemoryRegistry starts a throwaway registry and returns its host (127.0.0.1:<port> - plain HTTP)
+func startInMemoryRegistry(t *testing.T) string {
+	t.Helper()
+	server := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	t.Cleanup(server.Close)
+	return strings.TrimPrefix(server.URL, "http://")
+}
+
+func useRetagAnnotations(t *testing.T) {
+	t.Helper()
+	SetRetagAnnotations(true)
+	t.Cleanup(func() {
+		SetRetagAnnotations(false)
+	})
+}
+
+func TestCacheLineageAnnotations(t *testing.T) {
+	assert.Equal(t, map[string]string{
+		OriginalTagAnnotation: "myreg/app:" + CacheTagPrefix + "abc123",
+		CacheHashAnnotation:   "abc123",
+	}, cacheLineageAnnotations("myreg/app:"+CacheTagPrefix+"abc123"))
+
+	assert.Equal(t, map[string]string{
+		OriginalTagAnnotation: "myreg/app:v1",
+	}, cacheLineageAnnotations("myreg/app:v1"))
+
+	assert.Equal(t, map[string]string{
+		OriginalTagAnnotation: "myreg/app:" + CacheTagPrefix + "abc123-feature-login",
+		CacheHashAnnotation:   "abc123",
+	}, cacheLineageAnnotations("myreg/app:"+CacheTagPrefix+"abc123-feature-login"))
+}
+
+func TestRetag_WithAnnotations_Index(t *testing.T) {
+	useRetagAnnotations(t)
+	registryHost := startInMemoryRegistry(t)
+
+	cacheTag := registryHost + "/app:" + CacheTagPrefix + "abc123"
+	newTag := registryHost + "/app:v2"
+
+	index, err := random.Index(64, 1, 2)
+	require.NoError(t, err)
+	require.NoError(t, remote.WriteIndex(parseTestReference(t, cacheTag), index))
+
+	err = Retag("", map[string][]CacheTagPair{"default": {{CacheTag: cacheTag, NewTag: newTag}}}, false)
+	require.NoError(t, err)
+
+	retaggedDesc, err := remote.Get(parseTestReference(t, newTag))
+	require.NoError(t, err)
+	retaggedIndex, err := retaggedDesc.ImageIndex()
+	require.NoError(t, err)
+	retaggedManifest, err := retaggedIndex.IndexManifest()
+	require.NoError(t, err)
+
+	assert.Equal(t, "abc123", retaggedManifest.Annotations[CacheHashAnnotation])
+	assert.Equal(t, cacheTag, retaggedManifest.Annotations[OriginalTagAnnotation])
+
+	// the platform manifests are the same
+	originalManifest, err := index.IndexManifest()
+	require.NoError(t, err)
+	require.Len(t, retaggedManifest.Manifests, len(originalManifest.Manifests))
+	for i, manifest := range originalManifest.Manifests {
+		assert.Equal(t, manifest.Digest, retaggedManifest.Manifests[i].Digest)
+	}
+}
+
+func TestRetag_WithAnnotations_Image(t *testing.T) {
+	useRetagAnnotations(t)
+	registryHost := startInMemoryRegistry(t)
+
+	cacheTag := registryHost + "/app:" + CacheTagPrefix + "def456"
+	newTag := registryHost + "/app:v2"
+
+	image, err := random.Image(64, 2)
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(parseTestReference(t, cacheTag), image))
+
+	err = Retag("", map[string][]CacheTagPair{"default": {{CacheTag: cacheTag, NewTag: newTag}}}, false)
+	require.NoError(t, err)
+
+	retaggedDesc, err := remote.Get(parseTestReference(t, newTag))
+	require.NoError(t, err)
+	retaggedImage, err := retaggedDesc.Image()
+	require.NoError(t, err)
+	retaggedManifest, err := retaggedImage.Manifest()
+	require.NoError(t, err)
+
+	assert.Equal(t, "def456", retaggedManifest.Annotations[CacheHashAnnotation])
+
+	// the layers are the same
+	originalManifest, err := image.Manifest()
+	require.NoError(t, err)
+	assert.Equal(t, originalManifest.Layers, retaggedManifest.Layers)
+}
+
+func TestRetag_WithoutAnnotations_KeepsDigest(t *testing.T) {
+	registryHost := startInMemoryRegistry(t)
+
+	cacheTag := registryHost + "/app:" + CacheTagPrefix + "abc123"
+	newTag := registryHost + "/app:v2"
+
+	index, err := random.Index(64, 1, 2)
+	require.NoError(t, err)
+	require.NoError(t, remote.WriteIndex(parseTestReference(t, cacheTag), index))
+
+	err = Retag("", map[string][]CacheTagPair{"default": {{CacheTag: cacheTag, NewTag: newTag}}}, false)
+	require.NoError(t, err)
+
+	originalDigest, err := index.Digest()
+	require.NoError(t, err)
+	retaggedDesc, err := remote.Get(parseTestReference(t, newTag))
+	require.NoError(t, err)
+	assert.Equal(t, originalDigest, retaggedDesc.Digest)
+}
+
+func TestRetag_AuditLog(t *testing.T) {
+	registryHost := startInMemoryRegistry(t)
+	auditLog := filepath.Join(t.TempDir(), "audit.jsonl")
+	reporting.ConfigureAuditLog(auditLog)
+	t.Cleanup(func() { reporting.ConfigureAuditLog("") })
+
+	cacheTag := registryHost + "/app:" + CacheTagPrefix + "abc123"
+	newTag := registryHost + "/app:v2"
+	digest := pushFrontend(t, cacheTag)
+
+	require.NoError(t, Retag("", map[string][]CacheTagPair{"default": {{CacheTag: cacheTag, NewTag: newTag}}}, false))
+
+	content, err := os.ReadFile(auditLog)
+	require.NoError(t, err)
+	var record map[string]any
+	require.NoError(t, json.Unmarshal(content, &record))
+	assert.Equal(t, reporting.AuditRetag, record["action"])
+	assert.Equal(t, cacheTag, record["from"])
+	assert.Equal(t, newTag, record["to"])
+	assert.Equal(t, digest, record["digest"])
+}
+
+func TestRetag_MissingCacheTagWritesNothing(t *testing.T) {
+	registryHost := startInMemoryRegistry(t)
+
+	existingCacheTag := registryHost + "/app:" + CacheTagPrefix + "abc123"
+	missingCacheTag := registryHost + "/worker:" + CacheTagPrefix + "abc123"
+	appTag := registryHost + "/app:v2"
+	workerTag := registryHost + "/worker:v2"
+
+	image, err := random.Image(64, 1)
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(parseTestReference(t, existingCacheTag), image))
+
+	err = Retag("", map[string][]CacheTagPair{
+		"app":    {{CacheTag: existingCacheTag, NewTag: appTag}},
+		"worker": {{CacheTag: missingCacheTag, NewTag: workerTag}},
+	}, false)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), missingCacheTag)
+
+	// the target whose cache tag exists must not have been retagged either
+	_, err = remote.Head(parseTestReference(t, appTag))
+	assert.Error(t, err)
+	_, err = remote.Head(parseTestReference(t, workerTag))
+	assert.Error(t, err)
+}
+
+// manifestRequests counts the manifest requests that a registry received, by method
+type manifestRequests struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func (m *manifestRequests) count(method string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.counts[method]
+}
+
+func (m *manifestRequests) reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.counts = map[string]int{}
+}
+
+// startCountingRegistry starts an in-memory registry that counts the manifest requests it receives
+func startCountingRegistry(t *testing.T) (string, *manifestRequests) {
+	t.Helper()
+	requests := &manifestRequests{counts: map[string]int{}}
+	handler := registry.New(registry.Logger(log.New(io.Discard, "", 0)))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "/manifests/") {
+			requests.mu.Lock()
+			requests.counts[r.Method]++
+			requests.mu.Unlock()
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return strings.TrimPrefix(server.URL, "http://"), requests
+}
+
+func TestRetag_ManyTagsFetchTheCacheTagOnce(t *testing.T) {
+	registryHost, requests := startCountingRegistry(t)
+
+	cacheTag := registryHost + "/app:" + CacheTagPrefix + "abc123"
+	index, err := random.Index(64, 1, 2)
+	require.NoError(t, err)
+	require.NoError(t, remote.WriteIndex(parseTestReference(t, cacheTag), index))
+	requests.reset()
+
+	pairs := []CacheTagPair{}
+	for i := range 10 {
+		pairs = append(pairs, CacheTagPair{CacheTag: cacheTag, NewTag: fmt.Sprintf("%s/app:v%d", registryHost, i)})
+	}
+	require.NoError(t, Retag("", map[string][]CacheTagPair{"default": pairs}, false))
+
+	assert.Equal(t, 1, requests.count(http.MethodGet))
+	assert.Equal(t, 10, requests.count(http.MethodPut))
+	for _, pair := range pairs {
+		_, err := remote.Head(parseTestReference(t, pair.NewTag))
+		assert.NoError(t, err)
+	}
+}
+
+func TestSetCacheTagPrefix(t *testing.T) {
+	t.Cleanup(func() { _ = SetCacheTagPrefix("") })
+
+	require.NoError(t, SetCacheTagPrefix("ci_cache.v2-"))
+	assert.Equal(t, "ci_cache.v2-", CurrentCacheTagPrefix())
+
+	assert.Error(t, SetCacheTagPrefix("-cache"))
+	assert.Error(t, SetCacheTagPrefix("cache/"))
+	assert.Error(t, SetCacheTagPrefix(strings.Repeat("a", maxCacheTagPrefixLength+1)))
+	assert.Equal(t, "ci_cache.v2-", CurrentCacheTagPrefix(), "an invalid prefix is not applied")
+
+	require.NoError(t, SetCacheTagPrefix(""))
+	assert.Equal(t, CacheTagPrefix, CurrentCacheTagPrefix())
+}
+
+func TestCacheRepositoryFor(t *testing.T) {
+	t.Cleanup(func() { _ = SetCacheRepository("") })
+
+	registry, imageName, dedicated := CacheRepositoryFor("ghcr.io", "org/api")
+	assert.Equal(t, []any{"ghcr.io", "org/api", false}, []any{registry, imageName, dedicated})
+
+	// without a registry, the cache repository is in the registry of each image
+	require.NoError(t, SetCacheRepository("org/mimosa-cache"))
+	registry, imageName, dedicated = CacheRepositoryFor("ghcr.io", "org/api")
+	assert.Equal(t, []any{"ghcr.io", "org/mimosa-cache", true}, []any{registry, imageName, dedicated})
+	assert.True(t, isCacheRepository("ghcr.io", "org/mimosa-cache"))
+	assert.False(t, isCacheRepository("ghcr.io", "org/api"))
+
+	require.NoError(t, SetCacheRepository("localhost:5000/mimosa-cache"))
+	registry, imageName, _ = CacheRepositoryFor("ghcr.io", "org/api")
+	assert.Equal(t, []any{"localhost:5000", "mimosa-cache"}, []any{registry, imageName})
+
+	assert.Error(t, SetCacheRepository("Org/Cache"))
+}
+
+func TestRetag_CrossRepositoryRetagToTheCacheRepository(t *testing.T) {
+	t.Cleanup(func() { _ = SetCacheRepository("") })
+	registryHost := startInMemoryRegistry(t)
+	sourceTag := registryHost + "/org/api:v1"
+	image, err := random.Image(64, 1)
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(parseTestReference(t, sourceTag), image))
+
+	cacheTag := registryHost + "/org/mimosa-cache:" + CacheTagPrefix + "abc"
+	assert.ErrorContains(t, RetagSingleTag("", sourceTag, cacheTag, false), "retagging across repositories is not supported")
+
+	require.NoError(t, SetCacheRepository("org/mimosa-cache"))
+	require.NoError(t, RetagSingleTag("", sourceTag, cacheTag, false))
+	desc, err := remote.Get(parseTestReference(t, cacheTag))
+	require.NoError(t, err)
+	digest, err := image.Digest()
+	require.NoError(t, err)
+	assert.Equal(t, digest, desc.Digest)
+}
@@ -0,0 +1,49 @@
+package docker
+
+import (
+	"log/slog"
+	"strings"
+
+	"github.com/docker/buildx/util/buildflags"
+	"github.com/samber/lo"
+)
+
+// secretSpecs returns the values of all the --secret flags of a build command
+func secretSpecs(dockerBuildCmd []string) []string {
+	specs := []string{}
+	for i := 0; i < len(dockerBuildCmd); i++ {
+		if dockerBuildCmd[i] == "--secret" && i+1 < len(dockerBuildCmd) {
+			i++
+			specs = append(specs, dockerBuildCmd[i])
+		} else if value, ok := strings.CutPrefix(dockerBuildCmd[i], "--secret="); ok {
+			specs = append(specs, value)
+		}
+	}
+	return specs
+}
+
+// warnAboutSecretsFromEnv warns that the values of secrets are never hashed - only their IDs are. This is most
+// surprising for secrets read from env variables, which often change between runs without anything else changing
+func warnAboutSecretsFromEnv(secrets buildflags.Secrets) {
+	envSecretIDs := lo.FilterMap(secrets, func(secret *buildflags.Secret, _ int) (string, bool) {
+		if secret == nil {
+			return "", false
+		}
+		// without a src, buildkit reads the secret from the env variable named after its id (if it exists)
+		return secret.ID, secret.Env != "" || secret.FilePath == ""
+	})
+	if len(envSecretIDs) > 0 {
+		slog.Warn("Secrets are not part of the hash - changing their env variables does not cause a cache miss", "secrets", envSecretIDs)
+	}
+}
+
+// warnAboutBuildSecretsFromEnv does warnAboutSecretsFromEnv for the --secret flags of a build command
+func warnAboutBuildSecretsFromEnv(dockerBuildCmd []string) {
+	secrets, err := buildflags.ParseSecretSpecs(secretSpecs(dockerBuildCmd))
+	if err != nil {
+		// buildx will report the invalid secret itself
+		slog.Debug("Failed to parse secrets", "error", err)
+		return
+	}
+	warnAboutSecretsFromEnv(secrets)
+}
@@ -0,0 +1,39 @@
+package docker
+
+import (
+	"bytes"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSecretSpecs(t *testing.T) {
+	command := []string{"docker", "buildx", "build", "--secret", "id=a,src=/a", "--secret=id=b,env=B", "--ssh", "default", "."}
+	assert.Equal(t, []string{"id=a,src=/a", "id=b,env=B"}, secretSpecs(command))
+}
+
+func captureWarnings(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	defaultLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelWarn})))
+	t.Cleanup(func() {
+		slog.SetDefault(defaultLogger)
+	})
+	return &buf
+}
+
+func TestWarnAboutBuildSecretsFromEnv(t *testing.T) {
+	logs := captureWarnings(t)
+	warnAboutBuildSecretsFromEnv([]string{"docker", "buildx", "build", "--secret", "id=file,src=/a", "--secret", "id=token,env=GITHUB_TOKEN", "--secret", "id=bare", "."})
+	assert.Contains(t, logs.String(), "secrets=\"[token bare]\"")
+
+	logs.Reset()
+	warnAboutBuildSecretsFromEnv([]string{"docker", "buildx", "build", "--secret", "id=file,src=/a", "."})
+	assert.Empty(t, logs.String(), "secrets from files do not warn")
+
+	logs.Reset()
+	warnAboutBuildSecretsFromEnv([]string{"docker", "buildx", "build", "--secret", "id=x,what=y", "."})
+	assert.Empty(t, logs.String(), "invalid secrets are left to buildx")
+}
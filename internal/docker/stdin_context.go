@@ -0,0 +1,222 @@
+package docker
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/hytromo/mimosa/internal/utils/tempdir"
+)
+
+// stdinContextArg is the context of "docker build -", which reads either a tar of the context or a Dockerfile
+// (without a context) from stdin
+const stdinContextArg = "-"
+
+var bufferedStdin struct {
+	once sync.Once
+	file *os.File
+	err  error
+}
+
+// bufferStdin reads all of stdin into an (already deleted) temp file, which then replaces os.Stdin - rewound - so that
+// the wrapped command, which inherits os.Stdin, still reads the same bytes. Stdin is only read once per run
+func bufferStdin() (*os.File, error) {
+	bufferedStdin.once.Do(func() {
+		file, err := tempdir.CreateTemp("stdin-*")
+		if err != nil {
+			bufferedStdin.err = fmt.Errorf("failed to buffer stdin: %w", err)
+			return
+		}
+		// the open file stays readable, and is gone as soon as mimosa and the command exit
+		if err := os.Remove(file.Name()); err != nil {
+			slog.Debug("Failed to delete the stdin buffer", "path", file.Name(), "error", err)
+		}
+
+		if _, err := io.Copy(file, os.Stdin); err != nil {
+			bufferedStdin.err = fmt.Errorf("failed to buffer stdin: %w", err)
+			return
+		}
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			bufferedStdin.err = fmt.Errorf("failed to rewind the stdin buffer: %w", err)
+			return
+		}
+
+		os.Stdin = file
+		bufferedStdin.file = file
+	})
+	return bufferedStdin.file, bufferedStdin.err
+}
+
+// stdinContextDir buffers stdin and unpacks the context it contains into a new temp dir, to be hashed as the main
+// context (the caller removes the dir): a tar (plain, gzip or bzip2) is extracted, anything else is the Dockerfile
+func stdinContextDir() (string, error) {
+	stdin, err := bufferStdin()
+	if err != nil {
+		return "", err
+	}
+	info, err := stdin.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	dir, err := tempdir.MkdirTemp("stdin-context-*")
+	if err != nil {
+		return "", err
+	}
+
+	// read through a section, so that the offset of os.Stdin stays at the start for the command
+	if err := unpackStdinContext(io.NewSectionReader(stdin, 0, info.Size()), dir); err != nil {
+		_ = os.RemoveAll(dir)
+		return "", fmt.Errorf("failed to read the build context from stdin: %w", err)
+	}
+	return dir, nil
+}
+
+// unpackStdinContext writes what "docker build -" reads from stdin into dir: the files of a (compressed) tar, or a
+// Dockerfile - the same detection as the docker cli
+func unpackStdinContext(stdin io.Reader, dir string) error {
+	content := bufio.NewReader(stdin)
+	magic, _ := content.Peek(3)
+
+	var archive io.Reader = content
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		gzipReader, err := gzip.NewReader(content)
+		if err != nil {
+			return err
+		}
+		archive = gzipReader
+	case bytes.HasPrefix(magic, []byte("BZh")):
+		archive = bzip2.NewReader(content)
+	}
+
+	tarContent := bufio.NewReaderSize(archive, 1024)
+	// the first header of a tar is 512 bytes - the docker cli treats whatever is not a tar as a Dockerfile
+	header, _ := tarContent.Peek(512)
+	if _, err := tar.NewReader(bytes.NewReader(header)).Next(); err != nil {
+		dockerfile, err := io.ReadAll(tarContent)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(filepath.Join(dir, "Dockerfile"), dockerfile, 0o644)
+	}
+
+	return extractTar(tar.NewReader(tarContent), dir)
+}
+
+// extractTar writes the directories, files and links of the tar into dir - the metadata (owners, times) does not
+// affect the hash, so it is not kept
+func extractTar(archive *tar.Reader, dir string) error {
+	for {
+		header, err := archive.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		path, err := tarEntryPath(dir, header.Name)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return err
+		}
+		// a later entry replaces a symlink of an earlier one, instead of writing through it
+		if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSymlink != 0 {
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(path, 0o755)
+		case tar.TypeReg:
+			err = writeTarFile(path, archive, header.FileInfo().Mode().Perm())
+		case tar.TypeSymlink:
+			if err = checkTarSymlinkTarget(dir, path, header.Linkname); err == nil {
+				err = os.Symlink(header.Linkname, path)
+			}
+		case tar.TypeLink:
+			var target string
+			target, err = tarEntryPath(dir, header.Linkname)
+			if err == nil {
+				err = os.Link(target, path)
+			}
+		default:
+			slog.Debug("Skipping special file of the stdin build context", "path", header.Name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// tarEntryPath returns where a tar entry goes in dir, rejecting entries that point outside of it - by name, or through
+// a symlink of an earlier entry in their parent dirs
+func tarEntryPath(dir string, name string) (string, error) {
+	path := filepath.Join(dir, filepath.FromSlash(name))
+	if path != dir && !strings.HasPrefix(path, dir+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid path in the build context: %s", name)
+	}
+
+	relativePath, err := filepath.Rel(dir, filepath.Dir(path))
+	if err != nil {
+		return "", err
+	}
+	parent := dir
+	for _, component := range strings.Split(relativePath, string(filepath.Separator)) {
+		if component == "." {
+			continue
+		}
+		parent = filepath.Join(parent, component)
+		info, err := os.Lstat(parent)
+		if errors.Is(err, os.ErrNotExist) {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return "", fmt.Errorf("invalid path in the build context, through a symlink: %s", name)
+		}
+	}
+	return path, nil
+}
+
+// checkTarSymlinkTarget rejects the symlinks of a tar that point outside of dir (absolute, or up with ".."), so that
+// hashing the context never reads files of the host
+func checkTarSymlinkTarget(dir string, path string, target string) error {
+	if filepath.IsAbs(target) {
+		return fmt.Errorf("invalid symlink in the build context, to an absolute path: %s -> %s", path, target)
+	}
+	resolved := filepath.Join(filepath.Dir(path), filepath.FromSlash(target))
+	if resolved != dir && !strings.HasPrefix(resolved, dir+string(filepath.Separator)) {
+		return fmt.Errorf("invalid symlink in the build context, to outside of it: %s -> %s", path, target)
+	}
+	return nil
+}
+
+func writeTarFile(path string, content io.Reader, perm os.FileMode) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, perm|0o600)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(file, content)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,193 @@
+package docker
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hytromo/mimosa/internal/hasher"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func tarOf(t *testing.T, modTime time.Time, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	archive := tar.NewWriter(&buf)
+	for name, content := range files {
+		require.NoError(t, archive.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(content)), ModTime: modTime, Typeflag: tar.TypeReg}))
+		_, err := archive.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, archive.Close())
+	return buf.Bytes()
+}
+
+func gzipOf(t *testing.T, content []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	_, err := writer.Write(content)
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+	return buf.Bytes()
+}
+
+func TestUnpackStdinContext(t *testing.T) {
+	files := map[string]string{"Dockerfile": "FROM alpine\nCOPY app /app\n", "app/main.go": "package main"}
+	tarContent := tarOf(t, time.Now(), files)
+
+	for name, stdin := range map[string][]byte{"tar": tarContent, "gzipped tar": gzipOf(t, tarContent)} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			require.NoError(t, unpackStdinContext(bytes.NewReader(stdin), dir))
+			for path, content := range files {
+				written, err := os.ReadFile(filepath.Join(dir, path))
+				require.NoError(t, err)
+				assert.Equal(t, content, string(written))
+			}
+		})
+	}
+
+	t.Run("dockerfile", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, unpackStdinContext(bytes.NewReader([]byte("FROM alpine\n")), dir))
+		written, err := os.ReadFile(filepath.Join(dir, "Dockerfile"))
+		require.NoError(t, err)
+		assert.Equal(t, "FROM alpine\n", string(written))
+	})
+
+	t.Run("paths outside of the context", func(t *testing.T) {
+		err := unpackStdinContext(bytes.NewReader(tarOf(t, time.Now(), map[string]string{"../escape": "x"})), t.TempDir())
+		assert.ErrorContains(t, err, "invalid path")
+	})
+}
+
+// tarOfEntries is a tar of the entries in order, e.g. a symlink and then a file under it
+func tarOfEntries(t *testing.T, entries ...tar.Header) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	archive := tar.NewWriter(&buf)
+	for _, entry := range entries {
+		content := entry.Linkname
+		if entry.Typeflag == tar.TypeReg {
+			entry.Linkname, entry.Size = "", int64(len(content))
+		}
+		entry.Mode = 0o644
+		require.NoError(t, archive.WriteHeader(&entry))
+		if entry.Typeflag == tar.TypeReg {
+			_, err := archive.Write([]byte(content))
+			require.NoError(t, err)
+		}
+	}
+	require.NoError(t, archive.Close())
+	return buf.Bytes()
+}
+
+func TestUnpackStdinContext_Symlinks(t *testing.T) {
+	// the content of the regular files is set as their Linkname, see tarOfEntries
+	outside := t.TempDir()
+
+	t.Run("files through a symlink", func(t *testing.T) {
+		// entries are never written through a symlink, even one that points inside of the context
+		err := unpackStdinContext(bytes.NewReader(tarOfEntries(t,
+			tar.Header{Name: "context/file", Typeflag: tar.TypeReg, Linkname: "x"},
+			tar.Header{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "context"},
+			tar.Header{Name: "link/evil", Typeflag: tar.TypeReg, Linkname: "x"},
+		)), t.TempDir())
+		assert.ErrorContains(t, err, "through a symlink")
+	})
+
+	t.Run("absolute and .. symlink targets", func(t *testing.T) {
+		for _, target := range []string{outside, "../" + filepath.Base(outside), "app/../../etc"} {
+			err := unpackStdinContext(bytes.NewReader(tarOfEntries(t,
+				tar.Header{Name: "link", Typeflag: tar.TypeSymlink, Linkname: target},
+				tar.Header{Name: "link/evil", Typeflag: tar.TypeReg, Linkname: "x"},
+			)), t.TempDir())
+			assert.ErrorContains(t, err, "invalid symlink", "target %s", target)
+		}
+		assert.NoFileExists(t, filepath.Join(outside, "evil"))
+	})
+
+	t.Run("a file replaces the symlink of an earlier entry", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "target"), []byte("original"), 0o644))
+		require.NoError(t, unpackStdinContext(bytes.NewReader(tarOfEntries(t,
+			tar.Header{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "target"},
+			tar.Header{Name: "link", Typeflag: tar.TypeReg, Linkname: "replaced"},
+		)), dir))
+
+		content, err := os.ReadFile(filepath.Join(dir, "target"))
+		require.NoError(t, err)
+		assert.Equal(t, "original", string(content))
+		content, err = os.ReadFile(filepath.Join(dir, "link"))
+		require.NoError(t, err)
+		assert.Equal(t, "replaced", string(content))
+	})
+
+	t.Run("symlinks inside the context", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, unpackStdinContext(bytes.NewReader(tarOfEntries(t,
+			tar.Header{Name: "app/main.go", Typeflag: tar.TypeReg, Linkname: "package main"},
+			tar.Header{Name: "current", Typeflag: tar.TypeSymlink, Linkname: "app"},
+			tar.Header{Name: "app/self", Typeflag: tar.TypeSymlink, Linkname: "../app/main.go"},
+		)), dir))
+
+		content, err := os.ReadFile(filepath.Join(dir, "current", "main.go"))
+		require.NoError(t, err)
+		assert.Equal(t, "package main", string(content))
+		target, err := os.Readlink(filepath.Join(dir, "app", "self"))
+		require.NoError(t, err)
+		assert.Equal(t, "../app/main.go", target)
+	})
+}
+
+// withStdin makes os.Stdin (and the stdin buffer) start over with the given content
+func withStdin(t *testing.T, content []byte) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "stdin")
+	require.NoError(t, os.WriteFile(path, content, 0o644))
+	file, err := os.Open(path)
+	require.NoError(t, err)
+
+	originalStdin := os.Stdin
+	os.Stdin = file
+	bufferedStdin.once = sync.Once{}
+	t.Cleanup(func() {
+		os.Stdin = originalStdin
+		bufferedStdin.once = sync.Once{}
+		_ = file.Close()
+	})
+}
+
+func TestParseBuildCommand_ContextFromStdin(t *testing.T) {
+	t.Chdir(t.TempDir())
+	command := []string{"docker", "build", "--push", "-t", "myreg/app:v1", "-"}
+	files := map[string]string{"Dockerfile": "FROM alpine\nCOPY . /app\n", "main.go": "package main"}
+
+	hashOf := func(stdin []byte) string {
+		withStdin(t, stdin)
+		parsedCommand, err := ParseBuildCommand(command, hasher.Options{}, "")
+		require.NoError(t, err)
+
+		// the command still reads the whole context from stdin
+		replayed, err := io.ReadAll(os.Stdin)
+		require.NoError(t, err)
+		assert.Equal(t, stdin, replayed)
+		return parsedCommand.Hash
+	}
+
+	hash := hashOf(tarOf(t, time.Unix(1000, 0), files))
+	assert.Equal(t, hash, hashOf(tarOf(t, time.Unix(2000, 0), files)), "file times do not affect the hash")
+	assert.Equal(t, hash, hashOf(gzipOf(t, tarOf(t, time.Unix(1000, 0), files))), "compression does not affect the hash")
+
+	files["main.go"] = "package main // changed"
+	assert.NotEqual(t, hash, hashOf(tarOf(t, time.Unix(1000, 0), files)))
+	assert.NotEqual(t, hash, hashOf([]byte("FROM alpine\n")))
+}
@@ -0,0 +1,182 @@
+package docker
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"log/slog"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/hytromo/mimosa/internal/utils/envutil"
+)
+
+const (
+	// same layout as docker: <certs dir>/<registry host[:port]>/{*.crt (CA), *.cert + *.key (client cert)}
+	certsDirEnv     = "MIMOSA_CERTS_DIR"
+	defaultCertsDir = "/etc/docker/certs.d"
+	// comma separated list of registries (host[:port]) for which TLS verification is skipped and plain HTTP is allowed
+	insecureRegistriesEnv = "MIMOSA_INSECURE_REGISTRIES"
+	// comma separated list of registry=proxy URL pairs (http, https or socks5) that override HTTPS_PROXY/NO_PROXY for
+	// these registries - "direct" connects to the registry without a proxy
+	registryProxiesEnv = "MIMOSA_REGISTRY_PROXIES"
+	directProxy        = "direct"
+)
+
+var (
+	registryTransportsMu sync.Mutex
+	registryTransports   = map[string]http.RoundTripper{}
+)
+
+// insecureRegistries returns the registries configured through MIMOSA_INSECURE_REGISTRIES
+func insecureRegistries() []string {
+	registries := []string{}
+	for registry := range strings.SplitSeq(os.Getenv(insecureRegistriesEnv), ",") {
+		registry = strings.TrimSpace(registry)
+		if registry != "" {
+			registries = append(registries, registry)
+		}
+	}
+	return registries
+}
+
+func isInsecureRegistry(registry string) bool {
+	return slices.Contains(insecureRegistries(), registry)
+}
+
+// registryProxy returns the proxy of the registry from MIMOSA_REGISTRY_PROXIES - nil if the registry has no override,
+// in which case HTTPS_PROXY/NO_PROXY decide, like for the rest of mimosa
+func registryProxy(registry string) (func(*http.Request) (*url.URL, error), error) {
+	for pair := range strings.SplitSeq(os.Getenv(registryProxiesEnv), ",") {
+		proxyRegistry, proxy, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || strings.TrimSpace(proxyRegistry) != registry {
+			continue
+		}
+
+		proxy = strings.TrimSpace(proxy)
+		if proxy == directProxy {
+			return func(*http.Request) (*url.URL, error) { return nil, nil }, nil
+		}
+		proxyURL, err := url.Parse(proxy)
+		if err != nil || !slices.Contains([]string{"http", "https", "socks5", "socks5h"}, proxyURL.Scheme) || proxyURL.Host == "" {
+			return nil, fmt.Errorf("invalid proxy of registry %s in %s: %q", registry, registryProxiesEnv, proxy)
+		}
+		return http.ProxyURL(proxyURL), nil
+	}
+	return nil, nil
+}
+
+// loadRegistryTLSConfig builds the TLS configuration of a registry from its certs dir, if any
+func loadRegistryTLSConfig(certsDir string, registry string, insecure bool) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: insecure, // explicitly requested through MIMOSA_INSECURE_REGISTRIES
+	}
+
+	registryCertsDir := filepath.Join(certsDir, registry)
+	entries, err := os.ReadDir(registryCertsDir)
+	if os.IsNotExist(err) {
+		return tlsConfig, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read certs dir of registry %s: %w", registry, err)
+	}
+
+	for _, entry := range entries {
+		fileName := entry.Name()
+		fullPath := filepath.Join(registryCertsDir, fileName)
+
+		switch filepath.Ext(fileName) {
+		case ".crt":
+			if tlsConfig.RootCAs == nil {
+				systemPool, err := x509.SystemCertPool()
+				if err != nil {
+					systemPool = x509.NewCertPool()
+				}
+				tlsConfig.RootCAs = systemPool
+			}
+			caData, err := os.ReadFile(fullPath)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read CA %s: %w", fullPath, err)
+			}
+			if !tlsConfig.RootCAs.AppendCertsFromPEM(caData) {
+				return nil, fmt.Errorf("no valid certificates found in CA %s", fullPath)
+			}
+		case ".cert":
+			keyPath := strings.TrimSuffix(fullPath, ".cert") + ".key"
+			clientCert, err := tls.LoadX509KeyPair(fullPath, keyPath)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load client certificate %s: %w", fullPath, err)
+			}
+			tlsConfig.Certificates = append(tlsConfig.Certificates, clientCert)
+		}
+	}
+
+	return tlsConfig, nil
+}
+
+// registryTransport returns the (memoized) http transport to use when talking to the given registry
+func registryTransport(registry string) (http.RoundTripper, error) {
+	registryTransportsMu.Lock()
+	defer registryTransportsMu.Unlock()
+
+	if transport, ok := registryTransports[registry]; ok {
+		return transport, nil
+	}
+
+	insecure := isInsecureRegistry(registry)
+	tlsConfig, err := loadRegistryTLSConfig(envutil.GetEnv(certsDirEnv, defaultCertsDir), registry, insecure)
+	if err != nil {
+		return nil, err
+	}
+
+	proxy, err := registryProxy(registry)
+	if err != nil {
+		return nil, err
+	}
+
+	// the default transport already proxies through HTTPS_PROXY/NO_PROXY
+	var transport http.RoundTripper = remote.DefaultTransport
+	if insecure || tlsConfig.RootCAs != nil || len(tlsConfig.Certificates) > 0 || proxy != nil {
+		slog.Debug("Using custom transport for registry", "registry", registry, "insecure", insecure, "customCA", tlsConfig.RootCAs != nil, "clientCerts", len(tlsConfig.Certificates), "proxyOverride", proxy != nil)
+		httpTransport := remote.DefaultTransport.(*http.Transport).Clone()
+		httpTransport.TLSClientConfig = tlsConfig
+		if proxy != nil {
+			httpTransport.Proxy = proxy
+		}
+		transport = httpTransport
+	}
+
+	registryTransports[registry] = transport
+	return transport, nil
+}
+
+// withRegistryOptions returns the reference (allowing plain HTTP for insecure registries) along with the
+// remote options (auth from the docker config dir of the command, and per-registry transport) that every call to the
+// registry of the reference should use
+func withRegistryOptions(dockerConfigDir string, ref name.Reference) (name.Reference, []remote.Option, error) {
+	registry := ref.Context().RegistryStr()
+
+	if isInsecureRegistry(registry) {
+		insecureRef, err := name.ParseReference(ref.String(), name.Insecure)
+		if err != nil {
+			return nil, nil, err
+		}
+		ref = insecureRef
+	}
+
+	transport, err := registryTransport(registry)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return ref, []remote.Option{remote.WithAuthFromKeychain(keychainForConfigDir(dockerConfigDir)), remote.WithTransport(transport)}, nil
+}
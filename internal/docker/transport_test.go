@@ -0,0 +1,185 @@
+package docker
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeSelfSignedCert writes a self-signed certificate (and its key) as <prefix>.<certExt> and <prefix>.key
+func writeSelfSignedCert(t *testing.T, dir, prefix, certExt string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "registry.internal"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, prefix+certExt), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER}), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, prefix+".key"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+}
+
+func resetRegistryTransports(t *testing.T) {
+	t.Helper()
+	registryTransports = map[string]http.RoundTripper{}
+	t.Cleanup(func() {
+		registryTransports = map[string]http.RoundTripper{}
+	})
+}
+
+func TestInsecureRegistries(t *testing.T) {
+	t.Setenv(insecureRegistriesEnv, " registry.internal:5000, ,plain.local ")
+
+	assert.Equal(t, []string{"registry.internal:5000", "plain.local"}, insecureRegistries())
+	assert.True(t, isInsecureRegistry("plain.local"))
+	assert.False(t, isInsecureRegistry("docker.io"))
+}
+
+func TestLoadRegistryTLSConfig_NoCertsDir(t *testing.T) {
+	tlsConfig, err := loadRegistryTLSConfig(t.TempDir(), "registry.internal", false)
+	require.NoError(t, err)
+
+	assert.Nil(t, tlsConfig.RootCAs)
+	assert.Empty(t, tlsConfig.Certificates)
+	assert.False(t, tlsConfig.InsecureSkipVerify)
+}
+
+func TestLoadRegistryTLSConfig_CAAndClientCert(t *testing.T) {
+	certsDir := t.TempDir()
+	registryCertsDir := filepath.Join(certsDir, "registry.internal:5000")
+	require.NoError(t, os.MkdirAll(registryCertsDir, 0755))
+
+	writeSelfSignedCert(t, registryCertsDir, "ca", ".crt")
+	writeSelfSignedCert(t, registryCertsDir, "client", ".cert")
+
+	tlsConfig, err := loadRegistryTLSConfig(certsDir, "registry.internal:5000", true)
+	require.NoError(t, err)
+
+	assert.NotNil(t, tlsConfig.RootCAs)
+	assert.Len(t, tlsConfig.Certificates, 1)
+	assert.True(t, tlsConfig.InsecureSkipVerify)
+}
+
+func TestLoadRegistryTLSConfig_InvalidCA(t *testing.T) {
+	certsDir := t.TempDir()
+	registryCertsDir := filepath.Join(certsDir, "registry.internal")
+	require.NoError(t, os.MkdirAll(registryCertsDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(registryCertsDir, "ca.crt"), []byte("not a certificate"), 0644))
+
+	_, err := loadRegistryTLSConfig(certsDir, "registry.internal", false)
+	assert.ErrorContains(t, err, "no valid certificates found")
+}
+
+func TestLoadRegistryTLSConfig_ClientCertWithoutKey(t *testing.T) {
+	certsDir := t.TempDir()
+	registryCertsDir := filepath.Join(certsDir, "registry.internal")
+	require.NoError(t, os.MkdirAll(registryCertsDir, 0755))
+	writeSelfSignedCert(t, registryCertsDir, "client", ".cert")
+	require.NoError(t, os.Remove(filepath.Join(registryCertsDir, "client.key")))
+
+	_, err := loadRegistryTLSConfig(certsDir, "registry.internal", false)
+	assert.ErrorContains(t, err, "failed to load client certificate")
+}
+
+func TestRegistryTransport(t *testing.T) {
+	resetRegistryTransports(t)
+	t.Setenv(certsDirEnv, t.TempDir())
+	t.Setenv(insecureRegistriesEnv, "plain.local")
+
+	defaultTransport, err := registryTransport("docker.io")
+	require.NoError(t, err)
+	assert.Equal(t, remote.DefaultTransport, defaultTransport)
+
+	insecureTransport, err := registryTransport("plain.local")
+	require.NoError(t, err)
+	require.IsType(t, &http.Transport{}, insecureTransport)
+	assert.True(t, insecureTransport.(*http.Transport).TLSClientConfig.InsecureSkipVerify)
+
+	memoizedTransport, err := registryTransport("plain.local")
+	require.NoError(t, err)
+	assert.Same(t, insecureTransport, memoizedTransport)
+}
+
+func TestWithRegistryOptions_InsecureRegistryAllowsPlainHTTP(t *testing.T) {
+	resetRegistryTransports(t)
+	t.Setenv(certsDirEnv, t.TempDir())
+	t.Setenv(insecureRegistriesEnv, "registry.internal:5000")
+
+	ref, err := name.ParseReference("registry.internal:5000/app:v1")
+	require.NoError(t, err)
+	assert.Equal(t, "https", ref.Context().Scheme())
+
+	insecureRef, options, err := withRegistryOptions("", ref)
+	require.NoError(t, err)
+	assert.Equal(t, "http", insecureRef.Context().Scheme())
+	assert.Equal(t, ref.String(), insecureRef.String())
+	assert.Len(t, options, 2)
+
+	secureRef, _, err := withRegistryOptions("", name.MustParseReference("registry.example.com/app:v1"))
+	require.NoError(t, err)
+	assert.Equal(t, "https", secureRef.Context().Scheme())
+}
+
+func TestRegistryProxy(t *testing.T) {
+	t.Setenv(registryProxiesEnv, "registry.internal:5000=socks5://proxy.corp:1080, ecr.example.com = direct")
+
+	proxy, err := registryProxy("registry.internal:5000")
+	require.NoError(t, err)
+	proxyURL, err := proxy(&http.Request{})
+	require.NoError(t, err)
+	assert.Equal(t, "socks5://proxy.corp:1080", proxyURL.String())
+
+	direct, err := registryProxy("ecr.example.com")
+	require.NoError(t, err)
+	proxyURL, err = direct(&http.Request{})
+	require.NoError(t, err)
+	assert.Nil(t, proxyURL)
+
+	// registries without an override use HTTPS_PROXY/NO_PROXY
+	proxy, err = registryProxy("docker.io")
+	require.NoError(t, err)
+	assert.Nil(t, proxy)
+
+	t.Setenv(registryProxiesEnv, "registry.internal:5000=ftp://proxy.corp")
+	_, err = registryProxy("registry.internal:5000")
+	assert.ErrorContains(t, err, "invalid proxy of registry registry.internal:5000")
+}
+
+func TestRegistryTransport_ProxyOverride(t *testing.T) {
+	resetRegistryTransports(t)
+	t.Setenv(certsDirEnv, t.TempDir())
+	t.Setenv(registryProxiesEnv, "registry.internal=http://proxy.corp:3128")
+
+	transport, err := registryTransport("registry.internal")
+	require.NoError(t, err)
+	require.IsType(t, &http.Transport{}, transport)
+	proxyURL, err := transport.(*http.Transport).Proxy(&http.Request{URL: &url.URL{Scheme: "https", Host: "registry.internal"}})
+	require.NoError(t, err)
+	assert.Equal(t, "http://proxy.corp:3128", proxyURL.String())
+}
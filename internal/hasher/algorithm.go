@@ -0,0 +1,92 @@
+package hasher
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+
+	"github.com/kalafut/imohash"
+	"github.com/zeebo/xxh3"
+)
+
+// FileHashAlgorithm is the algorithm used to hash the contents of the files of the build contexts
+type FileHashAlgorithm string
+
+const (
+	// FileHashAlgorithmImo samples the file contents - very fast, but can miss changes in the middle of large files
+	FileHashAlgorithmImo FileHashAlgorithm = "imo"
+	// FileHashAlgorithmSHA256 hashes the full file contents - correctness first
+	FileHashAlgorithmSHA256 FileHashAlgorithm = "sha256"
+	// FileHashAlgorithmXXH3 hashes the full file contents - fast, non-cryptographic
+	FileHashAlgorithmXXH3 FileHashAlgorithm = "xxh3"
+)
+
+var FileHashAlgorithms = []FileHashAlgorithm{FileHashAlgorithmImo, FileHashAlgorithmSHA256, FileHashAlgorithmXXH3}
+
+// ParseFileHashAlgorithm returns the algorithm of the given name; an empty name selects the default (imo)
+func ParseFileHashAlgorithm(name string) (FileHashAlgorithm, error) {
+	if name == "" {
+		return FileHashAlgorithmImo, nil
+	}
+
+	for _, algorithm := range FileHashAlgorithms {
+		if string(algorithm) == name {
+			return algorithm, nil
+		}
+	}
+
+	return FileHashAlgorithmImo, fmt.Errorf("unknown hash algorithm %q, must be one of %v", name, FileHashAlgorithms)
+}
+
+func newFullContentHash(algorithm FileHashAlgorithm) hash.Hash {
+	if algorithm == FileHashAlgorithmXXH3 {
+		return xxh3.New()
+	}
+	return sha256.New()
+}
+
+// sumFile hashes a single file using the given algorithm
+func sumFile(algorithm FileHashAlgorithm, path string) ([]byte, error) {
+	if algorithm == FileHashAlgorithmImo {
+		sum, err := imohash.SumFile(path)
+		return sum[:], err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	fullContentHash := newFullContentHash(algorithm)
+	if _, err := io.Copy(fullContentHash, file); err != nil {
+		return nil, err
+	}
+
+	return sumBytes(fullContentHash), nil
+}
+
+// sumJoined hashes the concatenation of all the file hashes using the given algorithm
+func sumJoined(algorithm FileHashAlgorithm, joined []byte) []byte {
+	if algorithm == FileHashAlgorithmImo {
+		sum := imohash.Sum(joined)
+		return sum[:]
+	}
+
+	fullContentHash := newFullContentHash(algorithm)
+	_, _ = fullContentHash.Write(joined)
+	return sumBytes(fullContentHash)
+}
+
+func sumBytes(fullContentHash hash.Hash) []byte {
+	if xxh3Hash, ok := fullContentHash.(*xxh3.Hasher); ok {
+		// use the 128bit variant to keep collisions as unlikely as with imohash
+		sum := xxh3Hash.Sum128().Bytes()
+		return sum[:]
+	}
+	return fullContentHash.Sum(nil)
+}
@@ -0,0 +1,67 @@
+package hasher
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFileHashAlgorithm(t *testing.T) {
+	for _, algorithm := range FileHashAlgorithms {
+		parsed, err := ParseFileHashAlgorithm(string(algorithm))
+		assert.NoError(t, err)
+		assert.Equal(t, algorithm, parsed)
+	}
+
+	parsed, err := ParseFileHashAlgorithm("")
+	assert.NoError(t, err)
+	assert.Equal(t, FileHashAlgorithmImo, parsed)
+
+	_, err = ParseFileHashAlgorithm("md5")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown hash algorithm")
+}
+
+func TestHashFiles_AlgorithmsNeverCollide(t *testing.T) {
+	dir := t.TempDir()
+	files := []string{createTempFileWithContent(t, dir, "foo"), createTempFileWithContent(t, dir, "bar")}
+
+	hashes := map[string]FileHashAlgorithm{}
+	for _, algorithm := range FileHashAlgorithms {
+		hash := HashFiles(files, 2, algorithm)
+
+		assert.Equal(t, hash, HashFiles([]string{files[1], files[0]}, 1, algorithm), "Expected %s hash to be order independent", algorithm)
+		if algorithm != FileHashAlgorithmImo {
+			assert.True(t, strings.HasPrefix(hash, string(algorithm)+":"), "Expected %s hash to be prefixed with the algorithm, got %s", algorithm, hash)
+		}
+		_, seen := hashes[hash]
+		assert.False(t, seen, "Expected %s hash to differ from the other algorithms", algorithm)
+		hashes[hash] = algorithm
+	}
+}
+
+func TestHashFiles_FullContentAlgorithmsDetectChangesInTheMiddle(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "large.bin")
+	// large enough for imohash to only sample the contents
+	content := bytes.Repeat([]byte("a"), 1024*1024)
+	require.NoError(t, os.WriteFile(file, content, 0644))
+
+	hashesBefore := map[FileHashAlgorithm]string{}
+	for _, algorithm := range FileHashAlgorithms {
+		hashesBefore[algorithm] = HashFiles([]string{file}, 1, algorithm)
+	}
+
+	// change a byte that falls outside of imohash's samples
+	content[len(content)/4] = 'b'
+	require.NoError(t, os.WriteFile(file, content, 0644))
+
+	for _, algorithm := range []FileHashAlgorithm{FileHashAlgorithmSHA256, FileHashAlgorithmXXH3} {
+		assert.NotEqual(t, hashesBefore[algorithm], HashFiles([]string{file}, 1, algorithm), "Expected %s to detect the change", algorithm)
+	}
+}
@@ -3,15 +3,29 @@ package hasher
 import (
 	"fmt"
 	"log/slog"
+	"maps"
+	"os"
 	"path/filepath"
 	"slices"
+	"strings"
 
 	"github.com/docker/buildx/bake"
+	"github.com/docker/buildx/util/buildflags"
 	"github.com/hytromo/mimosa/internal/configuration"
 	argparse "github.com/hytromo/mimosa/internal/docker/arg_parse"
 	fileresolution "github.com/hytromo/mimosa/internal/docker/file_resolution"
+	"github.com/samber/lo"
 )
 
+// sortedSet returns the unique values sorted, for the target fields whose order and repetitions do not change the build
+func sortedSet(values []string) []string {
+	set := lo.Uniq(values)
+	slices.Sort(set)
+	return set
+}
+
+// constructDockerBuildCommandWithoutTags builds the docker build command of the target - the map fields and the
+// set-like fields are sorted, so that the same target always gives the same command
 func constructDockerBuildCommandWithoutTags(target *bake.Target) []string {
 	args := []string{"docker", "buildx", "build"}
 
@@ -31,15 +45,15 @@ func constructDockerBuildCommandWithoutTags(target *bake.Target) []string {
 
 	// Add build contexts
 	if target.Contexts != nil {
-		for name, context := range target.Contexts {
-			args = append(args, "--build-context", fmt.Sprintf("%s=%s", name, context))
+		for _, name := range slices.Sorted(maps.Keys(target.Contexts)) {
+			args = append(args, "--build-context", fmt.Sprintf("%s=%s", name, target.Contexts[name]))
 		}
 	}
 
 	// Add build args
 	if target.Args != nil {
-		for key, value := range target.Args {
-			if value != nil {
+		for _, key := range slices.Sorted(maps.Keys(target.Args)) {
+			if value := target.Args[key]; value != nil {
 				args = append(args, "--build-arg", fmt.Sprintf("%s=%s", key, *value))
 			}
 		}
@@ -66,8 +80,8 @@ func constructDockerBuildCommandWithoutTags(target *bake.Target) []string {
 
 	// Add labels
 	if target.Labels != nil {
-		for key, value := range target.Labels {
-			if value != nil {
+		for _, key := range slices.Sorted(maps.Keys(target.Labels)) {
+			if value := target.Labels[key]; value != nil {
 				args = append(args, "--label", fmt.Sprintf("%s=%s", key, *value))
 			}
 		}
@@ -85,14 +99,14 @@ func constructDockerBuildCommandWithoutTags(target *bake.Target) []string {
 
 	// Add no-cache-filter
 	if target.NoCacheFilter != nil {
-		for _, filter := range target.NoCacheFilter {
+		for _, filter := range sortedSet(target.NoCacheFilter) {
 			args = append(args, "--no-cache-filter", filter)
 		}
 	}
 
 	// Add platforms
 	if target.Platforms != nil {
-		for _, platform := range target.Platforms {
+		for _, platform := range sortedSet(target.Platforms) {
 			args = append(args, "--platform", platform)
 		}
 	}
@@ -105,7 +119,7 @@ func constructDockerBuildCommandWithoutTags(target *bake.Target) []string {
 	// Add secrets
 	if target.Secrets != nil {
 		for _, secret := range target.Secrets {
-			args = append(args, "--secret", secret.String())
+			args = append(args, "--secret", templatedSecret(secret))
 		}
 	}
 
@@ -117,7 +131,7 @@ func constructDockerBuildCommandWithoutTags(target *bake.Target) []string {
 	// Add SSH keys
 	if target.SSH != nil {
 		for _, ssh := range target.SSH {
-			args = append(args, "--ssh", ssh.String())
+			args = append(args, "--ssh", templatedSSH(ssh))
 		}
 	}
 
@@ -128,22 +142,22 @@ func constructDockerBuildCommandWithoutTags(target *bake.Target) []string {
 
 	// Add ulimits
 	if target.Ulimits != nil {
-		for _, ulimit := range target.Ulimits {
+		for _, ulimit := range sortedSet(target.Ulimits) {
 			args = append(args, "--ulimit", ulimit)
 		}
 	}
 
 	// Add entitlements
 	if target.Entitlements != nil {
-		for _, entitlement := range target.Entitlements {
+		for _, entitlement := range sortedSet(target.Entitlements) {
 			args = append(args, "--allow", entitlement)
 		}
 	}
 
 	// Add extra hosts
 	if target.ExtraHosts != nil {
-		for host, ip := range target.ExtraHosts {
-			if ip != nil {
+		for _, host := range slices.Sorted(maps.Keys(target.ExtraHosts)) {
+			if ip := target.ExtraHosts[host]; ip != nil {
 				args = append(args, "--add-host", fmt.Sprintf("%s:%s", host, *ip))
 			}
 		}
@@ -168,16 +182,119 @@ func constructDockerBuildCommandWithoutTags(target *bake.Target) []string {
 	return args
 }
 
-func HashBakeTargets(targets map[string]*bake.Target, bakeFiles []string) string {
+// templatedSecret keeps only the id of the secret, like the --secret flag of docker build is normalized - where its
+// value comes from (a path, an env variable) does not matter
+func templatedSecret(secret *buildflags.Secret) string {
+	templated := "id=" + secret.ID
+	if secret.FilePath != "" {
+		templated += ",src=<VALUE>"
+	}
+	if secret.Env != "" {
+		templated += ",env=<VALUE>"
+	}
+	return templated
+}
+
+// templatedSSH keeps only the id of the ssh agent/keys, like the --ssh flag of docker build is normalized
+func templatedSSH(ssh *buildflags.SSH) string {
+	if len(ssh.Paths) == 0 {
+		return ssh.ID
+	}
+	return ssh.ID + "=<VALUE>"
+}
+
+// the prefix of the build contexts that are other targets of the bake definition, e.g. contexts = { base = "target:base" }
+const bakeTargetContextPrefix = "target:"
+
+// TargetDependencies returns the targets that the target uses as build contexts, sorted
+func TargetDependencies(target *bake.Target) []string {
+	dependencies := []string{}
+	for _, contextValue := range target.Contexts {
+		if dependency, ok := strings.CutPrefix(contextValue, bakeTargetContextPrefix); ok {
+			dependencies = append(dependencies, dependency)
+		}
+	}
+	return sortedSet(dependencies)
+}
+
+// withDependencyHashes returns the hash of each target including the hashes of the targets it uses as build contexts,
+// transitively: a change in the inputs of a base target changes the hash of every target built on top of it
+func withDependencyHashes(targets map[string]*bake.Target, ownHashes map[string]string) map[string]string {
+	hashes := map[string]string{}
+	var hashOf func(name string, visiting []string) string
+	hashOf = func(name string, visiting []string) string {
+		if hash, ok := hashes[name]; ok {
+			return hash
+		}
+		target, ok := targets[name]
+		if !ok || slices.Contains(visiting, name) {
+			// buildx refuses unknown targets and cycles - keep the reference itself in the hash
+			return bakeTargetContextPrefix + name
+		}
+
+		parts := []string{ownHashes[name]}
+		for _, dependency := range TargetDependencies(target) {
+			parts = append(parts, dependency+"="+hashOf(dependency, append(visiting, name)))
+		}
+		hash := parts[0]
+		if len(parts) > 1 {
+			hash = HashStrings(parts)
+		}
+		hashes[name] = hash
+		return hash
+	}
+
+	for name := range ownHashes {
+		hashOf(name, nil)
+	}
+	return hashes
+}
+
+func HashBakeTargets(targets map[string]*bake.Target, bakeFiles []string, options Options) string {
+	return hashBakeTargets(targets, bakeFiles, "", options)
+}
+
+// HashRemoteBakeTargets hashes the targets of a remote bake definition, checked out to checkoutDir: like buildx, their
+// relative contexts are in the repository of the definition, unless they are prefixed with "cwd://"
+func HashRemoteBakeTargets(targets map[string]*bake.Target, bakeFiles []string, checkoutDir string, options Options) string {
+	return hashBakeTargets(targets, bakeFiles, checkoutDir, options)
+}
+
+// remoteDefinitionContextPath resolves a named context of a target of a remote bake definition (see updateContext of buildx)
+func remoteDefinitionContextPath(checkoutDir string, contextPath string) string {
+	if localPath, ok := strings.CutPrefix(contextPath, "cwd://"); ok {
+		return localPath
+	}
+	if isRemoteContext(contextPath) || strings.Contains(contextPath, "://") || strings.HasPrefix(contextPath, "git@") || filepath.IsAbs(contextPath) {
+		return contextPath
+	}
+	return filepath.Join(checkoutDir, contextPath)
+}
+
+func hashBakeTargets(targets map[string]*bake.Target, bakeFiles []string, checkoutDir string, options Options) string {
 	// each target is basically its own docker build - so we reuse HashBuildCommand for each target and sum the hashes:
 
-	hashes := []string{}
+	cwd, err := os.Getwd()
+	if err != nil {
+		slog.Error("Error getting current working directory", "error", err)
+	}
+
+	ownHashes := map[string]string{}
 	for targetName, target := range targets {
 		if target.Context == nil || target.Dockerfile == nil {
 			continue
 		}
 
-		dockerIgnorePath := fileresolution.ResolveAbsoluteDockerIgnorePath(*target.Context, *target.Dockerfile)
+		// resolve the context and the dockerfile the same way buildx does, so that the result does not depend
+		// on anything but the bake definition (e.g. a dockerfile outside the context like "../shared/Dockerfile")
+		contextDir := cwd
+		if checkoutDir != "" && !strings.HasPrefix(*target.Context, "cwd://") {
+			contextDir = checkoutDir
+		}
+		absoluteContextPath := fileresolution.ResolveBakeContextPath(contextDir, *target.Context)
+		absoluteDockerfilePath := fileresolution.ResolveAbsoluteBakeDockerfilePath(cwd, absoluteContextPath, *target.Dockerfile)
+		dockerIgnorePath := fileresolution.ResolveAbsoluteDockerIgnorePath(absoluteContextPath, absoluteDockerfilePath)
+
 		allRegistryDomains := []string{}
 		for _, tag := range target.Tags {
 			allRegistryDomains = append(allRegistryDomains, argparse.ExtractRegistryDomain(tag))
@@ -186,35 +303,43 @@ func HashBakeTargets(targets map[string]*bake.Target, bakeFiles []string) string
 		// copy target.Contexts to allContexts as shortly as possible:
 		allContexts := make(map[string]string)
 		for k, v := range target.Contexts {
-			allContexts[k] = v
-		}
-		allContexts[configuration.MainBuildContextName] = *target.Context
-
-		// if dockerfile already not absolute, then it is relative to the context
-		absoluteDockerfilePath := *target.Dockerfile
-		var err error
-		if !filepath.IsAbs(absoluteDockerfilePath) {
-			absoluteDockerfilePath, err = filepath.Abs(filepath.Join(*target.Context, *target.Dockerfile))
-			if err != nil {
-				slog.Error("Error getting absolute path for dockerfile", "error", err)
+			if checkoutDir != "" {
+				allContexts[k] = remoteDefinitionContextPath(checkoutDir, v)
+				continue
 			}
+			allContexts[k] = strings.TrimPrefix(v, "cwd://")
 		}
+		allContexts[configuration.MainBuildContextName] = absoluteContextPath
 
 		correspondingDockerBuildCommand := DockerBuildCommand{
+			Name:                   targetName,
 			DockerfilePath:         absoluteDockerfilePath,
 			DockerignorePath:       dockerIgnorePath,
 			BuildContexts:          allContexts,
 			AllRegistryDomains:     allRegistryDomains,
-			CmdWithoutTagArguments: constructDockerBuildCommandWithoutTags(target),
+			CmdWithoutTagArguments: TemplateInfrastructureFlags(constructDockerBuildCommandWithoutTags(target), options.InfrastructureFlags),
 		}
 
 		slog.Debug("Corresponding docker build command for target", "target", targetName, "command", correspondingDockerBuildCommand)
 
-		hash := HashBuildCommand(correspondingDockerBuildCommand)
-		hashes = append(hashes, hash)
+		ownHashes[targetName] = HashBuildCommand(correspondingDockerBuildCommand, options)
 	}
 
-	hashes = append(hashes, HashFiles(bakeFiles, 1))
+	hashes := lo.Values(withDependencyHashes(targets, ownHashes))
+
+	bakeFilesHash := ""
+	var bakeFileHashes []fileHash
+	if len(bakeFiles) > 0 {
+		bakeFileHashes = hashEachFile(bakeFiles, 1, options)
+		bakeFilesHash = combineFileHashes(bakeFileHashes, options.fileHashAlgorithm())
+	}
+	hashes = append(hashes, bakeFilesHash)
+	recordBreakdown(HashBreakdown{
+		Name:      BakeFilesBreakdownName,
+		Files:     fileHashesByPath(bakeFileHashes),
+		FilesHash: bakeFilesHash,
+		Hash:      bakeFilesHash,
+	})
 
 	slices.Sort(hashes)
 
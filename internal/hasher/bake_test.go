@@ -8,12 +8,13 @@ import (
 	"testing"
 
 	"github.com/docker/buildx/bake"
+	"github.com/docker/buildx/util/buildflags"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestHashBakeTargets_EmptyTargets(t *testing.T) {
 	targets := map[string]*bake.Target{}
-	hash := HashBakeTargets(targets, []string{})
+	hash := HashBakeTargets(targets, []string{}, Options{})
 	if hash != "00000000000000000000000000000000" {
 		t.Errorf("Expected empty hash for empty targets, got %q", hash)
 	}
@@ -29,7 +30,7 @@ func TestHashBakeTargets_SingleTarget(t *testing.T) {
 			Tags:       []string{"myapp:latest"},
 		},
 	}
-	hash := HashBakeTargets(targets, []string{})
+	hash := HashBakeTargets(targets, []string{}, Options{})
 	if hash == "" {
 		t.Error("Expected non-empty hash for single target")
 	}
@@ -53,7 +54,7 @@ func TestHashBakeTargets_MultipleTargets(t *testing.T) {
 			Tags:       []string{"myapp/frontend:latest"},
 		},
 	}
-	hash := HashBakeTargets(targets, []string{})
+	hash := HashBakeTargets(targets, []string{}, Options{})
 	if hash == "" {
 		t.Error("Expected non-empty hash for multiple targets")
 	}
@@ -70,8 +71,8 @@ func TestHashBakeTargets_Deterministic(t *testing.T) {
 		},
 	}
 
-	hash1 := HashBakeTargets(targets, []string{})
-	hash2 := HashBakeTargets(targets, []string{})
+	hash1 := HashBakeTargets(targets, []string{}, Options{})
+	hash2 := HashBakeTargets(targets, []string{}, Options{})
 
 	if hash1 != hash2 {
 		t.Errorf("Expected same hash for same targets, got %q and %q", hash1, hash2)
@@ -110,8 +111,8 @@ func TestHashBakeTargets_DifferentOrder_Deterministic(t *testing.T) {
 		},
 	}
 
-	hash1 := HashBakeTargets(targets1, []string{})
-	hash2 := HashBakeTargets(targets2, []string{})
+	hash1 := HashBakeTargets(targets1, []string{}, Options{})
+	hash2 := HashBakeTargets(targets2, []string{}, Options{})
 
 	if hash1 != hash2 {
 		t.Errorf("Expected same hash for same targets in different order, got %q and %q", hash1, hash2)
@@ -132,7 +133,7 @@ func TestHashBakeTargets_WithBuildContexts(t *testing.T) {
 			},
 		},
 	}
-	hash := HashBakeTargets(targets, []string{})
+	hash := HashBakeTargets(targets, []string{}, Options{})
 	if hash == "" {
 		t.Error("Expected non-empty hash for target with build contexts")
 	}
@@ -148,7 +149,7 @@ func TestHashBakeTargets_WithMultipleTags(t *testing.T) {
 			Tags:       []string{"myapp:latest", "myapp:v1.0", "registry.com/myapp:latest"},
 		},
 	}
-	hash := HashBakeTargets(targets, []string{})
+	hash := HashBakeTargets(targets, []string{}, Options{})
 	if hash == "" {
 		t.Error("Expected non-empty hash for target with multiple tags")
 	}
@@ -171,18 +172,18 @@ func TestHashBakeTargets_WithBakeFiles(t *testing.T) {
 		t.Fatalf("Failed to read bake targets: %v", err)
 	}
 
-	hash := HashBakeTargets(targets, []string{bakeFile})
+	hash := HashBakeTargets(targets, []string{bakeFile}, Options{})
 	if hash == "" {
 		t.Error("Expected non-empty hash for target with bake files")
 	}
-	hashWithoutBakeFiles := HashBakeTargets(targets, []string{})
+	hashWithoutBakeFiles := HashBakeTargets(targets, []string{}, Options{})
 	assert.NotEqual(t, hash, hashWithoutBakeFiles, "Expected different hashes for targets with and without bake files")
 
 	err = os.WriteFile(bakeFile, []byte(`{"targets": {"app": {"context": ".", "dockerfile": "Dockerfile.frontend"}}}`), 0644)
 	if err != nil {
 		t.Fatalf("Failed to write bake file: %v", err)
 	}
-	hashWithChangedBakeFile := HashBakeTargets(targets, []string{bakeFile})
+	hashWithChangedBakeFile := HashBakeTargets(targets, []string{bakeFile}, Options{})
 	assert.NotEqual(t, hash, hashWithChangedBakeFile, "Expected different hashes for targets with and without changed bake file")
 }
 
@@ -872,3 +873,144 @@ func TestConstructTemplatedDockerBuildCommand_EmptyMaps(t *testing.T) {
 		}
 	}
 }
+
+func TestHashBakeTargets_DockerfileOutsideContext(t *testing.T) {
+	// the same checkout in two different directories, as on two CI runners
+	writeCheckout := func() string {
+		rootDir := t.TempDir()
+		assert.NoError(t, os.MkdirAll(filepath.Join(rootDir, "services", "api"), 0755))
+		assert.NoError(t, os.MkdirAll(filepath.Join(rootDir, "services", "shared"), 0755))
+		assert.NoError(t, os.WriteFile(filepath.Join(rootDir, "services", "api", "main.go"), []byte("package main"), 0644))
+		assert.NoError(t, os.WriteFile(filepath.Join(rootDir, "services", "shared", "Dockerfile"), []byte("FROM alpine:3.20"), 0644))
+		return rootDir
+	}
+	firstCheckout := writeCheckout()
+	secondCheckout := writeCheckout()
+
+	// relative to the working directory, like the contexts of a bake file run from its directory
+	contextDir := filepath.Join("services", "api")
+	dockerfile := "../shared/Dockerfile"
+	targets := map[string]*bake.Target{
+		"api": {
+			Context:    &contextDir,
+			Dockerfile: &dockerfile,
+			Tags:       []string{"myapp/api:latest"},
+		},
+	}
+
+	// the hash must not depend on the directory mimosa is run from
+	t.Chdir(firstCheckout)
+	hashFromFirstCheckout := HashBakeTargets(targets, []string{}, Options{})
+	t.Chdir(secondCheckout)
+	hashFromSecondCheckout := HashBakeTargets(targets, []string{}, Options{})
+	assert.Equal(t, hashFromFirstCheckout, hashFromSecondCheckout, "Expected the same hash regardless of the working directory")
+
+	// the dockerfile outside of the context must be part of the hash
+	assert.NoError(t, os.WriteFile(filepath.Join(secondCheckout, "services", "shared", "Dockerfile"), []byte("FROM alpine:3.21"), 0644))
+	hashWithChangedDockerfile := HashBakeTargets(targets, []string{}, Options{})
+	assert.NotEqual(t, hashFromFirstCheckout, hashWithChangedDockerfile, "Expected a different hash when the dockerfile outside the context changes")
+}
+
+func TestHashBakeTargets_DockerfileOutsideContext_DockerignoreNextToDockerfile(t *testing.T) {
+	rootDir := t.TempDir()
+	contextDir := filepath.Join(rootDir, "app")
+	sharedDir := filepath.Join(rootDir, "shared")
+	assert.NoError(t, os.MkdirAll(contextDir, 0755))
+	assert.NoError(t, os.MkdirAll(sharedDir, 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(contextDir, "main.go"), []byte("package main"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(sharedDir, "Dockerfile"), []byte("FROM alpine:3.20"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(sharedDir, "Dockerfile.dockerignore"), []byte("*.log\n"), 0644))
+
+	dockerfile := "../shared/Dockerfile"
+	targets := map[string]*bake.Target{
+		"app": {
+			Context:    &contextDir,
+			Dockerfile: &dockerfile,
+			Tags:       []string{"myapp:latest"},
+		},
+	}
+
+	t.Chdir(rootDir)
+	hashBefore := HashBakeTargets(targets, []string{}, Options{})
+
+	// ignored by the Dockerfile-specific dockerignore, so the hash must not change
+	assert.NoError(t, os.WriteFile(filepath.Join(contextDir, "debug.log"), []byte("irrelevant"), 0644))
+	hashAfter := HashBakeTargets(targets, []string{}, Options{})
+
+	assert.Equal(t, hashBefore, hashAfter, "Expected files ignored by the dockerfile-specific dockerignore to not affect the hash")
+}
+
+func TestConstructTemplatedDockerBuildCommand_SecretsAndSSH(t *testing.T) {
+	target := &bake.Target{
+		Secrets: buildflags.Secrets{
+			{ID: "npmrc", FilePath: "/home/runner/work/_temp/npmrc"},
+			{ID: "token", Env: "GITHUB_TOKEN"},
+			{ID: "bare"},
+		},
+		SSH: buildflags.SSHKeys{
+			{ID: "default"},
+			{ID: "github", Paths: []string{"/home/runner/.ssh/id_rsa"}},
+		},
+	}
+	args := constructDockerBuildCommandWithoutTags(target)
+
+	assert.Equal(t, []string{
+		"docker", "buildx", "build",
+		"--secret", "id=npmrc,src=<VALUE>",
+		"--secret", "id=token,env=<VALUE>",
+		"--secret", "id=bare",
+		"--ssh", "default",
+		"--ssh", "github=<VALUE>",
+		".",
+	}, args)
+}
+
+func TestConstructTemplatedDockerBuildCommand_IsCanonical(t *testing.T) {
+	one, two := "1", "2"
+	target := func(platforms []string, entitlements []string) *bake.Target {
+		return &bake.Target{
+			Args:         map[string]*string{"A": &one, "B": &two, "C": &one, "D": &two},
+			Labels:       map[string]*string{"x": &one, "y": &two, "z": &one},
+			Platforms:    platforms,
+			Entitlements: entitlements,
+		}
+	}
+
+	expected := constructDockerBuildCommandWithoutTags(target([]string{"linux/amd64", "linux/arm64"}, []string{"network.host", "security.insecure"}))
+	for range 20 {
+		assert.Equal(t, expected, constructDockerBuildCommandWithoutTags(target([]string{"linux/arm64", "linux/amd64", "linux/arm64"}, []string{"security.insecure", "network.host"})))
+	}
+	assert.Equal(t, []string{
+		"docker", "buildx", "build",
+		"--build-arg", "A=1", "--build-arg", "B=2", "--build-arg", "C=1", "--build-arg", "D=2",
+		"--label", "x=1", "--label", "y=2", "--label", "z=1",
+		"--platform", "linux/amd64", "--platform", "linux/arm64",
+		"--allow", "network.host", "--allow", "security.insecure",
+		".",
+	}, expected)
+}
+
+func TestWithDependencyHashes(t *testing.T) {
+	targets := map[string]*bake.Target{
+		"base": {},
+		"lib":  {Contexts: map[string]string{"base": "target:base"}},
+		"app":  {Contexts: map[string]string{"lib": "target:lib", "src": "./src"}},
+		"docs": {},
+	}
+
+	hashes := withDependencyHashes(targets, map[string]string{"base": "b1", "lib": "l1", "app": "a1", "docs": "d1"})
+	assert.Equal(t, "b1", hashes["base"])
+	assert.Equal(t, "d1", hashes["docs"], "targets without dependencies keep their own hash")
+	assert.NotEqual(t, "a1", hashes["app"])
+
+	// the inputs of base reach app through lib
+	changed := withDependencyHashes(targets, map[string]string{"base": "b2", "lib": "l1", "app": "a1", "docs": "d1"})
+	assert.NotEqual(t, hashes["lib"], changed["lib"])
+	assert.NotEqual(t, hashes["app"], changed["app"])
+	assert.Equal(t, hashes["docs"], changed["docs"])
+}
+
+func TestTargetDependencies(t *testing.T) {
+	target := &bake.Target{Contexts: map[string]string{"b": "target:base", "a": "target:tools", "src": "./src", "img": "docker-image://alpine"}}
+	assert.Equal(t, []string{"base", "tools"}, TargetDependencies(target))
+}
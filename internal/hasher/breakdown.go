@@ -0,0 +1,72 @@
+package hasher
+
+import (
+	"encoding/hex"
+	"sync"
+)
+
+// BakeFilesBreakdownName is the name of the breakdown of the bake files themselves
+const BakeFilesBreakdownName = "<bake files>"
+
+// HashBreakdown is the hash of each component of a build - it explains why two builds have different hashes
+type HashBreakdown struct {
+	// the name of the build, "default" for docker build or the bake target
+	Name                string
+	Command             []string // the normalized command that is hashed
+	CommandHash         string
+	RegistryDomains     []string
+	RegistryDomainsHash string
+	Files               map[string]string // path -> hash of every hashed file
+	FilesHash           string
+	Hash                string
+}
+
+var breakdowns = struct {
+	mu        sync.Mutex
+	recording bool
+	recorded  []HashBreakdown
+}{}
+
+// RecordBreakdowns starts recording the breakdown of every hashed build
+func RecordBreakdowns() {
+	breakdowns.mu.Lock()
+	defer breakdowns.mu.Unlock()
+
+	breakdowns.recording = true
+	breakdowns.recorded = []HashBreakdown{}
+}
+
+// StopRecordingBreakdowns stops recording and returns the breakdowns recorded since RecordBreakdowns
+func StopRecordingBreakdowns() []HashBreakdown {
+	breakdowns.mu.Lock()
+	defer breakdowns.mu.Unlock()
+
+	breakdowns.recording = false
+	recorded := breakdowns.recorded
+	breakdowns.recorded = nil
+	return recorded
+}
+
+func isRecordingBreakdowns() bool {
+	breakdowns.mu.Lock()
+	defer breakdowns.mu.Unlock()
+
+	return breakdowns.recording
+}
+
+func recordBreakdown(breakdown HashBreakdown) {
+	breakdowns.mu.Lock()
+	defer breakdowns.mu.Unlock()
+
+	if breakdowns.recording {
+		breakdowns.recorded = append(breakdowns.recorded, breakdown)
+	}
+}
+
+func fileHashesByPath(fileHashes []fileHash) map[string]string {
+	byPath := make(map[string]string, len(fileHashes))
+	for _, h := range fileHashes {
+		byPath[h.path] = hex.EncodeToString(h.hash)
+	}
+	return byPath
+}
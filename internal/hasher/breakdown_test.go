@@ -0,0 +1,43 @@
+package hasher
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hytromo/mimosa/internal/configuration"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordBreakdowns(t *testing.T) {
+	contextDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(contextDir, "app.txt"), []byte("app"), 0644))
+
+	command := DockerBuildCommand{
+		Name:                   "default",
+		AllRegistryDomains:     []string{"index.docker.io", "index.docker.io"},
+		BuildContexts:          map[string]string{configuration.MainBuildContextName: contextDir},
+		CmdWithoutTagArguments: []string{"docker", "buildx", "build", "."},
+	}
+
+	hash := HashBuildCommand(command, Options{})
+	assert.Empty(t, StopRecordingBreakdowns(), "nothing is recorded by default")
+
+	RecordBreakdowns()
+	assert.Equal(t, hash, HashBuildCommand(command, Options{}), "recording does not change the hash")
+	breakdowns := StopRecordingBreakdowns()
+
+	require.Len(t, breakdowns, 1)
+	breakdown := breakdowns[0]
+	assert.Equal(t, "default", breakdown.Name)
+	assert.Equal(t, hash, breakdown.Hash)
+	assert.Equal(t, []string{"docker", "buildx", "build", "."}, breakdown.Command)
+	assert.Equal(t, []string{"index.docker.io"}, breakdown.RegistryDomains)
+	assert.Equal(t, registryDomainsHash(command.AllRegistryDomains), breakdown.RegistryDomainsHash)
+	assert.Contains(t, breakdown.Files, filepath.Join(contextDir, "app.txt"))
+	assert.Equal(t, HashFiles([]string{filepath.Join(contextDir, "app.txt")}, 1, FileHashAlgorithmImo), breakdown.FilesHash)
+
+	HashBuildCommand(command, Options{})
+	assert.Empty(t, StopRecordingBreakdowns(), "nothing is recorded after stopping")
+}
@@ -9,6 +9,7 @@ import (
 	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
 
 	"github.com/hytromo/mimosa/internal/configuration"
 	"github.com/hytromo/mimosa/internal/logger"
@@ -18,6 +19,7 @@ import (
 
 // DockerBuildCommand is a struct that contains the information needed to hash a docker build command
 type DockerBuildCommand struct {
+	Name                   string // the name of the build, used only for reporting (e.g. the bake target)
 	DockerfilePath         string
 	DockerignorePath       string
 	BuildContexts          map[string]string
@@ -37,14 +39,52 @@ func registryDomainsHash(registryDomains []string) string {
 	return HashStrings(domains)
 }
 
-func HashBuildCommand(command DockerBuildCommand) string {
+// isRemoteContext reports whether the build context is not a local directory, e.g. a git URL, an image or another
+// bake target
+func isRemoteContext(contextPath string) bool {
+	return strings.HasPrefix(contextPath, "https://") || strings.HasPrefix(contextPath, "docker-image://") || strings.HasPrefix(contextPath, "oci-layout://") ||
+		strings.HasPrefix(contextPath, bakeTargetContextPrefix)
+}
+
+// the scheme of the build contexts that are OCI image layouts on the local filesystem, e.g.
+// oci-layout:///tmp/layout@sha256:... - their files (index.json and blobs) are what identifies their content
+const ociLayoutContextScheme = "oci-layout://"
+
+// localContextPath returns the local directory of the build context to hash the files of, if it has one: a directory,
+// or the directory of an OCI layout (without its tag or digest)
+func localContextPath(contextPath string) (string, bool) {
+	if layoutPath, ok := strings.CutPrefix(contextPath, ociLayoutContextScheme); ok {
+		layoutPath, _, _ = strings.Cut(layoutPath, "@")
+		if separator := strings.LastIndex(layoutPath, ":"); separator > strings.LastIndex(layoutPath, "/") {
+			layoutPath = layoutPath[:separator]
+		}
+		return layoutPath, layoutPath != ""
+	}
+	return contextPath, !isRemoteContext(contextPath)
+}
+
+func HashBuildCommand(command DockerBuildCommand, options Options) string {
+	key := gitTreeKey(command, options)
+	if hash, ok := gitTreeHash(key); ok {
+		return hash
+	}
+
+	hash := hashBuildCommand(command, options)
+	// a cancelled hashing returns a wrong hash
+	if !options.cancelled() {
+		rememberGitTreeHash(key, hash)
+	}
+	return hash
+}
+
+func hashBuildCommand(command DockerBuildCommand, options Options) string {
 	registryDomainsHash := registryDomainsHash(command.AllRegistryDomains)
 
 	allLocalContexts := map[string]string{} // context name -> context path
 	// find all the included files of the build contexts that are local
 	for contextName, contextPath := range command.BuildContexts {
-		if !strings.HasPrefix(contextPath, "https://") && !strings.HasPrefix(contextPath, "docker-image://") && !strings.HasPrefix(contextPath, "oci-layout://") {
-			allLocalContexts[contextName] = contextPath
+		if localPath, ok := localContextPath(contextPath); ok {
+			allLocalContexts[contextName] = localPath
 		}
 	}
 
@@ -62,6 +102,8 @@ func HashBuildCommand(command DockerBuildCommand) string {
 
 	// Start workers
 	var wg sync.WaitGroup
+	var processedContexts atomic.Int32
+	logger.Progress.Phase("hashing build contexts (0/%d)", len(allLocalContexts))
 	for i := 0; i < nWorkers; i++ {
 		wg.Add(1)
 		go func() {
@@ -82,7 +124,11 @@ func HashBuildCommand(command DockerBuildCommand) string {
 				}
 
 				// Get all included files for this context
-				includedFiles, err := fileutil.IncludedFiles(contextPath, dockerIgnorePath)
+				includedFiles, err := includedFilesMemo.get(contextPath+"\x00"+dockerIgnorePath, func() ([]string, error) {
+					return fileutil.IncludedFiles(contextPath, dockerIgnorePath)
+				})
+				// the memoized slice is shared between builds, never append to it
+				includedFiles = slices.Clone(includedFiles)
 
 				if err != nil {
 					slog.Error("Error getting included files for context", "context", contextName, "error", err)
@@ -110,6 +156,7 @@ func HashBuildCommand(command DockerBuildCommand) string {
 
 				// Hash the context files
 				includedFilesChan <- includedFiles
+				logger.Progress.Phase("hashing build contexts (%d/%d)", processedContexts.Add(1), len(allLocalContexts))
 			}
 		}()
 	}
@@ -133,15 +180,23 @@ func HashBuildCommand(command DockerBuildCommand) string {
 		allFilesAcrossContexts = append(allFilesAcrossContexts, files...)
 	}
 
-	cmdHash := HashStrings([]string{strings.Join(command.CmdWithoutTagArguments, " ")})
-	filesHash := HashFiles(allFilesAcrossContexts, nWorkers)
+	logger.Progress.Phase("hashing %d files", len(allFilesAcrossContexts))
+	reportContextStats(command.Name, allFilesAcrossContexts)
+	normalizedCommand := templateDynamicValues(workspaceRelativePaths(command.CmdWithoutTagArguments, options.WorkspaceRoot), options.AggressiveNormalize)
+	cmdHash := HashStrings([]string{strings.Join(normalizedCommand, " ")})
+	var fileHashes []fileHash
+	filesHash := ""
+	if len(allFilesAcrossContexts) > 0 {
+		fileHashes = hashEachFile(allFilesAcrossContexts, nWorkers, options)
+		filesHash = combineFileHashes(fileHashes, options.fileHashAlgorithm())
+	}
 
 	if logger.IsDebugEnabled() {
 		slog.Debug("Hashed files across build contexts", "fileCount", len(allFilesAcrossContexts), "contextCount", len(allLocalContexts))
 		slog.Debug("Build command hashes", "cmdHash", cmdHash, "filesHash", filesHash, "registryDomainsHash", registryDomainsHash)
 	}
 
-	return HashStrings([]string{
+	hash := HashStrings([]string{
 		// the command itself (without tags)
 		cmdHash,
 		// the domains used to push the image to
@@ -151,4 +206,19 @@ func HashBuildCommand(command DockerBuildCommand) string {
 		// includes all the build contexts' files, plus dockerfile (and maybe dockerignore)
 		filesHash,
 	})
+
+	if isRecordingBreakdowns() {
+		recordBreakdown(HashBreakdown{
+			Name:                command.Name,
+			Command:             normalizedCommand,
+			CommandHash:         cmdHash,
+			RegistryDomains:     lo.Uniq(command.AllRegistryDomains),
+			RegistryDomainsHash: registryDomainsHash,
+			Files:               fileHashesByPath(fileHashes),
+			FilesHash:           filesHash,
+			Hash:                hash,
+		})
+	}
+
+	return hash
 }
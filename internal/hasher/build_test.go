@@ -11,6 +11,7 @@ import (
 	"github.com/hytromo/mimosa/internal/configuration"
 	fileresolution "github.com/hytromo/mimosa/internal/docker/file_resolution"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestRegistryDomainsHash_EmptyInput(t *testing.T) {
@@ -42,7 +43,7 @@ func TestRegistryDomainsHash_DuplicateDomains(t *testing.T) {
 }
 
 func TestHashBuildCommand_EmptyCommand(t *testing.T) {
-	hash := HashBuildCommand(DockerBuildCommand{})
+	hash := HashBuildCommand(DockerBuildCommand{}, Options{})
 	assert.NotEqual(t, hash, "", "Expected non-empty hash for empty command")
 }
 
@@ -51,7 +52,7 @@ func TestHashBuildCommand_WithRegistryDomains(t *testing.T) {
 		AllRegistryDomains:     []string{"index.docker.io", "gcr.io"},
 		CmdWithoutTagArguments: []string{"docker", "buildx", "build", "."},
 	}
-	hash := HashBuildCommand(command)
+	hash := HashBuildCommand(command, Options{})
 	assert.NotEqual(t, hash, "", "Expected non-empty hash for command with registry domains")
 }
 
@@ -69,14 +70,14 @@ func TestHashBuildCommand_WithBuildContexts_Local(t *testing.T) {
 		},
 		CmdWithoutTagArguments: []string{"docker", "buildx", "build", "."},
 	}
-	hash := HashBuildCommand(command)
+	hash := HashBuildCommand(command, Options{})
 	assert.NotEqual(t, hash, "", "Expected non-empty hash for command with local build context")
 
 	// change the file content:
 	if err := os.WriteFile(testFile, []byte("test content 2"), 0644); err != nil {
 		t.Fatalf("Failed to create test file: %v", err)
 	}
-	hash2 := HashBuildCommand(command)
+	hash2 := HashBuildCommand(command, Options{})
 	assert.NotEqual(t, hash, hash2, "Expected different hash for command with changed file content")
 }
 
@@ -87,14 +88,14 @@ func TestHashBuildCommand_WithBuildContexts_Remote(t *testing.T) {
 		},
 		CmdWithoutTagArguments: []string{"docker", "buildx", "build", "."},
 	}
-	hash := HashBuildCommand(command)
+	hash := HashBuildCommand(command, Options{})
 	assert.NotEqual(t, hash, "", "Expected non-empty hash for command with remote build context")
 	// expect the same hash for the same command without the remote context
 	commandWithoutRemote := DockerBuildCommand{
 		BuildContexts:          map[string]string{},
 		CmdWithoutTagArguments: []string{"docker", "buildx", "build", "."},
 	}
-	hashWithoutRemote := HashBuildCommand(commandWithoutRemote)
+	hashWithoutRemote := HashBuildCommand(commandWithoutRemote, Options{})
 	assert.Equal(t, hash, hashWithoutRemote, "Expected same hash for command with and without remote build context")
 }
 
@@ -105,14 +106,14 @@ func TestHashBuildCommand_WithBuildContexts_DockerImage(t *testing.T) {
 		},
 		CmdWithoutTagArguments: []string{"docker", "buildx", "build", "."},
 	}
-	hash := HashBuildCommand(command)
+	hash := HashBuildCommand(command, Options{})
 	assert.NotEqual(t, hash, "", "Expected non-empty hash for command with docker-image build context")
 	// expect the same hash for the same command without the docker-image context
 	commandWithoutDockerImage := DockerBuildCommand{
 		BuildContexts:          map[string]string{},
 		CmdWithoutTagArguments: []string{"docker", "buildx", "build", "."},
 	}
-	hashWithoutDockerImage := HashBuildCommand(commandWithoutDockerImage)
+	hashWithoutDockerImage := HashBuildCommand(commandWithoutDockerImage, Options{})
 	assert.Equal(t, hash, hashWithoutDockerImage, "Expected same hash for command with and without docker-image build context")
 }
 
@@ -123,17 +124,49 @@ func TestHashBuildCommand_WithBuildContexts_OCILayout(t *testing.T) {
 		},
 		CmdWithoutTagArguments: []string{"docker", "buildx", "build", "."},
 	}
-	hash := HashBuildCommand(command)
+	hash := HashBuildCommand(command, Options{})
 	assert.NotEqual(t, hash, "", "Expected non-empty hash for command with oci-layout build context")
 	// expect the same hash for the same command without the oci-layout context
 	commandWithoutOCILayout := DockerBuildCommand{
 		BuildContexts:          map[string]string{},
 		CmdWithoutTagArguments: []string{"docker", "buildx", "build", "."},
 	}
-	hashWithoutOCILayout := HashBuildCommand(commandWithoutOCILayout)
+	hashWithoutOCILayout := HashBuildCommand(commandWithoutOCILayout, Options{})
 	assert.Equal(t, hash, hashWithoutOCILayout, "Expected same hash for command with and without oci-layout build context")
 }
 
+func TestHashBuildCommand_WithBuildContexts_LocalOCILayout(t *testing.T) {
+	layoutDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(layoutDir, "index.json"), []byte(`{"manifests":[]}`), 0o644))
+	command := DockerBuildCommand{
+		BuildContexts:          map[string]string{"oci": "oci-layout://" + layoutDir + ":v1"},
+		CmdWithoutTagArguments: []string{"docker", "buildx", "build", "."},
+	}
+	hash := HashBuildCommand(command, Options{})
+
+	require.NoError(t, os.WriteFile(filepath.Join(layoutDir, "index.json"), []byte(`{"manifests":[{}]}`), 0o644))
+	assert.NotEqual(t, hash, HashBuildCommand(command, Options{}), "the files of the layout are its content")
+}
+
+func TestLocalContextPath(t *testing.T) {
+	for contextPath, expected := range map[string]string{
+		"./shared":                         "./shared",
+		"oci-layout:///tmp/layout":         "/tmp/layout",
+		"oci-layout:///tmp/layout:v1":      "/tmp/layout",
+		"oci-layout://layout@sha256:abcd":  "layout",
+		"oci-layout://../my:dir/layout:v1": "../my:dir/layout",
+	} {
+		localPath, ok := localContextPath(contextPath)
+		assert.True(t, ok, contextPath)
+		assert.Equal(t, expected, localPath, contextPath)
+	}
+
+	for _, contextPath := range []string{"https://github.com/user/repo.git", "docker-image://alpine:3.20", "target:base", "oci-layout://"} {
+		_, ok := localContextPath(contextPath)
+		assert.False(t, ok, contextPath)
+	}
+}
+
 func TestHashBuildCommand_WithBuildContexts_Mixed(t *testing.T) {
 	dir := t.TempDir()
 
@@ -150,7 +183,7 @@ func TestHashBuildCommand_WithBuildContexts_Mixed(t *testing.T) {
 		},
 		CmdWithoutTagArguments: []string{"docker", "buildx", "build", "."},
 	}
-	hash := HashBuildCommand(command)
+	hash := HashBuildCommand(command, Options{})
 	assert.NotEqual(t, hash, "", "Expected non-empty hash for command with mixed build contexts")
 	// expect the same hash for the same command without the mixed contexts
 	commandWithoutMixed := DockerBuildCommand{
@@ -159,7 +192,7 @@ func TestHashBuildCommand_WithBuildContexts_Mixed(t *testing.T) {
 		},
 		CmdWithoutTagArguments: []string{"docker", "buildx", "build", "."},
 	}
-	hashWithoutMixed := HashBuildCommand(commandWithoutMixed)
+	hashWithoutMixed := HashBuildCommand(commandWithoutMixed, Options{})
 	assert.Equal(t, hash, hashWithoutMixed, "Expected same hash for command with and without mixed build contexts")
 
 	// add a file inside dir
@@ -167,7 +200,7 @@ func TestHashBuildCommand_WithBuildContexts_Mixed(t *testing.T) {
 	if err := os.WriteFile(testFile2, []byte("test content 2"), 0644); err != nil {
 		t.Fatalf("Failed to create test file: %v", err)
 	}
-	hash2 := HashBuildCommand(command)
+	hash2 := HashBuildCommand(command, Options{})
 	assert.NotEqual(t, hash, hash2, "Expected different hash for command with changed file content")
 }
 
@@ -178,7 +211,7 @@ func TestHashBuildCommand_WithBuildContexts_Malformed(t *testing.T) {
 		},
 		CmdWithoutTagArguments: []string{"docker", "buildx", "build", "."},
 	}
-	hash := HashBuildCommand(command)
+	hash := HashBuildCommand(command, Options{})
 	assert.NotEqual(t, hash, "", "Expected non-empty hash for command with malformed build context")
 }
 
@@ -205,19 +238,19 @@ func TestHashBuildCommand_WithDockerfileAndDockerignore(t *testing.T) {
 		},
 		CmdWithoutTagArguments: []string{"docker", "buildx", "build", "."},
 	}
-	hash := HashBuildCommand(command)
+	hash := HashBuildCommand(command, Options{})
 	assert.NotEqual(t, hash, "", "Expected non-empty hash for command with Dockerfile and .dockerignore")
 	// create a file with .tmp extension and expect the same hash
 	testFile := filepath.Join(dir, "test.tmp")
 	if err := os.WriteFile(testFile, []byte("test content"), 0644); err != nil {
 		t.Fatalf("Failed to create test file: %v", err)
 	}
-	hash2 := HashBuildCommand(command)
+	hash2 := HashBuildCommand(command, Options{})
 	assert.Equal(t, hash, hash2, "Expected same hash for command with and without .tmp file")
 	// remove .dockerignore and expect different hash
 	err := os.Remove(dockerignore)
 	assert.NoError(t, err)
-	hash3 := HashBuildCommand(command)
+	hash3 := HashBuildCommand(command, Options{})
 	assert.NotEqual(t, hash, hash3, "Expected different hash for command without .dockerignore")
 }
 
@@ -237,14 +270,14 @@ func TestHashBuildCommand_WithDockerfileOnly(t *testing.T) {
 		},
 		CmdWithoutTagArguments: []string{"docker", "buildx", "build", "."},
 	}
-	hash := HashBuildCommand(command)
+	hash := HashBuildCommand(command, Options{})
 	assert.NotEqual(t, hash, "", "Expected non-empty hash for command with Dockerfile only")
 
 	// add to Dockerfile and expect different hash
 	if err := os.WriteFile(dockerfile, []byte("FROM alpine\nRUN echo 'test content' > test.txt"), 0644); err != nil {
 		t.Fatalf("Failed to create Dockerfile: %v", err)
 	}
-	hash2 := HashBuildCommand(command)
+	hash2 := HashBuildCommand(command, Options{})
 	assert.NotEqual(t, hash, hash2, "Expected different hash for command with changed Dockerfile")
 }
 
@@ -257,7 +290,7 @@ func TestHashBuildCommand_WithNonMainContext_NoDockerignore(t *testing.T) {
 		},
 		CmdWithoutTagArguments: []string{"docker", "buildx", "build", "."},
 	}
-	hash := HashBuildCommand(command)
+	hash := HashBuildCommand(command, Options{})
 	assert.NotEqual(t, hash, "", "Expected non-empty hash for command with non-main context without .dockerignore")
 }
 
@@ -283,7 +316,7 @@ func TestHashBuildCommand_WithMultipleLocalContexts(t *testing.T) {
 		},
 		CmdWithoutTagArguments: []string{"docker", "buildx", "build", "."},
 	}
-	hash := HashBuildCommand(command)
+	hash := HashBuildCommand(command, Options{})
 	if hash == "" {
 		t.Error("Expected non-empty hash for command with multiple local contexts")
 	}
@@ -305,8 +338,8 @@ func TestHashBuildCommand_Deterministic(t *testing.T) {
 		CmdWithoutTagArguments: []string{"docker", "buildx", "build", "."},
 	}
 
-	hash1 := HashBuildCommand(command)
-	hash2 := HashBuildCommand(command)
+	hash1 := HashBuildCommand(command, Options{})
+	hash2 := HashBuildCommand(command, Options{})
 
 	assert.Equal(t, hash1, hash2, "Expected same hash for same command")
 }
@@ -333,8 +366,8 @@ func TestHashBuildCommand_DifferentCommands_DifferentHashes(t *testing.T) {
 		CmdWithoutTagArguments: []string{"docker", "buildx", "build", "--no-cache", "."},
 	}
 
-	hash1 := HashBuildCommand(command1)
-	hash2 := HashBuildCommand(command2)
+	hash1 := HashBuildCommand(command1, Options{})
+	hash2 := HashBuildCommand(command2, Options{})
 
 	assert.NotEqual(t, hash1, hash2, "Expected different hashes for different commands")
 }
@@ -363,8 +396,8 @@ func TestHashBuildCommand_DifferentRegistryDomains_DifferentHashes(t *testing.T)
 		CmdWithoutTagArguments: []string{"docker", "buildx", "build", "--push", "."},
 	}
 
-	hash1 := HashBuildCommand(command1)
-	hash2 := HashBuildCommand(command2)
+	hash1 := HashBuildCommand(command1, Options{})
+	hash2 := HashBuildCommand(command2, Options{})
 
 	assert.NotEqual(t, hash1, hash2, "Expected different hashes for different registry domains")
 }
@@ -385,9 +418,9 @@ func TestHashBuildCommand_WithLargeNumberOfContexts(t *testing.T) {
 		BuildContexts:          contexts,
 		CmdWithoutTagArguments: []string{"docker", "buildx", "build", "."},
 	}
-	hash := HashBuildCommand(command)
+	hash := HashBuildCommand(command, Options{})
 	assert.NotEqual(t, hash, "", "Expected non-empty hash for command with many contexts")
-	hash2 := HashBuildCommand(command)
+	hash2 := HashBuildCommand(command, Options{})
 	assert.Equal(t, hash, hash2, "Expected same hash for command with many contexts")
 }
 
@@ -423,7 +456,7 @@ func TestHashBuildCommand_WithContextContainingSpecialFiles(t *testing.T) {
 		},
 		CmdWithoutTagArguments: []string{"docker", "buildx", "build", "."},
 	}
-	hash := HashBuildCommand(command)
+	hash := HashBuildCommand(command, Options{})
 	assert.NotEqual(t, hash, "", "Expected non-empty hash for command with special files")
 	// ignore subdir through a dockerignore file:
 	dockerignore := filepath.Join(dir, ".dockerignore")
@@ -432,12 +465,12 @@ func TestHashBuildCommand_WithContextContainingSpecialFiles(t *testing.T) {
 	}
 	command.DockerignorePath = fileresolution.ResolveAbsoluteDockerIgnorePath(dir, filepath.Join(dir, "Dockerfile"))
 
-	hash2 := HashBuildCommand(command)
+	hash2 := HashBuildCommand(command, Options{})
 	assert.NotEqual(t, hash, hash2, "Expected same hash for command with special files and dockerignore")
 	// but if we remove subdir we expect the same hash - as it is anyway ignored
 	err := os.RemoveAll(filepath.Join(dir, "subdir"))
 	assert.NoError(t, err)
-	hash3 := HashBuildCommand(command)
+	hash3 := HashBuildCommand(command, Options{})
 	assert.Equal(t, hash2, hash3, "Expected same hash for command with special files and dockerignore")
 }
 
@@ -456,7 +489,7 @@ func TestHashBuildCommand_WithNilCommandString(t *testing.T) {
 		AllRegistryDomains:     []string{"index.docker.io"},
 		CmdWithoutTagArguments: nil,
 	}
-	hash := HashBuildCommand(command)
+	hash := HashBuildCommand(command, Options{})
 	assert.NotEqual(t, hash, "", "Expected non-empty hash for command with nil command string")
 }
 
@@ -467,7 +500,7 @@ func TestHashBuildCommand_WithContextPathStartingWithEquals(t *testing.T) {
 		},
 		CmdWithoutTagArguments: []string{"docker", "buildx", "build", "."},
 	}
-	hash := HashBuildCommand(command)
+	hash := HashBuildCommand(command, Options{})
 	assert.NotEqual(t, hash, "", "Expected non-empty hash for command with context path starting with equals")
 }
 
@@ -478,7 +511,7 @@ func TestHashBuildCommand_WithContextPathEndingWithEquals(t *testing.T) {
 		},
 		CmdWithoutTagArguments: []string{"docker", "buildx", "build", "."},
 	}
-	hash := HashBuildCommand(command)
+	hash := HashBuildCommand(command, Options{})
 	assert.NotEqual(t, hash, "", "Expected non-empty hash for command with context path ending with equals")
 }
 
@@ -489,7 +522,7 @@ func TestHashBuildCommand_WithContextPathMultipleEquals(t *testing.T) {
 		},
 		CmdWithoutTagArguments: []string{"docker", "buildx", "build", "."},
 	}
-	hash := HashBuildCommand(command)
+	hash := HashBuildCommand(command, Options{})
 	assert.NotEqual(t, hash, "", "Expected non-empty hash for command with context path multiple equals")
 }
 
@@ -500,7 +533,7 @@ func TestHashBuildCommand_WithContextPathSpecialCharacters(t *testing.T) {
 		},
 		CmdWithoutTagArguments: []string{"docker", "buildx", "build", "."},
 	}
-	hash := HashBuildCommand(command)
+	hash := HashBuildCommand(command, Options{})
 	assert.NotEqual(t, hash, "", "Expected non-empty hash for command with context path special characters")
 }
 
@@ -521,14 +554,14 @@ func TestHashBuildCommand_WithContextPathUnicode(t *testing.T) {
 		},
 		CmdWithoutTagArguments: []string{"docker", "buildx", "build", "."},
 	}
-	hash := HashBuildCommand(command)
+	hash := HashBuildCommand(command, Options{})
 	assert.NotEqual(t, hash, "", "Expected non-empty hash for command with context path unicode")
 
 	// change the dockerfile and expect a different hash
 	if err := os.WriteFile(dockerfile, []byte("FROM alpine:2"), 0644); err != nil {
 		t.Fatalf("Failed to create dockerfile: %v", err)
 	}
-	hash2 := HashBuildCommand(command)
+	hash2 := HashBuildCommand(command, Options{})
 	assert.NotEqual(t, hash, hash2, "Expected different hash for command with changed dockerfile")
 }
 
@@ -539,7 +572,7 @@ func TestHashBuildCommand_WithContextPathWhitespace(t *testing.T) {
 		},
 		CmdWithoutTagArguments: []string{"docker", "buildx", "build", "."},
 	}
-	hash := HashBuildCommand(command)
+	hash := HashBuildCommand(command, Options{})
 	assert.NotEqual(t, hash, "", "Expected non-empty hash for command with whitespace in context path")
 }
 
@@ -550,7 +583,7 @@ func TestHashBuildCommand_WithContextPathNewlines(t *testing.T) {
 		},
 		CmdWithoutTagArguments: []string{"docker", "buildx", "build", "."},
 	}
-	hash := HashBuildCommand(command)
+	hash := HashBuildCommand(command, Options{})
 	assert.NotEqual(t, hash, "", "Expected non-empty hash for command with newlines in context path")
 }
 
@@ -561,7 +594,7 @@ func TestHashBuildCommand_WithContextPathControlCharacters(t *testing.T) {
 		},
 		CmdWithoutTagArguments: []string{"docker", "buildx", "build", "."},
 	}
-	hash := HashBuildCommand(command)
+	hash := HashBuildCommand(command, Options{})
 	assert.NotEqual(t, hash, "", "Expected non-empty hash for command with control characters in context path")
 }
 
@@ -572,6 +605,6 @@ func TestHashBuildCommand_WithContextPathBackslashes(t *testing.T) {
 		},
 		CmdWithoutTagArguments: []string{"docker", "buildx", "build", "."},
 	}
-	hash := HashBuildCommand(command)
+	hash := HashBuildCommand(command, Options{})
 	assert.NotEqual(t, hash, "", "Expected non-empty hash for command with backslashes in context path")
 }
@@ -0,0 +1,7 @@
+package hasher
+
+// cancelled reports whether the hashing was given up on (e.g. after --hash-timeout): it then skips the files it has not
+// hashed yet, so that it stops competing with the build for the CPU and the disk, and the hashes it returns are wrong
+func (options Options) cancelled() bool {
+	return options.Context != nil && options.Context.Err() != nil
+}
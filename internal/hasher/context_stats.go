@@ -0,0 +1,80 @@
+package hasher
+
+import (
+	"cmp"
+	"log/slog"
+	"os"
+	"slices"
+
+	"github.com/docker/go-units"
+	"github.com/hytromo/mimosa/internal/logger"
+	"github.com/samber/lo"
+)
+
+// DefaultContextSizeWarning is the default size of the build contexts above which a warning is logged
+const DefaultContextSizeWarning = 500 * units.MB
+
+const largestFilesToReport = 5
+
+// warn when the (not ignored) files of a build are larger than this - 0 disables the warning
+var contextSizeWarning int64 = DefaultContextSizeWarning
+
+// SetContextSizeWarning sets the size of the build contexts above which a warning is logged - 0 disables the warning
+func SetContextSizeWarning(bytes int64) {
+	contextSizeWarning = bytes
+}
+
+type fileSize struct {
+	path string
+	size int64
+}
+
+// contextStats are the statistics of the files of a build that are not ignored
+type contextStats struct {
+	fileCount    int
+	totalBytes   int64
+	largestFiles []fileSize
+}
+
+func calculateContextStats(filePaths []string) contextStats {
+	// the dockerfile can be both in the context and added explicitly
+	filePaths = lo.Uniq(filePaths)
+	stats := contextStats{fileCount: len(filePaths)}
+	sizes := make([]fileSize, 0, len(filePaths))
+	for _, path := range filePaths {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		stats.totalBytes += info.Size()
+		sizes = append(sizes, fileSize{path: path, size: info.Size()})
+	}
+
+	slices.SortStableFunc(sizes, func(a, b fileSize) int {
+		return cmp.Compare(b.size, a.size)
+	})
+	stats.largestFiles = sizes[:min(largestFilesToReport, len(sizes))]
+
+	return stats
+}
+
+// reportContextStats logs the statistics of the build contexts, and warns if they are larger than the configured
+// threshold - large contexts slow down both hashing and building, and usually mean that the .dockerignore misses something
+func reportContextStats(buildName string, filePaths []string) {
+	if contextSizeWarning <= 0 && !logger.IsDebugEnabled() {
+		return
+	}
+
+	stats := calculateContextStats(filePaths)
+	largestFiles := make([]string, 0, len(stats.largestFiles))
+	for _, file := range stats.largestFiles {
+		largestFiles = append(largestFiles, file.path+" ("+units.HumanSize(float64(file.size))+")")
+	}
+
+	attributes := []any{"build", buildName, "files", stats.fileCount, "size", units.HumanSize(float64(stats.totalBytes)), "largestFiles", largestFiles}
+	if contextSizeWarning > 0 && stats.totalBytes > contextSizeWarning {
+		slog.Warn("The build contexts are larger than "+units.HumanSize(float64(contextSizeWarning))+" - is something missing from .dockerignore?", attributes...)
+		return
+	}
+	slog.Debug("Build context stats", attributes...)
+}
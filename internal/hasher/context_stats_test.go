@@ -0,0 +1,59 @@
+package hasher
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCalculateContextStats(t *testing.T) {
+	dir := t.TempDir()
+	paths := []string{}
+	for name, size := range map[string]int{"a": 10, "b": 300, "c": 20, "d": 5, "e": 1, "f": 2} {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, make([]byte, size), 0644))
+		paths = append(paths, path)
+	}
+
+	stats := calculateContextStats(append(paths, paths[0], filepath.Join(dir, "missing")))
+
+	assert.Equal(t, 7, stats.fileCount, "duplicates are counted once, missing files are counted")
+	assert.Equal(t, int64(338), stats.totalBytes)
+	require.Len(t, stats.largestFiles, largestFilesToReport)
+	assert.Equal(t, filepath.Join(dir, "b"), stats.largestFiles[0].path)
+	assert.Equal(t, filepath.Join(dir, "c"), stats.largestFiles[1].path)
+	assert.Equal(t, int64(2), stats.largestFiles[4].size)
+}
+
+func TestReportContextStats_WarnsAboveThreshold(t *testing.T) {
+	t.Cleanup(func() {
+		SetContextSizeWarning(DefaultContextSizeWarning)
+	})
+	var logs bytes.Buffer
+	defaultLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelWarn})))
+	t.Cleanup(func() {
+		slog.SetDefault(defaultLogger)
+	})
+
+	path := createTempFileWithContent(t, t.TempDir(), "0123456789")
+
+	SetContextSizeWarning(100)
+	reportContextStats("default", []string{path})
+	assert.Empty(t, logs.String())
+
+	SetContextSizeWarning(5)
+	reportContextStats("default", []string{path})
+	assert.Contains(t, logs.String(), "larger than 5B")
+	assert.Contains(t, logs.String(), path+" (10B)")
+
+	logs.Reset()
+	SetContextSizeWarning(0)
+	reportContextStats("default", []string{path})
+	assert.Empty(t, logs.String(), "0 disables the warning")
+}
@@ -9,19 +9,36 @@ import (
 	"log/slog"
 
 	"github.com/hytromo/mimosa/internal/logger"
-	"github.com/kalafut/imohash"
 )
 
+// fileHash is the hash of a single file
+type fileHash struct {
+	path string
+	hash []byte
+}
+
 // HashFiles computes a hash of all files in the provided list
 // and returns a single hash representing the unique state of all files.
 // It produces the same hash for the same files, regardless of the order of the files.
-func HashFiles(filePaths []string, nWorkers int) string {
+// Hashes produced by algorithms other than the default are prefixed with the algorithm name, so they can never collide.
+func HashFiles(filePaths []string, nWorkers int, algorithm FileHashAlgorithm) string {
 	if len(filePaths) == 0 {
 		return ""
 	}
 
+	return combineFileHashes(hashEachFile(filePaths, nWorkers, Options{FileHashAlgorithm: algorithm}), algorithm)
+}
+
+// hashEachFile hashes every file of the list with the file hash algorithm of the options - files that cannot be hashed
+// are skipped, as well as the files left once the hashing is cancelled
+func hashEachFile(filePaths []string, nWorkers int, options Options) []fileHash {
+	if len(filePaths) == 0 {
+		return nil
+	}
+	algorithm := options.fileHashAlgorithm()
+
 	fileChan := make(chan string, len(filePaths))
-	hashChan := make(chan []byte, len(filePaths))
+	hashChan := make(chan fileHash, len(filePaths))
 	finalWorkerCount := int(math.Max(1, float64(nWorkers)))
 	workerCountChan := make(chan struct {
 		workerID int
@@ -34,12 +51,17 @@ func HashFiles(filePaths []string, nWorkers int) string {
 		defer wg.Done()
 		count := 0
 		for path := range fileChan {
-			hash, err := imohash.SumFile(path)
+			if options.cancelled() {
+				continue
+			}
+			hash, err := fileSumsMemo.get(string(algorithm)+"\x00"+path, func() ([]byte, error) {
+				return sumFile(algorithm, path)
+			})
 			if err == nil {
 				if logger.IsDebugEnabled() {
-					slog.Debug("Hashed file", "path", path, "hash", hex.EncodeToString(hash[:]))
+					slog.Debug("Hashed file", "path", path, "hash", hex.EncodeToString(hash))
 				}
-				hashChan <- hash[:]
+				hashChan <- fileHash{path: path, hash: hash}
 				count++
 			} else {
 				slog.Debug("Error hashing file", "path", path, "error", err)
@@ -66,7 +88,7 @@ func HashFiles(filePaths []string, nWorkers int) string {
 	close(workerCountChan)
 
 	// Collect all hashes
-	var fileHashes [][]byte
+	var fileHashes []fileHash
 	for h := range hashChan {
 		fileHashes = append(fileHashes, h)
 	}
@@ -91,15 +113,27 @@ func HashFiles(filePaths []string, nWorkers int) string {
 		}
 	}
 
+	return fileHashes
+}
+
+// combineFileHashes combines the hashes of the files into a single hash, regardless of their order
+func combineFileHashes(fileHashes []fileHash, algorithm FileHashAlgorithm) string {
 	// Sort the hashes to ensure consistent order
-	sort.Slice(fileHashes, func(i, j int) bool {
-		return string(fileHashes[i]) < string(fileHashes[j])
+	hashes := make([][]byte, len(fileHashes))
+	for i, h := range fileHashes {
+		hashes[i] = h.hash
+	}
+	sort.Slice(hashes, func(i, j int) bool {
+		return string(hashes[i]) < string(hashes[j])
 	})
 
 	// Concatenate all hashes and hash the result for a final hash
-	joined := joinHashes(fileHashes)
-	finalHash := imohash.Sum(joined)
-	return hex.EncodeToString(finalHash[:])
+	joined := joinHashes(hashes)
+	finalHash := hex.EncodeToString(sumJoined(algorithm, joined))
+	if algorithm != FileHashAlgorithmImo {
+		return string(algorithm) + ":" + finalHash
+	}
+	return finalHash
 }
 
 func joinHashes(hashes [][]byte) []byte {
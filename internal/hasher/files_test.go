@@ -1,6 +1,7 @@
 package hasher
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -26,7 +27,7 @@ func createTempFileWithContent(t *testing.T, dir, content string) string {
 }
 
 func TestHashFiles_EmptyInput(t *testing.T) {
-	hash := HashFiles([]string{}, 1)
+	hash := HashFiles([]string{}, 1, FileHashAlgorithmImo)
 	if hash != "" {
 		t.Errorf("Expected empty hash for empty input, got %q", hash)
 	}
@@ -35,7 +36,7 @@ func TestHashFiles_EmptyInput(t *testing.T) {
 func TestHashFiles_SingleFile(t *testing.T) {
 	dir := t.TempDir()
 	file := createTempFileWithContent(t, dir, "hello world")
-	hash1 := HashFiles([]string{file}, 1)
+	hash1 := HashFiles([]string{file}, 1, FileHashAlgorithmImo)
 	// Hash should be non-empty
 	if hash1 == "" {
 		t.Error("Expected non-empty hash for single file")
@@ -44,7 +45,7 @@ func TestHashFiles_SingleFile(t *testing.T) {
 	if err := os.WriteFile(file, []byte("goodbye world"), 0644); err != nil {
 		t.Fatalf("Failed to overwrite file: %v", err)
 	}
-	hash2 := HashFiles([]string{file}, 1)
+	hash2 := HashFiles([]string{file}, 1, FileHashAlgorithmImo)
 	if hash1 == hash2 {
 		t.Error("Hash did not change after file content changed")
 	}
@@ -55,9 +56,9 @@ func TestHashFiles_MultipleFiles_Deterministic(t *testing.T) {
 	file1 := createTempFileWithContent(t, dir, "foo")
 	file2 := createTempFileWithContent(t, dir, "bar")
 	files := []string{file1, file2}
-	hash1 := HashFiles(files, 1)
+	hash1 := HashFiles(files, 1, FileHashAlgorithmImo)
 	// Hash should be same regardless of order
-	hash2 := HashFiles([]string{file2, file1}, 1)
+	hash2 := HashFiles([]string{file2, file1}, 1, FileHashAlgorithmImo)
 	if hash1 != hash2 {
 		t.Errorf("Hash should be order-independent, got %q and %q", hash1, hash2)
 	}
@@ -65,7 +66,7 @@ func TestHashFiles_MultipleFiles_Deterministic(t *testing.T) {
 	if err := os.WriteFile(file1, []byte("baz"), 0644); err != nil {
 		t.Fatalf("Failed to overwrite file: %v", err)
 	}
-	hash3 := HashFiles(files, 1)
+	hash3 := HashFiles(files, 1, FileHashAlgorithmImo)
 	if hash1 == hash3 {
 		t.Error("Hash did not change after file content changed")
 	}
@@ -75,8 +76,8 @@ func TestHashFiles_SameContentFiles(t *testing.T) {
 	dir := t.TempDir()
 	file1 := createTempFileWithContent(t, dir, "same")
 	file2 := createTempFileWithContent(t, dir, "same")
-	hash1 := HashFiles([]string{file1, file2}, 1)
-	hash2 := HashFiles([]string{file2, file1}, 1)
+	hash1 := HashFiles([]string{file1, file2}, 1, FileHashAlgorithmImo)
+	hash2 := HashFiles([]string{file2, file1}, 1, FileHashAlgorithmImo)
 	if hash1 != hash2 {
 		t.Errorf("Hash should be same for same content files regardless of order, got %q and %q", hash1, hash2)
 	}
@@ -87,7 +88,7 @@ func TestHashFiles_NonExistentFile(t *testing.T) {
 	file := filepath.Join(dir, "doesnotexist.txt")
 	// Debug level is set by default in slog
 	// Should not panic or error, just skip
-	hash := HashFiles([]string{file}, 1)
+	hash := HashFiles([]string{file}, 1, FileHashAlgorithmImo)
 	// Should be empty since no file was hashed
 	if hash != "00000000000000000000000000000000" {
 		t.Fatalf("Expected zero-ed hash for non-existent file, got %q", hash)
@@ -101,7 +102,7 @@ func TestHashFiles_LargeFile(t *testing.T) {
 		largeContent[i] = byte(i % 256)
 	}
 	file := createTempFileWithContent(t, dir, string(largeContent))
-	hash := HashFiles([]string{file}, 1)
+	hash := HashFiles([]string{file}, 1, FileHashAlgorithmImo)
 	if hash == "" {
 		t.Error("Expected non-empty hash for large file")
 	}
@@ -110,8 +111,8 @@ func TestHashFiles_LargeFile(t *testing.T) {
 func TestHashFiles_DuplicatePaths(t *testing.T) {
 	dir := t.TempDir()
 	file := createTempFileWithContent(t, dir, "dup")
-	hash1 := HashFiles([]string{file, file}, 1)
-	hash2 := HashFiles([]string{file}, 1)
+	hash1 := HashFiles([]string{file, file}, 1, FileHashAlgorithmImo)
+	hash2 := HashFiles([]string{file}, 1, FileHashAlgorithmImo)
 	if hash1 == "" || hash2 == "" {
 		t.Error("Expected non-empty hashes")
 	}
@@ -131,9 +132,9 @@ func TestHashFiles_MultipleWorkers(t *testing.T) {
 	}
 
 	// Test with different numbers of workers
-	hash1 := HashFiles(files, 1)
-	hash2 := HashFiles(files, 4)
-	hash3 := HashFiles(files, 8)
+	hash1 := HashFiles(files, 1, FileHashAlgorithmImo)
+	hash2 := HashFiles(files, 4, FileHashAlgorithmImo)
+	hash3 := HashFiles(files, 8, FileHashAlgorithmImo)
 
 	// All hashes should be the same regardless of worker count
 	if hash1 != hash2 || hash2 != hash3 {
@@ -146,7 +147,7 @@ func TestHashFiles_ZeroWorkers(t *testing.T) {
 	file := createTempFileWithContent(t, dir, "test")
 
 	// Test with zero workers
-	hash := HashFiles([]string{file}, 0)
+	hash := HashFiles([]string{file}, 0, FileHashAlgorithmImo)
 	if hash == "" {
 		t.Error("Expected non-empty hash with zero workers")
 	}
@@ -155,7 +156,7 @@ func TestHashFiles_ZeroWorkers(t *testing.T) {
 func TestHashFiles_NegativeWorkers(t *testing.T) {
 	dir := t.TempDir()
 	file := createTempFileWithContent(t, dir, "test")
-	HashFiles([]string{file}, -1)
+	HashFiles([]string{file}, -1, FileHashAlgorithmImo)
 }
 
 func TestHashFiles_MixedExistentAndNonExistent(t *testing.T) {
@@ -163,7 +164,7 @@ func TestHashFiles_MixedExistentAndNonExistent(t *testing.T) {
 	existingFile := createTempFileWithContent(t, dir, "exists")
 	nonExistentFile := filepath.Join(dir, "doesnotexist.txt")
 
-	hash := HashFiles([]string{existingFile, nonExistentFile}, 1)
+	hash := HashFiles([]string{existingFile, nonExistentFile}, 1, FileHashAlgorithmImo)
 	if hash == "" {
 		t.Error("Expected non-empty hash when at least one file exists")
 	}
@@ -174,7 +175,7 @@ func TestHashFiles_AllNonExistent(t *testing.T) {
 	nonExistentFile1 := filepath.Join(dir, "doesnotexist1.txt")
 	nonExistentFile2 := filepath.Join(dir, "doesnotexist2.txt")
 
-	hash := HashFiles([]string{nonExistentFile1, nonExistentFile2}, 1)
+	hash := HashFiles([]string{nonExistentFile1, nonExistentFile2}, 1, FileHashAlgorithmImo)
 	if hash != "00000000000000000000000000000000" {
 		t.Errorf("Expected zero-ed hash for all non-existent files, got %q", hash)
 	}
@@ -184,7 +185,7 @@ func TestHashFiles_EmptyFile(t *testing.T) {
 	dir := t.TempDir()
 	emptyFile := createTempFileWithContent(t, dir, "")
 
-	hash := HashFiles([]string{emptyFile}, 1)
+	hash := HashFiles([]string{emptyFile}, 1, FileHashAlgorithmImo)
 	if hash == "" {
 		t.Error("Expected non-empty hash for empty file")
 	}
@@ -200,7 +201,7 @@ func TestHashFiles_SpecialCharactersInPath(t *testing.T) {
 		t.Fatalf("Failed to create file with special name: %v", err)
 	}
 
-	hash := HashFiles([]string{specialFile}, 1)
+	hash := HashFiles([]string{specialFile}, 1, FileHashAlgorithmImo)
 	if hash == "" {
 		t.Error("Expected non-empty hash for file with special characters in name")
 	}
@@ -219,7 +220,7 @@ func TestHashFiles_ConcurrentAccess(t *testing.T) {
 	done := make(chan bool, 3)
 	for i := 0; i < 3; i++ {
 		go func() {
-			hash := HashFiles(files, 2)
+			hash := HashFiles(files, 2, FileHashAlgorithmImo)
 			if hash == "" {
 				t.Error("Expected non-empty hash in concurrent access")
 			}
@@ -288,3 +289,23 @@ func TestJoinHashes_EmptyHashes(t *testing.T) {
 		}
 	}
 }
+
+func TestHashFiles_CancelledSkipsFiles(t *testing.T) {
+	dir := t.TempDir()
+	file := createTempFileWithContent(t, dir, "content")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if hashes := hashEachFile([]string{file}, 2, Options{Context: ctx}); len(hashes) != 1 {
+		t.Fatalf("Expected the file to be hashed before cancelling, got %d hashes", len(hashes))
+	}
+
+	cancel()
+	if hashes := hashEachFile([]string{file}, 2, Options{Context: ctx}); len(hashes) != 0 {
+		t.Fatalf("Expected no files to be hashed after cancelling, got %d", len(hashes))
+	}
+
+	// only the cancelled hashing skips files
+	if hashes := hashEachFile([]string{file}, 2, Options{}); len(hashes) != 1 {
+		t.Fatalf("Expected the file to be hashed by another hashing, got %d hashes", len(hashes))
+	}
+}
@@ -0,0 +1,93 @@
+package hasher
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"log/slog"
+)
+
+// gitTree keeps the hashes of the build commands whose files are all in a clean git checkout, keyed by the commit and
+// the command: while the checkout stays at the same commit, with nothing changed, untracked or ignored in it, their
+// files cannot have changed - so a long-running mimosa (e.g. sync) does not hash them again on every pass
+var gitTree = struct {
+	mu     sync.Mutex
+	root   string
+	commit string
+	hashes map[string]string
+}{hashes: map[string]string{}}
+
+// SetGitTree sets the clean git checkout that the files of the builds are in: its top-level directory and its commit.
+// Empty values (e.g. the checkout has changes) disable the fast path, and a new commit forgets the hashes of the old one
+func SetGitTree(root string, commit string) {
+	gitTree.mu.Lock()
+	defer gitTree.mu.Unlock()
+
+	if root == "" || commit == "" || root != gitTree.root || commit != gitTree.commit {
+		gitTree.hashes = map[string]string{}
+	}
+	gitTree.root = root
+	gitTree.commit = commit
+}
+
+// gitTreeKey returns the key of the hash of the command in the clean checkout, or "" if it cannot be memoized: there is
+// no clean checkout, or some of the files of the build are outside of it
+func gitTreeKey(command DockerBuildCommand, options Options) string {
+	gitTree.mu.Lock()
+	root, commit := gitTree.root, gitTree.commit
+	gitTree.mu.Unlock()
+
+	if commit == "" || isRecordingBreakdowns() {
+		return ""
+	}
+
+	paths := []string{command.DockerfilePath, command.DockerignorePath}
+	for _, contextPath := range command.BuildContexts {
+		if localPath, ok := localContextPath(contextPath); ok {
+			paths = append(paths, localPath)
+		}
+	}
+	for _, path := range paths {
+		if path != "" && !isInside(root, path) {
+			return ""
+		}
+	}
+
+	serialized, err := json.Marshal(command)
+	if err != nil {
+		return ""
+	}
+	// the command is hashed differently with other hashing options
+	return strings.Join([]string{commit, string(options.fileHashAlgorithm()), fmt.Sprint(options.AggressiveNormalize), fmt.Sprint(options.InfrastructureFlags), filepath.Clean(options.WorkspaceRoot), string(serialized)}, "\x00")
+}
+
+// isInside reports whether the absolute path is the directory or in it
+func isInside(dir string, path string) bool {
+	relative, err := filepath.Rel(dir, path)
+	return err == nil && filepath.IsAbs(path) && relative != ".." && !strings.HasPrefix(relative, ".."+string(filepath.Separator))
+}
+
+func gitTreeHash(key string) (string, bool) {
+	if key == "" {
+		return "", false
+	}
+	gitTree.mu.Lock()
+	defer gitTree.mu.Unlock()
+	hash, ok := gitTree.hashes[key]
+	if ok {
+		slog.Debug("The checkout has not changed since the build was hashed, reusing its hash")
+	}
+	return hash, ok
+}
+
+func rememberGitTreeHash(key string, hash string) {
+	if key == "" {
+		return
+	}
+	gitTree.mu.Lock()
+	defer gitTree.mu.Unlock()
+	gitTree.hashes[key] = hash
+}
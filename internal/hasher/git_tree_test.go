@@ -0,0 +1,83 @@
+package hasher
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hytromo/mimosa/internal/configuration"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func useGitTree(t *testing.T, root string, commit string) {
+	t.Helper()
+	SetGitTree(root, commit)
+	t.Cleanup(func() {
+		SetGitTree("", "")
+	})
+}
+
+func TestHashBuildCommand_CleanGitTreeReusesTheHash(t *testing.T) {
+	root := t.TempDir()
+	contextFile := filepath.Join(root, "app.txt")
+	require.NoError(t, os.WriteFile(contextFile, []byte("v1"), 0o644))
+	command := DockerBuildCommand{
+		BuildContexts:          map[string]string{configuration.MainBuildContextName: root},
+		CmdWithoutTagArguments: []string{"docker", "buildx", "build", "."},
+	}
+
+	useGitTree(t, root, "commit-1")
+	first := HashBuildCommand(command, Options{})
+
+	// the file changes behind the back of git: the hash of the commit is reused as is
+	require.NoError(t, os.WriteFile(contextFile, []byte("v2"), 0o644))
+	assert.Equal(t, first, HashBuildCommand(command, Options{}))
+
+	// a new commit (or a checkout that is no longer clean) hashes the files again
+	SetGitTree(root, "commit-2")
+	second := HashBuildCommand(command, Options{})
+	assert.NotEqual(t, first, second)
+	SetGitTree("", "")
+	require.NoError(t, os.WriteFile(contextFile, []byte("v3"), 0o644))
+	assert.NotEqual(t, second, HashBuildCommand(command, Options{}))
+}
+
+func TestHashBuildCommand_CancelledHashIsNotReused(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "app.txt"), []byte("v1"), 0o644))
+	command := DockerBuildCommand{
+		BuildContexts:          map[string]string{configuration.MainBuildContextName: root},
+		CmdWithoutTagArguments: []string{"docker", "buildx", "build", "."},
+	}
+	useGitTree(t, root, "commit-1")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	cancelled := HashBuildCommand(command, Options{Context: ctx})
+
+	assert.NotEqual(t, cancelled, HashBuildCommand(command, Options{}), "the hash of the cancelled hashing skipped the files")
+}
+
+func TestGitTreeKey(t *testing.T) {
+	root := t.TempDir()
+	command := DockerBuildCommand{
+		DockerfilePath:         filepath.Join(root, "Dockerfile"),
+		BuildContexts:          map[string]string{configuration.MainBuildContextName: root, "remote": "https://github.com/org/repo.git"},
+		CmdWithoutTagArguments: []string{"docker", "buildx", "build", "."},
+	}
+
+	assert.Empty(t, gitTreeKey(command, Options{}), "no clean checkout")
+
+	useGitTree(t, root, "commit-1")
+	assert.NotEmpty(t, gitTreeKey(command, Options{}))
+
+	outside := command
+	outside.BuildContexts = map[string]string{configuration.MainBuildContextName: root, "shared": t.TempDir()}
+	assert.Empty(t, gitTreeKey(outside, Options{}), "a build context outside of the checkout")
+
+	outside = command
+	outside.DockerfilePath = filepath.Join(filepath.Dir(root), "Dockerfile")
+	assert.Empty(t, gitTreeKey(outside, Options{}), "a Dockerfile outside of the checkout")
+}
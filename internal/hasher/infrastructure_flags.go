@@ -0,0 +1,85 @@
+package hasher
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// InfrastructureFlag is a build flag whose value depends on the runner rather than on the image, e.g. the IP of
+// "--add-host ci-proxy:10.0.0.5"
+type InfrastructureFlag struct {
+	Name string
+	// keep the key of a key:value (or key=value) value and template only the rest, e.g. the host of --add-host
+	KeepKey bool
+}
+
+// DefaultInfrastructureFlags are the infrastructure flags that are templated with --ignore-infra-flags: the
+// hosts of --add-host are kept, as RUN steps can depend on them being resolvable, but not the IPs that the runners
+// resolve them to - and --cgroup-parent only places the RUN steps in the cgroups of the runner
+var DefaultInfrastructureFlags = []InfrastructureFlag{
+	{Name: "--add-host", KeepKey: true},
+	{Name: "--cgroup-parent"},
+}
+
+// ParseInfrastructureFlags returns the infrastructure flags to template: the defaults if asked for, and the given
+// flags (a default flag given again keeps its key like the default does)
+func ParseInfrastructureFlags(withDefaults bool, names []string) ([]InfrastructureFlag, error) {
+	flags := []InfrastructureFlag{}
+	if withDefaults {
+		flags = append(flags, DefaultInfrastructureFlags...)
+	}
+	for _, name := range names {
+		if !strings.HasPrefix(name, "--") || len(name) < 3 || strings.ContainsAny(name, "= ") {
+			return nil, fmt.Errorf("invalid infrastructure flag %q, expected the long name of a build flag, e.g. --add-host", name)
+		}
+		if slices.ContainsFunc(flags, func(flag InfrastructureFlag) bool { return flag.Name == name }) {
+			continue
+		}
+		flag := InfrastructureFlag{Name: name}
+		if index := slices.IndexFunc(DefaultInfrastructureFlags, func(flag InfrastructureFlag) bool { return flag.Name == name }); index != -1 {
+			flag = DefaultInfrastructureFlags[index]
+		}
+		flags = append(flags, flag)
+	}
+	return flags, nil
+}
+
+// templateInfrastructureValue returns the value of the infrastructure flag as it is hashed
+func templateInfrastructureValue(flag InfrastructureFlag, value string) string {
+	if flag.KeepKey {
+		if index := strings.IndexAny(value, ":="); index != -1 {
+			return value[:index+1] + "<VALUE>"
+		}
+	}
+	return "<VALUE>"
+}
+
+// TemplateInfrastructureFlags replaces the values of the given infrastructure flags of the command arguments with
+// <VALUE>, given either as "--flag value" or "--flag=value"
+func TemplateInfrastructureFlags(args []string, infrastructureFlags []InfrastructureFlag) []string {
+	if len(infrastructureFlags) == 0 {
+		return args
+	}
+
+	templated := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		flagName, value, hasValue := strings.Cut(arg, "=")
+		index := slices.IndexFunc(infrastructureFlags, func(flag InfrastructureFlag) bool { return flag.Name == flagName })
+		switch {
+		case index == -1:
+			templated = append(templated, arg)
+		case hasValue:
+			templated = append(templated, flagName+"="+templateInfrastructureValue(infrastructureFlags[index], value))
+			TraceNormalization(arg, "infrastructure flag templated", templated[len(templated)-1])
+		case i+1 < len(args):
+			i++
+			templated = append(templated, arg, templateInfrastructureValue(infrastructureFlags[index], args[i]))
+			TraceNormalization(arg+" "+args[i], "infrastructure flag templated", strings.Join(templated[len(templated)-2:], " "))
+		default:
+			templated = append(templated, arg)
+		}
+	}
+	return templated
+}
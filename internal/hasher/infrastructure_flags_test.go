@@ -0,0 +1,63 @@
+package hasher
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func infrastructureFlags(t *testing.T, withDefaults bool, names ...string) []InfrastructureFlag {
+	t.Helper()
+	flags, err := ParseInfrastructureFlags(withDefaults, names)
+	require.NoError(t, err)
+	return flags
+}
+
+func TestParseInfrastructureFlags(t *testing.T) {
+	flags, err := ParseInfrastructureFlags(false, nil)
+	require.NoError(t, err)
+	assert.Empty(t, flags)
+
+	flags, err = ParseInfrastructureFlags(true, []string{"--dns", "--add-host"})
+	require.NoError(t, err)
+	assert.Equal(t, []InfrastructureFlag{{Name: "--add-host", KeepKey: true}, {Name: "--cgroup-parent"}, {Name: "--dns"}}, flags)
+
+	flags, err = ParseInfrastructureFlags(false, []string{"--add-host"})
+	require.NoError(t, err)
+	assert.Equal(t, []InfrastructureFlag{{Name: "--add-host", KeepKey: true}}, flags, "a default flag keeps its key")
+
+	for _, invalid := range []string{"dns", "-d", "--", "--dns=1.1.1.1"} {
+		_, err = ParseInfrastructureFlags(false, []string{invalid})
+		assert.ErrorContains(t, err, "invalid infrastructure flag", invalid)
+	}
+}
+
+func TestTemplateInfrastructureFlags(t *testing.T) {
+	args := []string{"docker", "buildx", "build", "--add-host", "ci-proxy:10.0.0.5", "--add-host=registry=10.0.0.6", "--cgroup-parent", "/actions_job", "--dns=1.1.1.1", "."}
+	assert.Equal(t, args, TemplateInfrastructureFlags(args, nil), "no infrastructure flags by default")
+
+	assert.Equal(t, []string{
+		"docker", "buildx", "build", "--add-host", "ci-proxy:<VALUE>", "--add-host=registry=<VALUE>", "--cgroup-parent", "<VALUE>", "--dns=<VALUE>", ".",
+	}, TemplateInfrastructureFlags(args, infrastructureFlags(t, true, "--dns")))
+}
+
+func TestHashBuildCommand_InfrastructureFlags(t *testing.T) {
+	tempDir := t.TempDir()
+	dockerfilePath := createTempFileWithContent(t, tempDir, "FROM alpine")
+
+	commandWithHost := func(host string, flags []InfrastructureFlag) DockerBuildCommand {
+		return DockerBuildCommand{
+			DockerfilePath:         dockerfilePath,
+			BuildContexts:          map[string]string{"default": tempDir},
+			CmdWithoutTagArguments: TemplateInfrastructureFlags([]string{"docker", "buildx", "build", "--add-host", host, tempDir}, flags),
+		}
+	}
+
+	assert.NotEqual(t, HashBuildCommand(commandWithHost("ci-proxy:10.0.0.5", nil), Options{}), HashBuildCommand(commandWithHost("ci-proxy:10.0.0.9", nil), Options{}))
+
+	options := Options{InfrastructureFlags: infrastructureFlags(t, true)}
+	assert.Equal(t, HashBuildCommand(commandWithHost("ci-proxy:10.0.0.5", options.InfrastructureFlags), options), HashBuildCommand(commandWithHost("ci-proxy:10.0.0.9", options.InfrastructureFlags), options))
+	assert.NotEqual(t, HashBuildCommand(commandWithHost("ci-proxy:10.0.0.5", options.InfrastructureFlags), options), HashBuildCommand(commandWithHost("other-proxy:10.0.0.5", options.InfrastructureFlags), options),
+		"the hosts are kept")
+}
@@ -0,0 +1,57 @@
+package hasher
+
+import (
+	"sync"
+)
+
+// memo caches results for the duration of a mimosa run that hashes many builds (e.g. batch mode),
+// so that build contexts and files shared between the builds are only walked/hashed once.
+// It is disabled by default, because a single build never hashes the same context twice.
+type memo[T any] struct {
+	mu      sync.Mutex
+	enabled bool
+	values  map[string]T
+}
+
+func (m *memo[T]) get(key string, compute func() (T, error)) (T, error) {
+	m.mu.Lock()
+	if !m.enabled {
+		m.mu.Unlock()
+		return compute()
+	}
+	if value, ok := m.values[key]; ok {
+		m.mu.Unlock()
+		return value, nil
+	}
+	m.mu.Unlock()
+
+	value, err := compute()
+	if err != nil {
+		return value, err
+	}
+
+	m.mu.Lock()
+	m.values[key] = value
+	m.mu.Unlock()
+
+	return value, nil
+}
+
+func (m *memo[T]) setEnabled(enabled bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.enabled = enabled
+	m.values = map[string]T{}
+}
+
+var (
+	includedFilesMemo = &memo[[]string]{}
+	fileSumsMemo      = &memo[[]byte]{}
+)
+
+// SetMemoization enables or disables memoization of the included files of the build contexts and of the file hashes
+func SetMemoization(enabled bool) {
+	includedFilesMemo.setEnabled(enabled)
+	fileSumsMemo.setEnabled(enabled)
+}
@@ -0,0 +1,56 @@
+package hasher
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoization(t *testing.T) {
+	t.Cleanup(func() {
+		SetMemoization(false)
+	})
+
+	filePath := createTempFileWithContent(t, t.TempDir(), "first")
+	firstHash := HashFiles([]string{filePath}, 1, FileHashAlgorithmImo)
+
+	require.NoError(t, os.WriteFile(filePath, []byte("second"), 0644))
+	secondHash := HashFiles([]string{filePath}, 1, FileHashAlgorithmImo)
+	assert.NotEqual(t, firstHash, secondHash, "without memoization the file is hashed again")
+
+	SetMemoization(true)
+	memoizedHash := HashFiles([]string{filePath}, 1, FileHashAlgorithmImo)
+	require.NoError(t, os.WriteFile(filePath, []byte("third"), 0644))
+	assert.Equal(t, memoizedHash, HashFiles([]string{filePath}, 1, FileHashAlgorithmImo), "with memoization the file is only hashed once")
+
+	// re-enabling resets the memoized values
+	SetMemoization(true)
+	assert.NotEqual(t, memoizedHash, HashFiles([]string{filePath}, 1, FileHashAlgorithmImo))
+}
+
+func TestMemo_ErrorsAreNotMemoized(t *testing.T) {
+	m := &memo[int]{}
+	m.setEnabled(true)
+
+	calls := 0
+	compute := func() (int, error) {
+		calls++
+		if calls == 1 {
+			return 0, assert.AnError
+		}
+		return calls, nil
+	}
+
+	_, err := m.get("key", compute)
+	assert.Error(t, err)
+
+	value, err := m.get("key", compute)
+	require.NoError(t, err)
+	assert.Equal(t, 2, value)
+
+	value, err = m.get("key", compute)
+	require.NoError(t, err)
+	assert.Equal(t, 2, value)
+}
@@ -0,0 +1,87 @@
+package hasher
+
+import (
+	"log/slog"
+	"path/filepath"
+	"regexp"
+)
+
+// dynamicValuePatterns match run-specific values that CI plugins inject into the build command
+// (e.g. builder-id URLs, temp iidfiles) - they change on every run without affecting the image content
+var dynamicValuePatterns = []*regexp.Regexp{
+	// CI run URLs: GitHub Actions (/actions/runs/123), GitLab (/-/jobs/123, /-/pipelines/123), Buildkite/others (/builds/123)
+	regexp.MustCompile(`https?://[^\s,]*/(?:actions/runs|-/jobs|-/pipelines|builds|runs|jobs|pipelines)/\d+[^\s,]*`),
+	// temp dirs: linux, macOS and the GitHub Actions runner temp dir
+	regexp.MustCompile(`(?:/private)?/var/folders/[^\s,]+`),
+	regexp.MustCompile(`/tmp/[^\s,]+`),
+	regexp.MustCompile(`/home/runner/work/_temp/[^\s,]+`),
+	regexp.MustCompile(`(?i)[a-z]:\\[^\s,]*\\Temp\\[^\s,]+`),
+	// UUIDs
+	regexp.MustCompile(`(?i)[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}`),
+}
+
+var normalizationTracing = false
+
+// SetNormalizationTracing enables logging, for every argument of the hashed commands, the normalization rule that
+// matched it (discarded, templated, kept, ...) and what it became
+func SetNormalizationTracing(enabled bool) {
+	normalizationTracing = enabled
+}
+
+// TraceNormalization logs the normalization rule that matched an argument, if normalization tracing is enabled
+func TraceNormalization(argument string, rule string, result string) {
+	if !normalizationTracing {
+		return
+	}
+	slog.Info("Normalized argument", "argument", argument, "rule", rule, "result", result)
+}
+
+// templateDynamicValues replaces the run-specific parts of the command arguments with <VALUE>,
+// if aggressive normalization is enabled
+func templateDynamicValues(args []string, aggressive bool) []string {
+	if !aggressive {
+		return args
+	}
+
+	templated := make([]string, len(args))
+	for i, arg := range args {
+		templated[i] = arg
+		for _, pattern := range dynamicValuePatterns {
+			templated[i] = pattern.ReplaceAllString(templated[i], "<VALUE>")
+		}
+		if templated[i] != arg {
+			TraceNormalization(arg, "run-specific value templated", templated[i])
+		}
+	}
+
+	return templated
+}
+
+// workspaceRootMarker takes the place of the workspace root in the hashed command arguments
+const workspaceRootMarker = "<WORKSPACE>"
+
+// workspaceRootPattern matches the workspace root as a whole path (or the start of one) in an argument, e.g. in
+// "/repo/api", "--build-context shared=/repo/shared" or "-f=/repo/Dockerfile" - nil hashes the paths as they are
+func workspaceRootPattern(root string) *regexp.Regexp {
+	if root == "" || filepath.Clean(root) == "/" {
+		return nil
+	}
+	return regexp.MustCompile(`(^|[=,:])` + regexp.QuoteMeta(filepath.Clean(root)) + `(/|,|$)`)
+}
+
+// workspaceRelativePaths replaces the workspace root (see Options) in the command arguments with <WORKSPACE>
+func workspaceRelativePaths(args []string, root string) []string {
+	workspaceRootPattern := workspaceRootPattern(root)
+	if workspaceRootPattern == nil {
+		return args
+	}
+
+	relative := make([]string, len(args))
+	for i, arg := range args {
+		relative[i] = workspaceRootPattern.ReplaceAllString(arg, "${1}"+workspaceRootMarker+"${2}")
+		if relative[i] != arg {
+			TraceNormalization(arg, "relative to the workspace root", relative[i])
+		}
+	}
+	return relative
+}
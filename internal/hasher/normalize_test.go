@@ -0,0 +1,147 @@
+package hasher
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemplateDynamicValues_Disabled(t *testing.T) {
+	args := []string{"docker", "buildx", "build", "--build-arg", "RUN_ID=123e4567-e89b-12d3-a456-426614174000", "."}
+	assert.Equal(t, args, templateDynamicValues(args, false))
+}
+
+func TestTemplateDynamicValues_Enabled(t *testing.T) {
+	testCases := []struct {
+		name     string
+		arg      string
+		expected string
+	}{
+		{
+			name:     "UUID",
+			arg:      "RUN_ID=123e4567-e89b-12d3-a456-426614174000",
+			expected: "RUN_ID=<VALUE>",
+		},
+		{
+			name:     "GitHub Actions run URL",
+			arg:      "type=provenance,mode=max,builder-id=https://github.com/org/repo/actions/runs/123456789/attempts/1",
+			expected: "type=provenance,mode=max,builder-id=<VALUE>",
+		},
+		{
+			name:     "GitLab job URL",
+			arg:      "ci.url=https://gitlab.com/org/repo/-/jobs/987654",
+			expected: "ci.url=<VALUE>",
+		},
+		{
+			name:     "Linux temp dir",
+			arg:      "type=local,dest=/tmp/docker-actions-toolkit-abc123/out",
+			expected: "type=local,dest=<VALUE>",
+		},
+		{
+			name:     "macOS temp dir",
+			arg:      "/private/var/folders/xy/abc/T/iidfile",
+			expected: "<VALUE>",
+		},
+		{
+			name:     "GitHub runner temp dir",
+			arg:      "--iidfile=/home/runner/work/_temp/docker-actions-toolkit-x/iidfile",
+			expected: "--iidfile=<VALUE>",
+		},
+		{
+			name:     "Windows temp dir",
+			arg:      `C:\Users\runner\AppData\Local\Temp\iidfile`,
+			expected: "<VALUE>",
+		},
+		{
+			name:     "Regular values are untouched",
+			arg:      "linux/amd64,linux/arm64",
+			expected: "linux/amd64,linux/arm64",
+		},
+		{
+			name:     "Non-run URLs are untouched",
+			arg:      "https://github.com/org/repo.git#main",
+			expected: "https://github.com/org/repo.git#main",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, []string{tc.expected}, templateDynamicValues([]string{tc.arg}, true))
+		})
+	}
+}
+
+func TestHashBuildCommand_AggressiveNormalization(t *testing.T) {
+	tempDir := t.TempDir()
+	dockerfilePath := createTempFileWithContent(t, tempDir, "FROM alpine")
+
+	commandWithRunID := func(runID string) DockerBuildCommand {
+		return DockerBuildCommand{
+			DockerfilePath:         dockerfilePath,
+			BuildContexts:          map[string]string{"default": tempDir},
+			CmdWithoutTagArguments: []string{"docker", "buildx", "build", "--annotation", "run=" + runID, tempDir},
+		}
+	}
+
+	first := commandWithRunID("123e4567-e89b-12d3-a456-426614174000")
+	second := commandWithRunID("00000000-1111-2222-3333-444444444444")
+
+	assert.NotEqual(t, HashBuildCommand(first, Options{}), HashBuildCommand(second, Options{}))
+
+	aggressive := Options{AggressiveNormalize: true}
+	assert.Equal(t, HashBuildCommand(first, aggressive), HashBuildCommand(second, aggressive))
+}
+
+func TestWorkspaceRelativePaths(t *testing.T) {
+	args := []string{"docker", "buildx", "build", "-f=/repo/api/Dockerfile", "--build-context", "shared=/repo/shared", "--label", "src=/repository", "/repo"}
+	assert.Equal(t, args, workspaceRelativePaths(args, ""), "no workspace root")
+
+	assert.Equal(t, []string{
+		"docker", "buildx", "build", "-f=<WORKSPACE>/api/Dockerfile", "--build-context", "shared=<WORKSPACE>/shared",
+		// only whole paths are replaced
+		"--label", "src=/repository", "<WORKSPACE>",
+	}, workspaceRelativePaths(args, "/repo/"))
+
+	assert.Equal(t, args, workspaceRelativePaths(args, "/"), "the filesystem root is not a workspace")
+}
+
+func TestHashBuildCommand_SameRepositoryAtDifferentPaths(t *testing.T) {
+	checkoutCommand := func(root string) DockerBuildCommand {
+		dockerfilePath := filepath.Join(root, "Dockerfile")
+		require.NoError(t, os.WriteFile(dockerfilePath, []byte("FROM alpine"), 0o644))
+		return DockerBuildCommand{
+			DockerfilePath:         dockerfilePath,
+			BuildContexts:          map[string]string{"default": root},
+			CmdWithoutTagArguments: []string{"docker", "buildx", "build", "--file", dockerfilePath, root},
+		}
+	}
+
+	firstRoot, secondRoot := t.TempDir(), t.TempDir()
+	first, second := checkoutCommand(firstRoot), checkoutCommand(secondRoot)
+	assert.NotEqual(t, HashBuildCommand(first, Options{}), HashBuildCommand(second, Options{}))
+
+	assert.Equal(t, HashBuildCommand(first, Options{WorkspaceRoot: firstRoot}), HashBuildCommand(second, Options{WorkspaceRoot: secondRoot}))
+}
+
+func TestTraceNormalization(t *testing.T) {
+	var logs bytes.Buffer
+	defaultLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+	t.Cleanup(func() {
+		slog.SetDefault(defaultLogger)
+		SetNormalizationTracing(false)
+	})
+
+	templateDynamicValues([]string{"--iidfile", "/tmp/abc/iid"}, true)
+	assert.Empty(t, logs.String(), "tracing is off by default")
+
+	SetNormalizationTracing(true)
+	templateDynamicValues([]string{"--iidfile", "/tmp/abc/iid"}, true)
+	assert.Contains(t, logs.String(), `argument=/tmp/abc/iid rule="run-specific value templated" result=<VALUE>`)
+	assert.NotContains(t, logs.String(), "argument=--iidfile", "unchanged arguments are left to the parsers to trace")
+}
@@ -0,0 +1,36 @@
+package hasher
+
+import "context"
+
+// Options pick how the build commands and the files of their contexts are hashed - the same command hashed with other
+// options gets another hash
+type Options struct {
+	// the algorithm that the files of the build contexts are hashed with, "" is the default (imo)
+	FileHashAlgorithm FileHashAlgorithm
+	// template the values of any flag that look run-specific (temp dirs, CI run URLs, UUIDs), on top of the flags
+	// that are always templated
+	AggressiveNormalize bool
+	// the flags whose values are templated, see ParseInfrastructureFlags - none by default
+	InfrastructureFlags []InfrastructureFlag
+	// the directory that the absolute paths of the command arguments are hashed relative to, so that the same
+	// repository checked out at different paths (e.g. /home/runner/work/app and /builds/app) hashes the same - ""
+	// (or "/") hashes the paths as they are
+	WorkspaceRoot string
+	// include the digests of the base images of the Dockerfiles in the hash (--hash-base-images)
+	HashBaseImages bool
+	// do so only for the builds that always pull their base images (--pull-policy resolve)
+	HashBaseImagesOnPull bool
+	// hash bake commands from this pre-resolved bake definition (the JSON output of "docker buildx bake --print")
+	// instead of their bake files and overrides, "" resolves the command
+	BakePlan string
+	// cancels the hashing once done, see cancelled - nil is never cancelled
+	Context context.Context
+}
+
+// fileHashAlgorithm returns the algorithm that the files are hashed with
+func (options Options) fileHashAlgorithm() FileHashAlgorithm {
+	if options.FileHashAlgorithm == "" {
+		return FileHashAlgorithmImo
+	}
+	return options.FileHashAlgorithm
+}
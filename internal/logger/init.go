@@ -2,6 +2,7 @@ package logger
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"log/slog"
 	"os"
@@ -11,30 +12,62 @@ import (
 // Global log level for checking if debug logging is enabled
 var globalLogLevel slog.Level = slog.LevelInfo
 
-func InitLogging(forceDebug bool) {
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+func parseLogLevel(level string) (slog.Level, error) {
+	switch strings.ToLower(level) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return slog.LevelInfo, fmt.Errorf("invalid log level %q, must be debug, info, warn or error", level)
+}
+
+// InitLogging sets up mimosa's logs, which always go to stderr, so that they never mix with the output of the
+// wrapped command on stdout. The log level is picked from (in order) forceDebug, logLevel and LOG_LEVEL, while the
+// format from logFormat and LOG_FORMAT - an invalid logLevel/logFormat is an error, invalid env values are ignored
+func InitLogging(forceDebug bool, logLevel string, logFormat string) error {
 	var level slog.Level
-	if forceDebug {
+	var err error
+	switch {
+	case forceDebug:
 		level = slog.LevelDebug
-	} else {
-		envLevel := strings.ToLower(os.Getenv("LOG_LEVEL"))
-		switch envLevel {
-		case "debug":
-			level = slog.LevelDebug
-		case "info":
-			level = slog.LevelInfo
-		case "warn", "warning":
-			level = slog.LevelWarn
-		case "error":
-			level = slog.LevelError
-		default:
-			level = slog.LevelInfo
+	case logLevel != "":
+		if level, err = parseLogLevel(logLevel); err != nil {
+			return err
 		}
+	default:
+		level, _ = parseLogLevel(os.Getenv("LOG_LEVEL"))
 	}
 
-	slog.SetLogLoggerLevel(level)
+	if logFormat == "" {
+		logFormat = strings.ToLower(os.Getenv("LOG_FORMAT"))
+		if logFormat != LogFormatJSON {
+			logFormat = LogFormatText
+		}
+	}
+
+	switch logFormat {
+	case LogFormatJSON:
+		slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: level})))
+	case LogFormatText:
+		slog.SetLogLoggerLevel(level)
+	default:
+		return fmt.Errorf("invalid log format %q, must be %s or %s", logFormat, LogFormatText, LogFormatJSON)
+	}
 
 	// Store the global log level
 	globalLogLevel = level
+
+	return nil
 }
 
 // OnlyMessageHandler is a custom slog handler that only outputs the message
@@ -74,7 +107,7 @@ var CleanLog = slog.New(&OnlyMessageHandler{
 	level:  slog.LevelInfo,
 })
 
-// IsLevelEnabled checks if the given level is enabled (equivalent to logrus IsLevelEnabled)
+// IsLevelEnabled checks if the given level is enabled
 func IsLevelEnabled(level slog.Level) bool {
 	return level >= globalLogLevel
 }
@@ -39,3 +39,68 @@ func TestCleanLog(t *testing.T) {
 		t.Errorf("expected 'test message\\n', got %q", buf.String())
 	}
 }
+
+func restoreLogging(t *testing.T) {
+	t.Helper()
+	defaultLogger := slog.Default()
+	t.Cleanup(func() {
+		slog.SetDefault(defaultLogger)
+		slog.SetLogLoggerLevel(slog.LevelInfo)
+		globalLogLevel = slog.LevelInfo
+	})
+}
+
+func TestInitLogging_Level(t *testing.T) {
+	restoreLogging(t)
+
+	t.Setenv("LOG_LEVEL", "warn")
+	if err := InitLogging(false, "", ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !IsLevelEnabled(slog.LevelWarn) || IsLevelEnabled(slog.LevelInfo) {
+		t.Errorf("expected LOG_LEVEL=warn to be used")
+	}
+
+	if err := InitLogging(false, "error", ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if IsLevelEnabled(slog.LevelWarn) {
+		t.Errorf("expected the log level flag to override LOG_LEVEL")
+	}
+
+	if err := InitLogging(true, "error", ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !IsDebugEnabled() {
+		t.Errorf("expected --debug to override the log level")
+	}
+
+	if err := InitLogging(false, "verbose", ""); err == nil {
+		t.Errorf("expected an error for an invalid log level")
+	}
+
+	t.Setenv("LOG_LEVEL", "verbose")
+	if err := InitLogging(false, "", ""); err != nil || !IsLevelEnabled(slog.LevelInfo) || IsDebugEnabled() {
+		t.Errorf("expected an invalid LOG_LEVEL to fall back to info, got error %v", err)
+	}
+}
+
+func TestInitLogging_Format(t *testing.T) {
+	restoreLogging(t)
+
+	if err := InitLogging(false, "", LogFormatJSON); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := slog.Default().Handler().(*slog.JSONHandler); !ok {
+		t.Errorf("expected a JSON handler, got %T", slog.Default().Handler())
+	}
+
+	if err := InitLogging(false, "", "yaml"); err == nil {
+		t.Errorf("expected an error for an invalid log format")
+	}
+
+	t.Setenv("LOG_FORMAT", "yaml")
+	if err := InitLogging(false, "", ""); err != nil {
+		t.Errorf("expected an invalid LOG_FORMAT to be ignored, got %v", err)
+	}
+}
@@ -0,0 +1,90 @@
+package logger
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// how often to remind that the current phase is still running, so that long phases do not look like a hang
+const progressReminderInterval = 10 * time.Second
+
+// ProgressReporter prints the current phase of a mimosa run along with the elapsed time
+type ProgressReporter struct {
+	mu           sync.Mutex
+	writer       io.Writer
+	enabled      bool
+	start        time.Time
+	currentPhase string
+	reminder     *time.Timer
+}
+
+// Progress is the global progress reporter - it is disabled until InitProgress enables it
+var Progress = &ProgressReporter{
+	writer: os.Stderr,
+}
+
+// InitProgress enables progress reporting, unless quiet is requested or stderr is not a terminal
+func InitProgress(quiet bool) {
+	Progress.mu.Lock()
+	defer Progress.mu.Unlock()
+
+	Progress.enabled = !quiet && isTerminal(os.Stderr)
+	Progress.start = time.Now()
+}
+
+func isTerminal(file *os.File) bool {
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return false
+	}
+	return fileInfo.Mode()&os.ModeCharDevice != 0
+}
+
+// Phase reports that a new phase has started, e.g. Phase("hashing build contexts (%d/%d)", 1, 3)
+func (p *ProgressReporter) Phase(format string, args ...any) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.enabled {
+		return
+	}
+
+	p.currentPhase = fmt.Sprintf(format, args...)
+	p.print(p.currentPhase)
+
+	if p.reminder != nil {
+		p.reminder.Stop()
+	}
+	p.reminder = time.AfterFunc(progressReminderInterval, p.remind)
+}
+
+// Done stops any pending reminders of the current phase
+func (p *ProgressReporter) Done() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.reminder != nil {
+		p.reminder.Stop()
+		p.reminder = nil
+	}
+}
+
+func (p *ProgressReporter) remind() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.enabled || p.reminder == nil {
+		return
+	}
+
+	p.print("still " + p.currentPhase)
+	p.reminder = time.AfterFunc(progressReminderInterval, p.remind)
+}
+
+func (p *ProgressReporter) print(message string) {
+	elapsed := time.Since(p.start).Seconds()
+	_, _ = fmt.Fprintf(p.writer, "[mimosa %5.1fs] %s\n", elapsed, message)
+}
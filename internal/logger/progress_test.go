@@ -0,0 +1,53 @@
+package logger
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestProgressReporter_Disabled(t *testing.T) {
+	var buf bytes.Buffer
+	reporter := &ProgressReporter{writer: &buf}
+
+	reporter.Phase("parsing command")
+	reporter.Done()
+
+	if buf.Len() != 0 {
+		t.Errorf("expected no output when disabled, got %q", buf.String())
+	}
+}
+
+func TestProgressReporter_Enabled(t *testing.T) {
+	var buf bytes.Buffer
+	reporter := &ProgressReporter{writer: &buf, enabled: true, start: time.Now()}
+
+	reporter.Phase("hashing build contexts (%d/%d)", 1, 3)
+	reporter.Done()
+
+	expected := "[mimosa   0.0s] hashing build contexts (1/3)\n"
+	if buf.String() != expected {
+		t.Errorf("expected %q, got %q", expected, buf.String())
+	}
+}
+
+func TestProgressReporter_Remind(t *testing.T) {
+	var buf bytes.Buffer
+	reporter := &ProgressReporter{writer: &buf, enabled: true, start: time.Now()}
+
+	reporter.Phase("checking registry cache")
+	reporter.remind()
+	reporter.Done()
+
+	expected := "[mimosa   0.0s] checking registry cache\n[mimosa   0.0s] still checking registry cache\n"
+	if buf.String() != expected {
+		t.Errorf("expected %q, got %q", expected, buf.String())
+	}
+}
+
+func TestInitProgress_Quiet(t *testing.T) {
+	InitProgress(true)
+	if Progress.enabled {
+		t.Error("expected progress to be disabled in quiet mode")
+	}
+}
@@ -1,24 +1,58 @@
 package actions
 
 import (
+	"time"
+
 	"github.com/hytromo/mimosa/internal/cacher"
 	"github.com/hytromo/mimosa/internal/configuration"
+	"github.com/hytromo/mimosa/internal/hasher"
 )
 
 type Actions interface {
 	// hashing
-	ParseCommand(command []string) (configuration.ParsedCommand, error)
+	ParseCommand(command []string, hashingOptions hasher.Options) (configuration.ParsedCommand, error)
 
 	// command execution
-	RunCommand(dryRun bool, command []string) int
+	// env holds extra KEY=VALUE environment variables for the command, on top of mimosa's environment
+	RunCommand(dryRun bool, command []string, env ...string) int
+	RunCommandScanningPushes(dryRun bool, command []string, pushPatterns []string, env []string) (int, []string)
 	ExitProcessWithCode(code int)
 
-	// docker
-	RetagFromCacheTags(cacheTagPairsByTarget map[string][]cacher.CacheTagPair, dryRun bool) error
+	// docker - dockerConfigDir is the docker config dir of the command (see ParsedCommand), whose credentials the
+	// registry calls use
+	RetagFromCacheTags(dockerConfigDir string, cacheTagPairsByTarget map[string][]cacher.CacheTagPair, dryRun bool) error
+	// checks that the new tags can be pushed to their repositories, before retagging to them
+	CheckPushPermission(dockerConfigDir string, cacheTagPairsByTarget map[string][]cacher.CacheTagPair, dryRun bool) error
+	// checks that the cached images are built for all the requested platforms of their targets
+	VerifyCachedPlatforms(dockerConfigDir string, cacheTagPairsByTarget map[string][]cacher.CacheTagPair, platformsByTarget map[string][]string) error
+	// checks that the cached images hold all the requested attestations (provenance, sbom) of their targets
+	VerifyCachedAttestations(dockerConfigDir string, cacheTagPairsByTarget map[string][]cacher.CacheTagPair, attestationsByTarget map[string][]string) error
+	// writes the --iidfile/--metadata-file of a command that was served from the cache
+	WriteCacheHitOutputs(command []string, cacheTagPairsByTarget map[string][]cacher.CacheTagPair, dryRun bool) error
+	InspectBuilder(command []string) (string, error)
+	// resolves the tags to the digests they point to in their registries
+	TagDigests(dockerConfigDir string, tags []string) (map[string]string, error)
 
 	// registry cache
-	CheckRegistryCacheExists(hash string, tagsByTarget map[string][]string) (bool, map[string][]cacher.CacheTagPair, error)
-	SaveRegistryCacheTags(hash string, tagsByTarget map[string][]string, dryRun bool) error
+	CheckRegistryCacheExists(dockerConfigDir string, hash string, tagsByTarget map[string][]string) (bool, map[string][]cacher.CacheTagPair, error)
+	SaveRegistryCacheTags(dockerConfigDir string, hash string, tagsByTarget map[string][]string, dryRun bool) error
+	// announces the build of the hash for ttl, returning instead the time another build is announced until if it has
+	// already announced itself (the zero time otherwise)
+	AnnounceRegistryBuild(dockerConfigDir string, hash string, tagsByTarget map[string][]string, ttl time.Duration, dryRun bool) (time.Time, error)
+	// the time the build of the hash is announced until, the zero time when no build is announced anymore
+	RegistryBuildAnnouncedUntil(dockerConfigDir string, hash string, tagsByTarget map[string][]string) (time.Time, error)
+	// withdraws the announcement of this build, when it will not save the cache
+	WithdrawRegistryBuild(dockerConfigDir string, hash string, tagsByTarget map[string][]string) error
+	// the inputs of the last build that pushed the digest to the repository of the tag, to analyze rebuilds
+	RecordedBuildInputs(dockerConfigDir string, tag string, digest string) (cacher.BuildInputs, bool, error)
+	RecordBuildInputs(dockerConfigDir string, tag string, digest string, inputs cacher.BuildInputs) error
+
+	// local cache, for commands that only load their image to the local docker daemon of the command
+	// reports whether the docker daemon of the command answers, without it mimosa runs registry-only
+	DockerDaemonAvailable(command []string) bool
+	CheckLocalCacheExists(command []string, hash string, tagsByTarget map[string][]string) (bool, map[string][]cacher.CacheTagPair, error)
+	RetagLocally(command []string, cacheTagPairsByTarget map[string][]cacher.CacheTagPair, dryRun bool) error
+	SaveLocalCacheTags(command []string, hash string, tagsByTarget map[string][]string, dryRun bool) error
 }
 
 // Actioner is a concrete implementation of the Actions interface
@@ -1,14 +1,42 @@
 package actions
 
 import (
+	"io"
 	"os"
 	"os/exec"
 	"strings"
 
 	"log/slog"
+
+	"github.com/hytromo/mimosa/internal/utils/tempdir"
 )
 
-func (a *Actioner) RunCommand(dryRun bool, command []string) int {
+func (a *Actioner) RunCommand(dryRun bool, command []string, env ...string) int {
+	stdout, stderr, closeOutput := commandWriters(os.Stdout, os.Stderr)
+	defer closeOutput()
+	return runCommand(dryRun, command, env, stdout, stderr)
+}
+
+// RunCommandScanningPushes runs the command like RunCommand, while scanning its output for the image references it
+// pushed, using the built-in and the given push patterns. The output is still shown as is, but it is no longer written
+// straight to the terminal, so build tools fall back to their non-interactive progress
+func (a *Actioner) RunCommandScanningPushes(dryRun bool, command []string, pushPatterns []string, env []string) (int, []string) {
+	patterns, err := CompilePushPatterns(pushPatterns)
+	if err != nil {
+		slog.Error("Cannot scan the command output", "error", err)
+		return a.RunCommand(dryRun, command, env...), nil
+	}
+
+	stdout, stderr, closeOutput := commandWriters(os.Stdout, os.Stderr)
+	defer closeOutput()
+	stdoutScanner := &pushScanner{patterns: patterns}
+	stderrScanner := &pushScanner{patterns: patterns}
+	exitCode := runCommand(dryRun, command, env, io.MultiWriter(stdout, stdoutScanner), io.MultiWriter(stderr, stderrScanner))
+
+	return exitCode, append(stdoutScanner.pushedReferences(), stderrScanner.pushedReferences()...)
+}
+
+func runCommand(dryRun bool, command []string, env []string, stdout io.Writer, stderr io.Writer) int {
 	if dryRun {
 		slog.Info("> DRY RUN: command would be run", "command", strings.Join(command, " "))
 		return 0
@@ -24,10 +52,16 @@ func (a *Actioner) RunCommand(dryRun bool, command []string) int {
 		return 1
 	}
 
+	// unless its output is scanned, prefixed or teed, the command inherits mimosa's stdio and environment as is - nothing is buffered: when
+	// stdout is a terminal, the command writes straight to it (so buildx shows its interactive, colored progress), and
+	// BUILDKIT_PROGRESS (or --progress) keeps controlling the progress output, even for remote (e.g. kubernetes) builders
 	cmd := exec.Command(command[0], command[1:]...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
 	cmd.Stdin = os.Stdin
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
 
 	err := cmd.Run()
 	if err != nil {
@@ -44,5 +78,7 @@ func (a *Actioner) RunCommand(dryRun bool, command []string) int {
 }
 
 func (a *Actioner) ExitProcessWithCode(code int) {
+	// deferred calls do not run on exit
+	tempdir.Cleanup()
 	os.Exit(code)
 }
@@ -0,0 +1,92 @@
+package actions
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"sync"
+
+	"log/slog"
+)
+
+// CommandOutput is what happens to the output of the wrapped command - the zero value shows it as is
+type CommandOutput struct {
+	Quiet  bool   // do not show the output in the terminal
+	Prefix string // prefix every line shown in the terminal with this
+	File   string // also append the output, as is, to this file
+}
+
+var commandOutput CommandOutput
+
+// SetCommandOutput sets what happens to the output of the commands run from now on
+func SetCommandOutput(output CommandOutput) {
+	commandOutput = output
+}
+
+// commandWriters returns the writers of the command's stdout and stderr according to the command output settings, and
+// a function that closes the output file, if any. By default these are the terminal's stdout and stderr themselves
+func commandWriters(stdout io.Writer, stderr io.Writer) (io.Writer, io.Writer, func()) {
+	output := commandOutput
+
+	switch {
+	case output.Quiet:
+		stdout, stderr = io.Discard, io.Discard
+	case output.Prefix != "":
+		stdout, stderr = &prefixWriter{out: stdout, prefix: []byte(output.Prefix)}, &prefixWriter{out: stderr, prefix: []byte(output.Prefix)}
+	}
+
+	if output.File == "" {
+		return stdout, stderr, func() {}
+	}
+
+	file, err := os.OpenFile(output.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		slog.Warn("Failed to open the command output file, the output is not written to it", "file", output.File, "error", err)
+		return stdout, stderr, func() {}
+	}
+	// stdout and stderr are copied concurrently
+	shared := &lockedWriter{out: file}
+	return io.MultiWriter(stdout, shared), io.MultiWriter(stderr, shared), func() {
+		if err := file.Close(); err != nil {
+			slog.Warn("Failed to close the command output file", "file", output.File, "error", err)
+		}
+	}
+}
+
+// prefixWriter writes the prefix at the start of every line; progress output redraws lines with carriage returns, so
+// these start a new line too
+type prefixWriter struct {
+	out     io.Writer
+	prefix  []byte
+	midLine bool
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	var buffer bytes.Buffer
+	for _, b := range p {
+		if !w.midLine {
+			buffer.Write(w.prefix)
+			w.midLine = true
+		}
+		buffer.WriteByte(b)
+		if b == '\n' || b == '\r' {
+			w.midLine = false
+		}
+	}
+	if _, err := w.out.Write(buffer.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// lockedWriter serializes the writes of many goroutines
+type lockedWriter struct {
+	mu  sync.Mutex
+	out io.Writer
+}
+
+func (w *lockedWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.out.Write(p)
+}
@@ -0,0 +1,64 @@
+package actions
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func useCommandOutput(t *testing.T, output CommandOutput) {
+	t.Helper()
+	SetCommandOutput(output)
+	t.Cleanup(func() {
+		SetCommandOutput(CommandOutput{})
+	})
+}
+
+func TestCommandWriters_Default(t *testing.T) {
+	stdout, stderr, closeOutput := commandWriters(os.Stdout, os.Stderr)
+	defer closeOutput()
+
+	// the terminal is passed as is, so the command can tell that it writes to one
+	assert.Equal(t, os.Stdout, stdout)
+	assert.Equal(t, os.Stderr, stderr)
+}
+
+func TestCommandWriters_PrefixAndFile(t *testing.T) {
+	outputFile := filepath.Join(t.TempDir(), "build.log")
+	useCommandOutput(t, CommandOutput{Prefix: "[api] ", File: outputFile})
+
+	var terminalStdout, terminalStderr bytes.Buffer
+	stdout, stderr, closeOutput := commandWriters(&terminalStdout, &terminalStderr)
+	_, err := stdout.Write([]byte("#1 building\n#1 do"))
+	require.NoError(t, err)
+	_, err = stdout.Write([]byte("ne\r#2 pushing\n"))
+	require.NoError(t, err)
+	_, err = stderr.Write([]byte("warning\n"))
+	require.NoError(t, err)
+	closeOutput()
+
+	assert.Equal(t, "[api] #1 building\n[api] #1 done\r[api] #2 pushing\n", terminalStdout.String())
+	assert.Equal(t, "[api] warning\n", terminalStderr.String())
+
+	content, err := os.ReadFile(outputFile)
+	require.NoError(t, err)
+	assert.Equal(t, "#1 building\n#1 done\r#2 pushing\nwarning\n", string(content))
+}
+
+func TestRunCommand_QuietWithOutputFile(t *testing.T) {
+	outputFile := filepath.Join(t.TempDir(), "build.log")
+	useCommandOutput(t, CommandOutput{Quiet: true, File: outputFile})
+
+	actioner := &Actioner{}
+	exitCode, pushed := actioner.RunCommandScanningPushes(false, []string{"sh", "-c", "echo 'pushing manifest for org/app:v1@sha256:00'"}, nil, nil)
+
+	assert.Equal(t, 0, exitCode)
+	assert.Equal(t, []string{"org/app:v1"}, pushed, "the output is still scanned")
+	content, err := os.ReadFile(outputFile)
+	require.NoError(t, err)
+	assert.Equal(t, "pushing manifest for org/app:v1@sha256:00\n", string(content))
+}
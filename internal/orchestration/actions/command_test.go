@@ -113,3 +113,22 @@ func TestRunCommandShouldHandleInvalidCommands(t *testing.T) {
 	exitCode = actioner.RunCommand(false, []string{"true"})
 	assert.Equal(t, 0, exitCode, "true command should return exit code 0")
 }
+
+func TestRunCommandPropagatesBuildkitProgress(t *testing.T) {
+	actioner := &Actioner{}
+	t.Setenv("BUILDKIT_PROGRESS", "plain")
+
+	exitCode := actioner.RunCommand(false, []string{"sh", "-c", `test "$BUILDKIT_PROGRESS" = plain`})
+	assert.Equal(t, 0, exitCode, "the command should see mimosa's environment")
+}
+
+func TestRunCommandWithEnv(t *testing.T) {
+	actioner := &Actioner{}
+	t.Setenv("MIMOSA_TEST_INHERITED", "yes")
+
+	exitCode := actioner.RunCommand(false, []string{"sh", "-c", `test "$MIMOSA_TEST_EXTRA" = "1" && test "$MIMOSA_TEST_INHERITED" = "yes"`}, "MIMOSA_TEST_EXTRA=1")
+	assert.Equal(t, 0, exitCode, "the extra variables are added to the inherited environment")
+
+	exitCode = actioner.RunCommand(false, []string{"sh", "-c", `test -z "$MIMOSA_TEST_EXTRA"`})
+	assert.Equal(t, 0, exitCode)
+}
@@ -1,14 +1,54 @@
 package actions
 
 import (
+	"log/slog"
+	"time"
+
 	"github.com/hytromo/mimosa/internal/cacher"
 	"github.com/hytromo/mimosa/internal/docker"
 )
 
 // RetagFromCacheTags retags from cache tags to new tags.
 // Each cache tag pair contains a cache tag and its corresponding new tag in the SAME repository.
-func (a *Actioner) RetagFromCacheTags(cacheTagPairsByTarget map[string][]cacher.CacheTagPair, dryRun bool) error {
-	// Convert cacher.CacheTagPair to docker.CacheTagPair
+func (a *Actioner) RetagFromCacheTags(dockerConfigDir string, cacheTagPairsByTarget map[string][]cacher.CacheTagPair, dryRun bool) error {
+	return docker.Retag(dockerConfigDir, toDockerCacheTagPairs(cacheTagPairsByTarget), dryRun)
+}
+
+// CheckPushPermission checks that the new tags can be pushed to their repositories
+func (a *Actioner) CheckPushPermission(dockerConfigDir string, cacheTagPairsByTarget map[string][]cacher.CacheTagPair, dryRun bool) error {
+	if dryRun {
+		slog.Info("> DRY RUN: would check the push permission to the repositories of the new tags")
+		return nil
+	}
+	return docker.CheckPushPermission(dockerConfigDir, toDockerCacheTagPairs(cacheTagPairsByTarget))
+}
+
+// VerifyCachedPlatforms checks that the images of the cache tags are built for the platforms requested for their targets
+func (a *Actioner) VerifyCachedPlatforms(dockerConfigDir string, cacheTagPairsByTarget map[string][]cacher.CacheTagPair, platformsByTarget map[string][]string) error {
+	return docker.VerifyCachedPlatforms(dockerConfigDir, toDockerCacheTagPairs(cacheTagPairsByTarget), platformsByTarget)
+}
+
+// VerifyCachedAttestations checks that the images of the cache tags hold the attestations requested for their targets
+func (a *Actioner) VerifyCachedAttestations(dockerConfigDir string, cacheTagPairsByTarget map[string][]cacher.CacheTagPair, attestationsByTarget map[string][]string) error {
+	return docker.VerifyCachedAttestations(dockerConfigDir, toDockerCacheTagPairs(cacheTagPairsByTarget), attestationsByTarget)
+}
+
+// WriteCacheHitOutputs writes the --iidfile/--metadata-file of the command from the images it was retagged to
+func (a *Actioner) WriteCacheHitOutputs(command []string, cacheTagPairsByTarget map[string][]cacher.CacheTagPair, dryRun bool) error {
+	if dryRun {
+		slog.Info("> DRY RUN: would write the build output files of the cached images", "files", docker.OutputFilesFromCommand(command))
+		return nil
+	}
+	return docker.WriteCacheHitOutputs(command, toDockerCacheTagPairs(cacheTagPairsByTarget))
+}
+
+// TagDigests resolves the tags to the digests they point to in their registries
+func (a *Actioner) TagDigests(dockerConfigDir string, tags []string) (map[string]string, error) {
+	return docker.TagDigests(dockerConfigDir, tags)
+}
+
+// toDockerCacheTagPairs converts cacher.CacheTagPair to docker.CacheTagPair
+func toDockerCacheTagPairs(cacheTagPairsByTarget map[string][]cacher.CacheTagPair) map[string][]docker.CacheTagPair {
 	dockerPairs := make(map[string][]docker.CacheTagPair)
 	for target, pairs := range cacheTagPairsByTarget {
 		dockerPairs[target] = make([]docker.CacheTagPair, len(pairs))
@@ -16,21 +56,103 @@ func (a *Actioner) RetagFromCacheTags(cacheTagPairsByTarget map[string][]cacher.
 			dockerPairs[target][i] = docker.CacheTagPair{CacheTag: p.CacheTag, NewTag: p.NewTag}
 		}
 	}
-	return docker.Retag(dockerPairs, dryRun)
+	return dockerPairs
+}
+
+// InspectBuilder returns a normalized summary of the buildx builder that the command is going to use
+func (a *Actioner) InspectBuilder(command []string) (string, error) {
+	globalFlags, command := docker.SplitGlobalFlags(command)
+	builderInfo, err := docker.InspectBuilder(globalFlags, docker.BuilderNameFromCommand(command))
+	if err != nil {
+		return "", err
+	}
+	return builderInfo.Summary(), nil
 }
 
-func (a *Actioner) CheckRegistryCacheExists(hash string, tagsByTarget map[string][]string) (bool, map[string][]cacher.CacheTagPair, error) {
+func (a *Actioner) CheckRegistryCacheExists(dockerConfigDir string, hash string, tagsByTarget map[string][]string) (bool, map[string][]cacher.CacheTagPair, error) {
 	registryCache := &cacher.RegistryCache{
-		Hash:         hash,
-		TagsByTarget: tagsByTarget,
+		Hash:            hash,
+		TagsByTarget:    tagsByTarget,
+		DockerConfigDir: dockerConfigDir,
 	}
 	return registryCache.Exists()
 }
 
-func (a *Actioner) SaveRegistryCacheTags(hash string, tagsByTarget map[string][]string, dryRun bool) error {
+func (a *Actioner) SaveRegistryCacheTags(dockerConfigDir string, hash string, tagsByTarget map[string][]string, dryRun bool) error {
+	registryCache := &cacher.RegistryCache{
+		Hash:            hash,
+		TagsByTarget:    tagsByTarget,
+		DockerConfigDir: dockerConfigDir,
+	}
+	return registryCache.SaveCacheTags(dryRun)
+}
+
+func (a *Actioner) AnnounceRegistryBuild(dockerConfigDir string, hash string, tagsByTarget map[string][]string, ttl time.Duration, dryRun bool) (time.Time, error) {
 	registryCache := &cacher.RegistryCache{
+		Hash:            hash,
+		TagsByTarget:    tagsByTarget,
+		DockerConfigDir: dockerConfigDir,
+	}
+	return registryCache.Announce(ttl, dryRun)
+}
+
+// RegistryBuildAnnouncedUntil returns the time the build of the hash is announced until
+func (a *Actioner) RegistryBuildAnnouncedUntil(dockerConfigDir string, hash string, tagsByTarget map[string][]string) (time.Time, error) {
+	registryCache := &cacher.RegistryCache{
+		Hash:            hash,
+		TagsByTarget:    tagsByTarget,
+		DockerConfigDir: dockerConfigDir,
+	}
+	return registryCache.AnnouncedUntil()
+}
+
+// WithdrawRegistryBuild withdraws the announcement of the build of the hash
+func (a *Actioner) WithdrawRegistryBuild(dockerConfigDir string, hash string, tagsByTarget map[string][]string) error {
+	registryCache := &cacher.RegistryCache{
+		Hash:            hash,
+		TagsByTarget:    tagsByTarget,
+		DockerConfigDir: dockerConfigDir,
+	}
+	return registryCache.Withdraw()
+}
+
+// RecordedBuildInputs returns the inputs of the last build that pushed the digest to the repository of the tag
+func (a *Actioner) RecordedBuildInputs(dockerConfigDir string, tag string, digest string) (cacher.BuildInputs, bool, error) {
+	return cacher.RecordedBuildInputs(dockerConfigDir, tag, digest)
+}
+
+// RecordBuildInputs records the inputs of the build that pushed the digest to the repository of the tag
+func (a *Actioner) RecordBuildInputs(dockerConfigDir string, tag string, digest string, inputs cacher.BuildInputs) error {
+	return cacher.RecordBuildInputs(dockerConfigDir, tag, digest, inputs)
+}
+
+func (a *Actioner) DockerDaemonAvailable(command []string) bool {
+	globalFlags, _ := docker.SplitGlobalFlags(command)
+	return docker.DaemonAvailable(globalFlags)
+}
+
+func (a *Actioner) CheckLocalCacheExists(command []string, hash string, tagsByTarget map[string][]string) (bool, map[string][]cacher.CacheTagPair, error) {
+	globalFlags, _ := docker.SplitGlobalFlags(command)
+	localCache := &cacher.LocalCache{
+		GlobalFlags:  globalFlags,
 		Hash:         hash,
 		TagsByTarget: tagsByTarget,
 	}
-	return registryCache.SaveCacheTags(dryRun)
+	return localCache.Exists()
+}
+
+// RetagLocally points the new tags of the local docker daemon of the command to the images of their cache tags
+func (a *Actioner) RetagLocally(command []string, cacheTagPairsByTarget map[string][]cacher.CacheTagPair, dryRun bool) error {
+	globalFlags, _ := docker.SplitGlobalFlags(command)
+	return docker.RetagLocally(globalFlags, toDockerCacheTagPairs(cacheTagPairsByTarget), dryRun)
+}
+
+func (a *Actioner) SaveLocalCacheTags(command []string, hash string, tagsByTarget map[string][]string, dryRun bool) error {
+	globalFlags, _ := docker.SplitGlobalFlags(command)
+	localCache := &cacher.LocalCache{
+		GlobalFlags:  globalFlags,
+		Hash:         hash,
+		TagsByTarget: tagsByTarget,
+	}
+	return localCache.SaveCacheTags(dryRun)
 }
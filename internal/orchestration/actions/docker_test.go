@@ -27,7 +27,7 @@ func TestActioner_RetagFromCacheTags_Success(t *testing.T) {
 	}
 
 	// Perform the retag
-	err := actioner.RetagFromCacheTags(cacheTagPairs, false)
+	err := actioner.RetagFromCacheTags("", cacheTagPairs, false)
 	require.NoError(t, err)
 
 	// Verify the new tag exists in the registry
@@ -51,7 +51,7 @@ func TestActioner_RetagFromCacheTags_DryRun(t *testing.T) {
 	}
 
 	// Perform dry run retag
-	err := actioner.RetagFromCacheTags(cacheTagPairs, true)
+	err := actioner.RetagFromCacheTags("", cacheTagPairs, true)
 	require.NoError(t, err)
 
 	// Verify the new tag does NOT exist (dry run should not create it)
@@ -63,7 +63,7 @@ func TestActioner_RetagFromCacheTags_EmptyPairs(t *testing.T) {
 	actioner := &Actioner{}
 
 	// Empty cache tag pairs should return an error
-	err := actioner.RetagFromCacheTags(map[string][]cacher.CacheTagPair{}, false)
+	err := actioner.RetagFromCacheTags("", map[string][]cacher.CacheTagPair{}, false)
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "no cache tag pairs provided")
 }
@@ -83,7 +83,7 @@ func TestActioner_RetagFromCacheTags_CrossRepoFails(t *testing.T) {
 		},
 	}
 
-	err := actioner.RetagFromCacheTags(cacheTagPairs, false)
+	err := actioner.RetagFromCacheTags("", cacheTagPairs, false)
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "retagging across repositories is not supported")
 }
@@ -109,7 +109,7 @@ func TestActioner_RetagFromCacheTags_MultipleTargets(t *testing.T) {
 	}
 
 	// Perform retag
-	err := actioner.RetagFromCacheTags(cacheTagPairs, false)
+	err := actioner.RetagFromCacheTags("", cacheTagPairs, false)
 	require.NoError(t, err)
 
 	// Verify both new tags exist
@@ -138,7 +138,7 @@ func TestActioner_CheckRegistryCacheExists_CacheHit(t *testing.T) {
 			{CacheTag: baseImage, NewTag: cacheTag},
 		},
 	}
-	err := actioner.RetagFromCacheTags(cacheTagPairs, false)
+	err := actioner.RetagFromCacheTags("", cacheTagPairs, false)
 	require.NoError(t, err)
 
 	// Now check if cache exists for a tag in the same repo
@@ -146,7 +146,7 @@ func TestActioner_CheckRegistryCacheExists_CacheHit(t *testing.T) {
 		"default": {fmt.Sprintf("localhost:5000/%s:v1.0.0", imageName)},
 	}
 
-	exists, cachePairs, err := actioner.CheckRegistryCacheExists(testHash, tagsByTarget)
+	exists, cachePairs, err := actioner.CheckRegistryCacheExists("", testHash, tagsByTarget)
 	require.NoError(t, err)
 	assert.True(t, exists, "Cache should exist")
 	assert.NotNil(t, cachePairs)
@@ -164,7 +164,7 @@ func TestActioner_CheckRegistryCacheExists_CacheMiss(t *testing.T) {
 		"default": {fmt.Sprintf("localhost:5000/nonexistent-%d:v1.0.0", testID)},
 	}
 
-	exists, cachePairs, err := actioner.CheckRegistryCacheExists(testHash, tagsByTarget)
+	exists, cachePairs, err := actioner.CheckRegistryCacheExists("", testHash, tagsByTarget)
 	require.NoError(t, err)
 	assert.False(t, exists, "Cache should not exist for non-existent image")
 	assert.Nil(t, cachePairs)
@@ -174,7 +174,7 @@ func TestActioner_CheckRegistryCacheExists_EmptyTags(t *testing.T) {
 	actioner := &Actioner{}
 
 	// Empty tags should return an error
-	exists, cachePairs, err := actioner.CheckRegistryCacheExists("somehash", map[string][]string{})
+	exists, cachePairs, err := actioner.CheckRegistryCacheExists("", "somehash", map[string][]string{})
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "no tags to check")
 	assert.False(t, exists)
@@ -196,7 +196,7 @@ func TestActioner_SaveRegistryCacheTags_Success(t *testing.T) {
 		"default": {originalTag},
 	}
 
-	err := actioner.SaveRegistryCacheTags(testHash, tagsByTarget, false)
+	err := actioner.SaveRegistryCacheTags("", testHash, tagsByTarget, false)
 	require.NoError(t, err)
 
 	// Verify the cache tag was created
@@ -220,7 +220,7 @@ func TestActioner_SaveRegistryCacheTags_DryRun(t *testing.T) {
 		"default": {originalTag},
 	}
 
-	err := actioner.SaveRegistryCacheTags(testHash, tagsByTarget, true)
+	err := actioner.SaveRegistryCacheTags("", testHash, tagsByTarget, true)
 	require.NoError(t, err)
 
 	// Verify the cache tag was NOT created (dry run)
@@ -233,7 +233,7 @@ func TestActioner_SaveRegistryCacheTags_EmptyTags(t *testing.T) {
 	actioner := &Actioner{}
 
 	// Empty tags should return an error
-	err := actioner.SaveRegistryCacheTags("somehash", map[string][]string{}, false)
+	err := actioner.SaveRegistryCacheTags("", "somehash", map[string][]string{}, false)
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "no tags to save")
 }
@@ -247,7 +247,7 @@ func TestActioner_SaveRegistryCacheTags_NonExistentSourceTag(t *testing.T) {
 		"default": {fmt.Sprintf("localhost:5000/nonexistent-source-%d:v1.0.0", testID)},
 	}
 
-	err := actioner.SaveRegistryCacheTags("somehash", tagsByTarget, false)
+	err := actioner.SaveRegistryCacheTags("", "somehash", tagsByTarget, false)
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "failed to create some cache tags")
 }
@@ -271,18 +271,18 @@ func TestActioner_EndToEnd_CacheHitFlow(t *testing.T) {
 		"default": {originalTag},
 	}
 
-	err := actioner.SaveRegistryCacheTags(testHash, tagsByTarget, false)
+	err := actioner.SaveRegistryCacheTags("", testHash, tagsByTarget, false)
 	require.NoError(t, err)
 
 	// Step 2: Check cache exists
-	exists, cachePairs, err := actioner.CheckRegistryCacheExists(testHash, tagsByTarget)
+	exists, cachePairs, err := actioner.CheckRegistryCacheExists("", testHash, tagsByTarget)
 	require.NoError(t, err)
 	assert.True(t, exists, "Cache should exist after saving")
 	require.NotNil(t, cachePairs)
 	require.Len(t, cachePairs["default"], 1)
 
 	// Step 3: Retag from cache to new tag
-	err = actioner.RetagFromCacheTags(cachePairs, false)
+	err = actioner.RetagFromCacheTags("", cachePairs, false)
 	require.NoError(t, err)
 
 	// Verify the original tag still exists
@@ -2,17 +2,48 @@ package actions
 
 import (
 	"errors"
+	"slices"
 
 	"github.com/hytromo/mimosa/internal/configuration"
 	"github.com/hytromo/mimosa/internal/docker"
+	"github.com/hytromo/mimosa/internal/hasher"
 )
 
-func (a *Actioner) ParseCommand(command []string) (configuration.ParsedCommand, error) {
+func (a *Actioner) ParseCommand(command []string, hashingOptions hasher.Options) (configuration.ParsedCommand, error) {
+	// custom parsers take precedence, so that they can handle any executable
+	if parsedByRegisteredParser, ok, err := parseWithRegisteredParsers(command, hashingOptions); ok {
+		return parsedByRegisteredParser, err
+	}
+
+	// docker's global flags (--config, --context etc) pick where/how the command runs, not what it builds
+	globalFlags, commandWithoutGlobalFlags := docker.SplitGlobalFlags(command)
+	if len(globalFlags) > 0 {
+		dockerConfigDir := docker.ConfigDirFromGlobalFlags(globalFlags)
+		parsedCommand, err := a.parseDockerCommand(commandWithoutGlobalFlags, hashingOptions, dockerConfigDir)
+		// the command is run as given, with its global flags
+		parsedCommand.Command = command
+		parsedCommand.DockerConfigDir = dockerConfigDir
+		return parsedCommand, err
+	}
+
+	return a.parseDockerCommand(command, hashingOptions, "")
+}
+
+// parseDockerCommand parses a docker command without global flags, whose registry calls use the credentials of
+// dockerConfigDir
+func (a *Actioner) parseDockerCommand(command []string, hashingOptions hasher.Options, dockerConfigDir string) (configuration.ParsedCommand, error) {
 	parsedCommand := configuration.ParsedCommand{
 		// still set the original command so that it can be run if needed
 		Command: command,
 	}
 
+	// aliases (e.g. "docker builder build") are parsed as the build command they stand for, and run as given
+	if canonicalCommand := docker.CanonicalBuildCommand(command); !slices.Equal(canonicalCommand, command) {
+		parsedCommand, err := a.parseDockerCommand(canonicalCommand, hashingOptions, dockerConfigDir)
+		parsedCommand.Command = command
+		return parsedCommand, err
+	}
+
 	// "docker build ." is the smallest possible command
 	if len(command) < 3 {
 		return parsedCommand, errors.New("command is too short")
@@ -23,7 +54,7 @@ func (a *Actioner) ParseCommand(command []string) (configuration.ParsedCommand,
 	}
 
 	if command[1] == "build" {
-		return docker.ParseBuildCommand(command)
+		return docker.ParseBuildCommand(command, hashingOptions, dockerConfigDir)
 	}
 
 	if command[1] != "buildx" {
@@ -37,9 +68,9 @@ func (a *Actioner) ParseCommand(command []string) (configuration.ParsedCommand,
 
 	switch command[2] {
 	case "build":
-		return docker.ParseBuildCommand(command)
+		return docker.ParseBuildCommand(command, hashingOptions, dockerConfigDir)
 	case "bake":
-		return docker.ParseBakeCommand(command)
+		return docker.ParseBakeCommand(command, hashingOptions, dockerConfigDir)
 	default:
 		return parsedCommand, errors.New("sub-command must either be 'build' or 'bake'")
 	}
@@ -1,9 +1,13 @@
 package actions
 
 import (
+	"os"
+	"strings"
 	"testing"
 
+	"github.com/hytromo/mimosa/internal/hasher"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestParseCommand(t *testing.T) {
@@ -77,7 +81,7 @@ func TestParseCommand(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			actioner := &Actioner{}
-			result, err := actioner.ParseCommand(tt.command)
+			result, err := actioner.ParseCommand(tt.command, hasher.Options{})
 
 			if tt.expectError {
 				assert.Error(t, err)
@@ -120,7 +124,7 @@ func TestParseCommandShouldPreserveCommandOnError(t *testing.T) {
 
 	for _, tt := range testCases {
 		t.Run(tt.name, func(t *testing.T) {
-			result, err := actioner.ParseCommand(tt.command)
+			result, err := actioner.ParseCommand(tt.command, hasher.Options{})
 
 			if tt.expectError {
 				assert.Error(t, err, "Should return error for: %v", tt.command)
@@ -133,11 +137,52 @@ func TestParseCommandShouldPreserveCommandOnError(t *testing.T) {
 func TestParseCommandShouldValidateInput(t *testing.T) {
 	actioner := &Actioner{}
 
-	result, err := actioner.ParseCommand(nil)
+	result, err := actioner.ParseCommand(nil, hasher.Options{})
 	assert.Error(t, err, "Should return error for nil command")
 	assert.Nil(t, result.Command, "Command should be nil for nil input")
 
-	result, err = actioner.ParseCommand([]string{})
+	result, err = actioner.ParseCommand([]string{}, hasher.Options{})
 	assert.Error(t, err, "Should return error for empty command")
 	assert.Equal(t, []string{}, result.Command, "Command should be empty for empty input")
 }
+
+func TestParseCommandWithDockerGlobalFlags(t *testing.T) {
+	actioner := &Actioner{}
+	t.Setenv("DOCKER_CONFIG", "/original")
+
+	command := []string{"docker", "--context", "colima", "--config", "/tmp/docker-config", "buildx", "build", "--push", "-t", "myimage:latest", "."}
+	result, err := actioner.ParseCommand(command, hasher.Options{})
+	assert.NoError(t, err)
+
+	// the command is run with its global flags, but they do not affect the hash
+	assert.Equal(t, command, result.Command)
+	withoutGlobalFlags, err := actioner.ParseCommand([]string{"docker", "buildx", "build", "--push", "-t", "myimage:latest", "."}, hasher.Options{})
+	assert.NoError(t, err)
+	assert.Equal(t, withoutGlobalFlags.Hash, result.Hash)
+
+	// mimosa's own registry calls for the command use its config dir, without changing the one of the other commands
+	assert.Equal(t, "/tmp/docker-config", result.DockerConfigDir)
+	assert.Equal(t, "", withoutGlobalFlags.DockerConfigDir)
+	assert.Equal(t, "/original", os.Getenv("DOCKER_CONFIG"))
+}
+
+func TestParseCommandWithSubcommandAliases(t *testing.T) {
+	actioner := &Actioner{}
+
+	for alias, canonical := range map[string][]string{
+		"builder build": {"build"},
+		"image build":   {"build"},
+		"buildx b":      {"buildx", "build"},
+	} {
+		command := append(append([]string{"docker"}, strings.Fields(alias)...), "--push", "-t", "myimage:latest", ".")
+		result, err := actioner.ParseCommand(command, hasher.Options{})
+		require.NoError(t, err, alias)
+
+		// the alias is run as given, and hashed like the build command it stands for
+		assert.Equal(t, command, result.Command)
+		canonicalResult, err := actioner.ParseCommand(append(append([]string{"docker"}, canonical...), "--push", "-t", "myimage:latest", "."), hasher.Options{})
+		require.NoError(t, err)
+		assert.Equal(t, canonicalResult.Hash, result.Hash, alias)
+		assert.Equal(t, canonicalResult.TagsByTarget, result.TagsByTarget, alias)
+	}
+}
@@ -0,0 +1,79 @@
+package actions
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"slices"
+	"sync"
+
+	"github.com/samber/lo"
+)
+
+// builtinPushPatterns match the image references that the supported build tools report as pushed - the first capture
+// group of each pattern is the reference, without its digest
+var builtinPushPatterns = []string{
+	// buildx (build and bake): "#12 pushing manifest for docker.io/org/app:v1@sha256:... 0.3s done"
+	`pushing manifest for ([^\s@]+)`,
+}
+
+// CompilePushPatterns compiles the built-in patterns together with the given ones; each pattern must capture the
+// pushed image reference in its first group
+func CompilePushPatterns(extraPatterns []string) ([]*regexp.Regexp, error) {
+	patterns := []*regexp.Regexp{}
+	for _, pattern := range append(slices.Clone(builtinPushPatterns), extraPatterns...) {
+		compiled, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid push pattern %q: %w", pattern, err)
+		}
+		if compiled.NumSubexp() < 1 {
+			return nil, fmt.Errorf("push pattern %q must capture the image reference in a group", pattern)
+		}
+		patterns = append(patterns, compiled)
+	}
+	return patterns, nil
+}
+
+// pushScanner is an io.Writer that scans the output of a command, line by line, for the image references it pushed
+type pushScanner struct {
+	patterns []*regexp.Regexp
+	mu       sync.Mutex
+	pending  []byte
+	pushed   []string
+}
+
+func (s *pushScanner) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pending = append(s.pending, p...)
+	for {
+		// progress output also uses carriage returns to redraw lines
+		end := bytes.IndexAny(s.pending, "\r\n")
+		if end == -1 {
+			break
+		}
+		s.scanLine(s.pending[:end])
+		s.pending = s.pending[end+1:]
+	}
+
+	return len(p), nil
+}
+
+func (s *pushScanner) scanLine(line []byte) {
+	for _, pattern := range s.patterns {
+		for _, match := range pattern.FindAllSubmatch(line, -1) {
+			s.pushed = append(s.pushed, string(match[1]))
+		}
+	}
+}
+
+// pushedReferences returns the unique references found in the output, including its last, unterminated, line
+func (s *pushScanner) pushedReferences() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.scanLine(s.pending)
+	s.pending = nil
+	return lo.Uniq(s.pushed)
+}
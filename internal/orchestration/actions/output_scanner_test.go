@@ -0,0 +1,61 @@
+package actions
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPushScanner_BuildxOutput(t *testing.T) {
+	patterns, err := CompilePushPatterns(nil)
+	require.NoError(t, err)
+	scanner := &pushScanner{patterns: patterns}
+
+	output := "#10 exporting to image\n" +
+		"#10 pushing layers 0.4s done\n" +
+		"#10 pushing manifest for docker.io/org/app:v1@sha256:0123abcd 0.3s done\r" +
+		"#10 pushing manifest for docker.io/org/app:v1@sha256:0123abcd 0.3s done\n" +
+		"#10 pushing manifest for ghcr.io/org/app:latest@sha256:4567ef"
+
+	// split writes must not break lines apart
+	for i := 0; i < len(output); i += 7 {
+		_, err := scanner.Write([]byte(output[i:min(i+7, len(output))]))
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, []string{"docker.io/org/app:v1", "ghcr.io/org/app:latest"}, scanner.pushedReferences())
+}
+
+func TestPushScanner_ExtraPatterns(t *testing.T) {
+	patterns, err := CompilePushPatterns([]string{`Pushed image (\S+)`})
+	require.NoError(t, err)
+	scanner := &pushScanner{patterns: patterns}
+
+	_, err = fmt.Fprintln(scanner, "Pushed image org/app:v1 ok")
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"org/app:v1"}, scanner.pushedReferences())
+}
+
+func TestCompilePushPatterns_Invalid(t *testing.T) {
+	_, err := CompilePushPatterns([]string{"(unclosed"})
+	assert.Error(t, err)
+
+	_, err = CompilePushPatterns([]string{"no capture group"})
+	assert.ErrorContains(t, err, "must capture")
+}
+
+func TestRunCommandScanningPushes(t *testing.T) {
+	actioner := &Actioner{}
+
+	exitCode, pushed := actioner.RunCommandScanningPushes(false, []string{"sh", "-c", "echo 'pushed org/app:v1'; echo 'pushing manifest for org/app:v2@sha256:00' >&2"}, []string{`pushed (\S+)`}, nil)
+
+	assert.Equal(t, 0, exitCode)
+	assert.ElementsMatch(t, []string{"org/app:v1", "org/app:v2"}, pushed)
+
+	exitCode, pushed = actioner.RunCommandScanningPushes(false, []string{"sh", "-c", "exit 3"}, nil, nil)
+	assert.Equal(t, 3, exitCode)
+	assert.Empty(t, pushed)
+}
@@ -0,0 +1,184 @@
+package actions
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"log/slog"
+
+	"github.com/hytromo/mimosa/internal/configuration"
+	"github.com/hytromo/mimosa/internal/docker"
+	"github.com/hytromo/mimosa/internal/hasher"
+)
+
+// CommandParser parses commands that are not docker build/bake commands, e.g. an internal wrapper like
+// "build-tool image push ...". Matching a command means that the parser guarantees that the command,
+// when successful, pushes the parsed tags to the registry.
+type CommandParser interface {
+	// Name is used for logging purposes
+	Name() string
+	// Matches reports whether the parser can parse the command
+	Matches(command []string) bool
+	// Parse returns the parsed command, hashed with the hashing options of the run if the parser hashes it itself -
+	// the hash and the tags by target are mandatory
+	Parse(command []string, hashingOptions hasher.Options) (configuration.ParsedCommand, error)
+}
+
+var (
+	commandParsersMu sync.RWMutex
+	commandParsers   = []CommandParser{}
+)
+
+// RegisterCommandParser registers a parser that is tried before the built-in docker parsers
+func RegisterCommandParser(parser CommandParser) {
+	commandParsersMu.Lock()
+	defer commandParsersMu.Unlock()
+
+	commandParsers = append(commandParsers, parser)
+}
+
+// findCommandParser returns the first registered parser that matches the command, if any
+func findCommandParser(command []string) (CommandParser, bool) {
+	commandParsersMu.RLock()
+	defer commandParsersMu.RUnlock()
+
+	for _, parser := range commandParsers {
+		if parser.Matches(command) {
+			return parser, true
+		}
+	}
+
+	return nil, false
+}
+
+// ExternalParserPrefix is the prefix of the binaries that can parse commands of other executables:
+// "mimosa-parser-build-tool" (found in PATH) parses commands starting with "build-tool" - the commands of the
+// executables that mimosa parses itself (docker, kaniko) are never handed to external parsers
+const ExternalParserPrefix = "mimosa-parser-"
+
+// externalParserOutput is the JSON that external parsers print to stdout
+type externalParserOutput struct {
+	Hash         string              `json:"hash"`
+	TagsByTarget map[string][]string `json:"tagsByTarget"`
+	// optional - the command to run on cache miss, defaults to the parsed command
+	Command []string `json:"command,omitempty"`
+}
+
+// ExternalBinaryParser delegates the parsing of a command to the "mimosa-parser-<executable>" binary, which
+// receives the whole command as its arguments and prints the parsed command as JSON to stdout
+type ExternalBinaryParser struct {
+	lookPath func(file string) (string, error)
+}
+
+func (p ExternalBinaryParser) Name() string {
+	return "external binary"
+}
+
+func (p ExternalBinaryParser) parserBinary(command []string) (string, bool) {
+	if len(command) == 0 || command[0] == "" || strings.ContainsRune(command[0], os.PathSeparator) {
+		return "", false
+	}
+	if hasBuiltInParser(command) {
+		return "", false
+	}
+
+	lookPath := p.lookPath
+	if lookPath == nil {
+		lookPath = exec.LookPath
+	}
+
+	binary, err := lookPath(ExternalParserPrefix + command[0])
+	if err != nil {
+		return "", false
+	}
+	return binary, true
+}
+
+// hasBuiltInParser reports whether mimosa parses the commands of the executable itself
+func hasBuiltInParser(command []string) bool {
+	return command[0] == "docker" || docker.IsKanikoCommand(command)
+}
+
+func (p ExternalBinaryParser) Matches(command []string) bool {
+	_, ok := p.parserBinary(command)
+	return ok
+}
+
+func (p ExternalBinaryParser) Parse(command []string, _ hasher.Options) (configuration.ParsedCommand, error) {
+	parsedCommand := configuration.ParsedCommand{
+		Command: command,
+	}
+
+	binary, ok := p.parserBinary(command)
+	if !ok {
+		return parsedCommand, fmt.Errorf("no external parser found for %s", command[0])
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(binary, command...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return parsedCommand, fmt.Errorf("external parser %s failed: %w: %s", binary, err, strings.TrimSpace(stderr.String()))
+	}
+
+	var output externalParserOutput
+	if err := json.Unmarshal(stdout.Bytes(), &output); err != nil {
+		return parsedCommand, fmt.Errorf("external parser %s returned invalid JSON: %w", binary, err)
+	}
+
+	if len(output.Command) > 0 {
+		parsedCommand.Command = output.Command
+	}
+	parsedCommand.Hash = output.Hash
+	parsedCommand.TagsByTarget = output.TagsByTarget
+
+	return parsedCommand, nil
+}
+
+// KanikoParser parses kaniko executor commands, e.g. "/kaniko/executor --context . --destination org/app:v1"
+type KanikoParser struct{}
+
+func (p KanikoParser) Name() string {
+	return "kaniko"
+}
+
+func (p KanikoParser) Matches(command []string) bool {
+	return docker.IsKanikoCommand(command)
+}
+
+func (p KanikoParser) Parse(command []string, hashingOptions hasher.Options) (configuration.ParsedCommand, error) {
+	return docker.ParseKanikoCommand(command, hashingOptions)
+}
+
+// parseWithRegisteredParsers parses the command with the first matching registered parser
+func parseWithRegisteredParsers(command []string, hashingOptions hasher.Options) (configuration.ParsedCommand, bool, error) {
+	parser, ok := findCommandParser(command)
+	if !ok {
+		return configuration.ParsedCommand{Command: command}, false, nil
+	}
+
+	slog.Debug("Parsing command with registered parser", "parser", parser.Name(), "command", command)
+	parsedCommand, err := parser.Parse(command, hashingOptions)
+	if err == nil && (parsedCommand.Hash == "" || len(parsedCommand.TagsByTarget) == 0) {
+		err = fmt.Errorf("parser %s returned a command without hash or tags", parser.Name())
+	}
+	if len(parsedCommand.Command) == 0 {
+		// still set the original command so that it can be run if needed
+		parsedCommand.Command = command
+	}
+
+	return parsedCommand, true, err
+}
+
+func init() {
+	RegisterCommandParser(KanikoParser{})
+	// last, as it only parses the commands that no built-in parser is for
+	RegisterCommandParser(ExternalBinaryParser{})
+}
@@ -0,0 +1,159 @@
+package actions
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/hytromo/mimosa/internal/configuration"
+	"github.com/hytromo/mimosa/internal/hasher"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeCommandParser struct {
+	executable string
+	parsed     configuration.ParsedCommand
+	err        error
+}
+
+func (p fakeCommandParser) Name() string {
+	return "fake"
+}
+
+func (p fakeCommandParser) Matches(command []string) bool {
+	return len(command) > 0 && command[0] == p.executable
+}
+
+func (p fakeCommandParser) Parse(command []string, _ hasher.Options) (configuration.ParsedCommand, error) {
+	return p.parsed, p.err
+}
+
+func useCommandParsers(t *testing.T, parsers ...CommandParser) {
+	t.Helper()
+	original := commandParsers
+	commandParsers = []CommandParser{}
+	for _, parser := range parsers {
+		RegisterCommandParser(parser)
+	}
+	t.Cleanup(func() {
+		commandParsers = original
+	})
+}
+
+func writeExternalParser(t *testing.T, executable, script string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("shell scripts are not supported on windows")
+	}
+
+	binDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(binDir, ExternalParserPrefix+executable), []byte("#!/bin/sh\n"+script), 0755))
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestParseCommand_RegisteredParser(t *testing.T) {
+	command := []string{"build-tool", "image", "push", "myreg/app:v1"}
+	useCommandParsers(t, fakeCommandParser{
+		executable: "build-tool",
+		parsed: configuration.ParsedCommand{
+			Hash:         "abc",
+			TagsByTarget: map[string][]string{"default": {"myreg/app:v1"}},
+		},
+	})
+
+	parsedCommand, err := New().ParseCommand(command, hasher.Options{})
+	require.NoError(t, err)
+
+	assert.Equal(t, "abc", parsedCommand.Hash)
+	assert.Equal(t, map[string][]string{"default": {"myreg/app:v1"}}, parsedCommand.TagsByTarget)
+	// the original command is kept so that it can be run
+	assert.Equal(t, command, parsedCommand.Command)
+}
+
+func TestParseCommand_RegisteredParserErrors(t *testing.T) {
+	command := []string{"build-tool", "image", "push"}
+
+	useCommandParsers(t, fakeCommandParser{executable: "build-tool", err: errors.New("boom")})
+	parsedCommand, err := New().ParseCommand(command, hasher.Options{})
+	assert.ErrorContains(t, err, "boom")
+	assert.Equal(t, command, parsedCommand.Command)
+
+	useCommandParsers(t, fakeCommandParser{executable: "build-tool"})
+	_, err = New().ParseCommand(command, hasher.Options{})
+	assert.ErrorContains(t, err, "without hash or tags")
+}
+
+func TestParseCommand_NoMatchingParser(t *testing.T) {
+	useCommandParsers(t, fakeCommandParser{executable: "build-tool"})
+
+	_, err := New().ParseCommand([]string{"other-tool", "image", "push"}, hasher.Options{})
+	assert.ErrorContains(t, err, "command must start with 'docker'")
+}
+
+func TestExternalBinaryParser(t *testing.T) {
+	writeExternalParser(t, "build-tool", `echo '{"hash": "'"$4"'", "tagsByTarget": {"default": ["myreg/app:v1"]}}'`)
+	useCommandParsers(t, ExternalBinaryParser{})
+
+	command := []string{"build-tool", "image", "push", "myhash"}
+	parsedCommand, err := New().ParseCommand(command, hasher.Options{})
+	require.NoError(t, err)
+
+	assert.Equal(t, "myhash", parsedCommand.Hash)
+	assert.Equal(t, map[string][]string{"default": {"myreg/app:v1"}}, parsedCommand.TagsByTarget)
+	assert.Equal(t, command, parsedCommand.Command)
+}
+
+func TestExternalBinaryParser_OverridesCommand(t *testing.T) {
+	writeExternalParser(t, "build-tool", `echo '{"hash": "h", "tagsByTarget": {"default": ["a:b"]}, "command": ["build-tool", "push", "--really"]}'`)
+
+	parsedCommand, err := ExternalBinaryParser{}.Parse([]string{"build-tool", "push"}, hasher.Options{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"build-tool", "push", "--really"}, parsedCommand.Command)
+}
+
+func TestExternalBinaryParser_Failures(t *testing.T) {
+	writeExternalParser(t, "failing-tool", "echo 'cannot parse' >&2\nexit 3")
+	writeExternalParser(t, "invalid-tool", "echo 'not json'")
+
+	_, err := ExternalBinaryParser{}.Parse([]string{"failing-tool", "push"}, hasher.Options{})
+	assert.ErrorContains(t, err, "cannot parse")
+
+	_, err = ExternalBinaryParser{}.Parse([]string{"invalid-tool", "push"}, hasher.Options{})
+	assert.ErrorContains(t, err, "invalid JSON")
+}
+
+func TestExternalBinaryParser_Matches(t *testing.T) {
+	parser := ExternalBinaryParser{lookPath: func(file string) (string, error) {
+		if file == ExternalParserPrefix+"build-tool" || file == ExternalParserPrefix+"docker" || file == ExternalParserPrefix+"executor" {
+			return "/usr/local/bin/" + file, nil
+		}
+		return "", errors.New("not found")
+	}}
+
+	assert.True(t, parser.Matches([]string{"build-tool", "push"}))
+	assert.False(t, parser.Matches([]string{"other-tool", "push"}))
+	assert.False(t, parser.Matches([]string{"./build-tool", "push"}))
+	assert.False(t, parser.Matches([]string{}))
+	// docker and kaniko commands are parsed by the built-in parsers, even if an external parser is found for them
+	assert.False(t, parser.Matches([]string{"docker", "buildx", "build", "."}))
+	assert.False(t, parser.Matches([]string{"executor", "--context", "."}))
+}
+
+func TestParseCommand_Kaniko(t *testing.T) {
+	contextDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(contextDir, "Dockerfile"), []byte("FROM alpine\n"), 0644))
+	command := []string{"/kaniko/executor", "--context", contextDir, "--destination", "registry.io/org/app:v1"}
+
+	parser, ok := findCommandParser(command)
+	require.True(t, ok)
+	assert.Equal(t, "kaniko", parser.Name())
+
+	parsedCommand, err := New().ParseCommand(command, hasher.Options{})
+	require.NoError(t, err)
+	assert.NotEmpty(t, parsedCommand.Hash)
+	assert.Equal(t, map[string][]string{"default": {"registry.io/org/app:v1"}}, parsedCommand.TagsByTarget)
+	assert.Equal(t, command, parsedCommand.Command)
+}
@@ -0,0 +1,36 @@
+package orchestrator
+
+import (
+	"time"
+
+	"github.com/hytromo/mimosa/internal/cacher"
+	"github.com/hytromo/mimosa/internal/configuration"
+	"github.com/hytromo/mimosa/internal/reporting"
+)
+
+// auditHash records the hash of the command in the audit log
+func auditHash(parsedCommand configuration.ParsedCommand) {
+	reporting.Audit(reporting.AuditHashComputed, "hash", parsedCommand.Hash, "command", parsedCommand.Command, "tags", parsedCommand.TagsByTarget)
+}
+
+// auditHashTimeout records in the audit log that hashing the command was given up on after --hash-timeout
+func auditHashTimeout(command []string, timeout time.Duration) {
+	reporting.Audit(reporting.AuditHashTimedOut, "command", command, "timeout", timeout.String())
+}
+
+// auditCacheLookup records the result of a cache lookup in the audit log
+func auditCacheLookup(parsedCommand configuration.ParsedCommand, exists bool, cacheTagsByTarget map[string][]cacher.CacheTagPair, err error) {
+	keyValues := []any{"hash", parsedCommand.Hash, "local", parsedCommand.Local, "found", exists}
+	if exists {
+		keyValues = append(keyValues, "cacheTags", cacheTagsByTarget)
+	}
+	if err != nil {
+		keyValues = append(keyValues, "error", err.Error())
+	}
+	reporting.Audit(reporting.AuditCacheLookup, keyValues...)
+}
+
+// auditCacheSaved records the saved cache tags of the command in the audit log
+func auditCacheSaved(parsedCommand configuration.ParsedCommand, dryRun bool) {
+	reporting.Audit(reporting.AuditCacheSaved, "hash", parsedCommand.Hash, "local", parsedCommand.Local, "tags", parsedCommand.TagsByTarget, "dryRun", dryRun)
+}
@@ -0,0 +1,304 @@
+package orchestrator
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hytromo/mimosa/internal/cacher"
+	"github.com/hytromo/mimosa/internal/configuration"
+	"github.com/hytromo/mimosa/internal/docker"
+	"github.com/hytromo/mimosa/internal/hasher"
+	"github.com/hytromo/mimosa/internal/logger"
+	"github.com/hytromo/mimosa/internal/orchestration/actions"
+	"github.com/hytromo/mimosa/internal/reporting"
+)
+
+const buildkitProgressEnv = "BUILDKIT_PROGRESS"
+
+type batchStatus string
+
+const (
+	batchStatusHit     batchStatus = "hit"     // retagged from cache
+	batchStatusMiss    batchStatus = "miss"    // built and cache tags saved
+	batchStatusSkipped batchStatus = "skipped" // cache miss in retag-only mode
+	batchStatusRan     batchStatus = "ran"     // not cacheable, run as is
+	batchStatusFailed  batchStatus = "failed"  // the command failed
+	// sync mode only: the hash was already reconciled by an earlier pass
+	batchStatusUpToDate batchStatus = "up-to-date"
+)
+
+// batchBuild keeps the state of a single build of the batch
+type batchBuild struct {
+	parsedCommand     configuration.ParsedCommand
+	cacheable         bool
+	cacheTagsByTarget map[string][]cacher.CacheTagPair
+	status            batchStatus
+	exitCode          int
+	buildDuration     time.Duration
+}
+
+// forEachConcurrently calls fn for every index up to count, using up to concurrency goroutines
+func forEachConcurrently(count int, concurrency int, fn func(i int)) {
+	indexes := make(chan int, count)
+	for i := range count {
+		indexes <- i
+	}
+	close(indexes)
+
+	var wg sync.WaitGroup
+	for range max(1, min(concurrency, count)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				fn(i)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// usePlainBuildkitProgress makes the builds that run at the same time print plain progress, because the interactive
+// progress of one build redraws the terminal lines of the others - unless the user has chosen a progress mode
+func usePlainBuildkitProgress() {
+	if _, ok := os.LookupEnv(buildkitProgressEnv); ok {
+		return
+	}
+	if err := os.Setenv(buildkitProgressEnv, "plain"); err != nil {
+		slog.Debug("Failed to set plain buildkit progress", "error", err)
+	}
+}
+
+// HandleRememberBatch is the batch version of HandleRememberSubcommand: all the commands are hashed concurrently
+// (sharing the hashing of common build contexts), checked against the registry cache, and then only the misses are run,
+// using up to BatchConcurrency commands at a time
+func HandleRememberBatch(rememberOptions configuration.RememberSubcommandOptions, commands [][]string, act actions.Actions) error {
+	if !rememberOptions.Enabled {
+		return errors.New("remember subcommand must be enabled")
+	}
+
+	if len(commands) == 0 {
+		return errors.New("no commands to run")
+	}
+
+	builds := runBatch(rememberOptions, commands, act, nil)
+	reportBuilds(rememberOptions.DryRun, batchRecords(builds)...)
+	recordSavings(rememberOptions.DryRun, batchSavingsEntries(builds)...)
+	writeDigestMap(rememberOptions.DigestMapFile, act, rememberOptions.DryRun, batchCachedCommands(builds)...)
+	return reportBatch(builds, act)
+}
+
+// batchRecords returns the records of the builds of the batch that hit or missed the cache
+func batchRecords(builds []*batchBuild) []reporting.Record {
+	records := []reporting.Record{}
+	for _, build := range builds {
+		if build.status == batchStatusHit || build.status == batchStatusMiss {
+			records = append(records, buildRecord(build.parsedCommand, build.status == batchStatusHit, build.buildDuration))
+		}
+	}
+	return records
+}
+
+// batchSavingsEntries returns the savings entries of the builds of the batch that hit or missed the cache
+func batchSavingsEntries(builds []*batchBuild) []reporting.SavingsEntry {
+	entries := []reporting.SavingsEntry{}
+	for _, build := range builds {
+		if build.status == batchStatusHit || build.status == batchStatusMiss {
+			entries = append(entries, savingsEntry(build.parsedCommand, build.status == batchStatusHit, build.buildDuration))
+		}
+	}
+	return entries
+}
+
+// batchCachedCommands returns the commands of the builds of the batch that hit or missed the cache
+func batchCachedCommands(builds []*batchBuild) []configuration.ParsedCommand {
+	parsedCommands := []configuration.ParsedCommand{}
+	for _, build := range builds {
+		if build.status == batchStatusHit || build.status == batchStatusMiss {
+			parsedCommands = append(parsedCommands, build.parsedCommand)
+		}
+	}
+	return parsedCommands
+}
+
+// runBatch hashes, checks against the registry cache, retags and runs the commands - builds whose hash upToDate
+// reports as already reconciled are not checked nor run (upToDate can be nil)
+func runBatch(rememberOptions configuration.RememberSubcommandOptions, commands [][]string, act actions.Actions, upToDate func(i int, hash string) bool) []*batchBuild {
+	dryRun := rememberOptions.DryRun
+	builds := make([]*batchBuild, len(commands))
+	for i, command := range commands {
+		builds[i] = &batchBuild{parsedCommand: configuration.ParsedCommand{Command: command}}
+	}
+
+	hashingErr := configureHashing(rememberOptions)
+	if hashingErr == nil {
+		hashingErr = validatePushVerification(rememberOptions)
+	}
+	if hashingErr == nil {
+		_, hashingErr = hitTagTemplate(rememberOptions.HitTagTemplate)
+	}
+	rollout := 100
+	if hashingErr == nil {
+		rollout, hashingErr = rolloutPercentage()
+	}
+	if hashingErr != nil {
+		slog.Error("Cannot hash the batch, running all the commands as is", "error", hashingErr)
+	} else if cachingDisabled() {
+		hashingErr = errors.New(disableEnv + " is set")
+		slog.Info("Running all the commands without caching", "reason", hashingErr)
+	}
+
+	hasher.SetMemoization(true)
+	defer hasher.SetMemoization(false)
+	docker.ForgetRegistryState()
+
+	// 1. hash all the builds concurrently
+	if hashingErr == nil {
+		deadline := hashDeadline(rememberOptions)
+		forEachConcurrently(len(builds), runtime.NumCPU(), func(i int) {
+			build := builds[i]
+			parsedCommand, err := parseAndHashCommandBefore(deadline, rememberOptions, act, commands[i])
+			build.parsedCommand = parsedCommand
+			if errors.Is(err, errNoPush) && rememberOptions.RequirePush {
+				slog.Error("The command does not push to a registry, not running it because of --require-push", "command", commands[i])
+				build.status = batchStatusFailed
+				build.exitCode = 1
+				return
+			}
+			if err != nil {
+				slog.Warn("Build is not cacheable, it will be run as is", "command", commands[i], "error", err)
+				return
+			}
+			auditHash(parsedCommand)
+			if upToDate != nil && upToDate(i, parsedCommand.Hash) {
+				build.status = batchStatusUpToDate
+				return
+			}
+			if !inRollout(parsedCommand.Hash, rollout) {
+				slog.Info("Running the command without caching", "command", commands[i], "reason", fmt.Sprintf("not in the %d%% %s", rollout, rolloutEnv))
+				return
+			}
+			build.cacheable = true
+		})
+	}
+
+	// 2. check the registry cache for all the cacheable builds
+	logger.Progress.Phase("checking registry cache for %d builds", len(builds))
+	forEachConcurrently(len(builds), runtime.NumCPU(), func(i int) {
+		build := builds[i]
+		if !build.cacheable {
+			return
+		}
+		exists, cacheTagsByTarget, err := checkCache(rememberOptions, act, build.parsedCommand)
+		if err != nil {
+			slog.Warn("Error checking registry cache, the build will be run as is", "command", build.parsedCommand.Command, "error", err)
+			build.cacheable = false
+			return
+		}
+		if exists && cachedImagesMatch(act, build.parsedCommand, cacheTagsByTarget) {
+			build.cacheTagsByTarget = cacheTagsByTarget
+			build.status = batchStatusHit
+		}
+	})
+
+	// 3. retag the hits
+	for _, build := range builds {
+		if build.status != batchStatusHit {
+			continue
+		}
+		logger.Progress.Phase("retagging from cache")
+		cacheTagsByTarget, err := withHitTagTemplate(rememberOptions, &build.parsedCommand, build.cacheTagsByTarget)
+		if err != nil {
+			slog.Error("Cannot name the tags of the cache hit", "command", build.parsedCommand.Command, "error", err)
+			build.status = batchStatusFailed
+			build.exitCode = 1
+			continue
+		}
+		build.cacheTagsByTarget = cacheTagsByTarget
+		if err := checkPushPermission(act, build.parsedCommand, build.cacheTagsByTarget, dryRun); err != nil {
+			slog.Error("Cannot push the cached images to the requested tags, check the registry credentials", "command", build.parsedCommand.Command, "error", err)
+			build.status = batchStatusFailed
+			build.exitCode = 1
+			continue
+		}
+		if err := retagFromCache(act, build.parsedCommand, build.cacheTagsByTarget, dryRun); err != nil {
+			slog.Warn("Failed to retag from cache, the build will be run as is", "command", build.parsedCommand.Command, "error", err)
+			build.status = ""
+			build.cacheable = false
+			continue
+		}
+		writeCacheHitOutputs(act, build.parsedCommand, build.cacheTagsByTarget, dryRun)
+		printHitMarkers(rememberOptions.HitMarker, build.parsedCommand)
+	}
+
+	// 4. run the misses
+	logger.Progress.Phase("running the builds that missed the cache")
+	logger.Progress.Done()
+	if rememberOptions.BatchConcurrency > 1 {
+		usePlainBuildkitProgress()
+	}
+	forEachConcurrently(len(builds), rememberOptions.BatchConcurrency, func(i int) {
+		build := builds[i]
+		if build.status == batchStatusHit || build.status == batchStatusFailed || build.status == batchStatusUpToDate {
+			return
+		}
+		if rememberOptions.RetagOnly {
+			build.status = batchStatusSkipped
+			return
+		}
+
+		if !build.cacheable {
+			build.exitCode = act.RunCommand(dryRun, build.parsedCommand.Command)
+		} else {
+			var saveCacheTags bool
+			buildStart := time.Now()
+			build.exitCode, saveCacheTags = runCacheMissCommand(rememberOptions, act, build.parsedCommand)
+			build.buildDuration = time.Since(buildStart)
+			build.cacheable = saveCacheTags
+		}
+		switch {
+		case build.exitCode != 0:
+			build.status = batchStatusFailed
+		case build.cacheable:
+			build.status = batchStatusMiss
+			if err := saveCommandCacheTags(rememberOptions, act, build.parsedCommand); err != nil {
+				slog.Warn("Failed to save registry cache tags", "command", build.parsedCommand.Command, "error", err)
+			}
+		default:
+			build.status = batchStatusRan
+		}
+	})
+
+	return builds
+}
+
+// reportBatch prints a consolidated report of the batch and exits with the exit code of the first failed build, if any
+func reportBatch(builds []*batchBuild, act actions.Actions) error {
+	counts := map[batchStatus]int{}
+	firstFailure := -1
+
+	for i, build := range builds {
+		counts[build.status]++
+		if build.status == batchStatusFailed && firstFailure == -1 {
+			firstFailure = i
+		}
+		logger.CleanLog.Info(fmt.Sprintf("mimosa-batch[%d]: %s: %s", i, build.status, strings.Join(build.parsedCommand.Command, " ")))
+	}
+
+	logger.CleanLog.Info(fmt.Sprintf("mimosa-batch: %d builds, %d hit, %d miss, %d skipped, %d ran without cache, %d failed",
+		len(builds), counts[batchStatusHit], counts[batchStatusMiss], counts[batchStatusSkipped], counts[batchStatusRan], counts[batchStatusFailed]))
+
+	if firstFailure != -1 {
+		exitCode := builds[firstFailure].exitCode
+		act.ExitProcessWithCode(exitCode)
+		return fmt.Errorf("%d of %d builds failed, first failure exit code: %d", counts[batchStatusFailed], len(builds), exitCode)
+	}
+
+	return nil
+}
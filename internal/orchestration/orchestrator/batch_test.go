@@ -0,0 +1,178 @@
+package orchestrator
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/hytromo/mimosa/internal/cacher"
+	"github.com/hytromo/mimosa/internal/configuration"
+	"github.com/hytromo/mimosa/internal/reporting"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	batchHitCommand    = []string{"docker", "buildx", "build", "--push", "-t", "myreg1/api:v1", "./api"}
+	batchMissCommand   = []string{"docker", "buildx", "build", "--push", "-t", "myreg1/web:v1", "./web"}
+	batchNoPushCommand = []string{"docker", "buildx", "build", "-t", "myreg1/local:v1", "."}
+)
+
+func batchParsedCommand(command []string, hash string, tag string) configuration.ParsedCommand {
+	return configuration.ParsedCommand{
+		Hash:         hash,
+		Command:      command,
+		TagsByTarget: map[string][]string{"default": {tag}},
+	}
+}
+
+func TestRememberBatch_HitsMissesAndUncacheable(t *testing.T) {
+	rememberOptions := configuration.RememberSubcommandOptions{Enabled: true, BatchConcurrency: 2}
+	mockActions := &MockActions{}
+	// concurrent builds switch to plain progress - make sure the environment is restored afterwards
+	t.Setenv(buildkitProgressEnv, "")
+	require.NoError(t, os.Unsetenv(buildkitProgressEnv))
+
+	hitParsed := batchParsedCommand(batchHitCommand, "hash-api", "myreg1/api:v1")
+	missParsed := batchParsedCommand(batchMissCommand, "hash-web", "myreg1/web:v1")
+	cacheTagPairs := map[string][]cacher.CacheTagPair{
+		"default": {{CacheTag: "myreg1/api:mimosa-content-hash-hash-api", NewTag: "myreg1/api:v1"}},
+	}
+
+	mockActions.On("ParseCommand", batchHitCommand).Return(hitParsed, nil)
+	mockActions.On("ParseCommand", batchMissCommand).Return(missParsed, nil)
+	mockActions.On("CheckRegistryCacheExists", "hash-api", hitParsed.TagsByTarget).Return(true, cacheTagPairs, nil)
+	mockActions.On("CheckRegistryCacheExists", "hash-web", missParsed.TagsByTarget).Return(false, nil, nil)
+	mockActions.On("CheckPushPermission", cacheTagPairs, false).Return(nil)
+	mockActions.On("RetagFromCacheTags", cacheTagPairs, false).Return(nil)
+	mockActions.On("RunCommand", false, batchMissCommand, cacheMissEnv("hash-web")).Return(0)
+	mockActions.On("SaveRegistryCacheTags", "hash-web", missParsed.TagsByTarget, false).Return(nil)
+	// no --push: run as is, without saving cache tags
+	mockActions.On("RunCommand", false, batchNoPushCommand).Return(0)
+
+	err := HandleRememberBatch(rememberOptions, [][]string{batchHitCommand, batchMissCommand, batchNoPushCommand}, mockActions)
+
+	assert.NoError(t, err)
+	mockActions.AssertExpectations(t)
+	mockActions.AssertNotCalled(t, "RunCommand", false, batchHitCommand)
+	mockActions.AssertNotCalled(t, "ParseCommand", batchNoPushCommand)
+	mockActions.AssertNotCalled(t, "ExitProcessWithCode", 0)
+	assert.Equal(t, "plain", os.Getenv(buildkitProgressEnv))
+}
+
+func TestRememberBatch_FailedBuildExitsWithItsCode(t *testing.T) {
+	rememberOptions := configuration.RememberSubcommandOptions{Enabled: true}
+	mockActions := &MockActions{}
+
+	missParsed := batchParsedCommand(batchMissCommand, "hash-web", "myreg1/web:v1")
+
+	mockActions.On("ParseCommand", batchMissCommand).Return(missParsed, nil)
+	mockActions.On("CheckRegistryCacheExists", "hash-web", missParsed.TagsByTarget).Return(false, nil, nil)
+	mockActions.On("RunCommand", false, batchMissCommand, cacheMissEnv("hash-web")).Return(2)
+	mockActions.On("ExitProcessWithCode", 2).Return()
+
+	err := HandleRememberBatch(rememberOptions, [][]string{batchMissCommand}, mockActions)
+
+	assert.ErrorContains(t, err, "1 of 1 builds failed")
+	mockActions.AssertExpectations(t)
+	mockActions.AssertNotCalled(t, "SaveRegistryCacheTags")
+}
+
+func TestRememberBatch_RetagOnlySkipsMisses(t *testing.T) {
+	rememberOptions := configuration.RememberSubcommandOptions{Enabled: true, RetagOnly: true}
+	mockActions := &MockActions{}
+
+	missParsed := batchParsedCommand(batchMissCommand, "hash-web", "myreg1/web:v1")
+
+	mockActions.On("ParseCommand", batchMissCommand).Return(missParsed, nil)
+	mockActions.On("CheckRegistryCacheExists", "hash-web", missParsed.TagsByTarget).Return(false, nil, nil)
+
+	err := HandleRememberBatch(rememberOptions, [][]string{batchMissCommand, batchNoPushCommand}, mockActions)
+
+	assert.NoError(t, err)
+	mockActions.AssertExpectations(t)
+	mockActions.AssertNotCalled(t, "RunCommand")
+}
+
+func TestRememberBatch_RetagFailureRunsTheBuild(t *testing.T) {
+	rememberOptions := configuration.RememberSubcommandOptions{Enabled: true}
+	mockActions := &MockActions{}
+
+	hitParsed := batchParsedCommand(batchHitCommand, "hash-api", "myreg1/api:v1")
+	cacheTagPairs := map[string][]cacher.CacheTagPair{
+		"default": {{CacheTag: "myreg1/api:mimosa-content-hash-hash-api", NewTag: "myreg1/api:v1"}},
+	}
+
+	mockActions.On("ParseCommand", batchHitCommand).Return(hitParsed, nil)
+	mockActions.On("CheckRegistryCacheExists", "hash-api", hitParsed.TagsByTarget).Return(true, cacheTagPairs, nil)
+	mockActions.On("CheckPushPermission", cacheTagPairs, false).Return(nil)
+	mockActions.On("RetagFromCacheTags", cacheTagPairs, false).Return(assert.AnError)
+	mockActions.On("RunCommand", false, batchHitCommand).Return(0)
+
+	err := HandleRememberBatch(rememberOptions, [][]string{batchHitCommand}, mockActions)
+
+	assert.NoError(t, err)
+	mockActions.AssertExpectations(t)
+	mockActions.AssertNotCalled(t, "SaveRegistryCacheTags")
+}
+
+func TestRememberBatch_InvalidHashAlgorithmRunsEverything(t *testing.T) {
+	rememberOptions := configuration.RememberSubcommandOptions{Enabled: true, HashAlgorithm: "md5"}
+	mockActions := &MockActions{}
+
+	mockActions.On("RunCommand", false, batchHitCommand).Return(0)
+	mockActions.On("RunCommand", false, batchMissCommand).Return(0)
+
+	err := HandleRememberBatch(rememberOptions, [][]string{batchHitCommand, batchMissCommand}, mockActions)
+
+	assert.NoError(t, err)
+	mockActions.AssertExpectations(t)
+	mockActions.AssertNotCalled(t, "ParseCommand")
+	mockActions.AssertNotCalled(t, "CheckRegistryCacheExists")
+}
+
+func TestRememberBatch_NoCommands(t *testing.T) {
+	err := HandleRememberBatch(configuration.RememberSubcommandOptions{Enabled: true}, [][]string{}, &MockActions{})
+	assert.Error(t, err)
+}
+
+func TestUsePlainBuildkitProgress(t *testing.T) {
+	t.Setenv(buildkitProgressEnv, "tty")
+	usePlainBuildkitProgress()
+	assert.Equal(t, "tty", os.Getenv(buildkitProgressEnv), "the progress mode chosen by the user is kept")
+
+	require.NoError(t, os.Unsetenv(buildkitProgressEnv))
+	usePlainBuildkitProgress()
+	assert.Equal(t, "plain", os.Getenv(buildkitProgressEnv))
+}
+
+func TestRememberBatch_RequirePush(t *testing.T) {
+	rememberOptions := configuration.RememberSubcommandOptions{Enabled: true, RequirePush: true}
+	mockActions := &MockActions{}
+
+	missParsed := batchParsedCommand(batchMissCommand, "hash-web", "myreg1/web:v1")
+	mockActions.On("ParseCommand", batchMissCommand).Return(missParsed, nil)
+	mockActions.On("CheckRegistryCacheExists", "hash-web", missParsed.TagsByTarget).Return(false, nil, nil)
+	mockActions.On("RunCommand", false, batchMissCommand, cacheMissEnv("hash-web")).Return(0)
+	mockActions.On("SaveRegistryCacheTags", "hash-web", missParsed.TagsByTarget, false).Return(nil)
+	mockActions.On("ExitProcessWithCode", 1).Return()
+
+	err := HandleRememberBatch(rememberOptions, [][]string{batchNoPushCommand, batchMissCommand}, mockActions)
+
+	assert.ErrorContains(t, err, "1 of 2 builds failed")
+	mockActions.AssertExpectations(t)
+	mockActions.AssertNotCalled(t, "RunCommand", false, batchNoPushCommand)
+}
+
+func TestBatchRecords(t *testing.T) {
+	builds := []*batchBuild{
+		{parsedCommand: batchParsedCommand(batchHitCommand, "hash-api", "myreg1/api:v1"), status: batchStatusHit},
+		{parsedCommand: batchParsedCommand(batchMissCommand, "hash-web", "myreg1/web:v1"), status: batchStatusMiss, buildDuration: time.Minute},
+		{parsedCommand: configuration.ParsedCommand{Command: batchNoPushCommand}, status: batchStatusRan},
+	}
+
+	assert.Equal(t, []reporting.Record{
+		reporting.NewRecord([]string{"myreg1/api:v1"}, true, 0),
+		reporting.NewRecord([]string{"myreg1/web:v1"}, false, time.Minute),
+	}, batchRecords(builds))
+}
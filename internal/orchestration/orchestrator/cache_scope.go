@@ -0,0 +1,70 @@
+package orchestrator
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/hytromo/mimosa/internal/configuration"
+)
+
+const (
+	cacheScopeBranch     = "branch"
+	defaultBranchEnv     = "CI_DEFAULT_BRANCH"
+	fallbackMainlineName = "main"
+)
+
+// the env variables that CI systems put the branch being built in, in order of preference (GITHUB_HEAD_REF is the
+// source branch of a pull request, which GITHUB_REF_NAME is not)
+var branchEnvs = []string{"GITHUB_HEAD_REF", "GITHUB_REF_NAME", "CI_COMMIT_REF_NAME", "BUILDKITE_BRANCH", "CIRCLE_BRANCH", "BRANCH_NAME"}
+
+// cacheScope returns the scope to save the cache tags under: "" (the default scope) unless --cache-scope branch is
+// set and the branch being built is not the default branch
+func cacheScope(rememberOptions configuration.RememberSubcommandOptions) (string, error) {
+	switch rememberOptions.CacheScope {
+	case "":
+		return "", nil
+	case cacheScopeBranch:
+	default:
+		return "", fmt.Errorf("invalid cache scope %q, the supported scope is %q", rememberOptions.CacheScope, cacheScopeBranch)
+	}
+
+	branch, err := currentBranch()
+	if err != nil {
+		return "", fmt.Errorf("cannot find the branch for the cache scope: %w", err)
+	}
+
+	defaultBranch := rememberOptions.CacheDefaultBranch
+	if defaultBranch == "" {
+		defaultBranch = os.Getenv(defaultBranchEnv)
+	}
+	if defaultBranch == "" {
+		defaultBranch = fallbackMainlineName
+	}
+
+	if branch == defaultBranch {
+		return "", nil
+	}
+	return branch, nil
+}
+
+// currentBranch returns the branch being built, from the env of the CI system or from git
+func currentBranch() (string, error) {
+	for _, env := range branchEnvs {
+		if branch := os.Getenv(env); branch != "" {
+			return branch, nil
+		}
+	}
+
+	output, err := exec.Command("git", "rev-parse", "--abbrev-ref", "HEAD").Output()
+	if err != nil {
+		return "", err
+	}
+	branch := strings.TrimSpace(string(output))
+	if branch == "HEAD" {
+		return "", errors.New("HEAD is detached")
+	}
+	return branch, nil
+}
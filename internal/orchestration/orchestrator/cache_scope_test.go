@@ -0,0 +1,56 @@
+package orchestrator
+
+import (
+	"testing"
+
+	"github.com/hytromo/mimosa/internal/configuration"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func useBranch(t *testing.T, env string, branch string) {
+	t.Helper()
+	for _, branchEnv := range branchEnvs {
+		t.Setenv(branchEnv, "")
+	}
+	t.Setenv(defaultBranchEnv, "")
+	t.Setenv(env, branch)
+}
+
+func TestCacheScope(t *testing.T) {
+	useBranch(t, "GITHUB_REF_NAME", "feature/login")
+
+	scope, err := cacheScope(configuration.RememberSubcommandOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "", scope, "no scope unless asked for")
+
+	scope, err = cacheScope(configuration.RememberSubcommandOptions{CacheScope: "branch"})
+	require.NoError(t, err)
+	assert.Equal(t, "feature/login", scope)
+
+	// the source branch of pull requests is preferred
+	t.Setenv("GITHUB_HEAD_REF", "feature/signup")
+	scope, err = cacheScope(configuration.RememberSubcommandOptions{CacheScope: "branch"})
+	require.NoError(t, err)
+	assert.Equal(t, "feature/signup", scope)
+
+	_, err = cacheScope(configuration.RememberSubcommandOptions{CacheScope: "tag"})
+	assert.ErrorContains(t, err, "invalid cache scope")
+}
+
+func TestCacheScope_DefaultBranchUsesTheDefaultScope(t *testing.T) {
+	useBranch(t, "CI_COMMIT_REF_NAME", "main")
+	scope, err := cacheScope(configuration.RememberSubcommandOptions{CacheScope: "branch"})
+	require.NoError(t, err)
+	assert.Equal(t, "", scope)
+
+	useBranch(t, "CI_COMMIT_REF_NAME", "develop")
+	t.Setenv(defaultBranchEnv, "develop")
+	scope, err = cacheScope(configuration.RememberSubcommandOptions{CacheScope: "branch"})
+	require.NoError(t, err)
+	assert.Equal(t, "", scope)
+
+	scope, err = cacheScope(configuration.RememberSubcommandOptions{CacheScope: "branch", CacheDefaultBranch: "trunk"})
+	require.NoError(t, err)
+	assert.Equal(t, "develop", scope)
+}
@@ -0,0 +1,206 @@
+package orchestrator
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/hytromo/mimosa/internal/cacher"
+	"github.com/hytromo/mimosa/internal/configuration"
+	"github.com/hytromo/mimosa/internal/hasher"
+	"github.com/hytromo/mimosa/internal/logger"
+	"github.com/hytromo/mimosa/internal/orchestration/actions"
+	"github.com/samber/lo"
+)
+
+// parseWithBreakdowns parses (and hashes) the command, recording the hash breakdown of each of its builds
+func parseWithBreakdowns(rememberOptions configuration.RememberSubcommandOptions, act actions.Actions, command []string) (configuration.ParsedCommand, []hasher.HashBreakdown, error) {
+	hasher.RecordBreakdowns()
+	parsedCommand, err := hashCommand(context.Background(), rememberOptions, act, command)
+	breakdowns := hasher.StopRecordingBreakdowns()
+	if err != nil {
+		return parsedCommand, nil, fmt.Errorf("failed to parse %q: %w", strings.Join(command, " "), err)
+	}
+	return parsedCommand, breakdowns, nil
+}
+
+// HandleDiffSubcommand hashes two commands (without running them) and prints which of their inputs differ,
+// to explain why two seemingly identical builds get different hashes - both are hashed with the hashing options of
+// remember, so that they get the hashes that remember would give them
+func HandleDiffSubcommand(rememberOptions configuration.RememberSubcommandOptions, commandA []string, commandB []string, act actions.Actions) error {
+	if len(commandA) == 0 || len(commandB) == 0 {
+		return fmt.Errorf("two commands are needed to diff")
+	}
+	if err := configureHashing(rememberOptions); err != nil {
+		return err
+	}
+
+	parsedA, breakdownsA, err := parseWithBreakdowns(rememberOptions, act, commandA)
+	if err != nil {
+		return err
+	}
+	parsedB, breakdownsB, err := parseWithBreakdowns(rememberOptions, act, commandB)
+	if err != nil {
+		return err
+	}
+
+	for _, line := range diffParsedCommands(parsedA, breakdownsA, parsedB, breakdownsB) {
+		logger.CleanLog.Info(line)
+	}
+
+	return nil
+}
+
+// hashOfCacheEntry matches the hashes of mimosa, which name the cache entries
+var hashOfCacheEntry = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// HandleDiffCacheEntriesSubcommand prints which inputs of two cache entries differ, from the inputs that their builds
+// recorded with remember --analyze-rebuilds. An entry is either a hash, whose cache tag is looked up in the repository
+// of the image, or the tag of an image that a build pushed
+func HandleDiffCacheEntriesSubcommand(rememberOptions configuration.RememberSubcommandOptions, image string, entryA string, entryB string, act actions.Actions) error {
+	// the cache tags are looked up like remember does
+	if err := configureHashing(rememberOptions); err != nil {
+		return err
+	}
+
+	inputsA, err := recordedInputsOfCacheEntry(act, image, entryA)
+	if err != nil {
+		return err
+	}
+	inputsB, err := recordedInputsOfCacheEntry(act, image, entryB)
+	if err != nil {
+		return err
+	}
+
+	logger.CleanLog.Info(fmt.Sprintf("hash: %s (A: %s, B: %s)", sameOrDiffers(inputsA.Hash, inputsB.Hash), inputsA.Hash, inputsB.Hash))
+	for _, line := range diffBreakdowns(inputsA.Breakdowns, inputsB.Breakdowns) {
+		logger.CleanLog.Info(line)
+	}
+
+	return nil
+}
+
+// recordedInputsOfCacheEntry returns the inputs that the build of the cache entry (a hash or an image tag) recorded
+func recordedInputsOfCacheEntry(act actions.Actions, image string, entry string) (cacher.BuildInputs, error) {
+	tag := entry
+	if hashOfCacheEntry.MatchString(entry) {
+		if image == "" {
+			return cacher.BuildInputs{}, fmt.Errorf("--image is needed to find the cache entry of hash %s", entry)
+		}
+		exists, cacheTagPairs, err := act.CheckRegistryCacheExists("", entry, map[string][]string{"default": {image}})
+		if err != nil {
+			return cacher.BuildInputs{}, fmt.Errorf("failed to look up hash %s in %s: %w", entry, image, err)
+		}
+		if !exists || len(cacheTagPairs["default"]) == 0 {
+			return cacher.BuildInputs{}, fmt.Errorf("no cache entry of hash %s in %s", entry, image)
+		}
+		tag = cacheTagPairs["default"][0].CacheTag
+	}
+
+	digests, err := act.TagDigests("", []string{tag})
+	if err != nil {
+		return cacher.BuildInputs{}, fmt.Errorf("failed to resolve %s: %w", tag, err)
+	}
+	inputs, found, err := act.RecordedBuildInputs("", tag, digests[tag])
+	if err != nil {
+		return cacher.BuildInputs{}, fmt.Errorf("failed to read the build inputs of %s: %w", tag, err)
+	}
+	if !found {
+		return cacher.BuildInputs{}, fmt.Errorf("no build inputs recorded for %s, its build has to run with remember --analyze-rebuilds", tag)
+	}
+	return inputs, nil
+}
+
+// diffLines returns "only in A" and "only in B" lines for the values that are not in both lists
+func diffLines(indent string, a []string, b []string) []string {
+	lines := []string{}
+	onlyInA, onlyInB := lo.Difference(a, b)
+	for _, value := range onlyInA {
+		lines = append(lines, fmt.Sprintf("%sonly in A: %s", indent, value))
+	}
+	for _, value := range onlyInB {
+		lines = append(lines, fmt.Sprintf("%sonly in B: %s", indent, value))
+	}
+	return lines
+}
+
+func sameOrDiffers(a string, b string) string {
+	if a == b {
+		return "same"
+	}
+	return "differs"
+}
+
+// diffParsedCommands returns a human readable, line by line, diff of two parsed commands and their hash breakdowns
+func diffParsedCommands(parsedA configuration.ParsedCommand, breakdownsA []hasher.HashBreakdown, parsedB configuration.ParsedCommand, breakdownsB []hasher.HashBreakdown) []string {
+	lines := []string{
+		fmt.Sprintf("hash: %s (A: %s, B: %s)", sameOrDiffers(parsedA.Hash, parsedB.Hash), parsedA.Hash, parsedB.Hash),
+	}
+
+	// tags do not affect the hash, but they show if the commands build the same targets
+	targetsA := slices.Sorted(maps.Keys(parsedA.TagsByTarget))
+	targetsB := slices.Sorted(maps.Keys(parsedB.TagsByTarget))
+	lines = append(lines, lo.Map(diffLines("", targetsA, targetsB), func(line string, _ int) string {
+		return "target " + line
+	})...)
+	for _, target := range lo.Intersect(targetsA, targetsB) {
+		tagLines := diffLines("  ", parsedA.TagsByTarget[target], parsedB.TagsByTarget[target])
+		if len(tagLines) > 0 {
+			lines = append(lines, fmt.Sprintf("tags of %s:", target))
+			lines = append(lines, tagLines...)
+		}
+	}
+
+	return append(lines, diffBreakdowns(breakdownsA, breakdownsB)...)
+}
+
+// diffBreakdowns returns a human readable, line by line, diff of the hash breakdowns of the builds of two commands
+func diffBreakdowns(breakdownsA []hasher.HashBreakdown, breakdownsB []hasher.HashBreakdown) []string {
+	lines := []string{}
+	byNameA := lo.KeyBy(breakdownsA, func(b hasher.HashBreakdown) string { return b.Name })
+	byNameB := lo.KeyBy(breakdownsB, func(b hasher.HashBreakdown) string { return b.Name })
+	namesA := lo.Map(breakdownsA, func(b hasher.HashBreakdown, _ int) string { return b.Name })
+	namesB := lo.Map(breakdownsB, func(b hasher.HashBreakdown, _ int) string { return b.Name })
+	lines = append(lines, lo.Map(diffLines("", namesA, namesB), func(line string, _ int) string {
+		return "build " + line
+	})...)
+
+	for _, name := range lo.Intersect(namesA, namesB) {
+		a, b := byNameA[name], byNameB[name]
+		if a.Hash == b.Hash {
+			lines = append(lines, fmt.Sprintf("build %s: same", name))
+			continue
+		}
+
+		lines = append(lines, fmt.Sprintf("build %s: differs", name))
+		if a.CommandHash != b.CommandHash {
+			lines = append(lines, "  command differs:")
+			lines = append(lines, diffLines("    ", a.Command, b.Command)...)
+		}
+		if a.RegistryDomainsHash != b.RegistryDomainsHash {
+			lines = append(lines, "  registry domains differ:")
+			lines = append(lines, diffLines("    ", a.RegistryDomains, b.RegistryDomains)...)
+		}
+		if a.FilesHash != b.FilesHash {
+			lines = append(lines, "  files differ:")
+			for _, path := range slices.Sorted(maps.Keys(a.Files)) {
+				hashB, inB := b.Files[path]
+				if !inB {
+					lines = append(lines, "    only in A: "+path)
+				} else if hashB != a.Files[path] {
+					lines = append(lines, "    changed: "+path)
+				}
+			}
+			for _, path := range slices.Sorted(maps.Keys(b.Files)) {
+				if _, inA := a.Files[path]; !inA {
+					lines = append(lines, "    only in B: "+path)
+				}
+			}
+		}
+	}
+
+	return lines
+}
@@ -0,0 +1,157 @@
+package orchestrator
+
+import (
+	"testing"
+
+	"github.com/hytromo/mimosa/internal/cacher"
+	"github.com/hytromo/mimosa/internal/configuration"
+	"github.com/hytromo/mimosa/internal/hasher"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffParsedCommands_SameHash(t *testing.T) {
+	parsed := configuration.ParsedCommand{Hash: "abc", TagsByTarget: map[string][]string{"default": {"r.io/app:v1"}}}
+	breakdowns := []hasher.HashBreakdown{{Name: "default", Hash: "abc"}}
+
+	lines := diffParsedCommands(parsed, breakdowns, parsed, breakdowns)
+
+	assert.Equal(t, []string{"hash: same (A: abc, B: abc)", "build default: same"}, lines)
+}
+
+func TestDiffParsedCommands_DifferentInputs(t *testing.T) {
+	parsedA := configuration.ParsedCommand{Hash: "a", TagsByTarget: map[string][]string{"api": {"r.io/api:v1"}, "web": {"r.io/web:v1"}}}
+	parsedB := configuration.ParsedCommand{Hash: "b", TagsByTarget: map[string][]string{"api": {"r.io/api:v2"}, "worker": {"r.io/worker:v1"}}}
+	breakdownsA := []hasher.HashBreakdown{
+		{Name: "api", Hash: "1", CommandHash: "c1", Command: []string{"docker", "buildx", "build", "--build-arg", "A=1"}, RegistryDomainsHash: "r", FilesHash: "f1", Files: map[string]string{"same.txt": "s", "changed.txt": "x", "removed.txt": "r"}},
+		{Name: "web", Hash: "2"},
+	}
+	breakdownsB := []hasher.HashBreakdown{
+		{Name: "api", Hash: "3", CommandHash: "c2", Command: []string{"docker", "buildx", "build", "--build-arg", "A=2"}, RegistryDomainsHash: "r", FilesHash: "f2", Files: map[string]string{"same.txt": "s", "changed.txt": "y", "added.txt": "a"}},
+		{Name: "worker", Hash: "4"},
+	}
+
+	lines := diffParsedCommands(parsedA, breakdownsA, parsedB, breakdownsB)
+
+	assert.Equal(t, []string{
+		"hash: differs (A: a, B: b)",
+		"target only in A: web",
+		"target only in B: worker",
+		"tags of api:",
+		"  only in A: r.io/api:v1",
+		"  only in B: r.io/api:v2",
+		"build only in A: web",
+		"build only in B: worker",
+		"build api: differs",
+		"  command differs:",
+		"    only in A: A=1",
+		"    only in B: A=2",
+		"  files differ:",
+		"    changed: changed.txt",
+		"    only in A: removed.txt",
+		"    only in B: added.txt",
+	}, lines)
+}
+
+func TestHandleDiffSubcommand(t *testing.T) {
+	commandA := []string{"docker", "buildx", "build", "--push", "-t", "r.io/app:v1", "."}
+	commandB := []string{"docker", "buildx", "build", "--push", "-t", "r.io/app:v2", "."}
+	mockActions := &MockActions{}
+
+	mockActions.On("ParseCommand", commandA).Return(configuration.ParsedCommand{Hash: "abc"}, nil)
+	mockActions.On("ParseCommand", commandB).Return(configuration.ParsedCommand{Hash: "abc"}, nil)
+
+	err := HandleDiffSubcommand(configuration.RememberSubcommandOptions{}, commandA, commandB, mockActions)
+
+	assert.NoError(t, err)
+	mockActions.AssertExpectations(t)
+	mockActions.AssertNotCalled(t, "RunCommand")
+	mockActions.AssertNotCalled(t, "CheckRegistryCacheExists")
+}
+
+func TestHandleDiffSubcommand_ParseError(t *testing.T) {
+	commandA := []string{"docker", "buildx", "build", "."}
+	commandB := []string{"docker", "buildx", "bake"}
+	mockActions := &MockActions{}
+
+	mockActions.On("ParseCommand", commandA).Return(configuration.ParsedCommand{}, assert.AnError)
+
+	err := HandleDiffSubcommand(configuration.RememberSubcommandOptions{}, commandA, commandB, mockActions)
+
+	assert.ErrorIs(t, err, assert.AnError)
+	mockActions.AssertNotCalled(t, "ParseCommand", commandB)
+}
+
+func TestHandleDiffSubcommand_HashBuilder(t *testing.T) {
+	commandA := []string{"docker", "buildx", "build", "--push", "-t", "r.io/app:v1", "."}
+	commandB := []string{"docker", "buildx", "build", "--builder", "other", "--push", "-t", "r.io/app:v1", "."}
+	mockActions := &MockActions{}
+
+	mockActions.On("ParseCommand", commandA).Return(configuration.ParsedCommand{Hash: "abc", Command: commandA}, nil)
+	mockActions.On("ParseCommand", commandB).Return(configuration.ParsedCommand{Hash: "abc", Command: commandB}, nil)
+	mockActions.On("InspectBuilder", commandA).Return("docker-container buildkit v0.23", nil)
+	mockActions.On("InspectBuilder", commandB).Return("docker-container buildkit v0.24", nil)
+
+	err := HandleDiffSubcommand(configuration.RememberSubcommandOptions{HashBuilder: true}, commandA, commandB, mockActions)
+
+	assert.NoError(t, err)
+	mockActions.AssertExpectations(t)
+}
+
+func TestHandleDiffSubcommand_InvalidHashingOptions(t *testing.T) {
+	commandA := []string{"docker", "buildx", "build", "."}
+	commandB := []string{"docker", "buildx", "build", "--pull", "."}
+	mockActions := &MockActions{}
+
+	err := HandleDiffSubcommand(configuration.RememberSubcommandOptions{PullPolicy: "sometimes"}, commandA, commandB, mockActions)
+
+	assert.Error(t, err)
+	mockActions.AssertNotCalled(t, "ParseCommand", commandA)
+}
+
+func TestHandleDiffCacheEntriesSubcommand(t *testing.T) {
+	cacheTag := "r.io/app:" + cacher.CacheTagPrefix + TestHash
+	mockActions := &MockActions{}
+
+	mockActions.On("CheckRegistryCacheExists", TestHash, map[string][]string{"default": {"r.io/app"}}).Return(true, map[string][]cacher.CacheTagPair{"default": {{CacheTag: cacheTag, NewTag: "r.io/app"}}}, nil)
+	mockActions.On("TagDigests", []string{cacheTag}).Return(map[string]string{cacheTag: "sha256:aaa"}, nil)
+	mockActions.On("TagDigests", []string{"r.io/app:v2"}).Return(map[string]string{"r.io/app:v2": "sha256:bbb"}, nil)
+	mockActions.On("RecordedBuildInputs", cacheTag, "sha256:aaa").Return(cacher.BuildInputs{Hash: TestHash, Breakdowns: []hasher.HashBreakdown{{Name: "default", Hash: "1"}}}, true, nil)
+	mockActions.On("RecordedBuildInputs", "r.io/app:v2", "sha256:bbb").Return(cacher.BuildInputs{Hash: "other", Breakdowns: []hasher.HashBreakdown{{Name: "default", Hash: "2"}}}, true, nil)
+
+	err := HandleDiffCacheEntriesSubcommand(configuration.RememberSubcommandOptions{}, "r.io/app", TestHash, "r.io/app:v2", mockActions)
+
+	assert.NoError(t, err)
+	mockActions.AssertExpectations(t)
+	mockActions.AssertNotCalled(t, "ParseCommand")
+}
+
+func TestHandleDiffCacheEntriesSubcommand_NoRecordedInputs(t *testing.T) {
+	mockActions := &MockActions{}
+
+	mockActions.On("TagDigests", []string{"r.io/app:v1"}).Return(map[string]string{"r.io/app:v1": "sha256:aaa"}, nil)
+	mockActions.On("RecordedBuildInputs", "r.io/app:v1", "sha256:aaa").Return(cacher.BuildInputs{}, false, nil)
+
+	err := HandleDiffCacheEntriesSubcommand(configuration.RememberSubcommandOptions{}, "", "r.io/app:v1", "r.io/app:v2", mockActions)
+
+	assert.ErrorContains(t, err, "--analyze-rebuilds")
+	mockActions.AssertNotCalled(t, "TagDigests", []string{"r.io/app:v2"})
+}
+
+func TestHandleDiffCacheEntriesSubcommand_HashNeedsAnImage(t *testing.T) {
+	mockActions := &MockActions{}
+
+	err := HandleDiffCacheEntriesSubcommand(configuration.RememberSubcommandOptions{}, "", TestHash, "r.io/app:v2", mockActions)
+
+	assert.ErrorContains(t, err, "--image")
+	mockActions.AssertNotCalled(t, "CheckRegistryCacheExists")
+}
+
+func TestHandleDiffCacheEntriesSubcommand_MissingCacheEntry(t *testing.T) {
+	mockActions := &MockActions{}
+
+	mockActions.On("CheckRegistryCacheExists", TestHash, map[string][]string{"default": {"r.io/app"}}).Return(false, nil, nil)
+
+	err := HandleDiffCacheEntriesSubcommand(configuration.RememberSubcommandOptions{}, "r.io/app", TestHash, "r.io/app:v2", mockActions)
+
+	assert.ErrorContains(t, err, "no cache entry of hash")
+}
@@ -0,0 +1,67 @@
+package orchestrator
+
+import (
+	"encoding/json"
+	"log/slog"
+	"maps"
+	"os"
+	"slices"
+
+	"github.com/hytromo/mimosa/internal/configuration"
+	"github.com/hytromo/mimosa/internal/orchestration/actions"
+)
+
+// writeDigestMap writes every tag of the builds, each with the digest it points to right now, as a JSON object to the
+// file - the builds are the ones that hit the cache or were pushed, so that deploy tooling can pin their images by
+// digest no matter whether they were retagged or built. A failure to write it does not fail the build
+func writeDigestMap(path string, act actions.Actions, dryRun bool, parsedCommands ...configuration.ParsedCommand) {
+	if path == "" {
+		return
+	}
+
+	// the tags of each build are resolved with the credentials of its docker config dir
+	tagsByConfigDir := map[string][]string{}
+	for _, parsedCommand := range parsedCommands {
+		for _, targetTags := range parsedCommand.PublishedTagsByTarget() {
+			if parsedCommand.Local {
+				// the tags of local-only builds are not in any registry
+				slog.Warn("The tags of local images are not written to the digest map", "tags", targetTags)
+				continue
+			}
+			tagsByConfigDir[parsedCommand.DockerConfigDir] = append(tagsByConfigDir[parsedCommand.DockerConfigDir], targetTags...)
+		}
+	}
+	tags := []string{}
+	for dockerConfigDir, configDirTags := range tagsByConfigDir {
+		slices.Sort(configDirTags)
+		tagsByConfigDir[dockerConfigDir] = slices.Compact(configDirTags)
+		tags = append(tags, tagsByConfigDir[dockerConfigDir]...)
+	}
+	slices.Sort(tags)
+
+	if dryRun {
+		slog.Info("> DRY RUN: would write the digests of the tags", "path", path, "tags", tags)
+		return
+	}
+
+	digests := map[string]string{}
+	var err error
+	for _, dockerConfigDir := range slices.Sorted(maps.Keys(tagsByConfigDir)) {
+		var configDirDigests map[string]string
+		if configDirDigests, err = act.TagDigests(dockerConfigDir, tagsByConfigDir[dockerConfigDir]); err != nil {
+			break
+		}
+		maps.Copy(digests, configDirDigests)
+	}
+	if err == nil {
+		var content []byte
+		if content, err = json.MarshalIndent(digests, "", "  "); err == nil {
+			err = os.WriteFile(path, append(content, '\n'), 0o644)
+		}
+	}
+	if err != nil {
+		slog.Warn("Failed to write the digest map", "path", path, "error", err)
+		return
+	}
+	slog.Debug("Wrote the digest map", "path", path, "tags", len(tags))
+}
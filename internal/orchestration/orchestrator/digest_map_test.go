@@ -0,0 +1,73 @@
+package orchestrator
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hytromo/mimosa/internal/cacher"
+	"github.com/hytromo/mimosa/internal/configuration"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteDigestMap(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "digests.json")
+	mockActions := &MockActions{}
+	mockActions.On("TagDigests", []string{"myreg1/api:latest", "myreg1/api:v1", "myreg1/web:v1"}).Return(map[string]string{
+		"myreg1/api:latest": "sha256:aaa",
+		"myreg1/api:v1":     "sha256:aaa",
+		"myreg1/web:v1":     "sha256:bbb",
+	}, nil)
+
+	writeDigestMap(path, mockActions, false,
+		configuration.ParsedCommand{TagsByTarget: map[string][]string{"api": {"myreg1/api:v1", "myreg1/api:latest"}, "web": {"myreg1/web:v1"}}},
+		configuration.ParsedCommand{TagsByTarget: map[string][]string{"default": {"myreg1/api:v1"}}},
+		configuration.ParsedCommand{TagsByTarget: map[string][]string{"default": {"local/app:dev"}}, Local: true},
+	)
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"myreg1/api:latest": "sha256:aaa", "myreg1/api:v1": "sha256:aaa", "myreg1/web:v1": "sha256:bbb"}`, string(content))
+	mockActions.AssertExpectations(t)
+}
+
+func TestWriteDigestMap_NotWritten(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "digests.json")
+	parsedCommand := configuration.ParsedCommand{TagsByTarget: map[string][]string{"default": {"myreg1/api:v1"}}}
+
+	mockActions := &MockActions{}
+	writeDigestMap("", mockActions, false, parsedCommand)
+	writeDigestMap(path, mockActions, true, parsedCommand)
+	mockActions.AssertNotCalled(t, "TagDigests")
+
+	mockActions.On("TagDigests", []string{"myreg1/api:v1"}).Return(nil, assert.AnError)
+	writeDigestMap(path, mockActions, false, parsedCommand)
+	assert.NoFileExists(t, path)
+}
+
+func TestRun_RememberEnabled_RegistryCache_CacheExists_WritesDigestMap(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "digests.json")
+	command := []string{"docker", "build", "--push", "-t", "myreg1/myimage:v1", "."}
+	rememberOptions := configuration.RememberSubcommandOptions{Enabled: true, CommandToRun: command, DigestMapFile: path}
+
+	parsedCommand := configuration.ParsedCommand{
+		Hash:         TestHash,
+		Command:      command,
+		TagsByTarget: map[string][]string{"default": {"myreg1/myimage:v1"}},
+	}
+	cacheTagPairs := map[string][]cacher.CacheTagPair{
+		"default": {{CacheTag: "myreg1/myimage:mimosa-content-hash-" + TestHash, NewTag: "myreg1/myimage:v1"}},
+	}
+
+	mockActions := &MockActions{}
+	mockActions.On("ParseCommand", command).Return(parsedCommand, nil)
+	mockActions.On("CheckRegistryCacheExists", TestHash, parsedCommand.TagsByTarget).Return(true, cacheTagPairs, nil)
+	mockActions.On("CheckPushPermission", cacheTagPairs, false).Return(nil)
+	mockActions.On("RetagFromCacheTags", cacheTagPairs, false).Return(nil)
+	mockActions.On("TagDigests", []string{"myreg1/myimage:v1"}).Return(map[string]string{"myreg1/myimage:v1": "sha256:aaa"}, nil)
+
+	require.NoError(t, HandleRememberSubcommand(rememberOptions, mockActions))
+	mockActions.AssertExpectations(t)
+	assert.FileExists(t, path)
+}
@@ -0,0 +1,36 @@
+package orchestrator
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+const (
+	// the file written by --gitlab in CI_PROJECT_DIR, to be declared as an artifacts:reports:dotenv of the job
+	gitlabDotenvFile    = "mimosa.env"
+	gitlabProjectDirEnv = "CI_PROJECT_DIR"
+	cacheHitEnv         = "MIMOSA_CACHE_HIT"
+)
+
+// GitLabDotenvPath returns where --gitlab writes the cache decision: mimosa.env in the project dir of the job
+// (or the current dir outside GitLab CI)
+func GitLabDotenvPath() string {
+	return filepath.Join(os.Getenv(gitlabProjectDirEnv), gitlabDotenvFile)
+}
+
+// writeDotenv writes the cache decision and the hash as a dotenv file, so that the jobs that follow can read them
+// as env variables - a failure to write it does not fail the build
+func writeDotenv(path string, cacheHit bool, hash string) {
+	if path == "" {
+		return
+	}
+
+	content := fmt.Sprintf("%s=%t\n%s=%s\n", cacheHitEnv, cacheHit, hashEnv, hash)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		slog.Warn("Failed to write the dotenv file", "path", path, "error", err)
+		return
+	}
+	slog.Debug("Wrote the cache decision to the dotenv file", "path", path)
+}
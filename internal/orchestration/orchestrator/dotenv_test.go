@@ -0,0 +1,62 @@
+package orchestrator
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hytromo/mimosa/internal/cacher"
+	"github.com/hytromo/mimosa/internal/configuration"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGitLabDotenvPath(t *testing.T) {
+	t.Setenv(gitlabProjectDirEnv, "/builds/org/app")
+	assert.Equal(t, "/builds/org/app/mimosa.env", GitLabDotenvPath())
+
+	t.Setenv(gitlabProjectDirEnv, "")
+	assert.Equal(t, "mimosa.env", GitLabDotenvPath())
+}
+
+func TestWriteDotenv(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mimosa.env")
+
+	writeDotenv(path, true, "abc")
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "MIMOSA_CACHE_HIT=true\nMIMOSA_HASH=abc\n", string(content))
+
+	writeDotenv(filepath.Join(path, "not-a-dir", "mimosa.env"), false, "abc")
+}
+
+func TestRememberSubcommand_WritesDotenvOnCacheHit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mimosa.env")
+	rememberOptions := configuration.RememberSubcommandOptions{
+		Enabled:      true,
+		CommandToRun: []string{"docker", "build", "--push", "-t", "myreg1/myimage:v1", "."},
+		DotenvFile:   path,
+	}
+
+	parsedCommand := configuration.ParsedCommand{
+		Hash:         TestHash,
+		Command:      rememberOptions.CommandToRun,
+		TagsByTarget: map[string][]string{"default": {"myreg1/myimage:v1"}},
+	}
+	cacheTagPairs := map[string][]cacher.CacheTagPair{
+		"default": {{CacheTag: "myreg1/myimage:mimosa-content-hash-" + TestHash, NewTag: "myreg1/myimage:v1"}},
+	}
+
+	mockActions := &MockActions{}
+	mockActions.On("ParseCommand", rememberOptions.CommandToRun).Return(parsedCommand, nil)
+	mockActions.On("CheckRegistryCacheExists", TestHash, parsedCommand.TagsByTarget).Return(true, cacheTagPairs, nil)
+	mockActions.On("CheckPushPermission", cacheTagPairs, false).Return(nil)
+	mockActions.On("RetagFromCacheTags", cacheTagPairs, false).Return(nil)
+
+	err := HandleRememberSubcommand(rememberOptions, mockActions)
+
+	assert.NoError(t, err)
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "MIMOSA_CACHE_HIT=true\nMIMOSA_HASH="+TestHash+"\n", string(content))
+}
@@ -0,0 +1,97 @@
+package orchestrator
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/hytromo/mimosa/internal/configuration"
+	"github.com/samber/lo"
+)
+
+const (
+	// the file that the GitHub Actions runner reads the outputs of a step from
+	githubOutputEnv = "GITHUB_OUTPUT"
+	// the file that the GitHub Actions runner shows as the markdown summary of the job
+	githubStepSummaryEnv = "GITHUB_STEP_SUMMARY"
+	// "true" in every step that the GitHub Actions runner runs
+	githubActionsEnv = "GITHUB_ACTIONS"
+)
+
+// InGitHubActions reports whether mimosa runs in a GitHub Actions step
+func InGitHubActions() bool {
+	return os.Getenv(githubActionsEnv) == "true"
+}
+
+// GitHubStepSummaryPath returns where --github-action writes the summary of the build ("" outside GitHub Actions)
+func GitHubStepSummaryPath() string {
+	return os.Getenv(githubStepSummaryEnv)
+}
+
+// GitHubOutputPath returns where --github-output writes the outputs of the step ("" outside GitHub Actions)
+func GitHubOutputPath() string {
+	return os.Getenv(githubOutputEnv)
+}
+
+// writeGitHubOutput appends the cache decision, the hash and the tags of the build to the outputs file of the step,
+// so that the steps that follow can branch on them - a failure to write it does not fail the build
+func writeGitHubOutput(path string, cacheHit bool, parsedCommand configuration.ParsedCommand) {
+	if path == "" {
+		return
+	}
+
+	content := fmt.Sprintf("cache-hit=%t\nhash=%s\ntags=%s\n", cacheHit, parsedCommand.Hash, strings.Join(sortedTags(parsedCommand), ","))
+	if err := appendToFile(path, content); err != nil {
+		slog.Warn("Failed to write the GitHub Actions outputs", "path", path, "error", err)
+		return
+	}
+	slog.Debug("Wrote the cache decision to the GitHub Actions outputs", "path", path)
+}
+
+// writeGitHubStepSummary appends the cache decision, the hash and the tags of the build to the markdown summary of
+// the job - a failure to write it does not fail the build
+func writeGitHubStepSummary(path string, cacheHit bool, retagOnly bool, parsedCommand configuration.ParsedCommand) {
+	if path == "" {
+		return
+	}
+
+	decision := "miss - built"
+	switch {
+	case cacheHit:
+		decision = "hit - retagged"
+	case retagOnly:
+		decision = "miss - not built (retag-only)"
+	}
+	tags := lo.Map(sortedTags(parsedCommand), func(tag string, _ int) string { return "`" + tag + "`" })
+	content := fmt.Sprintf("### mimosa\n\n| cache | hash | tags |\n| --- | --- | --- |\n| %s | `%s` | %s |\n\n", decision, parsedCommand.Hash, strings.Join(tags, "<br>"))
+	if err := appendToFile(path, content); err != nil {
+		slog.Warn("Failed to write the GitHub Actions step summary", "path", path, "error", err)
+		return
+	}
+	slog.Debug("Wrote the cache decision to the GitHub Actions step summary", "path", path)
+}
+
+// sortedTags returns all the tags that the command creates, sorted and without duplicates
+func sortedTags(parsedCommand configuration.ParsedCommand) []string {
+	tags := []string{}
+	for _, targetTags := range parsedCommand.PublishedTagsByTarget() {
+		tags = append(tags, targetTags...)
+	}
+	slices.Sort(tags)
+	return slices.Compact(tags)
+}
+
+// appendToFile appends the content to the file, creating it if needed
+func appendToFile(path string, content string) error {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	_, err = file.WriteString(content)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,62 @@
+package orchestrator
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hytromo/mimosa/internal/configuration"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteGitHubOutput(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "github_output")
+	require.NoError(t, os.WriteFile(path, []byte("previous=output\n"), 0o644))
+
+	writeGitHubOutput(path, false, configuration.ParsedCommand{
+		Hash: "abc",
+		TagsByTarget: map[string][]string{
+			"web": {"myreg1/web:v1", "myreg1/web:latest"},
+			"api": {"myreg1/api:v1", "myreg1/web:v1"},
+		},
+	})
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "previous=output\ncache-hit=false\nhash=abc\ntags=myreg1/api:v1,myreg1/web:latest,myreg1/web:v1\n", string(content))
+
+	writeGitHubOutput(filepath.Join(path, "not-a-dir"), true, configuration.ParsedCommand{Hash: "abc"})
+	writeGitHubOutput("", true, configuration.ParsedCommand{Hash: "abc"})
+}
+
+func TestGitHubOutputPath(t *testing.T) {
+	t.Setenv(githubOutputEnv, "/home/runner/work/_temp/_runner_file_commands/set_output")
+	assert.Equal(t, "/home/runner/work/_temp/_runner_file_commands/set_output", GitHubOutputPath())
+}
+
+func TestWriteGitHubStepSummary(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "step_summary")
+
+	writeGitHubStepSummary(path, true, false, configuration.ParsedCommand{
+		Hash:         "abc",
+		TagsByTarget: map[string][]string{"default": {"myreg1/web:v1", "myreg1/web:latest"}},
+	})
+	writeGitHubStepSummary(path, false, true, configuration.ParsedCommand{Hash: "def"})
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "### mimosa\n\n| cache | hash | tags |\n| --- | --- | --- |\n| hit - retagged | `abc` | `myreg1/web:latest`<br>`myreg1/web:v1` |\n\n"+
+		"### mimosa\n\n| cache | hash | tags |\n| --- | --- | --- |\n| miss - not built (retag-only) | `def` |  |\n\n", string(content))
+
+	writeGitHubStepSummary(filepath.Join(path, "not-a-dir"), true, false, configuration.ParsedCommand{Hash: "abc"})
+	writeGitHubStepSummary("", true, false, configuration.ParsedCommand{Hash: "abc"})
+}
+
+func TestInGitHubActions(t *testing.T) {
+	t.Setenv(githubActionsEnv, "true")
+	t.Setenv(githubStepSummaryEnv, "/home/runner/work/_temp/_runner_file_commands/step_summary")
+	assert.True(t, InGitHubActions())
+	assert.Equal(t, "/home/runner/work/_temp/_runner_file_commands/step_summary", GitHubStepSummaryPath())
+
+	t.Setenv(githubActionsEnv, "")
+	assert.False(t, InGitHubActions())
+}
@@ -0,0 +1,57 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hytromo/mimosa/internal/configuration"
+	"github.com/hytromo/mimosa/internal/orchestration/actions"
+)
+
+// errHashTimeout is returned when parsing and hashing a command takes longer than --hash-timeout
+var errHashTimeout = errors.New("hashing timed out")
+
+// hashDeadline returns when hashing has to be given up on, or the zero time when there is no --hash-timeout
+func hashDeadline(rememberOptions configuration.RememberSubcommandOptions) time.Time {
+	if rememberOptions.HashTimeout <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(rememberOptions.HashTimeout)
+}
+
+// parseAndHashCommandBefore is parseAndHashCommand that gives up at the deadline (unless it is zero), so that hashing
+// a gigantic build context never makes a build much slower than running it without mimosa. The hashing given up on is
+// cancelled, and the command is returned to be run as is
+func parseAndHashCommandBefore(deadline time.Time, rememberOptions configuration.RememberSubcommandOptions, act actions.Actions, commandToRun []string) (configuration.ParsedCommand, error) {
+	if deadline.IsZero() {
+		return parseAndHashCommand(context.Background(), rememberOptions, act, commandToRun)
+	}
+
+	// only this hashing is cancelled, the other builds of a batch keep hashing
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+
+	type result struct {
+		parsedCommand configuration.ParsedCommand
+		err           error
+	}
+	results := make(chan result, 1)
+	go func() {
+		parsedCommand, err := parseAndHashCommand(ctx, rememberOptions, act, commandToRun)
+		results <- result{parsedCommand, err}
+	}()
+
+	select {
+	case r := <-results:
+		// the hashing that finished after the deadline skipped files, so its hash cannot be trusted
+		if ctx.Err() == nil {
+			return r.parsedCommand, r.err
+		}
+	case <-ctx.Done():
+	}
+
+	auditHashTimeout(commandToRun, rememberOptions.HashTimeout)
+	return configuration.ParsedCommand{Command: commandToRun}, fmt.Errorf("%w after %s", errHashTimeout, rememberOptions.HashTimeout)
+}
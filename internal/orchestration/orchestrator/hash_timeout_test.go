@@ -0,0 +1,78 @@
+package orchestrator
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hytromo/mimosa/internal/configuration"
+	"github.com/hytromo/mimosa/internal/reporting"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHashDeadline(t *testing.T) {
+	assert.True(t, hashDeadline(configuration.RememberSubcommandOptions{}).IsZero())
+
+	deadline := hashDeadline(configuration.RememberSubcommandOptions{HashTimeout: time.Minute})
+	assert.WithinDuration(t, time.Now().Add(time.Minute), deadline, time.Second)
+}
+
+func TestRememberSubcommand_HashTimeoutRunsTheCommandAsIs(t *testing.T) {
+	rememberOptions := configuration.RememberSubcommandOptions{
+		Enabled:      true,
+		CommandToRun: []string{"docker", "buildx", "build", "--push", "-t", "myreg1/myimage:v1", "."},
+		HashTimeout:  10 * time.Millisecond,
+	}
+	auditLog := filepath.Join(t.TempDir(), "audit.jsonl")
+	reporting.ConfigureAuditLog(auditLog)
+	t.Cleanup(func() { reporting.ConfigureAuditLog("") })
+
+	mockActions := &MockActions{}
+	mockActions.On("ParseCommand", rememberOptions.CommandToRun).After(200*time.Millisecond).Return(configuration.ParsedCommand{
+		Command:      rememberOptions.CommandToRun,
+		Hash:         "late-hash",
+		TagsByTarget: map[string][]string{"default": {"myreg1/myimage:v1"}},
+	}, nil)
+	mockActions.On("RunCommand", false, rememberOptions.CommandToRun).Return(0)
+	mockActions.On("ExitProcessWithCode", 0).Return()
+
+	err := HandleRememberSubcommand(rememberOptions, mockActions)
+
+	assert.ErrorIs(t, err, errHashTimeout)
+	content, err := os.ReadFile(auditLog)
+	require.NoError(t, err)
+	assert.Contains(t, string(content), `"action":"hash-timed-out"`)
+	assert.Contains(t, string(content), `"timeout":"10ms"`)
+	mockActions.AssertCalled(t, "RunCommand", false, rememberOptions.CommandToRun)
+	mockActions.AssertNotCalled(t, "CheckRegistryCacheExists")
+}
+
+func TestParseAndHashCommandBefore_OnlyTheTimedOutHashingIsCancelled(t *testing.T) {
+	slowCommand := []string{"docker", "buildx", "build", "--push", "-t", "myreg1/slow:v1", "."}
+	command := []string{"docker", "buildx", "build", "--push", "-t", "myreg1/myimage:v1", "."}
+	rememberOptions := configuration.RememberSubcommandOptions{HashTimeout: time.Minute}
+
+	mockActions := &MockActions{}
+	mockActions.On("ParseCommand", slowCommand).After(200*time.Millisecond).Return(configuration.ParsedCommand{Command: slowCommand, Hash: "late-hash"}, nil)
+	// another build of the batch is still hashing when the slow one times out
+	mockActions.On("ParseCommand", command).After(100*time.Millisecond).Return(configuration.ParsedCommand{Command: command, Hash: "hash"}, nil)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		parsedCommand, err := parseAndHashCommandBefore(time.Now().Add(10*time.Millisecond), rememberOptions, mockActions, slowCommand)
+		assert.ErrorIs(t, err, errHashTimeout)
+		assert.Empty(t, parsedCommand.Hash)
+		assert.Equal(t, slowCommand, parsedCommand.Command)
+	}()
+
+	parsedCommand, err := parseAndHashCommandBefore(time.Now().Add(time.Minute), rememberOptions, mockActions, command)
+	wg.Wait()
+
+	require.NoError(t, err)
+	assert.Equal(t, "hash", parsedCommand.Hash)
+}
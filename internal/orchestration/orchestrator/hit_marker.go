@@ -0,0 +1,37 @@
+package orchestrator
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/hytromo/mimosa/internal/configuration"
+	"github.com/hytromo/mimosa/internal/logger"
+	"github.com/samber/lo"
+)
+
+// hitMarkerTagPlaceholder is replaced by each retagged tag in the --hit-marker line
+const hitMarkerTagPlaceholder = "{tag}"
+
+// hitMarkerLines returns the marker lines of a cache hit: one per tag (sorted) when the marker has a {tag}, otherwise
+// the marker itself once - none without a marker
+func hitMarkerLines(marker string, parsedCommand configuration.ParsedCommand) []string {
+	if marker == "" {
+		return nil
+	}
+	if !strings.Contains(marker, hitMarkerTagPlaceholder) {
+		return []string{marker}
+	}
+
+	tags := lo.Uniq(slices.Concat(lo.Values(parsedCommand.PublishedTagsByTarget())...))
+	slices.Sort(tags)
+	return lo.Map(tags, func(tag string, _ int) string {
+		return strings.ReplaceAll(marker, hitMarkerTagPlaceholder, tag)
+	})
+}
+
+// printHitMarkers prints the --hit-marker lines of a cache hit to stdout, for the scripts that look for them in the output
+func printHitMarkers(marker string, parsedCommand configuration.ParsedCommand) {
+	for _, line := range hitMarkerLines(marker, parsedCommand) {
+		logger.CleanLog.Info(line)
+	}
+}
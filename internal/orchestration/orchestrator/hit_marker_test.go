@@ -0,0 +1,51 @@
+package orchestrator
+
+import (
+	"testing"
+
+	"github.com/hytromo/mimosa/internal/cacher"
+	"github.com/hytromo/mimosa/internal/configuration"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHitMarkerLines(t *testing.T) {
+	parsedCommand := configuration.ParsedCommand{TagsByTarget: map[string][]string{
+		"web": {"myreg1/web:v1"},
+		"api": {"myreg1/api:v1", "myreg1/api:latest"},
+	}}
+
+	assert.Nil(t, hitMarkerLines("", parsedCommand))
+	assert.Equal(t, []string{"CACHED"}, hitMarkerLines("CACHED", parsedCommand))
+	assert.Equal(t, []string{
+		"CACHED myreg1/api:latest",
+		"CACHED myreg1/api:v1",
+		"CACHED myreg1/web:v1",
+	}, hitMarkerLines("CACHED {tag}", parsedCommand))
+}
+
+func TestRun_CacheHitWithHitMarker_ExitsWithZero(t *testing.T) {
+	command := []string{"docker", "buildx", "build", "--push", "-t", "myreg1/myimage:v1", "."}
+	rememberOptions := configuration.RememberSubcommandOptions{Enabled: true, CommandToRun: command, HitMarker: "CACHED {tag}"}
+	mockActions := &MockActions{}
+
+	parsedCommand := configuration.ParsedCommand{
+		Hash:         TestHash,
+		Command:      command,
+		TagsByTarget: map[string][]string{"default": {"myreg1/myimage:v1"}},
+	}
+	cacheTagPairs := map[string][]cacher.CacheTagPair{
+		"default": {{CacheTag: "myreg1/myimage:mimosa-content-hash-" + TestHash, NewTag: "myreg1/myimage:v1"}},
+	}
+	mockActions.On("ParseCommand", command).Return(parsedCommand, nil)
+	mockActions.On("CheckRegistryCacheExists", TestHash, parsedCommand.TagsByTarget).Return(true, cacheTagPairs, nil)
+	mockActions.On("CheckPushPermission", cacheTagPairs, false).Return(nil)
+	mockActions.On("RetagFromCacheTags", cacheTagPairs, false).Return(nil)
+
+	err := HandleRememberSubcommand(rememberOptions, mockActions)
+
+	// a hit returns without exiting, so mimosa exits with 0
+	assert.NoError(t, err)
+	mockActions.AssertExpectations(t)
+	mockActions.AssertNotCalled(t, "ExitProcessWithCode")
+	mockActions.AssertNotCalled(t, "RunCommand")
+}
@@ -0,0 +1,89 @@
+package orchestrator
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/hytromo/mimosa/internal/cacher"
+	"github.com/hytromo/mimosa/internal/configuration"
+	"github.com/hytromo/mimosa/internal/utils/dockerutil"
+)
+
+// hitTagData is what a --hit-tag-template can use to name the tag that a cache hit creates
+type hitTagData struct {
+	Original   string // the tag that the command creates, e.g. myorg/app:v1
+	Repository string // its repository as written, e.g. myorg/app
+	Tag        string // its tag, e.g. v1
+	Hash       string // the hash of the command
+	Target     string // the target of the tag, "default" for docker build
+}
+
+// hitTagTemplate parses the --hit-tag-template, nil when there is none - the template is tried on an example tag, so
+// that a template that cannot name tags fails before anything runs
+func hitTagTemplate(text string) (*template.Template, error) {
+	if text == "" {
+		return nil, nil
+	}
+	tmpl, err := template.New("hit-tag").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid hit tag template: %w", err)
+	}
+	if _, err := renderHitTag(tmpl, "myorg/app:v1", "0123456789abcdef", "default"); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// renderHitTag returns the tag named by the template for the tag of the target
+func renderHitTag(tmpl *template.Template, original string, hash string, target string) (string, error) {
+	parsed, err := dockerutil.ParseTag(original)
+	if err != nil {
+		return "", err
+	}
+
+	var rendered strings.Builder
+	err = tmpl.Execute(&rendered, hitTagData{
+		Original:   original,
+		Repository: strings.TrimSuffix(original, ":"+parsed.Tag),
+		Tag:        parsed.Tag,
+		Hash:       hash,
+		Target:     target,
+	})
+	if err != nil {
+		return "", fmt.Errorf("invalid hit tag template: %w", err)
+	}
+	hitTag := strings.TrimSpace(rendered.String())
+	if _, err := dockerutil.ParseTag(hitTag); err != nil {
+		return "", fmt.Errorf("the hit tag template names %s an invalid tag %q: %w", original, hitTag, err)
+	}
+	return hitTag, nil
+}
+
+// withHitTagTemplate renames the new tags of the cache tag pairs of a hit with the --hit-tag-template, and makes them
+// the output tags of the command, so that everything reporting the tags of the hit reports the renamed ones
+func withHitTagTemplate(rememberOptions configuration.RememberSubcommandOptions, parsedCommand *configuration.ParsedCommand, cacheTagsByTarget map[string][]cacher.CacheTagPair) (map[string][]cacher.CacheTagPair, error) {
+	tmpl, err := hitTagTemplate(rememberOptions.HitTagTemplate)
+	if err != nil || tmpl == nil {
+		return cacheTagsByTarget, err
+	}
+
+	renamed := map[string][]cacher.CacheTagPair{}
+	outputTagsByTarget := map[string][]string{}
+	for target, targetPairs := range cacheTagsByTarget {
+		for _, pair := range targetPairs {
+			hitTag, err := renderHitTag(tmpl, pair.NewTag, parsedCommand.Hash, target)
+			if err != nil {
+				return nil, err
+			}
+			// the image is copied within the registry of its cache tag
+			if registryOf(hitTag) != registryOf(pair.CacheTag) {
+				return nil, fmt.Errorf("the hit tag template names %s the tag %s, which is not in the same registry", pair.NewTag, hitTag)
+			}
+			renamed[target] = append(renamed[target], cacher.CacheTagPair{CacheTag: pair.CacheTag, NewTag: hitTag})
+			outputTagsByTarget[target] = append(outputTagsByTarget[target], hitTag)
+		}
+	}
+	parsedCommand.OutputTagsByTarget = outputTagsByTarget
+	return renamed, nil
+}
@@ -0,0 +1,96 @@
+package orchestrator
+
+import (
+	"testing"
+
+	"github.com/hytromo/mimosa/internal/cacher"
+	"github.com/hytromo/mimosa/internal/configuration"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHitTagTemplate(t *testing.T) {
+	tmpl, err := hitTagTemplate("")
+	require.NoError(t, err)
+	assert.Nil(t, tmpl)
+
+	_, err = hitTagTemplate("{{.Original")
+	assert.ErrorContains(t, err, "invalid hit tag template")
+	_, err = hitTagTemplate("{{.Branch}}")
+	assert.ErrorContains(t, err, "invalid hit tag template")
+	_, err = hitTagTemplate("{{.Original}} cached")
+	assert.ErrorContains(t, err, "an invalid tag")
+}
+
+func TestRenderHitTag(t *testing.T) {
+	for template, expected := range map[string]string{
+		"{{.Original}}-cached":                  "localhost:5000/org/app:v1-cached",
+		"{{.Repository}}:from-cache-{{.Tag}}":   "localhost:5000/org/app:from-cache-v1",
+		"{{.Repository}}-cache:{{.Tag}}":        "localhost:5000/org/app-cache:v1",
+		"{{.Repository}}:{{.Target}}-{{.Hash}}": "localhost:5000/org/app:api-abc",
+	} {
+		tmpl, err := hitTagTemplate(template)
+		require.NoError(t, err)
+		hitTag, err := renderHitTag(tmpl, "localhost:5000/org/app:v1", "abc", "api")
+		require.NoError(t, err)
+		assert.Equal(t, expected, hitTag, template)
+	}
+}
+
+func TestWithHitTagTemplate(t *testing.T) {
+	pairs := map[string][]cacher.CacheTagPair{
+		"default": {{CacheTag: "myreg1/app:mimosa-content-hash-abc", NewTag: "myreg1/app:v1"}},
+	}
+
+	parsedCommand := configuration.ParsedCommand{Hash: "abc"}
+	renamed, err := withHitTagTemplate(configuration.RememberSubcommandOptions{}, &parsedCommand, pairs)
+	require.NoError(t, err)
+	assert.Equal(t, pairs, renamed)
+	assert.Nil(t, parsedCommand.OutputTagsByTarget)
+
+	renamed, err = withHitTagTemplate(configuration.RememberSubcommandOptions{HitTagTemplate: "{{.Original}}-cached"}, &parsedCommand, pairs)
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]cacher.CacheTagPair{
+		"default": {{CacheTag: "myreg1/app:mimosa-content-hash-abc", NewTag: "myreg1/app:v1-cached"}},
+	}, renamed)
+	assert.Equal(t, map[string][]string{"default": {"myreg1/app:v1-cached"}}, parsedCommand.OutputTagsByTarget, "the renamed tags are reported")
+
+	_, err = withHitTagTemplate(configuration.RememberSubcommandOptions{HitTagTemplate: "ghcr.io/org/app:{{.Tag}}"}, &parsedCommand, pairs)
+	assert.ErrorContains(t, err, "not in the same registry")
+}
+
+func TestRemember_HitTagTemplate_CacheHitCreatesTheRenamedTags(t *testing.T) {
+	command := []string{"docker", "build", "--push", "-t", "myreg1/myimage:v1", "."}
+	rememberOptions := configuration.RememberSubcommandOptions{Enabled: true, CommandToRun: command, HitTagTemplate: "{{.Original}}-cached"}
+	mockActions := &MockActions{}
+	parsedCommand := configuration.ParsedCommand{Hash: TestHash, Command: command, TagsByTarget: map[string][]string{"default": {"myreg1/myimage:v1"}}}
+	cacheTag := "myreg1/myimage:mimosa-content-hash-" + TestHash
+	renamedPairs := map[string][]cacher.CacheTagPair{"default": {{CacheTag: cacheTag, NewTag: "myreg1/myimage:v1-cached"}}}
+
+	mockActions.On("ParseCommand", command).Return(parsedCommand, nil)
+	mockActions.On("CheckRegistryCacheExists", TestHash, parsedCommand.TagsByTarget).Return(true, map[string][]cacher.CacheTagPair{
+		"default": {{CacheTag: cacheTag, NewTag: "myreg1/myimage:v1"}},
+	}, nil)
+	mockActions.On("CheckPushPermission", renamedPairs, false).Return(nil)
+	mockActions.On("RetagFromCacheTags", renamedPairs, false).Return(nil)
+
+	err := HandleRememberSubcommand(rememberOptions, mockActions)
+
+	assert.NoError(t, err)
+	mockActions.AssertExpectations(t)
+}
+
+func TestRemember_HitTagTemplate_InvalidTemplateRunsTheCommand(t *testing.T) {
+	command := []string{"docker", "build", "--push", "-t", "myreg1/myimage:v1", "."}
+	rememberOptions := configuration.RememberSubcommandOptions{Enabled: true, CommandToRun: command, HitTagTemplate: "{{.Branch}}"}
+	mockActions := &MockActions{}
+
+	mockActions.On("RunCommand", false, command).Return(0)
+	mockActions.On("ExitProcessWithCode", 0).Return()
+
+	err := HandleRememberSubcommand(rememberOptions, mockActions)
+
+	assert.ErrorContains(t, err, "invalid hit tag template")
+	mockActions.AssertExpectations(t)
+	mockActions.AssertNotCalled(t, "ParseCommand", command)
+}
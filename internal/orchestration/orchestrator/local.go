@@ -0,0 +1,64 @@
+package orchestrator
+
+import (
+	"log/slog"
+
+	"github.com/hytromo/mimosa/internal/cacher"
+	"github.com/hytromo/mimosa/internal/configuration"
+	"github.com/hytromo/mimosa/internal/orchestration/actions"
+)
+
+// checkCache checks the cache tags of the command: in the local docker daemon for local-only builds, in the registry
+// otherwise - unless the pull policy makes the command a cache miss
+func checkCache(rememberOptions configuration.RememberSubcommandOptions, act actions.Actions, parsedCommand configuration.ParsedCommand) (bool, map[string][]cacher.CacheTagPair, error) {
+	if pullForcesMiss(rememberOptions, parsedCommand) {
+		return false, nil, nil
+	}
+	var exists bool
+	var cacheTagsByTarget map[string][]cacher.CacheTagPair
+	var err error
+	if parsedCommand.Local {
+		exists, cacheTagsByTarget, err = act.CheckLocalCacheExists(parsedCommand.Command, parsedCommand.Hash, parsedCommand.TagsByTarget)
+	} else {
+		exists, cacheTagsByTarget, err = act.CheckRegistryCacheExists(parsedCommand.DockerConfigDir, parsedCommand.Hash, parsedCommand.TagsByTarget)
+	}
+	auditCacheLookup(parsedCommand, exists, cacheTagsByTarget, err)
+	return exists, cacheTagsByTarget, err
+}
+
+// retagFromCache points the tags of the command to the images of their cache tags
+func retagFromCache(act actions.Actions, parsedCommand configuration.ParsedCommand, cacheTagsByTarget map[string][]cacher.CacheTagPair, dryRun bool) error {
+	if parsedCommand.Local {
+		return act.RetagLocally(parsedCommand.Command, cacheTagsByTarget, dryRun)
+	}
+	return act.RetagFromCacheTags(parsedCommand.DockerConfigDir, cacheTagsByTarget, dryRun)
+}
+
+// checkPushPermission checks that the images of a cache hit can be retagged to the requested tags - the local docker
+// daemon needs no credentials
+func checkPushPermission(act actions.Actions, parsedCommand configuration.ParsedCommand, cacheTagsByTarget map[string][]cacher.CacheTagPair, dryRun bool) error {
+	if parsedCommand.Local {
+		return nil
+	}
+	return act.CheckPushPermission(parsedCommand.DockerConfigDir, cacheTagsByTarget, dryRun)
+}
+
+// saveCommandCacheTags saves the cache tags of the command after it was built - unless the cache is read-only
+func saveCommandCacheTags(rememberOptions configuration.RememberSubcommandOptions, act actions.Actions, parsedCommand configuration.ParsedCommand) error {
+	if rememberOptions.NoWrite {
+		slog.Info("Not saving the cache tags, the cache is read-only (--no-write)", "hash", parsedCommand.Hash)
+		return nil
+	}
+
+	dryRun := rememberOptions.DryRun
+	var err error
+	if parsedCommand.Local {
+		err = act.SaveLocalCacheTags(parsedCommand.Command, parsedCommand.Hash, parsedCommand.TagsByTarget, dryRun)
+	} else {
+		err = act.SaveRegistryCacheTags(parsedCommand.DockerConfigDir, parsedCommand.Hash, parsedCommand.TagsByTarget, dryRun)
+	}
+	if err == nil {
+		auditCacheSaved(parsedCommand, dryRun)
+	}
+	return err
+}
@@ -0,0 +1,133 @@
+package orchestrator
+
+import (
+	"testing"
+
+	"github.com/hytromo/mimosa/internal/cacher"
+	"github.com/hytromo/mimosa/internal/configuration"
+	"github.com/stretchr/testify/assert"
+)
+
+var localCommand = []string{"docker", "buildx", "build", "--load", "-t", "myimage:dev", "."}
+
+func localParsedCommand() configuration.ParsedCommand {
+	return configuration.ParsedCommand{
+		Hash:         TestHash,
+		Command:      localCommand,
+		TagsByTarget: map[string][]string{"default": {"myimage:dev"}},
+	}
+}
+
+func TestRun_LocalBuild_CacheHitTagsLocally(t *testing.T) {
+	rememberOptions := configuration.RememberSubcommandOptions{Enabled: true, CommandToRun: localCommand}
+	mockActions := &MockActions{}
+	parsedCommand := localParsedCommand()
+	cacheTagPairs := map[string][]cacher.CacheTagPair{
+		"default": {{CacheTag: "myimage:mimosa-content-hash-" + TestHash, NewTag: "myimage:dev"}},
+	}
+
+	mockActions.On("DockerDaemonAvailable", localCommand).Return(true)
+	mockActions.On("ParseCommand", localCommand).Return(parsedCommand, nil)
+	mockActions.On("CheckLocalCacheExists", localCommand, TestHash, parsedCommand.TagsByTarget).Return(true, cacheTagPairs, nil)
+	mockActions.On("RetagLocally", localCommand, cacheTagPairs, false).Return(nil)
+
+	err := HandleRememberSubcommand(rememberOptions, mockActions)
+
+	assert.NoError(t, err)
+	mockActions.AssertExpectations(t)
+	mockActions.AssertNotCalled(t, "CheckRegistryCacheExists")
+	mockActions.AssertNotCalled(t, "RetagFromCacheTags")
+	mockActions.AssertNotCalled(t, "RunCommand")
+}
+
+func TestRun_LocalBuild_CacheMissSavesLocalCacheTags(t *testing.T) {
+	rememberOptions := configuration.RememberSubcommandOptions{Enabled: true, CommandToRun: localCommand, VerifyPush: configuration.VerifyPushFail}
+	mockActions := &MockActions{}
+	parsedCommand := localParsedCommand()
+
+	mockActions.On("DockerDaemonAvailable", localCommand).Return(true)
+	mockActions.On("ParseCommand", localCommand).Return(parsedCommand, nil)
+	mockActions.On("CheckLocalCacheExists", localCommand, TestHash, parsedCommand.TagsByTarget).Return(false, nil, nil)
+	// nothing is pushed, so there is no push to verify
+	mockActions.On("RunCommand", false, localCommand, cacheMissEnv(TestHash)).Return(0)
+	mockActions.On("SaveLocalCacheTags", localCommand, TestHash, parsedCommand.TagsByTarget, false).Return(nil)
+
+	err := HandleRememberSubcommand(rememberOptions, mockActions)
+
+	assert.NoError(t, err)
+	mockActions.AssertExpectations(t)
+	mockActions.AssertNotCalled(t, "SaveRegistryCacheTags")
+	mockActions.AssertNotCalled(t, "RunCommandScanningPushes")
+}
+
+func TestRun_LocalBuild_NoDaemonRunsAsIs(t *testing.T) {
+	rememberOptions := configuration.RememberSubcommandOptions{Enabled: true, CommandToRun: localCommand}
+	mockActions := &MockActions{}
+	mockActions.On("DockerDaemonAvailable", localCommand).Return(false)
+	mockActions.On("RunCommand", false, localCommand).Return(0)
+	mockActions.On("ExitProcessWithCode", 0).Return()
+
+	err := HandleRememberSubcommand(rememberOptions, mockActions)
+
+	assert.ErrorIs(t, err, errNoDaemon)
+	mockActions.AssertExpectations(t)
+	mockActions.AssertNotCalled(t, "ParseCommand")
+	mockActions.AssertNotCalled(t, "CheckLocalCacheExists")
+}
+
+func TestRun_NoPushNoLoad_RunsAsIs(t *testing.T) {
+	command := []string{"docker", "buildx", "build", "-t", "myimage:dev", "."}
+	rememberOptions := configuration.RememberSubcommandOptions{Enabled: true, CommandToRun: command}
+	mockActions := &MockActions{}
+	mockActions.On("RunCommand", false, command).Return(0)
+	mockActions.On("ExitProcessWithCode", 0).Return()
+
+	err := HandleRememberSubcommand(rememberOptions, mockActions)
+
+	assert.ErrorIs(t, err, errNoPush)
+	mockActions.AssertExpectations(t)
+	mockActions.AssertNotCalled(t, "ParseCommand")
+}
+
+func TestRemember_NoWrite_CacheMissSavesNoCacheTags(t *testing.T) {
+	command := []string{"docker", "build", "--push", "-t", "myreg1/myimage:pr-12", "."}
+	rememberOptions := configuration.RememberSubcommandOptions{Enabled: true, CommandToRun: command, NoWrite: true}
+	mockActions := &MockActions{}
+	parsedCommand := configuration.ParsedCommand{Hash: TestHash, Command: command, TagsByTarget: map[string][]string{"default": {"myreg1/myimage:pr-12"}}}
+	t.Cleanup(func() {
+		cacher.SetReadOnly(false)
+	})
+
+	mockActions.On("ParseCommand", command).Return(parsedCommand, nil)
+	mockActions.On("CheckRegistryCacheExists", TestHash, parsedCommand.TagsByTarget).Return(false, nil, nil)
+	mockActions.On("RunCommand", false, command, cacheMissEnv(TestHash)).Return(0)
+
+	err := HandleRememberSubcommand(rememberOptions, mockActions)
+
+	assert.NoError(t, err)
+	mockActions.AssertExpectations(t)
+	mockActions.AssertNotCalled(t, "SaveRegistryCacheTags", TestHash, parsedCommand.TagsByTarget, false)
+}
+
+func TestRemember_NoWrite_CacheHitIsRetagged(t *testing.T) {
+	command := []string{"docker", "build", "--push", "-t", "myreg1/myimage:pr-12", "."}
+	rememberOptions := configuration.RememberSubcommandOptions{Enabled: true, CommandToRun: command, NoWrite: true}
+	mockActions := &MockActions{}
+	parsedCommand := configuration.ParsedCommand{Hash: TestHash, Command: command, TagsByTarget: map[string][]string{"default": {"myreg1/myimage:pr-12"}}}
+	cacheTagPairs := map[string][]cacher.CacheTagPair{
+		"default": {{CacheTag: "myreg1/myimage:mimosa-content-hash-" + TestHash, NewTag: "myreg1/myimage:pr-12"}},
+	}
+	t.Cleanup(func() {
+		cacher.SetReadOnly(false)
+	})
+
+	mockActions.On("ParseCommand", command).Return(parsedCommand, nil)
+	mockActions.On("CheckRegistryCacheExists", TestHash, parsedCommand.TagsByTarget).Return(true, cacheTagPairs, nil)
+	mockActions.On("CheckPushPermission", cacheTagPairs, false).Return(nil)
+	mockActions.On("RetagFromCacheTags", cacheTagPairs, false).Return(nil)
+
+	err := HandleRememberSubcommand(rememberOptions, mockActions)
+
+	assert.NoError(t, err)
+	mockActions.AssertExpectations(t)
+}
@@ -2,10 +2,13 @@ package orchestrator
 
 import (
 	"errors"
+	"slices"
 	"testing"
+	"time"
 
 	"github.com/hytromo/mimosa/internal/cacher"
 	"github.com/hytromo/mimosa/internal/configuration"
+	"github.com/hytromo/mimosa/internal/hasher"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -19,27 +22,117 @@ type MockActions struct {
 	mock.Mock
 }
 
-func (m *MockActions) ParseCommand(command []string) (configuration.ParsedCommand, error) {
-	args := m.Called(command)
+func (m *MockActions) ParseCommand(command []string, hashingOptions hasher.Options) (configuration.ParsedCommand, error) {
+	// most commands are hashed with the default options, keep their expectations short - the context of the hashing
+	// differs on every call, and the workspace root on every machine
+	hashingOptions.Context = nil
+	hashingOptions.WorkspaceRoot = ""
+	var args mock.Arguments
+	if hashingOptions.FileHashAlgorithm == hasher.FileHashAlgorithmImo && !hashingOptions.AggressiveNormalize && len(hashingOptions.InfrastructureFlags) == 0 &&
+		!hashingOptions.HashBaseImages && !hashingOptions.HashBaseImagesOnPull && hashingOptions.BakePlan == "" {
+		args = m.Called(command)
+	} else {
+		args = m.Called(command, hashingOptions)
+	}
 	return args.Get(0).(configuration.ParsedCommand), args.Error(1)
 }
 
-func (m *MockActions) RunCommand(dryRun bool, command []string) int {
-	args := m.Called(dryRun, command)
-	return args.Int(0)
+func (m *MockActions) RunCommand(dryRun bool, command []string, env ...string) int {
+	// most commands run without extra environment variables, keep their expectations short
+	if len(env) == 0 {
+		return m.Called(dryRun, command).Int(0)
+	}
+	return m.Called(dryRun, command, env).Int(0)
+}
+
+func (m *MockActions) RunCommandScanningPushes(dryRun bool, command []string, pushPatterns []string, env []string) (int, []string) {
+	args := m.Called(dryRun, command, pushPatterns, env)
+	var pushedReferences []string
+	if args.Get(1) != nil {
+		pushedReferences = args.Get(1).([]string)
+	}
+	return args.Int(0), pushedReferences
 }
 
 func (m *MockActions) ExitProcessWithCode(code int) {
 	m.Called(code)
 }
 
-func (m *MockActions) RetagFromCacheTags(cacheTagPairsByTarget map[string][]cacher.CacheTagPair, dryRun bool) error {
-	args := m.Called(cacheTagPairsByTarget, dryRun)
+// registryCalled records a call that talks to the registries with the credentials of dockerConfigDir - most commands
+// use the default docker config, keep their expectations short
+func (m *MockActions) registryCalled(method string, dockerConfigDir string, arguments ...any) mock.Arguments {
+	if dockerConfigDir == "" {
+		return m.MethodCalled(method, arguments...)
+	}
+	return m.MethodCalled(method, append([]any{dockerConfigDir}, arguments...)...)
+}
+
+func (m *MockActions) RetagFromCacheTags(dockerConfigDir string, cacheTagPairsByTarget map[string][]cacher.CacheTagPair, dryRun bool) error {
+	args := m.registryCalled("RetagFromCacheTags", dockerConfigDir, cacheTagPairsByTarget, dryRun)
+	return args.Error(0)
+}
+
+func (m *MockActions) CheckPushPermission(dockerConfigDir string, cacheTagPairsByTarget map[string][]cacher.CacheTagPair, dryRun bool) error {
+	args := m.registryCalled("CheckPushPermission", dockerConfigDir, cacheTagPairsByTarget, dryRun)
+	return args.Error(0)
+}
+
+func (m *MockActions) AnnounceRegistryBuild(dockerConfigDir string, hash string, tagsByTarget map[string][]string, ttl time.Duration, dryRun bool) (time.Time, error) {
+	args := m.registryCalled("AnnounceRegistryBuild", dockerConfigDir, hash, tagsByTarget, ttl, dryRun)
+	return args.Get(0).(time.Time), args.Error(1)
+}
+
+func (m *MockActions) RegistryBuildAnnouncedUntil(dockerConfigDir string, hash string, tagsByTarget map[string][]string) (time.Time, error) {
+	args := m.registryCalled("RegistryBuildAnnouncedUntil", dockerConfigDir, hash, tagsByTarget)
+	return args.Get(0).(time.Time), args.Error(1)
+}
+
+func (m *MockActions) WithdrawRegistryBuild(dockerConfigDir string, hash string, tagsByTarget map[string][]string) error {
+	args := m.registryCalled("WithdrawRegistryBuild", dockerConfigDir, hash, tagsByTarget)
 	return args.Error(0)
 }
 
-func (m *MockActions) CheckRegistryCacheExists(hash string, tagsByTarget map[string][]string) (bool, map[string][]cacher.CacheTagPair, error) {
-	args := m.Called(hash, tagsByTarget)
+func (m *MockActions) RecordedBuildInputs(dockerConfigDir string, tag string, digest string) (cacher.BuildInputs, bool, error) {
+	args := m.registryCalled("RecordedBuildInputs", dockerConfigDir, tag, digest)
+	return args.Get(0).(cacher.BuildInputs), args.Bool(1), args.Error(2)
+}
+
+func (m *MockActions) RecordBuildInputs(dockerConfigDir string, tag string, digest string, inputs cacher.BuildInputs) error {
+	args := m.registryCalled("RecordBuildInputs", dockerConfigDir, tag, digest, inputs)
+	return args.Error(0)
+}
+
+func (m *MockActions) VerifyCachedAttestations(dockerConfigDir string, cacheTagPairsByTarget map[string][]cacher.CacheTagPair, attestationsByTarget map[string][]string) error {
+	args := m.registryCalled("VerifyCachedAttestations", dockerConfigDir, cacheTagPairsByTarget, attestationsByTarget)
+	return args.Error(0)
+}
+
+func (m *MockActions) VerifyCachedPlatforms(dockerConfigDir string, cacheTagPairsByTarget map[string][]cacher.CacheTagPair, platformsByTarget map[string][]string) error {
+	args := m.registryCalled("VerifyCachedPlatforms", dockerConfigDir, cacheTagPairsByTarget, platformsByTarget)
+	return args.Error(0)
+}
+
+func (m *MockActions) TagDigests(dockerConfigDir string, tags []string) (map[string]string, error) {
+	args := m.registryCalled("TagDigests", dockerConfigDir, tags)
+	var digests map[string]string
+	if args.Get(0) != nil {
+		digests = args.Get(0).(map[string]string)
+	}
+	return digests, args.Error(1)
+}
+
+func (m *MockActions) WriteCacheHitOutputs(command []string, cacheTagPairsByTarget map[string][]cacher.CacheTagPair, dryRun bool) error {
+	args := m.Called(command, cacheTagPairsByTarget, dryRun)
+	return args.Error(0)
+}
+
+func (m *MockActions) InspectBuilder(command []string) (string, error) {
+	args := m.Called(command)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockActions) CheckRegistryCacheExists(dockerConfigDir string, hash string, tagsByTarget map[string][]string) (bool, map[string][]cacher.CacheTagPair, error) {
+	args := m.registryCalled("CheckRegistryCacheExists", dockerConfigDir, hash, tagsByTarget)
 	var cacheTags map[string][]cacher.CacheTagPair
 	if args.Get(1) != nil {
 		cacheTags = args.Get(1).(map[string][]cacher.CacheTagPair)
@@ -47,8 +140,32 @@ func (m *MockActions) CheckRegistryCacheExists(hash string, tagsByTarget map[str
 	return args.Bool(0), cacheTags, args.Error(2)
 }
 
-func (m *MockActions) SaveRegistryCacheTags(hash string, tagsByTarget map[string][]string, dryRun bool) error {
-	args := m.Called(hash, tagsByTarget, dryRun)
+func (m *MockActions) SaveRegistryCacheTags(dockerConfigDir string, hash string, tagsByTarget map[string][]string, dryRun bool) error {
+	args := m.registryCalled("SaveRegistryCacheTags", dockerConfigDir, hash, tagsByTarget, dryRun)
+	return args.Error(0)
+}
+
+func (m *MockActions) CheckLocalCacheExists(command []string, hash string, tagsByTarget map[string][]string) (bool, map[string][]cacher.CacheTagPair, error) {
+	args := m.Called(command, hash, tagsByTarget)
+	var cacheTags map[string][]cacher.CacheTagPair
+	if args.Get(1) != nil {
+		cacheTags = args.Get(1).(map[string][]cacher.CacheTagPair)
+	}
+	return args.Bool(0), cacheTags, args.Error(2)
+}
+
+func (m *MockActions) DockerDaemonAvailable(command []string) bool {
+	args := m.Called(command)
+	return args.Bool(0)
+}
+
+func (m *MockActions) RetagLocally(command []string, cacheTagPairsByTarget map[string][]cacher.CacheTagPair, dryRun bool) error {
+	args := m.Called(command, cacheTagPairsByTarget, dryRun)
+	return args.Error(0)
+}
+
+func (m *MockActions) SaveLocalCacheTags(command []string, hash string, tagsByTarget map[string][]string, dryRun bool) error {
+	args := m.Called(command, hash, tagsByTarget, dryRun)
 	return args.Error(0)
 }
 
@@ -84,6 +201,7 @@ func TestRun_RememberEnabled_RegistryCache_CacheExists(t *testing.T) {
 
 	mockActions.On("ParseCommand", []string{"docker", "build", "--push", "-t", "myreg1/myimage:v1", "."}).Return(parsedCommand, nil)
 	mockActions.On("CheckRegistryCacheExists", TestHash, parsedCommand.TagsByTarget).Return(true, cacheTagPairs, nil)
+	mockActions.On("CheckPushPermission", cacheTagPairs, false).Return(nil)
 	mockActions.On("RetagFromCacheTags", cacheTagPairs, false).Return(nil)
 
 	err := HandleRememberSubcommand(rememberOptions, mockActions)
@@ -92,6 +210,124 @@ func TestRun_RememberEnabled_RegistryCache_CacheExists(t *testing.T) {
 	mockActions.AssertExpectations(t)
 }
 
+func TestRun_RememberEnabled_RegistryCache_DockerConfigDir(t *testing.T) {
+	command := []string{"docker", "--config", "/work/.docker", "build", "--push", "-t", "myreg1/myimage:v1", "."}
+	rememberOptions := configuration.RememberSubcommandOptions{Enabled: true, CommandToRun: command}
+
+	mockActions := &MockActions{}
+
+	parsedCommand := configuration.ParsedCommand{
+		Hash:            TestHash,
+		Command:         command,
+		TagsByTarget:    map[string][]string{"default": {"myreg1/myimage:v1"}},
+		DockerConfigDir: "/work/.docker",
+	}
+
+	cacheTagPairs := map[string][]cacher.CacheTagPair{
+		"default": {
+			{CacheTag: "myreg1/myimage:mimosa-content-hash-" + TestHash, NewTag: "myreg1/myimage:v1"},
+		},
+	}
+
+	// the registry calls use the credentials of the config dir of the command
+	mockActions.On("ParseCommand", command).Return(parsedCommand, nil)
+	mockActions.On("CheckRegistryCacheExists", "/work/.docker", TestHash, parsedCommand.TagsByTarget).Return(true, cacheTagPairs, nil)
+	mockActions.On("CheckPushPermission", "/work/.docker", cacheTagPairs, false).Return(nil)
+	mockActions.On("RetagFromCacheTags", "/work/.docker", cacheTagPairs, false).Return(nil)
+
+	err := HandleRememberSubcommand(rememberOptions, mockActions)
+
+	assert.NoError(t, err)
+	mockActions.AssertExpectations(t)
+}
+
+func TestRun_RememberEnabled_RegistryCache_CacheExists_WritesBuildOutputs(t *testing.T) {
+	command := []string{"docker", "build", "--push", "--iidfile", "iid.txt", "-t", "myreg1/myimage:v1", "."}
+	rememberOptions := configuration.RememberSubcommandOptions{Enabled: true, CommandToRun: command}
+
+	mockActions := &MockActions{}
+
+	parsedCommand := configuration.ParsedCommand{
+		Hash:         TestHash,
+		Command:      command,
+		TagsByTarget: map[string][]string{"default": {"myreg1/myimage:v1"}},
+	}
+	cacheTagPairs := map[string][]cacher.CacheTagPair{
+		"default": {{CacheTag: "myreg1/myimage:mimosa-content-hash-" + TestHash, NewTag: "myreg1/myimage:v1"}},
+	}
+
+	mockActions.On("ParseCommand", command).Return(parsedCommand, nil)
+	mockActions.On("CheckRegistryCacheExists", TestHash, parsedCommand.TagsByTarget).Return(true, cacheTagPairs, nil)
+	mockActions.On("CheckPushPermission", cacheTagPairs, false).Return(nil)
+	mockActions.On("RetagFromCacheTags", cacheTagPairs, false).Return(nil)
+	// failing to write the outputs does not fail the command
+	mockActions.On("WriteCacheHitOutputs", command, cacheTagPairs, false).Return(errors.New("write error"))
+
+	err := HandleRememberSubcommand(rememberOptions, mockActions)
+
+	assert.NoError(t, err)
+	mockActions.AssertExpectations(t)
+	mockActions.AssertNotCalled(t, "RunCommand")
+}
+
+func TestRun_RememberEnabled_RegistryCache_CachedPlatformsMismatch_RunsCommand(t *testing.T) {
+	command := []string{"docker", "buildx", "build", "--push", "--platform", "linux/amd64,linux/arm64", "-t", "myreg1/myimage:v1", "."}
+	rememberOptions := configuration.RememberSubcommandOptions{Enabled: true, CommandToRun: command}
+
+	mockActions := &MockActions{}
+
+	parsedCommand := configuration.ParsedCommand{
+		Hash:              TestHash,
+		Command:           command,
+		TagsByTarget:      map[string][]string{"default": {"myreg1/myimage:v1"}},
+		PlatformsByTarget: map[string][]string{"default": {"linux/amd64", "linux/arm64"}},
+	}
+	cacheTagPairs := map[string][]cacher.CacheTagPair{
+		"default": {{CacheTag: "myreg1/myimage:mimosa-content-hash-" + TestHash, NewTag: "myreg1/myimage:v1"}},
+	}
+
+	mockActions.On("ParseCommand", command).Return(parsedCommand, nil)
+	mockActions.On("CheckRegistryCacheExists", TestHash, parsedCommand.TagsByTarget).Return(true, cacheTagPairs, nil)
+	mockActions.On("VerifyCachedPlatforms", cacheTagPairs, parsedCommand.PlatformsByTarget).Return(errors.New("not built for linux/arm64"))
+	mockActions.On("RunCommand", false, command, cacheMissEnv(TestHash)).Return(0)
+	mockActions.On("SaveRegistryCacheTags", TestHash, parsedCommand.TagsByTarget, false).Return(nil)
+
+	err := HandleRememberSubcommand(rememberOptions, mockActions)
+
+	assert.NoError(t, err)
+	mockActions.AssertExpectations(t)
+	mockActions.AssertNotCalled(t, "RetagFromCacheTags")
+}
+
+func TestRun_RememberEnabled_RegistryCache_CachedAttestationsMissing_RunsCommand(t *testing.T) {
+	command := []string{"docker", "buildx", "build", "--push", "--provenance=mode=max", "-t", "myreg1/myimage:v1", "."}
+	rememberOptions := configuration.RememberSubcommandOptions{Enabled: true, CommandToRun: command}
+
+	mockActions := &MockActions{}
+
+	parsedCommand := configuration.ParsedCommand{
+		Hash:                 TestHash,
+		Command:              command,
+		TagsByTarget:         map[string][]string{"default": {"myreg1/myimage:v1"}},
+		AttestationsByTarget: map[string][]string{"default": {"provenance"}},
+	}
+	cacheTagPairs := map[string][]cacher.CacheTagPair{
+		"default": {{CacheTag: "myreg1/myimage:mimosa-content-hash-" + TestHash, NewTag: "myreg1/myimage:v1"}},
+	}
+
+	mockActions.On("ParseCommand", command).Return(parsedCommand, nil)
+	mockActions.On("CheckRegistryCacheExists", TestHash, parsedCommand.TagsByTarget).Return(true, cacheTagPairs, nil)
+	mockActions.On("VerifyCachedAttestations", cacheTagPairs, parsedCommand.AttestationsByTarget).Return(errors.New("has no provenance attestation"))
+	mockActions.On("RunCommand", false, command, cacheMissEnv(TestHash)).Return(0)
+	mockActions.On("SaveRegistryCacheTags", TestHash, parsedCommand.TagsByTarget, false).Return(nil)
+
+	err := HandleRememberSubcommand(rememberOptions, mockActions)
+
+	assert.NoError(t, err)
+	mockActions.AssertExpectations(t)
+	mockActions.AssertNotCalled(t, "RetagFromCacheTags")
+}
+
 func TestRun_RememberEnabled_RegistryCache_CacheMiss(t *testing.T) {
 	rememberOptions := configuration.RememberSubcommandOptions{
 		Enabled:      true,
@@ -109,7 +345,7 @@ func TestRun_RememberEnabled_RegistryCache_CacheMiss(t *testing.T) {
 
 	mockActions.On("ParseCommand", []string{"docker", "build", "--push", "-t", "myreg1/myimage:v1", "."}).Return(parsedCommand, nil)
 	mockActions.On("CheckRegistryCacheExists", TestHash, parsedCommand.TagsByTarget).Return(false, nil, nil)
-	mockActions.On("RunCommand", false, parsedCommand.Command).Return(0)
+	mockActions.On("RunCommand", false, parsedCommand.Command, cacheMissEnv(TestHash)).Return(0)
 	mockActions.On("SaveRegistryCacheTags", TestHash, parsedCommand.TagsByTarget, false).Return(nil)
 
 	err := HandleRememberSubcommand(rememberOptions, mockActions)
@@ -168,6 +404,7 @@ func TestRun_RememberEnabled_RegistryCache_RetagFails_Fallback(t *testing.T) {
 
 	mockActions.On("ParseCommand", []string{"docker", "build", "--push", "-t", "myreg1/myimage:v1", "."}).Return(parsedCommand, nil)
 	mockActions.On("CheckRegistryCacheExists", TestHash, parsedCommand.TagsByTarget).Return(true, cacheTagPairs, nil)
+	mockActions.On("CheckPushPermission", cacheTagPairs, false).Return(nil)
 	mockActions.On("RetagFromCacheTags", cacheTagPairs, false).Return(errors.New("retag error"))
 	mockActions.On("RunCommand", false, parsedCommand.Command).Return(1)
 	mockActions.On("ExitProcessWithCode", 1).Return()
@@ -179,6 +416,39 @@ func TestRun_RememberEnabled_RegistryCache_RetagFails_Fallback(t *testing.T) {
 	mockActions.AssertExpectations(t)
 }
 
+func TestRun_RememberEnabled_RegistryCache_NoPushPermission_FailsFast(t *testing.T) {
+	rememberOptions := configuration.RememberSubcommandOptions{
+		Enabled:      true,
+		CommandToRun: []string{"docker", "build", "--push", "-t", "myreg1/myimage:v1", "."},
+	}
+
+	mockActions := &MockActions{}
+
+	parsedCommand := configuration.ParsedCommand{
+		Hash:         TestHash,
+		Command:      []string{"docker", "build", "--push", "-t", "myreg1/myimage:v1", "."},
+		TagsByTarget: map[string][]string{"default": {"myreg1/myimage:v1"}},
+	}
+
+	cacheTagPairs := map[string][]cacher.CacheTagPair{
+		"default": {
+			{CacheTag: "myreg1/myimage:mimosa-content-hash-" + TestHash, NewTag: "myreg1/myimage:v1"},
+		},
+	}
+
+	mockActions.On("ParseCommand", parsedCommand.Command).Return(parsedCommand, nil)
+	mockActions.On("CheckRegistryCacheExists", TestHash, parsedCommand.TagsByTarget).Return(true, cacheTagPairs, nil)
+	mockActions.On("CheckPushPermission", cacheTagPairs, false).Return(errors.New("no push permission to myreg1/myimage"))
+	mockActions.On("ExitProcessWithCode", 1).Return()
+
+	err := HandleRememberSubcommand(rememberOptions, mockActions)
+
+	assert.ErrorContains(t, err, "no push permission")
+	mockActions.AssertExpectations(t)
+	mockActions.AssertNotCalled(t, "RetagFromCacheTags")
+	mockActions.AssertNotCalled(t, "RunCommand")
+}
+
 func TestRun_RememberEnabled_RegistryCache_CommandFails(t *testing.T) {
 	rememberOptions := configuration.RememberSubcommandOptions{
 		Enabled:      true,
@@ -196,7 +466,7 @@ func TestRun_RememberEnabled_RegistryCache_CommandFails(t *testing.T) {
 
 	mockActions.On("ParseCommand", []string{"docker", "build", "--push", "-t", "myreg1/myimage:v1", "."}).Return(parsedCommand, nil)
 	mockActions.On("CheckRegistryCacheExists", TestHash, parsedCommand.TagsByTarget).Return(false, nil, nil)
-	mockActions.On("RunCommand", false, parsedCommand.Command).Return(1)
+	mockActions.On("RunCommand", false, parsedCommand.Command, cacheMissEnv(TestHash)).Return(1)
 	mockActions.On("ExitProcessWithCode", 1).Return()
 
 	err := HandleRememberSubcommand(rememberOptions, mockActions)
@@ -223,7 +493,7 @@ func TestRun_RememberEnabled_RegistryCache_SaveCacheTagsFails_Continues(t *testi
 
 	mockActions.On("ParseCommand", []string{"docker", "build", "--push", "-t", "myreg1/myimage:v1", "."}).Return(parsedCommand, nil)
 	mockActions.On("CheckRegistryCacheExists", TestHash, parsedCommand.TagsByTarget).Return(false, nil, nil)
-	mockActions.On("RunCommand", false, parsedCommand.Command).Return(0)
+	mockActions.On("RunCommand", false, parsedCommand.Command, cacheMissEnv(TestHash)).Return(0)
 	mockActions.On("SaveRegistryCacheTags", TestHash, parsedCommand.TagsByTarget, false).Return(errors.New("save error"))
 
 	err := HandleRememberSubcommand(rememberOptions, mockActions)
@@ -262,6 +532,7 @@ func TestRun_RememberEnabled_RegistryCache_MultipleTargets(t *testing.T) {
 
 	mockActions.On("ParseCommand", []string{"docker", "buildx", "bake", "--push", "-f", "docker-bake.hcl"}).Return(parsedCommand, nil)
 	mockActions.On("CheckRegistryCacheExists", TestHash, parsedCommand.TagsByTarget).Return(true, cacheTagPairs, nil)
+	mockActions.On("CheckPushPermission", cacheTagPairs, false).Return(nil)
 	mockActions.On("RetagFromCacheTags", cacheTagPairs, false).Return(nil)
 
 	err := HandleRememberSubcommand(rememberOptions, mockActions)
@@ -309,7 +580,7 @@ func TestRun_DryRunMode(t *testing.T) {
 
 	mockActions.On("ParseCommand", []string{"docker", "build", "--push", "-t", "myreg1/myimage:v1", "."}).Return(parsedCommand, nil)
 	mockActions.On("CheckRegistryCacheExists", TestHash, parsedCommand.TagsByTarget).Return(false, nil, nil)
-	mockActions.On("RunCommand", true, parsedCommand.Command).Return(0)
+	mockActions.On("RunCommand", true, parsedCommand.Command, cacheMissEnv(TestHash)).Return(0)
 	mockActions.On("SaveRegistryCacheTags", TestHash, parsedCommand.TagsByTarget, true).Return(nil)
 
 	err := HandleRememberSubcommand(rememberOptions, mockActions)
@@ -342,6 +613,7 @@ func TestRun_RememberEnabled_RetagOnly_CacheHit(t *testing.T) {
 
 	mockActions.On("ParseCommand", []string{"docker", "build", "--push", "-t", "myreg1/myimage:v1", "."}).Return(parsedCommand, nil)
 	mockActions.On("CheckRegistryCacheExists", TestHash, parsedCommand.TagsByTarget).Return(true, cacheTagPairs, nil)
+	mockActions.On("CheckPushPermission", cacheTagPairs, false).Return(nil)
 	mockActions.On("RetagFromCacheTags", cacheTagPairs, false).Return(nil)
 
 	err := HandleRememberSubcommand(rememberOptions, mockActions)
@@ -477,6 +749,7 @@ func TestRun_RememberEnabled_RetagOnly_RetagFails_ReturnsError_NoRunCommand(t *t
 
 	mockActions.On("ParseCommand", []string{"docker", "build", "--push", "-t", "myreg1/myimage:v1", "."}).Return(parsedCommand, nil)
 	mockActions.On("CheckRegistryCacheExists", TestHash, parsedCommand.TagsByTarget).Return(true, cacheTagPairs, nil)
+	mockActions.On("CheckPushPermission", cacheTagPairs, false).Return(nil)
 	mockActions.On("RetagFromCacheTags", cacheTagPairs, false).Return(errors.New("retag error"))
 
 	err := HandleRememberSubcommand(rememberOptions, mockActions)
@@ -487,3 +760,225 @@ func TestRun_RememberEnabled_RetagOnly_RetagFails_ReturnsError_NoRunCommand(t *t
 	mockActions.AssertNotCalled(t, "RunCommand")
 	mockActions.AssertNotCalled(t, "ExitProcessWithCode")
 }
+
+func TestRun_RememberEnabled_HashBuilder_IncludedInHash(t *testing.T) {
+	rememberOptions := configuration.RememberSubcommandOptions{
+		Enabled:      true,
+		CommandToRun: []string{"docker", "buildx", "build", "--push", "-t", "myreg1/myimage:v1", "."},
+		HashBuilder:  true,
+	}
+
+	mockActions := &MockActions{}
+
+	parsedCommand := configuration.ParsedCommand{
+		Hash:         TestHash,
+		Command:      []string{"docker", "buildx", "build", "--push", "-t", "myreg1/myimage:v1", "."},
+		TagsByTarget: map[string][]string{"default": {"myreg1/myimage:v1"}},
+	}
+	builderSummary := "driver=docker-container;buildkit=v0.13.0;platforms=linux/amd64"
+	expectedHash := hasher.HashStrings([]string{TestHash, builderSummary})
+
+	mockActions.On("ParseCommand", parsedCommand.Command).Return(parsedCommand, nil)
+	mockActions.On("InspectBuilder", parsedCommand.Command).Return(builderSummary, nil)
+	mockActions.On("CheckRegistryCacheExists", expectedHash, parsedCommand.TagsByTarget).Return(false, nil, nil)
+	mockActions.On("RunCommand", false, parsedCommand.Command, cacheMissEnv(expectedHash)).Return(0)
+	mockActions.On("SaveRegistryCacheTags", expectedHash, parsedCommand.TagsByTarget, false).Return(nil)
+
+	err := HandleRememberSubcommand(rememberOptions, mockActions)
+
+	assert.NoError(t, err)
+	assert.NotEqual(t, TestHash, expectedHash)
+	mockActions.AssertExpectations(t)
+}
+
+func TestRun_RememberEnabled_HashBuilder_InspectFails_Fallback(t *testing.T) {
+	rememberOptions := configuration.RememberSubcommandOptions{
+		Enabled:      true,
+		CommandToRun: []string{"docker", "buildx", "build", "--push", "-t", "myreg1/myimage:v1", "."},
+		HashBuilder:  true,
+	}
+
+	mockActions := &MockActions{}
+
+	parsedCommand := configuration.ParsedCommand{
+		Hash:         TestHash,
+		Command:      []string{"docker", "buildx", "build", "--push", "-t", "myreg1/myimage:v1", "."},
+		TagsByTarget: map[string][]string{"default": {"myreg1/myimage:v1"}},
+	}
+
+	mockActions.On("ParseCommand", parsedCommand.Command).Return(parsedCommand, nil)
+	mockActions.On("InspectBuilder", parsedCommand.Command).Return("", errors.New("inspect error"))
+	mockActions.On("RunCommand", false, parsedCommand.Command).Return(0)
+	mockActions.On("ExitProcessWithCode", 0).Return()
+
+	err := HandleRememberSubcommand(rememberOptions, mockActions)
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "inspect error")
+	mockActions.AssertExpectations(t)
+	mockActions.AssertNotCalled(t, "CheckRegistryCacheExists")
+}
+
+func TestRun_RememberEnabled_HashingOptions(t *testing.T) {
+	rememberOptions := configuration.RememberSubcommandOptions{
+		Enabled:             true,
+		DryRun:              true,
+		CommandToRun:        []string{"docker", "buildx", "build", "--push", "-t", "myreg1/myimage:v1", "."},
+		HashAlgorithm:       "sha256",
+		AggressiveNormalize: true,
+		IgnoreInfraFlags:    true,
+		InfraFlags:          []string{"--dns"},
+		HashBaseImages:      true,
+		PullPolicy:          configuration.PullPolicyResolve,
+		BakePlan:            "plan.json",
+	}
+
+	mockActions := &MockActions{}
+
+	parsedCommand := configuration.ParsedCommand{
+		Hash:         TestHash,
+		Command:      rememberOptions.CommandToRun,
+		TagsByTarget: map[string][]string{"default": {"myreg1/myimage:v1"}},
+	}
+	hashingOptions := hasher.Options{
+		FileHashAlgorithm:    hasher.FileHashAlgorithmSHA256,
+		AggressiveNormalize:  true,
+		InfrastructureFlags:  append(slices.Clone(hasher.DefaultInfrastructureFlags), hasher.InfrastructureFlag{Name: "--dns"}),
+		HashBaseImages:       true,
+		HashBaseImagesOnPull: true,
+		BakePlan:             "plan.json",
+	}
+
+	mockActions.On("ParseCommand", parsedCommand.Command, hashingOptions).Return(parsedCommand, nil)
+	mockActions.On("CheckRegistryCacheExists", TestHash, parsedCommand.TagsByTarget).Return(false, nil, nil)
+	mockActions.On("RunCommand", true, parsedCommand.Command, cacheMissEnv(TestHash)).Return(0)
+	mockActions.On("SaveRegistryCacheTags", TestHash, parsedCommand.TagsByTarget, true).Return(nil)
+
+	err := HandleRememberSubcommand(rememberOptions, mockActions)
+
+	assert.NoError(t, err)
+	mockActions.AssertExpectations(t)
+}
+
+func TestRun_RememberEnabled_InvalidHashAlgorithm_Fallback(t *testing.T) {
+	rememberOptions := configuration.RememberSubcommandOptions{
+		Enabled:       true,
+		CommandToRun:  []string{"docker", "buildx", "build", "--push", "-t", "myreg1/myimage:v1", "."},
+		HashAlgorithm: "md5",
+	}
+
+	mockActions := &MockActions{}
+
+	mockActions.On("RunCommand", false, rememberOptions.CommandToRun).Return(0)
+	mockActions.On("ExitProcessWithCode", 0).Return()
+
+	err := HandleRememberSubcommand(rememberOptions, mockActions)
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown hash algorithm")
+	mockActions.AssertExpectations(t)
+	mockActions.AssertNotCalled(t, "ParseCommand")
+}
+
+func TestRun_RememberEnabled_NonDockerCommand_ParsedWithoutPushFlag(t *testing.T) {
+	rememberOptions := configuration.RememberSubcommandOptions{
+		Enabled:      true,
+		CommandToRun: []string{"build-tool", "image", "push", "myreg1/myimage:v1"},
+	}
+
+	mockActions := &MockActions{}
+
+	parsedCommand := configuration.ParsedCommand{
+		Hash:         TestHash,
+		TagsByTarget: map[string][]string{"default": {"myreg1/myimage:v1"}},
+		Command:      rememberOptions.CommandToRun,
+	}
+	cacheTagPairs := map[string][]cacher.CacheTagPair{
+		"default": {{CacheTag: "myreg1/myimage:mimosa-content-hash-" + TestHash, NewTag: "myreg1/myimage:v1"}},
+	}
+
+	// registered parsers guarantee that the command pushes, so no --push flag is needed
+	mockActions.On("ParseCommand", rememberOptions.CommandToRun).Return(parsedCommand, nil)
+	mockActions.On("CheckRegistryCacheExists", TestHash, parsedCommand.TagsByTarget).Return(true, cacheTagPairs, nil)
+	mockActions.On("CheckPushPermission", cacheTagPairs, false).Return(nil)
+	mockActions.On("RetagFromCacheTags", cacheTagPairs, false).Return(nil)
+
+	err := HandleRememberSubcommand(rememberOptions, mockActions)
+
+	assert.NoError(t, err)
+	mockActions.AssertExpectations(t)
+	mockActions.AssertNotCalled(t, "RunCommand")
+}
+
+func TestRun_RequirePush_FailsWithoutRunning(t *testing.T) {
+	rememberOptions := configuration.RememberSubcommandOptions{
+		Enabled:      true,
+		CommandToRun: []string{"docker", "buildx", "build", "--load", "-t", "myreg1/myimage:v1", "."},
+		RequirePush:  true,
+	}
+
+	mockActions := &MockActions{}
+	mockActions.On("ExitProcessWithCode", 1).Return()
+
+	err := HandleRememberSubcommand(rememberOptions, mockActions)
+
+	assert.ErrorIs(t, err, errNoPush)
+	mockActions.AssertExpectations(t)
+	mockActions.AssertNotCalled(t, "RunCommand")
+	mockActions.AssertNotCalled(t, "ParseCommand")
+}
+
+func TestRun_RequirePush_PushingCommandIsCached(t *testing.T) {
+	rememberOptions := configuration.RememberSubcommandOptions{
+		Enabled:      true,
+		CommandToRun: []string{"docker", "buildx", "build", "--output", "type=registry", "-t", "myreg1/myimage:v1", "."},
+		RequirePush:  true,
+	}
+
+	mockActions := &MockActions{}
+	parsedCommand := configuration.ParsedCommand{
+		Hash:         TestHash,
+		Command:      rememberOptions.CommandToRun,
+		TagsByTarget: map[string][]string{"default": {"myreg1/myimage:v1"}},
+	}
+	mockActions.On("ParseCommand", rememberOptions.CommandToRun).Return(parsedCommand, nil)
+	mockActions.On("CheckRegistryCacheExists", TestHash, parsedCommand.TagsByTarget).Return(false, nil, nil)
+	mockActions.On("RunCommand", false, rememberOptions.CommandToRun, cacheMissEnv(TestHash)).Return(0)
+	mockActions.On("SaveRegistryCacheTags", TestHash, parsedCommand.TagsByTarget, false).Return(nil)
+
+	err := HandleRememberSubcommand(rememberOptions, mockActions)
+
+	assert.NoError(t, err)
+	mockActions.AssertExpectations(t)
+}
+
+func TestHasPushFlag(t *testing.T) {
+	assert.True(t, hasPushFlag([]string{"docker", "buildx", "build", "--push", "-t", "myreg1/myimage:v1", "."}))
+	assert.True(t, hasPushFlag([]string{"docker", "buildx", "build", "-o", "type=registry,name=myreg1/myimage:v1", "."}))
+	assert.True(t, hasPushFlag([]string{"docker", "buildx", "build", "--output=type=image,name=myreg1/myimage:v1,push=true", "."}))
+	assert.False(t, hasPushFlag([]string{"docker", "buildx", "build", "--output", "type=image,name=myreg1/myimage:v1", "."}))
+	assert.False(t, hasPushFlag([]string{"docker", "buildx", "build", "--output=type=docker", "-t", "myreg1/myimage:v1", "."}))
+	assert.False(t, hasPushFlag([]string{"docker", "buildx", "build", "-t", "myreg1/myimage:v1", "."}))
+}
+
+func TestRun_InvalidContextSizeWarning_Fallback(t *testing.T) {
+	rememberOptions := configuration.RememberSubcommandOptions{
+		Enabled:            true,
+		CommandToRun:       []string{"docker", "buildx", "build", "--push", "-t", "myreg1/myimage:v1", "."},
+		ContextSizeWarning: "huge",
+	}
+
+	mockActions := &MockActions{}
+	mockActions.On("RunCommand", false, rememberOptions.CommandToRun).Return(0)
+	mockActions.On("ExitProcessWithCode", 0).Return()
+
+	err := HandleRememberSubcommand(rememberOptions, mockActions)
+
+	assert.ErrorContains(t, err, "invalid context size warning")
+	mockActions.AssertExpectations(t)
+	mockActions.AssertNotCalled(t, "ParseCommand")
+}
+
+func TestCacheMissEnv(t *testing.T) {
+	assert.Equal(t, []string{"MIMOSA_CACHE_DECISION=miss", "MIMOSA_HASH=abc123"}, cacheMissEnv("abc123"))
+}
@@ -0,0 +1,110 @@
+package orchestrator
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/hytromo/mimosa/internal/cacher"
+	"github.com/hytromo/mimosa/internal/configuration"
+	"github.com/hytromo/mimosa/internal/orchestration/actions"
+	"github.com/hytromo/mimosa/internal/utils/dockerutil"
+)
+
+// outputTagsByTarget assigns the --output-tag values ([target=]tag) to the targets of the command - the target can
+// only be left out when the command has a single one
+func outputTagsByTarget(outputTags []string, parsedCommand configuration.ParsedCommand) (map[string][]string, error) {
+	if len(outputTags) == 0 {
+		return nil, nil
+	}
+	if parsedCommand.Local {
+		return nil, fmt.Errorf("--output-tag is not supported for local images")
+	}
+
+	targets := slices.Sorted(maps.Keys(parsedCommand.TagsByTarget))
+	byTarget := map[string][]string{}
+	for _, outputTag := range outputTags {
+		target, tag, hasTarget := strings.Cut(outputTag, "=")
+		if !hasTarget {
+			if len(targets) != 1 {
+				return nil, fmt.Errorf("the output tag %s must name its target (<target>=<tag>), the command builds %s", outputTag, strings.Join(targets, ", "))
+			}
+			target, tag = targets[0], outputTag
+		}
+		if !slices.Contains(targets, target) {
+			return nil, fmt.Errorf("the target %s of the output tag %s is not built by the command", target, outputTag)
+		}
+		if _, err := dockerutil.ParseTag(tag); err != nil {
+			return nil, fmt.Errorf("invalid output tag %s: %w", tag, err)
+		}
+		byTarget[target] = append(byTarget[target], tag)
+	}
+	return byTarget, nil
+}
+
+// registryOf returns the registry of the tag, "" if it cannot be parsed
+func registryOf(tag string) string {
+	parsed, err := dockerutil.ParseTag(tag)
+	if err != nil {
+		return ""
+	}
+	return parsed.Registry
+}
+
+// outputTagPairs returns the pairs that create the output tags of each target from the tags that the images of the
+// target are in (the cache tags of a hit, or the tags that a miss pushed): the images are copied within a registry, so
+// every output tag needs a source tag in its own registry. Targets without output tags keep their sources
+func outputTagPairs(outputTagsByTarget map[string][]string, sourcesByTarget map[string][]string) (map[string][]cacher.CacheTagPair, error) {
+	pairs := map[string][]cacher.CacheTagPair{}
+	for target, sources := range sourcesByTarget {
+		outputTags, ok := outputTagsByTarget[target]
+		if !ok {
+			continue
+		}
+		for _, outputTag := range outputTags {
+			sourceIndex := slices.IndexFunc(sources, func(source string) bool { return registryOf(source) == registryOf(outputTag) })
+			if sourceIndex == -1 {
+				return nil, fmt.Errorf("the output tag %s is not in the registry of any tag of the target %s", outputTag, target)
+			}
+			pairs[target] = append(pairs[target], cacher.CacheTagPair{CacheTag: sources[sourceIndex], NewTag: outputTag})
+		}
+	}
+	return pairs, nil
+}
+
+// withOutputTags makes the cache tag pairs of a hit create the output tags of the command instead of its tags
+func withOutputTags(parsedCommand configuration.ParsedCommand, cacheTagsByTarget map[string][]cacher.CacheTagPair) (map[string][]cacher.CacheTagPair, error) {
+	if len(parsedCommand.OutputTagsByTarget) == 0 {
+		return cacheTagsByTarget, nil
+	}
+
+	cacheTags := map[string][]string{}
+	for target, targetPairs := range cacheTagsByTarget {
+		for _, pair := range targetPairs {
+			cacheTags[target] = append(cacheTags[target], pair.CacheTag)
+		}
+	}
+	outputPairs, err := outputTagPairs(parsedCommand.OutputTagsByTarget, cacheTags)
+	if err != nil {
+		return nil, err
+	}
+	for target, targetPairs := range cacheTagsByTarget {
+		if _, ok := outputPairs[target]; !ok {
+			outputPairs[target] = targetPairs
+		}
+	}
+	return outputPairs, nil
+}
+
+// publishOutputTags creates the output tags of a cache miss from the tags that the command pushed
+func publishOutputTags(act actions.Actions, parsedCommand configuration.ParsedCommand, dryRun bool) error {
+	if len(parsedCommand.OutputTagsByTarget) == 0 {
+		return nil
+	}
+	pairs, err := outputTagPairs(parsedCommand.OutputTagsByTarget, parsedCommand.TagsByTarget)
+	if err != nil {
+		return err
+	}
+	return act.RetagFromCacheTags(parsedCommand.DockerConfigDir, pairs, dryRun)
+}
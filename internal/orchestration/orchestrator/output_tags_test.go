@@ -0,0 +1,108 @@
+package orchestrator
+
+import (
+	"testing"
+
+	"github.com/hytromo/mimosa/internal/cacher"
+	"github.com/hytromo/mimosa/internal/configuration"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutputTagsByTarget(t *testing.T) {
+	single := configuration.ParsedCommand{TagsByTarget: map[string][]string{"default": {"myreg1/app:tmp-1"}}}
+	bake := configuration.ParsedCommand{TagsByTarget: map[string][]string{"api": {"myreg1/api:tmp-1"}, "web": {"myreg1/web:tmp-1"}}}
+
+	byTarget, err := outputTagsByTarget(nil, single)
+	require.NoError(t, err)
+	assert.Nil(t, byTarget)
+
+	byTarget, err = outputTagsByTarget([]string{"myreg1/app:1.2.0", "default=myreg1/app:latest"}, single)
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]string{"default": {"myreg1/app:1.2.0", "myreg1/app:latest"}}, byTarget)
+
+	byTarget, err = outputTagsByTarget([]string{"web=myreg1/web:1.2.0"}, bake)
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]string{"web": {"myreg1/web:1.2.0"}}, byTarget)
+
+	_, err = outputTagsByTarget([]string{"myreg1/web:1.2.0"}, bake)
+	assert.ErrorContains(t, err, "must name its target")
+	_, err = outputTagsByTarget([]string{"db=myreg1/db:1.2.0"}, bake)
+	assert.ErrorContains(t, err, "is not built by the command")
+	_, err = outputTagsByTarget([]string{"myreg1/app:1.2.0"}, configuration.ParsedCommand{Local: true, TagsByTarget: single.TagsByTarget})
+	assert.ErrorContains(t, err, "not supported for local images")
+}
+
+func TestOutputTagPairs(t *testing.T) {
+	sources := map[string][]string{
+		"api": {"myreg1/api:mimosa-content-hash-abc", "ghcr.io/org/api:mimosa-content-hash-abc"},
+		"web": {"myreg1/web:mimosa-content-hash-abc"},
+	}
+
+	pairs, err := outputTagPairs(map[string][]string{"api": {"ghcr.io/org/api:1.2.0", "myreg1/api-release:1.2.0"}}, sources)
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]cacher.CacheTagPair{"api": {
+		{CacheTag: "ghcr.io/org/api:mimosa-content-hash-abc", NewTag: "ghcr.io/org/api:1.2.0"},
+		{CacheTag: "myreg1/api:mimosa-content-hash-abc", NewTag: "myreg1/api-release:1.2.0"},
+	}}, pairs, "the image is copied from the registry of the output tag")
+
+	_, err = outputTagPairs(map[string][]string{"web": {"quay.io/org/web:1.2.0"}}, sources)
+	assert.ErrorContains(t, err, "is not in the registry of any tag of the target web")
+}
+
+func TestRemember_OutputTags_CacheHitCreatesTheOutputTags(t *testing.T) {
+	command := []string{"docker", "build", "--push", "-t", "myreg1/myimage:tmp-12", "."}
+	rememberOptions := configuration.RememberSubcommandOptions{Enabled: true, CommandToRun: command, OutputTags: []string{"myreg1/myimage:1.2.0"}}
+	mockActions := &MockActions{}
+	parsedCommand := configuration.ParsedCommand{Hash: TestHash, Command: command, TagsByTarget: map[string][]string{"default": {"myreg1/myimage:tmp-12"}}}
+	cacheTag := "myreg1/myimage:mimosa-content-hash-" + TestHash
+	outputPairs := map[string][]cacher.CacheTagPair{"default": {{CacheTag: cacheTag, NewTag: "myreg1/myimage:1.2.0"}}}
+
+	mockActions.On("ParseCommand", command).Return(parsedCommand, nil)
+	mockActions.On("CheckRegistryCacheExists", TestHash, parsedCommand.TagsByTarget).Return(true, map[string][]cacher.CacheTagPair{
+		"default": {{CacheTag: cacheTag, NewTag: "myreg1/myimage:tmp-12"}},
+	}, nil)
+	mockActions.On("CheckPushPermission", outputPairs, false).Return(nil)
+	mockActions.On("RetagFromCacheTags", outputPairs, false).Return(nil)
+
+	err := HandleRememberSubcommand(rememberOptions, mockActions)
+
+	assert.NoError(t, err)
+	mockActions.AssertExpectations(t)
+}
+
+func TestRemember_OutputTags_CacheMissPublishesThePushedImage(t *testing.T) {
+	command := []string{"docker", "build", "--push", "-t", "myreg1/myimage:tmp-12", "."}
+	rememberOptions := configuration.RememberSubcommandOptions{Enabled: true, CommandToRun: command, OutputTags: []string{"myreg1/myimage:1.2.0"}}
+	mockActions := &MockActions{}
+	parsedCommand := configuration.ParsedCommand{Hash: TestHash, Command: command, TagsByTarget: map[string][]string{"default": {"myreg1/myimage:tmp-12"}}}
+
+	mockActions.On("ParseCommand", command).Return(parsedCommand, nil)
+	mockActions.On("CheckRegistryCacheExists", TestHash, parsedCommand.TagsByTarget).Return(false, nil, nil)
+	mockActions.On("RunCommand", false, command, cacheMissEnv(TestHash)).Return(0)
+	mockActions.On("SaveRegistryCacheTags", TestHash, parsedCommand.TagsByTarget, false).Return(nil)
+	mockActions.On("RetagFromCacheTags", map[string][]cacher.CacheTagPair{
+		"default": {{CacheTag: "myreg1/myimage:tmp-12", NewTag: "myreg1/myimage:1.2.0"}},
+	}, false).Return(nil)
+
+	err := HandleRememberSubcommand(rememberOptions, mockActions)
+
+	assert.NoError(t, err)
+	mockActions.AssertExpectations(t)
+}
+
+func TestRemember_OutputTags_InvalidTarget(t *testing.T) {
+	command := []string{"docker", "build", "--push", "-t", "myreg1/myimage:tmp-12", "."}
+	rememberOptions := configuration.RememberSubcommandOptions{Enabled: true, CommandToRun: command, OutputTags: []string{"web=myreg1/web:1.2.0"}}
+	mockActions := &MockActions{}
+	parsedCommand := configuration.ParsedCommand{Hash: TestHash, Command: command, TagsByTarget: map[string][]string{"default": {"myreg1/myimage:tmp-12"}}}
+
+	mockActions.On("ParseCommand", command).Return(parsedCommand, nil)
+	mockActions.On("ExitProcessWithCode", 1).Return()
+
+	err := HandleRememberSubcommand(rememberOptions, mockActions)
+
+	assert.ErrorContains(t, err, "is not built by the command")
+	mockActions.AssertExpectations(t)
+	mockActions.AssertNotCalled(t, "CheckRegistryCacheExists", TestHash, parsedCommand.TagsByTarget)
+}
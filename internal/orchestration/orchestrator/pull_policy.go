@@ -0,0 +1,28 @@
+package orchestrator
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/hytromo/mimosa/internal/configuration"
+)
+
+// validatePullPolicy checks what --pull means for the cache: nothing (""), always a miss, or resolving the base images
+func validatePullPolicy(policy string) error {
+	switch policy {
+	case "", configuration.PullPolicyMiss, configuration.PullPolicyResolve:
+		return nil
+	default:
+		return fmt.Errorf("invalid pull policy %q, must be %s or %s", policy, configuration.PullPolicyMiss, configuration.PullPolicyResolve)
+	}
+}
+
+// pullForcesMiss reports whether the command must be a cache miss because it pulls its base images and the pull policy
+// is "miss" - the intent of --pull is to build on the current base images, which a retag of an older build may not be
+func pullForcesMiss(rememberOptions configuration.RememberSubcommandOptions, parsedCommand configuration.ParsedCommand) bool {
+	if rememberOptions.PullPolicy != configuration.PullPolicyMiss || !parsedCommand.Pulls {
+		return false
+	}
+	slog.Info("The command pulls its base images, treating it as a cache miss", "reason", "--pull-policy "+configuration.PullPolicyMiss)
+	return true
+}
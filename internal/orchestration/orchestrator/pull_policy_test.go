@@ -0,0 +1,49 @@
+package orchestrator
+
+import (
+	"testing"
+
+	"github.com/hytromo/mimosa/internal/configuration"
+	"github.com/stretchr/testify/assert"
+)
+
+var pullCommand = []string{"docker", "buildx", "build", "--push", "--pull", "-t", "myreg1/myimage:v1", "."}
+
+func TestRun_PullPolicyMiss_RebuildsCommandsThatPull(t *testing.T) {
+	rememberOptions := configuration.RememberSubcommandOptions{Enabled: true, CommandToRun: pullCommand, PullPolicy: configuration.PullPolicyMiss}
+	mockActions := &MockActions{}
+	parsedCommand := configuration.ParsedCommand{
+		Hash:         TestHash,
+		Command:      pullCommand,
+		TagsByTarget: map[string][]string{"default": {"myreg1/myimage:v1"}},
+		Pulls:        true,
+	}
+
+	mockActions.On("ParseCommand", pullCommand).Return(parsedCommand, nil)
+	mockActions.On("RunCommand", false, pullCommand, cacheMissEnv(TestHash)).Return(0)
+	// the fresh build still saves its cache tags, for the commands that do not pull
+	mockActions.On("SaveRegistryCacheTags", TestHash, parsedCommand.TagsByTarget, false).Return(nil)
+
+	err := HandleRememberSubcommand(rememberOptions, mockActions)
+
+	assert.NoError(t, err)
+	mockActions.AssertExpectations(t)
+	mockActions.AssertNotCalled(t, "CheckRegistryCacheExists")
+}
+
+func TestPullForcesMiss(t *testing.T) {
+	pulling := configuration.ParsedCommand{Pulls: true}
+	missPolicy := configuration.RememberSubcommandOptions{PullPolicy: configuration.PullPolicyMiss}
+
+	assert.True(t, pullForcesMiss(missPolicy, pulling))
+	assert.False(t, pullForcesMiss(missPolicy, configuration.ParsedCommand{}))
+	assert.False(t, pullForcesMiss(configuration.RememberSubcommandOptions{}, pulling), "--pull does not affect the cache by default")
+	assert.False(t, pullForcesMiss(configuration.RememberSubcommandOptions{PullPolicy: configuration.PullPolicyResolve}, pulling))
+}
+
+func TestValidatePullPolicy(t *testing.T) {
+	assert.NoError(t, validatePullPolicy(""))
+	assert.NoError(t, validatePullPolicy(configuration.PullPolicyMiss))
+	assert.NoError(t, validatePullPolicy(configuration.PullPolicyResolve))
+	assert.ErrorContains(t, validatePullPolicy("always"), "invalid pull policy")
+}
@@ -0,0 +1,88 @@
+package orchestrator
+
+import (
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+
+	"github.com/hytromo/mimosa/internal/cacher"
+	"github.com/hytromo/mimosa/internal/configuration"
+	"github.com/hytromo/mimosa/internal/hasher"
+	"github.com/hytromo/mimosa/internal/logger"
+	"github.com/hytromo/mimosa/internal/orchestration/actions"
+	"github.com/hytromo/mimosa/internal/reporting"
+)
+
+// parseAndHashRecordingBreakdowns is parseAndHashCommandBefore that also returns the hash breakdowns of the builds of
+// the command, when they are needed to analyze its rebuild
+func parseAndHashRecordingBreakdowns(rememberOptions configuration.RememberSubcommandOptions, act actions.Actions, commandToRun []string) (configuration.ParsedCommand, []hasher.HashBreakdown, error) {
+	if !rememberOptions.AnalyzeRebuilds {
+		parsedCommand, err := parseAndHashCommandBefore(hashDeadline(rememberOptions), rememberOptions, act, commandToRun)
+		return parsedCommand, nil, err
+	}
+
+	hasher.RecordBreakdowns()
+	parsedCommand, err := parseAndHashCommandBefore(hashDeadline(rememberOptions), rememberOptions, act, commandToRun)
+	return parsedCommand, hasher.StopRecordingBreakdowns(), err
+}
+
+// analyzeRebuild checks, after a cache miss was built and pushed, whether the build was a no-op: an image with the same
+// digest was already pushed by a build of a different hash, so the hash changed because of inputs that do not affect
+// the image. The inputs that differ between the two builds are logged and written to the audit log.
+// The inputs of this build are then recorded for the next builds to compare with (unless the cache is read-only) - a
+// failure does not fail the build
+func analyzeRebuild(rememberOptions configuration.RememberSubcommandOptions, act actions.Actions, parsedCommand configuration.ParsedCommand, breakdowns []hasher.HashBreakdown) {
+	// nothing is pushed during a dry run, nor by local-only builds
+	if !rememberOptions.AnalyzeRebuilds || rememberOptions.DryRun || parsedCommand.Local {
+		return
+	}
+
+	// the first tag of each target is enough, all of its tags point to the same image
+	tags := []string{}
+	for _, target := range slices.Sorted(maps.Keys(parsedCommand.TagsByTarget)) {
+		if targetTags := parsedCommand.TagsByTarget[target]; len(targetTags) > 0 {
+			tags = append(tags, targetTags[0])
+		}
+	}
+	if len(tags) == 0 {
+		return
+	}
+
+	digests, err := act.TagDigests(parsedCommand.DockerConfigDir, tags)
+	if err != nil {
+		slog.Warn("Failed to resolve the pushed images, not analyzing the rebuild", "error", err)
+		return
+	}
+
+	inputs := cacher.BuildInputs{Hash: parsedCommand.Hash, Breakdowns: breakdowns}
+	for _, tag := range tags {
+		digest := digests[tag]
+		recorded, found, err := act.RecordedBuildInputs(parsedCommand.DockerConfigDir, tag, digest)
+		if err != nil {
+			slog.Warn("Failed to read the inputs of the earlier builds of the image", "tag", tag, "digest", digest, "error", err)
+		} else if found && recorded.Hash != parsedCommand.Hash {
+			reportNoopRebuild(tag, digest, recorded, inputs)
+		}
+
+		if rememberOptions.NoWrite {
+			continue
+		}
+		if err := act.RecordBuildInputs(parsedCommand.DockerConfigDir, tag, digest, inputs); err != nil {
+			slog.Warn("Failed to record the inputs of the build", "tag", tag, "digest", digest, "error", err)
+		}
+	}
+}
+
+// reportNoopRebuild logs the inputs that made the hash of a build differ from the hash of the earlier build that
+// pushed the same image
+func reportNoopRebuild(tag string, digest string, earlier cacher.BuildInputs, current cacher.BuildInputs) {
+	differences := diffBreakdowns(earlier.Breakdowns, current.Breakdowns)
+	slog.Warn("The build pushed the same image as an earlier build of a different hash, the hash is stricter than the image", "tag", tag, "digest", digest, "earlierHash", earlier.Hash, "hash", current.Hash)
+
+	logger.CleanLog.Info(fmt.Sprintf("mimosa-noop-rebuild: %s (%s) was already built by hash %s, this hash is %s - A is the earlier build, B this one:", tag, digest, earlier.Hash, current.Hash))
+	for _, line := range differences {
+		logger.CleanLog.Info("  " + line)
+	}
+	reporting.Audit(reporting.AuditNoopRebuild, "tag", tag, "digest", digest, "earlierHash", earlier.Hash, "hash", current.Hash, "differences", differences)
+}
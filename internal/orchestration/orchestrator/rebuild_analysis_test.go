@@ -0,0 +1,93 @@
+package orchestrator
+
+import (
+	"testing"
+
+	"github.com/hytromo/mimosa/internal/cacher"
+	"github.com/hytromo/mimosa/internal/configuration"
+	"github.com/hytromo/mimosa/internal/hasher"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+const rebuildDigest = "sha256:1111111111111111111111111111111111111111111111111111111111111111"
+
+func rebuildBreakdowns(buildArg string, hash string) []hasher.HashBreakdown {
+	return []hasher.HashBreakdown{{
+		Name:        "default",
+		Command:     []string{"docker", "build", "--build-arg", buildArg, "."},
+		CommandHash: buildArg,
+		Files:       map[string]string{"Dockerfile": "1234"},
+		FilesHash:   "1234",
+		Hash:        hash,
+	}}
+}
+
+func TestAnalyzeRebuild_NoopRebuild(t *testing.T) {
+	rememberOptions := configuration.RememberSubcommandOptions{Enabled: true, AnalyzeRebuilds: true}
+	mockActions := &MockActions{}
+	parsedCommand := configuration.ParsedCommand{
+		Hash:         TestHash,
+		TagsByTarget: map[string][]string{"default": {"myreg1/myimage:v2", "myreg1/myimage:latest"}},
+	}
+	breakdowns := rebuildBreakdowns("BUILD_ID=2", TestHash)
+	earlier := cacher.BuildInputs{Hash: "earlier-hash", Breakdowns: rebuildBreakdowns("BUILD_ID=1", "earlier-hash")}
+
+	mockActions.On("TagDigests", []string{"myreg1/myimage:v2"}).Return(map[string]string{"myreg1/myimage:v2": rebuildDigest}, nil)
+	mockActions.On("RecordedBuildInputs", "myreg1/myimage:v2", rebuildDigest).Return(earlier, true, nil)
+	mockActions.On("RecordBuildInputs", "myreg1/myimage:v2", rebuildDigest, cacher.BuildInputs{Hash: TestHash, Breakdowns: breakdowns}).Return(nil)
+
+	analyzeRebuild(rememberOptions, mockActions, parsedCommand, breakdowns)
+
+	mockActions.AssertExpectations(t)
+	assert.Equal(t, []string{
+		"build default: differs",
+		"  command differs:",
+		"    only in A: BUILD_ID=1",
+		"    only in B: BUILD_ID=2",
+	}, diffBreakdowns(earlier.Breakdowns, breakdowns))
+}
+
+func TestAnalyzeRebuild_FirstBuildOfTheImage(t *testing.T) {
+	rememberOptions := configuration.RememberSubcommandOptions{Enabled: true, AnalyzeRebuilds: true}
+	mockActions := &MockActions{}
+	parsedCommand := configuration.ParsedCommand{Hash: TestHash, TagsByTarget: map[string][]string{"default": {"myreg1/myimage:v1"}}}
+
+	mockActions.On("TagDigests", []string{"myreg1/myimage:v1"}).Return(map[string]string{"myreg1/myimage:v1": rebuildDigest}, nil)
+	mockActions.On("RecordedBuildInputs", "myreg1/myimage:v1", rebuildDigest).Return(cacher.BuildInputs{}, false, nil)
+	mockActions.On("RecordBuildInputs", "myreg1/myimage:v1", rebuildDigest, mock.Anything).Return(nil)
+
+	analyzeRebuild(rememberOptions, mockActions, parsedCommand, nil)
+
+	mockActions.AssertExpectations(t)
+}
+
+func TestAnalyzeRebuild_SkippedWithoutTheOptionOrOnDryRun(t *testing.T) {
+	mockActions := &MockActions{}
+	parsedCommand := configuration.ParsedCommand{Hash: TestHash, TagsByTarget: map[string][]string{"default": {"myreg1/myimage:v1"}}}
+
+	analyzeRebuild(configuration.RememberSubcommandOptions{Enabled: true}, mockActions, parsedCommand, nil)
+	analyzeRebuild(configuration.RememberSubcommandOptions{Enabled: true, AnalyzeRebuilds: true, DryRun: true}, mockActions, parsedCommand, nil)
+
+	mockActions.AssertNotCalled(t, "TagDigests", mock.Anything)
+}
+
+func TestRemember_AnalyzeRebuilds_AfterCacheMiss(t *testing.T) {
+	command := []string{"docker", "build", "--push", "-t", "myreg1/myimage:v1", "."}
+	rememberOptions := configuration.RememberSubcommandOptions{Enabled: true, CommandToRun: command, AnalyzeRebuilds: true}
+	mockActions := &MockActions{}
+	parsedCommand := configuration.ParsedCommand{Hash: TestHash, Command: command, TagsByTarget: map[string][]string{"default": {"myreg1/myimage:v1"}}}
+
+	mockActions.On("ParseCommand", command).Return(parsedCommand, nil)
+	mockActions.On("CheckRegistryCacheExists", TestHash, parsedCommand.TagsByTarget).Return(false, nil, nil)
+	mockActions.On("RunCommand", false, command, cacheMissEnv(TestHash)).Return(0)
+	mockActions.On("SaveRegistryCacheTags", TestHash, parsedCommand.TagsByTarget, false).Return(nil)
+	mockActions.On("TagDigests", []string{"myreg1/myimage:v1"}).Return(map[string]string{"myreg1/myimage:v1": rebuildDigest}, nil)
+	mockActions.On("RecordedBuildInputs", "myreg1/myimage:v1", rebuildDigest).Return(cacher.BuildInputs{}, false, nil)
+	mockActions.On("RecordBuildInputs", "myreg1/myimage:v1", rebuildDigest, mock.Anything).Return(nil)
+
+	err := HandleRememberSubcommand(rememberOptions, mockActions)
+
+	assert.NoError(t, err)
+	mockActions.AssertExpectations(t)
+}
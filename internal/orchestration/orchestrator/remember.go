@@ -1,14 +1,20 @@
 package orchestrator
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
 	"log/slog"
 
+	"github.com/docker/go-units"
+	"github.com/hytromo/mimosa/internal/cacher"
 	"github.com/hytromo/mimosa/internal/configuration"
+	"github.com/hytromo/mimosa/internal/docker"
+	"github.com/hytromo/mimosa/internal/hasher"
 	"github.com/hytromo/mimosa/internal/logger"
 	"github.com/hytromo/mimosa/internal/orchestration/actions"
 )
@@ -17,6 +23,7 @@ import (
 // This is true if:
 // - --push flag exists
 // - --output type=registry,... exists (or -o type=registry,...)
+// - --output type=image,...,push=true exists
 func hasPushFlag(command []string) bool {
 	for i, arg := range command {
 		if arg == "--push" {
@@ -24,13 +31,13 @@ func hasPushFlag(command []string) bool {
 		}
 		// Check for --output type=registry or -o type=registry (space-separated)
 		if arg == "--output" || arg == "-o" {
-			if i+1 < len(command) && strings.Contains(command[i+1], "type=registry") {
+			if i+1 < len(command) && docker.OutputPushes(command[i+1]) {
 				return true
 			}
 		}
 		// Check for --output=type=registry or -o=type=registry (equals format)
-		if strings.HasPrefix(arg, "--output=") || strings.HasPrefix(arg, "-o=") {
-			if strings.Contains(arg, "type=registry") {
+		for _, prefix := range []string{"--output=", "-o="} {
+			if value, ok := strings.CutPrefix(arg, prefix); ok && docker.OutputPushes(value) {
 				return true
 			}
 		}
@@ -38,6 +45,142 @@ func hasPushFlag(command []string) bool {
 	return false
 }
 
+const (
+	// exported to the command of a cache miss, so that the build (or the scripts it runs) can tell why it runs
+	cacheDecisionEnv = "MIMOSA_CACHE_DECISION"
+	hashEnv          = "MIMOSA_HASH"
+)
+
+// cacheMissEnv returns the environment variables of the command run on a cache miss
+func cacheMissEnv(hash string) []string {
+	return []string{cacheDecisionEnv + "=miss", hashEnv + "=" + hash}
+}
+
+// errNoPush is returned for docker commands that do not push to a registry, which cannot be cached
+var errNoPush = errors.New("--push flag not found, skipping caching behavior and running command directly")
+
+// errNoDaemon is returned for local-only builds when there is no docker daemon to cache their images in
+var errNoDaemon = errors.New("no docker daemon answers, local images cannot be cached when running registry-only")
+
+func isDockerCommand(command []string) bool {
+	return len(command) > 0 && command[0] == "docker"
+}
+
+// hashingOptions returns the options that every command of the run is hashed with
+func hashingOptions(rememberOptions configuration.RememberSubcommandOptions) (hasher.Options, error) {
+	algorithm, err := hasher.ParseFileHashAlgorithm(rememberOptions.HashAlgorithm)
+	if err != nil {
+		return hasher.Options{}, err
+	}
+	infraFlags, err := hasher.ParseInfrastructureFlags(rememberOptions.IgnoreInfraFlags, rememberOptions.InfraFlags)
+	if err != nil {
+		return hasher.Options{}, err
+	}
+	if err := validatePullPolicy(rememberOptions.PullPolicy); err != nil {
+		return hasher.Options{}, err
+	}
+	return hasher.Options{
+		FileHashAlgorithm:    algorithm,
+		AggressiveNormalize:  rememberOptions.AggressiveNormalize,
+		InfrastructureFlags:  infraFlags,
+		WorkspaceRoot:        workspaceRoot(),
+		HashBaseImages:       rememberOptions.HashBaseImages,
+		HashBaseImagesOnPull: rememberOptions.PullPolicy == configuration.PullPolicyResolve,
+		BakePlan:             rememberOptions.BakePlan,
+	}, nil
+}
+
+// configureHashing validates the hashing options that every command is hashed with (see hashingOptions), and applies
+// the settings that are shared by all the builds of a run without affecting their hashes: the cache tags they are
+// looked up and saved under, and the context size warning
+func configureHashing(rememberOptions configuration.RememberSubcommandOptions) error {
+	if _, err := hashingOptions(rememberOptions); err != nil {
+		return err
+	}
+
+	scope, err := cacheScope(rememberOptions)
+	if err != nil {
+		return err
+	}
+	cacher.SetCacheScope(scope)
+	cacher.SetDatedCacheTags(rememberOptions.DatedCacheTags)
+	cacher.SetReadOnly(rememberOptions.NoWrite)
+	if err := cacher.SetRequireSignedCache(rememberOptions.RequireSignedCache); err != nil {
+		return err
+	}
+	if err := docker.SetCacheTagPrefix(rememberOptions.CacheTagPrefix); err != nil {
+		return err
+	}
+	if err := docker.SetCacheRepository(rememberOptions.CacheRepository); err != nil {
+		return err
+	}
+
+	contextSizeWarning := int64(hasher.DefaultContextSizeWarning)
+	if rememberOptions.ContextSizeWarning != "" {
+		size, err := units.FromHumanSize(rememberOptions.ContextSizeWarning)
+		if err != nil {
+			return fmt.Errorf("invalid context size warning: %w", err)
+		}
+		contextSizeWarning = size
+	}
+	hasher.SetContextSizeWarning(contextSizeWarning)
+
+	return nil
+}
+
+// parseAndHashCommand parses the command and calculates its final hash, skipping the files left once ctx is done - the
+// returned parsed command always contains the command to run in case of an error
+func parseAndHashCommand(ctx context.Context, rememberOptions configuration.RememberSubcommandOptions, act actions.Actions, commandToRun []string) (configuration.ParsedCommand, error) {
+	if rememberOptions.Shell {
+		return parseAndHashShellScript(ctx, rememberOptions, act, commandToRun)
+	}
+
+	// non-docker commands can only be cached through registered parsers, which guarantee that the command pushes
+	if isDockerCommand(commandToRun) && !hasPushFlag(commandToRun) {
+		if docker.LoadsLocally(commandToRun) && !rememberOptions.RequirePush {
+			// local-only builds are cached in the local docker daemon instead of the registry
+			if !act.DockerDaemonAvailable(commandToRun) {
+				return configuration.ParsedCommand{Command: commandToRun}, errNoDaemon
+			}
+			parsedCommand, err := hashCommand(ctx, rememberOptions, act, commandToRun)
+			parsedCommand.Local = true
+			return parsedCommand, err
+		}
+		// unsafe to continue without a --push flag, because command success does not guarantee that the tags were pushed to the registry
+		return configuration.ParsedCommand{Command: commandToRun}, errNoPush
+	}
+
+	return hashCommand(ctx, rememberOptions, act, commandToRun)
+}
+
+// hashCommand parses and hashes the command, including the builder when asked to
+func hashCommand(ctx context.Context, rememberOptions configuration.RememberSubcommandOptions, act actions.Actions, commandToRun []string) (configuration.ParsedCommand, error) {
+	options, err := hashingOptions(rememberOptions)
+	if err != nil {
+		return configuration.ParsedCommand{Command: commandToRun}, err
+	}
+	options.Context = ctx
+
+	logger.Progress.Phase("parsing command")
+	parsedCommand, err := act.ParseCommand(commandToRun, options)
+
+	if err != nil {
+		return parsedCommand, err
+	}
+
+	if rememberOptions.HashBuilder {
+		// builders with different drivers/buildkit versions can produce different artifacts for the same command
+		builderSummary, err := act.InspectBuilder(parsedCommand.Command)
+		if err != nil {
+			return parsedCommand, err
+		}
+		slog.Debug("Including builder in the hash", "builder", builderSummary)
+		parsedCommand.Hash = hasher.HashStrings([]string{parsedCommand.Hash, builderSummary})
+	}
+
+	return parsedCommand, nil
+}
+
 func HandleRememberSubcommand(rememberOptions configuration.RememberSubcommandOptions, act actions.Actions) error {
 	if !rememberOptions.Enabled {
 		return errors.New("remember subcommand must be enabled")
@@ -47,71 +190,208 @@ func HandleRememberSubcommand(rememberOptions configuration.RememberSubcommandOp
 	retagOnly := rememberOptions.RetagOnly
 	commandToRun := rememberOptions.GetCommandToRun()
 
-	if !hasPushFlag(commandToRun) {
-		// unsafe to continue without a --push flag, because command success does not guarantee that the tags were pushed to the registry
-		err := errors.New("--push flag not found, skipping caching behavior and running command directly")
+	if cachingDisabled() {
+		runWithoutCaching(disableEnv+" is set", dryRun, retagOnly, act, commandToRun)
+		return nil
+	}
+
+	rollout, err := rolloutPercentage()
+	if err != nil {
 		fallbackToSimpleCommandExecution(err, dryRun, retagOnly, act, commandToRun)
 		return err
 	}
 
-	parsedCommand, err := act.ParseCommand(commandToRun)
+	if err := configureHashing(rememberOptions); err != nil {
+		fallbackToSimpleCommandExecution(err, dryRun, retagOnly, act, commandToRun)
+		return err
+	}
+
+	if err := validatePushVerification(rememberOptions); err != nil {
+		fallbackToSimpleCommandExecution(err, dryRun, retagOnly, act, commandToRun)
+		return err
+	}
 
+	if _, err := hitTagTemplate(rememberOptions.HitTagTemplate); err != nil {
+		fallbackToSimpleCommandExecution(err, dryRun, retagOnly, act, commandToRun)
+		return err
+	}
+
+	parsedCommand, breakdowns, err := parseAndHashRecordingBreakdowns(rememberOptions, act, commandToRun)
+	if errors.Is(err, errNoPush) && rememberOptions.RequirePush {
+		slog.Error("The command does not push to a registry (--push or --output type=registry), not running it because of --require-push", "command", commandToRun)
+		logger.Progress.Done()
+		act.ExitProcessWithCode(1)
+		return err
+	}
 	if err != nil {
 		fallbackToSimpleCommandExecution(err, dryRun, retagOnly, act, parsedCommand.Command)
 		return err
 	}
 
 	slog.Debug("Final calculated command hash", "hash", parsedCommand.Hash)
+	auditHash(parsedCommand)
+
+	if parsedCommand.OutputTagsByTarget, err = outputTagsByTarget(rememberOptions.OutputTags, parsedCommand); err != nil {
+		slog.Error("Invalid output tags, not running the command", "error", err)
+		logger.Progress.Done()
+		act.ExitProcessWithCode(1)
+		return err
+	}
+
+	if !inRollout(parsedCommand.Hash, rollout) {
+		runWithoutCaching(fmt.Sprintf("not in the %d%% %s", rollout, rolloutEnv), dryRun, retagOnly, act, parsedCommand.Command)
+		return nil
+	}
+	if rollout < 100 {
+		slog.Info("Using the cache", "reason", fmt.Sprintf("in the %d%% %s", rollout, rolloutEnv))
+	}
 
 	// Registry-based cache
-	exists, cacheTagsByTarget, err := act.CheckRegistryCacheExists(parsedCommand.Hash, parsedCommand.TagsByTarget)
+	logger.Progress.Phase("checking registry cache")
+	exists, cacheTagsByTarget, err := checkCache(rememberOptions, act, parsedCommand)
 	if err != nil {
 		slog.Warn("Error checking registry cache, falling back to command execution", "error", err)
 		fallbackToSimpleCommandExecution(err, dryRun, retagOnly, act, parsedCommand.Command)
 		return err
 	}
 
-	cacheHit := exists
+	cacheHit := exists && cachedImagesMatch(act, parsedCommand, cacheTagsByTarget)
+	if !cacheHit && !rememberOptions.RetagOnly {
+		cacheHit, cacheTagsByTarget = waitForCache(rememberOptions, act, parsedCommand)
+	}
 
 	if cacheHit {
 		// Retag from cache tags to requested tags (each pair is cache tag -> new tag in the SAME repository)
-		err = act.RetagFromCacheTags(cacheTagsByTarget, dryRun)
+		logger.Progress.Phase("retagging from cache")
+		if cacheTagsByTarget, err = withOutputTags(parsedCommand, cacheTagsByTarget); err == nil {
+			cacheTagsByTarget, err = withHitTagTemplate(rememberOptions, &parsedCommand, cacheTagsByTarget)
+		}
+		if err != nil {
+			slog.Error("Cannot create the output tags from the cache", "error", err)
+			logger.Progress.Done()
+			act.ExitProcessWithCode(1)
+			return err
+		}
+		if err := checkPushPermission(act, parsedCommand, cacheTagsByTarget, dryRun); err != nil {
+			slog.Error("Cannot push the cached images to the requested tags, check the registry credentials", "error", err)
+			logger.Progress.Done()
+			act.ExitProcessWithCode(1)
+			return err
+		}
+		err = retagFromCache(act, parsedCommand, cacheTagsByTarget, dryRun)
 		if err != nil {
 			fallbackToSimpleCommandExecution(err, dryRun, retagOnly, act, parsedCommand.Command)
 			return err
 		}
+		writeCacheHitOutputs(act, parsedCommand, cacheTagsByTarget, dryRun)
+		writeDigestMap(rememberOptions.DigestMapFile, act, dryRun, parsedCommand)
+		printHitMarkers(rememberOptions.HitMarker, parsedCommand)
+		reportBuilds(dryRun, buildRecord(parsedCommand, true, 0))
+		recordSavings(dryRun, savingsEntry(parsedCommand, true, 0))
 	} else if rememberOptions.RetagOnly {
 		// Retag-only mode: on cache miss do not build or save cache; just report cache miss and exit 0
 		// so the workflow can run a real build step.
 	} else {
 		// Run command
-		exitCode := act.RunCommand(dryRun, parsedCommand.Command)
+		logger.Progress.Phase("cache miss - running command")
+		logger.Progress.Done()
+		buildStart := time.Now()
+		exitCode, saveCacheTags := runCacheMissCommand(rememberOptions, act, parsedCommand)
+		buildDuration := time.Since(buildStart)
 
 		if exitCode != 0 {
 			// not saving cache if command fails
+			withdrawAnnouncement(rememberOptions, act, parsedCommand)
 			act.ExitProcessWithCode(exitCode)
 			return errors.New("error running command - exit code: " + strconv.Itoa(exitCode))
 		}
 
 		// After successful build, create cache tags
-		err = act.SaveRegistryCacheTags(parsedCommand.Hash, parsedCommand.TagsByTarget, dryRun)
-		if err != nil {
-			slog.Warn("Failed to save registry cache tags", "error", err)
-			// Don't fail the command if cache tag creation fails
+		if saveCacheTags {
+			logger.Progress.Phase("saving registry cache tags")
+			err = saveCommandCacheTags(rememberOptions, act, parsedCommand)
+			if err != nil {
+				slog.Warn("Failed to save registry cache tags", "error", err)
+				// Don't fail the command if cache tag creation fails
+				withdrawAnnouncement(rememberOptions, act, parsedCommand)
+			}
+			analyzeRebuild(rememberOptions, act, parsedCommand, breakdowns)
+			if err := publishOutputTags(act, parsedCommand, dryRun); err != nil {
+				slog.Error("Failed to create the output tags from the pushed tags", "error", err)
+				act.ExitProcessWithCode(1)
+				return err
+			}
+			writeDigestMap(rememberOptions.DigestMapFile, act, dryRun, parsedCommand)
+			reportBuilds(dryRun, buildRecord(parsedCommand, false, buildDuration))
+			recordSavings(dryRun, savingsEntry(parsedCommand, false, buildDuration))
 		}
 	}
 
+	logger.Progress.Done()
 	logger.CleanLog.Info(fmt.Sprintf("mimosa-cache-hit: %t", cacheHit))
+	writeDotenv(rememberOptions.DotenvFile, cacheHit, parsedCommand.Hash)
+	writeGitHubOutput(rememberOptions.GitHubOutputFile, cacheHit, parsedCommand)
+	writeGitHubStepSummary(rememberOptions.GitHubStepSummaryFile, cacheHit, rememberOptions.RetagOnly, parsedCommand)
 
 	return nil
 }
 
+// cachedImagesMatch reports whether the cached images are what the command asks for: built for its platforms and
+// holding its attestations
+func cachedImagesMatch(act actions.Actions, parsedCommand configuration.ParsedCommand, cacheTagsByTarget map[string][]cacher.CacheTagPair) bool {
+	return cachedPlatformsMatch(act, parsedCommand, cacheTagsByTarget) && cachedAttestationsMatch(act, parsedCommand, cacheTagsByTarget)
+}
+
+// cachedAttestationsMatch reports whether the cached images hold all the attestations that the command asks for - a
+// builder that does not support attestations builds the same command without them, so the hash alone does not tell
+func cachedAttestationsMatch(act actions.Actions, parsedCommand configuration.ParsedCommand, cacheTagsByTarget map[string][]cacher.CacheTagPair) bool {
+	// images of the local docker daemon have no attestations
+	if len(parsedCommand.AttestationsByTarget) == 0 || parsedCommand.Local {
+		return true
+	}
+	if err := act.VerifyCachedAttestations(parsedCommand.DockerConfigDir, cacheTagsByTarget, parsedCommand.AttestationsByTarget); err != nil {
+		slog.Warn("The cached images do not hold the requested attestations, treating it as a cache miss", "error", err)
+		return false
+	}
+	return true
+}
+
+// cachedPlatformsMatch reports whether the cached images are built for all the platforms that the command asks for -
+// if they are not, or this cannot be checked, the cache tags are not used
+func cachedPlatformsMatch(act actions.Actions, parsedCommand configuration.ParsedCommand, cacheTagsByTarget map[string][]cacher.CacheTagPair) bool {
+	// the local docker daemon only has images of its own platform
+	if len(parsedCommand.PlatformsByTarget) == 0 || parsedCommand.Local {
+		return true
+	}
+	if err := act.VerifyCachedPlatforms(parsedCommand.DockerConfigDir, cacheTagsByTarget, parsedCommand.PlatformsByTarget); err != nil {
+		slog.Warn("The cached images do not match the requested platforms, treating it as a cache miss", "error", err)
+		return false
+	}
+	return true
+}
+
+// writeCacheHitOutputs writes the --iidfile/--metadata-file that the skipped build would have written, if the command
+// asks for them - failing to do so does not fail the command, the images are already retagged
+func writeCacheHitOutputs(act actions.Actions, parsedCommand configuration.ParsedCommand, cacheTagsByTarget map[string][]cacher.CacheTagPair, dryRun bool) {
+	if docker.OutputFilesFromCommand(parsedCommand.Command).Empty() {
+		return
+	}
+	if parsedCommand.Local {
+		slog.Warn("The build output files are not written for local images served from the cache", "files", docker.OutputFilesFromCommand(parsedCommand.Command))
+		return
+	}
+	if err := act.WriteCacheHitOutputs(parsedCommand.Command, cacheTagsByTarget, dryRun); err != nil {
+		slog.Warn("Failed to write the build output files of the cached images", "error", err)
+	}
+}
+
 func fallbackToSimpleCommandExecution(err error, dryRun, retagOnly bool, act actions.Actions, commandToRun []string) {
 	if retagOnly {
 		return
 	}
 
 	slog.Error("Falling back to plain command execution", "command", commandToRun, "error", err.Error())
+	logger.Progress.Done()
 
 	exitCode := act.RunCommand(dryRun, commandToRun)
 
@@ -0,0 +1,36 @@
+package orchestrator
+
+import (
+	"slices"
+	"time"
+
+	"github.com/hytromo/mimosa/internal/configuration"
+	"github.com/hytromo/mimosa/internal/reporting"
+	"github.com/samber/lo"
+)
+
+// buildRecord returns the --report-url record of a build that hit or missed the cache
+func buildRecord(parsedCommand configuration.ParsedCommand, cacheHit bool, buildDuration time.Duration) reporting.Record {
+	return reporting.NewRecord(slices.Concat(lo.Values(parsedCommand.TagsByTarget)...), cacheHit, buildDuration)
+}
+
+// reportBuilds sends the records to --report-url - dry runs neither build nor retag, so they are not reported
+func reportBuilds(dryRun bool, records ...reporting.Record) {
+	if dryRun {
+		return
+	}
+	reporting.Send(records)
+}
+
+// savingsEntry returns the --savings-file entry of a build that hit or missed the cache
+func savingsEntry(parsedCommand configuration.ParsedCommand, cacheHit bool, buildDuration time.Duration) reporting.SavingsEntry {
+	return reporting.NewSavingsEntry(slices.Concat(lo.Values(parsedCommand.TagsByTarget)...), parsedCommand.Hash, cacheHit, buildDuration)
+}
+
+// recordSavings appends the entries to the savings file - dry runs are not recorded either
+func recordSavings(dryRun bool, entries ...reporting.SavingsEntry) {
+	if dryRun {
+		return
+	}
+	reporting.AppendSavings(entries)
+}
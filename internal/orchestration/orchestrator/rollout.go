@@ -0,0 +1,65 @@
+package orchestrator
+
+import (
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"github.com/hytromo/mimosa/internal/logger"
+	"github.com/hytromo/mimosa/internal/orchestration/actions"
+	"github.com/hytromo/mimosa/internal/utils/envutil"
+)
+
+const (
+	// any true value (1, true, yes) makes mimosa run the commands as is, without touching the cache
+	disableEnv = "MIMOSA_DISABLE"
+	// the percentage (0-100) of builds that use the cache, picked deterministically by their hash
+	rolloutEnv = "MIMOSA_ROLLOUT"
+)
+
+// cachingDisabled reports whether caching is switched off through MIMOSA_DISABLE
+func cachingDisabled() bool {
+	switch strings.ToLower(envutil.GetEnv(disableEnv, "")) {
+	case "1", "true", "yes", "on":
+		return true
+	}
+	return false
+}
+
+// rolloutPercentage returns the MIMOSA_ROLLOUT percentage - 100 when it is not set
+func rolloutPercentage() (int, error) {
+	value := strings.TrimSuffix(envutil.GetEnv(rolloutEnv, "100"), "%")
+	percentage, err := strconv.Atoi(value)
+	if err != nil || percentage < 0 || percentage > 100 {
+		return 0, fmt.Errorf("invalid %s value %q, must be a percentage between 0 and 100", rolloutEnv, value)
+	}
+	return percentage, nil
+}
+
+// inRollout decides whether the build with this hash uses the cache: the same build always gets the same decision,
+// so a build that was cached keeps being cached while the percentage only grows
+func inRollout(hash string, percentage int) bool {
+	if percentage >= 100 {
+		return true
+	}
+
+	bucket := fnv.New32a()
+	_, _ = bucket.Write([]byte(hash))
+	return int(bucket.Sum32()%100) < percentage
+}
+
+// runWithoutCaching runs the command as is (in retag-only mode it is not run at all - it is reported as a cache miss),
+// exiting with its exit code
+func runWithoutCaching(reason string, dryRun bool, retagOnly bool, act actions.Actions, commandToRun []string) {
+	slog.Info("Running the command without caching", "reason", reason)
+	logger.Progress.Done()
+
+	if retagOnly {
+		logger.CleanLog.Info("mimosa-cache-hit: false")
+		return
+	}
+
+	act.ExitProcessWithCode(act.RunCommand(dryRun, commandToRun))
+}
@@ -0,0 +1,135 @@
+package orchestrator
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/hytromo/mimosa/internal/configuration"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var rolloutCommand = []string{"docker", "buildx", "build", "--push", "-t", "myreg1/myimage:v1", "."}
+
+func TestCachingDisabled(t *testing.T) {
+	for value, disabled := range map[string]bool{"": false, "0": false, "false": false, "1": true, "true": true, "YES": true, "on": true} {
+		t.Setenv(disableEnv, value)
+		assert.Equal(t, disabled, cachingDisabled(), "value: %q", value)
+	}
+}
+
+func TestRolloutPercentage(t *testing.T) {
+	t.Setenv(rolloutEnv, "")
+	percentage, err := rolloutPercentage()
+	require.NoError(t, err)
+	assert.Equal(t, 100, percentage, "everything uses the cache by default")
+
+	t.Setenv(rolloutEnv, "25%")
+	percentage, err = rolloutPercentage()
+	require.NoError(t, err)
+	assert.Equal(t, 25, percentage)
+
+	for _, invalid := range []string{"half", "-1", "101"} {
+		t.Setenv(rolloutEnv, invalid)
+		_, err = rolloutPercentage()
+		assert.Error(t, err, "value: %q", invalid)
+	}
+}
+
+func TestInRollout(t *testing.T) {
+	inQuarter := 0
+	for i := range 1000 {
+		hash := fmt.Sprintf("hash-%d", i)
+		assert.False(t, inRollout(hash, 0))
+		assert.True(t, inRollout(hash, 100))
+		assert.Equal(t, inRollout(hash, 25), inRollout(hash, 25), "the decision is deterministic")
+		if inRollout(hash, 25) {
+			inQuarter++
+			assert.True(t, inRollout(hash, 50), "a cached build stays cached when the percentage grows")
+		}
+	}
+	assert.InDelta(t, 250, inQuarter, 60)
+}
+
+func TestRun_Disabled_RunsCommandAsIs(t *testing.T) {
+	t.Setenv(disableEnv, "1")
+	mockActions := &MockActions{}
+	mockActions.On("RunCommand", false, rolloutCommand).Return(3)
+	mockActions.On("ExitProcessWithCode", 3).Return()
+
+	err := HandleRememberSubcommand(configuration.RememberSubcommandOptions{Enabled: true, CommandToRun: rolloutCommand}, mockActions)
+
+	assert.NoError(t, err)
+	mockActions.AssertExpectations(t)
+	mockActions.AssertNotCalled(t, "ParseCommand")
+}
+
+func TestRun_Disabled_RetagOnlyDoesNotRunTheCommand(t *testing.T) {
+	t.Setenv(disableEnv, "true")
+	mockActions := &MockActions{}
+
+	err := HandleRememberSubcommand(configuration.RememberSubcommandOptions{Enabled: true, RetagOnly: true, CommandToRun: rolloutCommand}, mockActions)
+
+	assert.NoError(t, err)
+	mockActions.AssertNotCalled(t, "RunCommand")
+	mockActions.AssertNotCalled(t, "ParseCommand")
+}
+
+func TestRun_NotInRollout_RunsCommandAsIs(t *testing.T) {
+	t.Setenv(rolloutEnv, "0")
+	mockActions := &MockActions{}
+	parsedCommand := configuration.ParsedCommand{Hash: TestHash, Command: rolloutCommand, TagsByTarget: map[string][]string{"default": {"myreg1/myimage:v1"}}}
+
+	mockActions.On("ParseCommand", rolloutCommand).Return(parsedCommand, nil)
+	mockActions.On("RunCommand", false, rolloutCommand).Return(0)
+	mockActions.On("ExitProcessWithCode", 0).Return()
+
+	err := HandleRememberSubcommand(configuration.RememberSubcommandOptions{Enabled: true, CommandToRun: rolloutCommand}, mockActions)
+
+	assert.NoError(t, err)
+	mockActions.AssertExpectations(t)
+	mockActions.AssertNotCalled(t, "CheckRegistryCacheExists")
+	mockActions.AssertNotCalled(t, "SaveRegistryCacheTags")
+}
+
+func TestRun_InvalidRollout_Fallback(t *testing.T) {
+	t.Setenv(rolloutEnv, "most")
+	mockActions := &MockActions{}
+	mockActions.On("RunCommand", false, rolloutCommand).Return(0)
+	mockActions.On("ExitProcessWithCode", 0).Return()
+
+	err := HandleRememberSubcommand(configuration.RememberSubcommandOptions{Enabled: true, CommandToRun: rolloutCommand}, mockActions)
+
+	assert.Error(t, err)
+	mockActions.AssertExpectations(t)
+	mockActions.AssertNotCalled(t, "ParseCommand")
+}
+
+func TestRememberBatch_Disabled_RunsEverythingAsIs(t *testing.T) {
+	t.Setenv(disableEnv, "1")
+	mockActions := &MockActions{}
+	mockActions.On("RunCommand", false, batchHitCommand).Return(0)
+	mockActions.On("RunCommand", false, batchMissCommand).Return(0)
+
+	err := HandleRememberBatch(configuration.RememberSubcommandOptions{Enabled: true}, [][]string{batchHitCommand, batchMissCommand}, mockActions)
+
+	assert.NoError(t, err)
+	mockActions.AssertExpectations(t)
+	mockActions.AssertNotCalled(t, "ParseCommand")
+	mockActions.AssertNotCalled(t, "CheckRegistryCacheExists")
+}
+
+func TestRememberBatch_NotInRollout_RunsAsIs(t *testing.T) {
+	t.Setenv(rolloutEnv, "0")
+	mockActions := &MockActions{}
+	missParsed := batchParsedCommand(batchMissCommand, "hash-web", "myreg1/web:v1")
+	mockActions.On("ParseCommand", batchMissCommand).Return(missParsed, nil)
+	mockActions.On("RunCommand", false, batchMissCommand).Return(0)
+
+	err := HandleRememberBatch(configuration.RememberSubcommandOptions{Enabled: true}, [][]string{batchMissCommand}, mockActions)
+
+	assert.NoError(t, err)
+	mockActions.AssertExpectations(t)
+	mockActions.AssertNotCalled(t, "CheckRegistryCacheExists")
+	mockActions.AssertNotCalled(t, "SaveRegistryCacheTags")
+}
@@ -0,0 +1,57 @@
+package orchestrator
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hytromo/mimosa/internal/logger"
+	"github.com/hytromo/mimosa/internal/reporting"
+)
+
+// HandleSavingsSubcommand prints what the cache saved the builds recorded in the savings file, per repository, over
+// the last window (0 is all of the file)
+func HandleSavingsSubcommand(savingsFile string, window time.Duration) error {
+	entries, err := reporting.ReadSavings(savingsFile)
+	if err != nil {
+		return err
+	}
+
+	since := time.Time{}
+	if window > 0 {
+		since = time.Now().Add(-window)
+	}
+
+	for _, line := range savingsLines(reporting.SummarizeSavings(entries, since)) {
+		logger.CleanLog.Info(line)
+	}
+	return nil
+}
+
+// savingsLines returns a line per summary and a line with the totals
+func savingsLines(summaries []reporting.SavingsSummary) []string {
+	lines := []string{}
+	total := reporting.SavingsSummary{}
+	for _, summary := range summaries {
+		lines = append(lines, savingsLine(strings.Join(summary.Repositories, ", "), summary))
+		total.Hits += summary.Hits
+		total.Misses += summary.Misses
+		total.BuildSeconds += summary.BuildSeconds
+		total.SavedSeconds += summary.SavedSeconds
+		total.HitsWithoutDuration += summary.HitsWithoutDuration
+	}
+	return append(lines, savingsLine("total", total))
+}
+
+func savingsLine(name string, summary reporting.SavingsSummary) string {
+	line := fmt.Sprintf("%s: %d hits, %d misses, built for %s, saved %s", name, summary.Hits, summary.Misses,
+		secondsDuration(summary.BuildSeconds), secondsDuration(summary.SavedSeconds))
+	if summary.HitsWithoutDuration > 0 {
+		line += fmt.Sprintf(" (%d hits of unknown duration)", summary.HitsWithoutDuration)
+	}
+	return line
+}
+
+func secondsDuration(seconds float64) time.Duration {
+	return (time.Duration(seconds * float64(time.Second))).Round(time.Second)
+}
@@ -0,0 +1,21 @@
+package orchestrator
+
+import (
+	"testing"
+
+	"github.com/hytromo/mimosa/internal/reporting"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSavingsLines(t *testing.T) {
+	lines := savingsLines([]reporting.SavingsSummary{
+		{Repositories: []string{"myreg/app", "myreg/app-debug"}, Hits: 3, Misses: 1, BuildSeconds: 120, SavedSeconds: 360},
+		{Repositories: []string{"myreg/web"}, Hits: 1, HitsWithoutDuration: 1},
+	})
+
+	assert.Equal(t, []string{
+		"myreg/app, myreg/app-debug: 3 hits, 1 misses, built for 2m0s, saved 6m0s",
+		"myreg/web: 1 hits, 0 misses, built for 0s, saved 0s (1 hits of unknown duration)",
+		"total: 4 hits, 1 misses, built for 2m0s, saved 6m0s (1 hits of unknown duration)",
+	}, lines)
+}
@@ -0,0 +1,98 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/hytromo/mimosa/internal/configuration"
+	"github.com/hytromo/mimosa/internal/docker"
+	"github.com/hytromo/mimosa/internal/orchestration/actions"
+	"github.com/samber/lo"
+)
+
+// ShellCommand returns the command that runs the script of remember --shell
+func ShellCommand(script string) []string {
+	return []string{"sh", "-c", script}
+}
+
+// isDockerBuildCommand checks if the command is a docker build, buildx build or buildx bake command (or an alias of them)
+func isDockerBuildCommand(command []string) bool {
+	_, command = docker.SplitGlobalFlags(command)
+	command = docker.CanonicalBuildCommand(command)
+	if len(command) < 2 || command[0] != "docker" {
+		return false
+	}
+	return command[1] == "build" || (len(command) > 2 && command[1] == "buildx" && (command[2] == "build" || command[2] == "bake"))
+}
+
+// pushedByScript returns the references pushed by the "docker push" (or "docker image push") commands of the script
+func pushedByScript(commands [][]string) []string {
+	pushed := []string{}
+	for _, command := range commands {
+		_, command = docker.SplitGlobalFlags(command)
+		var args []string
+		switch {
+		case len(command) > 2 && command[0] == "docker" && command[1] == "push":
+			args = command[2:]
+		case len(command) > 3 && command[0] == "docker" && command[1] == "image" && command[2] == "push":
+			args = command[3:]
+		default:
+			continue
+		}
+
+		for i := 0; i < len(args); i++ {
+			if args[i] == "--platform" {
+				i++
+				continue
+			}
+			if args[i] == "-a" || args[i] == "--all-tags" {
+				// the tags that are pushed are not known in advance
+				break
+			}
+			if len(args[i]) > 0 && args[i][0] != '-' {
+				pushed = append(pushed, args[i])
+			}
+		}
+	}
+	return pushed
+}
+
+// parseAndHashShellScript hashes the first docker build command of the script of remember --shell. The script is
+// cacheable when the build pushes its tags itself, or when "docker push" commands of the script push all of them
+func parseAndHashShellScript(ctx context.Context, rememberOptions configuration.RememberSubcommandOptions, act actions.Actions, commandToRun []string) (configuration.ParsedCommand, error) {
+	parsedCommand := configuration.ParsedCommand{Command: commandToRun}
+	if len(commandToRun) != 3 {
+		return parsedCommand, errors.New("--shell expects a single script")
+	}
+
+	commands, err := configuration.SplitShellScript(commandToRun[2], os.LookupEnv)
+	if err != nil {
+		return parsedCommand, err
+	}
+
+	buildIndex := slices.IndexFunc(commands, isDockerBuildCommand)
+	if buildIndex == -1 {
+		return parsedCommand, errors.New("no docker build command found in the script")
+	}
+	buildCommand := commands[buildIndex]
+
+	parsedBuild, err := hashCommand(ctx, rememberOptions, act, buildCommand)
+	if err != nil {
+		return parsedCommand, err
+	}
+
+	if !hasPushFlag(buildCommand) {
+		missing := docker.MissingReferences(lo.Flatten(lo.Values(parsedBuild.TagsByTarget)), pushedByScript(commands[buildIndex+1:]))
+		if len(missing) > 0 {
+			return parsedCommand, fmt.Errorf("%w: the script does not push %s", errNoPush, strings.Join(missing, ", "))
+		}
+	}
+
+	// the whole script runs on cache miss
+	parsedBuild.Command = commandToRun
+	return parsedBuild, nil
+}
@@ -0,0 +1,112 @@
+package orchestrator
+
+import (
+	"testing"
+
+	"github.com/hytromo/mimosa/internal/cacher"
+	"github.com/hytromo/mimosa/internal/configuration"
+	"github.com/stretchr/testify/assert"
+)
+
+var shellBuildCommand = []string{"docker", "build", "-t", "myreg1/app:v1", "."}
+
+func shellRememberOptions(script string) configuration.RememberSubcommandOptions {
+	return configuration.RememberSubcommandOptions{Enabled: true, Shell: true, CommandToRun: ShellCommand(script)}
+}
+
+func TestRun_Shell_CacheHitRetagsWithoutRunningTheScript(t *testing.T) {
+	rememberOptions := shellRememberOptions("docker build -t myreg1/app:v1 . && docker push myreg1/app:v1")
+	mockActions := &MockActions{}
+	parsedCommand := batchParsedCommand(shellBuildCommand, TestHash, "myreg1/app:v1")
+	cacheTagPairs := map[string][]cacher.CacheTagPair{
+		"default": {{CacheTag: "myreg1/app:mimosa-content-hash-" + TestHash, NewTag: "myreg1/app:v1"}},
+	}
+
+	mockActions.On("ParseCommand", shellBuildCommand).Return(parsedCommand, nil)
+	mockActions.On("CheckRegistryCacheExists", TestHash, parsedCommand.TagsByTarget).Return(true, cacheTagPairs, nil)
+	mockActions.On("CheckPushPermission", cacheTagPairs, false).Return(nil)
+	mockActions.On("RetagFromCacheTags", cacheTagPairs, false).Return(nil)
+
+	err := HandleRememberSubcommand(rememberOptions, mockActions)
+
+	assert.NoError(t, err)
+	mockActions.AssertExpectations(t)
+	mockActions.AssertNotCalled(t, "RunCommand")
+}
+
+func TestRun_Shell_CacheMissRunsTheWholeScript(t *testing.T) {
+	rememberOptions := shellRememberOptions("echo building; docker --debug build -t myreg1/app:v1 . && docker image push myreg1/app:v1")
+	mockActions := &MockActions{}
+	buildCommand := []string{"docker", "--debug", "build", "-t", "myreg1/app:v1", "."}
+	parsedCommand := batchParsedCommand(buildCommand, TestHash, "myreg1/app:v1")
+
+	mockActions.On("ParseCommand", buildCommand).Return(parsedCommand, nil)
+	mockActions.On("CheckRegistryCacheExists", TestHash, parsedCommand.TagsByTarget).Return(false, nil, nil)
+	mockActions.On("RunCommand", false, rememberOptions.CommandToRun, cacheMissEnv(TestHash)).Return(0)
+	mockActions.On("SaveRegistryCacheTags", TestHash, parsedCommand.TagsByTarget, false).Return(nil)
+
+	err := HandleRememberSubcommand(rememberOptions, mockActions)
+
+	assert.NoError(t, err)
+	mockActions.AssertExpectations(t)
+}
+
+func TestRun_Shell_ScriptThatDoesNotPushAllTagsRunsWithoutCaching(t *testing.T) {
+	rememberOptions := shellRememberOptions("docker build -t myreg1/app:v1 -t myreg1/app:latest . && docker push myreg1/app:v1")
+	mockActions := &MockActions{}
+	buildCommand := []string{"docker", "build", "-t", "myreg1/app:v1", "-t", "myreg1/app:latest", "."}
+	parsedCommand := configuration.ParsedCommand{
+		Hash:         TestHash,
+		Command:      buildCommand,
+		TagsByTarget: map[string][]string{"default": {"myreg1/app:v1", "myreg1/app:latest"}},
+	}
+
+	mockActions.On("ParseCommand", buildCommand).Return(parsedCommand, nil)
+	mockActions.On("RunCommand", false, rememberOptions.CommandToRun).Return(0)
+	mockActions.On("ExitProcessWithCode", 0).Return()
+
+	err := HandleRememberSubcommand(rememberOptions, mockActions)
+
+	assert.ErrorIs(t, err, errNoPush)
+	assert.ErrorContains(t, err, "myreg1/app:latest")
+	mockActions.AssertExpectations(t)
+	mockActions.AssertNotCalled(t, "CheckRegistryCacheExists")
+}
+
+func TestRun_Shell_UnsupportedScriptRunsWithoutCaching(t *testing.T) {
+	for _, script := range []string{
+		"docker build -t myreg1/app:$(git rev-parse HEAD) --push .",
+		"echo no build here",
+	} {
+		rememberOptions := shellRememberOptions(script)
+		mockActions := &MockActions{}
+		mockActions.On("RunCommand", false, rememberOptions.CommandToRun).Return(0)
+		mockActions.On("ExitProcessWithCode", 0).Return()
+
+		err := HandleRememberSubcommand(rememberOptions, mockActions)
+
+		assert.Error(t, err, script)
+		mockActions.AssertExpectations(t)
+		mockActions.AssertNotCalled(t, "ParseCommand")
+	}
+}
+
+func TestIsDockerBuildCommand(t *testing.T) {
+	assert.True(t, isDockerBuildCommand([]string{"docker", "build", "."}))
+	assert.True(t, isDockerBuildCommand([]string{"docker", "--context", "remote", "buildx", "build", "."}))
+	assert.True(t, isDockerBuildCommand([]string{"docker", "buildx", "bake"}))
+	assert.False(t, isDockerBuildCommand([]string{"docker", "push", "org/app:v1"}))
+	assert.False(t, isDockerBuildCommand([]string{"docker", "buildx", "ls"}))
+	assert.False(t, isDockerBuildCommand([]string{"echo", "docker", "build"}))
+}
+
+func TestPushedByScript(t *testing.T) {
+	pushed := pushedByScript([][]string{
+		{"docker", "push", "--platform", "linux/amd64", "-q", "org/app:v1"},
+		{"docker", "image", "push", "org/app:latest"},
+		{"docker", "push", "--all-tags", "org/other"},
+		{"echo", "org/ignored:v1"},
+	})
+
+	assert.Equal(t, []string{"org/app:v1", "org/app:latest"}, pushed)
+}
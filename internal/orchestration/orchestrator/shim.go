@@ -0,0 +1,171 @@
+package orchestrator
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/hytromo/mimosa/internal/configuration"
+	"github.com/hytromo/mimosa/internal/docker"
+)
+
+const (
+	shimName   = "docker"
+	shimMarker = "# mimosa docker shim"
+	// set by the shim for mimosa, so that the docker commands mimosa runs reach the real docker instead of the shim
+	shimActiveEnv = "MIMOSA_SHIM_ACTIVE"
+	// kill-switch: the shim runs the real docker for everything
+	shimDisableEnv = "MIMOSA_SHIM_DISABLE"
+	// overrides the real docker that the shim was installed with
+	shimDockerEnv = "MIMOSA_SHIM_DOCKER"
+)
+
+// shellQuote quotes a word for sh
+func shellQuote(word string) string {
+	return "'" + strings.ReplaceAll(word, "'", `'\''`) + "'"
+}
+
+// shimScript returns the docker wrapper: "docker build", "docker buildx build" and "docker buildx bake" (or their
+// aliases, after any of docker's global flags) run through mimosa remember - everything else, and everything while a kill-switch is set,
+// runs the real docker as is
+func shimScript(options configuration.InstallShimOptions) string {
+	rememberArgs := make([]string, 0, len(options.RememberArgs))
+	for _, arg := range options.RememberArgs {
+		rememberArgs = append(rememberArgs, shellQuote(arg))
+	}
+
+	// the subcommands that run through mimosa, as case patterns
+	singleWordSubcommands, twoWordSubcommands, subcommandPrefixes := []string{}, []string{}, []string{}
+	for _, subcommand := range docker.CacheableSubcommands() {
+		if len(subcommand) == 1 {
+			singleWordSubcommands = append(singleWordSubcommands, subcommand[0])
+			continue
+		}
+		twoWordSubcommands = append(twoWordSubcommands, shellQuote(strings.Join(subcommand, " ")))
+		if !slices.Contains(subcommandPrefixes, subcommand[0]) {
+			subcommandPrefixes = append(subcommandPrefixes, subcommand[0])
+		}
+	}
+
+	var script bytes.Buffer
+	fmt.Fprintf(&script, `#!/bin/sh
+%s - installed by "mimosa install-shim docker", remove this file to uninstall
+real_docker=%s
+if [ -n "$%s" ]; then
+	real_docker="$%s"
+fi
+
+if [ -n "$%s" ] || [ -n "$%s" ] || [ -n "$%s" ]; then
+	exec "$real_docker" "$@"
+fi
+
+cacheable=""
+skip_value=""
+previous=""
+for arg in "$@"; do
+	if [ -n "$skip_value" ]; then
+		skip_value=""
+		continue
+	fi
+	if [ -n "$previous" ]; then
+		case "$previous $arg" in
+		%s) cacheable=1 ;;
+		esac
+		break
+	fi
+	case "$arg" in
+	%s) skip_value=1 ;;
+	-*) ;;
+	%s)
+		cacheable=1
+		break
+		;;
+	%s) previous="$arg" ;;
+	*) break ;;
+	esac
+done
+
+if [ -z "$cacheable" ]; then
+	exec "$real_docker" "$@"
+fi
+
+%s=1 exec %s remember %s-- docker "$@"
+`,
+		shimMarker,
+		shellQuote(options.DockerPath), shimDockerEnv, shimDockerEnv,
+		shimActiveEnv, shimDisableEnv, disableEnv,
+		strings.Join(twoWordSubcommands, " | "),
+		strings.Join(docker.GlobalFlagsWithValue(), " | "),
+		strings.Join(singleWordSubcommands, " | "),
+		strings.Join(subcommandPrefixes, " | "),
+		shimActiveEnv, shellQuote(options.MimosaPath), strings.Join(append(rememberArgs, ""), " "),
+	)
+	return script.String()
+}
+
+// HandleInstallShim writes the docker shim into the directory of the options, which must come before the real
+// docker in PATH
+func HandleInstallShim(options configuration.InstallShimOptions) error {
+	if options.Dir == "" {
+		return errors.New("--dir is required")
+	}
+	shimPath := filepath.Join(options.Dir, shimName)
+
+	realDockerDir, err := filepath.Abs(filepath.Dir(options.DockerPath))
+	if err != nil {
+		return err
+	}
+	shimDir, err := filepath.Abs(options.Dir)
+	if err != nil {
+		return err
+	}
+	if realDockerDir == shimDir {
+		return fmt.Errorf("the shim cannot be installed next to the real docker (%s) - pick a directory that comes before it in PATH", options.DockerPath)
+	}
+
+	if existing, err := os.ReadFile(shimPath); err == nil && !bytes.Contains(existing, []byte(shimMarker)) && !options.Force {
+		return fmt.Errorf("%s exists and is not a mimosa shim, use --force to replace it", shimPath)
+	}
+
+	if err := os.MkdirAll(options.Dir, 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(shimPath, []byte(shimScript(options)), 0o755); err != nil {
+		return fmt.Errorf("failed to write the shim: %w", err)
+	}
+	// the file may already exist with other permissions
+	if err := os.Chmod(shimPath, 0o755); err != nil {
+		return err
+	}
+
+	slog.Info("Installed the docker shim - make sure its directory comes before the real docker in PATH", "shim", shimPath, "docker", options.DockerPath)
+	return nil
+}
+
+// FindRealDocker returns the first docker executable in PATH that is not in the directory of the shim
+func FindRealDocker(shimDir string) (string, error) {
+	shimDir, err := filepath.Abs(shimDir)
+	if err != nil {
+		return "", err
+	}
+
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		if dir == "" {
+			continue
+		}
+		absoluteDir, err := filepath.Abs(dir)
+		if err != nil || absoluteDir == shimDir {
+			continue
+		}
+		candidate := filepath.Join(absoluteDir, shimName)
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() && info.Mode()&0o111 != 0 {
+			return candidate, nil
+		}
+	}
+	return "", errors.New("docker not found in PATH, use --docker to point to it")
+}
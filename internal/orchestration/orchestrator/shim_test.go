@@ -0,0 +1,120 @@
+package orchestrator
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hytromo/mimosa/internal/configuration"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeExecutable writes a script that prints its name and its arguments
+func writeExecutable(t *testing.T, path string, name string) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	require.NoError(t, os.WriteFile(path, []byte("#!/bin/sh\necho "+name+" \"$@\"\n"), 0o755))
+}
+
+func installTestShim(t *testing.T, rememberArgs ...string) string {
+	t.Helper()
+	root := t.TempDir()
+	dockerPath := filepath.Join(root, "real", "docker")
+	mimosaPath := filepath.Join(root, "bin", "mimosa")
+	writeExecutable(t, dockerPath, "real-docker")
+	writeExecutable(t, mimosaPath, "mimosa")
+
+	shimDir := filepath.Join(root, "shim")
+	require.NoError(t, HandleInstallShim(configuration.InstallShimOptions{
+		Dir:          shimDir,
+		MimosaPath:   mimosaPath,
+		DockerPath:   dockerPath,
+		RememberArgs: rememberArgs,
+	}))
+	return filepath.Join(shimDir, "docker")
+}
+
+func runShim(t *testing.T, shim string, env []string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command(shim, args...)
+	cmd.Env = append(os.Environ(), env...)
+	output, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(output))
+	return strings.TrimSpace(string(output))
+}
+
+func TestShim_RoutesBuildsThroughMimosa(t *testing.T) {
+	t.Setenv(disableEnv, "")
+	t.Setenv(shimDisableEnv, "")
+	t.Setenv(shimActiveEnv, "")
+	shim := installTestShim(t, "--hash-base-images", "it's quoted")
+
+	for _, args := range [][]string{
+		{"build", "-t", "app:v1", "."},
+		{"buildx", "build", "--push", "."},
+		{"buildx", "bake", "-f", "docker-bake.hcl"},
+		{"--context", "remote", "-D", "--host=tcp://x", "buildx", "build", "."},
+		{"builder", "build", "-t", "app:v1", "."},
+		{"buildx", "f"},
+	} {
+		assert.Equal(t, "mimosa remember --hash-base-images it's quoted -- docker "+strings.Join(args, " "), runShim(t, shim, nil, args...))
+	}
+
+	for _, args := range [][]string{
+		{"run", "alpine", "echo", "build"},
+		{"buildx", "ls"},
+		{"--context", "build", "ps"},
+		{"image", "ls"},
+		{"builder", "prune"},
+		{},
+	} {
+		assert.Equal(t, strings.TrimSpace("real-docker "+strings.Join(args, " ")), runShim(t, shim, nil, args...))
+	}
+}
+
+func TestShim_KillSwitches(t *testing.T) {
+	shim := installTestShim(t)
+
+	for _, env := range []string{shimDisableEnv + "=1", disableEnv + "=1", shimActiveEnv + "=1"} {
+		assert.Equal(t, "real-docker build .", runShim(t, shim, []string{env}, "build", "."), env)
+	}
+
+	otherDocker := filepath.Join(t.TempDir(), "docker")
+	writeExecutable(t, otherDocker, "other-docker")
+	assert.Equal(t, "other-docker ps", runShim(t, shim, []string{shimDockerEnv + "=" + otherDocker}, "ps"))
+}
+
+func TestHandleInstallShim_DoesNotReplaceOtherFiles(t *testing.T) {
+	shimDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(shimDir, "docker"), []byte("#!/bin/sh\n"), 0o755))
+	options := configuration.InstallShimOptions{Dir: shimDir, MimosaPath: "/usr/bin/mimosa", DockerPath: "/usr/bin/docker"}
+
+	assert.ErrorContains(t, HandleInstallShim(options), "is not a mimosa shim")
+
+	options.Force = true
+	require.NoError(t, HandleInstallShim(options))
+	options.Force = false
+	assert.NoError(t, HandleInstallShim(options), "a mimosa shim is replaced")
+
+	options.DockerPath = filepath.Join(shimDir, "docker")
+	assert.ErrorContains(t, HandleInstallShim(options), "next to the real docker")
+}
+
+func TestFindRealDocker(t *testing.T) {
+	shimDir := t.TempDir()
+	realDir := t.TempDir()
+	writeExecutable(t, filepath.Join(shimDir, "docker"), "shim")
+	writeExecutable(t, filepath.Join(realDir, "docker"), "real-docker")
+	t.Setenv("PATH", shimDir+string(os.PathListSeparator)+realDir)
+
+	dockerPath, err := FindRealDocker(shimDir)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(realDir, "docker"), dockerPath)
+
+	t.Setenv("PATH", shimDir)
+	_, err = FindRealDocker(shimDir)
+	assert.Error(t, err)
+}
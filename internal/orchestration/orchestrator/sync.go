@@ -0,0 +1,110 @@
+package orchestrator
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/hytromo/mimosa/internal/configuration"
+	"github.com/hytromo/mimosa/internal/hasher"
+	"github.com/hytromo/mimosa/internal/orchestration/actions"
+	"github.com/samber/lo"
+)
+
+// syncReconciler remembers the hash each build spec was last reconciled with, so that a spec is only
+// retagged/built again when something that affects its hash has changed
+type syncReconciler struct {
+	reconciled map[string]string
+}
+
+func newSyncReconciler() *syncReconciler {
+	return &syncReconciler{reconciled: map[string]string{}}
+}
+
+// reconcile runs a single pass over the specs, like a batch of their commands
+func (r *syncReconciler) reconcile(rememberOptions configuration.RememberSubcommandOptions, specs []configuration.SyncSpec, act actions.Actions) []*batchBuild {
+	commands := lo.Map(specs, func(spec configuration.SyncSpec, _ int) []string { return spec.FullCommand() })
+	// builds whose files are all in a checkout that is still clean at the same commit are not hashed again
+	hasher.SetGitTree(cleanGitTree())
+
+	builds := runBatch(rememberOptions, commands, act, func(i int, hash string) bool {
+		return r.reconciled[specs[i].Name] == hash
+	})
+
+	// forget the specs that were removed from the directory
+	specNames := lo.Map(specs, func(spec configuration.SyncSpec, _ int) string { return spec.Name })
+	for name := range r.reconciled {
+		if !lo.Contains(specNames, name) {
+			delete(r.reconciled, name)
+		}
+	}
+
+	for i, build := range builds {
+		switch build.status {
+		case batchStatusHit, batchStatusMiss, batchStatusRan:
+			if build.parsedCommand.Hash != "" {
+				r.reconciled[specs[i].Name] = build.parsedCommand.Hash
+			}
+		case batchStatusFailed, batchStatusSkipped:
+			// try again on the next pass
+			delete(r.reconciled, specs[i].Name)
+		}
+	}
+
+	return builds
+}
+
+// HandleSyncSubcommand reconciles the build specs of the directory: every spec is hashed, retagged on cache hit
+// and built on cache miss - again and again every interval, unless Once is set
+func HandleSyncSubcommand(syncOptions configuration.SyncSubcommandOptions, act actions.Actions) error {
+	if err := configureHashing(syncOptions.Remember); err != nil {
+		return err
+	}
+	if err := validatePushVerification(syncOptions.Remember); err != nil {
+		return err
+	}
+	if cachingDisabled() {
+		return errors.New(disableEnv + " is set, sync would run all the builds on every pass")
+	}
+	if !syncOptions.Once && syncOptions.Interval <= 0 {
+		return fmt.Errorf("invalid sync interval %s", syncOptions.Interval)
+	}
+
+	reconciler := newSyncReconciler()
+	for {
+		specs, err := configuration.LoadSyncSpecs(syncOptions.Dir)
+		if err == nil && len(specs) == 0 {
+			err = fmt.Errorf("no build specs found in %s", syncOptions.Dir)
+		}
+
+		if syncOptions.Once {
+			if err != nil {
+				return err
+			}
+			return reportBatch(reconciler.reconcile(syncOptions.Remember, specs, act), act)
+		}
+
+		if err != nil {
+			slog.Error("Cannot load the build specs, trying again on the next pass", "error", err)
+		} else {
+			reportSync(specs, reconciler.reconcile(syncOptions.Remember, specs, act))
+		}
+
+		time.Sleep(syncOptions.Interval)
+	}
+}
+
+// reportSync logs what happened to the specs that were not already up to date
+func reportSync(specs []configuration.SyncSpec, builds []*batchBuild) {
+	for i, build := range builds {
+		if build.status == batchStatusUpToDate {
+			continue
+		}
+		if build.status == batchStatusFailed {
+			slog.Error("Build spec failed, trying again on the next pass", "spec", specs[i].Name, "exitCode", build.exitCode)
+			continue
+		}
+		slog.Info("Build spec reconciled", "spec", specs[i].Name, "status", build.status, "hash", build.parsedCommand.Hash)
+	}
+}
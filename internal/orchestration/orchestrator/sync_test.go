@@ -0,0 +1,111 @@
+package orchestrator
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hytromo/mimosa/internal/cacher"
+	"github.com/hytromo/mimosa/internal/configuration"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSyncReconciler_OnlyReconcilesChangedSpecs(t *testing.T) {
+	rememberOptions := configuration.RememberSubcommandOptions{Enabled: true}
+	mockActions := &MockActions{}
+	specs := []configuration.SyncSpec{{Name: "api", Command: batchHitCommand}}
+
+	hitParsed := batchParsedCommand(batchHitCommand, "hash-api", "myreg1/api:v1")
+	changedParsed := batchParsedCommand(batchHitCommand, "hash-api-2", "myreg1/api:v1")
+	cacheTagPairs := map[string][]cacher.CacheTagPair{
+		"default": {{CacheTag: "myreg1/api:mimosa-content-hash-hash-api", NewTag: "myreg1/api:v1"}},
+	}
+
+	mockActions.On("ParseCommand", batchHitCommand).Return(hitParsed, nil).Twice()
+	mockActions.On("CheckRegistryCacheExists", "hash-api", hitParsed.TagsByTarget).Return(true, cacheTagPairs, nil).Once()
+	mockActions.On("CheckPushPermission", cacheTagPairs, false).Return(nil).Once()
+	mockActions.On("RetagFromCacheTags", cacheTagPairs, false).Return(nil).Once()
+
+	reconciler := newSyncReconciler()
+
+	builds := reconciler.reconcile(rememberOptions, specs, mockActions)
+	assert.Equal(t, batchStatusHit, builds[0].status)
+
+	// nothing changed: not checked against the cache again
+	builds = reconciler.reconcile(rememberOptions, specs, mockActions)
+	assert.Equal(t, batchStatusUpToDate, builds[0].status)
+
+	// the hash changed: built again
+	mockActions.On("ParseCommand", batchHitCommand).Return(changedParsed, nil).Once()
+	mockActions.On("CheckRegistryCacheExists", "hash-api-2", changedParsed.TagsByTarget).Return(false, nil, nil).Once()
+	mockActions.On("RunCommand", false, batchHitCommand, cacheMissEnv("hash-api-2")).Return(0).Once()
+	mockActions.On("SaveRegistryCacheTags", "hash-api-2", changedParsed.TagsByTarget, false).Return(nil).Once()
+
+	builds = reconciler.reconcile(rememberOptions, specs, mockActions)
+	assert.Equal(t, batchStatusMiss, builds[0].status)
+	assert.Equal(t, map[string]string{"api": "hash-api-2"}, reconciler.reconciled)
+
+	mockActions.AssertExpectations(t)
+}
+
+func TestSyncReconciler_RetriesFailedSpecsAndForgetsRemovedOnes(t *testing.T) {
+	rememberOptions := configuration.RememberSubcommandOptions{Enabled: true}
+	mockActions := &MockActions{}
+
+	missParsed := batchParsedCommand(batchMissCommand, "hash-web", "myreg1/web:v1")
+	mockActions.On("ParseCommand", batchMissCommand).Return(missParsed, nil)
+	mockActions.On("CheckRegistryCacheExists", "hash-web", missParsed.TagsByTarget).Return(false, nil, nil)
+	mockActions.On("RunCommand", false, batchMissCommand, cacheMissEnv("hash-web")).Return(1)
+
+	reconciler := newSyncReconciler()
+	reconciler.reconciled["removed"] = "hash-removed"
+
+	builds := reconciler.reconcile(rememberOptions, []configuration.SyncSpec{{Name: "web", Command: batchMissCommand}}, mockActions)
+	assert.Equal(t, batchStatusFailed, builds[0].status)
+	assert.Empty(t, reconciler.reconciled)
+
+	builds = reconciler.reconcile(rememberOptions, []configuration.SyncSpec{{Name: "web", Command: batchMissCommand}}, mockActions)
+	assert.Equal(t, batchStatusFailed, builds[0].status)
+
+	mockActions.AssertNumberOfCalls(t, "RunCommand", 2)
+	mockActions.AssertNotCalled(t, "SaveRegistryCacheTags")
+}
+
+func TestHandleSyncSubcommand_Once(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "web.yaml"), []byte("command: docker buildx build --push\ntags: [myreg1/web:v1]\ncontext: ./web"), 0644))
+
+	mockActions := &MockActions{}
+	missParsed := batchParsedCommand(batchMissCommand, "hash-web", "myreg1/web:v1")
+	command := []string{"docker", "buildx", "build", "--push", "--tag", "myreg1/web:v1", "./web"}
+	missParsed.Command = command
+
+	mockActions.On("ParseCommand", command).Return(missParsed, nil)
+	mockActions.On("CheckRegistryCacheExists", "hash-web", missParsed.TagsByTarget).Return(false, nil, nil)
+	mockActions.On("RunCommand", false, command, cacheMissEnv("hash-web")).Return(0)
+	mockActions.On("SaveRegistryCacheTags", "hash-web", missParsed.TagsByTarget, false).Return(nil)
+
+	err := HandleSyncSubcommand(configuration.SyncSubcommandOptions{
+		Dir:      dir,
+		Once:     true,
+		Remember: configuration.RememberSubcommandOptions{Enabled: true},
+	}, mockActions)
+
+	assert.NoError(t, err)
+	mockActions.AssertExpectations(t)
+}
+
+func TestHandleSyncSubcommand_Errors(t *testing.T) {
+	rememberOptions := configuration.RememberSubcommandOptions{Enabled: true}
+
+	err := HandleSyncSubcommand(configuration.SyncSubcommandOptions{Dir: t.TempDir(), Once: true, Remember: rememberOptions}, &MockActions{})
+	assert.ErrorContains(t, err, "no build specs found")
+
+	err = HandleSyncSubcommand(configuration.SyncSubcommandOptions{Dir: t.TempDir(), Remember: rememberOptions}, &MockActions{})
+	assert.ErrorContains(t, err, "invalid sync interval")
+
+	t.Setenv(disableEnv, "1")
+	err = HandleSyncSubcommand(configuration.SyncSubcommandOptions{Dir: t.TempDir(), Once: true, Remember: rememberOptions}, &MockActions{})
+	assert.ErrorContains(t, err, disableEnv)
+}
@@ -0,0 +1,52 @@
+package orchestrator
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/hytromo/mimosa/internal/configuration"
+	"github.com/hytromo/mimosa/internal/docker"
+	"github.com/hytromo/mimosa/internal/orchestration/actions"
+	"github.com/samber/lo"
+)
+
+// validatePushVerification checks the --verify-push mode and the push patterns before anything is run
+func validatePushVerification(rememberOptions configuration.RememberSubcommandOptions) error {
+	switch rememberOptions.VerifyPush {
+	case "", configuration.VerifyPushWarn, configuration.VerifyPushFail:
+	default:
+		return fmt.Errorf("invalid push verification mode %q, must be %s or %s", rememberOptions.VerifyPush, configuration.VerifyPushWarn, configuration.VerifyPushFail)
+	}
+
+	_, err := actions.CompilePushPatterns(rememberOptions.PushPatterns)
+	return err
+}
+
+// runCacheMissCommand runs the command of a cache miss - when push verification is enabled, it also checks that the
+// command output reports all of its tags as pushed. It returns the exit code and whether the cache tags can be saved
+func runCacheMissCommand(rememberOptions configuration.RememberSubcommandOptions, act actions.Actions, parsedCommand configuration.ParsedCommand) (int, bool) {
+	// nothing is pushed during a dry run, nor by local-only builds
+	if rememberOptions.VerifyPush == "" || rememberOptions.DryRun || parsedCommand.Local {
+		exitCode := act.RunCommand(rememberOptions.DryRun, parsedCommand.Command, cacheMissEnv(parsedCommand.Hash)...)
+		return exitCode, exitCode == 0
+	}
+
+	exitCode, pushedReferences := act.RunCommandScanningPushes(rememberOptions.DryRun, parsedCommand.Command, rememberOptions.PushPatterns, cacheMissEnv(parsedCommand.Hash))
+	if exitCode != 0 {
+		return exitCode, false
+	}
+
+	slog.Debug("Found pushed images in the command output", "references", pushedReferences)
+	missing := docker.MissingReferences(lo.Flatten(lo.Values(parsedCommand.TagsByTarget)), pushedReferences)
+	if len(missing) == 0 {
+		return exitCode, true
+	}
+
+	if rememberOptions.VerifyPush == configuration.VerifyPushFail {
+		slog.Error("The command output does not show these tags as pushed, not saving cache tags", "tags", missing)
+		return 1, false
+	}
+
+	slog.Warn("The command output does not show these tags as pushed", "tags", missing)
+	return exitCode, true
+}
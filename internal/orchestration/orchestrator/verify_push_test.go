@@ -0,0 +1,122 @@
+package orchestrator
+
+import (
+	"testing"
+
+	"github.com/hytromo/mimosa/internal/configuration"
+	"github.com/stretchr/testify/assert"
+)
+
+var verifyPushCommand = []string{"docker", "buildx", "build", "--push", "-t", "myreg1/myimage:v1", "-t", "myreg1/myimage:latest", "."}
+
+func verifyPushParsedCommand() configuration.ParsedCommand {
+	return configuration.ParsedCommand{
+		Hash:         TestHash,
+		Command:      verifyPushCommand,
+		TagsByTarget: map[string][]string{"default": {"myreg1/myimage:v1", "myreg1/myimage:latest"}},
+	}
+}
+
+func TestRun_VerifyPush_AllTagsPushed(t *testing.T) {
+	rememberOptions := configuration.RememberSubcommandOptions{
+		Enabled:      true,
+		CommandToRun: verifyPushCommand,
+		VerifyPush:   configuration.VerifyPushFail,
+		PushPatterns: []string{`pushed (\S+)`},
+	}
+	mockActions := &MockActions{}
+	parsedCommand := verifyPushParsedCommand()
+
+	mockActions.On("ParseCommand", verifyPushCommand).Return(parsedCommand, nil)
+	mockActions.On("CheckRegistryCacheExists", TestHash, parsedCommand.TagsByTarget).Return(false, nil, nil)
+	mockActions.On("RunCommandScanningPushes", false, verifyPushCommand, rememberOptions.PushPatterns, cacheMissEnv(TestHash)).
+		Return(0, []string{"docker.io/myreg1/myimage:v1", "myreg1/myimage:latest"})
+	mockActions.On("SaveRegistryCacheTags", TestHash, parsedCommand.TagsByTarget, false).Return(nil)
+
+	err := HandleRememberSubcommand(rememberOptions, mockActions)
+
+	assert.NoError(t, err)
+	mockActions.AssertExpectations(t)
+	mockActions.AssertNotCalled(t, "RunCommand")
+}
+
+func TestRun_VerifyPush_Warn_SavesCacheTags(t *testing.T) {
+	rememberOptions := configuration.RememberSubcommandOptions{
+		Enabled:      true,
+		CommandToRun: verifyPushCommand,
+		VerifyPush:   configuration.VerifyPushWarn,
+	}
+	mockActions := &MockActions{}
+	parsedCommand := verifyPushParsedCommand()
+
+	mockActions.On("ParseCommand", verifyPushCommand).Return(parsedCommand, nil)
+	mockActions.On("CheckRegistryCacheExists", TestHash, parsedCommand.TagsByTarget).Return(false, nil, nil)
+	mockActions.On("RunCommandScanningPushes", false, verifyPushCommand, []string(nil), cacheMissEnv(TestHash)).Return(0, []string{"myreg1/myimage:v1"})
+	mockActions.On("SaveRegistryCacheTags", TestHash, parsedCommand.TagsByTarget, false).Return(nil)
+
+	err := HandleRememberSubcommand(rememberOptions, mockActions)
+
+	assert.NoError(t, err)
+	mockActions.AssertExpectations(t)
+}
+
+func TestRun_VerifyPush_Fail_DoesNotSaveCacheTags(t *testing.T) {
+	rememberOptions := configuration.RememberSubcommandOptions{
+		Enabled:      true,
+		CommandToRun: verifyPushCommand,
+		VerifyPush:   configuration.VerifyPushFail,
+	}
+	mockActions := &MockActions{}
+	parsedCommand := verifyPushParsedCommand()
+
+	mockActions.On("ParseCommand", verifyPushCommand).Return(parsedCommand, nil)
+	mockActions.On("CheckRegistryCacheExists", TestHash, parsedCommand.TagsByTarget).Return(false, nil, nil)
+	mockActions.On("RunCommandScanningPushes", false, verifyPushCommand, []string(nil), cacheMissEnv(TestHash)).Return(0, []string{"myreg1/myimage:v1"})
+	mockActions.On("ExitProcessWithCode", 1).Return()
+
+	err := HandleRememberSubcommand(rememberOptions, mockActions)
+
+	assert.Error(t, err)
+	mockActions.AssertExpectations(t)
+	mockActions.AssertNotCalled(t, "SaveRegistryCacheTags")
+}
+
+func TestRun_VerifyPush_DryRunIsNotVerified(t *testing.T) {
+	rememberOptions := configuration.RememberSubcommandOptions{
+		Enabled:      true,
+		CommandToRun: verifyPushCommand,
+		DryRun:       true,
+		VerifyPush:   configuration.VerifyPushFail,
+	}
+	mockActions := &MockActions{}
+	parsedCommand := verifyPushParsedCommand()
+
+	mockActions.On("ParseCommand", verifyPushCommand).Return(parsedCommand, nil)
+	mockActions.On("CheckRegistryCacheExists", TestHash, parsedCommand.TagsByTarget).Return(false, nil, nil)
+	mockActions.On("RunCommand", true, verifyPushCommand, cacheMissEnv(TestHash)).Return(0)
+	mockActions.On("SaveRegistryCacheTags", TestHash, parsedCommand.TagsByTarget, true).Return(nil)
+
+	err := HandleRememberSubcommand(rememberOptions, mockActions)
+
+	assert.NoError(t, err)
+	mockActions.AssertExpectations(t)
+	mockActions.AssertNotCalled(t, "RunCommandScanningPushes")
+}
+
+func TestRun_VerifyPush_InvalidOptionsFallback(t *testing.T) {
+	for _, rememberOptions := range []configuration.RememberSubcommandOptions{
+		{Enabled: true, CommandToRun: verifyPushCommand, VerifyPush: "sometimes"},
+		{Enabled: true, CommandToRun: verifyPushCommand, VerifyPush: configuration.VerifyPushWarn, PushPatterns: []string{"no capture group"}},
+		{Enabled: true, CommandToRun: verifyPushCommand, VerifyPush: configuration.VerifyPushWarn, PushPatterns: []string{"(unclosed"}},
+	} {
+		mockActions := &MockActions{}
+		mockActions.On("RunCommand", false, verifyPushCommand).Return(0)
+		mockActions.On("ExitProcessWithCode", 0).Return()
+
+		err := HandleRememberSubcommand(rememberOptions, mockActions)
+
+		assert.Error(t, err)
+		mockActions.AssertExpectations(t)
+		mockActions.AssertNotCalled(t, "ParseCommand")
+	}
+}
@@ -0,0 +1,86 @@
+package orchestrator
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/hytromo/mimosa/internal/cacher"
+	"github.com/hytromo/mimosa/internal/configuration"
+	"github.com/hytromo/mimosa/internal/docker"
+	"github.com/hytromo/mimosa/internal/logger"
+	"github.com/hytromo/mimosa/internal/orchestration/actions"
+)
+
+// how often the registry cache is checked while waiting for another build to save it
+var cachePollInterval = 10 * time.Second
+
+// announcesBuilds reports whether the builds of the command announce themselves for --wait-for-cache
+func announcesBuilds(rememberOptions configuration.RememberSubcommandOptions, parsedCommand configuration.ParsedCommand) bool {
+	return rememberOptions.WaitForCache > 0 && !parsedCommand.Local && !pullForcesMiss(rememberOptions, parsedCommand)
+}
+
+// waitForCache turns a cache miss into a hit when another build of the same hash (e.g. another job of a CI matrix) has
+// announced itself and saves the cache within --wait-for-cache - otherwise this build announces itself, for the others
+// to wait for it. The waiting stops as soon as the other build is not announced anymore: its announcement expired or
+// it gave up on saving the cache
+func waitForCache(rememberOptions configuration.RememberSubcommandOptions, act actions.Actions, parsedCommand configuration.ParsedCommand) (bool, map[string][]cacher.CacheTagPair) {
+	if !announcesBuilds(rememberOptions, parsedCommand) {
+		return false, nil
+	}
+
+	announcedUntil, err := act.AnnounceRegistryBuild(parsedCommand.DockerConfigDir, parsedCommand.Hash, parsedCommand.TagsByTarget, rememberOptions.WaitForCache, rememberOptions.DryRun)
+	if err != nil {
+		slog.Warn("Failed to announce the build, running the command without waiting for other builds", "error", err)
+		return false, nil
+	}
+	if announcedUntil.IsZero() {
+		return false, nil
+	}
+
+	logger.Progress.Phase("waiting for another build to save the cache")
+	// there is no point in waiting past the announcement of the other build
+	deadline := time.Now().Add(rememberOptions.WaitForCache)
+	if announcedUntil.Before(deadline) {
+		deadline = announcedUntil
+	}
+	for time.Now().Before(deadline) {
+		time.Sleep(min(cachePollInterval, time.Until(deadline)))
+		docker.ForgetRegistryState()
+		exists, cacheTagsByTarget, err := checkCache(rememberOptions, act, parsedCommand)
+		if err != nil {
+			slog.Warn("Error checking registry cache, running the command", "error", err)
+			return false, nil
+		}
+		if exists && cachedImagesMatch(act, parsedCommand, cacheTagsByTarget) {
+			slog.Info("Another build saved the cache")
+			return true, cacheTagsByTarget
+		}
+
+		announcedUntil, err = act.RegistryBuildAnnouncedUntil(parsedCommand.DockerConfigDir, parsedCommand.Hash, parsedCommand.TagsByTarget)
+		if err != nil {
+			slog.Warn("Error checking the announcement of the other build, running the command", "error", err)
+			return false, nil
+		}
+		if announcedUntil.IsZero() {
+			slog.Warn("The other build is not announced anymore without having saved the cache, running the command")
+			return false, nil
+		}
+		if announcedUntil.Before(deadline) {
+			deadline = announcedUntil
+		}
+	}
+
+	slog.Warn("Timed out waiting for another build to save the cache, running the command", "waited", rememberOptions.WaitForCache)
+	return false, nil
+}
+
+// withdrawAnnouncement withdraws the announcement of a build that will not save the cache, so that the builds waiting
+// for it run their commands right away - a failure is only logged
+func withdrawAnnouncement(rememberOptions configuration.RememberSubcommandOptions, act actions.Actions, parsedCommand configuration.ParsedCommand) {
+	if !announcesBuilds(rememberOptions, parsedCommand) {
+		return
+	}
+	if err := act.WithdrawRegistryBuild(parsedCommand.DockerConfigDir, parsedCommand.Hash, parsedCommand.TagsByTarget); err != nil {
+		slog.Warn("Failed to withdraw the announcement of the build, the builds waiting for it wait until it expires", "error", err)
+	}
+}
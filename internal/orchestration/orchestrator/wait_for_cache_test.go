@@ -0,0 +1,167 @@
+package orchestrator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hytromo/mimosa/internal/cacher"
+	"github.com/hytromo/mimosa/internal/configuration"
+	"github.com/stretchr/testify/assert"
+)
+
+func useCachePollInterval(t *testing.T, interval time.Duration) {
+	t.Helper()
+	cachePollInterval = interval
+	t.Cleanup(func() {
+		cachePollInterval = 10 * time.Second
+	})
+}
+
+var waitForCacheCommand = []string{"docker", "build", "--push", "-t", "myreg1/myimage:v1", "."}
+
+func waitForCacheParsedCommand() configuration.ParsedCommand {
+	return configuration.ParsedCommand{
+		Hash:         TestHash,
+		Command:      waitForCacheCommand,
+		TagsByTarget: map[string][]string{"default": {"myreg1/myimage:v1"}},
+	}
+}
+
+func TestRemember_WaitForCache_AnotherBuildSavesTheCache(t *testing.T) {
+	useCachePollInterval(t, time.Millisecond)
+	rememberOptions := configuration.RememberSubcommandOptions{Enabled: true, CommandToRun: waitForCacheCommand, WaitForCache: time.Minute}
+	mockActions := &MockActions{}
+	parsedCommand := waitForCacheParsedCommand()
+	cacheTagPairs := map[string][]cacher.CacheTagPair{
+		"default": {{CacheTag: "myreg1/myimage:mimosa-content-hash-" + TestHash, NewTag: "myreg1/myimage:v1"}},
+	}
+
+	mockActions.On("ParseCommand", waitForCacheCommand).Return(parsedCommand, nil)
+	mockActions.On("CheckRegistryCacheExists", TestHash, parsedCommand.TagsByTarget).Return(false, nil, nil).Twice()
+	mockActions.On("AnnounceRegistryBuild", TestHash, parsedCommand.TagsByTarget, time.Minute, false).Return(time.Now().Add(time.Minute), nil)
+	mockActions.On("RegistryBuildAnnouncedUntil", TestHash, parsedCommand.TagsByTarget).Return(time.Now().Add(time.Minute), nil).Once()
+	mockActions.On("CheckRegistryCacheExists", TestHash, parsedCommand.TagsByTarget).Return(true, cacheTagPairs, nil).Once()
+	mockActions.On("CheckPushPermission", cacheTagPairs, false).Return(nil)
+	mockActions.On("RetagFromCacheTags", cacheTagPairs, false).Return(nil)
+
+	err := HandleRememberSubcommand(rememberOptions, mockActions)
+
+	assert.NoError(t, err)
+	mockActions.AssertExpectations(t)
+	mockActions.AssertNotCalled(t, "RunCommand", false, waitForCacheCommand, cacheMissEnv(TestHash))
+}
+
+func TestRemember_WaitForCache_TimesOut(t *testing.T) {
+	useCachePollInterval(t, time.Millisecond)
+	rememberOptions := configuration.RememberSubcommandOptions{Enabled: true, CommandToRun: waitForCacheCommand, WaitForCache: 10 * time.Millisecond}
+	mockActions := &MockActions{}
+	parsedCommand := waitForCacheParsedCommand()
+
+	mockActions.On("ParseCommand", waitForCacheCommand).Return(parsedCommand, nil)
+	mockActions.On("CheckRegistryCacheExists", TestHash, parsedCommand.TagsByTarget).Return(false, nil, nil)
+	mockActions.On("AnnounceRegistryBuild", TestHash, parsedCommand.TagsByTarget, 10*time.Millisecond, false).Return(time.Now().Add(time.Minute), nil)
+	mockActions.On("RegistryBuildAnnouncedUntil", TestHash, parsedCommand.TagsByTarget).Return(time.Now().Add(time.Minute), nil)
+	mockActions.On("RunCommand", false, waitForCacheCommand, cacheMissEnv(TestHash)).Return(0)
+	mockActions.On("SaveRegistryCacheTags", TestHash, parsedCommand.TagsByTarget, false).Return(nil)
+
+	err := HandleRememberSubcommand(rememberOptions, mockActions)
+
+	assert.NoError(t, err)
+	mockActions.AssertExpectations(t)
+}
+
+func TestRemember_WaitForCache_FirstBuildAnnouncesItself(t *testing.T) {
+	rememberOptions := configuration.RememberSubcommandOptions{Enabled: true, CommandToRun: waitForCacheCommand, WaitForCache: time.Minute}
+	mockActions := &MockActions{}
+	parsedCommand := waitForCacheParsedCommand()
+
+	mockActions.On("ParseCommand", waitForCacheCommand).Return(parsedCommand, nil)
+	mockActions.On("CheckRegistryCacheExists", TestHash, parsedCommand.TagsByTarget).Return(false, nil, nil).Once()
+	mockActions.On("AnnounceRegistryBuild", TestHash, parsedCommand.TagsByTarget, time.Minute, false).Return(time.Time{}, nil)
+	mockActions.On("RunCommand", false, waitForCacheCommand, cacheMissEnv(TestHash)).Return(0)
+	mockActions.On("SaveRegistryCacheTags", TestHash, parsedCommand.TagsByTarget, false).Return(nil)
+
+	err := HandleRememberSubcommand(rememberOptions, mockActions)
+
+	assert.NoError(t, err)
+	mockActions.AssertExpectations(t)
+}
+
+func TestRemember_WaitForCache_StopsWhenTheOtherBuildGivesUp(t *testing.T) {
+	useCachePollInterval(t, time.Millisecond)
+	rememberOptions := configuration.RememberSubcommandOptions{Enabled: true, CommandToRun: waitForCacheCommand, WaitForCache: time.Hour}
+	mockActions := &MockActions{}
+	parsedCommand := waitForCacheParsedCommand()
+
+	mockActions.On("ParseCommand", waitForCacheCommand).Return(parsedCommand, nil)
+	mockActions.On("CheckRegistryCacheExists", TestHash, parsedCommand.TagsByTarget).Return(false, nil, nil)
+	mockActions.On("AnnounceRegistryBuild", TestHash, parsedCommand.TagsByTarget, time.Hour, false).Return(time.Now().Add(time.Hour), nil)
+	// the other build withdrew its announcement
+	mockActions.On("RegistryBuildAnnouncedUntil", TestHash, parsedCommand.TagsByTarget).Return(time.Time{}, nil).Once()
+	mockActions.On("RunCommand", false, waitForCacheCommand, cacheMissEnv(TestHash)).Return(0)
+	mockActions.On("SaveRegistryCacheTags", TestHash, parsedCommand.TagsByTarget, false).Return(nil)
+
+	err := HandleRememberSubcommand(rememberOptions, mockActions)
+
+	assert.NoError(t, err)
+	mockActions.AssertExpectations(t)
+}
+
+func TestRemember_WaitForCache_StopsWhenTheOtherAnnouncementExpires(t *testing.T) {
+	useCachePollInterval(t, time.Millisecond)
+	rememberOptions := configuration.RememberSubcommandOptions{Enabled: true, CommandToRun: waitForCacheCommand, WaitForCache: time.Hour}
+	mockActions := &MockActions{}
+	parsedCommand := waitForCacheParsedCommand()
+	announcedUntil := time.Now().Add(20 * time.Millisecond)
+
+	mockActions.On("ParseCommand", waitForCacheCommand).Return(parsedCommand, nil)
+	mockActions.On("CheckRegistryCacheExists", TestHash, parsedCommand.TagsByTarget).Return(false, nil, nil)
+	mockActions.On("AnnounceRegistryBuild", TestHash, parsedCommand.TagsByTarget, time.Hour, false).Return(announcedUntil, nil)
+	mockActions.On("RegistryBuildAnnouncedUntil", TestHash, parsedCommand.TagsByTarget).Return(announcedUntil, nil)
+	mockActions.On("RunCommand", false, waitForCacheCommand, cacheMissEnv(TestHash)).Return(0)
+	mockActions.On("SaveRegistryCacheTags", TestHash, parsedCommand.TagsByTarget, false).Return(nil)
+
+	start := time.Now()
+	err := HandleRememberSubcommand(rememberOptions, mockActions)
+
+	assert.NoError(t, err)
+	assert.Less(t, time.Since(start), time.Minute)
+	mockActions.AssertExpectations(t)
+}
+
+func TestRemember_WaitForCache_FailedBuildWithdrawsItsAnnouncement(t *testing.T) {
+	rememberOptions := configuration.RememberSubcommandOptions{Enabled: true, CommandToRun: waitForCacheCommand, WaitForCache: time.Minute}
+	mockActions := &MockActions{}
+	parsedCommand := waitForCacheParsedCommand()
+
+	mockActions.On("ParseCommand", waitForCacheCommand).Return(parsedCommand, nil)
+	mockActions.On("CheckRegistryCacheExists", TestHash, parsedCommand.TagsByTarget).Return(false, nil, nil).Once()
+	mockActions.On("AnnounceRegistryBuild", TestHash, parsedCommand.TagsByTarget, time.Minute, false).Return(time.Time{}, nil)
+	mockActions.On("RunCommand", false, waitForCacheCommand, cacheMissEnv(TestHash)).Return(1)
+	mockActions.On("WithdrawRegistryBuild", TestHash, parsedCommand.TagsByTarget).Return(nil)
+	mockActions.On("ExitProcessWithCode", 1).Return()
+
+	err := HandleRememberSubcommand(rememberOptions, mockActions)
+
+	assert.Error(t, err)
+	mockActions.AssertExpectations(t)
+	mockActions.AssertNotCalled(t, "SaveRegistryCacheTags", TestHash, parsedCommand.TagsByTarget, false)
+}
+
+func TestRemember_WaitForCache_FailedSaveWithdrawsTheAnnouncement(t *testing.T) {
+	rememberOptions := configuration.RememberSubcommandOptions{Enabled: true, CommandToRun: waitForCacheCommand, WaitForCache: time.Minute}
+	mockActions := &MockActions{}
+	parsedCommand := waitForCacheParsedCommand()
+
+	mockActions.On("ParseCommand", waitForCacheCommand).Return(parsedCommand, nil)
+	mockActions.On("CheckRegistryCacheExists", TestHash, parsedCommand.TagsByTarget).Return(false, nil, nil).Once()
+	mockActions.On("AnnounceRegistryBuild", TestHash, parsedCommand.TagsByTarget, time.Minute, false).Return(time.Time{}, nil)
+	mockActions.On("RunCommand", false, waitForCacheCommand, cacheMissEnv(TestHash)).Return(0)
+	mockActions.On("SaveRegistryCacheTags", TestHash, parsedCommand.TagsByTarget, false).Return(assert.AnError)
+	mockActions.On("WithdrawRegistryBuild", TestHash, parsedCommand.TagsByTarget).Return(nil)
+
+	err := HandleRememberSubcommand(rememberOptions, mockActions)
+
+	assert.NoError(t, err)
+	mockActions.AssertExpectations(t)
+}
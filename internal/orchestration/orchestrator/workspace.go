@@ -0,0 +1,45 @@
+package orchestrator
+
+import (
+	"log/slog"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// workspaceRoot returns the directory that the paths of the commands are hashed relative to: the top-level directory
+// of the git repository, or the working directory outside of one
+func workspaceRoot() string {
+	output, err := exec.Command("git", "rev-parse", "--show-toplevel").Output()
+	if err == nil {
+		if root := strings.TrimSpace(string(output)); root != "" {
+			return root
+		}
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		slog.Debug("Cannot find the workspace root, paths are hashed as they are", "error", err)
+		return ""
+	}
+	return cwd
+}
+
+// cleanGitTree returns the top-level directory and the commit of the git checkout of the working directory, if nothing
+// in it differs from the commit - no changes, no untracked and no ignored files - and empty values otherwise
+func cleanGitTree() (root string, commit string) {
+	status, err := exec.Command("git", "status", "--porcelain", "--ignored").Output()
+	if err != nil || len(strings.TrimSpace(string(status))) > 0 {
+		return "", ""
+	}
+
+	output, err := exec.Command("git", "rev-parse", "--show-toplevel", "HEAD").Output()
+	if err != nil {
+		return "", ""
+	}
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	if len(lines) != 2 {
+		return "", ""
+	}
+	return lines[0], lines[1]
+}
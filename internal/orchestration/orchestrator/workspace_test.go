@@ -0,0 +1,62 @@
+package orchestrator
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorkspaceRoot(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	repository, err := filepath.EvalSymlinks(t.TempDir())
+	require.NoError(t, err)
+	require.NoError(t, exec.Command("git", "init", "-q", repository).Run())
+	subdir := filepath.Join(repository, "services", "api")
+	require.NoError(t, os.MkdirAll(subdir, 0o755))
+
+	t.Chdir(subdir)
+	assert.Equal(t, repository, workspaceRoot(), "the top-level directory of the repository")
+
+	outside, err := filepath.EvalSymlinks(t.TempDir())
+	require.NoError(t, err)
+	t.Chdir(outside)
+	t.Setenv("GIT_CEILING_DIRECTORIES", filepath.Dir(outside))
+	assert.Equal(t, outside, workspaceRoot(), "the working directory outside of a repository")
+}
+
+func TestCleanGitTree(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	repository, err := filepath.EvalSymlinks(t.TempDir())
+	require.NoError(t, err)
+	git := func(args ...string) {
+		t.Helper()
+		command := exec.Command("git", append([]string{"-C", repository, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		require.NoError(t, command.Run())
+	}
+	git("init", "-q")
+	require.NoError(t, os.WriteFile(filepath.Join(repository, "Dockerfile"), []byte("FROM scratch"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(repository, ".gitignore"), []byte("*.log"), 0o644))
+	git("add", ".")
+	git("commit", "-q", "-m", "initial")
+	t.Chdir(repository)
+
+	root, commit := cleanGitTree()
+	assert.Equal(t, repository, root)
+	assert.Len(t, commit, 40)
+
+	// an ignored file can be part of the build context too
+	require.NoError(t, os.WriteFile(filepath.Join(repository, "build.log"), []byte("log"), 0o644))
+	root, commit = cleanGitTree()
+	assert.Empty(t, root)
+	assert.Empty(t, commit)
+}
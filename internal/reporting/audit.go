@@ -0,0 +1,77 @@
+package reporting
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// the file every significant action of the run is appended to (--audit-log), "" does not keep them
+var auditLog struct {
+	mu   sync.Mutex
+	path string
+}
+
+// the actions of the audit log
+const (
+	AuditHashComputed   = "hash-computed"
+	AuditHashTimedOut   = "hash-timed-out"
+	AuditCacheLookup    = "cache-lookup"
+	AuditCacheSaved     = "cache-saved"
+	AuditRetag          = "retag"
+	AuditTagDeleted     = "tag-deleted"
+	AuditTagRestored    = "tag-restored"
+	AuditArtifactPushed = "artifact-pushed"
+	AuditNoopRebuild    = "noop-rebuild"
+)
+
+// ConfigureAuditLog makes every significant action of the run - what was decided and what was written to the
+// registries - be appended to the file as a JSON line ("" does not keep them)
+func ConfigureAuditLog(path string) {
+	auditLog.mu.Lock()
+	defer auditLog.mu.Unlock()
+	auditLog.path = path
+}
+
+// Audit appends a record of the action to the audit log, with the given key-value pairs (like slog's) - it never
+// fails the run, errors are only logged
+func Audit(action string, keyValues ...any) {
+	audit(action, time.Now(), keyValues...)
+}
+
+func audit(action string, now time.Time, keyValues ...any) {
+	auditLog.mu.Lock()
+	defer auditLog.mu.Unlock()
+	if auditLog.path == "" {
+		return
+	}
+
+	record := map[string]any{}
+	for i := 0; i+1 < len(keyValues); i += 2 {
+		record[fmt.Sprint(keyValues[i])] = keyValues[i+1]
+	}
+	record["time"] = now.UTC()
+	record["action"] = action
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		slog.Warn("Failed to write to the audit log", "file", auditLog.path, "error", err)
+		return
+	}
+
+	file, err := os.OpenFile(auditLog.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		slog.Warn("Failed to open the audit log", "file", auditLog.path, "error", err)
+		return
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		slog.Warn("Failed to write to the audit log", "file", auditLog.path, "error", err)
+	}
+}
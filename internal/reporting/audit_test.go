@@ -0,0 +1,33 @@
+package reporting
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAudit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	// nothing is written without an audit log
+	audit(AuditHashComputed, now, "hash", "h1")
+	assert.NoFileExists(t, path)
+
+	ConfigureAuditLog(path)
+	t.Cleanup(func() { ConfigureAuditLog("") })
+	audit(AuditHashComputed, now, "hash", "h1", "tags", map[string][]string{"default": {"myreg/app:v1"}})
+	audit(AuditRetag, now, "from", "myreg/app:mimosa-content-hash-h1", "to", "myreg/app:v1")
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	require.Len(t, lines, 2)
+	assert.JSONEq(t, `{"time":"2026-05-01T12:00:00Z","action":"hash-computed","hash":"h1","tags":{"default":["myreg/app:v1"]}}`, lines[0])
+	assert.JSONEq(t, `{"time":"2026-05-01T12:00:00Z","action":"retag","from":"myreg/app:mimosa-content-hash-h1","to":"myreg/app:v1"}`, lines[1])
+}
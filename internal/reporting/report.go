@@ -0,0 +1,108 @@
+package reporting
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/samber/lo"
+)
+
+const reportTimeout = 5 * time.Second
+
+// Record is what is reported for a single cacheable build - it is anonymized: the repositories of the build are only
+// sent hashed, and nothing about its files, arguments or tags is
+type Record struct {
+	// sha256 of the repositories the build pushes to, to group the builds of the same image(s)
+	Repository string `json:"repository"`
+	CacheHit   bool   `json:"cacheHit"`
+	// how long the build command ran - 0 on a cache hit, so the average of the misses of a repository is what a hit saves
+	BuildSeconds float64 `json:"buildSeconds"`
+	Version      string  `json:"version"`
+}
+
+var (
+	reportURL string
+	version   = "unknown"
+)
+
+// Configure sets the endpoint the records are POSTed to ("" disables reporting) and the mimosa version they report
+func Configure(url string, mimosaVersion string) {
+	reportURL = url
+	version = mimosaVersion
+}
+
+// NewRecord creates the record of a build that pushes the given tags
+func NewRecord(tags []string, cacheHit bool, buildDuration time.Duration) Record {
+	return Record{
+		Repository:   RepositoryID(tags),
+		CacheHit:     cacheHit,
+		BuildSeconds: buildDuration.Seconds(),
+		Version:      version,
+	}
+}
+
+// RepositoryID hashes the (sorted, unique) repositories of the tags, e.g. "myreg/app:v1" and "myreg/app:v2" both
+// are "myreg/app"
+func RepositoryID(tags []string) string {
+	sum := sha256.New()
+	for _, repository := range repositories(tags) {
+		sum.Write([]byte(repository))
+		sum.Write([]byte{0})
+	}
+	return hex.EncodeToString(sum.Sum(nil))
+}
+
+// repositories returns the sorted, unique repositories of the tags
+func repositories(tags []string) []string {
+	repositories := lo.Uniq(lo.Map(tags, func(tag string, _ int) string {
+		ref, err := name.ParseReference(tag)
+		if err != nil {
+			return tag
+		}
+		return ref.Context().Name()
+	}))
+	slices.Sort(repositories)
+	return repositories
+}
+
+// Send POSTs all the records of a run as a single JSON array - reporting never fails the run, errors are only logged
+func Send(records []Record) {
+	if reportURL == "" || len(records) == 0 {
+		return
+	}
+
+	if err := post(reportURL, records); err != nil {
+		slog.Warn("Failed to report the run", "url", reportURL, "error", err)
+		return
+	}
+	slog.Debug("Reported the run", "url", reportURL, "records", len(records))
+}
+
+func post(url string, records []Record) error {
+	body, err := json.Marshal(records)
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{Timeout: reportTimeout}
+	response, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+
+	if response.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", response.Status)
+	}
+	return nil
+}
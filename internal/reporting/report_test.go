@@ -0,0 +1,57 @@
+package reporting
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepositoryID(t *testing.T) {
+	assert.Equal(t, RepositoryID([]string{"myreg/app:v1"}), RepositoryID([]string{"myreg/app:v2", "myreg/app:v1"}), "tags of the same repository")
+	assert.Equal(t, RepositoryID([]string{"a/x:1", "b/y:1"}), RepositoryID([]string{"b/y:2", "a/x:2"}), "order does not matter")
+	assert.NotEqual(t, RepositoryID([]string{"myreg/app:v1"}), RepositoryID([]string{"myreg/web:v1"}))
+	assert.NotContains(t, RepositoryID([]string{"myreg/app:v1"}), "app")
+}
+
+func TestNewRecord(t *testing.T) {
+	Configure("", "v1.2.3")
+	t.Cleanup(func() { Configure("", "unknown") })
+
+	record := NewRecord([]string{"myreg/app:v1"}, false, 90*time.Second)
+	assert.Equal(t, Record{Repository: RepositoryID([]string{"myreg/app:v1"}), BuildSeconds: 90, Version: "v1.2.3"}, record)
+}
+
+func TestSend(t *testing.T) {
+	var received []Record
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+	}))
+	defer server.Close()
+
+	Configure(server.URL, "v1.2.3")
+	t.Cleanup(func() { Configure("", "unknown") })
+
+	records := []Record{NewRecord([]string{"myreg/app:v1"}, true, 0), NewRecord([]string{"myreg/web:v1"}, false, time.Minute)}
+	Send(records)
+	assert.Equal(t, records, received, "all the records are sent in a single request")
+}
+
+func TestSend_FailuresAreOnlyLogged(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	assert.Error(t, post(server.URL, []Record{{}}))
+
+	Configure(server.URL, "v1.2.3")
+	t.Cleanup(func() { Configure("", "unknown") })
+	Send([]Record{{}})
+}
@@ -0,0 +1,175 @@
+package reporting
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/samber/lo"
+)
+
+// the file the records of every run are appended to (--savings-file), "" does not keep them
+var savingsFile string
+
+// SavingsEntry is a line of the savings file: a build that hit or missed the cache. Unlike the reported records, it
+// is kept locally, so it names the repositories and the hash of the build
+type SavingsEntry struct {
+	Time         time.Time `json:"time"`
+	Repositories []string  `json:"repositories"`
+	Hash         string    `json:"hash"`
+	CacheHit     bool      `json:"cacheHit"`
+	BuildSeconds float64   `json:"buildSeconds"`
+}
+
+// SavingsSummary is what the cache saved the builds of the same repositories
+type SavingsSummary struct {
+	Repositories []string
+	Hits         int
+	Misses       int
+	// how long the misses ran
+	BuildSeconds float64
+	// how long the hits would have run: the duration of the miss that built the same hash or, if that is not in the
+	// file, the average duration of the misses of the repositories
+	SavedSeconds float64
+	// the hits that no miss of the repositories tells the duration of
+	HitsWithoutDuration int
+}
+
+// ConfigureSavingsFile makes every run append its records to the file ("" does not keep them)
+func ConfigureSavingsFile(path string) {
+	savingsFile = path
+}
+
+// NewSavingsEntry creates the savings entry of a build that pushes the given tags
+func NewSavingsEntry(tags []string, hash string, cacheHit bool, buildDuration time.Duration) SavingsEntry {
+	return SavingsEntry{
+		Repositories: repositories(tags),
+		Hash:         hash,
+		CacheHit:     cacheHit,
+		BuildSeconds: buildDuration.Seconds(),
+	}
+}
+
+// AppendSavings appends the entries of a run to the savings file, at the current time - like reporting, it never
+// fails the run, errors are only logged
+func AppendSavings(entries []SavingsEntry) {
+	appendSavings(entries, time.Now())
+}
+
+func appendSavings(entries []SavingsEntry, now time.Time) {
+	if savingsFile == "" || len(entries) == 0 {
+		return
+	}
+
+	file, err := os.OpenFile(savingsFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		slog.Warn("Failed to open the savings file", "file", savingsFile, "error", err)
+		return
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	for _, entry := range entries {
+		entry.Time = now.UTC()
+		line, err := json.Marshal(entry)
+		if err == nil {
+			_, err = file.Write(append(line, '\n'))
+		}
+		if err != nil {
+			slog.Warn("Failed to write to the savings file", "file", savingsFile, "error", err)
+			return
+		}
+	}
+}
+
+// ReadSavings reads the entries of a savings file
+func ReadSavings(path string) ([]SavingsEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	entries := []SavingsEntry{}
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var entry SavingsEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			return nil, fmt.Errorf("invalid savings entry on line %d: %w", lineNumber, err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, errors.New("no entries found in the savings file")
+	}
+	return entries, nil
+}
+
+// SummarizeSavings sums up the entries since the given time (the zero time is all of them) per repositories, sorted
+// by the time saved. The durations of the misses before the window still estimate the savings of the hits in it
+func SummarizeSavings(entries []SavingsEntry, since time.Time) []SavingsSummary {
+	missSeconds := map[string]float64{}
+	missDurations := map[string][]float64{}
+	for _, entry := range entries {
+		if !entry.CacheHit {
+			missSeconds[entry.Hash] = entry.BuildSeconds
+			key := strings.Join(entry.Repositories, ",")
+			missDurations[key] = append(missDurations[key], entry.BuildSeconds)
+		}
+	}
+
+	summaries := map[string]*SavingsSummary{}
+	for _, entry := range entries {
+		if entry.Time.Before(since) {
+			continue
+		}
+		key := strings.Join(entry.Repositories, ",")
+		summary, ok := summaries[key]
+		if !ok {
+			summary = &SavingsSummary{Repositories: entry.Repositories}
+			summaries[key] = summary
+		}
+
+		if !entry.CacheHit {
+			summary.Misses++
+			summary.BuildSeconds += entry.BuildSeconds
+			continue
+		}
+		summary.Hits++
+		if seconds, ok := missSeconds[entry.Hash]; ok {
+			summary.SavedSeconds += seconds
+		} else if durations := missDurations[key]; len(durations) > 0 {
+			summary.SavedSeconds += lo.Sum(durations) / float64(len(durations))
+		} else {
+			summary.HitsWithoutDuration++
+		}
+	}
+
+	sorted := lo.Map(lo.Values(summaries), func(summary *SavingsSummary, _ int) SavingsSummary { return *summary })
+	slices.SortFunc(sorted, func(a, b SavingsSummary) int {
+		if a.SavedSeconds != b.SavedSeconds {
+			if a.SavedSeconds > b.SavedSeconds {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(strings.Join(a.Repositories, ","), strings.Join(b.Repositories, ","))
+	})
+	return sorted
+}
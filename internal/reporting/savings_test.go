@@ -0,0 +1,71 @@
+package reporting
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func useSavingsFile(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "savings.jsonl")
+	ConfigureSavingsFile(path)
+	t.Cleanup(func() { ConfigureSavingsFile("") })
+	return path
+}
+
+func TestAppendAndReadSavings(t *testing.T) {
+	path := useSavingsFile(t)
+	day := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	appendSavings([]SavingsEntry{NewSavingsEntry([]string{"myreg/app:v1", "myreg/app:latest"}, "h1", false, 90*time.Second)}, day)
+	appendSavings([]SavingsEntry{NewSavingsEntry([]string{"myreg/app:v2"}, "h1", true, 0)}, day.Add(time.Hour))
+
+	entries, err := ReadSavings(path)
+	require.NoError(t, err)
+	assert.Equal(t, []SavingsEntry{
+		{Time: day, Repositories: []string{"index.docker.io/myreg/app"}, Hash: "h1", BuildSeconds: 90},
+		{Time: day.Add(time.Hour), Repositories: []string{"index.docker.io/myreg/app"}, Hash: "h1", CacheHit: true},
+	}, entries)
+}
+
+func TestReadSavings_Invalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "savings.jsonl")
+	require.NoError(t, os.WriteFile(path, []byte("{}\nnot json\n"), 0644))
+	_, err := ReadSavings(path)
+	assert.ErrorContains(t, err, "line 2")
+
+	require.NoError(t, os.WriteFile(path, []byte("\n"), 0644))
+	_, err = ReadSavings(path)
+	assert.Error(t, err)
+}
+
+func TestSummarizeSavings(t *testing.T) {
+	day := time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC)
+	app := []string{"myreg/app"}
+	web := []string{"myreg/web"}
+	entries := []SavingsEntry{
+		{Time: day, Repositories: app, Hash: "a1", BuildSeconds: 100},
+		{Time: day, Repositories: app, Hash: "a2", BuildSeconds: 200},
+		// the miss that built it is known
+		{Time: day.Add(48 * time.Hour), Repositories: app, Hash: "a1", CacheHit: true},
+		// the miss that built it is not in the file: the average of the misses of the repository
+		{Time: day.Add(48 * time.Hour), Repositories: app, Hash: "a3", CacheHit: true},
+		{Time: day.Add(48 * time.Hour), Repositories: web, Hash: "w1", CacheHit: true},
+	}
+
+	assert.Equal(t, []SavingsSummary{
+		{Repositories: app, Hits: 2, Misses: 2, BuildSeconds: 300, SavedSeconds: 250},
+		{Repositories: web, Hits: 1, HitsWithoutDuration: 1},
+	}, SummarizeSavings(entries, time.Time{}))
+
+	// the misses before the window still tell the durations of the hits in it
+	assert.Equal(t, []SavingsSummary{
+		{Repositories: app, Hits: 2, SavedSeconds: 250},
+		{Repositories: web, Hits: 1, HitsWithoutDuration: 1},
+	}, SummarizeSavings(entries, day.Add(24*time.Hour)))
+}
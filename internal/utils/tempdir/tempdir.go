@@ -0,0 +1,144 @@
+package tempdir
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// every run keeps its temp files (e.g. the build context read from stdin, the checkouts of remote bake definitions) in
+// its own "run-<pid>-*" dir of the mimosa temp dir, which is removed when the run exits - or, if the run was killed
+// before that, by the next run
+const (
+	baseDirName  = "mimosa-runs"
+	runDirPrefix = "run-"
+)
+
+var run struct {
+	mu  sync.Mutex
+	dir string
+}
+
+// baseDir returns the mimosa temp dir, which holds the temp dirs of all the runs of the user - each user has its own,
+// as the temp dir of the system is shared
+func baseDir() string {
+	if uid := os.Getuid(); uid >= 0 {
+		return filepath.Join(os.TempDir(), fmt.Sprintf("%s-%d", baseDirName, uid))
+	}
+	return filepath.Join(os.TempDir(), baseDirName)
+}
+
+// runDir returns the temp dir of this run, creating it the first time it is asked for
+func runDir() (string, error) {
+	run.mu.Lock()
+	defer run.mu.Unlock()
+
+	if run.dir != "" {
+		return run.dir, nil
+	}
+	if err := os.MkdirAll(baseDir(), 0o700); err != nil {
+		return "", fmt.Errorf("failed to create the mimosa temp dir: %w", err)
+	}
+	dir, err := os.MkdirTemp(baseDir(), fmt.Sprintf("%s%d-*", runDirPrefix, os.Getpid()))
+	if err != nil {
+		return "", fmt.Errorf("failed to create the temp dir of the run: %w", err)
+	}
+	run.dir = dir
+	return dir, nil
+}
+
+// MkdirTemp creates a new dir in the temp dir of the run, like os.MkdirTemp
+func MkdirTemp(pattern string) (string, error) {
+	dir, err := runDir()
+	if err != nil {
+		return "", err
+	}
+	return os.MkdirTemp(dir, pattern)
+}
+
+// CreateTemp creates a new file in the temp dir of the run, like os.CreateTemp
+func CreateTemp(pattern string) (*os.File, error) {
+	dir, err := runDir()
+	if err != nil {
+		return nil, err
+	}
+	return os.CreateTemp(dir, pattern)
+}
+
+// Cleanup removes the temp dir of the run with everything that is left in it - it must be called before exiting
+func Cleanup() {
+	run.mu.Lock()
+	defer run.mu.Unlock()
+
+	if run.dir == "" {
+		return
+	}
+	if err := os.RemoveAll(run.dir); err != nil {
+		slog.Debug("Failed to remove the temp dir of the run", "dir", run.dir, "error", err)
+		return
+	}
+	run.dir = ""
+}
+
+// CleanOrphans removes the temp dirs of the runs that did not clean up after themselves, because they were killed or
+// crashed: the ones of processes that are not running anymore - the dirs of running runs are kept, however long they
+// have been running (e.g. a long sync or build). It returns the removed dirs
+func CleanOrphans() ([]string, error) {
+	entries, err := os.ReadDir(baseDir())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	removed := []string{}
+	var errs []error
+	for _, entry := range entries {
+		dir := filepath.Join(baseDir(), entry.Name())
+		if !entry.IsDir() || !isOrphaned(entry) || dir == currentRunDir() {
+			continue
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		removed = append(removed, dir)
+	}
+	return removed, errors.Join(errs...)
+}
+
+func currentRunDir() string {
+	run.mu.Lock()
+	defer run.mu.Unlock()
+	return run.dir
+}
+
+// isOrphaned reports whether the run of the temp dir is gone
+func isOrphaned(entry os.DirEntry) bool {
+	pidAndSuffix, ok := strings.CutPrefix(entry.Name(), runDirPrefix)
+	if !ok {
+		return false
+	}
+	pid, err := strconv.Atoi(strings.SplitN(pidAndSuffix, "-", 2)[0])
+	if err != nil {
+		return false
+	}
+	return !processRunning(pid)
+}
+
+// processRunning reports whether the process is running - processes of other users count as running. Signal 0 checks
+// the process without signaling it; on windows finding the process is the check
+func processRunning(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	return !errors.Is(process.Signal(syscall.Signal(0)), os.ErrProcessDone)
+}
@@ -0,0 +1,82 @@
+package tempdir
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// useTempDir points the mimosa temp dir to a new dir, and forgets the temp dir of the run afterwards
+func useTempDir(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	t.Cleanup(func() {
+		run.dir = ""
+	})
+}
+
+func TestMkdirTempAndCleanup(t *testing.T) {
+	useTempDir(t)
+
+	dir, err := MkdirTemp("context-*")
+	require.NoError(t, err)
+	file, err := CreateTemp("stdin-*")
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	runDir := filepath.Dir(dir)
+	assert.Equal(t, runDir, filepath.Dir(file.Name()), "the temp files of a run share its temp dir")
+	assert.Equal(t, baseDir(), filepath.Dir(runDir))
+	assert.Contains(t, filepath.Base(runDir), runDirPrefix+strconv.Itoa(os.Getpid())+"-")
+
+	Cleanup()
+	assert.NoDirExists(t, runDir)
+
+	// a new temp file after the cleanup gets a new temp dir
+	dir, err = MkdirTemp("context-*")
+	require.NoError(t, err)
+	assert.DirExists(t, dir)
+	Cleanup()
+}
+
+func TestCleanOrphans(t *testing.T) {
+	useTempDir(t)
+
+	// a process that has exited
+	exited := exec.Command("go", "version")
+	require.NoError(t, exited.Run())
+	orphaned := filepath.Join(baseDir(), runDirPrefix+strconv.Itoa(exited.Process.Pid)+"-1")
+	longRunning := filepath.Join(baseDir(), runDirPrefix+strconv.Itoa(os.Getppid())+"-2")
+	running := filepath.Join(baseDir(), runDirPrefix+strconv.Itoa(os.Getppid())+"-3")
+	other := filepath.Join(baseDir(), "not-a-run")
+	for _, dir := range []string{orphaned, longRunning, running, other} {
+		require.NoError(t, os.MkdirAll(dir, 0o700))
+	}
+	old := time.Now().Add(-48 * time.Hour)
+	require.NoError(t, os.Chtimes(longRunning, old, old))
+
+	ownDir, err := MkdirTemp("context-*")
+	require.NoError(t, err)
+	defer Cleanup()
+
+	removed, err := CleanOrphans()
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{orphaned}, removed)
+	assert.DirExists(t, running)
+	assert.DirExists(t, longRunning, "the temp dir of a run that is still running is kept, however old")
+	assert.DirExists(t, other)
+	assert.DirExists(t, ownDir, "the temp dir of the run itself is kept")
+}
+
+func TestCleanOrphans_NoTempDir(t *testing.T) {
+	useTempDir(t)
+
+	removed, err := CleanOrphans()
+	assert.NoError(t, err)
+	assert.Empty(t, removed)
+}